@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Permission checks. Access() reports whether an operation on a name would be allowed,
+ *  without performing it, so that every entry point (the io/fs, http.FileSystem, WebDAV
+ *  and SFTP adapters) enforces the same rules: DBConfig.ReadOnly, append-only files, the
+ *  type of the file and, for a principal attached to the context, ACLs (see acl.go).
+ */
+
+import (
+    "context"
+    "strings"
+)
+
+type AccessMode int
+const ACCESS_EXIST            AccessMode = 0 /* Only whether the name exists */
+const (
+    ACCESS_READ               AccessMode = 1 << iota /* Read the contents of a file */
+    ACCESS_WRITE              /* Replace the contents of a file, or create names in a directory */
+    ACCESS_APPEND             /* Append to a file */
+    ACCESS_DELETE             /* Delete a file or directory */
+    ACCESS_LIST               /* List a directory */
+)
+
+/*
+ * Returns nil if every operation of `mode` on `name` is allowed, otherwise a *PathError
+ *  of ErrNotExist, ErrIsDirectory, ErrNotDirectory, ErrReadOnly, ErrAppendOnly or
+ *  ErrPermission. A directory may be named with or without its trailing "/"
+ */
+func (f *FSHeader) Access(name string, mode AccessMode) error {
+    return f.AccessCtx(context.Background(), name, mode)
+}
+
+func (f *FSHeader) AccessCtx(ctx context.Context, name string, mode AccessMode) error {
+    if f.isClosed() {
+        return ErrClosed
+    }
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    if err := f.syncPath(name); err != nil {
+        return err
+    }
+
+    file, dir := f.resolve(name)
+    if file == nil {
+        return pathError("access", name, ErrNotExist)
+    }
+
+    switch {
+    case dir == true && (mode & (ACCESS_READ | ACCESS_APPEND)) > 0:
+        return pathError("access", name, ErrIsDirectory)
+    case dir == false && (mode & ACCESS_LIST) > 0:
+        return pathError("access", name, ErrNotDirectory)
+    case f.config.ReadOnly == true && (mode & (ACCESS_WRITE | ACCESS_APPEND | ACCESS_DELETE)) > 0:
+        return pathError("access", name, ErrReadOnly)
+    case dir == false && (file.flags & FLAG_APPEND_ONLY) > 0 && (mode & (ACCESS_WRITE | ACCESS_DELETE)) > 0:
+        return pathError("access", name, ErrAppendOnly)
+    }
+
+    return f.checkACL("access", name, file, principalFromContext(ctx), mode)
+}
+
+/*
+ * Resolves a name to a file or directory, and whether it is a directory. Implicitly
+ *  created directories are keyed without the trailing "/", explicitly created ones with it
+ */
+func (f *FSHeader) resolve(name string) (*govfsFile, bool) {
+    if name == "" || name == "/" {
+        return f.check("/"), true
+    }
+
+    if file := f.check(name); file != nil {
+        return file, (file.flags & FLAG_DIRECTORY) > 0
+    }
+    if strings.HasSuffix(name, "/") == true {
+        /* A regular file of the same name is not the directory */
+        if file := f.check(strings.TrimSuffix(name, "/")); file != nil && (file.flags & FLAG_DIRECTORY) > 0 {
+            return file, true
+        }
+        return nil, false
+    }
+    if file := f.check(name + "/"); file != nil && (file.flags & FLAG_DIRECTORY) > 0 {
+        return file, true
+    }
+
+    return nil, false
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "errors"
+    "testing"
+    "io/fs"
+)
+
+func TestAccess(t *testing.T) {
+    debugOut("[+] Running Access Test...")
+
+    var filename = gen_raw_filename("test_access")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := New(filename)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/docs/")
+    header.Create("/docs/a.txt")
+    header.Write("/docs/a.txt", []byte("access"))
+    header.Create("/implicit/b.txt")
+    header.CreateAppendOnly("/audit.log", false)
+
+    for _, name := range []string{ "/docs/a.txt", "/docs", "/docs/", "/implicit", "/implicit/", "/", "" } {
+        if err := header.Access(name, ACCESS_EXIST); err != nil {
+            drive_fail("TEST2: Access() of an existing name failed: " + name, t)
+        }
+    }
+    if err := header.Access("/missing", ACCESS_EXIST); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST3: Access() of a missing name did not fail with ErrNotExist", t)
+    }
+    var perr *fs.PathError
+    if err := header.Access("/missing", ACCESS_READ); !errors.As(err, &perr) || perr.Path != "/missing" {
+        drive_fail("TEST4: Access() did not return a *PathError", t)
+    }
+
+    /* The type of the file */
+    if err := header.Access("/docs/a.txt", ACCESS_READ | ACCESS_WRITE | ACCESS_APPEND | ACCESS_DELETE); err != nil {
+        drive_fail("TEST5: Access() of a file failed", t)
+    }
+    if err := header.Access("/docs", ACCESS_LIST | ACCESS_WRITE | ACCESS_DELETE); err != nil {
+        drive_fail("TEST6: Access() of a directory failed", t)
+    }
+    if err := header.Access("/implicit", ACCESS_READ); !errors.Is(err, ErrIsDirectory) {
+        drive_fail("TEST7: ACCESS_READ of a directory did not fail with ErrIsDirectory", t)
+    }
+    if err := header.Access("/docs/", ACCESS_APPEND); !errors.Is(err, ErrIsDirectory) {
+        drive_fail("TEST8: ACCESS_APPEND of a directory did not fail with ErrIsDirectory", t)
+    }
+    if err := header.Access("/docs/a.txt", ACCESS_LIST); !errors.Is(err, ErrNotDirectory) {
+        drive_fail("TEST9: ACCESS_LIST of a file did not fail with ErrNotDirectory", t)
+    }
+    if err := header.Access("/docs/a.txt/", ACCESS_EXIST); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST9.1: A file was accessed as a directory", t)
+    }
+
+    /* Append-only files */
+    if err := header.Access("/audit.log", ACCESS_READ | ACCESS_APPEND); err != nil {
+        drive_fail("TEST10: Access() of an append-only file failed", t)
+    }
+    if err := header.Access("/audit.log", ACCESS_WRITE); !errors.Is(err, ErrAppendOnly) {
+        drive_fail("TEST11: ACCESS_WRITE of an append-only file did not fail with ErrAppendOnly", t)
+    }
+    if err := header.Access("/audit.log", ACCESS_DELETE); !errors.Is(err, ErrAppendOnly) {
+        drive_fail("TEST12: ACCESS_DELETE of an append-only file did not fail with ErrAppendOnly", t)
+    }
+
+    /* The io/fs adapter consults Access() */
+    if _, err := header.FS().Open("audit.log"); err != nil {
+        drive_fail("TEST13: FS().Open() of a readable file failed", t)
+    }
+
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST14: Failed to commit database", t)
+    }
+    header.Close()
+    if err := header.Access("/docs/a.txt", ACCESS_EXIST); !errors.Is(err, ErrClosed) {
+        drive_fail("TEST15: Access() of a closed database did not fail with ErrClosed", t)
+    }
+
+    /* Read-only databases */
+    loaded, err := Open(filename, ReadOnly())
+    if loaded == nil || err != nil {
+        drive_fail("TEST16: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+    if err := loaded.Access("/docs/a.txt", ACCESS_READ); err != nil {
+        drive_fail("TEST17: ACCESS_READ of a read-only database failed", t)
+    }
+    for _, mode := range []AccessMode{ ACCESS_WRITE, ACCESS_APPEND, ACCESS_DELETE } {
+        if err := loaded.Access("/docs/a.txt", mode); !errors.Is(err, ErrReadOnly) ||
+            !errors.As(err, &perr) || perr.Path != "/docs/a.txt" {
+            drive_fail("TEST18: Modifying a read-only database did not fail with a *PathError of ErrReadOnly", t)
+        }
+    }
+    if err := loaded.Access("/docs", ACCESS_WRITE); !errors.Is(err, ErrReadOnly) {
+        drive_fail("TEST19: Creating in a read-only database did not fail with ErrReadOnly", t)
+    }
+}
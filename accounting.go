@@ -0,0 +1,285 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Space accounting. The totals of the database and of every directory subtree are
+ *  maintained as files are created, resized and deleted, so that Statfs(), DirSize()
+ *  and GetTotalFilesizes() never walk the metadata table. Sizes are of the plaintext
+ *  data, whether it is held in memory, spilled or unloaded.
+ */
+
+import (
+    "sync"
+    "strings"
+)
+
+type Statfs struct {
+    Bytes       uint64 /* Size of all files, as GetTotalFilesizes() */
+    Files       uint
+    Directories uint /* Not including the root */
+    MemoryBytes uint64 /* Held in memory, as MemoryUsage() */
+    MaxMemory   uint64 /* DBConfig.MaxMemory, 0 if unlimited */
+}
+
+/*
+ * The zero value is an empty database. Every method may be called concurrently, the
+ *  IO controller keeps the totals consistent with the metadata table
+ */
+type accounting struct {
+    lock        sync.Mutex
+    bytes       int
+    files       int
+    dirs        int /* Not including the root */
+    directories map[string]int /* Entries referring to each directory, see add() */
+    subtrees    map[string]*subtree /* Keyed by directory, with a trailing "/" */
+    owners      map[string]int /* Bytes of the files of each OWNER_XATTR, see session.go */
+}
+
+type subtree struct {
+    bytes       int
+    files       int /* Regular files in the whole subtree */
+    entries     int /* Entries beneath the directory, and its own. The subtree is dropped at 0 */
+}
+
+/*
+ * Accounts for a new file or directory in the metadata table. A directory may be
+ *  referred to by two entries, see FSHeader.dispatch(), but is counted once
+ */
+func (a *accounting) add(name string, dir bool) {
+    a.lock.Lock()
+    defer a.lock.Unlock()
+
+    if a.subtrees == nil {
+        a.directories, a.subtrees = make(map[string]int), make(map[string]*subtree)
+    }
+
+    if dir == true {
+        name = dirKey(name)
+        if a.directories[name] += 1; a.directories[name] == 1 && name != "/" {
+            a.dirs += 1
+        }
+        a.subtree(name).entries += 1
+    } else {
+        a.files += 1
+    }
+
+    a.ancestors(name, func (_ string, t *subtree) {
+        t.entries += 1
+        if dir == false {
+            t.files += 1
+        }
+    })
+}
+
+/*
+ * Accounts for the removal of a file or directory of `size` bytes from the metadata table
+ */
+func (a *accounting) remove(name string, dir bool, size int) {
+    a.lock.Lock()
+    defer a.lock.Unlock()
+
+    if a.subtrees == nil {
+        return
+    }
+
+    if dir == true {
+        name = dirKey(name)
+        if a.directories[name] -= 1; a.directories[name] <= 0 {
+            delete(a.directories, name)
+            if name != "/" {
+                a.dirs -= 1
+            }
+        }
+        a.release(name, a.subtree(name))
+    } else {
+        a.files -= 1
+    }
+    a.bytes -= size
+
+    a.ancestors(name, func (key string, t *subtree) {
+        t.bytes -= size
+        if dir == false {
+            t.files -= 1
+        }
+        a.release(key, t)
+    })
+}
+
+/*
+ * Drops a reference to the subtree of `dir`. The lock must be held
+ */
+func (a *accounting) release(dir string, t *subtree) {
+    if t.entries -= 1; t.entries <= 0 {
+        delete(a.subtrees, dir)
+    }
+}
+
+/*
+ * Accounts for a file whose size changed by `delta` bytes
+ */
+func (a *accounting) resize(name string, delta int) {
+    if delta == 0 {
+        return
+    }
+
+    a.lock.Lock()
+    defer a.lock.Unlock()
+
+    if a.subtrees == nil {
+        a.directories, a.subtrees = make(map[string]int), make(map[string]*subtree)
+    }
+
+    a.bytes += delta
+    a.ancestors(name, func (_ string, t *subtree) {
+        t.bytes += delta
+    })
+}
+
+/*
+ * Replaces the totals with those of `files`, e.g. once a database is loaded
+ */
+func (a *accounting) rebuild(files []*govfsFile) {
+    a.lock.Lock()
+    a.bytes, a.files, a.dirs, a.directories, a.subtrees, a.owners = 0, 0, 0, nil, nil, nil
+    a.lock.Unlock()
+
+    for _, file := range files {
+        file.lock.Lock()
+        name, dir, size := file.filename, (file.flags & FLAG_DIRECTORY) > 0 || file.filename == "/", file.size
+        owner := fileOwner(file)
+        file.lock.Unlock()
+
+        a.add(name, dir)
+        if dir == false {
+            a.resize(name, size)
+            a.own(owner, size)
+        }
+    }
+}
+
+/*
+ * Accounts for `delta` bytes more of the files of `owner`. Files without an owner
+ *  are not counted
+ */
+func (a *accounting) own(owner string, delta int) {
+    if owner == "" || delta == 0 {
+        return
+    }
+
+    a.lock.Lock()
+    defer a.lock.Unlock()
+
+    if a.owners == nil {
+        a.owners = make(map[string]int)
+    }
+    if a.owners[owner] += delta; a.owners[owner] <= 0 {
+        delete(a.owners, owner)
+    }
+}
+
+func (a *accounting) owned(owner string) int {
+    a.lock.Lock()
+    defer a.lock.Unlock()
+
+    return a.owners[owner]
+}
+
+func (a *accounting) total() int {
+    a.lock.Lock()
+    defer a.lock.Unlock()
+
+    return a.bytes
+}
+
+/*
+ * Returns the size and number of files beneath `dir`, false if there is no such directory
+ */
+func (a *accounting) dirSize(dir string) (int, int, bool) {
+    a.lock.Lock()
+    defer a.lock.Unlock()
+
+    t, ok := a.subtrees[dirKey(dir)]
+    if ok == false {
+        return 0, 0, false
+    }
+
+    return t.bytes, t.files, true
+}
+
+/*
+ * Calls `fn` with the subtree of every directory above `name`, root first. The lock
+ *  must be held
+ */
+func (a *accounting) ancestors(name string, fn func (dir string, t *subtree)) {
+    trimmed := strings.TrimSuffix(name, "/")
+    for i := 0; i < len(trimmed); i += 1 {
+        if trimmed[i] == '/' {
+            fn(trimmed[:i + 1], a.subtree(trimmed[:i + 1]))
+        }
+    }
+}
+
+/*
+ * Directories are keyed with a trailing "/", whether or not the name has one
+ */
+func dirKey(name string) string {
+    if strings.HasSuffix(name, "/") {
+        return name
+    }
+    return name + "/"
+}
+
+/*
+ * The lock must be held
+ */
+func (a *accounting) subtree(dir string) *subtree {
+    t := a.subtrees[dir]
+    if t == nil {
+        t = new(subtree)
+        a.subtrees[dir] = t
+    }
+
+    return t
+}
+
+/*
+ * Returns the totals of the database, without walking it
+ */
+func (f *FSHeader) Statfs() (Statfs, error) {
+    if f.isClosed() {
+        return Statfs{}, ErrClosed
+    }
+
+    f.usage.lock.Lock()
+    output := Statfs{ Bytes: uint64(f.usage.bytes), Files: uint(f.usage.files), Directories: uint(f.usage.dirs) }
+    f.usage.lock.Unlock()
+
+    output.MemoryBytes = uint64(f.MemoryUsage())
+    if f.config.MaxMemory > 0 {
+        output.MaxMemory = uint64(f.config.MaxMemory)
+    }
+
+    return output, nil
+}
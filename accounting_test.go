@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "os"
+    "testing"
+)
+
+func TestAccounting(t *testing.T) {
+    debugOut("[+] Running Space Accounting Test...")
+
+    var filename = gen_raw_filename("accounting")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE | FLAG_COMPRESS)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    header.Create("/docs/a.txt")
+    header.Write("/docs/a.txt", []byte("hello"))
+    header.Create("/docs/old/b.txt")
+    header.Write("/docs/old/b.txt", []byte("world!"))
+    header.Create("/empty/")
+    header.Create("/c.txt")
+    header.Write("/c.txt", []byte("c"))
+    header.Write("/c.txt", []byte("shrunk")[:3])
+    header.Append("/c.txt", []byte("++"))
+
+    st, err := header.Statfs()
+    if err != nil || st.Bytes != 5 + 6 + 5 || st.Files != 3 || st.Directories != 3 {
+        drive_fail("TEST2: Invalid totals", t)
+    }
+    if bytes, files, err := header.DirSize("/docs/"); err != nil || bytes != 11 || files != 2 {
+        drive_fail("TEST3: Invalid size of a subtree", t)
+    }
+    if bytes, files, err := header.DirSize("/empty"); err != nil || bytes != 0 || files != 0 {
+        drive_fail("TEST4: Invalid size of an empty directory", t)
+    }
+
+    /* Deleting gives the space back */
+    header.Delete("/docs/old/b.txt")
+    header.Delete("/docs/old")
+    if st, _ := header.Statfs(); st.Bytes != 10 || st.Files != 2 || st.Directories != 2 ||
+        header.GetTotalFilesizes() != 10 {
+        drive_fail("TEST5: Invalid totals after delete", t)
+    }
+    if _, _, err := header.DirSize("/docs/old/"); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST6: Deleted directory still has a size", t)
+    }
+    checkAccounting(header, "TEST7", t)
+
+    /* Compressed files are accounted for by their plaintext size on load */
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST8: Failed to commit database", t)
+    }
+    header.Close()
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD | FLAG_COMPRESS)
+    if loaded == nil || err != nil {
+        drive_fail("TEST9: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+    if st, _ := loaded.Statfs(); st.Bytes != 10 || st.Files != 2 || st.Directories != 2 {
+        drive_fail("TEST10: Invalid totals after load", t)
+    }
+    checkAccounting(loaded, "TEST11", t)
+
+    loaded.Purge()
+    if st, _ := loaded.Statfs(); st.Bytes != 0 || st.Files != 0 || st.Directories != 0 {
+        drive_fail("TEST12: Invalid totals after purge", t)
+    }
+
+    debugOut("[+] Space Accounting Test PASS")
+}
+
+/*
+ * Compares the maintained totals with those of a walk of the metadata table
+ */
+func checkAccounting(header *FSHeader, test string, t *testing.T) {
+    var walked accounting
+    walked.rebuild(header.files())
+
+    if walked.bytes != header.usage.bytes || walked.files != header.usage.files ||
+        walked.dirs != header.usage.dirs || len(walked.subtrees) != len(header.usage.subtrees) {
+        drive_fail(test + ": Totals differ from the metadata table", t)
+    }
+    for dir, w := range walked.subtrees {
+        if u := header.usage.subtrees[dir]; u == nil || *u != *w {
+            drive_fail(test + ": Totals of " + dir + " differ from the metadata table", t)
+        }
+    }
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Access control lists. An ACL is an optional list of principals allowed or denied each
+ *  AccessMode on a file or directory, kept in the attribute ACL_XATTR so it is committed,
+ *  audited and replicated with the rest of the metadata. Operations with a principal
+ *  attached to their context (see WithPrincipal()) are checked against the ACL of the
+ *  file: the IO controller checks changes, ReadCtx() reads and AccessCtx() everything.
+ *  Operations without a principal, and files without an ACL, are not restricted. ACLs
+ *  are not inherited, creating a name is checked against its parent directory
+ */
+
+import (
+    "errors"
+    "path"
+    "strings"
+)
+
+const (
+    ACL_XATTR                 string    = "govfs.acl" /* The ACL of the file, one ACLEntry per line */
+    ACL_ANYONE                string    = "*" /* An ACLEntry principal matching every principal */
+    ACL_MODE_LETTERS          string    = "rwadl" /* ACCESS_READ through ACCESS_LIST, in ACL_XATTR */
+)
+
+type ACLEntry struct {
+    Principal   string /* See WithPrincipal(), or ACL_ANYONE */
+    Allow       AccessMode
+    Deny        AccessMode /* Takes precedence over Allow, of this or any other matching entry */
+}
+
+/*
+ * Replaces the ACL of a file or directory. An empty acl removes it, leaving the file
+ *  unrestricted. Cannot be changed by an operation with a principal
+ */
+func (f *FSHeader) SetACL(name string, acl []ACLEntry) error {
+    value, err := formatACL(acl)
+    if err != nil {
+        return pathError("setacl", name, err)
+    }
+
+    if len(acl) == 0 {
+        if err := f.RemoveXattr(name, ACL_XATTR); err != nil && !errors.Is(err, ErrNoAttribute) {
+            return err
+        }
+        return nil
+    }
+
+    return f.SetXattr(name, ACL_XATTR, value)
+}
+
+/*
+ * Returns the ACL of a file or directory, nil if it has none
+ */
+func (f *FSHeader) ACL(name string) ([]ACLEntry, error) {
+    attrs, err := f.Xattrs(name)
+    if err != nil {
+        return nil, err
+    }
+
+    value, ok := attrs[ACL_XATTR]
+    if ok == false {
+        return nil, nil
+    }
+
+    return parseACL(value)
+}
+
+/*
+ * Adds `mode` to what `principal` is allowed, and removes it from what it is denied
+ */
+func (f *FSHeader) Allow(name string, principal string, mode AccessMode) error {
+    return f.updateACL(name, principal, func (e *ACLEntry) {
+        e.Allow |= mode
+        e.Deny &^= mode
+    })
+}
+
+/*
+ * Adds `mode` to what `principal` is denied, and removes it from what it is allowed
+ */
+func (f *FSHeader) Deny(name string, principal string, mode AccessMode) error {
+    return f.updateACL(name, principal, func (e *ACLEntry) {
+        e.Deny |= mode
+        e.Allow &^= mode
+    })
+}
+
+/*
+ * Read-modify-write of ACL_XATTR under the path lock, see updateTags()
+ */
+func (f *FSHeader) updateACL(name string, principal string, update func (e *ACLEntry)) error {
+    unlock := f.lockPath(name)
+    defer unlock()
+
+    acl, err := f.ACL(name)
+    if err != nil {
+        return err
+    }
+
+    var entry *ACLEntry
+    for i := range acl {
+        if acl[i].Principal == principal {
+            entry = &acl[i]
+        }
+    }
+    if entry == nil {
+        acl = append(acl, ACLEntry{ Principal: principal })
+        entry = &acl[len(acl) - 1]
+    }
+    update(entry)
+
+    return f.SetACL(name, acl)
+}
+
+/*
+ * Returns true if the entries matching `principal` allow every bit of `mode`, and deny
+ *  none of them
+ */
+func aclAllows(acl []ACLEntry, principal string, mode AccessMode) bool {
+    var allow, deny AccessMode
+    for _, e := range acl {
+        if e.Principal == principal || e.Principal == ACL_ANYONE {
+            allow |= e.Allow
+            deny |= e.Deny
+        }
+    }
+
+    return (mode & deny) == 0 && (mode & allow) == mode
+}
+
+/*
+ * Fails with ErrPermission if the ACL of `file` denies `principal` any of `mode`. A
+ *  malformed ACL allows nothing
+ */
+func (f *FSHeader) checkACL(op string, name string, file *govfsFile, principal string, mode AccessMode) error {
+    if principal == "" || file == nil {
+        return nil
+    }
+
+    file.lock.Lock()
+    value, ok := file.xattrs[ACL_XATTR]
+    file.lock.Unlock()
+    if ok == false {
+        return nil
+    }
+
+    acl, _ := parseACL(value)
+    if aclAllows(acl, principal, mode) == false {
+        return pathError(op, name, ErrPermission)
+    }
+
+    return nil
+}
+
+/*
+ * Checks an IRP against the ACLs for its principal, called by dispatch()
+ */
+func (f *FSHeader) authorizeIRP(ioh *govfsIoBlock) error {
+    if ioh.principal == "" {
+        return nil
+    }
+
+    switch ioh.operation {
+    case IRP_DELETE:
+        return f.checkACL("delete", ioh.name, ioh.file, ioh.principal, ACCESS_DELETE)
+    case IRP_WRITE:
+        if (ioh.flags & FLAG_APPEND) > 0 {
+            return f.checkACL("write", ioh.name, ioh.file, ioh.principal, ACCESS_APPEND)
+        }
+        return f.checkACL("write", ioh.name, ioh.file, ioh.principal, ACCESS_WRITE)
+    case IRP_CREATE:
+        return f.checkACL("create", ioh.name, f.aclParent(ioh.name), ioh.principal, ACCESS_WRITE)
+    case IRP_XATTR:
+        if ioh.attr == ACL_XATTR || ioh.attr == OWNER_XATTR {
+            return pathError("setxattr", ioh.name, ErrPermission)
+        }
+        return f.checkACL("setxattr", ioh.name, ioh.file, ioh.principal, ACCESS_WRITE)
+    case IRP_PURGE:
+        for _, file := range f.files() {
+            if err := f.checkACL("purge", file.filename, file, ioh.principal, ACCESS_DELETE); err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
+
+/*
+ * Returns the closest existing directory above `name`. Create() makes any missing ones
+ */
+func (f *FSHeader) aclParent(name string) *govfsFile {
+    dir := path.Dir(strings.TrimSuffix(name, "/"))
+    for {
+        if file, isDir := f.resolve(dir); file != nil && isDir == true {
+            return file
+        }
+        if dir == "/" || dir == "." {
+            return nil
+        }
+        dir = path.Dir(dir)
+    }
+}
+
+func formatACL(acl []ACLEntry) (string, error) {
+    lines := make([]string, 0, len(acl))
+    for _, e := range acl {
+        if e.Principal == "" || strings.ContainsAny(e.Principal, "\n") {
+            return "", retErrStr("Invalid ACL principal " + e.Principal)
+        }
+        lines = append(lines, formatModes(e.Allow) + ":" + formatModes(e.Deny) + ":" + e.Principal)
+    }
+
+    return strings.Join(lines, "\n"), nil
+}
+
+/*
+ * Parses ACL_XATTR, each line being "<allow>:<deny>:<principal>" with the modes as
+ *  letters of ACL_MODE_LETTERS, e.g. "rl:w:alice"
+ */
+func parseACL(value string) ([]ACLEntry, error) {
+    var acl []ACLEntry
+    for _, line := range strings.Split(value, "\n") {
+        fields := strings.SplitN(line, ":", 3)
+        if len(fields) != 3 || fields[2] == "" {
+            return nil, retErrStr("Invalid ACL entry " + line)
+        }
+
+        allow, ok := parseModes(fields[0])
+        if ok == false {
+            return nil, retErrStr("Invalid ACL entry " + line)
+        }
+        deny, ok := parseModes(fields[1])
+        if ok == false {
+            return nil, retErrStr("Invalid ACL entry " + line)
+        }
+        acl = append(acl, ACLEntry{ Principal: fields[2], Allow: allow, Deny: deny })
+    }
+
+    return acl, nil
+}
+
+func formatModes(mode AccessMode) string {
+    var output []byte
+    for i := range ACL_MODE_LETTERS {
+        if (mode & (ACCESS_READ << uint(i))) > 0 {
+            output = append(output, ACL_MODE_LETTERS[i])
+        }
+    }
+
+    return string(output)
+}
+
+func parseModes(letters string) (AccessMode, bool) {
+    var mode AccessMode
+    for _, c := range letters {
+        i := strings.IndexRune(ACL_MODE_LETTERS, c)
+        if i < 0 {
+            return 0, false
+        }
+        mode |= ACCESS_READ << uint(i)
+    }
+
+    return mode, true
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "time"
+    "errors"
+    "context"
+    "testing"
+)
+
+func TestACL(t *testing.T) {
+    debugOut("[+] Running ACL Test...")
+
+    var filename = gen_raw_filename("test_acl")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := New(filename)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/private/")
+    header.Create("/private/notes.txt")
+    header.Write("/private/notes.txt", []byte("secret"))
+    header.Create("/public.txt")
+    header.Write("/public.txt", []byte("public"))
+
+    alice := WithPrincipal(context.Background(), "alice")
+    bob := WithPrincipal(context.Background(), "bob")
+
+    if acl, err := header.ACL("/private/notes.txt"); acl != nil || err != nil {
+        drive_fail("TEST2: ACL() of a file without an ACL failed", t)
+    }
+    if err := header.SetACL("/private/notes.txt", []ACLEntry{
+        { Principal: "alice", Allow: ACCESS_READ | ACCESS_WRITE | ACCESS_APPEND },
+        { Principal: ACL_ANYONE, Allow: ACCESS_READ },
+        { Principal: "bob", Deny: ACCESS_READ },
+    }); err != nil {
+        drive_fail("TEST3: SetACL() failed", t)
+    }
+    header.Allow("/private/", "alice", ACCESS_WRITE | ACCESS_LIST)
+    if acl, _ := header.ACL("/private/notes.txt"); len(acl) != 3 || acl[1].Principal != ACL_ANYONE || acl[0].Allow != ACCESS_READ | ACCESS_WRITE | ACCESS_APPEND {
+        drive_fail("TEST4: ACL() did not return the ACL", t)
+    }
+
+    /* Reads */
+    if data, err := header.ReadCtx(alice, "/private/notes.txt"); err != nil || string(data) != "secret" {
+        drive_fail("TEST5: ReadCtx() allowed by the ACL failed", t)
+    }
+    if _, err := header.ReadCtx(bob, "/private/notes.txt"); !errors.Is(err, ErrPermission) || !os.IsPermission(err) {
+        drive_fail("TEST6: ReadCtx() denied by the ACL did not fail with ErrPermission", t)
+    }
+    if _, err := header.ReadCtx(WithPrincipal(context.Background(), "carol"), "/private/notes.txt"); err != nil {
+        drive_fail("TEST7: ReadCtx() allowed by ACL_ANYONE failed", t)
+    }
+
+    /* Changes, checked by the IO controller */
+    if err := header.WriteCtx(alice, "/private/notes.txt", []byte("changed")); err != nil {
+        drive_fail("TEST8: WriteCtx() allowed by the ACL failed", t)
+    }
+    if err := header.WriteCtx(bob, "/private/notes.txt", []byte("forged")); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST9: WriteCtx() denied by the ACL did not fail with ErrPermission", t)
+    }
+    if err := header.AppendCtx(alice, "/private/notes.txt", []byte("!")); err != nil {
+        drive_fail("TEST10: AppendCtx() allowed by the ACL failed", t)
+    }
+    if err := header.DeleteCtx(alice, "/private/notes.txt"); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST11: DeleteCtx() denied by the ACL did not fail with ErrPermission", t)
+    }
+    if err := header.CreateCtx(alice, "/private/more.txt"); err != nil {
+        drive_fail("TEST12: CreateCtx() in a directory allowed by its ACL failed", t)
+    }
+    if err := header.CreateCtx(bob, "/private/sub/other.txt"); !errors.Is(err, ErrPermission) || header.Check("/private/sub/other.txt") {
+        drive_fail("TEST13: CreateCtx() in a directory denied by its ACL did not fail with ErrPermission", t)
+    }
+    if err := header.PurgeCtx(bob); !errors.Is(err, ErrPermission) || header.Check("/public.txt") == false {
+        drive_fail("TEST14: PurgeCtx() of files denied by their ACL did not fail with ErrPermission", t)
+    }
+
+    /* Files without an ACL, and operations without a principal, are not restricted */
+    if err := header.WriteCtx(bob, "/public.txt", []byte("changed")); err != nil {
+        drive_fail("TEST15: WriteCtx() of a file without an ACL failed", t)
+    }
+    if data, err := header.Read("/private/notes.txt"); err != nil || string(data) != "changed!" {
+        drive_fail("TEST16: Read() without a principal failed", t)
+    }
+
+    /* Access() */
+    if err := header.AccessCtx(alice, "/private/notes.txt", ACCESS_READ | ACCESS_APPEND); err != nil {
+        drive_fail("TEST17: AccessCtx() allowed by the ACL failed", t)
+    }
+    if err := header.AccessCtx(alice, "/private/notes.txt", ACCESS_DELETE); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST18: AccessCtx() denied by the ACL did not fail with ErrPermission", t)
+    }
+    if err := header.AccessCtx(bob, "/private", ACCESS_LIST); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST19: AccessCtx() of a directory denied by its ACL did not fail with ErrPermission", t)
+    }
+
+    /* Malformed ACLs are rejected */
+    if err := header.SetXattr("/public.txt", ACL_XATTR, "garbage"); err == nil {
+        drive_fail("TEST20: SetXattr() of a malformed ACL did not fail", t)
+    }
+    if err := header.SetACL("/public.txt", []ACLEntry{ { Principal: "", Allow: ACCESS_READ } }); err == nil {
+        drive_fail("TEST21: SetACL() without a principal did not fail", t)
+    }
+
+    /* Deny() takes a mode from an allow */
+    header.Deny("/private/notes.txt", "alice", ACCESS_WRITE)
+    if err := header.WriteCtx(alice, "/private/notes.txt", []byte("again")); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST22: WriteCtx() after Deny() did not fail with ErrPermission", t)
+    }
+
+    /* ACLs are committed with the metadata */
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST23: Failed to commit database", t)
+    }
+    header.Close()
+
+    loaded, err := Open(filename)
+    if loaded == nil || err != nil {
+        drive_fail("TEST24: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+    if _, err := loaded.ReadCtx(bob, "/private/notes.txt"); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST25: ACL was not committed", t)
+    }
+    if err := loaded.SetACL("/private/notes.txt", nil); err != nil {
+        drive_fail("TEST26: SetACL() of an empty ACL failed", t)
+    }
+    if _, err := loaded.ReadCtx(bob, "/private/notes.txt"); err != nil {
+        drive_fail("TEST27: ReadCtx() after removing the ACL failed", t)
+    }
+    if err := loaded.SetACL("/private/notes.txt", nil); err != nil {
+        drive_fail("TEST28: SetACL() of an empty ACL without an ACL failed", t)
+    }
+}
+
+func TestACLWriteBack(t *testing.T) {
+    debugOut("[+] Running ACL Write-Back Test...")
+
+    var filename = gen_raw_filename("test_acl_wb")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ WriteBackSize: 1024, WriteBackDelay: time.Hour }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+    header.Create("/log.txt")
+    header.SetACL("/log.txt", []ACLEntry{ { Principal: "alice", Allow: ACCESS_APPEND } })
+
+    /* Buffered writes are checked before they are buffered */
+    if err := header.AppendCtx(WithPrincipal(context.Background(), "alice"), "/log.txt", []byte("a")); err != nil {
+        drive_fail("TEST2: Buffered AppendCtx() allowed by the ACL failed", t)
+    }
+    if err := header.WriteCtx(WithPrincipal(context.Background(), "alice"), "/log.txt", []byte("b")); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST3: Buffered WriteCtx() denied by the ACL did not fail with ErrPermission", t)
+    }
+    if err := header.AppendCtx(WithPrincipal(context.Background(), "bob"), "/log.txt", []byte("c")); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST4: Buffered AppendCtx() denied by the ACL did not fail with ErrPermission", t)
+    }
+    header.Sync()
+    if data, _ := header.Read("/log.txt"); string(data) != "a" {
+        drive_fail("TEST5: Buffered writes were not checked", t)
+    }
+}
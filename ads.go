@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "strings"
+)
+
+const ADS_PREFIX              string    = "ads:"
+
+/*
+ * Returns a database name which keeps the raw fs stream in the `stream` NTFS alternate
+ *  data stream of `carrier`, e.g. ADSName(`C:\Users\me\photo.jpg`, "thumbs"). The
+ *  carrier must already exist; its contents and timestamps are left untouched, so the
+ *  database does not show up in directory listings or in the carrier's size. Only
+ *  supported on Windows
+ */
+func ADSName(carrier string, stream string) string {
+    return ADS_PREFIX + carrier + ":" + stream
+}
+
+func init() {
+    RegisterStorage(ADS_PREFIX, adsStorage{})
+}
+
+/*
+ * Splits "<carrier>:<stream>" on the last ":", a drive letter is part of the carrier
+ */
+func splitADS(name string) (string, string, error) {
+    i := strings.LastIndex(name, ":")
+    if i <= 0 || i == len(name) - 1 || strings.ContainsAny(name[i + 1:], `\/`) {
+        return "", "", retErrStr("ads: Expected <carrier>:<stream>, see ADSName()")
+    }
+
+    return name[:i], name[i + 1:], nil
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Alternate data streams only exist on NTFS
+ */
+type adsStorage struct{}
+
+func (adsStorage) Open(name string) (int64, error) {
+    return 0, retErrStr("ads: Alternate data streams are only supported on Windows")
+}
+
+func (adsStorage) Read(name string) ([]byte, error) {
+    return nil, retErrStr("ads: Alternate data streams are only supported on Windows")
+}
+
+func (adsStorage) Write(name string, data []byte) error {
+    return retErrStr("ads: Alternate data streams are only supported on Windows")
+}
+
+func (adsStorage) Delete(name string) error {
+    return retErrStr("ads: Alternate data streams are only supported on Windows")
+}
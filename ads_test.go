@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "time"
+    "bytes"
+    "runtime"
+    "testing"
+    "path/filepath"
+)
+
+func TestADSName(t *testing.T) {
+    debugOut("[+] Running ADS Name Test...")
+
+    for _, c := range []struct{ carrier, stream string }{
+        { `C:\Users\me\photo.jpg`, "thumbs" },
+        { `relative.txt`, "s" },
+        { `\\server\share\doc.pdf`, "govfs" },
+    } {
+        carrier, stream, err := splitADS(ADSName(c.carrier, c.stream)[len(ADS_PREFIX):])
+        if err != nil || carrier != c.carrier || stream != c.stream {
+            drive_fail("TEST1: ADS name did not round trip: " + c.carrier, t)
+        }
+    }
+
+    for _, name := range []string{ `photo.jpg`, `C:\photo.jpg`, `photo.jpg:`, `:stream` } {
+        if _, _, err := splitADS(name); err == nil {
+            drive_fail("TEST2: Accepted an invalid ADS name: " + name, t)
+        }
+    }
+}
+
+func TestADSStore(t *testing.T) {
+    debugOut("[+] Running ADS Store Test...")
+
+    carrier := filepath.Join(t.TempDir(), "carrier.txt")
+    contents := []byte("nothing to see here")
+    if err := os.WriteFile(carrier, contents, 0600); err != nil {
+        drive_fail("TEST1: Failed to create carrier", t)
+    }
+    modtime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+    os.Chtimes(carrier, modtime, modtime)
+
+    header, err := CreateDatabase(ADSName(carrier, "govfs"), FLAG_DB_CREATE | FLAG_ENCRYPT)
+    if header == nil || err != nil {
+        drive_fail("TEST2: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+    header.Create("/hidden")
+    header.Write("/hidden", []byte("hidden contents"))
+
+    if runtime.GOOS != "windows" {
+        if err := header.UnmountDB(0); err == nil {
+            drive_fail("TEST3: Committed to an ADS on " + runtime.GOOS, t)
+        }
+        return
+    }
+
+    reloaded, err := header.Commit()
+    if reloaded == nil || err != nil {
+        t.Skip("Alternate data streams are not supported here:", err)
+    }
+    defer reloaded.Close()
+
+    if data, err := reloaded.Read("/hidden"); err != nil || !bytes.Equal(data, []byte("hidden contents")) {
+        drive_fail("TEST4: Reloaded file has unexpected contents", t)
+    }
+
+    data, err := os.ReadFile(carrier)
+    if err != nil || !bytes.Equal(data, contents) {
+        drive_fail("TEST5: The carrier contents changed", t)
+    }
+    if info, err := os.Stat(carrier); err != nil || !info.ModTime().Equal(modtime) {
+        drive_fail("TEST6: The carrier modification time changed", t)
+    }
+}
@@ -0,0 +1,108 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "time"
+    "syscall"
+)
+
+/*
+ * Keeps the raw fs stream in an alternate data stream, "<carrier>:<stream>", which
+ *  the os package opens like any other path
+ */
+type adsStorage struct{}
+
+func (adsStorage) path(name string) (string, error) {
+    carrier, stream, err := splitADS(name)
+    if err != nil {
+        return "", err
+    }
+
+    return carrier + ":" + stream, nil
+}
+
+func (s adsStorage) Open(name string) (int64, error) {
+    path, err := s.path(name)
+    if err != nil {
+        return 0, err
+    }
+
+    return StorageFile.Open(path)
+}
+
+func (s adsStorage) Read(name string) ([]byte, error) {
+    path, err := s.path(name)
+    if err != nil {
+        return nil, err
+    }
+
+    return StorageFile.Read(path)
+}
+
+func (s adsStorage) Write(name string, data []byte) error {
+    return s.preserveCarrier(name, func (path string) error {
+        return StorageFile.Write(path, data)
+    })
+}
+
+func (s adsStorage) Delete(name string) error {
+    return s.preserveCarrier(name, StorageFile.Delete)
+}
+
+/*
+ * Writing to a stream updates the carrier's access and modification times, which
+ *  would give the database away. They are restored afterwards
+ */
+func (s adsStorage) preserveCarrier(name string, fn func (path string) error) error {
+    carrier, _, err := splitADS(name)
+    if err != nil {
+        return err
+    }
+    path, _ := s.path(name)
+
+    info, err := os.Stat(carrier)
+    if err != nil {
+        return err /* The carrier is never created */
+    }
+    if info.IsDir() {
+        return retErrStr("ads: The carrier must be a file")
+    }
+
+    var atime = info.ModTime()
+    if attr, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+        atime = time.Unix(0, attr.LastAccessTime.Nanoseconds())
+    }
+
+    status := fn(path)
+    if err := os.Chtimes(carrier, atime, info.ModTime()); err != nil && status == nil {
+        status = err
+    }
+
+    return status
+}
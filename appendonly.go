@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Append-only files, e.g. for audit logs kept inside the database. The IO controller
+ *  rejects every write which is not an append, and the deletion of the file, so bytes
+ *  once written cannot be changed. A chained file additionally frames each append as
+ *  a record which ends with the SHA-256 of the previous record's hash and its data, so
+ *  that ReadRecords() detects records which were altered outside of govfs, e.g. in the
+ *  raw fs file.
+ *
+ * Record layout of a chained file:
+ *  [4 byte big endian data length][data][32 byte hash]
+ */
+
+import (
+    "io"
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/binary"
+)
+
+const CHAIN_LENGTH_SIZE       int       = 4
+const CHAIN_HASH_LENGTH       int       = sha256.Size
+
+/*
+ * Creates an append-only file. If `chain` is set, each Append() is stored as a record
+ *  of the hash chain, see ReadRecords(). Write(), Delete() and Shred() of the file fail
+ *  with ErrAppendOnly; Purge() still removes it along with everything else.
+ */
+func (f *FSHeader) CreateAppendOnly(name string, chain bool) (err error) {
+    ctx, span := f.trace(context.Background(), TRACE_CREATE, name)
+    defer func () { span.End(0, err) }()
+
+    if len(name) == 0 || string(name[len(name) - 1:]) == "/" {
+        return pathError("create", name, ErrIsDirectory)
+    }
+
+    unlock := f.lockPath(name)
+    defer unlock()
+
+    irp, err := f.createIRP(ctx, name)
+    if err != nil {
+        return err
+    }
+    irp.flags |= FLAG_APPEND_ONLY
+    if chain == true {
+        irp.flags |= FLAG_HASH_CHAIN
+    }
+
+    output_irp, err := f.submitCtx(ctx, irp)
+    if err != nil {
+        return err
+    }
+
+    return output_irp.status
+}
+
+/*
+ * Returns the data of each record of a chained file, in the order they were appended.
+ *  Fails with ErrChainBroken if a record does not match the hash chain.
+ */
+func (f *FSHeader) ReadRecords(name string) ([][]byte, error) {
+    file := f.check(name)
+    if file == nil {
+        return nil, pathError("read", name, ErrNotExist)
+    }
+    if (file.flags & FLAG_HASH_CHAIN) == 0 {
+        return nil, retErrStr("ReadRecords: File is not a hash chain")
+    }
+
+    data, err := f.Read(name)
+    if err != nil {
+        return nil, err
+    }
+    if f.mem_cipher != nil {
+        defer wipeBuffer(data, false)
+    }
+
+    var records [][]byte
+    var prev = make([]byte, CHAIN_HASH_LENGTH)
+    for off := 0; off < len(data); {
+        if len(data) - off < CHAIN_LENGTH_SIZE + CHAIN_HASH_LENGTH {
+            return nil, pathError("read", name, ErrChainBroken)
+        }
+        length := int(binary.BigEndian.Uint32(data[off:]))
+        off += CHAIN_LENGTH_SIZE
+        if length > len(data) - off - CHAIN_HASH_LENGTH {
+            return nil, pathError("read", name, ErrChainBroken)
+        }
+
+        record := data[off:off + length]
+        hash := chainHash(prev, record)
+        if bytes.Equal(hash, data[off + length:off + length + CHAIN_HASH_LENGTH]) == false {
+            return nil, pathError("read", name, ErrChainBroken)
+        }
+
+        records = append(records, append([]byte(nil), record...))
+        prev = hash
+        off += length + CHAIN_HASH_LENGTH
+    }
+
+    return records, nil
+}
+
+func chainHash(prev []byte, data []byte) []byte {
+    h := sha256.New()
+    h.Write(prev)
+    h.Write(data)
+    return h.Sum(nil)
+}
+
+/*
+ * Frames `data` as the next record of the hash chain of `file`. The caller holds
+ *  file.lock
+ */
+func (f *FSHeader) chainRecord(file *govfsFile, data []byte) ([]byte, error) {
+    prev := make([]byte, CHAIN_HASH_LENGTH)
+    if file.size > 0 {
+        if file.size < CHAIN_LENGTH_SIZE + CHAIN_HASH_LENGTH {
+            return nil, pathError("append", file.filename, ErrChainBroken)
+        }
+        if err := f.loadUnloaded(file); err != nil {
+            return nil, err
+        }
+
+        if file.spill != nil {
+            _, err := f.spillReadAt(file, prev, int64(file.size - CHAIN_HASH_LENGTH))
+            if err != nil && err != io.EOF {
+                return nil, err
+            }
+        } else {
+            existing, err := f.unsealData(file)
+            if err != nil {
+                return nil, err
+            }
+            copy(prev, existing[len(existing) - CHAIN_HASH_LENGTH:])
+            if f.mem_cipher != nil {
+                wipeBuffer(existing, false)
+            }
+        }
+    }
+
+    record := make([]byte, CHAIN_LENGTH_SIZE, CHAIN_LENGTH_SIZE + len(data) + CHAIN_HASH_LENGTH)
+    binary.BigEndian.PutUint32(record, uint32(len(data)))
+    record = append(record, data...)
+    record = append(record, chainHash(prev, data)...)
+
+    return record, nil
+}
+
+func (f *FSHeader) isAppendOnly(name string) bool {
+    file := f.check(name)
+    return file != nil && (file.flags & FLAG_APPEND_ONLY) > 0
+}
+
+func (f *FSHeader) isChained(name string) bool {
+    file := f.check(name)
+    return file != nil && (file.flags & FLAG_HASH_CHAIN) > 0
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "errors"
+    "testing"
+)
+
+func TestAppendOnly(t *testing.T) {
+    debugOut("[+] Running Append-Only File Test...")
+
+    var filename = gen_raw_filename("test_appendonly")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    if err := header.CreateAppendOnly("/audit.log", false); err != nil {
+        drive_fail("TEST2: CreateAppendOnly() failed", t)
+    }
+    if err := header.Append("/audit.log", []byte("one,")); err != nil {
+        drive_fail("TEST3: Append() to an append-only file failed", t)
+    }
+    header.Append("/audit.log", []byte("two"))
+
+    /* Prior bytes cannot be replaced or removed */
+    if err := header.Write("/audit.log", []byte("forged")); !errors.Is(err, ErrAppendOnly) {
+        drive_fail("TEST4: Write() of an append-only file did not fail", t)
+    }
+    if err := header.Delete("/audit.log"); !errors.Is(err, ErrAppendOnly) {
+        drive_fail("TEST5: Delete() of an append-only file did not fail", t)
+    }
+    if err := header.Shred("/audit.log"); !errors.Is(err, ErrAppendOnly) {
+        drive_fail("TEST6: Shred() of an append-only file did not fail", t)
+    }
+    if data, _ := header.Read("/audit.log"); string(data) != "one,two" {
+        drive_fail("TEST7: Unexpected contents", t)
+    }
+
+    /* The file stays append-only across commits */
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST8: Failed to commit database", t)
+    }
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST9: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+
+    if err := loaded.Write("/audit.log", []byte("forged")); !errors.Is(err, ErrAppendOnly) {
+        drive_fail("TEST10: Append-only flag was not kept across a commit", t)
+    }
+    loaded.Append("/audit.log", []byte(",three"))
+    if data, _ := loaded.Read("/audit.log"); string(data) != "one,two,three" {
+        drive_fail("TEST11: Unexpected contents after load", t)
+    }
+}
+
+func TestHashChain(t *testing.T) {
+    debugOut("[+] Running Hash Chain Test...")
+
+    header, err := CreateDatabaseConfig("hash_chain", FLAG_DB_CREATE, &DBConfig{ WriteBackSize: 1024 })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.CreateAppendOnly("/chain", true)
+    for _, record := range []string{ "first", "", "third" } {
+        if err := header.Append("/chain", []byte(record)); err != nil {
+            drive_fail("TEST2: Append() to a chained file failed", t)
+        }
+    }
+
+    records, err := header.ReadRecords("/chain")
+    if err != nil || len(records) != 3 || string(records[0]) != "first" || len(records[1]) != 0 ||
+        string(records[2]) != "third" {
+        drive_fail("TEST3: ReadRecords() did not return the appended records", t)
+    }
+
+    /* Alter a record behind the back of the IO controller */
+    file := header.check("/chain")
+    file.lock.Lock()
+    data, _ := header.unsealData(file)
+    data[CHAIN_LENGTH_SIZE] ^= 0xff
+    header.writeInternal(file, data, false, true)
+    file.lock.Unlock()
+
+    if _, err := header.ReadRecords("/chain"); !errors.Is(err, ErrChainBroken) {
+        drive_fail("TEST4: ReadRecords() did not detect a tampered record", t)
+    }
+
+    header.Create("/plain")
+    if _, err := header.ReadRecords("/plain"); err == nil {
+        drive_fail("TEST5: ReadRecords() of a plain file did not fail", t)
+    }
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+)
+
+/*
+ * Asynchronous variants of Create/Write/Delete. The IRP is queued before returning, so
+ *  operations submitted from one goroutine are applied in order (per priority), and
+ *  the returned channel yields the status once the IO controller has processed it.
+ *  Write and Delete look up the file when called, so wait for a CreateAsync() before
+ *  writing to the new file.
+ */
+func (f *FSHeader) CreateAsync(name string) <-chan error {
+    return f.CreateAsyncCtx(context.Background(), name)
+}
+
+func (f *FSHeader) CreateAsyncCtx(ctx context.Context, name string) <-chan error {
+    unlock := f.lockPath(name)
+    defer unlock()
+
+    irp, err := f.createIRP(ctx, name)
+    if err != nil {
+        return completed(err)
+    }
+
+    return f.submitAsync(ctx, irp)
+}
+
+func (f *FSHeader) WriteAsync(name string, d []byte) <-chan error {
+    return f.WriteAsyncCtx(context.Background(), name, d)
+}
+
+func (f *FSHeader) WriteAsyncCtx(ctx context.Context, name string, d []byte) <-chan error {
+    if f.wb != nil {
+        /* Replaces any buffered data */
+        f.wb.flush_lock.Lock()
+        defer f.wb.flush_lock.Unlock()
+        f.discardPath(name)
+    }
+
+    irp, err := f.writeIRP(name, d, false)
+    if err != nil {
+        return completed(err)
+    }
+
+    return f.submitAsync(ctx, irp)
+}
+
+func (f *FSHeader) DeleteAsync(name string) <-chan error {
+    return f.DeleteAsyncCtx(context.Background(), name)
+}
+
+func (f *FSHeader) DeleteAsyncCtx(ctx context.Context, name string) <-chan error {
+    if f.wb != nil {
+        f.wb.flush_lock.Lock()
+        defer f.wb.flush_lock.Unlock()
+        f.discardPath(name)
+    }
+
+    irp, err := f.deleteIRP(name)
+    if err != nil {
+        return completed(err)
+    }
+
+    return f.submitAsync(ctx, irp)
+}
+
+/*
+ * Waits for all of the futures, and returns the first error encountered
+ */
+func WaitAll(futures ...<-chan error) error {
+    var status error = nil
+    for _, future := range futures {
+        if err := <- future; err != nil && status == nil {
+            status = err
+        }
+    }
+
+    return status
+}
+
+func (f *FSHeader) submitAsync(ctx context.Context, irp *govfsIoBlock) <-chan error {
+    if f.config.Direct == true {
+        output_irp, err := f.dispatchDirect(ctx, irp)
+        if err != nil {
+            return completed(err)
+        }
+        return completed(output_irp.status)
+    }
+
+    if err := f.enqueue(ctx, irp); err != nil {
+        return completed(err)
+    }
+
+    future := make(chan error, 1)
+    go func () {
+        output_irp, err := f.awaitIRP(ctx, irp)
+        if err != nil {
+            future <- err
+            return
+        }
+        future <- output_irp.status
+    }()
+
+    return future
+}
+
+func completed(err error) <-chan error {
+    future := make(chan error, 1)
+    future <- err
+
+    return future
+}
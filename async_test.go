@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "errors"
+    "strconv"
+)
+
+func TestAsync(t *testing.T) {
+    debugOut("[+] Running Async Operations Test...")
+
+    var filename = gen_raw_filename("test_async")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+
+    const files = 128
+    var futures []<-chan error
+    for i := 0; i < files; i += 1 {
+        futures = append(futures, header.CreateAsync("/bulk/file" + strconv.Itoa(i)))
+    }
+    if err := WaitAll(futures...); err != nil {
+        drive_fail("TEST2: Failed to create files: " + err.Error(), t)
+    }
+
+    /* Writes to the same file are applied in submission order */
+    futures = nil
+    for i := 0; i < files; i += 1 {
+        name := "/bulk/file" + strconv.Itoa(i)
+        futures = append(futures, header.WriteAsync(name, []byte("first")))
+        futures = append(futures, header.WriteAsync(name, []byte(name)))
+    }
+    if err := WaitAll(futures...); err != nil {
+        drive_fail("TEST3: Failed to write files: " + err.Error(), t)
+    }
+    for i := 0; i < files; i += 1 {
+        name := "/bulk/file" + strconv.Itoa(i)
+        if output, _ := header.Read(name); string(output) != name {
+            drive_fail("TEST4: Writes were applied out of order", t)
+        }
+    }
+
+    if err := <- header.DeleteAsync("/bulk/file0"); err != nil || header.Check("/bulk/file0") {
+        drive_fail("TEST5: Failed to delete file0", t)
+    }
+    if err := <- header.WriteAsync("/bulk/file0", []byte("deleted")); err == nil {
+        drive_fail("TEST6: Wrote to a deleted file", t)
+    }
+
+    header.Close()
+    if err := <- header.CreateAsync("/bulk/closed"); !errors.Is(err, ErrClosed) {
+        drive_fail("TEST7: CreateAsync succeeded after Close()", t)
+    }
+
+    debugOut("[+] Async Operations Test PASS")
+}
@@ -0,0 +1,329 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Audit log. With DBConfig.Audit set, every successful create, write, append, delete,
+ *  shred and purge is appended to a log which is persisted with the database: in the
+ *  raw fs stream header, or as the AUDIT_RECORD_NAME record of a RecordStorage. Each
+ *  entry carries an HMAC-SHA256 of the previous entry's hash and its own fields, keyed
+ *  by the database key, so that VerifyAudit() detects entries which were altered,
+ *  removed or reordered by anyone without the key.
+ *
+ * The log is never truncated, it grows with every mutation. A log which was loaded is
+ *  kept on commits even if DBConfig.Audit is no longer set.
+ */
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/gob"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const AUDIT_RECORD_NAME       string    = "govfs:audit" /* File names begin with "/", so this cannot collide */
+
+type AuditEntry struct {
+    Seq         uint64 /* Starts at 1 */
+    Time        time.Time
+    Op          string /* LOG_CREATE, LOG_WRITE, LOG_APPEND, LOG_DELETE, LOG_SHRED, LOG_PURGE or LOG_XATTR */
+    Path        string /* "/" for LOG_PURGE */
+    Size        int /* Bytes written */
+    Principal   string /* See WithPrincipal(), "" if the operation had none */
+    Hash        []byte
+}
+
+/*
+ * Selects entries in Audit(). Zero fields match every entry
+ */
+type AuditQuery struct {
+    Prefix      string /* Path, or the beginning of it */
+    Op          string
+    Principal   string
+    Since       time.Time /* Inclusive */
+    Until       time.Time /* Exclusive */
+}
+
+type auditLog struct {
+    lock        sync.Mutex
+    entries     []AuditEntry
+    committed   int /* Number of entries as of the last commit or load */
+}
+
+type principalKey struct{}
+
+/*
+ * Returns a context which records `principal` in the audit log for the operations of
+ *  the *Ctx() methods, and makes them as its session, see session.go
+ */
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+    return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func principalFromContext(ctx context.Context) string {
+    if p, ok := ctx.Value(principalKey{}).(string); ok == true {
+        return p
+    }
+
+    return ""
+}
+
+/*
+ * Returns the entries matching `query`, oldest first
+ */
+func (f *FSHeader) Audit(query AuditQuery) []AuditEntry {
+    f.audit.lock.Lock()
+    defer f.audit.lock.Unlock()
+
+    var output []AuditEntry
+    for _, e := range f.audit.entries {
+        if query.matches(&e) == false {
+            continue
+        }
+
+        e.Hash = append([]byte(nil), e.Hash...)
+        output = append(output, e)
+    }
+
+    return output
+}
+
+func (q *AuditQuery) matches(e *AuditEntry) bool {
+    switch {
+    case strings.HasPrefix(e.Path, q.Prefix) == false:
+        return false
+    case q.Op != "" && e.Op != q.Op:
+        return false
+    case q.Principal != "" && e.Principal != q.Principal:
+        return false
+    case q.Since.IsZero() == false && e.Time.Before(q.Since):
+        return false
+    case q.Until.IsZero() == false && e.Time.Before(q.Until) == false:
+        return false
+    }
+
+    return true
+}
+
+/*
+ * Recomputes the hash chain. Returns an error wrapping ErrAuditTampered which names the
+ *  first entry that does not match, nil if the log is intact
+ */
+func (f *FSHeader) VerifyAudit() error {
+    f.audit.lock.Lock()
+    defer f.audit.lock.Unlock()
+
+    key := f.config.fsKey()
+    defer ZeroKey(key)
+
+    var prev []byte
+    for i := range f.audit.entries {
+        e := &f.audit.entries[i]
+        if e.Seq != uint64(i + 1) || hmac.Equal(e.Hash, auditHash(key, prev, e)) == false {
+            return auditError(e.Seq)
+        }
+        prev = e.Hash
+    }
+
+    return nil
+}
+
+type auditTamperedError struct {
+    seq         uint64
+}
+
+func auditError(seq uint64) error {
+    return auditTamperedError{ seq: seq }
+}
+
+func (e auditTamperedError) Error() string {
+    return ErrAuditTampered.Error() + " at entry " + strconv.FormatUint(e.seq, 10)
+}
+
+func (auditTamperedError) Is(target error) bool {
+    return target == ErrAuditTampered
+}
+
+/*
+ * Called by dispatch() for every IRP it processed
+ */
+func (f *FSHeader) auditIRP(ioh *govfsIoBlock) {
+    if f.config.Audit == false || ioh.status != nil {
+        return
+    }
+
+    op := irpOp(ioh)
+    if op == "" {
+        return
+    }
+
+    name := ioh.name
+    if ioh.operation == IRP_PURGE {
+        name = "/"
+    }
+
+    f.audit.lock.Lock()
+    defer f.audit.lock.Unlock()
+
+    e := AuditEntry{
+        Seq: uint64(len(f.audit.entries) + 1),
+        Time: time.Now().Round(0),
+        Op: op,
+        Path: name,
+        Size: len(ioh.data),
+        Principal: ioh.principal,
+    }
+
+    var prev []byte
+    if len(f.audit.entries) > 0 {
+        prev = f.audit.entries[len(f.audit.entries) - 1].Hash
+    }
+
+    key := f.config.fsKey()
+    e.Hash = auditHash(key, prev, &e)
+    ZeroKey(key)
+
+    f.audit.entries = append(f.audit.entries, e)
+}
+
+func auditHash(key []byte, prev []byte, e *AuditEntry) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write(prev)
+
+    var n [8]byte
+    field := func (v []byte) {
+        binary.BigEndian.PutUint64(n[:], uint64(len(v)))
+        mac.Write(n[:])
+        mac.Write(v)
+    }
+
+    binary.BigEndian.PutUint64(n[:], e.Seq)
+    mac.Write(n[:])
+    binary.BigEndian.PutUint64(n[:], uint64(e.Time.UnixNano()))
+    mac.Write(n[:])
+    binary.BigEndian.PutUint64(n[:], uint64(e.Size))
+    mac.Write(n[:])
+    field([]byte(e.Op))
+    field([]byte(e.Path))
+    field([]byte(e.Principal))
+
+    return mac.Sum(nil)
+}
+
+/*
+ * Returns the entries to persist with a commit
+ */
+func (f *FSHeader) auditEntries() []AuditEntry {
+    f.audit.lock.Lock()
+    defer f.audit.lock.Unlock()
+
+    return f.audit.entries[:len(f.audit.entries):len(f.audit.entries)]
+}
+
+/*
+ * Called once `count` entries were persisted
+ */
+func (f *FSHeader) auditCommitted(count int) {
+    f.audit.lock.Lock()
+    defer f.audit.lock.Unlock()
+
+    if count > f.audit.committed {
+        f.audit.committed = count
+    }
+}
+
+/*
+ * The AUDIT_RECORD_NAME record for commitRecords(), nil if nothing was added since the
+ *  last commit
+ */
+func (f *FSHeader) auditRecord() (*Record, int, error) {
+    entries := f.auditEntries()
+    count := len(entries)
+
+    f.audit.lock.Lock()
+    committed := f.audit.committed
+    f.audit.lock.Unlock()
+    if count == committed {
+        return nil, count, nil
+    }
+
+    b := new(bytes.Buffer)
+    if err := gob.NewEncoder(b).Encode(entries); err != nil {
+        return nil, 0, err
+    }
+    data := b.Bytes()
+
+    if (f.flags & FLAG_ENCRYPT) > 0 {
+        key := f.config.fsKey()
+        encrypted, err := f.config.Cipher.Encrypt(data, key)
+        ZeroKey(key)
+        if err != nil {
+            return nil, 0, err
+        }
+        data = encrypted
+    }
+
+    return &Record{
+        Header: RawFile{ Name: AUDIT_RECORD_NAME, UnzippedLen: len(data) },
+        Data: data,
+    }, count, nil
+}
+
+/*
+ * Reads the AUDIT_RECORD_NAME record while loading a RecordStorage
+ */
+func (f *FSHeader) loadAuditRecord(config *DBConfig) error {
+    data, err := config.Records.ReadData(AUDIT_RECORD_NAME)
+    if err != nil {
+        return err
+    }
+
+    if (f.flags & FLAG_ENCRYPT) > 0 {
+        key := config.fsKey()
+        data, err = config.Cipher.Decrypt(data, key)
+        ZeroKey(key)
+        if err != nil {
+            return err
+        }
+    }
+
+    var entries []AuditEntry
+    if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil {
+        return err
+    }
+    f.setAudit(entries)
+
+    return nil
+}
+
+func (f *FSHeader) setAudit(entries []AuditEntry) {
+    f.audit.entries = entries
+    f.audit.committed = len(entries)
+}
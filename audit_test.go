@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "os"
+    "testing"
+    "time"
+)
+
+func TestAuditLog(t *testing.T) {
+    debugOut("[+] Running Audit Log Test...")
+
+    var filename = gen_raw_filename("test_audit")
+    defer os.Remove(filename)
+
+    config := &DBConfig{ Audit: true, Cipher: CipherAESGCM, Key: bytes.Repeat([]byte{ 7 }, 32) }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    ctx := WithPrincipal(context.Background(), "alice")
+    header.CreateCtx(ctx, "/docs/a.txt")
+    header.WriteCtx(ctx, "/docs/a.txt", []byte("hello"))
+    header.Append("/docs/a.txt", []byte(" world"))
+    header.Write("/missing", []byte("x")) /* Failed operations are not audited */
+    header.Delete("/docs/a.txt")
+
+    entries := header.Audit(AuditQuery{})
+    if len(entries) != 4 {
+        drive_fail("TEST2: Unexpected number of entries", t)
+    }
+    if e := entries[1]; e.Seq != 2 || e.Op != LOG_WRITE || e.Path != "/docs/a.txt" || e.Size != 5 ||
+        e.Principal != "alice" || e.Time.IsZero() {
+        drive_fail("TEST3: Invalid write entry", t)
+    }
+    if entries[2].Op != LOG_APPEND || entries[2].Principal != "" || entries[3].Op != LOG_DELETE {
+        drive_fail("TEST4: Invalid entries", t)
+    }
+    if len(header.Audit(AuditQuery{ Principal: "alice" })) != 2 || len(header.Audit(AuditQuery{ Prefix: "/docs/" })) != 4 ||
+        len(header.Audit(AuditQuery{ Op: LOG_DELETE })) != 1 || len(header.Audit(AuditQuery{ Since: time.Now() })) != 0 {
+        drive_fail("TEST5: Queries returned unexpected entries", t)
+    }
+    if err := header.VerifyAudit(); err != nil {
+        drive_fail("TEST6: Intact audit log failed verification", t)
+    }
+
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST7: Failed to commit", t)
+    }
+    header.Close()
+
+    /* The log is persisted with the stream */
+    header, err = CreateDatabaseConfig(filename, FLAG_DB_LOAD | FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        drive_fail("TEST8: Failed to load database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/b")
+    entries = header.Audit(AuditQuery{})
+    if len(entries) != 5 || entries[4].Seq != 5 || header.VerifyAudit() != nil {
+        drive_fail("TEST9: Audit log was not persisted", t)
+    }
+
+    /* Tampering breaks the chain */
+    header.audit.entries[1].Principal = "mallory"
+    if err := header.VerifyAudit(); !errors.Is(err, ErrAuditTampered) {
+        drive_fail("TEST10: Altered entry was not detected", t)
+    }
+    header.audit.entries[1].Principal = "alice"
+    header.audit.entries = append(header.audit.entries[:2], header.audit.entries[3:]...)
+    if err := header.VerifyAudit(); !errors.Is(err, ErrAuditTampered) {
+        drive_fail("TEST11: Removed entry was not detected", t)
+    }
+
+    debugOut("[+] Audit Log Test PASS")
+}
+
+func TestAuditRecords(t *testing.T) {
+    records := newMemRecords()
+    config := &DBConfig{ Records: records, Audit: true }
+    header, err := CreateDatabaseConfig("audit", FLAG_DB_LOAD | FLAG_DB_CREATE | FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+
+    header.Create("/a")
+    header.Write("/a", []byte("data"))
+    if err := header.UnmountDB(0); err != nil || records.puts != 2 || len(records.data[AUDIT_RECORD_NAME]) == 0 {
+        t.Fatal("TEST2: Audit record was not committed")
+    }
+    if bytes.Contains(records.data[AUDIT_RECORD_NAME], []byte("/a")) {
+        t.Fatal("TEST3: Audit record is not encrypted")
+    }
+    if err := header.UnmountDB(0); err != nil || records.puts != 0 {
+        t.Fatal("TEST4: Unchanged audit log was rewritten")
+    }
+
+    /* Purge keeps the audit record */
+    header.Purge()
+    if err := header.UnmountDB(0); err != nil || records.headers[AUDIT_RECORD_NAME].Name == "" {
+        t.Fatal("TEST5: Purge removed the audit record")
+    }
+    header.Close()
+
+    header, err = CreateDatabaseConfig("audit", FLAG_DB_LOAD | FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        t.Fatal("TEST6: Failed to load database")
+    }
+    defer header.Close()
+    if header.GetFileCount() != 1 || len(header.Audit(AuditQuery{})) != 3 || header.VerifyAudit() != nil {
+        t.Fatal("TEST7: Audit log was not loaded")
+    }
+}
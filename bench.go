@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Throughput of the IRP path, for `govfs bench` and regression tracking. Allocations
+ *  are process-wide, so they include those of the IO controller
+ */
+
+import (
+    "os"
+    "runtime"
+    "strconv"
+    "time"
+)
+
+const (
+    BENCH_DEFAULT_FILES       int       = 1000
+    BENCH_DEFAULT_SIZE        int       = 4096
+    BENCH_DIRECTORIES         int       = 64 /* Files are spread over this many directories */
+)
+
+type BenchOptions struct {
+    Files       int /* BENCH_DEFAULT_FILES if 0 */
+    Size        int /* Bytes per file, BENCH_DEFAULT_SIZE if 0 */
+    Flags       FlagVal /* FLAG_ENCRYPT, FLAG_COMPRESS */
+    Config      *DBConfig
+    CommitFlags FlagVal /* Passed to UnmountDB() */
+}
+
+/*
+ * The cost of one phase: "create", "write", "read", "commit" or "load"
+ */
+type BenchPhase struct {
+    Name        string
+    Ops         int
+    Bytes       int64 /* Plaintext bytes written or read, 0 for create */
+    Duration    time.Duration
+    Allocs      uint64
+    AllocBytes  uint64
+}
+
+func (p BenchPhase) OpsPerSec() float64 {
+    if p.Duration <= 0 {
+        return 0
+    }
+    return float64(p.Ops) / p.Duration.Seconds()
+}
+
+func (p BenchPhase) BytesPerSec() float64 {
+    if p.Duration <= 0 {
+        return 0
+    }
+    return float64(p.Bytes) / p.Duration.Seconds()
+}
+
+func (p BenchPhase) AllocsPerOp() uint64 {
+    if p.Ops == 0 {
+        return 0
+    }
+    return p.Allocs / uint64(p.Ops)
+}
+
+/*
+ * Creates a database at `name`, which must not exist, and measures creating, writing
+ *  and reading opts.Files files, committing the database and loading it back. The
+ *  database is removed afterwards
+ */
+func Bench(name string, opts BenchOptions) ([]BenchPhase, error) {
+    if opts.Files <= 0 {
+        opts.Files = BENCH_DEFAULT_FILES
+    }
+    if opts.Size <= 0 {
+        opts.Size = BENCH_DEFAULT_SIZE
+    }
+    if _, err := os.Stat(name); err == nil {
+        return nil, retErrStr("bench: " + name + " already exists")
+    }
+    defer os.Remove(name)
+
+    header, err := CreateDatabaseConfig(name, FLAG_DB_CREATE | opts.Flags, opts.Config)
+    if err != nil {
+        return nil, err
+    }
+    defer header.Close()
+    if err := header.StartIOController(); err != nil {
+        return nil, err
+    }
+
+    names := make([]string, opts.Files)
+    for i := range names {
+        names[i] = "/bench/d" + strconv.Itoa(i % BENCH_DIRECTORIES) + "/f" + strconv.Itoa(i)
+    }
+    data := make([]byte, opts.Size)
+    for i := range data {
+        data[i] = byte(i % 251)
+    }
+    total := int64(opts.Files) * int64(opts.Size)
+
+    var output []BenchPhase
+    phase := func (phaseName string, ops int, bytes int64, run func () error) error {
+        var before, after runtime.MemStats
+        runtime.GC()
+        runtime.ReadMemStats(&before)
+        start := time.Now()
+
+        if err := run(); err != nil {
+            return retErrStr("bench: " + phaseName + ": " + err.Error())
+        }
+
+        duration := time.Since(start)
+        runtime.ReadMemStats(&after)
+        output = append(output, BenchPhase{
+            Name: phaseName,
+            Ops: ops,
+            Bytes: bytes,
+            Duration: duration,
+            Allocs: after.Mallocs - before.Mallocs,
+            AllocBytes: after.TotalAlloc - before.TotalAlloc,
+        })
+        return nil
+    }
+    readAll := func (h *FSHeader) error {
+        for _, n := range names {
+            if _, err := h.Read(n); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    err = phase("create", opts.Files, 0, func () error {
+        for _, n := range names {
+            if err := header.Create(n); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    err = phase("write", opts.Files, total, func () error {
+        for _, n := range names {
+            if err := header.Write(n, data); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    if err := phase("read", opts.Files, total, func () error { return readAll(header) }); err != nil {
+        return nil, err
+    }
+
+    err = phase("commit", 1, total, func () error {
+        return header.UnmountDB(opts.CommitFlags)
+    })
+    if err != nil {
+        return nil, err
+    }
+    header.Close()
+
+    err = phase("load", opts.Files, total, func () error {
+        loaded, err := CreateDatabaseConfig(name, FLAG_DB_LOAD | opts.Flags, opts.Config)
+        if err != nil {
+            return err
+        }
+        defer loaded.Close()
+        if err := loaded.StartIOController(); err != nil {
+            return err
+        }
+
+        return readAll(loaded)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return output, nil
+}
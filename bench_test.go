@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "runtime"
+    "strconv"
+    "testing"
+)
+
+func TestBench(t *testing.T) {
+    debugOut("[+] Running Bench Harness Test...")
+
+    var filename = gen_raw_filename("bench_harness")
+    os.Remove(filename)
+
+    phases, err := Bench(filename, BenchOptions{ Files: 100, Size: 64, Flags: FLAG_COMPRESS })
+    if err != nil || len(phases) != 5 {
+        drive_fail("TEST1: Bench failed", t)
+    }
+    for i, name := range []string{ "create", "write", "read", "commit", "load" } {
+        if phases[i].Name != name || phases[i].Duration <= 0 || phases[i].OpsPerSec() <= 0 {
+            drive_fail("TEST2: Invalid phase " + name, t)
+        }
+    }
+    if phases[1].Ops != 100 || phases[1].Bytes != 100 * 64 || phases[1].Allocs == 0 {
+        drive_fail("TEST3: Invalid write phase", t)
+    }
+    if _, err := os.Stat(filename); err == nil {
+        drive_fail("TEST4: Database was not removed", t)
+    }
+
+    os.WriteFile(filename, []byte("existing"), 0600)
+    defer os.Remove(filename)
+    if _, err := Bench(filename, BenchOptions{}); err == nil {
+        drive_fail("TEST5: Bench overwrote an existing file", t)
+    }
+
+    debugOut("[+] Bench Harness Test PASS")
+}
+
+var benchSizes = []int{ 64, 4096, 65536, 1 << 20 }
+
+/*
+ * A database with `files` files of `size` bytes, each written once
+ */
+func benchDatabase(b *testing.B, files int, size int) (*FSHeader, []string, []byte) {
+    var filename = gen_raw_filename("bench_irp")
+    os.Remove(filename)
+    b.Cleanup(func () { os.Remove(filename) })
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        b.Fatal("Failed to create database")
+    }
+    header.StartIOController()
+    b.Cleanup(func () { header.Close() })
+
+    names := make([]string, files)
+    data := make([]byte, size)
+    for i := range names {
+        names[i] = "/bench/file" + strconv.Itoa(i)
+        header.Create(names[i])
+        header.Write(names[i], data)
+    }
+
+    return header, names, data
+}
+
+/*
+ * Also reports the heap retained by each empty file, less its name
+ */
+func BenchmarkCreate(b *testing.B) {
+    header, _, _ := benchDatabase(b, 0, 0)
+
+    names := make([]string, b.N)
+    for i := range names {
+        names[i] = "/bench/dir" + strconv.Itoa(i % 1000) + "/create" + strconv.Itoa(i)
+    }
+    var before, after runtime.MemStats
+    runtime.GC()
+    runtime.ReadMemStats(&before)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i += 1 {
+        header.Create(names[i])
+    }
+    b.StopTimer()
+
+    runtime.GC()
+    runtime.ReadMemStats(&after)
+    b.ReportMetric(float64(int64(after.HeapAlloc) - int64(before.HeapAlloc)) / float64(b.N), "heap-B/file")
+    runtime.KeepAlive(names)
+}
+
+func BenchmarkWrite(b *testing.B) {
+    for _, size := range benchSizes {
+        b.Run(strconv.Itoa(size), func (b *testing.B) {
+            header, names, data := benchDatabase(b, 64, size)
+
+            b.SetBytes(int64(size))
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i += 1 {
+                header.Write(names[i % len(names)], data)
+            }
+        })
+    }
+}
+
+func BenchmarkWriteOwned(b *testing.B) {
+    for _, size := range benchSizes {
+        b.Run(strconv.Itoa(size), func (b *testing.B) {
+            header, names, _ := benchDatabase(b, 64, size)
+
+            /* The file keeps each buffer, and returns the previous one */
+            buffers := make([][]byte, len(names))
+            for i := range buffers {
+                buffers[i] = make([]byte, size)
+            }
+
+            b.SetBytes(int64(size))
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i += 1 {
+                n := i % len(names)
+                data := buffers[n]
+                buffers[n] = header.check(names[n]).data
+                header.WriteOwned(names[n], data)
+            }
+        })
+    }
+}
+
+func BenchmarkRead(b *testing.B) {
+    for _, size := range benchSizes {
+        b.Run(strconv.Itoa(size), func (b *testing.B) {
+            header, names, _ := benchDatabase(b, 64, size)
+
+            b.SetBytes(int64(size))
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i += 1 {
+                header.Read(names[i % len(names)])
+            }
+        })
+    }
+}
+
+func BenchmarkReadInto(b *testing.B) {
+    for _, size := range benchSizes {
+        b.Run(strconv.Itoa(size), func (b *testing.B) {
+            header, names, _ := benchDatabase(b, 64, size)
+            buf := make([]byte, size)
+
+            b.SetBytes(int64(size))
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i += 1 {
+                header.ReadInto(names[i % len(names)], buf)
+            }
+        })
+    }
+}
+
+func BenchmarkCommit(b *testing.B) {
+    for _, files := range []int{ 100, 1000 } {
+        b.Run(strconv.Itoa(files), func (b *testing.B) {
+            header, _, _ := benchDatabase(b, files, 4096)
+
+            b.SetBytes(int64(files) * 4096)
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i += 1 {
+                if err := header.UnmountDB(0); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        })
+    }
+}
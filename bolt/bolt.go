@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+/*
+ * Package bolt keeps a govfs database in a bbolt file, one record per file, see
+ *  govfs.RecordStorage. Commits only write the files which changed, and loads only
+ *  read the catalog
+ */
+package bolt
+
+import (
+    "bytes"
+    "io/fs"
+    "encoding/gob"
+
+    "go.etcd.io/bbolt"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+var (
+    BUCKET_FILES    = []byte("files") /* RawFile headers, gob encoded */
+    BUCKET_DATA     = []byte("data") /* Stored file data */
+)
+
+type Storage struct {
+    db          *bbolt.DB
+}
+
+/*
+ * Opens or creates a bbolt file. Options may be nil. The file is locked until Close()
+ */
+func Open(path string, options *bbolt.Options) (*Storage, error) {
+    db, err := bbolt.Open(path, 0600, options)
+    if err != nil {
+        return nil, err
+    }
+
+    if options == nil || options.ReadOnly == false {
+        err = db.Update(func (tx *bbolt.Tx) error {
+            for _, bucket := range [][]byte{ BUCKET_FILES, BUCKET_DATA } {
+                if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+                    return err
+                }
+            }
+            return nil
+        })
+        if err != nil {
+            db.Close()
+            return nil, err
+        }
+    }
+
+    return &Storage{ db: db }, nil
+}
+
+func (s *Storage) Close() error {
+    return s.db.Close()
+}
+
+/*
+ * The underlying database, e.g. for backups with Tx.WriteTo()
+ */
+func (s *Storage) DB() *bbolt.DB {
+    return s.db
+}
+
+func (s *Storage) Catalog() ([]govfs.RawFile, error) {
+    var output []govfs.RawFile
+    err := s.db.View(func (tx *bbolt.Tx) error {
+        files := tx.Bucket(BUCKET_FILES)
+        if files == nil {
+            return nil
+        }
+
+        return files.ForEach(func (k []byte, v []byte) error {
+            var raw govfs.RawFile
+            if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&raw); err != nil {
+                return err
+            }
+            output = append(output, raw)
+            return nil
+        })
+    })
+
+    return output, err
+}
+
+func (s *Storage) ReadData(name string) ([]byte, error) {
+    var output []byte
+    err := s.db.View(func (tx *bbolt.Tx) error {
+        data := tx.Bucket(BUCKET_DATA)
+        if data == nil {
+            return fs.ErrNotExist
+        }
+
+        value := data.Get([]byte(name))
+        if value == nil {
+            return fs.ErrNotExist
+        }
+
+        /* Only valid for the life of the transaction */
+        output = append([]byte(nil), value...)
+        return nil
+    })
+
+    return output, err
+}
+
+func (s *Storage) Commit(put []govfs.Record, remove []string) error {
+    return s.db.Update(func (tx *bbolt.Tx) error {
+        files, data := tx.Bucket(BUCKET_FILES), tx.Bucket(BUCKET_DATA)
+
+        for _, name := range remove {
+            if err := files.Delete([]byte(name)); err != nil {
+                return err
+            }
+            if err := data.Delete([]byte(name)); err != nil {
+                return err
+            }
+        }
+
+        for _, record := range put {
+            var header bytes.Buffer
+            if err := gob.NewEncoder(&header).Encode(record.Header); err != nil {
+                return err
+            }
+
+            name := []byte(record.Header.Name)
+            if err := files.Put(name, header.Bytes()); err != nil {
+                return err
+            }
+            if len(record.Data) == 0 {
+                if err := data.Delete(name); err != nil {
+                    return err
+                }
+                continue
+            }
+            if err := data.Put(name, record.Data); err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+}
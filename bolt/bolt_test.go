@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package bolt
+
+import (
+    "bytes"
+    "testing"
+    "path/filepath"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+func TestBolt(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "govfs.bolt")
+    storage, err := Open(path, nil)
+    if err != nil {
+        t.Fatal("TEST1: Failed to open bbolt file: ", err)
+    }
+
+    config := &govfs.DBConfig{ Records: storage }
+    header, err := govfs.CreateDatabaseConfig(path, govfs.FLAG_DB_LOAD | govfs.FLAG_DB_CREATE | govfs.FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        t.Fatal("TEST2: Failed to create database")
+    }
+    header.StartIOController()
+
+    large := bytes.Repeat([]byte("large file "), 10000)
+    header.Create("/data/large.bin")
+    header.Write("/data/large.bin", large)
+    header.Create("/data/small.txt")
+    header.Write("/data/small.txt", []byte("small"))
+    header.Create("/empty")
+    if err := header.UnmountDB(govfs.FLAG_COMPRESS_FILES); err != nil {
+        t.Fatal("TEST3: Failed to commit: ", err)
+    }
+
+    header.Delete("/empty")
+    header.Write("/data/small.txt", []byte("changed"))
+    if err := header.UnmountDB(0); err != nil {
+        t.Fatal("TEST4: Failed to commit: ", err)
+    }
+    header.Close()
+    storage.Close()
+
+    /* Reopen the bbolt file */
+    storage, err = Open(path, nil)
+    if err != nil {
+        t.Fatal("TEST5: Failed to reopen bbolt file: ", err)
+    }
+    defer storage.Close()
+
+    catalog, err := storage.Catalog()
+    if err != nil || len(catalog) != 3 {
+        t.Fatalf("TEST6: Unexpected catalog of %d records", len(catalog))
+    }
+
+    config.Records = storage
+    header, err = govfs.CreateDatabaseConfig(path, govfs.FLAG_DB_LOAD | govfs.FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        t.Fatal("TEST7: Failed to load database: ", err)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    if header.Check("/empty") {
+        t.Fatal("TEST8: Deleted file was loaded")
+    }
+    if data, err := header.Read("/data/large.bin"); err != nil || !bytes.Equal(data, large) {
+        t.Fatal("TEST9: Loaded file has unexpected contents")
+    }
+    if data, err := header.Read("/data/small.txt"); err != nil || string(data) != "changed" {
+        t.Fatal("TEST10: Loaded file has unexpected contents")
+    }
+}
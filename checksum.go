@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "sync"
+    "hash"
+    "crypto/md5"
+    "crypto/sha256"
+    "encoding/hex"
+
+    "lukechampine.com/blake3"
+)
+
+/*
+ * Checksum is the digest of the contents of each file, as compared by Diff(), Verify()
+ *  and every load. The algorithm is recorded by name with every file, so files of a
+ *  database may have been summed with different ones. Custom algorithms must be
+ *  registered with RegisterChecksum() so that they can be found on load.
+ */
+type Checksum interface {
+    Name() string
+    New() hash.Hash /* The hex encoded Sum() of the contents is the checksum */
+}
+
+var (
+    ChecksumSHA256          Checksum = &simpleChecksum{ "sha256", sha256.New }
+    ChecksumBLAKE3          Checksum = &simpleChecksum{ "blake3", func () hash.Hash { return blake3.New(32, nil) } } /* Fastest */
+    ChecksumMD5             Checksum = &simpleChecksum{ "md5", newSaltedMD5 } /* Streams written before checksums were recorded */
+)
+
+var (
+    checksums               = map[string]Checksum{}
+    checksums_lock          sync.RWMutex
+)
+
+func init() {
+    RegisterChecksum(ChecksumSHA256)
+    RegisterChecksum(ChecksumBLAKE3)
+    RegisterChecksum(ChecksumMD5)
+}
+
+/*
+ * Makes a checksum algorithm available for loading databases which were written with it
+ */
+func RegisterChecksum(c Checksum) {
+    checksums_lock.Lock()
+    defer checksums_lock.Unlock()
+
+    checksums[c.Name()] = c
+}
+
+/*
+ * Returns the registered algorithm called `name`, nil if there is none. Files written
+ *  before checksums were recorded have no name, and are ChecksumMD5
+ */
+func checksumByName(name string) Checksum {
+    if name == "" {
+        return ChecksumMD5
+    }
+
+    checksums_lock.RLock()
+    defer checksums_lock.RUnlock()
+
+    return checksums[name]
+}
+
+/*
+ * The name recorded in RawFile.Checksum. Files without contents have no checksum
+ */
+func checksumName(c Checksum) string {
+    if c == nil {
+        return ""
+    }
+    return c.Name()
+}
+
+func checksumOf(c Checksum, data []byte) string {
+    h := c.New()
+    h.Write(data)
+
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+/*
+ * With DBConfig.VerifyReads, detects contents which were corrupted in memory (or in a
+ *  spill file) since they were written or loaded. The caller holds file.lock
+ */
+func (f *FSHeader) verifyData(file *govfsFile, data []byte) error {
+    if f.config.VerifyReads == false || file.sumAlgorithm() == nil || file.dataSum() == "" {
+        return nil
+    }
+    if checksumOf(file.sumAlgorithm(), data) != file.dataSum() {
+        return ErrChecksum
+    }
+
+    return nil
+}
+
+type simpleChecksum struct {
+    name        string
+    new         func () hash.Hash
+}
+
+func (c *simpleChecksum) Name() string {
+    return c.name
+}
+
+func (c *simpleChecksum) New() hash.Hash {
+    return c.new()
+}
+
+/*
+ * md5 of the contents followed by the "gofs_magic" salt of s()
+ */
+type saltedMD5 struct {
+    hash.Hash
+}
+
+func newSaltedMD5() hash.Hash {
+    return saltedMD5{ md5.New() }
+}
+
+func (h saltedMD5) Sum(b []byte) []byte {
+    /* Salt a copy, so that more data may still be written */
+    state, _ := h.Hash.(interface{ MarshalBinary() ([]byte, error) }).MarshalBinary()
+    salted := md5.New()
+    salted.(interface{ UnmarshalBinary([]byte) error }).UnmarshalBinary(state)
+    salted.Write([]byte("gofs_magic"))
+
+    return salted.Sum(b)
+}
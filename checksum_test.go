@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "os"
+    "testing"
+)
+
+func TestChecksum(t *testing.T) {
+    debugOut("[+] Running Checksum Test...")
+
+    var filename = gen_raw_filename("checksum")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := New(filename, WithChecksum(ChecksumBLAKE3))
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/blake3.txt")
+    header.Write("/blake3.txt", []byte("blake3"))
+    if header.check("/blake3.txt").dataSum() != checksumOf(ChecksumBLAKE3, []byte("blake3")) {
+        drive_fail("TEST2: File was not summed with BLAKE3", t)
+    }
+
+    /* Streams written before the algorithm was recorded are salted md5 */
+    header.Create("/legacy.txt")
+    header.Write("/legacy.txt", []byte("legacy"))
+    legacy := header.check("/legacy.txt")
+    legacy.setSum(s("legacy"), nil)
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST3: Failed to commit database", t)
+    }
+    header.Close()
+
+    loaded, err := Open(filename)
+    if loaded == nil || err != nil {
+        drive_fail("TEST4: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+    if data, err := loaded.Read("/blake3.txt"); err != nil || string(data) != "blake3" {
+        drive_fail("TEST5: Invalid contents of the BLAKE3 file", t)
+    }
+    if data, err := loaded.Read("/legacy.txt"); err != nil || string(data) != "legacy" ||
+        loaded.check("/legacy.txt").sumAlgorithm() != ChecksumMD5 {
+        drive_fail("TEST6: Invalid contents of the legacy file", t)
+    }
+
+    /* Rewrites use the configured algorithm, SHA-256 by default */
+    loaded.Write("/blake3.txt", []byte("sha256"))
+    if file := loaded.check("/blake3.txt"); file.sumAlgorithm() != ChecksumSHA256 ||
+        file.dataSum() != checksumOf(ChecksumSHA256, []byte("sha256")) {
+        drive_fail("TEST7: File was not summed with SHA-256", t)
+    }
+
+    /* The same contents summed with different algorithms are no change */
+    other, _ := New(gen_raw_filename("checksum_other"), InMemory())
+    other.StartIOController()
+    defer other.Close()
+    other.Create("/blake3.txt")
+    other.Write("/blake3.txt", []byte("sha256"))
+    other.Create("/legacy.txt")
+    other.Write("/legacy.txt", []byte("legacy"))
+    if changes, err := loaded.Diff(other); err != nil || len(changes) != 0 {
+        drive_fail("TEST8: Diff of databases summed with different algorithms", t)
+    }
+
+    if checksumByName("") != ChecksumMD5 || checksumByName("unknown") != nil {
+        drive_fail("TEST9: Invalid checksum registry", t)
+    }
+
+    debugOut("[+] Checksum Test PASS")
+}
+
+func TestVerifyReads(t *testing.T) {
+    debugOut("[+] Running Verify-on-Read Test...")
+
+    configs := []*DBConfig{
+        &DBConfig{ VerifyReads: true },
+        &DBConfig{ VerifyReads: true, SpillSize: 1, SpillDir: t.TempDir() },
+    }
+
+    for _, config := range configs {
+        header, err := CreateDatabaseConfig("verify", FLAG_DB_CREATE, config)
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to create database", t)
+        }
+        header.StartIOController()
+
+        header.Create("/file")
+        header.Write("/file", []byte("intact contents"))
+        header.Create("/empty")
+        if data, err := header.Read("/file"); err != nil || string(data) != "intact contents" {
+            drive_fail("TEST2: Failed to read intact file", t)
+        }
+        if data, err := header.Head("/file", 6); err != nil || string(data) != "intact" {
+            drive_fail("TEST3: Failed to read the head of intact file", t)
+        }
+        if _, err := header.Read("/empty"); err != nil {
+            drive_fail("TEST4: File without contents failed verification", t)
+        }
+
+        /* Flip a bit behind the database's back */
+        file := header.check("/file")
+        if file.spill != nil {
+            b := make([]byte, 1)
+            file.spill.file.ReadAt(b, 0)
+            b[0] ^= 1
+            file.spill.file.WriteAt(b, 0)
+        } else {
+            file.data[0] ^= 1
+        }
+
+        if _, err := header.Read("/file"); !errors.Is(err, ErrChecksum) {
+            drive_fail("TEST5: Corrupt contents were read", t)
+        }
+        if _, err := header.ReadRange("/file", 7, 4); !errors.Is(err, ErrChecksum) {
+            drive_fail("TEST6: Range of corrupt contents was read", t)
+        }
+        header.Close()
+    }
+
+    debugOut("[+] Verify-on-Read Test PASS")
+}
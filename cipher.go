@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "io"
+
+    "golang.org/x/crypto/chacha20poly1305"
+)
+
+/*
+ * Cipher is used by readFsStream/writeFsStream to encrypt and decrypt the
+ *  serialized fs stream when FLAG_ENCRYPT is set. The key passed in is the raw
+ *  database key (see getFsKey()), implementations derive whatever key size
+ *  they require from it.
+ */
+type Cipher interface {
+    Name() string
+    Encrypt(plaintext []byte, key []byte) ([]byte, error)
+    Decrypt(ciphertext []byte, key []byte) ([]byte, error)
+}
+
+/*
+ * Built-in ciphers. CipherRC4 is the legacy default and is kept so that
+ *  existing images can still be loaded. AES-GCM is the better choice on CPUs
+ *  with AES-NI, XChaCha20-Poly1305 is faster everywhere else.
+ */
+var (
+    CipherRC4               Cipher = rc4Cipher{}
+    CipherAESGCM            Cipher = aeadCipher{name: "aes-gcm", gen: newAESGCM}
+    CipherXChaCha20Poly1305 Cipher = aeadCipher{name: "xchacha20-poly1305", gen: chacha20poly1305.NewX}
+)
+
+type rc4Cipher struct{}
+
+func (rc4Cipher) Name() string {
+    return "rc4"
+}
+
+func (rc4Cipher) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+    return rc4Encrypt(plaintext, key)
+}
+
+func (rc4Cipher) Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
+    return rc4Decrypt(ciphertext, key)
+}
+
+/*
+ * Generic AEAD wrapper. The output stream is composed of the random nonce
+ *  followed by the sealed data, the tag authenticates the whole fs stream.
+ */
+type aeadCipher struct {
+    name string
+    gen  func(key []byte) (cipher.AEAD, error)
+}
+
+func (c aeadCipher) Name() string {
+    return c.name
+}
+
+func (c aeadCipher) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+    aead, err := c.gen(deriveCipherKey(key))
+    if err != nil {
+        return nil, err
+    }
+
+    nonce := make([]byte, aead.NonceSize(), aead.NonceSize() + len(plaintext) + aead.Overhead())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return nil, err
+    }
+
+    return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c aeadCipher) Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
+    aead, err := c.gen(deriveCipherKey(key))
+    if err != nil {
+        return nil, err
+    }
+
+    if len(ciphertext) < aead.NonceSize() + aead.Overhead() {
+        return nil, retErrStr(c.name + ": Ciphertext is too short")
+    }
+
+    nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+    plaintext, err := aead.Open(nil, nonce, sealed, nil)
+    if err != nil {
+        return nil, retErrStr(c.name + ": Failed to authenticate fs stream")
+    }
+
+    return plaintext, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+
+    return cipher.NewGCM(block)
+}
+
+/*
+ * Both AEAD ciphers take a 256-bit key, whereas the database key may be of
+ *  any length (the hostname key is an MD5 sum). Stretch it with SHA-256.
+ */
+func deriveCipherKey(key []byte) []byte {
+    sum := sha256.Sum256(key)
+    return sum[:]
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+)
+
+func TestCiphers(t *testing.T) {
+    debugOut("[+] Running Cipher Round-Trip Test...")
+
+    for _, c := range []Cipher{ CipherRC4, CipherAESGCM, CipherXChaCha20Poly1305 } {
+        var filename = gen_raw_filename("test_cipher_" + c.Name())
+        os.Remove(filename)
+
+        config := &DBConfig{ Cipher: c }
+        header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | FLAG_ENCRYPT, config)
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to create database with cipher " + c.Name(), t)
+        }
+        if err := header.StartIOController(); err != nil {
+            drive_fail("TEST1.1: Failed to start IOController", t)
+        }
+
+        data := []byte("cipher test data")
+        if err := header.Create("/folder0/file0"); err != nil {
+            drive_fail("TEST2: Failed to create file0", t)
+        }
+        if err := header.Write("/folder0/file0", data); err != nil {
+            drive_fail("TEST3: Failed to write file0", t)
+        }
+        if err := header.UnmountDB(0); err != nil {
+            drive_fail("TEST4: Failed to commit database with cipher " + c.Name(), t)
+        }
+
+        loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD | FLAG_ENCRYPT, config)
+        if loaded == nil || err != nil {
+            drive_fail("TEST5: Failed to load database with cipher " + c.Name(), t)
+        }
+        if output, _ := loaded.Read("/folder0/file0"); bytes.Compare(output, data) != 0 {
+            drive_fail("TEST6: Data mismatch after load with cipher " + c.Name(), t)
+        }
+
+        /* The AEAD ciphers must reject a tampered stream */
+        if c != CipherRC4 {
+            raw, _ := os.ReadFile(filename)
+            raw[len(raw) - 1] ^= 0xff
+            os.WriteFile(filename, raw, 0644)
+
+            if _, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD | FLAG_ENCRYPT, config); err == nil {
+                drive_fail("TEST7: Tampered stream was accepted by " + c.Name(), t)
+            }
+        }
+
+        os.Remove(filename)
+        debugOut("[+] Cipher " + c.Name() + " PASS")
+    }
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+    "time"
+)
+
+/*
+ * Stops the IO controller without committing. Any IRPs which are already queued are
+ *  processed first. All subsequent calls on the header return ErrClosed.
+ */
+func (f *FSHeader) Close() error {
+    return f.Shutdown(false, 0)
+}
+
+/*
+ * Stops the IO controller once the pending IRPs are drained and, if `commit` is set,
+ *  writes the database to disk with UnmountDB(flags) before returning. All subsequent
+ *  calls on the header return ErrClosed.
+ */
+func (f *FSHeader) Shutdown(commit bool, flags FlagVal /* FLAG_COMPRESS_FILES */) error {
+    /* Buffered writes need the IO controller */
+    var status error = nil
+    if f.isClosed() == false {
+        status = f.Sync()
+    }
+
+    if f.stopIOController() == false {
+        return ErrClosed
+    }
+    if f.config.Ephemeral == true {
+        defer f.zeroize()
+    }
+    defer f.removeSpills()
+    defer f.stopReplication()
+    defer f.stopWatches()
+    defer f.stopScrubber()
+    defer f.prefetches.Wait()
+
+    if commit == true {
+        if err := f.unmount(context.Background(), flags); err != nil {
+            return err
+        }
+    }
+
+    return status
+}
+
+/*
+ * Marks the header closed, closes io_in and waits for the IO controller to drain it.
+ *  Returns false if the header was already closed.
+ */
+func (f *FSHeader) stopIOController() bool {
+    f.ctl_lock.Lock()
+    if f.closed == true {
+        done := f.ctl_done
+        f.ctl_lock.Unlock()
+        if done != nil {
+            <- done
+        }
+        return false
+    }
+
+    f.closed = true
+    if f.io_in != nil {
+        /* No sender holds ctl_lock, so nothing can be sent on the queues after this */
+        close(f.io_in)
+        close(f.io_high)
+        close(f.io_bg)
+    }
+    done := f.ctl_done
+    f.ctl_lock.Unlock()
+
+    if done != nil {
+        <- done
+    }
+
+    return true
+}
+
+/*
+ * Sends an IRP to the IO controller and waits for its reply. The read lock is held
+ *  while sending so that stopIOController() cannot close io_in underneath us.
+ */
+func (f *FSHeader) submit(irp *govfsIoBlock) (*govfsIoBlock, error) {
+    return f.submitCtx(context.Background(), irp)
+}
+
+/*
+ * submit() which gives up once ctx is done. If ctx expires after the IO controller has
+ *  accepted the IRP, the operation may still complete; io_out is buffered so that the
+ *  controller is not blocked on the abandoned reply.
+ */
+func (f *FSHeader) submitCtx(ctx context.Context, irp *govfsIoBlock) (*govfsIoBlock, error) {
+    if f.config.Direct == true {
+        return f.dispatchDirect(ctx, irp)
+    }
+
+    if err := f.enqueue(ctx, irp); err != nil {
+        return nil, err
+    }
+
+    return f.awaitIRP(ctx, irp)
+}
+
+/*
+ * Queues an IRP for the IO controller without waiting for its reply
+ */
+func (f *FSHeader) enqueue(ctx context.Context, irp *govfsIoBlock) error {
+    /* Before taking ctl_lock, Close() does not wait for a throttled IRP */
+    if err := f.throttleIRP(ctx, irp); err != nil {
+        return err
+    }
+
+    f.ctl_lock.RLock()
+    defer f.ctl_lock.RUnlock()
+
+    if f.closed == true {
+        return ErrClosed
+    }
+    if f.io_in == nil {
+        return ErrControllerStopped
+    }
+
+    irp.priority = priorityFromContext(ctx)
+    irp.principal = principalFromContext(ctx)
+    irp.queued = time.Now()
+    queue := f.queue(irp.priority)
+
+    /* Visible to PendingOps() until the IO controller has processed it */
+    f.trackIRP(irp)
+
+    if f.config.FailWhenQueueFull == true {
+        select {
+        case queue <- irp:
+            return nil
+        default:
+            f.untrackIRP(irp)
+            return ErrQueueFull
+        }
+    }
+
+    select {
+    case queue <- irp:
+        return nil
+    case <- ctx.Done():
+        f.untrackIRP(irp)
+        return ctx.Err()
+    }
+}
+
+func (f *FSHeader) awaitIRP(ctx context.Context, irp *govfsIoBlock) (*govfsIoBlock, error) {
+    select {
+    case output_irp := <- irp.io_out:
+        return output_irp, nil
+    case <- ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+/*
+ * Returns the number of IRPs waiting for the IO controller across all priorities, and
+ *  the capacity of each priority queue
+ */
+func (f *FSHeader) QueueLength() (int, int) {
+    f.ctl_lock.RLock()
+    defer f.ctl_lock.RUnlock()
+
+    if f.io_in == nil {
+        return 0, 0
+    }
+
+    return len(f.io_in) + len(f.io_high) + len(f.io_bg), cap(f.io_in)
+}
+
+/*
+ * Returns true if StartIOController() was called and the database has not been closed.
+ *  Always false in DBConfig.Direct mode, which has no IO controller
+ */
+func (f *FSHeader) ControllerRunning() bool {
+    f.ctl_lock.RLock()
+    defer f.ctl_lock.RUnlock()
+
+    return f.io_in != nil && f.closed == false
+}
+
+func (f *FSHeader) isClosed() bool {
+    f.ctl_lock.RLock()
+    defer f.ctl_lock.RUnlock()
+
+    return f.closed
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "sync"
+    "errors"
+    "bytes"
+)
+
+func TestClose(t *testing.T) {
+    debugOut("[+] Running Close Test...")
+
+    var filename = gen_raw_filename("test_close")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+
+    /* Queue writes concurrently with Shutdown(), every accepted IRP must be serviced */
+    data := []byte("close test data")
+    if err := header.Create("/file0"); err != nil {
+        drive_fail("TEST2: Failed to create file0", t)
+    }
+    if err := header.Write("/file0", data); err != nil {
+        drive_fail("TEST2.1: Failed to write file0", t)
+    }
+    var wg sync.WaitGroup
+    for i := 0; i < 16; i += 1 {
+        wg.Add(1)
+        go func () {
+            defer wg.Done()
+            if err := header.Write("/file0", data); err != nil && !errors.Is(err, ErrClosed) {
+                t.Error("TEST3: Unexpected write error: " + err.Error())
+            }
+        }()
+    }
+
+    if err := header.Shutdown(true, 0); err != nil {
+        drive_fail("TEST4: Failed to shut down database", t)
+    }
+    wg.Wait()
+
+    if err := header.Write("/file0", data); !errors.Is(err, ErrClosed) {
+        drive_fail("TEST5: Write succeeded after Shutdown()", t)
+    }
+    if err := header.Create("/file1"); !errors.Is(err, ErrClosed) {
+        drive_fail("TEST5.1: Create succeeded after Shutdown()", t)
+    }
+    if _, err := header.Read("/file0"); !errors.Is(err, ErrClosed) {
+        drive_fail("TEST5.2: Read succeeded after Shutdown()", t)
+    }
+    if err := header.UnmountDB(0); !errors.Is(err, ErrClosed) {
+        drive_fail("TEST5.3: UnmountDB succeeded after Shutdown()", t)
+    }
+    if err := header.Close(); !errors.Is(err, ErrClosed) {
+        drive_fail("TEST5.4: Close succeeded twice", t)
+    }
+    if header.Check("/file0") {
+        drive_fail("TEST5.5: Check succeeded after Shutdown()", t)
+    }
+
+    /* Shutdown(true) must have committed the database */
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST6: Failed to load database", t)
+    }
+    if output, _ := loaded.Read("/file0"); !bytes.Equal(output, data) {
+        drive_fail("TEST7: Data mismatch after Shutdown()", t)
+    }
+
+    /* A header whose controller was never started can still be closed */
+    if err := loaded.Close(); err != nil {
+        drive_fail("TEST8: Failed to close database", t)
+    }
+
+    debugOut("[+] Close Test PASS")
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+/*
+ * The -json output of bench, per phase
+ */
+type benchOutput struct {
+    Phase       string          `json:"phase"`
+    Ops         int             `json:"ops"`
+    Seconds     float64         `json:"seconds"`
+    OpsPerSec   float64         `json:"ops_per_sec"`
+    BytesPerSec float64         `json:"bytes_per_sec"`
+    Allocs      uint64          `json:"allocs"`
+    AllocBytes  uint64          `json:"alloc_bytes"`
+}
+
+/*
+ * Measures govfs.Bench() with a scratch database at `name`, which must not exist
+ */
+func cmdBench(c *cli, name string, args []string) error {
+    flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    files := flags.Int("files", govfs.BENCH_DEFAULT_FILES, "number of files")
+    size := flags.Int("size", govfs.BENCH_DEFAULT_SIZE, "bytes per file")
+    asJSON := flags.Bool("json", false, "print the phases as JSON")
+    if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *files <= 0 || *size <= 0 {
+        return errUsage
+    }
+
+    config, err := c.config(PASSPHRASE_ENV)
+    if err != nil {
+        return err
+    }
+    defer govfs.ZeroKey(config.Key)
+
+    phases, err := govfs.Bench(name, govfs.BenchOptions{
+        Files: *files,
+        Size: *size,
+        Flags: c.flags(),
+        Config: config,
+        CommitFlags: c.commitFlags(),
+    })
+    if err != nil {
+        return err
+    }
+
+    if *asJSON == true {
+        var output []benchOutput
+        for _, p := range phases {
+            output = append(output, benchOutput{
+                Phase: p.Name,
+                Ops: p.Ops,
+                Seconds: p.Duration.Seconds(),
+                OpsPerSec: p.OpsPerSec(),
+                BytesPerSec: p.BytesPerSec(),
+                Allocs: p.Allocs,
+                AllocBytes: p.AllocBytes,
+            })
+        }
+        e := json.NewEncoder(c.stdout)
+        e.SetIndent("", "  ")
+        return e.Encode(output)
+    }
+
+    fmt.Fprintf(c.stdout, "%-8s %8s %12s %12s %10s %12s\n", "phase", "ops", "ops/sec", "MB/sec", "allocs/op",
+        "bytes/op")
+    for _, p := range phases {
+        fmt.Fprintf(c.stdout, "%-8s %8d %12.0f %12.2f %10d %12d\n", p.Name, p.Ops, p.OpsPerSec(),
+            p.BytesPerSec() / (1 << 20), p.AllocsPerOp(), p.AllocBytes / uint64(p.Ops))
+    }
+
+    return nil
+}
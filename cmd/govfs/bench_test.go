@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "encoding/json"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestBench(t *testing.T) {
+    db := filepath.Join(t.TempDir(), "bench.db")
+
+    code, stdout, stderr := govfsCmd(t, "", "-compress", db, "bench", "-files", "50", "-size", "100")
+    if code != 0 {
+        t.Fatal("TEST1: bench failed: " + stderr)
+    }
+    lines := strings.Split(strings.TrimSpace(stdout), "\n")
+    if len(lines) != 6 || !strings.HasPrefix(lines[0], "phase") || !strings.HasPrefix(lines[2], "write          50") {
+        t.Fatal("TEST2: Unexpected bench output: " + stdout)
+    }
+
+    code, stdout, _ = govfsCmd(t, "", db, "bench", "-files", "10", "-json")
+    var phases []benchOutput
+    if code != 0 || json.Unmarshal([]byte(stdout), &phases) != nil || len(phases) != 5 || phases[4].Phase != "load" ||
+        phases[4].Ops != 10 {
+        t.Fatal("TEST3: Unexpected JSON output: " + stdout)
+    }
+
+    if code, _, _ := govfsCmd(t, "", db, "bench", "-files", "0"); code != 2 {
+        t.Fatal("TEST4: bench with no files succeeded")
+    }
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "github.com/AlexRuzin/govfs"
+)
+
+/*
+ * Rewrites the database with govfs.Convert(). The target flags are those of the tool
+ *  itself and default to the source's, e.g. `-cipher aes-gcm` re-encrypts an RC4
+ *  database with AES-GCM and the same key, and `-keyfile new.key` replaces the
+ *  hostname key. The output may be the database itself
+ */
+func cmdConvert(c *cli, name string, args []string) error {
+    srcConfig, err := c.config(PASSPHRASE_ENV)
+    if err != nil {
+        return err
+    }
+    defer govfs.ZeroKey(srcConfig.Key)
+
+    flags, target := c.otherOptions("convert")
+    if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+        return errUsage
+    }
+    if target.encrypt == false {
+        /* A key file implies -encrypt */
+        target.keyfile, target.passphrase = "", ""
+    }
+
+    dstConfig, err := target.config(NEW_PASSPHRASE_ENV)
+    if err != nil {
+        return err
+    }
+    defer govfs.ZeroKey(dstConfig.Key)
+
+    return govfs.Convert(name, c.flags(), srcConfig, flags.Arg(0), target.flags(), dstConfig, target.commitFlags())
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+func TestConvert(t *testing.T) {
+    dir := t.TempDir()
+    db := filepath.Join(dir, "test.db")
+    out := filepath.Join(dir, "out.db")
+    keyfile := filepath.Join(dir, "key")
+    govfs.GenerateKeyfile(keyfile)
+
+    govfsCmd(t, "secret data", "-encrypt", db, "put", "/a")
+
+    if code, _, stderr := govfsCmd(t, "", "-encrypt", db, "convert", "-cipher", "aes-gcm", "-keyfile", keyfile,
+        "-codec", "zstd", "-compress", out); code != 0 {
+        t.Fatal("TEST1: convert failed: " + stderr)
+    }
+    if code, stdout, _ := govfsCmd(t, "", "-keyfile", keyfile, "-cipher", "aes-gcm", "-compress", "-codec", "zstd",
+        out, "cat", "/a"); code != 0 || stdout != "secret data" {
+        t.Fatal("TEST2: Converted database has unexpected contents")
+    }
+
+    if code, _, _ := govfsCmd(t, "", "-keyfile", keyfile, "-cipher", "aes-gcm", "-compress", out, "convert",
+        "-encrypt=false", "-compress=false", out); code != 0 {
+        t.Fatal("TEST3: In-place convert failed")
+    }
+    if raw, _ := os.ReadFile(out); !bytes.Contains(raw, []byte("secret data")) {
+        t.Fatal("TEST4: Database was not decrypted")
+    }
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+var errDiffer = errors.New("databases differ")
+
+/*
+ * Lists the changes from the database to another one, whose flags default to those of
+ *  the first. Like diff(1), fails if there are any
+ */
+func cmdDiff(c *cli, db *govfs.FSHeader, args []string) error {
+    flags, other := c.otherOptions("diff")
+    asJSON := flags.Bool("json", false, "print the changes as JSON")
+    if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+        return errUsage
+    }
+
+    peer := &cli{ stdin: c.stdin, stdout: c.stdout, stderr: c.stderr, options: *other }
+    if other.encrypt == false {
+        peer.keyfile, peer.passphrase = "", ""
+    }
+    peerDB, err := peer.open(flags.Arg(0), false)
+    if err != nil {
+        return errors.New(flags.Arg(0) + ": " + err.Error())
+    }
+    defer peerDB.Close()
+
+    changes, err := db.Diff(peerDB)
+    if err != nil {
+        return err
+    }
+
+    if *asJSON == true {
+        if changes == nil {
+            changes = []govfs.Change{}
+        }
+        e := json.NewEncoder(c.stdout)
+        e.SetIndent("", "  ")
+        if err := e.Encode(changes); err != nil {
+            return err
+        }
+    } else {
+        for _, change := range changes {
+            switch change.Kind {
+            case govfs.DIFF_ADDED:
+                fmt.Fprintf(c.stdout, "A %s  %d  %s\n", change.Path, change.NewSize, change.NewSum)
+            case govfs.DIFF_REMOVED:
+                fmt.Fprintf(c.stdout, "D %s  %d  %s\n", change.Path, change.OldSize, change.OldSum)
+            default:
+                fmt.Fprintf(c.stdout, "M %s  %d -> %d  %s -> %s\n", change.Path, change.OldSize, change.NewSize,
+                    change.OldSum, change.NewSum)
+            }
+        }
+    }
+
+    if len(changes) > 0 {
+        return errDiffer
+    }
+    return nil
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "encoding/json"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+func TestDiff(t *testing.T) {
+    dir := t.TempDir()
+    a := filepath.Join(dir, "a.db")
+    b := filepath.Join(dir, "b.db")
+
+    govfsCmd(t, "same", a, "put", "/same")
+    govfsCmd(t, "old", a, "put", "/changed")
+    govfsCmd(t, "same", "-encrypt", b, "put", "/same")
+    govfsCmd(t, "new contents", "-encrypt", b, "put", "/changed")
+    govfsCmd(t, "added", "-encrypt", b, "put", "/added")
+
+    if code, stdout, _ := govfsCmd(t, "", a, "diff", a); code != 0 || stdout != "" {
+        t.Fatal("TEST1: A database differs from itself")
+    }
+
+    code, stdout, stderr := govfsCmd(t, "", a, "diff", "-encrypt", b)
+    if code != 1 || !strings.Contains(stderr, "databases differ") {
+        t.Fatal("TEST2: diff of different databases did not fail")
+    }
+    lines := strings.Split(strings.TrimSpace(stdout), "\n")
+    if len(lines) != 2 || !strings.HasPrefix(lines[0], "A /added  5  ") ||
+        !strings.HasPrefix(lines[1], "M /changed  3 -> 12  ") {
+        t.Fatal("TEST3: Unexpected diff output: " + stdout)
+    }
+
+    code, stdout, _ = govfsCmd(t, "", "-encrypt", b, "diff", "-json", "-encrypt=false", a)
+    var changes []govfs.Change
+    if code != 1 || json.Unmarshal([]byte(stdout), &changes) != nil || len(changes) != 2 ||
+        changes[0].Kind != govfs.DIFF_REMOVED || changes[1].Kind != govfs.DIFF_CHANGED {
+        t.Fatal("TEST4: Unexpected JSON output: " + stdout)
+    }
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "strconv"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+/*
+ * The -json output of fsck
+ */
+type fsckOutput struct {
+    OK          bool            `json:"ok"`
+    Files       uint            `json:"files"`
+    Bytes       int             `json:"bytes"`
+    Problems    []fsckProblem   `json:"problems"`
+    Repaired    bool            `json:"repaired"`
+}
+
+type fsckProblem struct {
+    Path        string          `json:"path,omitempty"`
+    Error       string          `json:"error"`
+}
+
+/*
+ * Checks the database with govfs.Verify(), or salvages it with govfs.Repair(). Fails if
+ *  any problem was found, even if it was repaired
+ */
+func cmdFsck(c *cli, name string, args []string) error {
+    flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    asJSON := flags.Bool("json", false, "print a JSON report")
+    repair := flags.Bool("repair", false, "commit the intact files, dropping the damaged ones")
+    if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+        return errUsage
+    }
+
+    config, err := c.config(PASSPHRASE_ENV)
+    if err != nil {
+        return err
+    }
+    defer govfs.ZeroKey(config.Key)
+
+    var report *govfs.FsckReport
+    var repaired = false
+    if *repair == true {
+        var db *govfs.FSHeader
+        db, report, err = govfs.Repair(name, c.flags(), config)
+        if err == nil {
+            if report.OK() == false {
+                err = db.UnmountDB(c.commitFlags())
+                repaired = err == nil
+            }
+            db.Close()
+        }
+    } else {
+        report, err = govfs.Verify(name, c.flags(), config)
+    }
+    if err != nil {
+        return err
+    }
+
+    output := fsckOutput{
+        OK: report.OK(),
+        Files: report.Files,
+        Bytes: report.Bytes,
+        Problems: []fsckProblem{},
+        Repaired: repaired,
+    }
+    for _, p := range report.Problems {
+        output.Problems = append(output.Problems, fsckProblem{ Path: p.Path, Error: p.Err.Error() })
+    }
+
+    if *asJSON == true {
+        e := json.NewEncoder(c.stdout)
+        e.SetIndent("", "  ")
+        if err := e.Encode(output); err != nil {
+            return err
+        }
+    } else {
+        for _, p := range output.Problems {
+            path := p.Path
+            if path == "" {
+                path = "(database)"
+            }
+            fmt.Fprintln(c.stdout, path + ": " + p.Error)
+        }
+        fmt.Fprintf(c.stdout, "%d files, %d bytes intact, %d problems\n", output.Files, output.Bytes, len(output.Problems))
+        if repaired == true {
+            fmt.Fprintln(c.stdout, "repaired, the damaged files were removed")
+        }
+    }
+
+    if output.OK == false {
+        return errors.New(strconv.Itoa(len(output.Problems)) + " problems found")
+    }
+    return nil
+}
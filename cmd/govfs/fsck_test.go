@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestFsck(t *testing.T) {
+    db := filepath.Join(t.TempDir(), "test.db")
+    govfsCmd(t, "intact", db, "put", "/good")
+    govfsCmd(t, strings.Repeat("A", 64), db, "put", "/bad")
+
+    if code, stdout, _ := govfsCmd(t, "", db, "fsck"); code != 0 || !strings.Contains(stdout, "0 problems") {
+        t.Fatal("TEST1: Intact database failed fsck\n" + stdout)
+    }
+
+    raw, _ := os.ReadFile(db)
+    raw[bytes.Index(raw, []byte(strings.Repeat("A", 64)))] = 'B'
+    os.WriteFile(db, raw, 0600)
+
+    code, stdout, _ := govfsCmd(t, "", db, "fsck", "-json")
+    var output fsckOutput
+    if code != 1 || json.Unmarshal([]byte(stdout), &output) != nil || output.OK || len(output.Problems) != 1 ||
+        output.Problems[0].Path != "/bad" || output.Repaired {
+        t.Fatal("TEST2: Unexpected report\n" + stdout)
+    }
+
+    if code, stdout, _ := govfsCmd(t, "", db, "fsck", "-repair"); code != 1 || !strings.Contains(stdout, "repaired") {
+        t.Fatal("TEST3: Repair failed\n" + stdout)
+    }
+    if code, _, _ := govfsCmd(t, "", db, "fsck"); code != 0 {
+        t.Fatal("TEST4: Repaired database failed fsck")
+    }
+    if code, stdout, _ := govfsCmd(t, "", db, "cat", "/good"); code != 0 || stdout != "intact" {
+        t.Fatal("TEST5: Intact file was lost")
+    }
+}
@@ -0,0 +1,607 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+/*
+ * Command govfs creates, inspects and modifies govfs database files
+ *
+ *  govfs [flags] <database> <command> [arguments]
+ *
+ * Commands which modify the database create it if it does not exist, and commit it
+ *  once they succeeded. Paths inside the database are absolute, e.g. /docs/a.txt
+ */
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+const (
+    PASSPHRASE_ENV            string    = "GOVFS_PASSPHRASE" /* Used if -passphrase is not set */
+    NEW_PASSPHRASE_ENV        string    = "GOVFS_NEW_PASSPHRASE" /* Used for the second database if neither -passphrase is set */
+    SERVE_PASSWORD_ENV        string    = "GOVFS_SERVE_PASSWORD" /* Used by serve if -password is not set */
+)
+
+type cli struct {
+    stdin       io.Reader
+    stdout      io.Writer
+    stderr      io.Writer
+    options
+}
+
+/*
+ * How a database is opened and committed
+ */
+type options struct {
+    keyfile     string
+    passphrase  string
+    cipher      string
+    codec       string
+    encrypt     bool
+    compress    bool
+    compressFiles bool
+}
+
+type command struct {
+    usage       string
+    write       bool /* Creates the database if necessary and commits it */
+    run         func(c *cli, db *govfs.FSHeader, args []string) error
+    raw         func(c *cli, name string, args []string) error /* Opens the database itself, instead of run */
+}
+
+var commands map[string]*command
+
+func init() {
+    commands = map[string]*command{
+        "ls":    { usage: "ls [-r] [-sort name|size|time] [-reverse] [-type f|d] [-prefix p] [-min-size n] " +
+            "[-max-size n] [-since time] [-offset n] [-limit n] [dir]", run: cmdLs },
+        "cat":   { usage: "cat <path>...", run: cmdCat },
+        "get":   { usage: "get <path> [local file, - for stdout]", run: cmdGet },
+        "put":   { usage: "put <path> [local file, - for stdin]", write: true, run: cmdPut },
+        "rm":    { usage: "rm [-r] <path>...", write: true, run: cmdRm },
+        "mkdir": { usage: "mkdir [-p] <dir>...", write: true, run: cmdMkdir },
+        "stat":  { usage: "stat <path>...", run: cmdStat },
+        "tree":  { usage: "tree [-dot] [-sums] [dir]", run: cmdTree },
+        "fsck":  { usage: "fsck [-json] [-repair]", raw: cmdFsck },
+        "convert": { usage: "convert [target flags] <output database>", raw: cmdConvert },
+        "diff":  { usage: "diff [-json] [flags of the other database] <other database>", run: cmdDiff },
+        "mount": { usage: "mount [-ro] [-addr host:port] <mount point>", raw: cmdMount },
+        "bench": { usage: "bench [-files n] [-size bytes] [-json], with a scratch database", raw: cmdBench },
+        "serve": { usage: "serve [-http addr [-webdav] [-tls-cert file -tls-key file]] [-sftp addr [-host-key file]] " +
+            "[-ro] [-user name]", raw: cmdServe },
+    }
+}
+
+var ciphers = map[string]govfs.Cipher{
+    govfs.CipherRC4.Name():               govfs.CipherRC4,
+    govfs.CipherAESGCM.Name():            govfs.CipherAESGCM,
+    govfs.CipherXChaCha20Poly1305.Name(): govfs.CipherXChaCha20Poly1305,
+}
+
+var codecs = map[string]govfs.Codec{
+    govfs.CodecGzip.Name():   govfs.CodecGzip,
+    govfs.CodecZstd.Name():   govfs.CodecZstd,
+    govfs.CodecSnappy.Name(): govfs.CodecSnappy,
+}
+
+func main() {
+    os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+/*
+ * Returns the exit code: 0 on success, 1 if the command failed, 2 on invalid usage
+ */
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    c := &cli{ stdin: stdin, stdout: stdout, stderr: stderr }
+
+    flags := flag.NewFlagSet("govfs", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    flags.StringVar(&c.keyfile, "keyfile", "", "key file, see govfs.GenerateKeyfile(). Implies -encrypt")
+    flags.StringVar(&c.passphrase, "passphrase", "", "passphrase of the key file, defaults to $" + PASSPHRASE_ENV)
+    flags.StringVar(&c.cipher, "cipher", govfs.CipherRC4.Name(), "cipher of an encrypted database: " + names(ciphers))
+    flags.StringVar(&c.codec, "codec", govfs.CodecGzip.Name(), "compression codec: " + names(codecs))
+    flags.BoolVar(&c.encrypt, "encrypt", false, "the database is encrypted (FLAG_ENCRYPT)")
+    flags.BoolVar(&c.compress, "compress", false, "compress the database (FLAG_COMPRESS)")
+    flags.BoolVar(&c.compressFiles, "compress-files", false, "compress each file on commit (FLAG_COMPRESS_FILES)")
+    flags.Usage = func () {
+        fmt.Fprintln(stderr, "usage: govfs [flags] <database> <command> [arguments]\n\ncommands:")
+        for _, name := range sortedKeys(commands) {
+            fmt.Fprintln(stderr, "  " + commands[name].usage)
+        }
+        fmt.Fprintln(stderr, "\nflags:")
+        flags.PrintDefaults()
+    }
+
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+    if flags.NArg() < 2 {
+        flags.Usage()
+        return 2
+    }
+
+    name, cmd := flags.Arg(0), commands[flags.Arg(1)]
+    if cmd == nil {
+        fmt.Fprintln(stderr, "govfs: unknown command " + flags.Arg(1))
+        flags.Usage()
+        return 2
+    }
+
+    if err := c.execute(name, cmd, flags.Args()[2:]); err != nil {
+        fmt.Fprintln(stderr, "govfs: " + err.Error())
+        if errors.Is(err, errUsage) {
+            fmt.Fprintln(stderr, "usage: govfs [flags] <database> " + cmd.usage)
+            return 2
+        }
+        return 1
+    }
+
+    return 0
+}
+
+var errUsage = errors.New("invalid arguments")
+
+func (c *cli) execute(name string, cmd *command, args []string) error {
+    if cmd.raw != nil {
+        return cmd.raw(c, name, args)
+    }
+
+    db, err := c.open(name, cmd.write)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    if err := cmd.run(c, db, args); err != nil {
+        return err
+    }
+    if cmd.write == false {
+        return nil
+    }
+
+    return db.UnmountDB(c.commitFlags())
+}
+
+func (c *cli) open(name string, create bool) (*govfs.FSHeader, error) {
+    config, err := c.config(PASSPHRASE_ENV)
+    if err != nil {
+        return nil, err
+    }
+    defer govfs.ZeroKey(config.Key)
+
+    var flags govfs.FlagVal = govfs.FLAG_DB_LOAD
+    if create == true {
+        flags |= govfs.FLAG_DB_CREATE
+    }
+
+    db, err := govfs.CreateDatabaseConfig(name, flags | c.flags(), config)
+    if err != nil {
+        return nil, err
+    }
+    if err := db.StartIOController(); err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    return db, nil
+}
+
+/*
+ * FLAG_ENCRYPT and FLAG_COMPRESS as selected by the flags, after config()
+ */
+func (o *options) flags() govfs.FlagVal {
+    var flags govfs.FlagVal = 0
+    if o.encrypt == true {
+        flags |= govfs.FLAG_ENCRYPT
+    }
+    if o.compress == true {
+        flags |= govfs.FLAG_COMPRESS
+    }
+    return flags
+}
+
+/*
+ * The flags of UnmountDB()
+ */
+func (o *options) commitFlags() govfs.FlagVal {
+    if o.compressFiles == true {
+        return govfs.FLAG_COMPRESS_FILES
+    }
+    return 0
+}
+
+/*
+ * The passphrase defaults to the environment variable `env`
+ */
+func (o *options) config(env string) (*govfs.DBConfig, error) {
+    config := &govfs.DBConfig{
+        Cipher: ciphers[o.cipher],
+        Codec: codecs[o.codec],
+    }
+    if config.Cipher == nil {
+        return nil, errors.New("unknown cipher " + o.cipher)
+    }
+    if config.Codec == nil {
+        return nil, errors.New("unknown codec " + o.codec)
+    }
+
+    passphrase := o.passphrase
+    if passphrase == "" {
+        passphrase = os.Getenv(env)
+    }
+    if o.keyfile == "" {
+        if passphrase != "" {
+            return nil, errors.New("a passphrase requires a key file")
+        }
+        return config, nil
+    }
+
+    key, err := govfs.KeyFromFile(o.keyfile, []byte(passphrase))
+    if err != nil {
+        return nil, err
+    }
+    config.Key = key
+    o.encrypt = true
+
+    return config, nil
+}
+
+/*
+ * Flags for a second database, which default to the options of the first one
+ */
+func (c *cli) otherOptions(name string) (*flag.FlagSet, *options) {
+    other := c.options
+    if other.passphrase == "" {
+        other.passphrase = os.Getenv(PASSPHRASE_ENV)
+    }
+
+    flags := flag.NewFlagSet(name, flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    flags.StringVar(&other.keyfile, "keyfile", other.keyfile, "key file, \"\" for the hostname key")
+    flags.StringVar(&other.passphrase, "passphrase", other.passphrase, "passphrase of the key file, defaults to $" +
+        NEW_PASSPHRASE_ENV)
+    flags.StringVar(&other.cipher, "cipher", other.cipher, "cipher: " + names(ciphers))
+    flags.StringVar(&other.codec, "codec", other.codec, "compression codec: " + names(codecs))
+    flags.BoolVar(&other.encrypt, "encrypt", other.encrypt, "the database is encrypted, -encrypt=false if not")
+    flags.BoolVar(&other.compress, "compress", other.compress, "compress the database")
+    flags.BoolVar(&other.compressFiles, "compress-files", other.compressFiles, "compress each file on commit")
+
+    return flags, &other
+}
+
+/*
+ * Cleans a database path, "docs/a.txt" is "/docs/a.txt"
+ */
+func clean(p string) string {
+    return path.Clean("/" + p)
+}
+
+/*
+ * The io/fs name of a database path, see govfs.FS()
+ */
+func fsName(p string) string {
+    if p = strings.TrimPrefix(clean(p), "/"); p == "" {
+        return "."
+    }
+    return p
+}
+
+/*
+ * Directories are either keyed with or without the trailing "/", see govfs.FS()
+ */
+func resolve(db *govfs.FSHeader, p string) (string, error) {
+    p = clean(p)
+    if db.Check(p) == true {
+        return p, nil
+    }
+    if db.Check(p + "/") == true {
+        return p + "/", nil
+    }
+
+    return "", errors.New(p + ": no such file or directory")
+}
+
+func names[T any](m map[string]T) string {
+    return strings.Join(sortedKeys(m), ", ")
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+    var output []string
+    for k := range m {
+        output = append(output, k)
+    }
+    sort.Strings(output)
+    return output
+}
+
+var listSorts = map[string]govfs.ListSort{
+    "name": govfs.SORT_NAME,
+    "size": govfs.SORT_SIZE,
+    "time": govfs.SORT_MODTIME,
+}
+
+var listTypes = map[string]govfs.ListType{
+    "":  govfs.LIST_ALL,
+    "f": govfs.LIST_FILES,
+    "d": govfs.LIST_DIRS,
+}
+
+func cmdLs(c *cli, db *govfs.FSHeader, args []string) error {
+    flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    recursive := flags.Bool("r", false, "list the whole subtree, with full paths")
+    sortBy := flags.String("sort", "name", "sort by name, size or time")
+    reverse := flags.Bool("reverse", false, "reverse the order")
+    kind := flags.String("type", "", "only files (f) or directories (d)")
+    prefix := flags.String("prefix", "", "only names starting with this")
+    minSize := flags.Int("min-size", 0, "only files of at least this many bytes")
+    maxSize := flags.Int("max-size", 0, "only files of at most this many bytes")
+    since := flags.String("since", "", "only entries modified since this RFC 3339 time")
+    offset := flags.Int("offset", 0, "skip this many entries")
+    limit := flags.Int("limit", 0, "list at most this many entries")
+    if err := flags.Parse(args); err != nil || flags.NArg() > 1 {
+        return errUsage
+    }
+
+    opts := govfs.ListOptions{ Dir: clean(flags.Arg(0)), Shallow: *recursive == false, Prefix: *prefix,
+        MinSize: *minSize, MaxSize: *maxSize, Reverse: *reverse, Offset: *offset, Limit: *limit }
+    var ok bool
+    if opts.Sort, ok = listSorts[*sortBy]; ok == false {
+        return errUsage
+    }
+    if opts.Type, ok = listTypes[*kind]; ok == false {
+        return errUsage
+    }
+    if *since != "" {
+        t, err := time.Parse(time.RFC3339, *since)
+        if err != nil {
+            return err
+        }
+        opts.ModifiedSince = t
+    }
+
+    entries, err := db.List(opts)
+    if err != nil {
+        return err
+    }
+    for _, e := range entries {
+        name := e.Name
+        if *recursive == false {
+            name = path.Base(strings.TrimSuffix(name, "/"))
+        }
+        printEntry(c.stdout, e.Dir, int64(e.Size), e.ModTime, name)
+    }
+
+    return nil
+}
+
+func printInfo(w io.Writer, info fs.FileInfo, name string) {
+    printEntry(w, info.IsDir(), info.Size(), info.ModTime(), name)
+}
+
+func printEntry(w io.Writer, dir bool, size int64, modtime time.Time, name string) {
+    kind := "-"
+    if dir == true {
+        kind = "d"
+        if strings.HasSuffix(name, "/") == false {
+            name += "/"
+        }
+    }
+    fmt.Fprintf(w, "%s %12d %s %s\n", kind, size, modtime.Format("2006-01-02 15:04:05"), name)
+}
+
+func cmdCat(c *cli, db *govfs.FSHeader, args []string) error {
+    if len(args) == 0 {
+        return errUsage
+    }
+
+    for _, p := range args {
+        data, err := db.Read(clean(p))
+        if err != nil {
+            return errors.New(clean(p) + ": " + err.Error())
+        }
+        if _, err := c.stdout.Write(data); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func cmdGet(c *cli, db *govfs.FSHeader, args []string) error {
+    if len(args) < 1 || len(args) > 2 {
+        return errUsage
+    }
+
+    data, err := db.Read(clean(args[0]))
+    if err != nil {
+        return errors.New(clean(args[0]) + ": " + err.Error())
+    }
+
+    if len(args) == 1 || args[1] == "-" {
+        _, err = c.stdout.Write(data)
+        return err
+    }
+    return os.WriteFile(args[1], data, 0600)
+}
+
+func cmdPut(c *cli, db *govfs.FSHeader, args []string) error {
+    if len(args) < 1 || len(args) > 2 {
+        return errUsage
+    }
+
+    var data []byte
+    var err error
+    if len(args) == 1 || args[1] == "-" {
+        data, err = io.ReadAll(c.stdin)
+    } else {
+        data, err = os.ReadFile(args[1])
+    }
+    if err != nil {
+        return err
+    }
+
+    p := clean(args[0])
+    if db.Check(p) == false {
+        if err := db.Create(p); err != nil {
+            return errors.New(p + ": " + err.Error())
+        }
+    }
+
+    return db.Write(p, data)
+}
+
+func cmdRm(c *cli, db *govfs.FSHeader, args []string) error {
+    flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    recursive := flags.Bool("r", false, "remove directories and their contents")
+    if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+        return errUsage
+    }
+
+    for _, p := range flags.Args() {
+        name, err := resolve(db, p)
+        if err != nil {
+            return err
+        }
+        if name == "/" {
+            return errors.New("cannot remove /")
+        }
+
+        if strings.HasSuffix(name, "/") == true {
+            entries, err := fs.ReadDir(db.FS(), fsName(name))
+            if err != nil {
+                return err
+            }
+            if len(entries) > 0 && *recursive == false {
+                return errors.New(name + ": directory is not empty")
+            }
+            if err := removeAll(db, name); err != nil {
+                return err
+            }
+            continue
+        }
+
+        if err := db.Delete(name); err != nil {
+            return errors.New(name + ": " + err.Error())
+        }
+    }
+
+    return nil
+}
+
+/*
+ * Removes a directory and everything beneath it, deepest first
+ */
+func removeAll(db *govfs.FSHeader, dir string) error {
+    var names []string
+    err := fs.WalkDir(db.FS(), fsName(dir), func (p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        names = append(names, "/" + p)
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+
+    for i := len(names) - 1; i >= 0; i-- {
+        name, err := resolve(db, names[i])
+        if err != nil {
+            return err
+        }
+        if err := db.Delete(name); err != nil {
+            return errors.New(name + ": " + err.Error())
+        }
+    }
+
+    return nil
+}
+
+func cmdMkdir(c *cli, db *govfs.FSHeader, args []string) error {
+    flags := flag.NewFlagSet("mkdir", flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    parents := flags.Bool("p", false, "no error if the directory exists")
+    if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+        return errUsage
+    }
+
+    for _, p := range flags.Args() {
+        name := clean(p)
+        if _, err := resolve(db, name); err == nil {
+            if *parents == true {
+                continue
+            }
+            return errors.New(name + ": file exists")
+        }
+        if err := db.Create(name + "/"); err != nil {
+            return errors.New(name + ": " + err.Error())
+        }
+    }
+
+    return nil
+}
+
+func cmdStat(c *cli, db *govfs.FSHeader, args []string) error {
+    if len(args) == 0 {
+        return errUsage
+    }
+
+    for _, p := range args {
+        info, err := fs.Stat(db.FS(), fsName(p))
+        if err != nil {
+            return err
+        }
+        printInfo(c.stdout, info, clean(p))
+    }
+
+    return nil
+}
+
+func cmdTree(c *cli, db *govfs.FSHeader, args []string) error {
+    flags := flag.NewFlagSet("tree", flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    dot := flags.Bool("dot", false, "print a Graphviz graph")
+    sums := flags.Bool("sums", false, "print checksums")
+    if err := flags.Parse(args); err != nil || flags.NArg() > 1 {
+        return errUsage
+    }
+
+    opts := govfs.DumpOptions{ Root: clean(flags.Arg(0)), Checksums: *sums }
+    if *dot == true {
+        opts.Format = govfs.DUMP_DOT
+    }
+
+    return db.DumpTree(c.stdout, opts)
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+/*
+ * Runs the tool and returns its exit code and output
+ */
+func govfsCmd(t *testing.T, stdin string, args ...string) (int, string, string) {
+    var stdout, stderr bytes.Buffer
+    code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+    return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+    dir := t.TempDir()
+    db := filepath.Join(dir, "test.db")
+    local := filepath.Join(dir, "local.txt")
+    os.WriteFile(local, []byte("from a file"), 0600)
+
+    if code, _, _ := govfsCmd(t, "", db, "ls"); code != 1 {
+        t.Fatal("TEST1: ls of a missing database succeeded")
+    }
+    if code, _, stderr := govfsCmd(t, "hello", "-compress", db, "put", "/docs/a.txt"); code != 0 {
+        t.Fatal("TEST2: put from stdin failed: " + stderr)
+    }
+    if code, _, _ := govfsCmd(t, "", "-compress", db, "put", "docs/b.txt", local); code != 0 {
+        t.Fatal("TEST3: put from a file failed")
+    }
+    if code, _, _ := govfsCmd(t, "", "-compress", db, "mkdir", "/empty"); code != 0 {
+        t.Fatal("TEST4: mkdir failed")
+    }
+    if code, _, _ := govfsCmd(t, "", "-compress", db, "mkdir", "/empty"); code != 1 {
+        t.Fatal("TEST5: mkdir of an existing directory succeeded")
+    }
+
+    code, stdout, _ := govfsCmd(t, "", "-compress", db, "ls")
+    if code != 0 || !strings.Contains(stdout, " docs/\n") || !strings.Contains(stdout, " empty/\n") {
+        t.Fatal("TEST6: Unexpected listing\n" + stdout)
+    }
+    code, stdout, _ = govfsCmd(t, "", "-compress", db, "ls", "/docs")
+    if code != 0 || !strings.HasPrefix(stdout, "-            5 ") || !strings.HasSuffix(stdout, " b.txt\n") {
+        t.Fatal("TEST7: Unexpected listing\n" + stdout)
+    }
+    code, stdout, _ = govfsCmd(t, "", "-compress", db, "ls", "-r", "-type", "f", "-sort", "size", "-limit", "1")
+    if code != 0 || !strings.HasSuffix(stdout, " /docs/a.txt\n") || strings.Count(stdout, "\n") != 1 {
+        t.Fatal("TEST7.1: Unexpected filtered listing\n" + stdout)
+    }
+    if code, stdout, _ := govfsCmd(t, "", "-compress", db, "cat", "/docs/a.txt", "/docs/b.txt"); code != 0 ||
+        stdout != "hellofrom a file" {
+        t.Fatal("TEST8: Unexpected contents " + stdout)
+    }
+    if code, stdout, _ := govfsCmd(t, "", "-compress", db, "stat", "/docs/b.txt"); code != 0 ||
+        !strings.HasPrefix(stdout, "-           11 ") {
+        t.Fatal("TEST9: Unexpected stat " + stdout)
+    }
+
+    out := filepath.Join(dir, "out.txt")
+    if code, _, _ := govfsCmd(t, "", "-compress", db, "get", "/docs/a.txt", out); code != 0 {
+        t.Fatal("TEST10: get failed")
+    }
+    if data, _ := os.ReadFile(out); string(data) != "hello" {
+        t.Fatal("TEST11: get wrote unexpected contents")
+    }
+
+    if code, _, _ := govfsCmd(t, "", "-compress", db, "rm", "/docs"); code != 1 {
+        t.Fatal("TEST12: rm of a non-empty directory succeeded")
+    }
+    if code, _, _ := govfsCmd(t, "", "-compress", db, "rm", "-r", "/docs", "/empty"); code != 0 {
+        t.Fatal("TEST13: rm -r failed")
+    }
+    if code, stdout, _ := govfsCmd(t, "", "-compress", db, "ls"); code != 0 || stdout != "" {
+        t.Fatal("TEST14: Files remain after rm\n" + stdout)
+    }
+
+    if code, _, _ := govfsCmd(t, "", db, "frobnicate"); code != 2 {
+        t.Fatal("TEST15: Unknown command was accepted")
+    }
+    if code, _, _ := govfsCmd(t, "", db, "get"); code != 2 {
+        t.Fatal("TEST16: Missing arguments were accepted")
+    }
+}
+
+func TestKeyfile(t *testing.T) {
+    dir := t.TempDir()
+    db := filepath.Join(dir, "test.db")
+    keyfile := filepath.Join(dir, "key")
+    if err := govfs.GenerateKeyfile(keyfile); err != nil {
+        t.Fatal(err)
+    }
+
+    if code, _, stderr := govfsCmd(t, "secret", "-keyfile", keyfile, "-cipher", "aes-gcm", db, "put", "/a"); code != 0 {
+        t.Fatal("TEST1: put to an encrypted database failed: " + stderr)
+    }
+    if raw, _ := os.ReadFile(db); bytes.Contains(raw, []byte("secret")) {
+        t.Fatal("TEST2: Database is not encrypted")
+    }
+    if code, stdout, _ := govfsCmd(t, "", "-keyfile", keyfile, "-cipher", "aes-gcm", db, "cat", "/a"); code != 0 ||
+        stdout != "secret" {
+        t.Fatal("TEST3: Failed to read an encrypted database")
+    }
+    if code, _, _ := govfsCmd(t, "", "-cipher", "aes-gcm", "-encrypt", db, "cat", "/a"); code == 0 {
+        t.Fatal("TEST4: Read an encrypted database without its key")
+    }
+    if code, _, _ := govfsCmd(t, "", "-passphrase", "x", db, "ls"); code != 1 {
+        t.Fatal("TEST5: Passphrase without a key file was accepted")
+    }
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/hex"
+    "errors"
+    "flag"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "os/exec"
+    "os/signal"
+    "strings"
+    "syscall"
+
+    "github.com/AlexRuzin/govfs/webdav"
+)
+
+/*
+ * Mounts a URL served over WebDAV, see mount_*.go. The server requires basic auth with
+ *  the user and password, which must not be passed on the command line of the client
+ */
+type mounter interface {
+    mount(url string, point string, readOnly bool, user string, password string) error
+    unmount(point string, force bool) error
+}
+
+/*
+ * User name of the generated credential, the password is random for each mount
+ */
+const MOUNT_USER = "govfs"
+
+var osMounter mounter = platformMounter{}
+
+/*
+ * Returns once the mount should be removed
+ */
+var waitForSignal = func () {
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    <-signals
+    signal.Stop(signals)
+}
+
+/*
+ * Serves the database over WebDAV on a loopback address and mounts it with the client of
+ *  the OS, which on Linux is davfs2 (FUSE). Only the client is given the random password
+ *  of the server. Unmounts on SIGINT or SIGTERM, committing the database unless it is
+ *  mounted read-only. The database is committed even if it cannot be unmounted
+ */
+func cmdMount(c *cli, name string, args []string) error {
+    flags := flag.NewFlagSet("mount", flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    readOnly := flags.Bool("ro", false, "mount read-only")
+    addr := flags.String("addr", "127.0.0.1:0", "address of the WebDAV server")
+    if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+        return errUsage
+    }
+    point := flags.Arg(0)
+
+    db, err := c.open(name, *readOnly == false)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    listener, err := net.Listen("tcp", *addr)
+    if err != nil {
+        return err
+    }
+    secret := make([]byte, 16)
+    if _, err := rand.Read(secret); err != nil {
+        listener.Close()
+        return err
+    }
+    password := hex.EncodeToString(secret)
+
+    var handler http.Handler = webdav.NewHandler(db)
+    if *readOnly == true {
+        handler = readOnlyHandler(handler)
+    }
+    handler = basicAuth(handler, func (u string, p string) bool {
+        return subtle.ConstantTimeCompare([]byte(u), []byte(MOUNT_USER)) &
+            subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+    })
+    server := &http.Server{ Handler: handler }
+    go server.Serve(listener)
+    defer server.Close()
+
+    url := "http://" + listener.Addr().String() + "/"
+    if err := osMounter.mount(url, point, *readOnly, MOUNT_USER, password); err != nil {
+        return errors.New("mount " + point + ": " + err.Error())
+    }
+    fmt.Fprintln(c.stderr, "govfs: " + name + " mounted on " + point + " (" + url + "), interrupt to unmount")
+
+    waitForSignal()
+
+    /*
+     * Writes already received by the server are committed either way, so a mount that
+     *  is still busy does not lose them to the deferred Close()
+     */
+    var unmountErr error
+    if err := osMounter.unmount(point, false); err != nil {
+        if forced := osMounter.unmount(point, true); forced != nil {
+            unmountErr = errors.New("unmount " + point + ": " + err.Error())
+        }
+    }
+    server.Close()
+
+    var commitErr error
+    if *readOnly == false {
+        commitErr = db.UnmountDB(c.commitFlags())
+    }
+    switch {
+    case unmountErr != nil && commitErr != nil:
+        return errors.New(unmountErr.Error() + ", commit: " + commitErr.Error())
+    case unmountErr != nil:
+        return unmountErr
+    }
+    return commitErr
+}
+
+/*
+ * Runs a mount command, returning its output on failure
+ */
+func runMount(cmd *exec.Cmd) error {
+    output, err := cmd.CombinedOutput()
+    if err != nil && len(output) > 0 {
+        return errors.New(strings.TrimSpace(string(output)))
+    }
+    return err
+}
+
+/*
+ * Rejects every WebDAV method that would modify the database
+ */
+func readOnlyHandler(next http.Handler) http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+            next.ServeHTTP(w, r)
+        default:
+            http.Error(w, "read-only mount", http.StatusForbidden)
+        }
+    })
+}
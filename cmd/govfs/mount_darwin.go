@@ -0,0 +1,74 @@
+//go:build darwin
+// +build darwin
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "encoding/binary"
+    "os"
+    "os/exec"
+)
+
+/*
+ * The WebDAV client of macOS. mount_webdav -a reads the credentials from a descriptor,
+ *  each as a length in host byte order (little-endian on every supported Mac) followed by
+ *  the string
+ */
+type platformMounter struct{}
+
+func (platformMounter) mount(url string, point string, readOnly bool, user string, password string) error {
+    var auth []byte
+    for _, s := range []string{ user, password } {
+        auth = binary.LittleEndian.AppendUint32(auth, uint32(len(s)))
+        auth = append(auth, s...)
+    }
+    r, w, err := os.Pipe()
+    if err != nil {
+        return err
+    }
+    defer r.Close()
+    if _, err := w.Write(auth); err != nil {
+        w.Close()
+        return err
+    }
+    w.Close()
+
+    /* ExtraFiles[0] is descriptor 3 of the child */
+    args := []string{ "-S", "-a", "3" }
+    if readOnly == true {
+        args = append(args, "-o", "rdonly")
+    }
+    cmd := exec.Command("mount_webdav", append(args, url, point)...)
+    cmd.ExtraFiles = []*os.File{ r }
+    return runMount(cmd)
+}
+
+func (platformMounter) unmount(point string, force bool) error {
+    if force == true {
+        return runMount(exec.Command("umount", "-f", point))
+    }
+    return runMount(exec.Command("umount", point))
+}
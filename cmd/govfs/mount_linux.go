@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "os/exec"
+    "strings"
+)
+
+/*
+ * davfs2, which asks for credentials on stdin. Requires root, or a user entry in /etc/fstab.
+ *  A forced unmount detaches the mount lazily
+ */
+type platformMounter struct{}
+
+func (platformMounter) mount(url string, point string, readOnly bool, user string, password string) error {
+    args := []string{ "-t", "davfs", url, point }
+    if readOnly == true {
+        args = append(args, "-o", "ro")
+    }
+
+    cmd := exec.Command("mount", args...)
+    cmd.Stdin = strings.NewReader(user + "\n" + password + "\n")
+    return runMount(cmd)
+}
+
+func (platformMounter) unmount(point string, force bool) error {
+    if force == true {
+        return runMount(exec.Command("umount", "-l", point))
+    }
+    return runMount(exec.Command("umount", point))
+}
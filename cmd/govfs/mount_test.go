@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "errors"
+    "io"
+    "net/http"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+/*
+ * Records the mounted URL instead of running a mount command
+ */
+type testMounter struct {
+    url         string
+    user        string
+    password    string
+    mounted     bool
+    fail        bool
+    busy        bool
+}
+
+func (m *testMounter) mount(url string, point string, readOnly bool, user string, password string) error {
+    if m.fail == true {
+        return errors.New("no WebDAV client")
+    }
+    m.url, m.user, m.password, m.mounted = url, user, password, true
+    return nil
+}
+
+func (m *testMounter) unmount(point string, force bool) error {
+    if m.busy == true {
+        return errors.New("target is busy")
+    }
+    m.mounted = false
+    return nil
+}
+
+func (m *testMounter) do(method string, name string, body string) (int, string) {
+    req, _ := http.NewRequest(method, m.url + name, strings.NewReader(body))
+    req.SetBasicAuth(m.user, m.password)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return 0, ""
+    }
+    defer resp.Body.Close()
+    data, _ := io.ReadAll(resp.Body)
+    return resp.StatusCode, string(data)
+}
+
+func mountWith(t *testing.T, m *testMounter, whileMounted func ()) {
+    oldMounter, oldWait := osMounter, waitForSignal
+    osMounter, waitForSignal = m, whileMounted
+    t.Cleanup(func () {
+        osMounter, waitForSignal = oldMounter, oldWait
+    })
+}
+
+func TestMount(t *testing.T) {
+    db := filepath.Join(t.TempDir(), "test.db")
+    govfsCmd(t, "hello", db, "put", "/a.txt")
+
+    m := &testMounter{}
+    var status int
+    var contents string
+    var anonymous int
+    mountWith(t, m, func () {
+        status, _ = m.do(http.MethodPut, "b.txt", "written")
+        _, contents = m.do(http.MethodGet, "a.txt", "")
+        if resp, err := http.Get(m.url + "a.txt"); err == nil {
+            anonymous = resp.StatusCode
+            resp.Body.Close()
+        }
+    })
+
+    if code, _, stderr := govfsCmd(t, "", db, "mount", "-ro", "/mnt/point"); code != 0 {
+        t.Fatal("TEST1: Read-only mount failed: " + stderr)
+    }
+    if m.mounted == true || contents != "hello" || status != http.StatusForbidden {
+        t.Fatal("TEST2: Read-only mount served unexpected contents")
+    }
+    if anonymous != http.StatusUnauthorized || m.user != MOUNT_USER || len(m.password) != 32 {
+        t.Fatal("TEST2: Mount did not require the generated credential")
+    }
+
+    status = 0
+    if code, _, _ := govfsCmd(t, "", db, "mount", "/mnt/point"); code != 0 || status != http.StatusCreated {
+        t.Fatal("TEST3: Read-write mount failed")
+    }
+    if _, stdout, _ := govfsCmd(t, "", db, "cat", "/b.txt"); stdout != "written" {
+        t.Fatal("TEST4: Write to the mount was not committed")
+    }
+
+    m.fail = true
+    if code, _, stderr := govfsCmd(t, "", db, "mount", "/mnt/point"); code != 1 ||
+        !strings.Contains(stderr, "no WebDAV client") {
+        t.Fatal("TEST5: Failed mount did not fail")
+    }
+
+    m.fail, m.busy = false, true
+    mountWith(t, m, func () {
+        status, _ = m.do(http.MethodPut, "c.txt", "busy")
+    })
+    if code, _, stderr := govfsCmd(t, "", db, "mount", "/mnt/point"); code != 1 ||
+        !strings.Contains(stderr, "target is busy") {
+        t.Fatal("TEST6: Failed unmount was not reported")
+    }
+    if _, stdout, _ := govfsCmd(t, "", db, "cat", "/c.txt"); stdout != "busy" {
+        t.Fatal("TEST7: Write to a mount that failed to unmount was not committed")
+    }
+}
@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "os/exec"
+    "strings"
+)
+
+/*
+ * The WebClient service maps the URL to a drive letter, e.g. "X:". Read-only mounts are
+ *  enforced by the server. The password is given as "*", which net reads from stdin
+ */
+type platformMounter struct{}
+
+func (platformMounter) mount(url string, point string, readOnly bool, user string, password string) error {
+    cmd := exec.Command("net", "use", point, url, "*", "/user:" + user, "/persistent:no")
+    cmd.Stdin = strings.NewReader(password + "\r\n")
+    return runMount(cmd)
+}
+
+func (platformMounter) unmount(point string, force bool) error {
+    return runMount(exec.Command("net", "use", point, "/delete", "/y"))
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/subtle"
+    "errors"
+    "flag"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+
+    "github.com/AlexRuzin/govfs/sftp"
+    "github.com/AlexRuzin/govfs/webdav"
+    "golang.org/x/crypto/ssh"
+)
+
+/*
+ * Serves the database over HTTP, read-only, or WebDAV, and SFTP. Writable WebDAV and
+ *  SFTP require a user. Stops on SIGINT or SIGTERM, committing the database if it was
+ *  served writable
+ */
+func cmdServe(c *cli, name string, args []string) error {
+    flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    httpAddr := flags.String("http", "", "address of the HTTP server, e.g. :8080")
+    useWebDAV := flags.Bool("webdav", false, "serve WebDAV instead of plain HTTP downloads")
+    sftpAddr := flags.String("sftp", "", "address of the SFTP server, e.g. :2022")
+    readOnly := flags.Bool("ro", false, "reject every change")
+    user := flags.String("user", "", "require this user name, with basic auth and SSH password authentication")
+    password := flags.String("password", "", "password of -user, defaults to $" + SERVE_PASSWORD_ENV)
+    certFile := flags.String("tls-cert", "", "certificate of the HTTP server, enables TLS with -tls-key")
+    keyFile := flags.String("tls-key", "", "private key of -tls-cert")
+    hostKeyFile := flags.String("host-key", "", "SSH host key, a new one is generated for every run if not set")
+    if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+        return errUsage
+    }
+    if (*httpAddr == "" && *sftpAddr == "") || (*certFile == "") != (*keyFile == "") {
+        return errUsage
+    }
+    if *password == "" {
+        *password = os.Getenv(SERVE_PASSWORD_ENV)
+    }
+    if (*user == "") != (*password == "") {
+        return errors.New("-user requires a password, and a password requires -user")
+    }
+
+    writable := *readOnly == false && (*useWebDAV == true || *sftpAddr != "")
+    if writable == true && *user == "" {
+        return errors.New("serving WebDAV or SFTP writable requires -user, or -ro")
+    }
+    db, err := c.open(name, writable)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    check := func (u string, p string) bool {
+        return subtle.ConstantTimeCompare([]byte(u), []byte(*user)) &
+            subtle.ConstantTimeCompare([]byte(p), []byte(*password)) == 1
+    }
+
+    var servers []func () error
+    defer func () {
+        for _, stop := range servers {
+            stop()
+        }
+    }()
+
+    if *httpAddr != "" {
+        listener, err := net.Listen("tcp", *httpAddr)
+        if err != nil {
+            return err
+        }
+
+        var handler http.Handler = http.FileServer(db.HTTPFileSystem())
+        if *useWebDAV == true {
+            handler = webdav.NewHandler(db)
+            if *readOnly == true {
+                handler = readOnlyHandler(handler)
+            }
+        }
+        if *user != "" {
+            handler = basicAuth(handler, check)
+        }
+
+        server := &http.Server{ Handler: handler }
+        scheme := "http"
+        if *certFile != "" {
+            scheme = "https"
+            go server.ServeTLS(listener, *certFile, *keyFile)
+        } else {
+            go server.Serve(listener)
+        }
+        servers = append(servers, server.Close)
+        fmt.Fprintln(c.stderr, "govfs: serving " + name + " on " + scheme + "://" + listener.Addr().String() + "/")
+    }
+
+    if *sftpAddr != "" {
+        config, hostKey, err := sshConfig(*hostKeyFile, *user, check)
+        if err != nil {
+            return err
+        }
+        listener, err := net.Listen("tcp", *sftpAddr)
+        if err != nil {
+            return err
+        }
+
+        go sftp.Serve(listener, config, db, *readOnly)
+        servers = append(servers, listener.Close)
+        fmt.Fprintln(c.stderr, "govfs: serving " + name + " on sftp://" + listener.Addr().String() + "/, host key " +
+            ssh.FingerprintSHA256(hostKey.PublicKey()))
+    }
+
+    waitForSignal()
+
+    for _, stop := range servers {
+        stop()
+    }
+    servers = nil
+    if writable == false {
+        return nil
+    }
+
+    return db.UnmountDB(c.commitFlags())
+}
+
+func basicAuth(next http.Handler, check func (string, string) bool) http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        if u, p, ok := r.BasicAuth(); ok == false || check(u, p) == false {
+            w.Header().Set("WWW-Authenticate", `Basic realm="govfs"`)
+            http.Error(w, "unauthorized", http.StatusUnauthorized)
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+/*
+ * Without a user, every client is accepted
+ */
+func sshConfig(hostKeyFile string, user string, check func (string, string) bool) (*ssh.ServerConfig, ssh.Signer, error) {
+    var hostKey ssh.Signer
+    if hostKeyFile != "" {
+        pem, err := os.ReadFile(hostKeyFile)
+        if err != nil {
+            return nil, nil, err
+        }
+        if hostKey, err = ssh.ParsePrivateKey(pem); err != nil {
+            return nil, nil, errors.New(hostKeyFile + ": " + err.Error())
+        }
+    } else {
+        _, private, err := ed25519.GenerateKey(rand.Reader)
+        if err != nil {
+            return nil, nil, err
+        }
+        if hostKey, err = ssh.NewSignerFromKey(private); err != nil {
+            return nil, nil, err
+        }
+    }
+
+    config := &ssh.ServerConfig{ NoClientAuth: user == "" }
+    config.PasswordCallback = func (meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+        if check(meta.User(), string(password)) == false {
+            return nil, errors.New("invalid user name or password")
+        }
+        return nil, nil
+    }
+    config.AddHostKey(hostKey)
+
+    return config, hostKey, nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package main
+
+import (
+    "io"
+    "net"
+    "net/http"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/pkg/sftp"
+    "golang.org/x/crypto/ssh"
+)
+
+func freeAddr(t *testing.T) string {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer listener.Close()
+
+    return listener.Addr().String()
+}
+
+func TestServe(t *testing.T) {
+    db := filepath.Join(t.TempDir(), "test.db")
+    govfsCmd(t, "hello", db, "put", "/a.txt")
+    httpAddr, sftpAddr := freeAddr(t), freeAddr(t)
+
+    var anonymous, authorized int
+    var contents string
+    mountWith(t, &testMounter{}, func () {
+        if resp, err := http.Get("http://" + httpAddr + "/a.txt"); err == nil {
+            anonymous = resp.StatusCode
+            resp.Body.Close()
+        }
+        req, _ := http.NewRequest(http.MethodGet, "http://" + httpAddr + "/a.txt", nil)
+        req.SetBasicAuth("user", "secret")
+        if resp, err := http.DefaultClient.Do(req); err == nil {
+            data, _ := io.ReadAll(resp.Body)
+            authorized, contents = resp.StatusCode, string(data)
+            resp.Body.Close()
+        }
+    })
+    if code, _, stderr := govfsCmd(t, "", db, "serve", "-http", httpAddr, "-user", "user", "-password", "secret");
+        code != 0 {
+        t.Fatal("TEST1: serve failed: " + stderr)
+    }
+    if anonymous != http.StatusUnauthorized || authorized != http.StatusOK || contents != "hello" {
+        t.Fatal("TEST2: Unexpected HTTP responses")
+    }
+
+    var uploadErr error
+    mountWith(t, &testMounter{}, func () {
+        config := &ssh.ClientConfig{
+            User: "user",
+            Auth: []ssh.AuthMethod{ ssh.Password("secret") },
+            HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+        }
+        conn, err := ssh.Dial("tcp", sftpAddr, config)
+        if uploadErr = err; err != nil {
+            return
+        }
+        defer conn.Close()
+        client, err := sftp.NewClient(conn)
+        if uploadErr = err; err != nil {
+            return
+        }
+        defer client.Close()
+
+        file, err := client.Create("/b.txt")
+        if uploadErr = err; err != nil {
+            return
+        }
+        file.Write([]byte("uploaded"))
+        uploadErr = file.Close()
+    })
+    if code, _, stderr := govfsCmd(t, "", db, "serve", "-sftp", sftpAddr, "-user", "user", "-password", "secret");
+        code != 0 || uploadErr != nil {
+        t.Fatal("TEST3: SFTP upload failed: " + stderr)
+    }
+    if _, stdout, _ := govfsCmd(t, "", db, "cat", "/b.txt"); stdout != "uploaded" {
+        t.Fatal("TEST4: SFTP upload was not committed")
+    }
+
+    if code, _, stderr := govfsCmd(t, "", db, "serve", "-http", httpAddr, "-user", "user"); code != 1 ||
+        !strings.Contains(stderr, "password") {
+        t.Fatal("TEST5: serve without a password succeeded")
+    }
+    if code, _, _ := govfsCmd(t, "", db, "serve"); code != 2 {
+        t.Fatal("TEST6: serve without an address succeeded")
+    }
+    if code, _, stderr := govfsCmd(t, "", db, "serve", "-sftp", sftpAddr); code != 1 ||
+        !strings.Contains(stderr, "-user") {
+        t.Fatal("TEST7: Writable SFTP without a user was served")
+    }
+    if code, _, stderr := govfsCmd(t, "", db, "serve", "-http", httpAddr, "-webdav"); code != 1 ||
+        !strings.Contains(stderr, "-user") {
+        t.Fatal("TEST8: Writable WebDAV without a user was served")
+    }
+}
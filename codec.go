@@ -0,0 +1,370 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "io"
+    "errors"
+    "compress/gzip"
+    "sync"
+    "bytes"
+
+    "github.com/golang/snappy"
+    "github.com/klauspost/compress/zstd"
+    "github.com/klauspost/compress/dict"
+)
+
+const ZSTD_DICT_MAX_SIZE      int       = 64 * 1024
+const ZSTD_DICT_MIN_SAMPLES   int       = 8
+
+/*
+ * Codec is the compression algorithm used for both FLAG_COMPRESS (the whole fs
+ *  stream) and FLAG_COMPRESS_FILES (each file's data). The per-file codec is
+ *  recorded by name in the stream header, the stream codec is identified by the
+ *  magic bytes at the beginning of its output. Custom codecs must be registered
+ *  with RegisterCodec() so that they can be found on load.
+ */
+type Codec interface {
+    Name() string
+    Magic() []byte /* Prefix of every compressed stream produced by the codec */
+    Compress(data []byte) ([]byte, error)
+    Decompress(data []byte) ([]byte, error)
+}
+
+/*
+ * StreamCodec is optionally implemented by codecs which can write their output
+ *  directly to `w`. FLAG_COMPRESS_FILES commits use it to avoid holding the
+ *  compressed copy of a file in an intermediate buffer
+ */
+type StreamCodec interface {
+    CompressTo(w io.Writer, data []byte) error
+}
+
+var (
+    CodecGzip               Codec = gzipCodec{}
+    CodecZstd               Codec = &zstdCodec{}
+    CodecSnappy             Codec = snappyCodec{} /* Lowest CPU cost, for latency sensitive commits */
+)
+
+var (
+    codecs                  = map[string]Codec{}
+    codecs_lock             sync.RWMutex
+)
+
+func init() {
+    RegisterCodec(CodecGzip)
+    RegisterCodec(CodecZstd)
+    RegisterCodec(CodecSnappy)
+}
+
+/*
+ * Makes a codec available for loading databases which were compressed with it
+ */
+func RegisterCodec(c Codec) {
+    codecs_lock.Lock()
+    defer codecs_lock.Unlock()
+
+    codecs[c.Name()] = c
+}
+
+/*
+ * Returns the registered codec called `name`. Streams written before codecs were
+ *  recorded have no name, and are gzip.
+ */
+func codecByName(name string) Codec {
+    if name == "" {
+        return CodecGzip
+    }
+
+    codecs_lock.RLock()
+    defer codecs_lock.RUnlock()
+
+    return codecs[name]
+}
+
+/*
+ * Identifies the codec of a compressed stream by its magic bytes
+ */
+func detectCodec(data []byte) Codec {
+    codecs_lock.RLock()
+    defer codecs_lock.RUnlock()
+
+    for _, c := range codecs {
+        if magic := c.Magic(); len(magic) > 0 && bytes.HasPrefix(data, magic) {
+            return c
+        }
+    }
+
+    return nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+    return "gzip"
+}
+
+func (gzipCodec) Magic() []byte {
+    return []byte{ 0x1f, 0x8b }
+}
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+    return compressStream(data)
+}
+
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+    return decompressStream(data)
+}
+
+/*
+ * The deflate state of a gzip writer is large, so writers are reused between files
+ */
+var gzipWriters = sync.Pool{
+    New: func () interface{} { return gzip.NewWriter(nil) },
+}
+
+func (gzipCodec) CompressTo(w io.Writer, data []byte) error {
+    z := gzipWriters.Get().(*gzip.Writer)
+    defer gzipWriters.Put(z)
+
+    z.Reset(w)
+    if _, err := z.Write(data); err != nil {
+        return err
+    }
+
+    return z.Close()
+}
+
+/*
+ * Compresses `data` into `out` with `c`, streaming when the codec supports it. Returns
+ *  false, with `out` left in an undefined state, if the output is not smaller than
+ *  the input, in which case streaming stops as soon as that is known
+ */
+func compressInto(c Codec, out *bytes.Buffer, data []byte) (bool, error) {
+    start := out.Len()
+
+    if s, ok := c.(StreamCodec); ok == true {
+        err := s.CompressTo(&limitWriter{ out: out, limit: start + len(data) }, data)
+        if errors.Is(err, errNoGain) {
+            return false, nil
+        }
+        return err == nil, err
+    }
+
+    compressed, err := c.Compress(data)
+    if err != nil || len(compressed) >= len(data) {
+        return false, err
+    }
+    out.Write(compressed)
+
+    return true, nil
+}
+
+var errNoGain = errors.New("compressed data is not smaller")
+
+/*
+ * Fails writes which would grow `out` to `limit` bytes or more
+ */
+type limitWriter struct {
+    out     *bytes.Buffer
+    limit   int
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+    if l.out.Len() + len(p) >= l.limit {
+        return 0, errNoGain
+    }
+
+    return l.out.Write(p)
+}
+
+/*
+ * The zstd encoder and decoder are expensive to create, but safe for concurrent
+ *  use with EncodeAll/DecodeAll, so one of each is shared by every commit
+ */
+type zstdCodec struct {
+    init        sync.Once
+    encoder     *zstd.Encoder
+    decoder     *zstd.Decoder
+    err         error
+    dict        []byte /* Shared dictionary for per-file compression, see TrainDictionary() */
+}
+
+func (c *zstdCodec) Name() string {
+    return "zstd"
+}
+
+func (c *zstdCodec) Magic() []byte {
+    return []byte{ 0x28, 0xb5, 0x2f, 0xfd }
+}
+
+func (c *zstdCodec) setup() error {
+    c.init.Do(func () {
+        var (
+            eopts []zstd.EOption
+            dopts []zstd.DOption
+        )
+        if c.dict != nil {
+            eopts = append(eopts, zstd.WithEncoderDict(c.dict))
+            dopts = append(dopts, zstd.WithDecoderDicts(c.dict))
+        }
+
+        if c.encoder, c.err = zstd.NewWriter(nil, eopts...); c.err != nil {
+            return
+        }
+        c.decoder, c.err = zstd.NewReader(nil, dopts...)
+    })
+
+    return c.err
+}
+
+func (c *zstdCodec) Compress(data []byte) ([]byte, error) {
+    if err := c.setup(); err != nil {
+        return nil, err
+    }
+
+    return c.encoder.EncodeAll(data, make([]byte, 0, len(data))), nil
+}
+
+func (c *zstdCodec) Decompress(data []byte) ([]byte, error) {
+    if err := c.setup(); err != nil {
+        return nil, err
+    }
+
+    return c.decoder.DecodeAll(data, nil)
+}
+
+/*
+ * Snappy trades compression ratio for speed. The framed format is used since,
+ *  unlike the block format, it begins with a magic chunk
+ */
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string {
+    return "snappy"
+}
+
+func (snappyCodec) Magic() []byte {
+    return []byte("\xff\x06\x00\x00sNaPpY")
+}
+
+func (snappyCodec) Compress(data []byte) ([]byte, error) {
+    var output bytes.Buffer
+
+    w := snappy.NewBufferedWriter(&output)
+    if _, err := w.Write(data); err != nil {
+        return nil, err
+    }
+    if err := w.Close(); err != nil {
+        return nil, err
+    }
+
+    return output.Bytes(), nil
+}
+
+func (snappyCodec) Decompress(data []byte) ([]byte, error) {
+    var output bytes.Buffer
+
+    if _, err := io.Copy(&output, snappy.NewReader(bytes.NewReader(data))); err != nil {
+        return nil, err
+    }
+
+    return output.Bytes(), nil
+}
+
+/*
+ * Trains a zstd dictionary from the contents of the files currently in the database.
+ *  When the database codec is CodecZstd, the dictionary is stored in the stream
+ *  header and used for FLAG_COMPRESS_FILES, which greatly improves the ratio for
+ *  many small, similar files (JSON, configs). `maxSize` of 0 uses ZSTD_DICT_MAX_SIZE.
+ */
+func (f *FSHeader) TrainDictionary(maxSize int) error {
+    if maxSize <= 0 {
+        maxSize = ZSTD_DICT_MAX_SIZE
+    }
+
+    var samples [][]byte
+    for _, v := range f.files() {
+        v.lock.Lock()
+        if (v.flags & FLAG_FILE) == 0 || v.size == 0 {
+            v.lock.Unlock()
+            continue
+        }
+
+        data, err := f.unsealData(v)
+        v.lock.Unlock()
+        if err != nil {
+            return err
+        }
+        samples = append(samples, data)
+    }
+
+    if len(samples) < ZSTD_DICT_MIN_SAMPLES {
+        return retErrStr("TrainDictionary: Not enough files to train a dictionary")
+    }
+
+    trained, err := dict.BuildZstdDict(samples, dict.Options{ MaxDictSize: maxSize, HashBytes: 6 })
+    if err != nil {
+        return err
+    }
+
+    return f.SetDictionary(trained)
+}
+
+/*
+ * Sets (or with nil, removes) the zstd dictionary used for FLAG_COMPRESS_FILES
+ */
+func (f *FSHeader) SetDictionary(d []byte) error {
+    if d == nil {
+        f.dictionary = nil
+        f.dict_codec = nil
+        return nil
+    }
+
+    codec := &zstdCodec{ dict: append([]byte(nil), d...) }
+    if err := codec.setup(); err != nil {
+        return err
+    }
+
+    f.dictionary = codec.dict
+    f.dict_codec = codec
+    return nil
+}
+
+/*
+ * Returns the zstd dictionary, or nil
+ */
+func (f *FSHeader) Dictionary() []byte {
+    return f.dictionary
+}
+
+/*
+ * The codec used for the data of each file. The dictionary only applies to zstd
+ */
+func (f *FSHeader) fileCodec() Codec {
+    if f.dict_codec != nil && f.config.Codec == CodecZstd {
+        return f.dict_codec
+    }
+
+    return f.config.Codec
+}
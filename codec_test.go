@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+    "crypto/rand"
+)
+
+func TestCodecs(t *testing.T) {
+    debugOut("[+] Running Compression Codec Test...")
+
+    data := bytes.Repeat([]byte("compressible codec test data "), 512)
+
+    for _, c := range []Codec{ CodecGzip, CodecZstd, CodecSnappy } {
+        var filename = gen_raw_filename("test_codec_" + c.Name())
+        os.Remove(filename)
+
+        config := &DBConfig{ Codec: c }
+        header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | FLAG_COMPRESS, config)
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to create database with codec " + c.Name(), t)
+        }
+        header.StartIOController()
+        header.Create("/folder0/file0")
+        header.Write("/folder0/file0", data)
+
+        if err := header.UnmountDB(FLAG_COMPRESS_FILES); err != nil {
+            drive_fail("TEST2: Failed to commit database with codec " + c.Name(), t)
+        }
+
+        /* Skip the stream envelope */
+        raw, _ := os.ReadFile(filename)
+        if !bytes.HasPrefix(raw[2:], c.Magic()) || len(raw) >= len(data) {
+            drive_fail("TEST3: Stream was not compressed with codec " + c.Name(), t)
+        }
+
+        /* The codec is recorded in the stream, so load with the default config */
+        loaded, err := CreateDatabase(filename, FLAG_DB_LOAD | FLAG_COMPRESS)
+        if loaded == nil || err != nil {
+            drive_fail("TEST4: Failed to load database with codec " + c.Name(), t)
+        }
+        if output, _ := loaded.Read("/folder0/file0"); !bytes.Equal(output, data) {
+            drive_fail("TEST5: Data mismatch after load with codec " + c.Name(), t)
+        }
+
+        os.Remove(filename)
+        debugOut("[+] Codec " + c.Name() + " PASS")
+    }
+}
+
+func TestStreamCompression(t *testing.T) {
+    debugOut("[+] Running Streaming Compression Test...")
+
+    data := bytes.Repeat([]byte("streamed per-file compression "), 64 * 1024)
+
+    /* Output of CompressTo() must be readable by Decompress() */
+    var out bytes.Buffer
+    out.WriteString("prefix")
+    if smaller, err := compressInto(CodecGzip, &out, data); smaller != true || err != nil {
+        drive_fail("TEST1: Compressible data was not compressed", t)
+    }
+    if output, err := CodecGzip.Decompress(out.Bytes()[6:]); err != nil || !bytes.Equal(output, data) {
+        drive_fail("TEST2: Streamed gzip output does not decompress", t)
+    }
+
+    /* Streaming stops once the output is known to be no smaller */
+    random := make([]byte, 64 * 1024)
+    rand.Read(random)
+    for _, c := range []Codec{ CodecGzip, CodecSnappy } {
+        out.Reset()
+        if smaller, err := compressInto(c, &out, random); smaller != false || err != nil {
+            drive_fail("TEST3: Incompressible data was kept compressed with " + c.Name(), t)
+        }
+        if out.Len() >= len(random) {
+            drive_fail("TEST4: Output grew past the input with " + c.Name(), t)
+        }
+    }
+
+    /* Commit and load a large file, with and without an encryption policy */
+    var filename = gen_raw_filename("test_stream_compress")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ Policies: map[string]*EncryptionPolicy{ "/secret": { Key: []byte("stream policy key") } } }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST5: Failed to create database", t)
+    }
+    header.StartIOController()
+    for _, name := range []string{ "/plain/large", "/secret/large" } {
+        header.Create(name)
+        header.Write(name, data)
+    }
+    if err := header.UnmountDB(FLAG_COMPRESS_FILES); err != nil {
+        drive_fail("TEST6: Failed to commit database", t)
+    }
+
+    raw, _ := os.ReadFile(filename)
+    if len(raw) >= len(data) {
+        drive_fail("TEST7: File data was not compressed", t)
+    }
+
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, config)
+    if loaded == nil || err != nil {
+        drive_fail("TEST8: Failed to load database", t)
+    }
+    for _, name := range []string{ "/plain/large", "/secret/large" } {
+        if output, _ := loaded.Read(name); !bytes.Equal(output, data) {
+            drive_fail("TEST9: Data mismatch after load of " + name, t)
+        }
+    }
+    stats := loaded.CompressionStats()
+    if stats.Compressed != 2 {
+        drive_fail("TEST10: Expected both files to be compressed", t)
+    }
+}
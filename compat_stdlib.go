@@ -0,0 +1,93 @@
+//go:build govfs_stdlib
+// +build govfs_stdlib
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package govfs
+
+/*
+ * Standard library implementations of the helpers in compat_util.go, selected
+ *  with `-tags govfs_stdlib`. This build has no dependency on the util or cryptog
+ *  packages. Streams are compressed with compress/gzip and FLAG_ENCRYPT with
+ *  CipherRC4 uses crypto/rc4.
+ */
+
+import (
+    "os"
+    "fmt"
+    "bytes"
+    "errors"
+    "io"
+    "crypto/rc4"
+    "compress/gzip"
+)
+
+func retErrStr(msg string) error {
+    return errors.New(msg)
+}
+
+func debugOut(msg string) {
+    fmt.Fprintln(os.Stdout, msg)
+}
+
+func throwN(msg string) {
+    panic(msg)
+}
+
+func compressStream(data []byte) ([]byte, error) {
+    var output bytes.Buffer
+
+    w := gzip.NewWriter(&output)
+    if _, err := w.Write(data); err != nil {
+        return nil, err
+    }
+    if err := w.Close(); err != nil {
+        return nil, err
+    }
+
+    return output.Bytes(), nil
+}
+
+func decompressStream(data []byte) ([]byte, error) {
+    r, err := gzip.NewReader(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    defer r.Close()
+
+    return io.ReadAll(r)
+}
+
+func rc4Encrypt(data []byte, key []byte) ([]byte, error) {
+    c, err := rc4.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+
+    output := make([]byte, len(data))
+    c.XORKeyStream(output, data)
+    return output, nil
+}
+
+func rc4Decrypt(data []byte, key []byte) ([]byte, error) {
+    return rc4Encrypt(data, key)
+}
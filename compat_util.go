@@ -0,0 +1,64 @@
+//go:build !govfs_stdlib
+// +build !govfs_stdlib
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package govfs
+
+/*
+ * Default helper implementations, provided by github.com/AlexRuzin/util and
+ *  github.com/AlexRuzin/cryptog. Build with `-tags govfs_stdlib` to use the
+ *  standard library implementations in compat_stdlib.go instead.
+ */
+
+import (
+    "github.com/AlexRuzin/util"
+    "github.com/AlexRuzin/cryptog"
+)
+
+func retErrStr(msg string) error {
+    return util.RetErrStr(msg)
+}
+
+func debugOut(msg string) {
+    util.DebugOut(msg)
+}
+
+func throwN(msg string) {
+    util.ThrowN(msg)
+}
+
+func compressStream(data []byte) ([]byte, error) {
+    return util.CompressStream(data)
+}
+
+func decompressStream(data []byte) ([]byte, error) {
+    return util.DecompressStream(data)
+}
+
+func rc4Encrypt(data []byte, key []byte) ([]byte, error) {
+    return cryptog.RC4_Encrypt(data, &key)
+}
+
+func rc4Decrypt(data []byte, key []byte) ([]byte, error) {
+    return cryptog.RC4_Decrypt(data, &key)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "sort"
+)
+
+/*
+ * Compression statistics of a single file, as of the last commit or load
+ */
+type FileCompressionStats struct {
+    Name        string
+    RawSize     int64 /* Size of the file data */
+    StoredSize  int64 /* Size of the data in the stream, after compression and subtree encryption */
+    Codec       string /* "" if the data is stored uncompressed */
+    Decision    string /* RawFile.Compression, e.g. COMPRESS_SKIP_ENTROPY */
+    Ratio       float64 /* StoredSize / RawSize, 1.0 for empty files */
+}
+
+/*
+ * Aggregate compression statistics. Sizes only account for file data, StreamSize is
+ *  the size of the raw fs file after FLAG_COMPRESS and FLAG_ENCRYPT
+ */
+type CompressionStats struct {
+    Files       []FileCompressionStats /* Sorted by name */
+    Codec       string
+    RawSize     int64
+    StoredSize  int64
+    StreamSize  int64
+    Compressed  uint /* Number of files stored compressed */
+    Skipped     uint /* Number of files where compression was skipped by the heuristics */
+    Ratio       float64
+}
+
+/*
+ * Returns the compression statistics of the last commit, or of the load if the
+ *  database has not been committed since
+ */
+func (f *FSHeader) CompressionStats() CompressionStats {
+    f.stats_lock.Lock()
+    defer f.stats_lock.Unlock()
+
+    output := f.comp_stats
+    output.Files = append([]FileCompressionStats(nil), f.comp_stats.Files...)
+    return output
+}
+
+func (f *FSHeader) setCompressionStats(stats CompressionStats) {
+    sort.Slice(stats.Files, func (i, j int) bool {
+        return stats.Files[i].Name < stats.Files[j].Name
+    })
+
+    f.stats_lock.Lock()
+    f.comp_stats = stats
+    f.stats_lock.Unlock()
+}
+
+func newCompressionStats(codec string) CompressionStats {
+    return CompressionStats{ Codec: codec, Ratio: 1.0 }
+}
+
+func (c *CompressionStats) add(raw *RawFile, codec string) {
+    var stored = raw.StoredLen
+    if stored == 0 {
+        stored = raw.UnzippedLen
+    }
+
+    file := FileCompressionStats{
+        Name:       raw.Name,
+        RawSize:    int64(raw.UnzippedLen),
+        StoredSize: int64(stored),
+        Decision:   raw.Compression,
+        Ratio:      1.0,
+    }
+
+    if (raw.Flags & FLAG_COMPRESS) > 0 {
+        file.Codec = codec
+        c.Compressed += 1
+    } else if raw.Compression != COMPRESS_NONE && raw.Compression != COMPRESS_APPLIED {
+        c.Skipped += 1
+    }
+
+    if file.RawSize > 0 {
+        file.Ratio = float64(file.StoredSize) / float64(file.RawSize)
+    }
+
+    c.Files = append(c.Files, file)
+    c.RawSize += file.RawSize
+    c.StoredSize += file.StoredSize
+    if c.RawSize > 0 {
+        c.Ratio = float64(c.StoredSize) / float64(c.RawSize)
+    }
+}
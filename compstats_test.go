@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+    "crypto/rand"
+)
+
+func TestCompressionStats(t *testing.T) {
+    debugOut("[+] Running Compression Stats Test...")
+
+    var filename = gen_raw_filename("test_compstats")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ Codec: CodecZstd })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    random := make([]byte, 8192)
+    rand.Read(random)
+    text := bytes.Repeat([]byte("compression stats "), 1024)
+
+    header.Create("/random")
+    header.Write("/random", random)
+    header.Create("/text")
+    header.Write("/text", text)
+    header.Create("/dir/empty")
+
+    if err := header.UnmountDB(FLAG_COMPRESS_FILES); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+
+    stats := header.CompressionStats()
+    if stats.Codec != "zstd" || stats.Compressed != 1 || stats.Skipped != 1 || len(stats.Files) != 4 {
+        drive_fail("TEST3: Invalid aggregate compression stats", t)
+    }
+    if stats.RawSize != int64(len(random) + len(text)) || stats.StoredSize >= stats.RawSize || stats.StreamSize == 0 {
+        drive_fail("TEST4: Invalid aggregate sizes", t)
+    }
+    for _, v := range stats.Files {
+        if v.Name == "/text" && (v.Codec != "zstd" || v.Ratio >= 0.5) {
+            drive_fail("TEST5: Invalid stats for compressed file", t)
+        }
+        if v.Name == "/random" && (v.Codec != "" || v.Decision != COMPRESS_SKIP_ENTROPY || v.Ratio != 1.0) {
+            drive_fail("TEST6: Invalid stats for skipped file", t)
+        }
+    }
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST7: Failed to load database", t)
+    }
+    if loaded.CompressionStats().StoredSize != stats.StoredSize || loaded.CompressionStats().StreamSize != stats.StreamSize {
+        drive_fail("TEST8: Stats after load do not match the commit", t)
+    }
+
+    debugOut("[+] Compression Stats Test PASS")
+}
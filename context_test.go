@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "time"
+    "errors"
+    "context"
+)
+
+func TestContext(t *testing.T) {
+    debugOut("[+] Running Context Test...")
+
+    var filename = gen_raw_filename("test_context")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+
+    ctx := context.Background()
+    if err := header.CreateCtx(ctx, "/file0"); err != nil {
+        drive_fail("TEST2: Failed to create file0", t)
+    }
+    if err := header.WriteCtx(ctx, "/file0", []byte("context")); err != nil {
+        drive_fail("TEST3: Failed to write file0", t)
+    }
+    if output, err := header.ReadCtx(ctx, "/file0"); err != nil || string(output) != "context" {
+        drive_fail("TEST4: Failed to read file0", t)
+    }
+
+    cancelled, cancel := context.WithCancel(ctx)
+    cancel()
+    if err := header.CreateCtx(cancelled, "/file1"); !errors.Is(err, context.Canceled) {
+        drive_fail("TEST5: CreateCtx ignored a cancelled context", t)
+    }
+    if _, err := header.ReadCtx(cancelled, "/file0"); !errors.Is(err, context.Canceled) {
+        drive_fail("TEST5.1: ReadCtx ignored a cancelled context", t)
+    }
+
+    /* Stall the IO controller by swapping in a channel that is never serviced */
+    header.ctl_lock.Lock()
+    io_in := header.io_in
+    header.io_in = make(chan *govfsIoBlock)
+    header.ctl_lock.Unlock()
+
+    timeout, cancel := context.WithTimeout(ctx, 50 * time.Millisecond)
+    defer cancel()
+    if err := header.WriteCtx(timeout, "/file0", []byte("stuck")); !errors.Is(err, context.DeadlineExceeded) {
+        drive_fail("TEST6: WriteCtx did not time out behind a busy IO controller", t)
+    }
+    if err := header.DeleteCtx(timeout, "/file0"); !errors.Is(err, context.DeadlineExceeded) {
+        drive_fail("TEST6.1: DeleteCtx did not time out behind a busy IO controller", t)
+    }
+
+    header.ctl_lock.Lock()
+    header.io_in = io_in
+    header.ctl_lock.Unlock()
+
+    if err := header.DeleteCtx(ctx, "/file0"); err != nil {
+        drive_fail("TEST7: Failed to delete file0", t)
+    }
+    header.Close()
+
+    debugOut("[+] Context Test PASS")
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "errors"
+)
+
+func TestControllerStopped(t *testing.T) {
+    debugOut("[+] Running Controller State Test...")
+
+    var filename = gen_raw_filename("test_controller")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+
+    /* Nothing may block before StartIOController() */
+    if header.ControllerRunning() {
+        drive_fail("TEST2: Controller reported running before StartIOController()", t)
+    }
+    if err := header.Create("/file0"); !errors.Is(err, ErrControllerStopped) {
+        drive_fail("TEST2.1: Create did not return ErrControllerStopped", t)
+    }
+    if err := <- header.CreateAsync("/file0"); !errors.Is(err, ErrControllerStopped) {
+        drive_fail("TEST2.2: CreateAsync did not return ErrControllerStopped", t)
+    }
+
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST3: Failed to start IOController", t)
+    }
+    if !header.ControllerRunning() || header.StartIOController() == nil {
+        drive_fail("TEST3.1: Unexpected controller state after StartIOController()", t)
+    }
+    if err := header.Create("/file0"); err != nil {
+        drive_fail("TEST4: Failed to create file0", t)
+    }
+
+    /* Stopping the controller must not leave callers blocked or panicking */
+    if err := header.Close(); err != nil {
+        drive_fail("TEST5: Failed to close database", t)
+    }
+    if header.ControllerRunning() {
+        drive_fail("TEST6: Controller reported running after Close()", t)
+    }
+    if err := header.Write("/file0", []byte("closed")); !errors.Is(err, ErrControllerStopped) || !errors.Is(err, ErrClosed) {
+        drive_fail("TEST7: Write after Close() did not return ErrClosed", t)
+    }
+
+    debugOut("[+] Controller State Test PASS")
+}
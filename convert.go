@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Conversion between database options: cipher, key, FLAG_ENCRYPT, FLAG_COMPRESS, codec,
+ *  and between a raw fs stream and a RecordStorage. Names, flags and modification times
+ *  of all files are kept. The raw fs stream has a single serialization (gob), so there
+ *  is no other encoding to convert it to.
+ *
+ * The audit log is verified with the source key and rechained with the destination key.
+ *  The streams of named volumes are copied as they are, since each volume has its own
+ *  options, and cannot be converted to a RecordStorage.
+ */
+
+/*
+ * Rewrites the database `src`, which must exist, as `dst` with the destination flags
+ *  and configuration. `dst` may be the same as `src` for a raw fs stream, it is only
+ *  written once `src` was read entirely. `commitFlags` are passed to UnmountDB()
+ */
+func Convert(src string, srcFlags FlagVal, srcConfig *DBConfig,
+             dst string, dstFlags FlagVal, dstConfig *DBConfig, commitFlags FlagVal) error {
+    from, err := CreateDatabaseConfig(src, (srcFlags | FLAG_DB_LOAD) &^ FLAG_DB_CREATE, srcConfig)
+    if err != nil {
+        return err
+    }
+    defer from.Close()
+
+    if err := from.VerifyAudit(); err != nil {
+        return err
+    }
+
+    to, err := CreateDatabaseConfig(dst, (dstFlags | FLAG_DB_CREATE) &^ FLAG_DB_LOAD, dstConfig)
+    if err != nil {
+        return err
+    }
+    defer to.Close()
+
+    /* Replaces every record of an existing RecordStorage */
+    to.markPurged()
+
+    for _, file := range from.files() {
+        if file.filename == "/" {
+            continue
+        }
+        if err := to.copyFile(from, file); err != nil {
+            return err
+        }
+    }
+
+    to.rechainAudit(from.auditEntries())
+    for key, value := range from.Labels() {
+        to.SetLabel(key, value)
+    }
+    if volumes := from.volumes.snapshot(); len(volumes) > 0 {
+        if to.config.Records != nil {
+            return retErrStr("Convert: Volumes require a raw fs stream")
+        }
+        to.volumes.set(volumes)
+    }
+
+    return to.UnmountDB(commitFlags)
+}
+
+func (f *FSHeader) copyFile(from *FSHeader, file *govfsFile) error {
+    file.lock.Lock()
+    data, err := from.unsealData(file)
+    output := &govfsFile{ filename: file.filename, flags: file.flags, modtime: file.modtime,
+        xattrs: copyXattrs(file.xattrs) }
+    generation := file.generation()
+    file.lock.Unlock()
+    if err != nil {
+        return retErrStr("Convert: " + file.filename + ": " + err.Error())
+    }
+    if from.mem_cipher != nil || file.spill != nil {
+        defer wipeBuffer(data, false)
+    }
+
+    output.lock.Lock()
+    defer output.lock.Unlock()
+
+    if len(data) > 0 {
+        spill, err := f.checkMemory(output, data)
+        if err != nil {
+            return err
+        }
+        if f.writeInternal(output, data, spill, false) != len(data) {
+            return retErrStr("Convert: " + file.filename + ": Failed to write")
+        }
+        output.modtime = file.modtime
+        output.setGeneration(generation)
+    }
+
+    f.meta.set(output.filename, output)
+    f.usage.add(output.filename, (output.flags & FLAG_DIRECTORY) > 0)
+    f.markDirty(output.filename, output)
+
+    return nil
+}
+
+/*
+ * Rehashes `entries`, which were verified, with the key of this database
+ */
+func (f *FSHeader) rechainAudit(entries []AuditEntry) {
+    key := f.config.fsKey()
+    defer ZeroKey(key)
+
+    f.audit.lock.Lock()
+    defer f.audit.lock.Unlock()
+
+    var prev []byte
+    f.audit.entries = make([]AuditEntry, len(entries))
+    for i, e := range entries {
+        e.Hash = auditHash(key, prev, &e)
+        f.audit.entries[i] = e
+        prev = e.Hash
+    }
+}
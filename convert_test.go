@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "os"
+    "testing"
+)
+
+func TestConvert(t *testing.T) {
+    debugOut("[+] Running Convert Test...")
+
+    var src = gen_raw_filename("test_convert_src")
+    var dst = gen_raw_filename("test_convert_dst")
+    defer os.Remove(src)
+    defer os.Remove(dst)
+
+    header, err := CreateDatabaseConfig(src, FLAG_DB_CREATE | FLAG_ENCRYPT, &DBConfig{ Audit: true })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    text := bytes.Repeat([]byte("convert "), 100)
+    header.Create("/docs/a.txt")
+    header.Write("/docs/a.txt", text)
+    header.Create("/empty")
+    modtime := header.check("/docs/a.txt").modTime()
+    if err := header.Shutdown(true, 0); err != nil {
+        drive_fail("TEST2: Failed to commit", t)
+    }
+
+    /* RC4 with the hostname key to AES-GCM with a key, compressed with zstd */
+    key := bytes.Repeat([]byte{ 3 }, 32)
+    config := &DBConfig{ Cipher: CipherAESGCM, Key: key, Codec: CodecZstd }
+    if err := Convert(src, FLAG_ENCRYPT, nil, dst, FLAG_ENCRYPT | FLAG_COMPRESS, config, FLAG_COMPRESS_FILES); err != nil {
+        drive_fail("TEST3: Convert failed", t)
+    }
+
+    header, err = CreateDatabaseConfig(dst, FLAG_DB_LOAD | FLAG_ENCRYPT | FLAG_COMPRESS, config)
+    if header == nil || err != nil {
+        drive_fail("TEST4: Failed to load the converted database", t)
+    }
+    header.StartIOController()
+    if data, err := header.Read("/docs/a.txt"); err != nil || !bytes.Equal(data, text) {
+        drive_fail("TEST5: Converted file has unexpected contents", t)
+    }
+    if header.Check("/empty") == false || header.Check("/docs/") == false ||
+        !header.check("/docs/a.txt").modTime().Equal(modtime) {
+        drive_fail("TEST6: Converted database has unexpected files", t)
+    }
+    if len(header.Audit(AuditQuery{})) != 3 || header.VerifyAudit() != nil {
+        drive_fail("TEST7: Audit log was not converted", t)
+    }
+    header.Close()
+
+    if _, err := CreateDatabaseConfig(dst, FLAG_DB_LOAD | FLAG_ENCRYPT, nil); err == nil {
+        drive_fail("TEST8: Converted database loaded with the old key", t)
+    }
+
+    /* In place, back to an unencrypted database */
+    if err := Convert(dst, FLAG_ENCRYPT, config, dst, 0, nil, 0); err != nil {
+        drive_fail("TEST9: In-place convert failed", t)
+    }
+    if raw, _ := os.ReadFile(dst); !bytes.Contains(raw, text) {
+        drive_fail("TEST10: Database was not decrypted", t)
+    }
+
+    debugOut("[+] Convert Test PASS")
+}
+
+func TestConvertVolumes(t *testing.T) {
+    debugOut("[+] Running Convert Volumes Test...")
+
+    var src = gen_raw_filename("test_convert_volumes_src")
+    var dst = gen_raw_filename("test_convert_volumes_dst")
+    defer os.Remove(src)
+    defer os.Remove(dst)
+
+    header, err := CreateDatabase(src, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    volume, err := header.OpenVolume("code", FLAG_DB_CREATE, nil)
+    if volume == nil || err != nil {
+        drive_fail("TEST2: Failed to create volume", t)
+    }
+    volume.StartIOController()
+    volume.Create("/main.go")
+    volume.Write("/main.go", []byte("package main"))
+    if volume.Shutdown(true, 0) != nil || header.Shutdown(true, 0) != nil {
+        drive_fail("TEST3: Failed to commit", t)
+    }
+
+    if err := Convert(src, 0, nil, dst, FLAG_ENCRYPT, nil, 0); err != nil {
+        drive_fail("TEST4: Convert failed", t)
+    }
+
+    header, err = CreateDatabase(dst, FLAG_DB_LOAD | FLAG_ENCRYPT)
+    if header == nil || err != nil {
+        drive_fail("TEST5: Failed to load the converted database", t)
+    }
+    defer header.Close()
+    if volumes := header.Volumes(); len(volumes) != 1 || volumes[0] != "code" {
+        drive_fail("TEST6: Volumes were not converted", t)
+    }
+    volume, err = header.OpenVolume("code", FLAG_DB_LOAD, nil)
+    if volume == nil || err != nil {
+        drive_fail("TEST7: Failed to open the converted volume", t)
+    }
+    volume.StartIOController()
+    defer volume.Close()
+    if data, _ := volume.Read("/main.go"); string(data) != "package main" {
+        drive_fail("TEST8: Converted volume has unexpected contents", t)
+    }
+}
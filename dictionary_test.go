@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+    "strconv"
+)
+
+func TestZstdDictionary(t *testing.T) {
+    debugOut("[+] Running Shared Dictionary Test...")
+
+    var filename = gen_raw_filename("test_dictionary")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ Codec: CodecZstd, CompressMinSize: -1 }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    files := make(map[string][]byte)
+    for i := 0; i < 256; i += 1 {
+        name := "/configs/service" + strconv.Itoa(i) + ".json"
+        files[name] = []byte(`{"service": "service` + strconv.Itoa(i) + `", "enabled": true, "replicas": ` +
+            strconv.Itoa(i % 7) + `, "endpoint": "https://internal.example.com/api/v1/service` +
+            strconv.Itoa(i) + `", "timeout_ms": 2500, "retries": 3}`)
+        header.Create(name)
+        header.Write(name, files[name])
+    }
+
+    if err := header.UnmountDB(FLAG_COMPRESS_FILES); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+    info, _ := os.Stat(filename)
+    withoutDict := info.Size()
+
+    if err := header.TrainDictionary(0); err != nil {
+        drive_fail("TEST3: Failed to train dictionary: " + err.Error(), t)
+    }
+    if err := header.UnmountDB(FLAG_COMPRESS_FILES); err != nil {
+        drive_fail("TEST4: Failed to commit database with dictionary", t)
+    }
+    info, _ = os.Stat(filename)
+    if info.Size() >= withoutDict {
+        drive_fail("TEST5: Dictionary did not improve the compression ratio", t)
+    }
+    debugOut("[+] Stream size without dictionary: " + strconv.Itoa(int(withoutDict)) +
+        ", with dictionary: " + strconv.Itoa(int(info.Size())))
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST6: Failed to load database with dictionary", t)
+    }
+    if loaded.Dictionary() == nil {
+        drive_fail("TEST7: Dictionary was not loaded from the header", t)
+    }
+    for name, data := range files {
+        if output, _ := loaded.Read(name); !bytes.Equal(output, data) {
+            drive_fail("TEST8: Data mismatch after load for " + name, t)
+        }
+    }
+
+    debugOut("[+] Shared Dictionary Test PASS")
+}
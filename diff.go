@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Differences between two databases, by name. Files are compared by their checksums,
+ *  which are known without reading the data of unloaded records, unless the two were
+ *  summed with different algorithms, see DBConfig.Checksum.
+ */
+
+import (
+    "sort"
+    "bytes"
+)
+
+const (
+    DIFF_ADDED                string    = "added"
+    DIFF_REMOVED              string    = "removed"
+    DIFF_CHANGED              string    = "changed" /* Contents, or a file became a directory */
+)
+
+type Change struct {
+    Path        string
+    Kind        string /* DIFF_ADDED, DIFF_REMOVED or DIFF_CHANGED */
+    OldSize     int /* 0 if added */
+    NewSize     int /* 0 if removed */
+    OldSum      string /* Checksum of the data, "" for directories and empty files */
+    NewSum      string
+}
+
+type diffEntry struct {
+    dir         bool
+    size        int
+    datasum     string
+    checksum    string /* Name of the algorithm of datasum */
+}
+
+/*
+ * Returns the changes from this database to `other`, sorted by path
+ */
+func (f *FSHeader) Diff(other *FSHeader) ([]Change, error) {
+    if f.isClosed() || other.isClosed() {
+        return nil, ErrClosed
+    }
+
+    old, new := f.diffEntries(), other.diffEntries()
+
+    var output []Change
+    for name, o := range old {
+        n, ok := new[name]
+        switch {
+        case ok == false:
+            output = append(output, Change{ Path: name, Kind: DIFF_REMOVED, OldSize: o.size, OldSum: o.datasum })
+        default:
+            changed, err := f.diffChanged(other, name, o, n)
+            if err != nil {
+                return nil, err
+            }
+            if changed == false {
+                continue
+            }
+            output = append(output, Change{ Path: name, Kind: DIFF_CHANGED, OldSize: o.size, NewSize: n.size,
+                OldSum: o.datasum, NewSum: n.datasum })
+        }
+    }
+    for name, n := range new {
+        if _, ok := old[name]; ok == false {
+            output = append(output, Change{ Path: name, Kind: DIFF_ADDED, NewSize: n.size, NewSum: n.datasum })
+        }
+    }
+
+    sort.Slice(output, func (i, j int) bool {
+        return output[i].Path < output[j].Path
+    })
+
+    return output, nil
+}
+
+/*
+ * Sums of different algorithms cannot be compared, so then the contents are
+ */
+func (f *FSHeader) diffChanged(other *FSHeader, name string, o, n diffEntry) (bool, error) {
+    switch {
+    case o.dir != n.dir || o.size != n.size:
+        return true, nil
+    case o.datasum == n.datasum:
+        return false, nil
+    case o.checksum == n.checksum:
+        return true, nil
+    }
+
+    a, err := f.Read(name)
+    if err != nil {
+        return false, err
+    }
+    b, err := other.Read(name)
+    if err != nil {
+        return false, err
+    }
+
+    return bytes.Equal(a, b) == false, nil
+}
+
+func (f *FSHeader) diffEntries() map[string]diffEntry {
+    output := make(map[string]diffEntry)
+    for _, file := range f.files() {
+        if file.filename == "/" {
+            continue
+        }
+
+        file.lock.Lock()
+        e := diffEntry{ dir: (file.flags & FLAG_DIRECTORY) > 0, size: file.size, datasum: file.dataSum(),
+            checksum: checksumName(file.sumAlgorithm()) }
+        file.lock.Unlock()
+        if e.size == 0 {
+            e.datasum, e.checksum = "", ""
+        }
+
+        output[file.filename] = e
+    }
+
+    return output
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+)
+
+func TestDiff(t *testing.T) {
+    debugOut("[+] Running Diff Test...")
+
+    old, err := CreateDatabaseConfig("diff_old", FLAG_DB_CREATE, nil)
+    if old == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    old.StartIOController()
+    defer old.Close()
+    new, err := CreateDatabaseConfig("diff_new", FLAG_DB_CREATE, nil)
+    if new == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    new.StartIOController()
+    defer new.Close()
+
+    for _, h := range []*FSHeader{ old, new } {
+        h.Create("/same")
+        h.Write("/same", []byte("unchanged"))
+        h.Create("/dir/")
+    }
+    old.Create("/changed")
+    old.Write("/changed", []byte("before"))
+    new.Create("/changed")
+    new.Write("/changed", []byte("after!!"))
+    old.Create("/removed")
+    old.Write("/removed", []byte("gone"))
+    new.Create("/added")
+
+    changes, err := old.Diff(new)
+    if err != nil || len(changes) != 3 {
+        drive_fail("TEST2: Unexpected number of changes", t)
+    }
+    if c := changes[0]; c.Path != "/added" || c.Kind != DIFF_ADDED || c.NewSize != 0 || c.NewSum != "" {
+        drive_fail("TEST3: /added is not reported as added", t)
+    }
+    if c := changes[1]; c.Path != "/changed" || c.Kind != DIFF_CHANGED || c.OldSize != 6 || c.NewSize != 7 ||
+        c.OldSum == "" || c.OldSum == c.NewSum {
+        drive_fail("TEST4: /changed is not reported as changed", t)
+    }
+    if c := changes[2]; c.Path != "/removed" || c.Kind != DIFF_REMOVED || c.OldSize != 4 || c.OldSum == "" {
+        drive_fail("TEST5: /removed is not reported as removed", t)
+    }
+
+    if changes, err := new.Diff(new); err != nil || len(changes) != 0 {
+        drive_fail("TEST6: A database differs from itself", t)
+    }
+}
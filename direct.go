@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+    "time"
+)
+
+/*
+ * DBConfig.Direct mode. Single-goroutine embedders pay for two channel round trips
+ *  and a goroutine switch per operation when going through the IO controller. In
+ *  direct mode the IRP is dispatched by the calling goroutine under direct_lock, so
+ *  StartIOController() is not required. Priorities and queue settings do not apply.
+ */
+func (f *FSHeader) dispatchDirect(ctx context.Context, irp *govfsIoBlock) (*govfsIoBlock, error) {
+    if err := f.throttleIRP(ctx, irp); err != nil {
+        return nil, err
+    }
+
+    /* Held for the whole operation, so that Close() waits for it to finish */
+    f.ctl_lock.RLock()
+    defer f.ctl_lock.RUnlock()
+
+    if f.closed == true {
+        return nil, ErrClosed
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+
+    irp.queued = time.Now()
+    irp.principal = principalFromContext(ctx)
+    f.trackIRP(irp)
+    defer f.untrackIRP(irp)
+
+    f.direct_lock.Lock()
+    f.startIRP(irp)
+    f.dispatch(irp)
+    f.direct_lock.Unlock()
+
+    return irp, nil
+}
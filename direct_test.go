@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "errors"
+    "strconv"
+)
+
+func TestDirectMode(t *testing.T) {
+    debugOut("[+] Running Direct Mode Test...")
+
+    var filename = gen_raw_filename("test_direct")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ Direct: true })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+
+    /* No IO controller is required */
+    data := []byte("direct mode data")
+    if err := header.Create("/folder0/file0"); err != nil {
+        drive_fail("TEST2: Failed to create file0", t)
+    }
+    if err := header.Write("/folder0/file0", data); err != nil {
+        drive_fail("TEST3: Failed to write file0", t)
+    }
+    if err := <- header.WriteAsync("/folder0/file0", data); err != nil {
+        drive_fail("TEST3.1: Failed to write file0 asynchronously", t)
+    }
+    if err := header.Create("/folder0/file1"); err != nil {
+        drive_fail("TEST3.2: Failed to create file1", t)
+    }
+    if err := header.Delete("/folder0/file1"); err != nil || header.Check("/folder0/file1") {
+        drive_fail("TEST4: Failed to delete file1", t)
+    }
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST5: Failed to commit database", t)
+    }
+    if err := header.Close(); err != nil {
+        drive_fail("TEST6: Failed to close database", t)
+    }
+    if err := header.Write("/folder0/file0", data); !errors.Is(err, ErrClosed) {
+        drive_fail("TEST7: Write succeeded after Close()", t)
+    }
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST8: Failed to load database", t)
+    }
+    if output, _ := loaded.Read("/folder0/file0"); string(output) != string(data) || loaded.Check("/folder0/file1") {
+        drive_fail("TEST9: Data mismatch after load", t)
+    }
+
+    debugOut("[+] Direct Mode Test PASS")
+}
+
+func benchmarkWrite(b *testing.B, config *DBConfig) {
+    var filename = gen_raw_filename("bench_write")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        b.Fatal("Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    var names []string
+    for i := 0; i < 64; i += 1 {
+        names = append(names, "/bench/file" + strconv.Itoa(i))
+        header.Create(names[i])
+    }
+    data := []byte("small write")
+
+    b.ResetTimer()
+    for i := 0; i < b.N; i += 1 {
+        header.Write(names[i % len(names)], data)
+    }
+}
+
+func BenchmarkWriteController(b *testing.B) {
+    benchmarkWrite(b, nil)
+}
+
+func BenchmarkWriteDirect(b *testing.B) {
+    benchmarkWrite(b, &DBConfig{ Direct: true })
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * du-style size aggregation. Sizes are of the plaintext data, as GetTotalFilesizes().
+ *  DirSize() is kept up to date by the accounting, see accounting.go
+ */
+
+import (
+    "sort"
+)
+
+type DirUsage struct {
+    Path        string /* With a trailing "/" */
+    Bytes       uint64
+    Files       uint /* In the whole subtree */
+}
+
+/*
+ * Returns the size and number of files of the subtree beneath `dir`
+ */
+func (f *FSHeader) DirSize(dir string) (bytes uint64, files uint, err error) {
+    if f.isClosed() {
+        return 0, 0, ErrClosed
+    }
+
+    size, count, ok := f.usage.dirSize(dir)
+    if ok == false {
+        return 0, 0, pathError("tree", dir, ErrNotExist)
+    }
+
+    return uint64(size), uint(count), nil
+}
+
+/*
+ * Returns the `n` directories with the largest subtrees, largest first, or all of them
+ *  if `n` is negative. The root is not included, its size is GetTotalFilesizes()
+ */
+func (f *FSHeader) DiskUsage(n int) ([]DirUsage, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+
+    root, err := f.buildTree("/")
+    if err != nil {
+        return nil, err
+    }
+
+    var output []DirUsage
+    var walk func (node *treeNode)
+    walk = func (node *treeNode) {
+        for _, child := range node.children {
+            if child.dir == true {
+                output = append(output, DirUsage{ Path: child.name, Bytes: uint64(child.size), Files: child.files })
+                walk(child)
+            }
+        }
+    }
+    walk(root)
+
+    sort.SliceStable(output, func (i, j int) bool {
+        return output[i].Bytes > output[j].Bytes
+    })
+    if n >= 0 && len(output) > n {
+        output = output[:n]
+    }
+
+    return output, nil
+}
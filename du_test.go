@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+)
+
+func TestDiskUsage(t *testing.T) {
+    debugOut("[+] Running Disk Usage Test...")
+
+    header, err := CreateDatabaseConfig("du", FLAG_DB_CREATE, nil)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/a/small")
+    header.Write("/a/small", []byte("1"))
+    header.Create("/a/b/large")
+    header.Write("/a/b/large", make([]byte, 100))
+    header.Create("/c/medium")
+    header.Write("/c/medium", make([]byte, 50))
+    header.Create("/c/empty/")
+
+    if bytes, files, err := header.DirSize("/a"); err != nil || bytes != 101 || files != 2 {
+        drive_fail("TEST2: Invalid size of /a", t)
+    }
+    if bytes, files, err := header.DirSize("/"); err != nil || bytes != 151 || files != 3 {
+        drive_fail("TEST3: Invalid size of /", t)
+    }
+    if _, _, err := header.DirSize("/missing/"); err == nil {
+        drive_fail("TEST4: Size of a missing directory", t)
+    }
+
+    usage, err := header.DiskUsage(3)
+    if err != nil || len(usage) != 3 || usage[0] != (DirUsage{ "/a/", 101, 2 }) ||
+        usage[1] != (DirUsage{ "/a/b/", 100, 1 }) || usage[2] != (DirUsage{ "/c/", 50, 1 }) {
+        drive_fail("TEST5: Unexpected disk usage", t)
+    }
+    if usage, _ := header.DiskUsage(-1); len(usage) != 4 {
+        drive_fail("TEST6: Unlimited disk usage is incomplete", t)
+    }
+
+    debugOut("[+] Disk Usage Test PASS")
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Debug dump of the namespace, for debugging and support bundles. Directories which
+ *  were only created implicitly, by creating a file beneath them, are included.
+ */
+
+import (
+    "bufio"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+type DumpFormat int
+
+const (
+    DUMP_TEXT                 DumpFormat = iota /* Indented tree */
+    DUMP_DOT                                    /* Graphviz digraph, e.g. `dot -Tsvg` */
+)
+
+type DumpOptions struct {
+    Root        string /* Directory to dump, defaults to "/" */
+    Format      DumpFormat
+    Checksums   bool /* Include the checksum of every file */
+    MaxDepth    int /* Levels below Root, 0 for all */
+}
+
+/*
+ * A file or directory of the namespace. Directory sizes are those of their subtree
+ */
+type treeNode struct {
+    name        string /* Full name, directories with a trailing "/" */
+    dir         bool
+    flags       FlagVal
+    size        int
+    files       uint /* Files in the subtree of a directory */
+    datasum     string
+    state       string /* "unloaded", "spilled" or "" */
+    children    []*treeNode
+}
+
+/*
+ * Writes the tree beneath opts.Root to `w`. Sizes are in bytes, of the plaintext data
+ */
+func (f *FSHeader) DumpTree(w io.Writer, opts DumpOptions) error {
+    if f.isClosed() {
+        return ErrClosed
+    }
+
+    root, err := f.buildTree(opts.Root)
+    if err != nil {
+        return err
+    }
+
+    b := bufio.NewWriter(w)
+    switch opts.Format {
+    case DUMP_TEXT:
+        b.WriteString(root.name + "  " + root.describe(opts.Checksums) + "\n")
+        dumpText(b, root, "", 1, &opts)
+    case DUMP_DOT:
+        b.WriteString("digraph govfs {\n    node [shape=box];\n")
+        dumpDot(b, root, 0, &opts)
+        b.WriteString("}\n")
+    default:
+        return retErrStr("DumpTree: Invalid format")
+    }
+
+    return b.Flush()
+}
+
+func dumpText(b *bufio.Writer, node *treeNode, indent string, depth int, opts *DumpOptions) {
+    if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+        return
+    }
+
+    for i, child := range node.children {
+        branch, next := "|-- ", "|   "
+        if i == len(node.children) - 1 {
+            branch, next = "`-- ", "    "
+        }
+
+        b.WriteString(indent + branch + child.base() + "  " + child.describe(opts.Checksums) + "\n")
+        dumpText(b, child, indent + next, depth + 1, opts)
+    }
+}
+
+func dumpDot(b *bufio.Writer, node *treeNode, depth int, opts *DumpOptions) {
+    label := node.base() + "\n" + node.describe(opts.Checksums)
+    b.WriteString("    " + strconv.Quote(node.name) + " [label=" + strconv.Quote(label))
+    if node.dir == true {
+        b.WriteString(", shape=folder")
+    }
+    b.WriteString("];\n")
+
+    if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+        return
+    }
+    for _, child := range node.children {
+        b.WriteString("    " + strconv.Quote(node.name) + " -> " + strconv.Quote(child.name) + ";\n")
+        dumpDot(b, child, depth + 1, opts)
+    }
+}
+
+/*
+ * The last element of the name, with a trailing "/" for directories
+ */
+func (n *treeNode) base() string {
+    if n.name == "/" {
+        return "/"
+    }
+
+    name := strings.TrimSuffix(n.name, "/")
+    name = name[strings.LastIndex(name, "/") + 1:]
+    if n.dir == true {
+        name += "/"
+    }
+    return name
+}
+
+func (n *treeNode) describe(checksums bool) string {
+    output := strconv.Itoa(n.size)
+
+    var flags []string
+    if n.dir == true {
+        flags = append(flags, "dir", strconv.FormatUint(uint64(n.files), 10) + " files")
+    } else {
+        flags = append(flags, "file")
+    }
+    if (n.flags & FLAG_ENCRYPT) > 0 {
+        flags = append(flags, "encrypted")
+    }
+    if n.state != "" {
+        flags = append(flags, n.state)
+    }
+    output += "  [" + strings.Join(flags, " ") + "]"
+
+    if checksums == true && n.datasum != "" {
+        output += "  " + n.datasum
+    }
+
+    return output
+}
+
+/*
+ * Builds the tree beneath `root` from a snapshot of the namespace
+ */
+func (f *FSHeader) buildTree(root string) (*treeNode, error) {
+    if root == "" {
+        root = "/"
+    }
+    if strings.HasSuffix(root, "/") == false {
+        root += "/"
+    }
+
+    nodes := make(map[string]*treeNode)
+    var node func (name string, dir bool) *treeNode
+    node = func (name string, dir bool) *treeNode {
+        key := strings.TrimSuffix(name, "/")
+        if n, ok := nodes[key]; ok == true {
+            return n
+        }
+
+        n := &treeNode{ name: key, dir: dir }
+        if dir == true {
+            n.name += "/"
+        }
+        nodes[key] = n
+
+        if key != "" {
+            parent := node(key[:strings.LastIndex(key, "/") + 1], true)
+            parent.children = append(parent.children, n)
+        }
+        return n
+    }
+
+    for _, file := range f.files() {
+        file.lock.Lock()
+        flags, size, datasum := file.flags, file.size, file.dataSum()
+        var state string
+        if file.record() != nil {
+            state = "unloaded"
+        } else if file.spill != nil {
+            state = "spilled"
+        }
+        file.lock.Unlock()
+
+        n := node(file.filename, (flags & FLAG_DIRECTORY) > 0 || file.filename == "/")
+        n.flags = flags
+        if n.dir == false {
+            n.size, n.datasum, n.state = size, datasum, state
+        }
+    }
+
+    output := nodes[strings.TrimSuffix(root, "/")]
+    if output == nil || output.dir == false {
+        return nil, pathError("tree", root, ErrNotExist)
+    }
+    output.total()
+
+    return output, nil
+}
+
+/*
+ * Sorts the children and sums up the sizes of the subtree
+ */
+func (n *treeNode) total() {
+    sort.Slice(n.children, func (i, j int) bool {
+        return n.children[i].name < n.children[j].name
+    })
+
+    for _, child := range n.children {
+        child.total()
+        if child.dir == true {
+            n.files += child.files
+        } else {
+            n.files += 1
+        }
+        n.size += child.size
+    }
+}
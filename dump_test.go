@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestDumpTree(t *testing.T) {
+    debugOut("[+] Running Dump Tree Test...")
+
+    header, err := CreateDatabaseConfig("dump", FLAG_DB_CREATE, nil)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/docs/a.txt")
+    header.Write("/docs/a.txt", []byte("hello"))
+    header.Create("/docs/old/b.txt")
+    header.Write("/docs/old/b.txt", []byte("xy"))
+    header.Create("/empty/")
+    header.Create("/z")
+
+    var out bytes.Buffer
+    if err := header.DumpTree(&out, DumpOptions{}); err != nil {
+        drive_fail("TEST2: DumpTree failed", t)
+    }
+    expected := "/  7  [dir 3 files]\n" +
+        "|-- docs/  7  [dir 2 files]\n" +
+        "|   |-- a.txt  5  [file]\n" +
+        "|   `-- old/  2  [dir 1 files]\n" +
+        "|       `-- b.txt  2  [file]\n" +
+        "|-- empty/  0  [dir 0 files]\n" +
+        "`-- z  0  [file]\n"
+    if out.String() != expected {
+        drive_fail("TEST3: Unexpected tree\n" + out.String(), t)
+    }
+
+    out.Reset()
+    header.DumpTree(&out, DumpOptions{ Root: "/docs", MaxDepth: 1, Checksums: true })
+    if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 || lines[0] != "/docs/  7  [dir 2 files]" ||
+        !strings.HasSuffix(lines[1], "[file]  " + header.check("/docs/a.txt").dataSum()) {
+        drive_fail("TEST4: Unexpected subtree\n" + out.String(), t)
+    }
+
+    out.Reset()
+    header.DumpTree(&out, DumpOptions{ Format: DUMP_DOT })
+    if !strings.HasPrefix(out.String(), "digraph govfs {") || !strings.Contains(out.String(), `"/docs/" -> "/docs/old/";`) ||
+        !strings.Contains(out.String(), `"/docs/a.txt" [label="a.txt\n5  [file]"];`) {
+        drive_fail("TEST5: Unexpected graph\n" + out.String(), t)
+    }
+
+    if err := header.DumpTree(&out, DumpOptions{ Root: "/z" }); err == nil {
+        drive_fail("TEST6: Dumped a file as a directory", t)
+    }
+
+    debugOut("[+] Dump Tree Test PASS")
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Ephemeral databases, for processing secrets in RAM. An ephemeral database has no
+ *  name and can never be written to the disk: committing fails with ErrEphemeral, and
+ *  the options which keep anything in files (SpillSize, MEMORY_SPILL, Locking, Storage,
+ *  Records, VolumeSize) are rejected when it is created. Close() and Shutdown()
+ *  zero the contents of every file and the keys.
+ *
+ * Zeroing is best effort: copies which were returned by Read() belong to the caller,
+ *  and the heap may have been paged out to swap by the operating system.
+ */
+
+/*
+ * Creates an empty ephemeral database. InMemory() and ReadOnly() do not apply
+ */
+func NewEphemeral(opts ...Option) (*FSHeader, error) {
+    o, err := applyOptions(opts)
+    if err != nil {
+        return nil, err
+    }
+    if o.readOnly == true || o.inMemory == true {
+        return nil, retErrStr("NewEphemeral: An ephemeral database cannot be read-only or InMemory")
+    }
+
+    flags, config, err := o.build()
+    if err != nil {
+        return nil, err
+    }
+    config.Ephemeral = true
+
+    return CreateDatabaseConfig("", FLAG_DB_CREATE | flags, config)
+}
+
+/*
+ * Fails if an ephemeral database would load or keep anything on the disk
+ */
+func checkEphemeral(flags FlagVal, cfg *DBConfig) error {
+    switch {
+    case (flags & FLAG_DB_LOAD) > 0:
+        return retErrStr("An ephemeral database cannot be loaded")
+    case cfg.SpillSize > 0 || (cfg.MaxMemory > 0 && cfg.MemoryPolicy == MEMORY_SPILL):
+        return retErrStr("An ephemeral database cannot spill to the disk")
+    case cfg.Locking == true || cfg.Storage != nil || cfg.Records != nil || cfg.VolumeSize > 0:
+        return retErrStr("An ephemeral database has no storage")
+    }
+
+    return nil
+}
+
+/*
+ * Zeroes the contents of every file, and the keys. Called once the IO controller
+ *  has stopped
+ */
+func (f *FSHeader) zeroize() {
+    for _, file := range f.files() {
+        file.lock.Lock()
+        wipeBuffer(file.data, false)
+        file.data = nil
+        file.lock.Unlock()
+    }
+
+    ZeroKey(f.config.Key)
+    ZeroKey(f.config.SignatureKey)
+    f.policy_lock.Lock()
+    for _, policy := range f.config.Policies {
+        ZeroKey(policy.Key)
+    }
+    f.policy_lock.Unlock()
+    wipeBuffer(f.dictionary, false)
+}
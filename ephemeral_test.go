@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "errors"
+    "testing"
+)
+
+func TestEphemeral(t *testing.T) {
+    debugOut("[+] Running Ephemeral Database Test...")
+
+    header, err := NewEphemeral(WithEncryption([]byte("ephemeral key")))
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create ephemeral database", t)
+    }
+    header.StartIOController()
+
+    secret := []byte("secret processed in memory")
+    header.Create("/secret")
+    header.Write("/secret", secret)
+    if data, _ := header.Read("/secret"); !bytes.Equal(data, secret) {
+        drive_fail("TEST2: Data mismatch", t)
+    }
+
+    if err := header.UnmountDB(0); !errors.Is(err, ErrEphemeral) {
+        drive_fail("TEST3: Ephemeral database was committed", t)
+    }
+    if _, err := header.Commit(); !errors.Is(err, ErrEphemeral) {
+        drive_fail("TEST4: Ephemeral database was committed", t)
+    }
+
+    /* The contents and the key are zeroed on Close() */
+    data := header.check("/secret").data
+    key := header.config.Key
+    if err := header.Shutdown(true, 0); !errors.Is(err, ErrEphemeral) {
+        drive_fail("TEST5: Shutdown() committed the ephemeral database", t)
+    }
+    if !bytes.Equal(data, make([]byte, len(data))) || !bytes.Equal(key, make([]byte, len(key))) {
+        drive_fail("TEST6: Contents or key were not zeroed", t)
+    }
+    if _, err := header.Read("/secret"); err != ErrClosed {
+        drive_fail("TEST7: Read after Close() did not fail", t)
+    }
+
+    /* Nothing which would write to the disk is accepted */
+    for _, config := range []*DBConfig{
+        { SpillSize: 1 },
+        { MaxMemory: 1, MemoryPolicy: MEMORY_SPILL },
+        { Locking: true },
+        { Records: newMemRecords() },
+    } {
+        if _, err := NewEphemeral(WithConfig(config)); err == nil {
+            drive_fail("TEST8: Ephemeral database accepted a disk option", t)
+        }
+    }
+    if _, err := NewEphemeral(ReadOnly()); err == nil {
+        drive_fail("TEST9: Ephemeral database accepted ReadOnly()", t)
+    }
+    if _, err := CreateDatabaseConfig("ephemeral", FLAG_DB_LOAD, &DBConfig{ Ephemeral: true }); err == nil {
+        drive_fail("TEST10: Ephemeral database was loaded", t)
+    }
+}
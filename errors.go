@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "io/fs"
+)
+
+/*
+ * Errors which callers are expected to test for with errors.Is()
+ */
+var (
+    ErrControllerStopped      = errors.New("govfs: IO controller is not running") /* StartIOController() was not called */
+    ErrClosed         error   = closedError{} /* Close() or Shutdown() stopped the database. Is also ErrControllerStopped */
+    ErrQueueFull              = errors.New("govfs: IRP queue is full") /* See DBConfig.FailWhenQueueFull */
+    ErrTimeout                = errors.New("govfs: operation timed out") /* See DBConfig.OperationTimeout */
+    ErrQuota                  = errors.New("govfs: quota exceeded") /* A limit on the size of the database was reached */
+    ErrNoSpace        error   = quotaError{ "govfs: memory limit exceeded" } /* See DBConfig.MaxMemory. Is also ErrQuota */
+    ErrSessionQuota   error   = quotaError{ "govfs: session quota exceeded" } /* See DBConfig.SessionQuota. Is also ErrQuota */
+    ErrConflict               = errors.New("govfs: raw fs stream was committed by another process") /* See DBConfig.Locking */
+    ErrAuditTampered          = errors.New("govfs: audit log was tampered with") /* See VerifyAudit() */
+    ErrRejected               = errors.New("govfs: write was rejected") /* By a Validator, see ValidationError */
+    ErrExist                  = fs.ErrExist /* Create() of an existing name. Also matches os.IsExist() */
+    ErrNotExist               = fs.ErrNotExist /* The name does not exist. Also matches os.IsNotExist() */
+    ErrIsDirectory            = errors.New("is a directory") /* Read() or Write() of a directory */
+    ErrNotDirectory           = errors.New("not a directory") /* A directory operation on a file */
+    ErrReadOnly               = errors.New("govfs: database is read-only") /* See DBConfig.ReadOnly */
+    ErrPermission             = fs.ErrPermission /* Denied by an ACL, see SetACL(). Also matches os.IsPermission() */
+    ErrNoAttribute            = errors.New("govfs: no such attribute") /* See GetXattr() */
+    ErrChecksum               = errors.New("govfs: checksum mismatch") /* Contents do not match their checksum, see DBConfig.VerifyReads */
+    ErrStaleGeneration        = errors.New("govfs: file is at another generation") /* See CompareAndWrite() */
+    ErrAppendOnly             = errors.New("govfs: file is append-only") /* A write other than an append, or a delete, see CreateAppendOnly() */
+    ErrChainBroken            = errors.New("govfs: hash chain is broken") /* A record does not match its hash, see ReadRecords() */
+    ErrEphemeral              = errors.New("govfs: database is ephemeral") /* Committing a database created by NewEphemeral() */
+    ErrSignature              = errors.New("govfs: stream signature does not match") /* See DBConfig.Signature and SignatureKey */
+)
+
+/*
+ * A closed database has no IO controller either, so callers which only test for
+ *  ErrControllerStopped also handle ErrClosed
+ */
+type closedError struct{}
+
+func (closedError) Error() string {
+    return "govfs: database is closed"
+}
+
+func (closedError) Is(target error) bool {
+    return target == ErrControllerStopped
+}
+
+/*
+ * The specific limits that were exceeded are also ErrQuota
+ */
+type quotaError struct {
+    msg         string
+}
+
+func (e quotaError) Error() string {
+    return e.msg
+}
+
+func (quotaError) Is(target error) bool {
+    return target == ErrQuota
+}
+
+/*
+ * Errors about a name are *fs.PathError, so that errors.Is() matches the sentinel and
+ *  the message names the file, e.g. "read /a: file does not exist"
+ */
+func pathError(op string, name string, err error) error {
+    return &fs.PathError{ Op: op, Path: name, Err: err }
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "io/fs"
+    "os"
+    "testing"
+)
+
+func TestTypedErrors(t *testing.T) {
+    debugOut("[+] Running Typed Errors Test...")
+
+    header, err := CreateDatabaseConfig("typed_errors", FLAG_DB_CREATE, nil)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+    header.Create("/dir/file")
+
+    _, err = header.Read("/missing")
+    var pathErr *fs.PathError
+    if !errors.Is(err, ErrNotExist) || !errors.Is(err, fs.ErrNotExist) || !os.IsNotExist(err) ||
+        !errors.As(err, &pathErr) || pathErr.Op != "read" || pathErr.Path != "/missing" {
+        drive_fail("TEST2: Read of a missing file did not fail with ErrNotExist", t)
+    }
+    if err := header.Write("/missing", []byte("data")); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST3: Write to a missing file did not fail with ErrNotExist", t)
+    }
+    if err := header.Delete("/missing"); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST4: Delete of a missing file did not fail with ErrNotExist", t)
+    }
+    if _, err := header.GetFileSize("/missing"); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST5: GetFileSize of a missing file did not fail with ErrNotExist", t)
+    }
+    if err := header.Create("/dir/file"); !errors.Is(err, ErrExist) || !os.IsExist(err) {
+        drive_fail("TEST6: Create of an existing file did not fail with ErrExist", t)
+    }
+
+    header.Create("/folder/")
+    if _, err := header.Read("/folder/"); !errors.Is(err, ErrIsDirectory) {
+        drive_fail("TEST7: Read of a directory did not fail with ErrIsDirectory", t)
+    }
+    if err := header.Write("/folder/", []byte("data")); !errors.Is(err, ErrIsDirectory) {
+        drive_fail("TEST8: Write to a directory did not fail with ErrIsDirectory", t)
+    }
+    if _, err := fs.ReadDir(header.FS(), "dir/file"); !errors.Is(err, ErrNotDirectory) {
+        drive_fail("TEST9: ReadDir of a file did not fail with ErrNotDirectory", t)
+    }
+
+    if !errors.Is(ErrNoSpace, ErrQuota) || errors.Is(ErrQuota, ErrNoSpace) {
+        drive_fail("TEST10: ErrNoSpace is not ErrQuota", t)
+    }
+
+    debugOut("[+] Typed Errors Test PASS")
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Multi-process access to a raw fs stream. When DBConfig.Locking is set, an advisory
+ *  OS lock (flock, LockFileEx) is taken on a lock file next to the stream: a shared
+ *  lock while the stream is loaded and an exclusive lock while it is committed.
+ *
+ * The lock file also holds a commit counter. A database remembers the counter as of
+ *  its load or last commit, and UnmountDB() fails with ErrConflict if another process
+ *  committed in the meantime, instead of silently replacing that commit. Reload the
+ *  database to pick up the other process's changes.
+ *
+ * RecordStorage implementations do their own locking, Locking only applies to raw fs
+ *  streams.
+ */
+
+import (
+    "os"
+    "sync/atomic"
+    "encoding/binary"
+)
+
+const LOCK_FILE_SUFFIX        string    = ".lock"
+
+/*
+ * Returns the path of the lock file of a database, or an error if the storage backend
+ *  has no path on the host and DBConfig.LockFile is not set
+ */
+func (c *DBConfig) lockPath(name string) (string, error) {
+    if c.LockFile != "" {
+        return c.LockFile, nil
+    }
+
+    storage, stored_name := c.storage(name)
+    if storage != StorageFile {
+        return "", retErrStr("Locking requires DBConfig.LockFile for this storage backend")
+    }
+
+    return stored_name + LOCK_FILE_SUFFIX, nil
+}
+
+/*
+ * Opens and locks the lock file of a database. Blocks until the lock is granted, the
+ *  lock is released by closing the returned file.
+ */
+func (c *DBConfig) lockStream(name string, exclusive bool) (*os.File, error) {
+    path, err := c.lockPath(name)
+    if err != nil {
+        return nil, err
+    }
+
+    file, err := os.OpenFile(path, os.O_RDWR | os.O_CREATE, 0600)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := lockFile(file, exclusive); err != nil {
+        file.Close()
+        return nil, err
+    }
+
+    return file, nil
+}
+
+/*
+ * Returns the commit counter stored in a locked lock file, 0 if it was just created
+ */
+func readLockVersion(file *os.File) (uint64, error) {
+    var version [8]byte
+    n, err := file.ReadAt(version[:], 0)
+    if n == 0 {
+        return 0, nil
+    }
+    if n < len(version) {
+        return 0, err
+    }
+
+    return binary.BigEndian.Uint64(version[:]), nil
+}
+
+func writeLockVersion(file *os.File, version uint64) error {
+    var output [8]byte
+    binary.BigEndian.PutUint64(output[:], version)
+
+    if _, err := file.WriteAt(output[:], 0); err != nil {
+        return err
+    }
+
+    return file.Sync()
+}
+
+/*
+ * Commits the raw fs stream with `commit` under the exclusive lock. Fails with
+ *  ErrConflict if another process committed since this database was loaded or last
+ *  committed.
+ */
+func (f *FSHeader) lockedCommit(commit func () error) error {
+    file, err := f.config.lockStream(f.filename, true)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    version, err := readLockVersion(file)
+    if err != nil {
+        return err
+    }
+    if version != atomic.LoadUint64(&f.lock_version) {
+        return ErrConflict
+    }
+
+    if err := commit(); err != nil {
+        return err
+    }
+
+    /* The stream is replaced, a failure here would let the next commit clobber it */
+    if err := writeLockVersion(file, version + 1); err != nil {
+        return err
+    }
+    atomic.StoreUint64(&f.lock_version, version + 1)
+
+    return nil
+}
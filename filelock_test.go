@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "time"
+    "errors"
+    "testing"
+)
+
+func TestFileLock(t *testing.T) {
+    debugOut("[+] Running File Lock Test...")
+
+    raw := gen_raw_filename("filelock")
+    defer os.Remove(raw)
+    defer os.Remove(raw + LOCK_FILE_SUFFIX)
+
+    config := &DBConfig{ Locking: true }
+    first, err := CreateDatabaseConfig(raw, FLAG_DB_CREATE, config)
+    if first == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    first.StartIOController()
+    defer first.Close()
+    first.Create("/first")
+    if err := first.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit", t)
+    }
+    if _, err := os.Stat(raw + LOCK_FILE_SUFFIX); err != nil {
+        drive_fail("TEST3: Lock file was not created", t)
+    }
+
+    /* Two "processes" load the same commit, only the first to commit wins */
+    second, err := CreateDatabaseConfig(raw, FLAG_DB_LOAD, config)
+    if second == nil || err != nil {
+        drive_fail("TEST4: Failed to load database", t)
+    }
+    second.StartIOController()
+    defer second.Close()
+
+    first.Create("/again")
+    if err := first.UnmountDB(0); err != nil {
+        drive_fail("TEST5: Failed to commit", t)
+    }
+    second.Create("/second")
+    if err := second.UnmountDB(0); !errors.Is(err, ErrConflict) {
+        drive_fail("TEST6: Commit over another commit did not fail with ErrConflict", t)
+    }
+
+    reloaded, err := CreateDatabaseConfig(raw, FLAG_DB_LOAD, config)
+    if reloaded == nil || err != nil || reloaded.Check("/again") == false {
+        drive_fail("TEST7: Failed to reload the other commit", t)
+    }
+    reloaded.StartIOController()
+    if err := reloaded.UnmountDB(0); err != nil {
+        drive_fail("TEST8: Commit after reloading failed", t)
+    }
+    reloaded.Close()
+    if err := first.UnmountDB(0); !errors.Is(err, ErrConflict) {
+        drive_fail("TEST9: Stale commit did not fail with ErrConflict", t)
+    }
+
+    /* A load waits for a commit in progress */
+    lock, err := config.lockStream(raw, true)
+    if err != nil {
+        drive_fail("TEST10: Failed to lock", t)
+    }
+    loaded := make(chan error, 1)
+    go func () {
+        header, err := CreateDatabaseConfig(raw, FLAG_DB_LOAD, config)
+        if err == nil {
+            header.Close()
+        }
+        loaded <- err
+    }()
+    select {
+    case <- loaded:
+        drive_fail("TEST11: Load did not wait for the exclusive lock", t)
+    case <- time.After(100 * time.Millisecond):
+    }
+    lock.Close()
+    if err := <- loaded; err != nil {
+        drive_fail("TEST12: Load failed after the lock was released", t)
+    }
+
+    if _, err := CreateDatabaseConfig(ADS_PREFIX + "carrier:stream", FLAG_DB_CREATE, config); err == nil {
+        drive_fail("TEST13: Locking without a lock file path was accepted", t)
+    }
+
+    debugOut("[+] File Lock Test PASS")
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Consistency checks. Verify() reads every file of a database, checking that it can be
+ *  decrypted, decompressed and matches its checksum, that the raw fs stream is complete
+ *  and that the audit log is intact. Repair() loads what is intact, leaving the damaged
+ *  files out, so that committing the result salvages the database.
+ */
+
+type FsckProblem struct {
+    Path        string /* "" if the problem is not of a single file */
+    Err         error
+}
+
+type FsckReport struct {
+    Files       uint /* Files and directories checked, including damaged ones */
+    Bytes       int /* Of the intact files */
+    Problems    []FsckProblem
+}
+
+func (r *FsckReport) OK() bool {
+    return len(r.Problems) == 0
+}
+
+func (r *FsckReport) add(path string, err error) {
+    r.Problems = append(r.Problems, FsckProblem{ Path: path, Err: err })
+}
+
+/*
+ * Checks the database `name`, which must exist. The error is only set if the database
+ *  could not be read at all, e.g. for a wrong key
+ */
+func Verify(name string, flags FlagVal, config *DBConfig) (*FsckReport, error) {
+    header, report, err := Repair(name, flags, config)
+    if header != nil {
+        header.Close()
+    }
+
+    return report, err
+}
+
+/*
+ * Loads the intact files of the database `name`. Nothing is written until the returned
+ *  header is committed with UnmountDB(), which replaces the damaged database
+ */
+func Repair(name string, flags FlagVal, config *DBConfig) (*FSHeader, *FsckReport, error) {
+    report := &FsckReport{}
+    header, err := openDatabase(name, (flags | FLAG_DB_LOAD) &^ FLAG_DB_CREATE, config, report)
+    if err != nil {
+        return nil, report, err
+    }
+
+    return header, report, nil
+}
+
+/*
+ * Reads every record of a RecordStorage, the data of a raw fs stream was already checked
+ *  by loadHeader(), and checks the audit log
+ */
+func (f *FSHeader) verifyLoaded(report *FsckReport) {
+    if f.config.Records != nil {
+        for _, file := range f.files() {
+            if file.filename == "/" {
+                continue
+            }
+            report.Files += 1
+
+            file.lock.Lock()
+            var err error
+            if file.record() != nil {
+                err = f.loadRecord(file)
+            }
+            size, dir, owner := file.size, (file.flags & FLAG_DIRECTORY) > 0, fileOwner(file)
+            file.lock.Unlock()
+
+            if err == nil {
+                report.Bytes += size
+                continue
+            }
+
+            report.add(file.filename, err)
+            f.meta.remove(file.filename)
+            f.usage.remove(file.filename, dir, size)
+            f.usage.own(owner, -size)
+            f.markDirty(file.filename, nil)
+        }
+    }
+
+    if err := f.VerifyAudit(); err != nil {
+        report.add("", err)
+    }
+}
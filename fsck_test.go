@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "os"
+    "testing"
+)
+
+func TestVerifyRepair(t *testing.T) {
+    debugOut("[+] Running Verify/Repair Test...")
+
+    var filename = gen_raw_filename("test_fsck")
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/good")
+    header.Write("/good", []byte("intact data"))
+    header.Create("/bad")
+    header.Write("/bad", bytes.Repeat([]byte("A"), 64))
+    if err := header.Shutdown(true, 0); err != nil {
+        drive_fail("TEST2: Failed to commit", t)
+    }
+
+    if report, err := Verify(filename, 0, nil); err != nil || !report.OK() || report.Files != 2 ||
+        report.Bytes != 75 {
+        drive_fail("TEST3: Intact database failed verification", t)
+    }
+
+    /* Damage the data of /bad */
+    raw, _ := os.ReadFile(filename)
+    i := bytes.Index(raw, bytes.Repeat([]byte("A"), 64))
+    raw[i + 10] = 'B'
+    os.WriteFile(filename, raw, 0600)
+
+    if _, err := CreateDatabase(filename, FLAG_DB_LOAD); err == nil {
+        drive_fail("TEST4: Damaged database was loaded", t)
+    }
+    report, err := Verify(filename, 0, nil)
+    if err != nil || report.OK() || len(report.Problems) != 1 || report.Problems[0].Path != "/bad" || report.Files != 2 {
+        drive_fail("TEST5: Damaged file was not reported", t)
+    }
+
+    header, report, err = Repair(filename, 0, nil)
+    if header == nil || err != nil || len(report.Problems) != 1 {
+        drive_fail("TEST6: Repair failed", t)
+    }
+    if header.Check("/bad") == true || header.Check("/good") == false || header.GetTotalFilesizes() != 11 {
+        drive_fail("TEST7: Repaired database has unexpected files", t)
+    }
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST8: Failed to commit the repaired database", t)
+    }
+    header.Close()
+
+    if report, err := Verify(filename, 0, nil); err != nil || !report.OK() || report.Files != 1 {
+        drive_fail("TEST9: Repaired database failed verification", t)
+    }
+
+    /* A truncated stream keeps the files before the damage */
+    raw, _ = os.ReadFile(filename)
+    os.WriteFile(filename, raw[:len(raw) - 4], 0600)
+    if report, err := Verify(filename, 0, nil); err != nil || report.OK() {
+        drive_fail("TEST10: Truncated stream was not reported", t)
+    }
+
+    if _, err := Verify(filename + ".missing", 0, nil); err == nil {
+        drive_fail("TEST11: Verified a missing database", t)
+    }
+
+    debugOut("[+] Verify/Repair Test PASS")
+}
+
+func TestVerifyRecords(t *testing.T) {
+    records := newMemRecords()
+    config := &DBConfig{ Records: records, Audit: true }
+    header, err := CreateDatabaseConfig("fsck", FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+    header.Create("/a")
+    header.Write("/a", []byte("aaaa"))
+    header.Create("/b")
+    header.Write("/b", []byte("bbbb"))
+    header.Shutdown(true, 0)
+
+    records.data["/a"][0] ^= 0xff
+    header, report, err := Repair("fsck", 0, config)
+    if err != nil || len(report.Problems) != 1 || report.Problems[0].Path != "/a" || header.Check("/a") == true {
+        t.Fatal("TEST2: Damaged record was not reported")
+    }
+    header.UnmountDB(0)
+    header.Close()
+    if _, ok := records.headers["/a"]; ok == true {
+        t.Fatal("TEST3: Damaged record was not removed")
+    }
+    if report, err := Verify("fsck", 0, config); err != nil || !report.OK() || report.Bytes != 4 {
+        t.Fatal("TEST4: Repaired database failed verification")
+    }
+}
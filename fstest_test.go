@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "io/fs"
+    "testing/fstest"
+)
+
+/*
+ * Runs testing/fstest.TestFS against a freshly created database, the same database
+ *  after it is loaded from disk, after Commit(), and against a Sub() view
+ */
+func TestFSConformance(t *testing.T) {
+    debugOut("[+] Running fstest Conformance Test...")
+
+    var filename = gen_raw_filename("test_fstest")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    files := map[string]string{
+        "/a/b/c.txt": "c",
+        "/a/b/d.txt": "dddd",
+        "/a/e.bin": string([]byte{ 0, 1, 2, 3 }),
+        "/f": "",
+        "/g/h/i/j": "deep",
+    }
+    explicit := []string{ "/empty/" } /* Explicitly created directory */
+    for name, data := range files {
+        if err := header.Create(name); err != nil {
+            drive_fail("TEST2: Failed to create " + name, t)
+        }
+        header.Write(name, []byte(data))
+    }
+    for _, name := range explicit {
+        header.Create(name)
+    }
+
+    expected := []string{ "a/b/c.txt", "a/b/d.txt", "a/e.bin", "f", "g/h/i/j", "empty" }
+    if err := fstest.TestFS(header.FS(), expected...); err != nil {
+        drive_fail("TEST3: Created database failed fstest: " + err.Error(), t)
+    }
+    if sub, err := header.FS().(fs.SubFS).Sub("a"); err == nil {
+        if err := fstest.TestFS(sub, "b/c.txt", "b/d.txt", "e.bin"); err != nil {
+            drive_fail("TEST4: Sub() view failed fstest: " + err.Error(), t)
+        }
+    } else {
+        drive_fail("TEST4.1: Sub() failed", t)
+    }
+
+    committed, err := header.Commit()
+    if committed == nil || err != nil {
+        drive_fail("TEST5: Failed to commit database", t)
+    }
+    if err := fstest.TestFS(committed.FS(), expected...); err != nil {
+        drive_fail("TEST6: Committed database failed fstest: " + err.Error(), t)
+    }
+    committed.Close()
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST7: Failed to load database", t)
+    }
+    if err := fstest.TestFS(loaded.FS(), expected...); err != nil {
+        drive_fail("TEST8: Loaded database failed fstest: " + err.Error(), t)
+    }
+
+    debugOut("[+] fstest Conformance Test PASS")
+}
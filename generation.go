@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Generation numbers. Every file has a generation which is bumped by each write that
+ *  changes its contents, and is kept across commits, so that it identifies one version
+ *  of the contents, e.g. as an HTTP ETag. A file which was never written is at
+ *  generation 0. CompareAndWrite() only replaces the contents if they are still at the
+ *  generation the caller read, for optimistic concurrency.
+ */
+
+import (
+    "context"
+)
+
+func (file *govfsFile) generation() uint64 {
+    if file.contents == nil {
+        return 0
+    }
+    return file.contents.generation
+}
+
+/*
+ * Requires the contents to be set, a file without contents is at generation 0
+ */
+func (file *govfsFile) setGeneration(generation uint64) {
+    if file.contents != nil {
+        file.contents.generation = generation
+    }
+}
+
+/*
+ * Write() which returns the generation of the contents it wrote
+ */
+func (f *FSHeader) WriteGeneration(name string, d []byte) (uint64, error) {
+    return f.writeGeneration(context.Background(), name, d, 0, false)
+}
+
+/*
+ * Replaces the contents of a file only if it is still at `generation`, as returned by
+ *  Stat() or a previous write, and fails with ErrStaleGeneration otherwise. Returns the
+ *  new generation
+ */
+func (f *FSHeader) CompareAndWrite(name string, d []byte, generation uint64) (uint64, error) {
+    return f.writeGeneration(context.Background(), name, d, generation, true)
+}
+
+func (f *FSHeader) writeGeneration(ctx context.Context, name string, d []byte, generation uint64,
+    compare bool) (uint64, error) {
+    if f.wb != nil {
+        /* Buffered writes come first, they may change the generation */
+        f.wb.flush_lock.Lock()
+        defer f.wb.flush_lock.Unlock()
+        if err := f.flushPathLocked(name); err != nil {
+            return 0, err
+        }
+    }
+
+    irp, err := f.writeIRP(name, d, false)
+    if err != nil {
+        return 0, err
+    }
+    if compare == true {
+        irp.flags |= FLAG_IF_GENERATION
+        irp.generation = generation
+    }
+
+    output_irp, err := f.submitCtx(ctx, irp)
+    if err != nil {
+        return 0, err
+    }
+
+    return output_irp.generation, output_irp.status
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "time"
+    "errors"
+    "testing"
+)
+
+func TestGeneration(t *testing.T) {
+    debugOut("[+] Running File Generation Test...")
+
+    var filename = gen_raw_filename("test_generation")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    generation := func (h *FSHeader) uint64 {
+        e, err := h.Stat("/file")
+        if err != nil {
+            drive_fail("TEST2: Stat() failed", t)
+        }
+        return e.Generation
+    }
+
+    header.Create("/file")
+    if generation(header) != 0 {
+        drive_fail("TEST3: New file is not at generation 0", t)
+    }
+    if gen, err := header.WriteGeneration("/file", []byte("one")); gen != 1 || err != nil {
+        drive_fail("TEST4: WriteGeneration() did not return generation 1", t)
+    }
+    header.Write("/file", []byte("two"))
+    header.Append("/file", []byte("three"))
+    if generation(header) != 3 {
+        drive_fail("TEST5: Writes did not bump the generation", t)
+    }
+
+    /* Only the current generation may be replaced */
+    if gen, err := header.CompareAndWrite("/file", []byte("four"), 3); gen != 4 || err != nil {
+        drive_fail("TEST6: CompareAndWrite() failed at the current generation", t)
+    }
+    if _, err := header.CompareAndWrite("/file", []byte("stale"), 3); !errors.Is(err, ErrStaleGeneration) {
+        drive_fail("TEST7: CompareAndWrite() succeeded at a stale generation", t)
+    }
+    if data, _ := header.Read("/file"); string(data) != "four" {
+        drive_fail("TEST8: Stale write changed the contents", t)
+    }
+
+    if _, err := header.Stat("/missing"); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST9: Stat() of a missing file did not fail", t)
+    }
+
+    /* Generations are kept across commits */
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST10: Failed to commit database", t)
+    }
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST11: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    if generation(loaded) != 4 {
+        drive_fail("TEST12: Generation was not kept across a commit", t)
+    }
+    if gen, err := loaded.WriteGeneration("/file", []byte("five")); gen != 5 || err != nil {
+        drive_fail("TEST13: Generation did not continue after load", t)
+    }
+}
+
+func TestGenerationWriteBack(t *testing.T) {
+    debugOut("[+] Running Write-Back Generation Test...")
+
+    header, err := CreateDatabaseConfig("generation_wb", FLAG_DB_CREATE, &DBConfig{ WriteBackSize: 1024 })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/file")
+    gen, _ := header.WriteGeneration("/file", []byte("base"))
+
+    /* A buffered write is applied before the comparison */
+    header.Write("/file", []byte("buffered"))
+    if _, err := header.CompareAndWrite("/file", []byte("stale"), gen); !errors.Is(err, ErrStaleGeneration) {
+        drive_fail("TEST2: CompareAndWrite() ignored a buffered write", t)
+    }
+    if data, _ := header.Read("/file"); string(data) != "buffered" {
+        drive_fail("TEST3: Unexpected contents", t)
+    }
+}
+
+func TestGenerationTimeout(t *testing.T) {
+    debugOut("[+] Running Operation Timeout Generation Test...")
+
+    header, err := CreateDatabaseConfig("generation_timeout", FLAG_DB_CREATE, &DBConfig{ OperationTimeout: time.Second })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/file")
+    header.Write("/file", []byte("one"))
+    if gen, err := header.WriteGeneration("/file", []byte("two")); gen != 2 || err != nil {
+        drive_fail("TEST2: WriteGeneration() did not return generation 2", t)
+    }
+    if gen, err := header.CompareAndWrite("/file", []byte("three"), 2); gen != 3 || err != nil {
+        drive_fail("TEST3: CompareAndWrite() did not return generation 3", t)
+    }
+    if e, _ := header.Stat("/file"); e.Generation != 3 {
+        drive_fail("TEST4: Stat() disagrees with the returned generation", t)
+    }
+}
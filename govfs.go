@@ -26,7 +26,6 @@ package govfs
 // create() can either create a folder or a file.
 // When a folder/file is created, make all subdirectories in the map as well
 // https://golang.org/src/encoding/gob/example_test.go
-// Fix all FLAG_COMPRESS operations -- causes a panic in CreateDatabase()
 
 /* TEST5
  * Supports:
@@ -38,37 +37,52 @@ package govfs
 
 import (
     "os"
+    "context"
     "bytes"
     "sync"
+    "sync/atomic"
+    "time"
+    "runtime"
     "strings"
+    "strconv"
     "io"
-    "io/ioutil"
     "crypto/md5"
+    "crypto/cipher"
     "encoding/hex"
     "encoding/gob"
-
-    "github.com/AlexRuzin/util"
-    "github.com/AlexRuzin/cryptog"
 )
 
 /*
  * Configurable constants
  */
 const MAX_FILENAME_LENGTH     int       = 256
-const FS_SIGNATURE            string    = "govfs_header"    /* Cannot exceed 64 */
-const STREAM_PAD_LEN          int       = 0                 /* Length of the pad between two serialized RawFile structs */
+const FS_SIGNATURE            string    = "govfs_header"    /* Default DBConfig.Signature, cannot exceed SIGNATURE_MAX_LENGTH */
+const STREAM_PAD_LEN          int       = 0                 /* Default DBConfig.RecordPad, see padding.go */
 const REMOVE_FS_HEADER        bool      = false             /* Removes the header at the beginning of the serialized file - leave false */
 
+/*
+ * The serialized fs table is prefixed with a two byte envelope, inside of the encryption,
+ *  which describes how the rest of the stream is encoded. Legacy streams have no envelope:
+ *  they begin with either gob data or the codec magic, neither of which can start with
+ *  STREAM_ENVELOPE_MAGIC (gob never encodes an 11 byte message length).
+ */
+const STREAM_ENVELOPE_MAGIC   byte      = 0xf5
+const (
+    STREAM_ENVELOPE_COMPRESSED byte     = 1 << iota /* The table is compressed, see detectCodec() */
+    STREAM_ENVELOPE_PADDED /* The table is followed by padding, see padding.go */
+)
+
 type FlagVal int
 const IRP_BASE                FlagVal = 2 /*
                                            * Start the IRP controller ID count from n > 1.
                                            *  Altering this may break logic in the I/O controller
                                            */
 const (
-    IRP_PURGE                 FlagVal = IRP_BASE + iota /* Flush the entire database and all files */
+    IRP_PURGE                 FlagVal = IRP_BASE + iota /* Remove all files except the root, see Purge() */
     IRP_DELETE                /* Delete a file/folder */
     IRP_WRITE                 /* Write data to a file */
     IRP_CREATE                /* Create a new file or folder */
+    IRP_XATTR                 /* Set an extended attribute of a file, see xattr.go */
 )
 
 const (
@@ -82,27 +96,227 @@ const (
                                *  if a file should be compressed due to the chance of high entropy. If compression
                                *  takes places, then this flag is set on comp_file.Flags
                                */
+    FLAG_SHRED                /* IRP_DELETE flag -- overwrite the file data with random bytes before zeroing */
+    FLAG_APPEND               /* IRP_WRITE flag -- append to the existing data instead of replacing it */
+    FLAG_REMOVE_XATTR         /* IRP_XATTR flag -- remove the attribute instead of setting it */
+    FLAG_IF_GENERATION        /* IRP_WRITE flag -- fail unless the file is at the generation of the IRP, see generation.go */
+    FLAG_APPEND_ONLY          /* The file may only be appended to, see appendonly.go */
+    FLAG_HASH_CHAIN           /* Each append to the file is a record of a hash chain, see appendonly.go */
 )
 
+const FLAG_COMPRESS_FILES     FlagVal = FLAG_COMPRESS /* UnmountDB() flag -- compress the data of each file */
+
+const IRP_QUEUE_DEPTH         int     = 64 /* Default capacity of io_in, see DBConfig.QueueDepth */
+
 type FSHeader struct {
     filename    string
     key         [16]byte
-    meta        map[string]*govfsFile
-    t_size      int /* Total size of all files */
-    io_in       chan *govfsIoBlock
-    create_sync sync.Mutex
+    meta        *metaTable /* The IO controller is the only writer */
+    size_lock   sync.Mutex /* Guards mem_size */
+    usage       accounting /* Total size and number of files, see accounting.go */
+    io_in       chan *govfsIoBlock /* PRIORITY_NORMAL IRPs */
+    io_high     chan *govfsIoBlock /* PRIORITY_HIGH IRPs */
+    io_bg       chan *govfsIoBlock /* PRIORITY_BACKGROUND IRPs */
+    path_locks  pathLocks /* Serializes Create() of the same name, see lockPath() */
     flags       FlagVal /* Generic flags as passed in by CreateDatabase() */
-    stale       bool
+    config      DBConfig
+    ctl_lock    sync.RWMutex /* Guards io_in and closed, see submit() */
+    ctl_done    chan struct{} /* Closed by the IO controller once it has drained io_in */
+    abandoned   chan struct{} /* Closed once an IRP abandoned by dispatchTimeout() finishes. Only used by the IO controller */
+    direct_lock sync.Mutex /* Serializes dispatch() in DBConfig.Direct mode */
+    wb          *writeBack /* Set if DBConfig.WriteBackSize is set */
+    ops         pendingOps /* See PendingOps() */
+    closed      bool /* Set by Close()/Shutdown(), all further calls return ErrClosed */
+    wipe_stale  int32 /* Set atomically if shredded or purged data exists in the raw fs file, overwrite it on the next commit */
+    mem_cipher  cipher.AEAD /* Ephemeral in-memory cipher, only set if DBConfig.EncryptMemory */
+    policy_lock sync.RWMutex /* Guards config.Policies */
+    dictionary  []byte /* zstd dictionary for FLAG_COMPRESS_FILES, see TrainDictionary() */
+    dict_codec  Codec
+    comp_stats  CompressionStats /* As of the last commit or load */
+    stats_lock  sync.Mutex
+    dirty       dirtySet /* Changes since the last commit, only tracked for DBConfig.Records */
+    spill_block cipher.Block /* Ephemeral spill file cipher, only set if DBConfig.SpillSize. See spill.go */
+    lru         *lruCache /* Set if DBConfig.MemoryBudget is set, see lru.go */
+    mem_size    int /* Guarded by size_lock, see MemoryUsage() */
+    op_stats    statsTable /* See Stats() */
+    lock_version uint64 /* Accessed atomically, the commit counter as of the load or last commit. See filelock.go */
+    repl        replLog /* See Replicate() */
+    audit       auditLog /* Only used if DBConfig.Audit is set, see audit.go */
+    watch       watchList /* See Watch() */
+    hooks       hookList /* See AddHook() */
+    validators  validatorList /* See AddValidator() */
+    scrub       *scrubber /* Set if DBConfig.ScrubInterval is set */
+    prefetches  sync.WaitGroup /* Background fetches, see prefetch.go */
+    throttle    *throttle /* Set if DBConfig.RateLimit or SessionRateLimit is set, see ratelimit.go */
+    volumes     volumeTable /* See OpenVolume() */
+    labels      labelTable /* See SetLabel() */
 }
 
+/*
+ * Optional database parameters that cannot be expressed as a FlagVal. A nil
+ *  *DBConfig passed to CreateDatabaseConfig() is equivalent to a zero DBConfig.
+ */
+type DBConfig struct {
+    Cipher      Cipher /* Used when FLAG_ENCRYPT is set, defaults to CipherRC4 */
+    Key         []byte /* Used when FLAG_ENCRYPT is set, defaults to getFsKey(). See KeyFromFile() */
+    KeyProvider KeyProvider /* Supplies the key if Key is nil, e.g. KeyringProvider */
+    EncryptMemory bool /* Keep file contents encrypted in memory with an ephemeral key, see memcrypt.go */
+    Policies    map[string]*EncryptionPolicy /* Per-subtree encryption policies, keyed by directory. See policy.go */
+    Codec       Codec /* Used for FLAG_COMPRESS and FLAG_COMPRESS_FILES, defaults to CodecGzip */
+    Checksum    Checksum /* Digest of the contents of each file, defaults to ChecksumSHA256. See checksum.go */
+    CompressMinSize int /* FLAG_COMPRESS_FILES skips smaller files, defaults to COMPRESS_MIN_SIZE, -1 disables */
+    CompressMaxEntropy float64 /* FLAG_COMPRESS_FILES skips files whose sampled entropy (bits/byte) is higher, defaults to COMPRESS_MAX_ENTROPY */
+    QueueDepth  int /* Number of IRPs which may be queued for the IO controller, defaults to IRP_QUEUE_DEPTH, -1 is unbuffered */
+    FailWhenQueueFull bool /* Return ErrQueueFull instead of blocking when the IRP queue is full */
+    Direct      bool /* Execute operations inline under a mutex instead of through the IO controller, see direct.go */
+    OperationTimeout time.Duration /* Fail IRPs with ErrTimeout once queued for longer, 0 disables. See timeout.go */
+    WriteBackSize int /* Coalesce smaller writes per file until this many bytes are pending, 0 disables. See writeback.go */
+    WriteBackDelay time.Duration /* Flush coalesced writes at the latest after this, defaults to WRITEBACK_DEFAULT_DELAY */
+    Storage     StorageBackend /* Keeps the raw fs stream, defaults to the backend selected by the name. See storage.go */
+    Records     RecordStorage /* Keeps each file as a record instead of a raw fs stream, e.g. bolt.Open(). See records.go */
+    SpillSize   int /* Keep files of at least this many bytes in temporary files on the disk, 0 disables. See spill.go */
+    SpillDir    string /* Directory for the spill files, defaults to os.TempDir() */
+    MemoryBudget int /* Evict the data of the least recently used clean files above this many bytes, 0 disables. Requires Records. See lru.go */
+    MaxMemory   int /* Limit on the file data held in memory, 0 disables. See memlimit.go */
+    MemoryPolicy MemoryPolicy /* What a write exceeding MaxMemory does, defaults to MEMORY_FAIL */
+    Locking     bool /* Lock the raw fs stream against other processes, commits fail with ErrConflict. See filelock.go */
+    LockFile    string /* Defaults to the raw fs file name + LOCK_FILE_SUFFIX, required for other storage backends */
+    Tracer      Tracer /* Wraps operations in spans, e.g. otel.NewTracer(). See trace.go */
+    Logger      Logger /* Receives structured events, e.g. SlogLogger(). See log.go */
+    Audit       bool /* Keep a tamper-evident log of every mutation with the database, see audit.go */
+    Hooks       []Hook /* Run before and after every operation, see hooks.go */
+    Validators  []Validator /* Check the contents of every write to any file, see validate.go */
+    ReadOnly    bool /* Fail every change and commit with ErrReadOnly, see ReadOnly() */
+    VerifyReads bool /* Compare the contents to their checksum on every read, failing with ErrChecksum. See verifyData() */
+    ScrubInterval time.Duration /* Verify one file per interval in the background, 0 disables. See scrub.go */
+    PadSize     int /* Pad the raw fs stream to a multiple of this many bytes, 0 disables. See padding.go */
+    RecordPad   int /* Random bytes between two records of the raw fs stream at least, defaults to STREAM_PAD_LEN, -1 disables */
+    RecordAlign int /* Begin every record of the raw fs stream at a multiple of this many bytes, 0 disables */
+    ShuffleRecords bool /* Write the files of the raw fs stream in a random order */
+    Signature   string /* Recorded in and required of the raw fs stream, defaults to FS_SIGNATURE. See signature.go */
+    SignatureKey []byte /* Masks the raw fs stream so that it cannot be identified without this key */
+    VolumeSize  int /* Fixed size of the raw fs file, which may hold a hidden volume. Requires SignatureKey, see hidden.go */
+    Hidden      bool /* Create the hidden volume of a VolumeSize file instead of the outer one */
+    Ephemeral   bool /* Never write to the disk, commits fail with ErrEphemeral. See NewEphemeral() */
+    Progress    ProgressFunc /* Called with the progress of commits and loads, see progress.go */
+    EncryptScope Scope /* What FLAG_ENCRYPT applies to, defaults to SCOPE_ALL. See scope.go */
+    CompressScope Scope /* What FLAG_COMPRESS applies to, defaults to SCOPE_ALL */
+    RateLimit   int /* Bytes per second written by all operations, 0 disables. See ratelimit.go */
+    SessionRateLimit int /* Bytes per second written by the operations of each principal, 0 disables */
+    SessionQuota int /* Bytes of file data each principal may own, 0 disables. See session.go */
+}
+
+/*
+ * Kept for every name, so it is laid out to be small: empty files, most of the entries
+ *  of a large database, have no fileContents, and the modification time is not a
+ *  time.Time
+ */
 type govfsFile struct {
     filename    string
     flags       FlagVal /* FLAG_FILE, FLAG_DIRECTORY */
-    datasum     string
-    data        []byte
+    contents    *fileContents /* nil if there are no contents */
+    data        []byte /* Sealed with FSHeader.mem_cipher if DBConfig.EncryptMemory is set */
+    size        int /* Length of the plaintext data */
+    modtime     int64 /* Unix nanoseconds, set on create and on every write. See modTime() */
+    spill       *spillFile /* Set if the data is kept on the disk instead of in data, see spill.go */
+    xattrs      map[string]string /* Extended attributes, see xattr.go */
     lock        sync.Mutex
 }
 
+type fileContents struct {
+    datasum     string
+    checksum    Checksum /* Algorithm of datasum */
+    stored      *RawFile /* The record of the last commit or load, the data can be evicted while it matches. See lru.go */
+    unloaded    bool /* The data has not been read from DBConfig.Records since it was stored, see loadRecord() */
+    generation  uint64 /* Bumped on every write, see generation.go */
+}
+
+func (file *govfsFile) dataSum() string {
+    if file.contents == nil {
+        return ""
+    }
+    return file.contents.datasum
+}
+
+/*
+ * The algorithm of dataSum(), nil if there are no contents
+ */
+func (file *govfsFile) sumAlgorithm() Checksum {
+    if file.contents == nil {
+        return nil
+    }
+    return file.contents.checksum
+}
+
+/*
+ * Empties the contents if both are unset. Keeps the stored record, which is compared to
+ *  the new checksum, see evictable()
+ */
+func (file *govfsFile) setSum(datasum string, checksum Checksum) {
+    if datasum == "" && checksum == nil {
+        file.contents = nil
+        return
+    }
+    if file.contents == nil {
+        file.contents = &fileContents{}
+    }
+    file.contents.datasum, file.contents.checksum = datasum, checksum
+}
+
+func (file *govfsFile) stored() *RawFile {
+    if file.contents == nil {
+        return nil
+    }
+    return file.contents.stored
+}
+
+/*
+ * Requires the contents to be set, there is no record of empty contents
+ */
+func (file *govfsFile) setStored(raw *RawFile) {
+    file.contents.stored = raw
+}
+
+/*
+ * The record to read the data from, nil if it is resident (or spilled)
+ */
+func (file *govfsFile) record() *RawFile {
+    if file.contents == nil || file.contents.unloaded == false {
+        return nil
+    }
+    return file.contents.stored
+}
+
+/*
+ * Drops the data in favour of the stored record. Requires the contents to be set
+ */
+func (file *govfsFile) unload() {
+    file.contents.unloaded = true
+}
+
+func (file *govfsFile) setLoaded() {
+    if file.contents != nil {
+        file.contents.unloaded = false
+    }
+}
+
+func (file *govfsFile) modTime() time.Time {
+    if file.modtime == 0 {
+        return time.Time{}
+    }
+    return time.Unix(0, file.modtime)
+}
+
+/*
+ * The modtime of `t`, 0 for the zero time
+ */
+func unixNano(t time.Time) int64 {
+    if t.IsZero() {
+        return 0
+    }
+    return t.UnixNano()
+}
+
 type govfsIoBlock struct {
     file        *govfsFile
     name        string
@@ -111,6 +325,11 @@ type govfsIoBlock struct {
     operation   FlagVal /* 2 == purge, 3 == delete, 4 == write */
     flags       FlagVal
     io_out      chan *govfsIoBlock
+    queued      time.Time /* Set by enqueue() */
+    priority    Priority
+    principal   string /* See WithPrincipal() */
+    attr        string /* Name of the attribute of IRP_XATTR, data is its value */
+    generation  uint64 /* IRP_WRITE: required with FLAG_IF_GENERATION, then the generation written */
 }
 
 /*
@@ -120,6 +339,11 @@ type govfsIoBlock struct {
 type rawStreamHeader struct {
     Signature string /* Uppercase so that it's "exported" i.e. visibile to the encoder */
     FileCount uint
+    Codec string /* Name of the codec used for FLAG_COMPRESS_FILES, "" is gzip */
+    Dictionary []byte /* zstd dictionary used for FLAG_COMPRESS_FILES, if any */
+    Audit []AuditEntry /* See DBConfig.Audit */
+    Volumes map[string][]byte /* Raw fs streams of the named volumes, see OpenVolume() */
+    Labels map[string]string /* See SetLabel() */
 }
 
 /*
@@ -131,146 +355,492 @@ type RawFile /* Export required for gob serializer */ struct {
     Flags FlagVal
     Name string
     UnzippedLen int
+    StoredLen int /* Length of the data following the header, if 0 then UnzippedLen */
+    Policy string /* Directory whose EncryptionPolicy encrypted the data, if FLAG_ENCRYPT */
+    Compression string /* Outcome of FLAG_COMPRESS_FILES for this file, see heuristics.go */
+    ModTime time.Time /* Zero in streams written before modification times were recorded */
+    Codec string /* Codec of FLAG_COMPRESS data in a RecordStorage, the stream header names it otherwise */
+    Checksum string /* Algorithm of RawSum, "" in streams written before it was recorded (ChecksumMD5) */
+    Xattrs map[string]string /* Extended attributes, see xattr.go */
+    Generation uint64 /* See generation.go */
 }
 
 /*
  * Creates or loads a filesystem database file. If the filename is nil, then create a new database
  *  otherwise try to load an existing fs database file.
  *
- * Flags: FLAG_ENCRYPT, FLAG_COMPRESS
+ * Flags: FLAG_ENCRYPT, FLAG_COMPRESS. See New() and Open() for the option-based form
  */
 func CreateDatabase(name string, flags FlagVal) (*FSHeader, error) {
+    return CreateDatabaseConfig(name, flags, nil)
+}
+
+/*
+ * Same as CreateDatabase(), but takes in the optional DBConfig parameters
+ */
+func CreateDatabaseConfig(name string, flags FlagVal, config *DBConfig) (*FSHeader, error) {
+    return openDatabase(name, flags, config, nil)
+}
+
+/*
+ * With a `report`, damaged files are recorded in it and left out of the header instead
+ *  of failing the load, see Repair()
+ */
+func openDatabase(name string, flags FlagVal, config *DBConfig, report *FsckReport) (*FSHeader, error) {
     var header *FSHeader
 
+    var cfg DBConfig
+    if config != nil {
+        cfg = *config
+    }
+    if cfg.Cipher == nil {
+        cfg.Cipher = CipherRC4
+    }
+    if cfg.Codec == nil {
+        cfg.Codec = CodecGzip
+    }
+    if cfg.Checksum == nil {
+        cfg.Checksum = ChecksumSHA256
+    }
+    if len(cfg.Signature) > SIGNATURE_MAX_LENGTH {
+        return nil, retErrStr("Signature cannot exceed " + strconv.Itoa(SIGNATURE_MAX_LENGTH) + " bytes")
+    }
+    cfg.SignatureKey = append([]byte(nil), cfg.SignatureKey...)
+    if cfg.Ephemeral == true {
+        if err := checkEphemeral(flags, &cfg); err != nil {
+            return nil, err
+        }
+    }
+    if cfg.VolumeSize > 0 && (len(cfg.SignatureKey) == 0 || cfg.Records != nil) {
+        return nil, retErrStr("VolumeSize requires a SignatureKey and a raw fs stream")
+    }
+    cfg.Policies = copyPolicies(cfg.Policies)
+    cfg.Hooks = append([]Hook(nil), cfg.Hooks...)
+    if cfg.Key != nil {
+        /* Keep a private copy of the key, the caller is free to zero theirs */
+        cfg.Key = append([]byte(nil), cfg.Key...)
+    } else if cfg.KeyProvider != nil {
+        key, err := cfg.KeyProvider.Key()
+        if err != nil {
+            return nil, err
+        }
+        cfg.Key = key
+    }
+    config = &cfg
+
+    var evicts = cfg.MemoryBudget > 0 || (cfg.MaxMemory > 0 && cfg.MemoryPolicy == MEMORY_EVICT)
+    if evicts == true && cfg.Records == nil {
+        ZeroKey(cfg.Key)
+        return nil, retErrStr("MemoryBudget and MEMORY_EVICT require a RecordStorage")
+    }
+
+    var lock_version uint64 = 0
+    if config.Locking == true && config.Records == nil {
+        /* Shared with other loads, excludes commits */
+        lock, err := config.lockStream(name, false)
+        if err != nil {
+            ZeroKey(cfg.Key)
+            return nil, err
+        }
+        defer lock.Close()
+
+        if lock_version, err = readLockVersion(lock); err != nil {
+            ZeroKey(cfg.Key)
+            return nil, err
+        }
+    }
+
     if (flags & FLAG_DB_LOAD) > 0 {
-        /* Check if the file exists */
-        if _, err := os.Stat(name); !os.IsNotExist(err) {
-            raw, err := readFsStream(name, flags)
-            if raw == nil || err != nil {
-                return nil, err
-            }
-            header, err = loadHeader(raw, name)
-            if header == nil || err != nil {
-                return nil, err
-            }
+        var err error
+        start := time.Now()
+        if config.Records != nil {
+            header, err = loadRecords(name, flags, config)
+        } else {
+            header, err = loadStream(name, flags, config, report)
+        }
+
+        var size = 0
+        if header != nil {
+            size = header.GetTotalFilesizes()
+        }
+        config.logEvent(LOG_LOAD, name, size, start, err)
+        if err != nil {
+            return nil, err
         }
     }
 
-    if (flags & FLAG_DB_CREATE) > 0 {
+    if header == nil && (flags & FLAG_DB_CREATE) > 0 {
         /* Either the raw fs does not exist, or it is invalid -- create new */
         header = &FSHeader{
             filename: name,
-            meta:     make(map[string]*govfsFile),
-            stale:    false,
+            meta:     newMetaTable(),
         }
 
         /* Generate the standard "/" file */
-        header.meta[s("/")] = new(govfsFile)
-        header.meta[s("/")].filename = "/"
-        header.t_size = 0
+        header.meta.set("/", &govfsFile{ filename: "/" })
+        header.usage.add("/", true)
+        if config.Records == nil {
+            header.initLabels()
+        }
     }
 
     if header == nil {
-        return nil, util.RetErrStr("Invalid header. Failed to generate database header")
+        ZeroKey(cfg.Key)
+        return nil, retErrStr("Invalid header. Failed to generate database header")
     }
 
     header.flags = flags
+    header.config = *config
+    header.lock_version = lock_version
+    header.op_stats.since = time.Now()
+    header.initHooks()
+    header.initValidators()
+    if header.config.WriteBackSize > 0 && header.config.ReadOnly == false {
+        header.wb = newWriteBack()
+    }
+    header.throttle = newThrottle(config)
+
+    if config.SpillSize > 0 || (config.MaxMemory > 0 && config.MemoryPolicy == MEMORY_SPILL) {
+        if err := header.initSpill(); err != nil {
+            return nil, err
+        }
+    }
+
+    if config.EncryptMemory == true {
+        if err := header.initMemoryCipher(); err != nil {
+            return nil, err
+        }
+    }
+
+    if config.MemoryBudget > 0 {
+        header.lru = newLRUCache(config.MemoryBudget)
+    } else if evicts == true {
+        header.lru = newLRUCache(config.MaxMemory)
+    }
+    if report != nil {
+        header.verifyLoaded(report)
+    }
+    header.initMemoryUsage()
+    if config.ScrubInterval > 0 {
+        header.startScrubber()
+    }
+
+    return header, nil
+}
+
+/*
+ * Loads the raw fs stream. Returns nil if it does not exist
+ */
+func loadStream(name string, flags FlagVal, config *DBConfig, report *FsckReport) (*FSHeader, error) {
+    storage, stored_name := config.storage(name)
+    if _, err := storage.Open(stored_name); os.IsNotExist(err) {
+        return nil, nil
+    }
+
+    raw, scoped, err := readFsStream(name, flags, config)
+    if raw == nil || err != nil {
+        return nil, err
+    }
+    header, err := loadHeader(raw, scoped, name, config, report)
+    if header == nil || err != nil {
+        return nil, err
+    }
+    if size, err := storage.Open(stored_name); err == nil {
+        header.comp_stats.StreamSize = size
+    }
+
     return header, nil
 }
 
 func (f *FSHeader) StartIOController() error {
-    var header *FSHeader = f
+    f.ctl_lock.Lock()
+    defer f.ctl_lock.Unlock()
+
+    if f.closed == true {
+        return ErrClosed
+    }
+    if f.io_in != nil {
+        return retErrStr("StartIOController: IO controller is already running")
+    }
+    if f.config.Direct == true {
+        return nil /* Operations are dispatched inline */
+    }
+
+    var depth = f.config.QueueDepth
+    if depth == 0 {
+        depth = IRP_QUEUE_DEPTH
+    } else if depth < 0 {
+        depth = 0
+    }
 
     /* i/o channel processor. Performs i/o to the filesystem */
-    header.io_in = make(chan *govfsIoBlock)
-    go func (f *FSHeader) {
-        for {
-            var ioh = <- header.io_in
+    f.io_in = make(chan *govfsIoBlock, depth)
+    f.io_high = make(chan *govfsIoBlock, depth)
+    f.io_bg = make(chan *govfsIoBlock, depth)
+    f.ctl_done = make(chan struct{})
+    go f.ioController([IRP_PRIORITY_COUNT]chan *govfsIoBlock{ f.io_bg, f.io_in, f.io_high }, f.ctl_done)
 
-            if f.stale == true {
-                return
+    return nil
+}
+
+/*
+ * Services IRPs until the queues are closed by stopIOController(). Any IRPs which were
+ *  already queued are still processed, and answered, before returning.
+ */
+func (f *FSHeader) ioController(queues [IRP_PRIORITY_COUNT]chan *govfsIoBlock, done chan struct{}) {
+    defer close(done)
+
+    for {
+        ioh := nextIRP(&queues)
+        if ioh == nil {
+            return
+        }
+
+        f.startIRP(ioh)
+        if f.config.OperationTimeout > 0 {
+            f.dispatchTimeout(ioh, f.config.OperationTimeout)
+        } else {
+            f.dispatch(ioh)
+        }
+        f.untrackIRP(ioh)
+
+        ioh.io_out <- ioh
+    }
+}
+
+/*
+ * Performs the operation described by an IRP, and sets its status
+ */
+func (f *FSHeader) dispatch(ioh *govfsIoBlock) {
+    start := time.Now()
+    f.repl.apply.RLock()
+    hooks, operation, err := f.beforeIRP(ioh)
+    defer func () {
+        f.repl.record(ioh)
+        f.auditIRP(ioh)
+        f.notifyIRP(ioh)
+        f.repl.apply.RUnlock()
+        f.observeIRP(ioh, start)
+        afterIRP(hooks, operation, ioh.status)
+    }()
+
+    if err == nil {
+        err = f.resolveIRP(ioh)
+    }
+    if err == nil {
+        err = f.authorizeIRP(ioh)
+    }
+    if err != nil {
+        ioh.status = err
+        return
+    }
+
+    switch ioh.operation {
+    case IRP_PURGE:
+        /* PURGE -- remove every file except the root, see Purge() */
+        root := f.check("/")
+        for _, v := range f.meta.reset() {
+            if v == root {
+                continue
             }
 
-            switch ioh.operation {
-            case IRP_PURGE:
-                /* PURGE */
-                ioh.status = util.RetErrStr("Purge command issued")
-                close(header.io_in)
-                return
-            case IRP_DELETE:
-                /* DELETE */
-                // FIXME/ADDME
-                ioh.status = util.RetErrStr("IRP_DELETE generic error")
-                if ioh.file.filename == "/" { /* Cannot delete the root file */
-                    ioh.status = util.RetErrStr("IRP_DELETE: Tried to delete the root file")
-                    ioh.io_out <- ioh
-                } else {
-                    if i := f.check(ioh.name); i != nil {
-                        delete(f.meta, s(ioh.name))
-                        f.meta[s(ioh.name)] = nil
-                        ioh.status = nil
-                    }
-                    ioh.io_out <- ioh
+            v.lock.Lock()
+            wipeBuffer(v.data, false)
+            v.data = nil
+            f.removeSpill(v, false)
+            f.cacheRemove(v)
+            v.size = 0
+            v.lock.Unlock()
+        }
+        f.meta.set("/", root)
+        f.markPurged()
+        f.usage.rebuild([]*govfsFile{ root })
+
+        f.size_lock.Lock()
+        f.mem_size = 0
+        f.size_lock.Unlock()
+
+        atomic.StoreInt32(&f.wipe_stale, 1)
+        ioh.status = nil
+    case IRP_DELETE:
+        /* DELETE */
+        ioh.status = pathError("delete", ioh.name, ErrNotExist)
+        if ioh.file.filename == "/" { /* Cannot delete the root file */
+            ioh.status = retErrStr("IRP_DELETE: Tried to delete the root file")
+        } else {
+            if i := f.check(ioh.name); i != nil && (i.flags & FLAG_APPEND_ONLY) > 0 {
+                ioh.status = pathError("delete", ioh.name, ErrAppendOnly)
+            } else if i != nil {
+                i.lock.Lock()
+                size, dir, owner := i.size, (i.flags & FLAG_DIRECTORY) > 0, fileOwner(i)
+                f.adjustMemory(-residentSize(i))
+                wipeBuffer(i.data, (ioh.flags & FLAG_SHRED) > 0)
+                i.data = nil
+                f.removeSpill(i, (ioh.flags & FLAG_SHRED) > 0)
+                f.cacheRemove(i)
+                i.size = 0
+                i.lock.Unlock()
+                if (ioh.flags & FLAG_SHRED) > 0 {
+                    atomic.StoreInt32(&f.wipe_stale, 1)
                 }
-            case IRP_WRITE:
-                /* WRITE */
-                if i := f.check(ioh.name); i != nil {
-                    ioh.file.lock.Lock()
-                    if f.writeInternal(i, ioh.data) == len(ioh.data) {
-                        ioh.status = nil
-                        ioh.file.lock.Unlock()
-                        ioh.io_out <- ioh
-                    } else {
-                        ioh.status = util.RetErrStr("IRP_WRITE: Failed to write to filesystem")
-                        ioh.file.lock.Unlock()
-                        ioh.io_out <- ioh
-                    }
+
+                f.meta.remove(ioh.name)
+                f.usage.remove(i.filename, dir, size)
+                f.usage.own(owner, -size)
+                f.markDirty(i.filename, nil)
+                ioh.status = nil
+            }
+        }
+    case IRP_WRITE:
+        /* WRITE */
+        ioh.status = pathError("write", ioh.name, ErrNotExist)
+        if i := f.check(ioh.name); i != nil && (i.flags & FLAG_DIRECTORY) > 0 {
+            ioh.status = pathError("write", ioh.name, ErrIsDirectory)
+        } else if i != nil {
+            ioh.file.lock.Lock()
+            if err := f.validateIRP(i, ioh); err != nil {
+                ioh.status = err
+                ioh.file.lock.Unlock()
+                break
+            }
+
+            if (ioh.flags & FLAG_IF_GENERATION) > 0 && i.generation() != ioh.generation {
+                ioh.status = pathError("write", ioh.name, ErrStaleGeneration)
+                ioh.file.lock.Unlock()
+                break
+            }
+
+            if (i.flags & FLAG_APPEND_ONLY) > 0 && (ioh.flags & FLAG_APPEND) == 0 {
+                ioh.status = pathError("write", ioh.name, ErrAppendOnly)
+                ioh.file.lock.Unlock()
+                break
+            }
+
+            var appended = ioh.data
+            if (i.flags & FLAG_HASH_CHAIN) > 0 && (ioh.flags & FLAG_APPEND) > 0 {
+                record, err := f.chainRecord(i, ioh.data)
+                if err != nil {
+                    ioh.status = err
+                    ioh.file.lock.Unlock()
+                    break
                 }
-            case IRP_CREATE:
-                f.meta[s(ioh.name)] = new(govfsFile)
-                ioh.file = f.meta[s(ioh.name)]
-                ioh.file.filename = ioh.name
+                appended = record
+            }
+
+            var growth = len(ioh.data) - i.size
+            if (ioh.flags & FLAG_APPEND) > 0 {
+                growth = len(appended)
+            }
+            if err := f.checkSessionQuota(i, ioh.principal, growth); err != nil {
+                ioh.status = err
+                ioh.file.lock.Unlock()
+                break
+            }
 
-                if string(ioh.name[len(ioh.name) - 1:]) == "/" {
-                    ioh.file.flags |= FLAG_DIRECTORY
+            var data = ioh.data
+            if (ioh.flags & FLAG_APPEND) > 0 && i.spill != nil {
+                /* Spilled files are appended to on the disk */
+                if err := f.spillAppend(i, appended); err != nil {
+                    ioh.status = err
                 } else {
-                    ioh.file.flags |= FLAG_FILE
+                    f.markDirty(i.filename, i)
+                    ioh.status = nil
+                    ioh.generation = i.generation()
                 }
-
-                /* Recursively create all subdirectory files */
-                sub_strings := strings.Split(ioh.name, "/")
-                sub_array := make([]string, len(sub_strings) - 2)
-                copy(sub_array, sub_strings[1:len(sub_strings) - 1]) /* We do not need the first/last file */
-                var tmp string = ""
-                for e := range sub_array {
-                    tmp += "/" + sub_array[e]
-
-                    /* Create a subdirectory header */
-                    func (sub_directory string, f *FSHeader) {
-                        if f := f.check(sub_directory); f != nil {
-                            return /* There can exist two files with the same name,
-                                       as long as one is a directory and the other is a file */
-                        }
-
-                        f.meta[s(tmp)] = new(govfsFile)
-                        f.meta[s(tmp)].filename = sub_directory + "/" /* Explicit directory name */
-                        f.meta[s(tmp)].flags |= FLAG_DIRECTORY
-                    } (tmp, f)
+                ioh.file.lock.Unlock()
+                break
+            } else if (ioh.flags & FLAG_APPEND) > 0 {
+                existing, err := f.unsealData(i)
+                if err != nil {
+                    ioh.status = err
+                    ioh.file.lock.Unlock()
+                    break
+                }
+                data = append(existing, appended...)
+                if f.mem_cipher != nil {
+                    defer wipeBuffer(data, false)
                 }
+            }
+
+            spill, err := f.checkMemory(i, data)
+            if err != nil {
+                ioh.status = err
+                ioh.file.lock.Unlock()
+                break
+            }
 
+            if f.writeInternal(i, data, spill, true) == len(data) {
+                f.markDirty(i.filename, i)
                 ioh.status = nil
-                ioh.io_out <- ioh
+                ioh.generation = i.generation()
+            } else {
+                ioh.status = retErrStr("IRP_WRITE: Failed to write to filesystem")
             }
+            ioh.file.lock.Unlock()
+        }
+    case IRP_CREATE:
+        if f.check(ioh.name) != nil {
+            /* Lost a race with an asynchronous create of the same name */
+            ioh.status = pathError("create", ioh.name, ErrExist)
+            break
         }
-    } (header)
 
-    return nil
+        ioh.file = &govfsFile{ filename: ioh.name, modtime: time.Now().UnixNano() }
+        if ioh.principal != "" {
+            ioh.file.xattrs = map[string]string{ OWNER_XATTR: ioh.principal }
+        }
+
+        if string(ioh.name[len(ioh.name) - 1:]) == "/" {
+            ioh.file.flags |= FLAG_DIRECTORY
+        } else {
+            ioh.file.flags |= FLAG_FILE | (ioh.flags & (FLAG_APPEND_ONLY | FLAG_HASH_CHAIN))
+        }
+        f.meta.set(ioh.name, ioh.file)
+        f.usage.add(ioh.name, (ioh.file.flags & FLAG_DIRECTORY) > 0)
+        f.markDirty(ioh.file.filename, ioh.file)
+
+        /* Recursively create all subdirectory files */
+        sub_strings := strings.Split(ioh.name, "/")
+        sub_array := make([]string, len(sub_strings) - 2)
+        copy(sub_array, sub_strings[1:len(sub_strings) - 1]) /* We do not need the first/last file */
+        var tmp string = ""
+        for e := range sub_array {
+            tmp += "/" + sub_array[e]
+
+            /* Create a subdirectory header */
+            func (sub_directory string, f *FSHeader) {
+                if f := f.check(sub_directory); f != nil {
+                    return /* There can exist two files with the same name,
+                               as long as one is a directory and the other is a file */
+                }
+
+                dir := &govfsFile{
+                    filename: sub_directory + "/", /* Explicit directory name */
+                    flags: FLAG_DIRECTORY,
+                    modtime: ioh.file.modtime,
+                }
+                f.meta.set(tmp, dir)
+                f.usage.add(dir.filename, true)
+                f.markDirty(dir.filename, dir)
+            } (tmp, f)
+        }
+
+        ioh.status = nil
+    case IRP_XATTR:
+        ioh.status = f.setXattr(ioh)
+    default:
+        ioh.status = retErrStr("Invalid IRP operation")
+    }
 }
 
 /*
  * Exported method to check for object existence in db
  */
 func (f *FSHeader) Check(name string) bool {
+    if f.isClosed() {
+        return false
+    }
+
     t := f.check(name)
     if t == nil {
         return false
@@ -280,11 +850,7 @@ func (f *FSHeader) Check(name string) bool {
 }
 
 func (f *FSHeader) check(name string) *govfsFile {
-    if sum := s(name); f.meta[sum] != nil {
-        return f.meta[sum]
-    }
-
-    return nil
+    return f.meta.get(name)
 }
 
 func (f *FSHeader) generateIRP(name string, data []byte, irp_type FlagVal) *govfsIoBlock {
@@ -292,14 +858,14 @@ func (f *FSHeader) generateIRP(name string, data []byte, irp_type FlagVal) *govf
     case IRP_DELETE:
         /* DELETE */
         var file_header = f.check(name)
-        if file_header == nil {
+        if file_header == nil && f.hasHooks() == false {
             return nil /* ERROR -- deleting non-existant file */
         }
 
         irp := &govfsIoBlock {
             file: file_header,
             name: name,
-            io_out: make(chan *govfsIoBlock),
+            io_out: make(chan *govfsIoBlock, 1), /* Buffered, the sender may have given up, see submitCtx() */
 
             operation: IRP_DELETE,
         }
@@ -308,19 +874,19 @@ func (f *FSHeader) generateIRP(name string, data []byte, irp_type FlagVal) *govf
     case IRP_WRITE:
         /* WRITE */
         var file_header = f.check(name)
-        if file_header == nil {
-            return nil
+        if file_header == nil && f.hasHooks() == false {
+            return nil /* A hook may rewrite the name, see resolveIRP() */
         }
 
+        /* The file keeps the data, the caller passes a copy unless it gives it up. See writeIRP() */
         irp := &govfsIoBlock{
             file: file_header,
             name: name,
-            data: make([]byte, len(data)),
-            io_out: make(chan *govfsIoBlock),
+            data: data,
+            io_out: make(chan *govfsIoBlock, 1), /* Buffered, the sender may have given up, see submitCtx() */
 
             operation: IRP_WRITE, /* write IRP request */
         }
-        copy(irp.data, data)
 
         return irp
 
@@ -329,7 +895,7 @@ func (f *FSHeader) generateIRP(name string, data []byte, irp_type FlagVal) *govf
         irp := &govfsIoBlock{
             name: name,
             operation: IRP_CREATE,
-            io_out: make(chan *govfsIoBlock),
+            io_out: make(chan *govfsIoBlock, 1), /* Buffered, the sender may have given up, see submitCtx() */
         }
 
         return irp
@@ -339,26 +905,57 @@ func (f *FSHeader) generateIRP(name string, data []byte, irp_type FlagVal) *govf
 }
 
 func (f *FSHeader) Create(name string) error {
-    if file := f.check(name); file != nil {
-        return util.RetErrStr("create: File already exists")
+    return f.CreateCtx(context.Background(), name)
+}
+
+/*
+ * Create() which gives up once ctx is done, e.g. when stuck behind a busy IO controller
+ */
+func (f *FSHeader) CreateCtx(ctx context.Context, name string) error {
+    /* Held until the IRP is processed, so a concurrent Create() of the same name sees the file */
+    unlock := f.lockPath(name)
+    defer unlock()
+
+    return f.createLocked(ctx, name)
+}
+
+/*
+ * Create() of a name whose path lock the caller holds
+ */
+func (f *FSHeader) createLocked(ctx context.Context, name string) (err error) {
+    ctx, span := f.trace(ctx, TRACE_CREATE, name)
+    defer func () { span.End(0, err) }()
+
+    irp, err := f.createIRP(ctx, name)
+    if err != nil {
+        return err
     }
 
-    if len(name) > MAX_FILENAME_LENGTH {
-        return util.RetErrStr("create: File name is too long")
+    output_irp, err := f.submitCtx(ctx, irp)
+    if err != nil {
+        return err
+    }
+
+    return output_irp.status
+}
+
+func (f *FSHeader) createIRP(ctx context.Context, name string) (*govfsIoBlock, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
     }
 
-    f.create_sync.Lock()
-    var irp *govfsIoBlock = f.generateIRP(name, nil, IRP_CREATE)
+    if file := f.check(name); file != nil {
+        return nil, pathError("create", name, ErrExist)
+    }
 
-    f.io_in <- irp
-    output_irp := <- irp.io_out
-    f.create_sync.Unlock()
-    if output_irp.file == nil {
-        return output_irp.status
+    if len(name) > MAX_FILENAME_LENGTH {
+        return nil, retErrStr("create: File name is too long")
     }
-    close(output_irp.io_out)
 
-    return nil
+    return f.generateIRP(name, nil, IRP_CREATE), nil
 }
 
 /*
@@ -369,12 +966,22 @@ type Reader struct {
     File *govfsFile
     Hdr *FSHeader
     Offset int
+    next int /* Offset after the previous Read(), see readAhead() */
+    sequential int
+    ahead int /* End of the data fetched ahead */
 }
 
 func (f *FSHeader) NewReader(name string) (*Reader, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+    if err := f.syncPath(name); err != nil {
+        return nil, err
+    }
+
     file := f.check(name)
     if file == nil {
-        return nil, util.RetErrStr("File not found")
+        return nil, pathError("open", name, ErrNotExist)
     }
 
     reader := &Reader{
@@ -388,14 +995,33 @@ func (f *FSHeader) NewReader(name string) (*Reader, error) {
 }
 
 func (f *Reader) Len() (int) {
-    return len(f.File.data)
+    f.File.lock.Lock()
+    defer f.File.lock.Unlock()
+
+    return f.File.size
 }
 
 func (f *Reader) Read(r []byte) (int, error) {
-    if f.Name == "" || f.File == nil || len(f.File.data) < 1  {
+    if f.Name == "" || f.File == nil || f.File.size < 1  {
         return 0, nil
     }
 
+    /* Spilled files are streamed from the disk */
+    if err := f.Hdr.syncPath(f.Name); err != nil {
+        return 0, err
+    }
+    f.readAhead()
+    defer func () { f.next = f.Offset }()
+
+    f.File.lock.Lock()
+    if f.File.spill != nil {
+        n, err := f.Hdr.spillReadAt(f.File, r, int64(f.Offset))
+        f.Offset += n
+        f.File.lock.Unlock()
+        return n, err
+    }
+    f.File.lock.Unlock()
+
     data, err := f.Hdr.Read(f.Name)
     if err != nil || len(data) == 0 {
         return 0, err
@@ -414,51 +1040,138 @@ func (f *Reader) Read(r []byte) (int, error) {
 }
 
 func (f *FSHeader) Read(name string) ([]byte, error) {
-    var file_header = f.check(name)
-    if file_header == nil {
-        return nil, util.RetErrStr("read: File does not exist")
-    }
-
-    if (file_header.flags & FLAG_DIRECTORY) > 0 {
-        return nil, util.RetErrStr("read: Cannot read a directory")
-    }
+    return f.ReadCtx(context.Background(), name)
+}
 
-    output := make([]byte, len(file_header.data))
-    copy(output, file_header.data)
-    return output, nil
+/*
+ * Reads do not pass through the IO controller, so ctx is only checked before reading
+ */
+func (f *FSHeader) ReadCtx(ctx context.Context, name string) ([]byte, error) {
+    return f.readCtx(ctx, name, nil)
 }
 
-func (f *FSHeader) Delete(name string) error {
-    irp := f.generateIRP(name, nil, IRP_DELETE)
-    if irp == nil {
-        return util.RetErrStr("delete: File does not exist") /* ERROR -- File does not exist */
+func (f *FSHeader) readCtx(ctx context.Context, name string, buf []byte) (data []byte, err error) {
+    ctx, span := f.trace(ctx, TRACE_READ, name)
+    start := time.Now()
+    defer func () {
+        f.observe(LOG_READ, name, len(data), start, err)
+        span.End(len(data), err)
+    }()
+
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if err := f.syncPath(name); err != nil {
+        return nil, err
+    }
+
+    var file_header = f.check(name)
+    if file_header == nil {
+        return nil, pathError("read", name, ErrNotExist)
+    }
+    if err := f.checkACL("read", name, file_header, principalFromContext(ctx), ACCESS_READ); err != nil {
+        return nil, err
     }
 
-    f.io_in <- irp
-    var output_irp = <- irp.io_out
-    defer close(irp.io_out)
+    file_header.lock.Lock()
+    defer file_header.lock.Unlock()
+
+    if (file_header.flags & FLAG_DIRECTORY) > 0 {
+        return nil, pathError("read", name, ErrIsDirectory)
+    }
+
+    hit := file_header.record() == nil
+    data, err = f.unsealDataInto(file_header, buf)
+    if err != nil {
+        return nil, err
+    }
+    if err := f.verifyData(file_header, data); err != nil {
+        wipeBuffer(data, false)
+        return nil, pathError("read", name, err)
+    }
+    f.cacheRead(file_header, hit)
+
+    return data, nil
+}
+
+func (f *FSHeader) Delete(name string) error {
+    return f.DeleteCtx(context.Background(), name)
+}
+
+func (f *FSHeader) DeleteCtx(ctx context.Context, name string) error {
+    return f.deleteCtx(ctx, name, 0)
+}
+
+/*
+ * `flags` are those of the IRP_DELETE, i.e. FLAG_SHRED
+ */
+func (f *FSHeader) deleteCtx(ctx context.Context, name string, flags FlagVal) (err error) {
+    ctx, span := f.trace(ctx, TRACE_DELETE, name)
+    defer func () { span.End(0, err) }()
+
+    if f.wb != nil {
+        f.wb.flush_lock.Lock()
+        defer f.wb.flush_lock.Unlock()
+        f.discardPath(name)
+    }
+
+    irp, err := f.deleteIRP(name)
+    if err != nil {
+        return err
+    }
+    irp.flags |= flags
+
+    output_irp, err := f.submitCtx(ctx, irp)
+    if err != nil {
+        return err
+    }
 
     return output_irp.status
 }
 
+func (f *FSHeader) deleteIRP(name string) (*govfsIoBlock, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+
+    irp := f.generateIRP(name, nil, IRP_DELETE)
+    if irp == nil {
+        return nil, pathError("delete", name, ErrNotExist)
+    }
+
+    return irp, nil
+}
+
 /*
  * Commits in-memory objects to the disk
  */
 func (f *FSHeader) Commit() (*FSHeader, error) {
     var existingFlags FlagVal = (f.flags & FLAG_COMPRESS) | (f.flags & FLAG_ENCRYPT)
 
-    f.UnmountDB(0)
+    if err := f.UnmountDB(0); err != nil {
+        return nil, err
+    }
 
-    if _, err := os.Stat(f.filename); os.IsNotExist(err) {
+    storage, stored_name := f.config.storage(f.filename)
+    if _, err := storage.Open(stored_name); f.config.Records == nil && os.IsNotExist(err) {
         return nil, err
     }
-    f.stale = true
 
-    var header, err = CreateDatabase(f.filename, existingFlags | FLAG_DB_LOAD)
+    /* This header is superseded by the reloaded one */
+    f.stopIOController()
+
+    var header, err = CreateDatabaseConfig(f.filename, existingFlags | FLAG_DB_LOAD, &f.config)
     if err != nil {
         return nil, err
     }
 
+    /* The new header holds its own copy of the key */
+    ZeroKey(f.config.Key)
+    f.mem_cipher = nil
+
     if err := header.StartIOController(); err != nil {
         return nil, err
     }
@@ -476,9 +1189,13 @@ type Writer struct {
 }
 
 func (f *FSHeader) NewWriter(name string) (*Writer, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+
     file := f.check(name)
     if file == nil {
-        return nil, util.RetErrStr("File not found")
+        return nil, pathError("open", name, ErrNotExist)
     }
 
     writer := &Writer {
@@ -492,7 +1209,7 @@ func (f *FSHeader) NewWriter(name string) (*Writer, error) {
 
 func (f *Writer) Write(p []byte) (int, error) {
     if len(p) < 1 {
-        return 0, util.RetErrStr("Invalid write stream length")
+        return 0, retErrStr("Invalid write stream length")
     }
 
     if err := f.Hdr.Write(f.Name, p); err != nil {
@@ -502,105 +1219,205 @@ func (f *Writer) Write(p []byte) (int, error) {
     return len(p), io.EOF
 }
 
+/*
+ * Replaces the contents of a file with `d`. An empty `d` truncates the file, keeping its
+ *  attributes, owner and ACL. Like every successful write it advances the generation
+ */
 func (f *FSHeader) Write(name string, d []byte) error {
-    if i := f.check(name); i == nil {
-        return util.RetErrStr("write: Cannot write to nonexistent file")
+    return f.WriteCtx(context.Background(), name, d)
+}
+
+/*
+ * Write() made as the principal of ctx, and traced as a child of its span
+ */
+func (f *FSHeader) WriteCtx(ctx context.Context, name string, d []byte) error {
+    return f.writeCtx(ctx, name, d, false)
+}
+
+func (f *FSHeader) writeCtx(ctx context.Context, name string, d []byte, owned bool) (err error) {
+    ctx, span := f.trace(ctx, TRACE_WRITE, name)
+    defer func () { span.End(len(d), err) }()
+
+    if f.isAppendOnly(name) == true {
+        /* Rather than buffering a replace of the pending appends */
+        return pathError("write", name, ErrAppendOnly)
     }
 
-    irp := f.generateIRP(name, d, IRP_WRITE)
-    if irp == nil {
-        return util.RetErrStr("write: Failed to generate IRP_WRITE") /* FAILURE */
+    if f.wb != nil {
+        if len(d) < f.config.WriteBackSize && f.buffersSession(ctx) == true {
+            return f.bufferWrite(name, d, true)
+        }
+        /* Replaces any buffered data */
+        f.wb.flush_lock.Lock()
+        defer f.wb.flush_lock.Unlock()
+        f.discardPath(name)
+    }
+
+    irp, err := f.writeIRP(name, d, owned)
+    if err != nil {
+        return err
     }
 
     /*
      * Send the write request IRP and receive the response
      *  IRP indicating the write status of the request
      */
-    f.io_in <- irp
-    var output_irp = <- irp.io_out
-    defer close(irp.io_out)
+    output_irp, err := f.submitCtx(ctx, irp)
+    if err != nil {
+        return err
+    }
 
     return output_irp.status
 }
 
-func (f *FSHeader) writeInternal(d *govfsFile, data []byte) int {
-    if len(data) == 0 {
-        return len(data)
+/*
+ * Unless `owned` is set, the IRP is given a copy of `d`, which the file keeps
+ */
+func (f *FSHeader) writeIRP(name string, d []byte, owned bool) (*govfsIoBlock, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
     }
 
-    if uint(len(data)) >= uint(len(d.data)) {
-        f.t_size += len(data) - len(d.data)
-    } else {
-        f.t_size -= len(d.data) - len(data)
+    if i := f.check(name); i == nil && f.hasHooks() == false {
+        return nil, pathError("write", name, ErrNotExist)
     }
 
-    d.data = make([]byte, len(data))
-    copy(d.data, data)
-    d.datasum = s(string(data))
+    if owned == false {
+        d = append([]byte(nil), d...)
+    }
 
-    datalen := len(d.data)
+    irp := f.generateIRP(name, d, IRP_WRITE)
+    if irp == nil {
+        return nil, retErrStr("write: Failed to generate IRP_WRITE") /* FAILURE */
+    }
 
-    return datalen
+    return irp, nil
 }
 
-func (f *FSHeader) UnmountDB(flags FlagVal /* FLAG_COMPRESS_FILES */) error {
-    type comp_data struct {
-        file *govfsFile
-        raw RawFile
+/*
+ * If `owned` is set, `data` is not referenced by anyone else and the file may keep it.
+ *  Empty data truncates the file, keeping its attributes
+ */
+func (f *FSHeader) writeInternal(d *govfsFile, data []byte, spill bool, owned bool) int {
+    if len(data) == 0 {
+        spill, owned, data = false, true, nil
     }
 
-    commit_ch := make(chan bytes.Buffer)
-    for k := range f.meta {
-        var channel_header comp_data
-        channel_header.file = f.meta[k]
-        channel_header.raw = RawFile{
-            Flags: f.meta[k].flags,
-            RawSum: f.meta[k].datasum,
-            Name: f.meta[k].filename,
-            UnzippedLen: 0,
+    resident := residentSize(d)
+    if spill == true {
+        if err := f.spillWrite(d, data); err != nil {
+            return 0
         }
 
-        go func (d *comp_data) {
-            if d.file.filename == "/" {
-                return
+        wipeBuffer(d.data, false)
+        d.data = nil
+    } else {
+        var sealed = data
+        if len(data) > 0 && (owned == false || f.mem_cipher != nil) {
+            var err error
+            if sealed, err = f.sealData(data); err != nil {
+                return 0
             }
+        }
 
-            var dataStream []byte = d.file.data
-            if (d.file.flags & FLAG_FILE) > 0 && len(d.file.data) > 0 {
-                d.raw.UnzippedLen = len(d.file.data)
+        /* The previous contents are stale, do not leave them on the heap */
+        wipeBuffer(d.data, false)
+        f.removeSpill(d, false)
 
-                if (flags & FLAG_COMPRESS) > 0 && util.GetCompressedSize(d.file.data) < len(d.file.data) {
-                    d.raw.Flags |= FLAG_COMPRESS
+        d.data = sealed
+        d.setSum(checksumOf(f.config.Checksum, data), f.config.Checksum)
+    }
 
-                    var err error = nil
-                    dataStream, err = util.CompressStream(d.file.data)
-                    if err != nil {
-                        util.ThrowN(err.Error())
-                    }
-                }
-            }
+    f.usage.resize(d.filename, len(data) - d.size)
+    f.usage.own(fileOwner(d), len(data) - d.size)
 
-            var output = bytes.Buffer{}
-            enc := gob.NewEncoder(&output)
-            enc.Encode(d.raw)
+    d.setLoaded()
+    d.size = len(data)
+    d.modtime = time.Now().UnixNano()
+    d.contents.generation++
+    f.adjustMemory(residentSize(d) - resident)
+    f.cacheUpdate(d)
 
-            if len(dataStream) > 0 {
-                output.Write(dataStream)
-            }
+    return d.size
+}
 
-            commit_ch <- output
-        }(&channel_header)
+func (f *FSHeader) UnmountDB(flags FlagVal /* FLAG_COMPRESS_FILES */) error {
+    return f.UnmountDBCtx(context.Background(), flags)
+}
+
+/*
+ * UnmountDB() which is traced as a child of the span in ctx, see Tracer. Once ctx is
+ *  done the commit is abandoned and ctx.Err() returned, leaving both the header and the
+ *  previous raw fs file unchanged. Cancellation is checked while encoding the files and
+ *  while writing to a StorageBackend which implements ContextStorage, but no longer once
+ *  the previous raw fs file was destroyed to wipe deleted files, or once the records were
+ *  passed to RecordStorage.Commit().
+ */
+func (f *FSHeader) UnmountDBCtx(ctx context.Context, flags FlagVal) (err error) {
+    _, span := f.trace(ctx, TRACE_COMMIT, f.filename)
+    defer func () { span.End(f.GetTotalFilesizes(), err) }()
+
+    if f.isClosed() {
+        return ErrClosed
+    }
+    if f.config.ReadOnly == true {
+        return ErrReadOnly
+    }
+    if err := ctx.Err(); err != nil {
+        return err
     }
+    if err := f.Sync(); err != nil {
+        return err
+    }
+
+    return f.unmount(ctx, flags)
+}
 
-    /* Do not count "/" as a file, since it is not sent in channel */
-    total_files := f.GetFileCount() - 1
+func (f *FSHeader) unmount(ctx context.Context, flags FlagVal) (err error) {
+    start := time.Now()
+    defer func () {
+        if err == nil {
+            f.meta.gc() /* Frees the entries of the files deleted since the last commit */
+        }
+        f.observe(LOG_COMMIT, f.filename, f.GetTotalFilesizes(), start, err)
+    }()
+
+    if f.config.Ephemeral == true {
+        return ErrEphemeral
+    }
+    if f.config.Records != nil {
+        return f.commitRecords(ctx, flags)
+    }
+
+    fileCodec := f.fileCodec()
+
+    /* "/" is not counted as a file, since it is not written to the stream */
+    files := f.files()
+    if f.config.ShuffleRecords == true {
+        shuffleFiles(files)
+    }
+    var total_files uint = 0
+    for _, file := range files {
+        if file.filename != "/" {
+            total_files += 1
+        }
+    }
 
     /*
      * Generate the primary filesystem header and write it to the fs_stream
      */
     hdr := rawStreamHeader {
-        Signature:  FS_SIGNATURE, /* This signature may be modified in the configuration -- FIXME */
-        FileCount:  total_files }
+        Signature:  f.config.signature(), /* See signature.go */
+        FileCount:  total_files,
+        Codec:      fileCodec.Name() }
+
+    if fileCodec == f.dict_codec {
+        hdr.Dictionary = f.dictionary
+    }
+    hdr.Audit = f.auditEntries()
+    hdr.Volumes = f.volumes.snapshot()
+    var labelVersion int
+    hdr.Labels, labelVersion = f.labels.snapshot()
 
     /* Serializer for fs_header */
     var stream *bytes.Buffer
@@ -619,58 +1436,389 @@ func (f *FSHeader) UnmountDB(flags FlagVal /* FLAG_COMPRESS_FILES */) error {
         stream = new(bytes.Buffer)
     }
 
-    /* serialized RawFile metadata includes the gzip'd file data, if necessary */
-    for total_files != 0 {
-        var meta_raw = <- commit_ch
-        stream.Write(meta_raw.Bytes())
-        total_files -= 1
+    /* The catalog and the data of a scoped stream are kept apart, see scope.go */
+    var stored = stream
+    if f.config.scoped() == true {
+        stored = new(bytes.Buffer)
+        flags = f.scopedFlags(flags)
     }
 
-    close(commit_ch)
+    /* serialized RawFile metadata includes the gzip'd file data, if necessary */
+    stats := newCompressionStats(fileCodec.Name())
+    progress := newProgress(f.config.Progress, LOG_COMMIT, f.filename, int(total_files), int64(f.GetTotalFilesizes()))
+    var padErr error
+    err = f.encodeFiles(ctx, files, flags, fileCodec, func (raw *RawFile, header []byte, data []byte) {
+        /* Offsets count the envelope, see padding.go */
+        if pad := f.config.recordPadding(2 + stream.Len()); pad > 0 && padErr == nil {
+            padErr = writeRecordPad(stream, pad)
+        }
+        stream.Write(header)
+        stored.Write(data)
+        stats.add(raw, fileCodec.Name())
+        progress.add(1, int64(raw.UnzippedLen))
+    })
+    if err == nil {
+        err = padErr
+    }
+    if err != nil {
+        return err
+    }
+    if stored != stream {
+        if stream, err = f.encodeScoped(stream, stored); err != nil {
+            return err
+        }
+    }
 
     /* Compress, encrypt, and write stream */
-    written, err := f.writeFsStream(f.filename, stream, f.flags)
-    if err != nil || int(written) == 0 {
-        return util.RetErrStr("Failure in writing raw fs stream")
+    var written uint = 0
+    write := func () error {
+        var err error
+        written, err = f.writeFsStream(ctx, f.filename, stream, f.flags)
+        if err != nil && ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if err != nil || int(written) == 0 {
+            return retErrStr("Failure in writing raw fs stream")
+        }
+        return nil
+    }
+
+    if f.config.Locking == true {
+        err = f.lockedCommit(write)
+    } else {
+        err = write()
     }
+    if err != nil {
+        return err
+    }
+
+    stats.StreamSize = int64(written)
+    f.setCompressionStats(stats)
+    f.labels.setCommitted(labelVersion)
+    progress.done()
 
-    return err
+    return nil
 }
 
-func loadHeader(data []byte, filename string) (*FSHeader, error) {
-    ptr := bytes.NewBuffer(data) /* raw file stream */
+/*
+ * Buffers of the gob encoded RawFile and the stored data of each file, see encodeFiles()
+ */
+var encodeBuffers = sync.Pool{
+    New: func () interface{} { return new(bytes.Buffer) },
+}
 
-    if REMOVE_FS_HEADER != true {
-        header, err := func(p *bytes.Buffer) (*rawStreamHeader, error) {
-            output := new(rawStreamHeader)
+/*
+ * Encodes every file but "/" on at most GOMAXPROCS workers, and passes each to `emit`
+ *  (on the calling goroutine) as it completes. `header` and `data` are only valid
+ *  until emit returns. Files are no longer encoded after the first error, which is returned,
+ *  or once ctx is done
+ */
+func (f *FSHeader) encodeFiles(ctx context.Context, files []*govfsFile, flags FlagVal, fileCodec Codec,
+    emit func (raw *RawFile, header []byte, data []byte)) error {
+    type encoded_file struct {
+        raw         RawFile
+        header      *bytes.Buffer
+        data        *bytes.Buffer
+        err         error
+    }
 
-            d := gob.NewDecoder(p)
-            if err := d.Decode(output); err != nil {
-                return nil, err
+    /* The data of each file of a scoped stream may be encrypted on its own */
+    seal := f.config.scoped() == true && (f.scopeBits() & SCOPED_DATA_ENCRYPTED) > 0
+
+    workers := runtime.GOMAXPROCS(0)
+    jobs := make(chan *govfsFile)
+    results := make(chan *encoded_file, workers)
+    abort := make(chan struct{})
+
+    var wg sync.WaitGroup
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func () {
+            defer wg.Done()
+            for file := range jobs {
+                d := &encoded_file{
+                    header: encodeBuffers.Get().(*bytes.Buffer),
+                    data:   encodeBuffers.Get().(*bytes.Buffer),
+                }
+
+                /* The header is encoded after the data, since it records its length */
+                raw, err := f.encodeFile(file, flags, fileCodec, d.data)
+                if err == nil && seal == true && d.data.Len() > 0 {
+                    if err = f.sealScoped(d.data); err == nil {
+                        raw.StoredLen = d.data.Len()
+                    }
+                }
+                if err == nil {
+                    err = gob.NewEncoder(d.header).Encode(raw)
+                }
+                if err != nil {
+                    d.err = pathError("commit", file.filename, err)
+                }
+                d.raw = raw
+                results <- d
             }
+        }()
+    }
 
-            return output, nil
-        }(ptr)
+    go func () {
+        defer close(jobs)
+        for _, file := range files {
+            if file.filename == "/" {
+                continue
+            }
+            select {
+            case jobs <- file:
+            case <- abort:
+                return
+            }
+        }
+    }()
+    go func () {
+        wg.Wait()
+        close(results)
+    }()
+
+    /* Drained completely, so that no worker is left blocked on results */
+    var status error
+    for d := range results {
+        if d.err == nil {
+            d.err = ctx.Err()
+        }
+        if d.err != nil && status == nil {
+            status = d.err
+            close(abort)
+        }
+        if status == nil {
+            emit(&d.raw, d.header.Bytes(), d.data.Bytes())
+        }
+
+        /* The data is plaintext unless it is encrypted by a policy */
+        if f.mem_cipher != nil {
+            wipeBuffer(d.data.Bytes(), false)
+        }
+        d.header.Reset()
+        d.data.Reset()
+        encodeBuffers.Put(d.header)
+        encodeBuffers.Put(d.data)
+    }
+
+    return status
+}
+
+/*
+ * Returns the RawFile header of a file and writes its data to `out` as it is stored,
+ *  i.e. compressed if FLAG_COMPRESS_FILES is set and worthwhile, then encrypted by
+ *  its subtree's EncryptionPolicy. Compressed data is streamed into `out` directly
+ *  when the codec implements StreamCodec
+ */
+func (f *FSHeader) encodeFile(file *govfsFile, flags FlagVal, fileCodec Codec, out *bytes.Buffer) (RawFile, error) {
+    raw := RawFile{
+        Name: file.filename,
+        UnzippedLen: 0,
+    }
+
+    /* The flags and checksum must be consistent with the data */
+    file.lock.Lock()
+    raw.Flags = file.flags
+    raw.RawSum = file.dataSum()
+    raw.Checksum = checksumName(file.sumAlgorithm())
+    raw.Xattrs = copyXattrs(file.xattrs)
+    raw.ModTime = file.modTime()
+    raw.Generation = file.generation()
+    plaintext, err := f.unsealData(file)
+    file.lock.Unlock()
+    if err != nil {
+        return raw, err
+    }
+    if f.mem_cipher != nil {
+        /* openData() returned a transient plaintext copy */
+        defer wipeBuffer(plaintext, false)
+    }
+
+    /* Discards the contents of `out`, which may be derived from the plaintext */
+    reset := func () {
+        if f.mem_cipher != nil {
+            wipeBuffer(out.Bytes(), false)
+        }
+        out.Reset()
+    }
+
+    if (raw.Flags & FLAG_FILE) == 0 || len(plaintext) == 0 {
+        out.Write(plaintext)
+        return raw, nil
+    }
+    raw.UnzippedLen = len(plaintext)
+
+    if (flags & FLAG_COMPRESS_FILES) > 0 {
+        /* Small and high entropy files are not worth the CPU time */
+        raw.Compression = f.compressDecision(plaintext)
+    }
+
+    if raw.Compression == COMPRESS_APPLIED {
+        /* Only keep the compressed data if it is actually smaller */
+        smaller, err := compressInto(fileCodec, out, plaintext)
+        if err != nil {
+            reset()
+            return raw, err
+        }
+        if smaller == true {
+            raw.Flags |= FLAG_COMPRESS
+        } else {
+            reset()
+            raw.Compression = COMPRESS_SKIP_NO_GAIN
+        }
+    }
+    if (raw.Flags & FLAG_COMPRESS) == 0 {
+        out.Write(plaintext)
+    }
 
-        if err != nil || header == nil || header.Signature != FS_SIGNATURE {
+    /* Files in an "encrypted at rest" subtree are encrypted after compression */
+    if dir, policy := f.findPolicy(file.filename); policy != nil {
+        encrypted, err := policy.encrypt(out.Bytes())
+        reset()
+        if err != nil {
+            return raw, err
+        }
+        out.Write(encrypted)
+        raw.Flags |= FLAG_ENCRYPT
+        raw.Policy = dir
+    }
+
+    raw.StoredLen = out.Len()
+
+    return raw, nil
+}
+
+/*
+ * Reverses encodeFile(): decrypts and decompresses the stored data of a file, and
+ *  verifies its checksum
+ */
+func decodeFile(raw *RawFile, stored []byte, codec Codec, policies map[string]*EncryptionPolicy) ([]byte, error) {
+    var err error
+    if (raw.Flags & FLAG_ENCRYPT) > 0 {
+        policy := policies[raw.Policy]
+        if policy == nil {
+            return nil, retErrStr("No encryption policy supplied for subtree " + raw.Policy)
+        }
+
+        stored, err = policy.decrypt(stored)
+        if err != nil {
             return nil, err
         }
     }
 
+    var data []byte
+    if (raw.Flags & FLAG_COMPRESS) > 0 {
+        data, err = codec.Decompress(stored)
+        if err != nil {
+            return nil, err
+        }
+    } else {
+        data = make([]byte, raw.UnzippedLen)
+        copy(data, stored)
+    }
+
+    /* Verifiy sums */
+    checksum := checksumByName(raw.Checksum)
+    if checksum == nil {
+        return nil, retErrStr("Unknown checksum " + raw.Checksum)
+    }
+    if sum := checksumOf(checksum, data); sum != raw.RawSum {
+        return nil, ErrChecksum
+    }
+
+    return data, nil
+}
+
+/*
+ * Decodes the rawStreamHeader at the beginning of `p`, and checks its signature
+ */
+func decodeStreamHeader(p *bytes.Buffer, config *DBConfig) (*rawStreamHeader, error) {
+    output := new(rawStreamHeader)
+
+    d := gob.NewDecoder(p)
+    if err := d.Decode(output); err != nil {
+        return nil, err
+    }
+    if output.Signature != config.signature() {
+        return nil, ErrSignature
+    }
+
+    return output, nil
+}
+
+func loadHeader(data []byte, scoped bool, filename string, config *DBConfig, report *FsckReport) (*FSHeader, error) {
+    ptr := bytes.NewBuffer(data) /* raw file stream */
+
+    /* The RawFile headers and the stored data are interleaved, unless the stream is scoped */
+    var stored = ptr
+    var unseal func ([]byte) ([]byte, error)
+    if scoped == true {
+        var err error
+        if ptr, stored, unseal, err = decodeScoped(data, config); err != nil {
+            return nil, err
+        }
+    }
+
+    var codec Codec = CodecGzip
+    var dictionary []byte
+    var audit []AuditEntry
+    var volumes map[string][]byte
+    var labels map[string]string
+    var fileCount uint = 0
+    if REMOVE_FS_HEADER != true {
+        header, err := decodeStreamHeader(ptr, config)
+        if err != nil {
+            return nil, err
+        }
+
+        if codec = codecByName(header.Codec); codec == nil {
+            return nil, retErrStr("Unknown compression codec " + header.Codec)
+        }
+
+        if header.Dictionary != nil {
+            dictCodec := &zstdCodec{ dict: header.Dictionary }
+            if err := dictCodec.setup(); err != nil {
+                return nil, err
+            }
+            codec = dictCodec
+            dictionary = header.Dictionary
+        }
+        audit = header.Audit
+        volumes = header.Volumes
+        labels = header.Labels
+        fileCount = header.FileCount
+    }
+
     output := &FSHeader{
         filename: filename,
-        meta:     make(map[string]*govfsFile),
+        meta:     newMetaTable(),
+    }
+    if dictionary != nil {
+        /* Keep using the dictionary on subsequent commits */
+        output.dictionary = dictionary
+        output.dict_codec = codec
     }
-    output.meta[s("/")] = new(govfsFile)
-    output.meta[s("/")].filename = "/"
+    output.setAudit(audit)
+    output.volumes.set(volumes)
+    output.labels.set(labels)
+    output.meta.set("/", &govfsFile{ filename: "/" })
+
+    output.comp_stats = newCompressionStats(codec.Name())
 
-    /* Enumerate files */
+    /* Enumerate files, their data is decoded afterwards by decodeLoaded() */
+    var loaded []loadedFile
+    var entries int
     for {
-        if ptr.Len() == 0 {
+        padErr := skipRecordPad(ptr)
+        if padErr == nil && ptr.Len() == 0 {
             break
         }
 
         fileHeader, err := func (p *bytes.Buffer) (*RawFile, error) {
+            if padErr != nil {
+                return nil, padErr
+            }
             output := &RawFile{}
 
             d := gob.NewDecoder(p)
@@ -679,60 +1827,152 @@ func loadHeader(data []byte, filename string) (*FSHeader, error) {
                 return nil, err
             }
 
-            for i := STREAM_PAD_LEN; i != 0; i -= 1 {
-                p.UnreadByte()
-            }
-
             return output, nil
         } (ptr)
 
+        if err != nil && report != nil {
+            report.add("", retErrStr("Stream is corrupt after " + strconv.Itoa(int(report.Files)) + " files: " +
+                err.Error()))
+            break
+        }
         if err != nil {
             return nil, err
         }
 
-        output.meta[s(fileHeader.Name)] = &govfsFile{
+        if fileHeader.Name != "/" {
+            entries += 1
+            output.comp_stats.add(fileHeader, codec.Name())
+            if report != nil {
+                report.Files += 1
+            }
+        }
+
+        /* FLAG_COMPRESS/FLAG_ENCRYPT on a file describe the stored data only */
+        var fileFlags = fileHeader.Flags
+        if (fileFlags & FLAG_FILE) > 0 {
+            fileFlags &^= FLAG_COMPRESS | FLAG_ENCRYPT
+        }
+
+        file := &govfsFile{
             filename: fileHeader.Name,
-            flags: fileHeader.Flags,
+            flags: fileFlags,
             data: nil,
-            datasum: "",
+            modtime: unixNano(fileHeader.ModTime),
+            xattrs: fileHeader.Xattrs,
         }
+        output.meta.set(fileHeader.Name, file)
 
-        //output.meta[s(file_hdr.Name)].data = make([]byte, decompressed_len)
         if fileHeader.UnzippedLen > 0 {
-            output.meta[s(fileHeader.Name)].datasum = fileHeader.RawSum
-
-            var rawFileData = make([]byte, fileHeader.UnzippedLen)
-            ptr.Read(rawFileData)
+            file.setSum(fileHeader.RawSum, checksumByName(fileHeader.Checksum))
+            file.setGeneration(fileHeader.Generation)
 
-            if (fileHeader.Flags & FLAG_COMPRESS) > 0 {
-                var streamStatus error = nil
-                output.meta[s(fileHeader.Name)].data, streamStatus = util.DecompressStream(rawFileData)
-                if streamStatus != nil {
-                    return nil, err
-                }
-                output.t_size = len(output.meta[s(fileHeader.Name)].data)
-            } else {
-                output.meta[s(fileHeader.Name)].data = make([]byte, fileHeader.UnzippedLen)
-                copy(output.meta[s(fileHeader.Name)].data, rawFileData)
-                output.t_size += fileHeader.UnzippedLen
+            var storedLen = fileHeader.StoredLen
+            if storedLen == 0 {
+                storedLen = fileHeader.UnzippedLen
             }
 
-            /* Verifiy sums */
-            if sum := s(string(output.meta[s(fileHeader.Name)].data)); sum != output.meta[s(fileHeader.Name)].datasum {
-                return nil, util.RetErrStr("Invalid file sum")
+            var rawFileData = make([]byte, storedLen)
+            if n, _ := stored.Read(rawFileData); n < storedLen && report != nil {
+                loaded = append(loaded, loadedFile{ file: file, err: retErrStr("Stream is truncated") })
+                break
             }
+            loaded = append(loaded, loadedFile{ file: file, raw: fileHeader, stored: rawFileData })
         }
     }
 
+    var total int64
+    for i := range loaded {
+        if loaded[i].raw != nil {
+            total += int64(loaded[i].raw.UnzippedLen)
+        }
+    }
+    progress := newProgress(config.Progress, LOG_LOAD, filename, entries, total)
+    progress.add(entries - len(loaded), 0) /* Directories and empty files have nothing to decode */
+    decodeLoaded(loaded, codec, config.Policies, unseal, progress)
+    progress.done()
+
+    for i := range loaded {
+        l := &loaded[i]
+        if l.err != nil && report != nil {
+            report.add(l.file.filename, l.err)
+            output.meta.remove(l.file.filename)
+            continue
+        }
+        if l.err != nil {
+            return nil, l.err
+        }
+        l.file.data, l.file.size = l.data, len(l.data)
+        if report != nil {
+            report.Bytes += l.file.size
+        }
+    }
+
+    if report != nil && REMOVE_FS_HEADER != true && report.Files != fileCount {
+        report.add("", retErrStr("Stream holds " + strconv.Itoa(int(report.Files)) + " files, its header " +
+            strconv.Itoa(int(fileCount))))
+    }
+
+    output.setCompressionStats(output.comp_stats)
+    output.usage.rebuild(output.files())
+
     return output, nil
 }
 
+/*
+ * A file enumerated by loadHeader() whose data is yet to be decoded
+ */
+type loadedFile struct {
+    file        *govfsFile
+    raw         *RawFile
+    stored      []byte
+    data        []byte
+    err         error /* Set before decoding if the stream is truncated */
+}
+
+/*
+ * Decrypts, decompresses and verifies the data of the loaded files on at most GOMAXPROCS
+ *  workers. `unseal`, if not nil, first decrypts the data of a scoped stream
+ */
+func decodeLoaded(loaded []loadedFile, codec Codec, policies map[string]*EncryptionPolicy,
+    unseal func ([]byte) ([]byte, error), progress *progressTracker) {
+    workers := runtime.GOMAXPROCS(0)
+    if workers > len(loaded) {
+        workers = len(loaded)
+    }
+
+    var next int64 = -1
+    var wg sync.WaitGroup
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func () {
+            defer wg.Done()
+            for {
+                n := int(atomic.AddInt64(&next, 1))
+                if n >= len(loaded) {
+                    return
+                }
+
+                l := &loaded[n]
+                if l.err == nil && unseal != nil {
+                    l.stored, l.err = unseal(l.stored)
+                }
+                if l.err == nil {
+                    l.data, l.err = decodeFile(l.raw, l.stored, codec, policies)
+                    progress.add(1, int64(l.raw.UnzippedLen))
+                }
+                l.stored = nil
+            }
+        }()
+    }
+    wg.Wait()
+}
+
 /*
  * Generate the key used to encrypt/decrypt the raw fs table. The key is composed of the
  *  MD5 sum of the hostname + the FS_SIGNATURE string
  */
 func getFsKey() []byte {
-    host, _ := os.Hostname()
+    host := hostname()
     host += FS_SIGNATURE
 
     sum := md5.Sum([]byte(host))
@@ -742,82 +1982,167 @@ func getFsKey() []byte {
 }
 
 /*
- * Decrypts the raw fs stream from a filename, decompresses it, and returns a vector composed of the
- *  serialized fs table. Since no FSHeader exists yet, this method will not be apart of that
- *  structure, as per design choice
+ * Returns a copy of the key used for the raw fs table, which the caller must ZeroKey() after use
  */
-func readFsStream(name string, flags FlagVal) ([]byte, error) {
-    if _, err := os.Stat(name); os.IsNotExist(err) {
-        return nil, err
+func (c *DBConfig) fsKey() []byte {
+    if c.Key == nil {
+        return getFsKey()
+    }
+
+    output := make([]byte, len(c.Key))
+    copy(output, c.Key)
+    return output
+}
+
+/*
+ * Decrypts the raw fs stream from the StorageBackend, decompresses it, and returns a vector composed of the
+ *  serialized fs table, and whether it is a scoped stream whose parts are decoded by decodeScoped().
+ *  Since no FSHeader exists yet, this method will not be apart of that structure, as per design choice
+ */
+func readFsStream(name string, flags FlagVal, config *DBConfig) ([]byte, bool, error) {
+    table, layout, err := readStreamLayout(name, flags, config)
+    return table, layout.scoped, err
+}
+
+/*
+ * How a raw fs stream was found to be encoded by readStreamLayout()
+ */
+type streamLayout struct {
+    scoped      bool
+    envelope    bool /* Legacy streams have none */
+    encrypted   bool /* As a whole */
+    compressed  bool /* As a whole */
+}
+
+/*
+ * Same as readFsStream(), but returns the layout of the stream
+ */
+func readStreamLayout(name string, flags FlagVal, config *DBConfig) ([]byte, streamLayout, error) {
+    var layout streamLayout
+    storage, name := config.storage(name)
+    if _, err := storage.Open(name); os.IsNotExist(err) {
+        return nil, layout, err
     }
 
-    raw_file, err := ioutil.ReadFile(name)
+    raw_file, err := storage.Read(name)
     if err != nil {
-        return nil, err
+        return nil, layout, err
+    }
+    if len(raw_file) == 0 {
+        return nil, layout, retErrStr("readFsStream: Raw fs stream is empty")
+    }
+    if raw_file, err = config.unmaskStream(raw_file); err != nil {
+        return nil, layout, err
+    }
+
+    /* Scoped streams are never encrypted as a whole, see scope.go */
+    scoped := bytes.HasPrefix(raw_file, []byte(SCOPED_STREAM_MAGIC))
+    layout.scoped = scoped
+    if scoped == true {
+        raw_file = raw_file[len(SCOPED_STREAM_MAGIC):]
     }
 
     var plaintext []byte
 
-    if (flags & FLAG_ENCRYPT) > 0 {
-        /* The crypto key is composed of the MD5 of the hostname + the FS_SIGNATURE */
-        key := getFsKey()
+    if (flags & FLAG_ENCRYPT) > 0 && scoped == false {
+        /* The crypto key is either supplied in the config, or the MD5 of the hostname + the FS_SIGNATURE */
+        key := config.fsKey()
 
-        plaintext, err = cryptog.RC4_Decrypt(raw_file, &key)
+        plaintext, err = config.Cipher.Decrypt(raw_file, key)
+        ZeroKey(key)
         if err != nil {
-            return nil, err
+            return nil, layout, err
         }
+        layout.encrypted = true
     } else {
         plaintext = make([]byte, len(raw_file))
         copy(plaintext, raw_file)
     }
 
+    /* Streams with an envelope describe themselves, legacy streams rely on the caller's flags */
+    var compressed = (flags & FLAG_COMPRESS) > 0 && scoped == false
+    if len(plaintext) >= 2 && plaintext[0] == STREAM_ENVELOPE_MAGIC {
+        layout.envelope = true
+        compressed = (plaintext[1] & STREAM_ENVELOPE_COMPRESSED) > 0
+        padded := (plaintext[1] & STREAM_ENVELOPE_PADDED) > 0
+        if plaintext = plaintext[2:]; padded == true {
+            if plaintext, err = unpadStream(plaintext); err != nil {
+                return nil, layout, err
+            }
+        }
+    }
+
     var decompressed []byte
+    layout.compressed = compressed
+
+    if compressed == true {
+        /* The stream codec is identified by its magic, fall back to the configured one */
+        codec := detectCodec(plaintext)
+        if codec == nil {
+            codec = config.Codec
+        }
 
-    if (flags & FLAG_COMPRESS) > 0 {
         var streamStatus error = nil
-        decompressed, streamStatus = util.DecompressStream(plaintext)
+        decompressed, streamStatus = codec.Decompress(plaintext)
         if streamStatus != nil {
-            return nil, streamStatus
+            return nil, layout, retErrStr("readFsStream: Failed to decompress fs stream (" + codec.Name() + "): " +
+                streamStatus.Error())
         }
     } else {
         decompressed = make([]byte, len(plaintext))
         copy(decompressed, plaintext)
     }
 
-    return decompressed, nil
+    return decompressed, layout, nil
 }
 
 /*
- * Takes in the serialized fs table, compresses it, encrypts it and writes it to the disk
+ * Takes in the serialized fs table, compresses it, encrypts it and writes it to the StorageBackend.
+ *  The table of a scoped stream is written as it is, see scope.go
  */
-func (f *FSHeader) writeFsStream(name string, data *bytes.Buffer, flags FlagVal) (uint, error) {
+func (f *FSHeader) writeFsStream(ctx context.Context, name string, data *bytes.Buffer, flags FlagVal) (uint, error) {
 
     var compressed = new(bytes.Buffer)
+    scoped := f.config.scoped()
 
-    if (flags & FLAG_COMPRESS) > 0 {
+    /* Compress first, encrypted data does not compress */
+    if (flags & FLAG_COMPRESS) > 0 && scoped == false {
         var (
             streamStatus    error = nil
             out             []byte
         )
-        out, streamStatus = util.CompressStream(data.Bytes())
+        out, streamStatus = f.config.Codec.Compress(data.Bytes())
         if streamStatus != nil {
             return 0, streamStatus
         }
 
+        compressed.Write([]byte{ STREAM_ENVELOPE_MAGIC, STREAM_ENVELOPE_COMPRESSED })
         compressed.Write(out)
     } else {
+        compressed.Write([]byte{ STREAM_ENVELOPE_MAGIC, 0 })
         compressed.Write(data.Bytes())
     }
 
+    if f.config.PadSize > 0 {
+        if err := padStream(compressed, f.config.PadSize); err != nil {
+            return 0, err
+        }
+    }
+
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+
     var ciphertext []byte
 
-    if (flags & FLAG_ENCRYPT) > 0 {
-        /* The crypto key will be the MD5 of the hostname string + the FS_SIGNATURE string */
-        key := getFsKey()
+    if (flags & FLAG_ENCRYPT) > 0 && scoped == false {
+        /* The crypto key will be the configured key, or the MD5 of the hostname string + the FS_SIGNATURE string */
+        key := f.config.fsKey()
 
-        /* Perform RC4 encryption */
+        /* Perform encryption with the configured cipher (RC4 by default) */
         var err error
-        ciphertext, err = cryptog.RC4_Encrypt(compressed.Bytes(), &key)
+        ciphertext, err = f.config.Cipher.Encrypt(compressed.Bytes(), key)
+        ZeroKey(key)
         if err != nil {
             return 0, err
         }
@@ -825,45 +2150,75 @@ func (f *FSHeader) writeFsStream(name string, data *bytes.Buffer, flags FlagVal)
         ciphertext = make([]byte, compressed.Len())
         copy(ciphertext, compressed.Bytes())
     }
+    if scoped == true {
+        ciphertext = append([]byte(SCOPED_STREAM_MAGIC), ciphertext...)
+    }
 
-    if _, err := os.Stat(name); os.IsExist(err) {
-        os.Remove(name)
+    storage, name := f.config.storage(name)
+    if f.config.VolumeSize > 0 {
+        /* Shares the file with another volume, see hidden.go */
+        atomic.StoreInt32(&f.wipe_stale, 0)
+        return f.writeVolume(storage, name, ciphertext)
     }
 
-    file, err := os.Create(name)
+    ciphertext, err := f.config.maskStream(ciphertext)
     if err != nil {
         return 0, err
     }
-    defer file.Close()
 
-    written, err := file.Write(ciphertext)
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+
+    /* Shredded files may still be present in the previous raw fs file, which is destroyed */
+    wipe := atomic.SwapInt32(&f.wipe_stale, 0) == 1
+    if w, ok := storage.(wipingStorage); ok == true && wipe == true {
+        err = w.writeWipe(ctx, name, ciphertext)
+    } else {
+        if wipe == true {
+            /* The backend can only destroy the previous blob before the write */
+            if err := storage.Delete(name); err != nil && !os.IsNotExist(err) {
+                atomic.StoreInt32(&f.wipe_stale, 1)
+                return 0, err
+            }
+
+            /* There is nothing left to keep, the write must complete */
+            ctx = context.Background()
+        }
+
+        if c, ok := storage.(ContextStorage); ok == true {
+            err = c.WriteCtx(ctx, name, ciphertext)
+        } else {
+            err = storage.Write(name, ciphertext)
+        }
+    }
     if err != nil {
-        return uint(written), err
+        if wipe == true {
+            atomic.StoreInt32(&f.wipe_stale, 1)
+        }
+        return 0, err
     }
 
-    return uint(written), nil
+    return uint(len(ciphertext)), nil
 }
 
 func (f *FSHeader) GetFileCount() uint {
-    var total uint = 0
-    for range f.meta {
-        total += 1
-    }
-
-    return total
+    return f.meta.count()
 }
 
 /*
- * Retrieves the file listing in a specific directrory. NOTE: The
- *  `dir` parameter must contain a trailing "/"
+ * Retrieves the file listing in a specific directrory, and all of its subdirectories,
+ *  including the directory itself. Takes time in the size of the listing only. NOTE:
+ *  The `dir` parameter must contain a trailing "/"
  */
 func (f *FSHeader) GetFileListDirectory(dir string) ([]string, error) {
     var output []string
-    for _, v := range f.meta {
-        if strings.Contains(v.filename, dir) {
-            output = append(output, v.filename)
-        }
+    if f.checkDir(dir) == true {
+        output = append(output, dir)
     }
+    f.walk(dir, func (file *govfsFile) {
+        output = append(output, file.filename)
+    })
 
     if len(output) == 0 {
         return nil, nil
@@ -872,25 +2227,86 @@ func (f *FSHeader) GetFileListDirectory(dir string) ([]string, error) {
     return output, nil
 }
 
+/*
+ * True if `dir`, which has a trailing "/", is the root or an explicitly or implicitly
+ *  created directory
+ */
+func (f *FSHeader) checkDir(dir string) bool {
+    if dir == "/" {
+        return f.check(dir) != nil
+    }
+
+    for _, key := range []string{ dir, strings.TrimSuffix(dir, "/") } {
+        if file := f.check(key); file != nil && (file.flags & FLAG_DIRECTORY) > 0 {
+            return true
+        }
+    }
+
+    return false
+}
+
+/*
+ * Calls `fn` once for every file and directory beneath `dir`, which has a trailing "/".
+ *  Takes time in the size of the subtree only
+ */
+func (f *FSHeader) walk(dir string, fn func (file *govfsFile)) {
+    seen := make(map[string]bool)
+    pending := []string{ dir }
+    for len(pending) > 0 {
+        next := pending[len(pending) - 1]
+        pending = pending[:len(pending) - 1]
+
+        for _, file := range f.children(next) {
+            if seen[file.filename] == true {
+                continue /* A directory may be keyed twice, see dispatch() */
+            }
+            seen[file.filename] = true
+
+            fn(file)
+            if (file.flags & FLAG_DIRECTORY) > 0 {
+                pending = append(pending, file.filename)
+            }
+        }
+    }
+}
+
+/*
+ * Returns the files and directories directly beneath `dir`, which has a trailing "/".
+ *  A directory may be returned twice, see dispatch()
+ */
+func (f *FSHeader) children(dir string) []*govfsFile {
+    return f.meta.list(dir)
+}
+
 func (f *FSHeader) GetFileSize(name string) (uint, error) {
+    if err := f.syncPath(name); err != nil {
+        return 0, err
+    }
+
     file := f.check(name)
     if file == nil {
-        return 0, util.RetErrStr("GetFileSize: File does not exist")
+        return 0, pathError("stat", name, ErrNotExist)
     }
 
-    return uint(len(file.data)), nil
+    file.lock.Lock()
+    defer file.lock.Unlock()
+
+    return uint(file.size), nil
 }
 
 func (f *FSHeader) GetTotalFilesizes() int {
-    return f.t_size
+    return f.usage.total()
 }
 
 func (f *FSHeader) GetFileList() []string {
     var output []string
 
-    for k := range f.meta {
-        file := f.meta[k]
-        if (file.flags & FLAG_DIRECTORY) > 0 {
+    for _, file := range f.files() {
+        file.lock.Lock()
+        flags := file.flags
+        file.lock.Unlock()
+
+        if (flags & FLAG_DIRECTORY) > 0 {
             output = append(output, "(DIR)  " + file.filename)
             continue
         }
@@ -900,6 +2316,14 @@ func (f *FSHeader) GetFileList() []string {
     return output
 }
 
+/*
+ * Returns a snapshot of all files and directories, so that callers do not need
+ *  to hold any lock while iterating
+ */
+func (f *FSHeader) files() []*govfsFile {
+    return f.meta.snapshot()
+}
+
 /* Returns an md5sum of a string */
 func s(name string) string {
     name_seeded := name + "gofs_magic"
@@ -29,7 +29,6 @@ import (
     "io"
     "bytes"
     "runtime"
-    "github.com/AlexRuzin/util"
     "strconv"
 )
 
@@ -41,7 +40,7 @@ func TestFSWriter(t *testing.T) {
      * This test will generate the raw fs stream file, along with some contents
      *  that will be later loaded by the TestFSReader() method
      */
-    util.DebugOut("[+] Running Standard I/O Sanity Test...")
+    debugOut("[+] Running Standard I/O Sanity Test...")
 
     /* Remove the test database if it exists */
     var filename = gen_raw_filename(FS_DATABASE_FILE)
@@ -56,13 +55,13 @@ func TestFSWriter(t *testing.T) {
     if err := header.StartIOController(); err != nil {
         drive_fail("TEST1.1: Failed to start IOController", t)
     }
-    util.DebugOut("[+] Test 1 PASS")
+    debugOut("[+] Test 1 PASS")
     
     // The root file "/" must at least exist
     if err := header.Create("/"); err == nil {
         drive_fail("TEST2: Failed to return root handle", t)
     }
-    util.DebugOut("[+] Test 2 PASS")
+    debugOut("[+] Test 2 PASS")
     
     /*
      * Try to delete the root file "/"
@@ -70,7 +69,7 @@ func TestFSWriter(t *testing.T) {
     if header.Delete("/") == nil {
         drive_fail("TEST3: Cannot delete root -- critical", t)
     }
-    util.DebugOut("[+] Test 3 PASS")
+    debugOut("[+] Test 3 PASS")
 
     /*
      * Attempt to write to a nonexistant file
@@ -79,7 +78,7 @@ func TestFSWriter(t *testing.T) {
     if header.Write("/folder5/folder5/file5", data) == nil {
         drive_fail("TEST4: Cannot write to a nonexistant file", t)
     }
-    util.DebugOut("[+] Test 4 PASS")
+    debugOut("[+] Test 4 PASS")
 
     /*
      * Create empty file file9
@@ -87,7 +86,7 @@ func TestFSWriter(t *testing.T) {
     if err := header.Create("/folder5/folder4/folder2/file9"); err != nil {
         drive_fail("TEST4.1: file9 cannot be created", t)
     }
-    util.DebugOut("[+] Test 4.1 PASS")
+    debugOut("[+] Test 4.1 PASS")
 
     /*
      * Attempt to create a new file0
@@ -95,7 +94,7 @@ func TestFSWriter(t *testing.T) {
     if err := header.Create("/folder0/folder0/file0"); err != nil {
         drive_fail("TEST5.0: file0 cannot be created", t)
     }
-    util.DebugOut("[+] Test 5.0 PASS")
+    debugOut("[+] Test 5.0 PASS")
 
     /*
      * Attempt to create a new file0, this will fail since it should already exist
@@ -103,7 +102,7 @@ func TestFSWriter(t *testing.T) {
     if err := header.Create("/folder0/folder0/file0"); err == nil {
         drive_fail("TEST5.1: file0 cannot be created twice", t)
     }
-    util.DebugOut("[+] Test 5.1 PASS")
+    debugOut("[+] Test 5.1 PASS")
 
     
     /*
@@ -113,7 +112,7 @@ func TestFSWriter(t *testing.T) {
     if header.Write("/folder0/folder0/file0", data) != nil {
         drive_fail("TEST6: Failed to write data in file0", t)
     }
-    util.DebugOut("[+] Test 6 PASS")
+    debugOut("[+] Test 6 PASS")
 
     /*
      * Check that the size of file0 is 4
@@ -121,7 +120,7 @@ func TestFSWriter(t *testing.T) {
     if k, _ := header.GetFileSize("/folder0/folder0/file0"); k != uint(len(data)) {
         drive_fail("TEST6.1: The size of data does not match", t)
     }
-    util.DebugOut("[+] Test 6.1 PASS")
+    debugOut("[+] Test 6.1 PASS")
     
     /*
      * Attempt to create a new file3
@@ -129,7 +128,7 @@ func TestFSWriter(t *testing.T) {
     if err := header.Create("/folder1/folder0/file3"); err != nil {
         drive_fail("TEST7: file3 cannot be created", t)
     }
-    util.DebugOut("[+] Test 7 PASS")
+    debugOut("[+] Test 7 PASS")
     
     /*
      * Write some data into file3
@@ -138,7 +137,7 @@ func TestFSWriter(t *testing.T) {
     if header.Write("/folder1/folder0/file3", data2) != nil {
         drive_fail("TEST8: Failed to write data in file3", t)
     }
-    util.DebugOut("[+] Test 8 PASS")
+    debugOut("[+] Test 8 PASS")
 
     /*
      * Write some data into file3
@@ -146,25 +145,25 @@ func TestFSWriter(t *testing.T) {
     if header.Write("/folder1/folder0/file3", data2) != nil {
         drive_fail("TEST8.1: Failed to write data in file3", t)
     }
-    util.DebugOut("[+] Test 8.1 PASS")
+    debugOut("[+] Test 8.1 PASS")
     
     /*
      * Read the written data from file0 and compare
      */
     output_data, _ := header.Read("/folder0/folder0/file0")
-    if output_data == nil || len(output_data) != len(data) || header.t_size - 7 /* len(file3) */ != len(data) {
+    if output_data == nil || len(output_data) != len(data) || header.GetTotalFilesizes() - 7 /* len(file3) */ != len(data) {
         drive_fail("TEST9: Failed to read data from file0", t)
     }
-    util.DebugOut("[+] Test 9 PASS")
+    debugOut("[+] Test 9 PASS")
     
     /*
      * Read the written data from file3 and compare
      */
     output_data, _ = header.Read("/folder1/folder0/file3")
-    if output_data == nil || len(output_data) != len(data2) || header.t_size - 4 /* len(file0) */ != len(data2) {
+    if output_data == nil || len(output_data) != len(data2) || header.GetTotalFilesizes() - 4 /* len(file0) */ != len(data2) {
         drive_fail("TEST10: Failed to read data from file3", t)
     }
-    util.DebugOut("[+] Test 10 PASS")
+    debugOut("[+] Test 10 PASS")
 
     /* Test GetFileListDirectory */
     fileEnum, err := header.GetFileListDirectory("/folder1/")
@@ -172,7 +171,7 @@ func TestFSWriter(t *testing.T) {
         drive_fail("TEST10.1: Failed to retrieve file listing", t)
     }
     for _, v := range fileEnum {
-        util.DebugOut(v)
+        debugOut(v)
     }
 
     /*
@@ -182,7 +181,7 @@ func TestFSWriter(t *testing.T) {
     if header.Write("/folder0/folder0/file0", data) != nil {
         drive_fail("TEST11: Failed to write data in file1", t)
     }   
-    util.DebugOut("[+] Test 11 PASS")
+    debugOut("[+] Test 11 PASS")
     
     /*
      * Read the new data from file0
@@ -191,7 +190,7 @@ func TestFSWriter(t *testing.T) {
     if output_data == nil || len(output_data) != len(data) {
         drive_fail("TEST12: Failed to read data from file1", t)
     }
-    util.DebugOut("[+] Test 12 PASS")
+    debugOut("[+] Test 12 PASS")
 
     /*
      * Attempt to create a new file5. This will be a blank file
@@ -199,7 +198,7 @@ func TestFSWriter(t *testing.T) {
     if err := header.Create("/folder2/file7"); err != nil {
         drive_fail("TEST13: file3 cannot be created", t)
     }
-    util.DebugOut("[+] Test 13 PASS")
+    debugOut("[+] Test 13 PASS")
     
     /*
      * Delete file0 -- complete this
@@ -212,7 +211,7 @@ func TestFSWriter(t *testing.T) {
     if err := header.Create("/folder2/file5/"); err != nil {
         drive_fail("TEST15: folder file5 cannot be created", t)
     }
-    util.DebugOut("[+] Test 15 PASS")
+    debugOut("[+] Test 15 PASS")
 
     /*
      * Tests the Reader interface
@@ -234,7 +233,7 @@ func TestFSWriter(t *testing.T) {
     if data_read != 1 || err != nil || file0data[0] != 1 {
         drive_fail("TEST15.3: Invalid Reader interface behaviour", t)
     }
-    util.DebugOut("[+] Test 15.1, 15.2, 15.3 PASS -- Reader interface")
+    debugOut("[+] Test 15.1, 15.2, 15.3 PASS -- Reader interface")
 
     /*
      * Tests the Writer interface
@@ -255,14 +254,14 @@ func TestFSWriter(t *testing.T) {
     if data_read != 8 || err != io.EOF || file0data[0] != 1 || file0data[1] != 2 {
         drive_fail("TEST15.5: Invalid Reader data",t )
     }
-    util.DebugOut("[+] Test 15.4, 15.5 PASS -- Writer interface")
+    debugOut("[+] Test 15.4, 15.5 PASS -- Writer interface")
 
     /*
      * Print out files
      */
     file_list := header.GetFileList()
     for _, e := range file_list {
-        util.DebugOut(e)
+        debugOut(e)
     }
 
     /*
@@ -271,8 +270,8 @@ func TestFSWriter(t *testing.T) {
     if err := header.UnmountDB(0 /*FLAG_COMPRESS_FILES*/); err != nil {
         drive_fail("TEST16: Failed to commit database", t)
     }
-    util.DebugOut("[+] Test 16 PASS. Raw FS stream written to: " + header.filename)
-    util.DebugOut("Total File Content Size: " + strconv.Itoa(header.GetTotalFilesizes()))
+    debugOut("[+] Test 16 PASS. Raw FS stream written to: " + header.filename)
+    debugOut("Total File Content Size: " + strconv.Itoa(header.GetTotalFilesizes()))
 
     time.Sleep(10000)
 }
@@ -282,7 +281,7 @@ func TestFSReader(t *testing.T) {
      * Read in FS_DATABASE_FILE and do basic tests
      */
     var filename = gen_raw_filename(FS_DATABASE_FILE)
-    util.DebugOut("[+] Loading Raw FS stream file: " + filename)
+    debugOut("[+] Loading Raw FS stream file: " + filename)
 
     /* Remove the test database if it exists */
     if _, err := os.Stat(filename); os.IsNotExist(err) {
@@ -297,7 +296,7 @@ func TestFSReader(t *testing.T) {
     if err := header.StartIOController(); err != nil {
         drive_fail("TEST1.1: Failed to start IOController", t)
     }
-    util.DebugOut("[+] Test 1 PASS (Loaded FS stream)")
+    debugOut("[+] Test 1 PASS (Loaded FS stream)")
 
     /*
      * Tests the Writer interface
@@ -316,17 +315,55 @@ func TestFSReader(t *testing.T) {
     if written != len(file0data) || err != io.EOF {
         drive_fail("TEST2.3: Invalid Writer response", t)
     }
-    util.DebugOut("[+] Test 2 PASS")
+    debugOut("[+] Test 2 PASS")
 
     /*
      * Print out files
      */
     file_list := header.GetFileList()
     for _, e := range file_list {
-        util.DebugOut(e)
+        debugOut(e)
     }
 
-    util.DebugOut("Total File Content Size: " + strconv.Itoa(int(header.GetTotalFilesizes())))
+    debugOut("Total File Content Size: " + strconv.Itoa(int(header.GetTotalFilesizes())))
+}
+
+func TestLoadMany(t *testing.T) {
+    debugOut("[+] Running Parallel Load Test...")
+
+    var filename = gen_raw_filename("load_many")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE | FLAG_ENCRYPT)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    for i := 0; i < 500; i++ {
+        name := "/dir" + strconv.Itoa(i % 7) + "/file" + strconv.Itoa(i)
+        header.Create(name)
+        header.Write(name, bytes.Repeat([]byte(name), i + 1))
+    }
+    if err := header.UnmountDB(FLAG_COMPRESS_FILES); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+    header.Close()
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD | FLAG_ENCRYPT)
+    if loaded == nil || err != nil {
+        drive_fail("TEST3: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+    for i := 0; i < 500; i++ {
+        name := "/dir" + strconv.Itoa(i % 7) + "/file" + strconv.Itoa(i)
+        if data, err := loaded.Read(name); err != nil || !bytes.Equal(data, bytes.Repeat([]byte(name), i + 1)) {
+            drive_fail("TEST4: Invalid contents of " + name, t)
+        }
+    }
+
+    debugOut("[+] Parallel Load Test PASS")
 }
 
 func gen_raw_filename(suffix string) string {
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "math"
+)
+
+/*
+ * Compression heuristics for FLAG_COMPRESS_FILES. Files below a size threshold
+ *  are stored as-is, as are files whose sampled Shannon entropy indicates that they
+ *  are already compressed or encrypted (JPEG, zip, media). The decision is recorded
+ *  in RawFile.Compression.
+ */
+const COMPRESS_MIN_SIZE       int       = 256
+const COMPRESS_MAX_ENTROPY    float64   = 7.5               /* bits per byte, 8.0 is random data */
+const COMPRESS_SAMPLE_SIZE    int       = 4096              /* Bytes sampled at each of the start, middle and end of a file */
+
+/* Values of RawFile.Compression */
+const (
+    COMPRESS_NONE             string    = ""                /* FLAG_COMPRESS_FILES was not requested */
+    COMPRESS_APPLIED          string    = "compressed"
+    COMPRESS_SKIP_SMALL       string    = "small"
+    COMPRESS_SKIP_ENTROPY     string    = "entropy"
+    COMPRESS_SKIP_NO_GAIN     string    = "no_gain"         /* Compressed output was not smaller */
+)
+
+func (f *FSHeader) compressDecision(data []byte) string {
+    var minSize = f.config.CompressMinSize
+    if minSize == 0 {
+        minSize = COMPRESS_MIN_SIZE
+    }
+    if minSize > 0 && len(data) < minSize {
+        return COMPRESS_SKIP_SMALL
+    }
+
+    var maxEntropy = f.config.CompressMaxEntropy
+    if maxEntropy == 0 {
+        maxEntropy = COMPRESS_MAX_ENTROPY
+    }
+    if sampleEntropy(data) > maxEntropy {
+        return COMPRESS_SKIP_ENTROPY
+    }
+
+    return COMPRESS_APPLIED
+}
+
+/*
+ * Estimates the entropy of `data` in bits per byte from up to three samples
+ */
+func sampleEntropy(data []byte) float64 {
+    var counts [256]int
+    var total int
+
+    sample := func (block []byte) {
+        for _, b := range block {
+            counts[b] += 1
+        }
+        total += len(block)
+    }
+
+    if len(data) <= COMPRESS_SAMPLE_SIZE * 3 {
+        sample(data)
+    } else {
+        middle := (len(data) - COMPRESS_SAMPLE_SIZE) / 2
+        sample(data[:COMPRESS_SAMPLE_SIZE])
+        sample(data[middle:middle + COMPRESS_SAMPLE_SIZE])
+        sample(data[len(data) - COMPRESS_SAMPLE_SIZE:])
+    }
+
+    if total == 0 {
+        return 0
+    }
+
+    var entropy float64
+    for _, c := range counts {
+        if c == 0 {
+            continue
+        }
+        p := float64(c) / float64(total)
+        entropy -= p * math.Log2(p)
+    }
+
+    return entropy
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+    "crypto/rand"
+)
+
+func TestCompressionHeuristics(t *testing.T) {
+    debugOut("[+] Running Compression Heuristics Test...")
+
+    var filename = gen_raw_filename("test_heuristics")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    random := make([]byte, 64 * 1024)
+    rand.Read(random)
+    text := bytes.Repeat([]byte("a very compressible line of text\n"), 1024)
+    small := []byte("tiny")
+
+    if d := header.compressDecision(small); d != COMPRESS_SKIP_SMALL {
+        drive_fail("TEST2: Small file was not skipped: " + d, t)
+    }
+    if d := header.compressDecision(random); d != COMPRESS_SKIP_ENTROPY {
+        drive_fail("TEST3: High entropy file was not skipped: " + d, t)
+    }
+    if d := header.compressDecision(text); d != COMPRESS_APPLIED {
+        drive_fail("TEST4: Compressible file was skipped: " + d, t)
+    }
+
+    header.config.CompressMinSize = -1
+    if d := header.compressDecision(small); d == COMPRESS_SKIP_SMALL {
+        drive_fail("TEST5: Size threshold could not be disabled", t)
+    }
+    header.config.CompressMinSize = 0
+
+    files := map[string][]byte{ "/random.jpg": random, "/text.log": text, "/small": small }
+    for name, data := range files {
+        header.Create(name)
+        header.Write(name, data)
+    }
+    if err := header.UnmountDB(FLAG_COMPRESS_FILES); err != nil {
+        drive_fail("TEST6: Failed to commit database", t)
+    }
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST7: Failed to load database", t)
+    }
+    for name, data := range files {
+        if output, _ := loaded.Read(name); !bytes.Equal(output, data) {
+            drive_fail("TEST8: Data mismatch after load for " + name, t)
+        }
+    }
+
+    debugOut("[+] Compression Heuristics Test PASS")
+}
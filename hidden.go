@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Hidden volumes. With DBConfig.VolumeSize, the raw fs file has that fixed size and
+ *  holds up to two independent databases, each masked with its own
+ *  DBConfig.SignatureKey (see signature.go): the outer volume from the beginning of
+ *  the file, and the hidden volume, created with DBConfig.Hidden, from its end. The
+ *  rest of the file is random, so that without a key a volume cannot be told apart
+ *  from free space, and nothing reveals whether a hidden volume exists.
+ *
+ * Loading tries both positions with the configured key, so key A opens the outer
+ *  (decoy) tree and key B the hidden one; the volume which was opened is the one that
+ *  is committed. Neither volume knows the extent of the other: the outer volume must
+ *  be kept small enough not to grow into the hidden one, which it would overwrite.
+ *
+ * Each volume is laid out as a VOLUME_HEADER_LENGTH header (nonce, keyed tag and the
+ *  masked length of the stream) followed by the masked stream; the hidden volume's
+ *  header is the last VOLUME_HEADER_LENGTH bytes of the file, preceded by its stream.
+ */
+
+import (
+    "io"
+    "os"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/binary"
+)
+
+const VOLUME_HEADER_LENGTH    int       = SIGNATURE_NONCE_LENGTH + SIGNATURE_TAG_LENGTH + 8
+
+/*
+ * Returns the tag of a volume header with `nonce`. Differs from signatureTag(), so a
+ *  volume is not mistaken for a masked stream
+ */
+func (c *DBConfig) volumeTag(nonce []byte) []byte {
+    mac := hmac.New(sha256.New, c.SignatureKey)
+    mac.Write(nonce)
+    mac.Write([]byte("govfs volume"))
+    mac.Write([]byte(c.signature()))
+
+    return mac.Sum(nil)[:SIGNATURE_TAG_LENGTH]
+}
+
+/*
+ * Returns the offsets of the header and the stream of the volume in `raw` which the key
+ *  opens, with ok set to false if there is none
+ */
+func (c *DBConfig) findVolume(raw []byte) (header int, stream int, length int, hidden bool, ok bool) {
+    for _, hidden := range []bool{ false, true } {
+        header := 0
+        if hidden == true {
+            header = len(raw) - VOLUME_HEADER_LENGTH
+        }
+        if header < 0 || len(raw) < VOLUME_HEADER_LENGTH {
+            continue
+        }
+
+        nonce := raw[header:header + SIGNATURE_NONCE_LENGTH]
+        tag := raw[header + SIGNATURE_NONCE_LENGTH:header + SIGNATURE_NONCE_LENGTH + SIGNATURE_TAG_LENGTH]
+        if hmac.Equal(tag, c.volumeTag(nonce)) == false {
+            continue
+        }
+
+        mask, err := c.signatureStream(nonce)
+        if err != nil {
+            return 0, 0, 0, false, false
+        }
+        var size [8]byte
+        mask.XORKeyStream(size[:], raw[header + VOLUME_HEADER_LENGTH - 8:header + VOLUME_HEADER_LENGTH])
+        length := binary.BigEndian.Uint64(size[:])
+        if length > uint64(len(raw) - VOLUME_HEADER_LENGTH) {
+            continue
+        }
+
+        stream := VOLUME_HEADER_LENGTH
+        if hidden == true {
+            stream = header - int(length)
+        }
+
+        return header, stream, int(length), hidden, true
+    }
+
+    return 0, 0, 0, false, false
+}
+
+/*
+ * Unmasks the stream of the volume in `raw` which the key opens, in place. Remembers
+ *  which volume was opened, and the size of the file, for the next commit
+ */
+func (c *DBConfig) openVolume(raw []byte) ([]byte, error) {
+    header, stream, length, hidden, ok := c.findVolume(raw)
+    if ok == false {
+        return nil, ErrSignature
+    }
+
+    mask, err := c.signatureStream(raw[header:header + SIGNATURE_NONCE_LENGTH])
+    if err != nil {
+        return nil, err
+    }
+    var size [8]byte
+    mask.XORKeyStream(size[:], size[:]) /* The length comes first in the key stream */
+    output := raw[stream:stream + length]
+    mask.XORKeyStream(output, output)
+
+    c.VolumeSize = len(raw)
+    c.Hidden = hidden
+
+    return output, nil
+}
+
+/*
+ * Writes `stream` as this database's volume of the raw fs file, keeping the rest of
+ *  the file. The previous extent of the volume is overwritten with random data first
+ */
+func (f *FSHeader) writeVolume(storage StorageBackend, name string, stream []byte) (uint, error) {
+    c := &f.config
+    size := c.VolumeSize
+    if VOLUME_HEADER_LENGTH + len(stream) > size {
+        return 0, retErrStr("Volume does not fit in VolumeSize")
+    }
+
+    raw, err := storage.Read(name)
+    if err != nil && !os.IsNotExist(err) {
+        return 0, err
+    }
+    if len(raw) != size {
+        raw = make([]byte, size)
+        if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+            return 0, err
+        }
+    } else if header, offset, length, hidden, ok := c.findVolume(raw); ok == true && hidden == c.Hidden {
+        /* Deleted files may be present in the previous extent -- destroy it */
+        if _, err := io.ReadFull(rand.Reader, raw[header:header + VOLUME_HEADER_LENGTH]); err != nil {
+            return 0, err
+        }
+        if _, err := io.ReadFull(rand.Reader, raw[offset:offset + length]); err != nil {
+            return 0, err
+        }
+    }
+
+    header, offset := 0, VOLUME_HEADER_LENGTH
+    if c.Hidden == true {
+        header = size - VOLUME_HEADER_LENGTH
+        offset = header - len(stream)
+    }
+
+    nonce := raw[header:header + SIGNATURE_NONCE_LENGTH]
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return 0, err
+    }
+    copy(raw[header + SIGNATURE_NONCE_LENGTH:], c.volumeTag(nonce))
+
+    mask, err := c.signatureStream(nonce)
+    if err != nil {
+        return 0, err
+    }
+    length := raw[header + VOLUME_HEADER_LENGTH - 8:header + VOLUME_HEADER_LENGTH]
+    binary.BigEndian.PutUint64(length, uint64(len(stream)))
+    mask.XORKeyStream(length, length)
+    mask.XORKeyStream(raw[offset:offset + len(stream)], stream)
+
+    if err := storage.Write(name, raw); err != nil {
+        return 0, err
+    }
+
+    return uint(len(raw)), nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "bytes"
+    "errors"
+    "testing"
+)
+
+func TestHiddenVolume(t *testing.T) {
+    debugOut("[+] Running Hidden Volume Test...")
+
+    var filename = gen_raw_filename("test_hidden")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    const size = 64 * 1024
+    outer := &DBConfig{ SignatureKey: []byte("outer key"), VolumeSize: size }
+    inner := &DBConfig{ SignatureKey: []byte("hidden key"), VolumeSize: size, Hidden: true }
+
+    commit := func (config *DBConfig, flags FlagVal, name string, data string) {
+        header, err := CreateDatabaseConfig(filename, flags, config)
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to open volume", t)
+        }
+        header.StartIOController()
+        header.Create(name)
+        header.Write(name, []byte(data))
+        if err := header.UnmountDB(0); err != nil {
+            drive_fail("TEST2: Failed to commit volume", t)
+        }
+    }
+    commit(outer, FLAG_DB_CREATE, "/decoy/file", "decoy contents")
+    commit(inner, FLAG_DB_CREATE, "/secret/file", "hidden contents")
+
+    raw, _ := os.ReadFile(filename)
+    if len(raw) != size {
+        drive_fail("TEST3: File does not have VolumeSize", t)
+    }
+    for _, s := range []string{ "decoy", "secret", "contents", FS_SIGNATURE } {
+        if bytes.Contains(raw, []byte(s)) {
+            drive_fail("TEST4: Volume file contains " + s, t)
+        }
+    }
+
+    /* Each key opens its own tree, without being told which volume it is */
+    check := func (key string, present string, absent string) {
+        header, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, &DBConfig{ SignatureKey: []byte(key) })
+        if header == nil || err != nil {
+            drive_fail("TEST5: Failed to load volume with " + key, t)
+        }
+        if header.check(present) == nil || header.check(absent) != nil {
+            drive_fail("TEST6: Unexpected tree with " + key, t)
+        }
+    }
+    check("outer key", "/decoy/file", "/secret/file")
+    check("hidden key", "/secret/file", "/decoy/file")
+
+    /* Committing the outer volume keeps the hidden one */
+    commit(&DBConfig{ SignatureKey: []byte("outer key") }, FLAG_DB_LOAD, "/decoy/other", "more decoy contents")
+    check("outer key", "/decoy/other", "/secret/file")
+    check("hidden key", "/secret/file", "/decoy/other")
+
+    for _, key := range []string{ "outer key", "hidden key" } {
+        if ok, err := IsDatabase(filename, 0, &DBConfig{ SignatureKey: []byte(key) }); ok != true || err != nil {
+            drive_fail("TEST7: Volume not detected with " + key, t)
+        }
+    }
+    wrong := &DBConfig{ SignatureKey: []byte("wrong key") }
+    if ok, _ := IsDatabase(filename, 0, wrong); ok != false {
+        drive_fail("TEST8: Volume detected with the wrong key", t)
+    }
+    if _, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, wrong); !errors.Is(err, ErrSignature) {
+        drive_fail("TEST9: Volume loaded with the wrong key", t)
+    }
+
+    /* A volume must fit */
+    header, _ := CreateDatabaseConfig(filename, FLAG_DB_LOAD, &DBConfig{ SignatureKey: []byte("outer key") })
+    header.StartIOController()
+    header.Create("/large")
+    header.Write("/large", make([]byte, size))
+    if err := header.UnmountDB(0); err == nil {
+        drive_fail("TEST10: Volume larger than VolumeSize was committed", t)
+    }
+    if _, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ VolumeSize: size }); err == nil {
+        drive_fail("TEST11: VolumeSize accepted without a SignatureKey", t)
+    }
+}
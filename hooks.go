@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Operation hooks. Every IRP dispatch() processes is passed to the Before function of
+ *  each hook, in the order they were added, and once it completed to every After
+ *  function. Before may veto the operation by returning an error, which is returned to
+ *  the caller as is, rewrite Operation.Path, or leave Annotations for the After hooks.
+ *
+ * Hooks run on the IO controller (or inline in DBConfig.Direct mode) and hold up every
+ *  other operation while they run; they must not call back into the database.
+ */
+
+import (
+    "strings"
+    "sync"
+)
+
+type Operation struct {
+    Op          string /* LOG_CREATE, LOG_WRITE, LOG_APPEND, LOG_DELETE, LOG_SHRED, LOG_PURGE or LOG_XATTR */
+    Path        string /* May be rewritten by Before, except for LOG_PURGE */
+    Data        []byte /* The data to write, or the value of the attribute. Must not be modified or kept */
+    Attr        string /* The name of the attribute of LOG_XATTR */
+    Principal   string /* See WithPrincipal() */
+    Annotations map[string]string
+}
+
+type Hook struct {
+    Before      func(op *Operation) error /* Optional */
+    After       func(op *Operation, err error) /* Optional, err is the result of the operation */
+}
+
+type hookList struct {
+    lock        sync.RWMutex
+    hooks       []*Hook
+}
+
+/*
+ * Adds a hook to those of DBConfig.Hooks. The returned function removes it again
+ */
+func (f *FSHeader) AddHook(h Hook) CancelFunc {
+    hook := &h
+
+    f.hooks.lock.Lock()
+    f.hooks.hooks = append(f.hooks.hooks[:len(f.hooks.hooks):len(f.hooks.hooks)], hook)
+    f.hooks.lock.Unlock()
+
+    return func () {
+        f.hooks.lock.Lock()
+        defer f.hooks.lock.Unlock()
+
+        for i, v := range f.hooks.hooks {
+            if v == hook {
+                f.hooks.hooks = append(f.hooks.hooks[:i:i], f.hooks.hooks[i + 1:]...)
+                return
+            }
+        }
+    }
+}
+
+func (f *FSHeader) initHooks() {
+    for i := range f.config.Hooks {
+        f.hooks.hooks = append(f.hooks.hooks, &f.config.Hooks[i])
+    }
+}
+
+/*
+ * Runs the Before hooks for an IRP, and applies a rewritten path. Returns the hooks
+ *  to run after it, nil if there are none. Every IRP of a read-only database fails
+ */
+func (f *FSHeader) beforeIRP(ioh *govfsIoBlock) ([]*Hook, *Operation, error) {
+    if f.config.ReadOnly == true {
+        return nil, nil, ErrReadOnly
+    }
+
+    f.hooks.lock.RLock()
+    hooks := f.hooks.hooks
+    f.hooks.lock.RUnlock()
+
+    op := irpOp(ioh)
+    if len(hooks) == 0 || op == "" {
+        return nil, nil, nil
+    }
+
+    operation := &Operation{
+        Op: op,
+        Path: ioh.name,
+        Data: ioh.data,
+        Attr: ioh.attr,
+        Principal: ioh.principal,
+        Annotations: make(map[string]string),
+    }
+    if ioh.operation == IRP_PURGE {
+        operation.Path = "/"
+    }
+
+    for _, h := range hooks {
+        if h.Before == nil {
+            continue
+        }
+        if err := h.Before(operation); err != nil {
+            return hooks, operation, err
+        }
+    }
+
+    if ioh.operation != IRP_PURGE && operation.Path != ioh.name {
+        if strings.HasPrefix(operation.Path, "/") == false || len(operation.Path) > MAX_FILENAME_LENGTH {
+            return hooks, operation, retErrStr("hook: Invalid rewritten path " + operation.Path)
+        }
+
+        ioh.name = operation.Path
+        ioh.file = nil
+    }
+
+    return hooks, operation, nil
+}
+
+/*
+ * While hooks are registered, IRP_WRITE, IRP_DELETE and IRP_XATTR are submitted for names
+ *  which do not exist, since a hook may rewrite them. Looks the file up once the hooks ran
+ */
+func (f *FSHeader) resolveIRP(ioh *govfsIoBlock) error {
+    if ioh.file != nil || (ioh.operation != IRP_WRITE && ioh.operation != IRP_DELETE && ioh.operation != IRP_XATTR) {
+        return nil
+    }
+
+    if ioh.file = f.check(ioh.name); ioh.file == nil {
+        return pathError(irpOp(ioh), ioh.name, ErrNotExist)
+    }
+
+    return nil
+}
+
+func (f *FSHeader) hasHooks() bool {
+    f.hooks.lock.RLock()
+    defer f.hooks.lock.RUnlock()
+
+    return len(f.hooks.hooks) > 0
+}
+
+func afterIRP(hooks []*Hook, operation *Operation, err error) {
+    for _, h := range hooks {
+        if h.After != nil {
+            h.After(operation, err)
+        }
+    }
+}
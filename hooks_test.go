@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+func TestHooks(t *testing.T) {
+    debugOut("[+] Running Operation Hooks Test...")
+
+    errQuota := errors.New("quota exceeded")
+    var after []string
+
+    quota := Hook{
+        Before: func (op *Operation) error {
+            if len(op.Data) > 4 {
+                return errQuota
+            }
+            op.Annotations["checked"] = "yes"
+            return nil
+        },
+        After: func (op *Operation, err error) {
+            var status = "ok"
+            if err != nil {
+                status = err.Error()
+            }
+            after = append(after, op.Op + " " + op.Path + " " + op.Annotations["checked"] + " " + status)
+        },
+    }
+
+    header, err := CreateDatabaseConfig("hooks", FLAG_DB_CREATE, &DBConfig{ Hooks: []Hook{ quota } })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/a")
+    if err := header.Write("/a", []byte("too long")); !errors.Is(err, errQuota) {
+        drive_fail("TEST2: Hook did not veto the write", t)
+    }
+    if data, _ := header.Read("/a"); len(data) != 0 {
+        drive_fail("TEST3: Vetoed write was applied", t)
+    }
+    if err := header.Write("/a", []byte("ok")); err != nil {
+        drive_fail("TEST4: Hook vetoed a valid write", t)
+    }
+    if strings.Join(after, ",") != "create /a yes ok,write /a  quota exceeded,write /a yes ok" {
+        drive_fail("TEST5: Unexpected After calls " + strings.Join(after, ","), t)
+    }
+
+    /* Rewriting paths */
+    remove := header.AddHook(Hook{
+        Before: func (op *Operation) error {
+            if strings.HasPrefix(op.Path, "/tmp/") {
+                op.Path = "/scratch/" + strings.TrimPrefix(op.Path, "/tmp/")
+            }
+            return nil
+        },
+    })
+    header.Create("/scratch/x")
+    header.Create("/tmp/y")
+    if header.Check("/scratch/y") == false || header.Check("/tmp/y") == true {
+        drive_fail("TEST6: Create was not rewritten", t)
+    }
+    if err := header.Write("/tmp/x", []byte("x")); err != nil {
+        drive_fail("TEST7: Write was not rewritten", t)
+    }
+
+    remove()
+    remove()
+    header.Create("/tmp/z")
+    if header.Check("/tmp/z") == false {
+        drive_fail("TEST8: Removed hook still ran", t)
+    }
+
+    debugOut("[+] Operation Hooks Test PASS")
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Copies of single files between the host and the database. Both directions stream the
+ *  contents in INGEST_CHUNK_SIZE chunks and compare the checksum of the copy, in the
+ *  algorithm of the file (see DBConfig.Checksum), to that of the source, failing with
+ *  ErrChecksum if they differ, e.g. because the source changed while it was copied.
+ *  A failed copy leaves nothing behind: CopyFromHost() deletes the file, CopyToHost()
+ *  writes a temporary file which only replaces hostPath once it was verified.
+ */
+
+import (
+    "io"
+    "os"
+    "hash"
+    "context"
+    "encoding/hex"
+    "path/filepath"
+)
+
+/*
+ * Creates the file `vfsPath` with the contents of the host file `hostPath`
+ */
+func (f *FSHeader) CopyFromHost(hostPath string, vfsPath string) (err error) {
+    src, err := os.Open(hostPath)
+    if err != nil {
+        return err
+    }
+    defer src.Close()
+
+    if info, err := src.Stat(); err != nil {
+        return err
+    } else if info.IsDir() == true {
+        return pathError("copy", hostPath, ErrIsDirectory)
+    }
+
+    if err := f.Create(vfsPath); err != nil {
+        return err
+    }
+    defer func () {
+        if err != nil {
+            f.Delete(vfsPath)
+        }
+    }()
+
+    sum := f.config.Checksum.New()
+    n, err := f.appendFrom(context.Background(), vfsPath, io.TeeReader(src, sum))
+    if err != nil {
+        return err
+    }
+
+    entry, err := f.Stat(vfsPath)
+    if err != nil {
+        return err
+    }
+    if int64(entry.Size) != n || (n > 0 && (entry.Algorithm != f.config.Checksum.Name() ||
+        entry.Checksum != hex.EncodeToString(sum.Sum(nil)))) {
+        return pathError("copy", vfsPath, ErrChecksum)
+    }
+
+    return nil
+}
+
+/*
+ * Writes the contents of the file `vfsPath` to the host file `hostPath`, replacing it
+ */
+func (f *FSHeader) CopyToHost(vfsPath string, hostPath string) (err error) {
+    entry, err := f.Stat(vfsPath)
+    if err != nil {
+        return err
+    }
+    if entry.Dir == true {
+        return pathError("copy", vfsPath, ErrIsDirectory)
+    }
+
+    var sum hash.Hash
+    if entry.Size > 0 {
+        algorithm := checksumByName(entry.Algorithm)
+        if algorithm == nil {
+            return pathError("copy", vfsPath, retErrStr("Unknown checksum " + entry.Algorithm))
+        }
+        sum = algorithm.New()
+    }
+
+    dst, err := os.CreateTemp(filepath.Dir(hostPath), filepath.Base(hostPath) + ".*.tmp")
+    if err != nil {
+        return err
+    }
+    defer func () {
+        if err != nil {
+            dst.Close()
+            os.Remove(dst.Name())
+        }
+    }()
+
+    for off := 0; off < entry.Size; off += INGEST_CHUNK_SIZE {
+        chunk, err := f.ReadRange(vfsPath, off, INGEST_CHUNK_SIZE)
+        if err != nil {
+            return err
+        }
+        if len(chunk) == 0 {
+            break /* Truncated since Stat() */
+        }
+        sum.Write(chunk)
+        if _, err := dst.Write(chunk); err != nil {
+            return err
+        }
+    }
+
+    if sum != nil && hex.EncodeToString(sum.Sum(nil)) != entry.Checksum {
+        return pathError("copy", vfsPath, ErrChecksum)
+    }
+
+    dst.Chmod(0644) /* Best effort, e.g. js/wasm does not support it */
+    if err = dst.Sync(); err != nil {
+        return err
+    }
+    if err = dst.Close(); err != nil {
+        return err
+    }
+
+    return os.Rename(dst.Name(), hostPath)
+}
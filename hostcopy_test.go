@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "bytes"
+    "errors"
+    "testing"
+    "path/filepath"
+)
+
+func TestHostCopy(t *testing.T) {
+    debugOut("[+] Running Host Copy Test...")
+
+    var filename = gen_raw_filename("test_host_copy")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    dir := t.TempDir()
+    data := bytes.Repeat([]byte("host copy "), INGEST_CHUNK_SIZE / 4)
+    src := filepath.Join(dir, "src.bin")
+    if err := os.WriteFile(src, data, 0644); err != nil {
+        drive_fail("TEST1: Failed to write the host file", t)
+    }
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST2: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    if err := header.CopyFromHost(src, "/imported"); err != nil {
+        drive_fail("TEST3: Failed to copy from the host", t)
+    }
+    if output, _ := header.Read("/imported"); !bytes.Equal(output, data) {
+        drive_fail("TEST4: Data mismatch after CopyFromHost", t)
+    }
+    if err := header.CopyFromHost(src, "/imported"); errors.Is(err, ErrExist) == false || header.Check("/imported") == false {
+        drive_fail("TEST5: Copied over an existing file", t)
+    }
+    if err := header.CopyFromHost(dir, "/dir"); errors.Is(err, ErrIsDirectory) == false {
+        drive_fail("TEST6: Copied a directory", t)
+    }
+
+    dst := filepath.Join(dir, "dst.bin")
+    os.WriteFile(dst, []byte("replaced"), 0644)
+    if err := header.CopyToHost("/imported", dst); err != nil {
+        drive_fail("TEST7: Failed to copy to the host", t)
+    }
+    if output, _ := os.ReadFile(dst); !bytes.Equal(output, data) {
+        drive_fail("TEST8: Data mismatch after CopyToHost", t)
+    }
+    if err := header.CopyToHost("/missing", dst); errors.Is(err, ErrNotExist) == false {
+        drive_fail("TEST9: Copied a missing file", t)
+    }
+
+    /* Empty files */
+    header.Create("/empty")
+    empty := filepath.Join(dir, "empty")
+    if err := header.CopyToHost("/empty", empty); err != nil {
+        drive_fail("TEST10: Failed to copy an empty file", t)
+    }
+    if err := header.CopyFromHost(empty, "/empty2"); err != nil || header.Check("/empty2") == false {
+        drive_fail("TEST11: Failed to copy an empty host file", t)
+    }
+
+    /* No temporary file is left behind */
+    entries, _ := os.ReadDir(dir)
+    for _, e := range entries {
+        if filepath.Ext(e.Name()) == ".tmp" {
+            drive_fail("TEST12: Temporary file was left behind", t)
+        }
+    }
+}
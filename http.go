@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "net/http"
+)
+
+/*
+ * Returns an http.FileSystem view of the database, for http.FileServer. Open files
+ *  support Seek, so Range requests work, and modification times are used for
+ *  Last-Modified and conditional requests.
+ */
+func (f *FSHeader) HTTPFileSystem() http.FileSystem {
+    return http.FS(f.FS())
+}
+
+/*
+ * http.FileServer of the database whose reads are checked for the principal of each
+ *  request's context, e.g. as attached by SessionHandler()
+ */
+func (f *FSHeader) FileServer() http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        http.FileServer(http.FS(f.FSCtx(r.Context()))).ServeHTTP(w, r)
+    })
+}
+
+/*
+ * Wraps h, e.g. FileServer() or a WebDAV handler, so that the operations of each request
+ *  are made as the principal returned by `principal`, see WithPrincipal(). Requests for
+ *  which it returns "" have none
+ */
+func SessionHandler(h http.Handler, principal func (r *http.Request) string) http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        if p := principal(r); p != "" {
+            r = r.WithContext(WithPrincipal(r.Context(), p))
+        }
+        h.ServeHTTP(w, r)
+    })
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "io"
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+)
+
+func TestHTTPFileSystem(t *testing.T) {
+    debugOut("[+] Running http.FileSystem Test...")
+
+    var filename = gen_raw_filename("test_http")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    media := bytes.Repeat([]byte("0123456789"), 1000)
+    header.Create("/media/clip.bin")
+    header.Write("/media/clip.bin", media)
+    header.Create("/site/index.html")
+    header.Write("/site/index.html", []byte("<html>index</html>"))
+
+    server := httptest.NewServer(http.FileServer(header.HTTPFileSystem()))
+    defer server.Close()
+
+    resp, err := http.Get(server.URL + "/site/")
+    if err != nil {
+        drive_fail("TEST2: GET failed", t)
+    }
+    body, _ := io.ReadAll(resp.Body)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || string(body) != "<html>index</html>" {
+        drive_fail("TEST3: index.html was not served", t)
+    }
+
+    req, _ := http.NewRequest("GET", server.URL + "/media/clip.bin", nil)
+    req.Header.Set("Range", "bytes=5000-5009")
+    resp, err = http.DefaultClient.Do(req)
+    if err != nil {
+        drive_fail("TEST4: Range request failed", t)
+    }
+    body, _ = io.ReadAll(resp.Body)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, media[5000:5010]) {
+        drive_fail("TEST5: Unexpected Range response", t)
+    }
+
+    lastModified := resp.Header.Get("Last-Modified")
+    if lastModified == "" {
+        drive_fail("TEST6: Last-Modified header is missing", t)
+    }
+    req, _ = http.NewRequest("GET", server.URL + "/media/clip.bin", nil)
+    req.Header.Set("If-Modified-Since", lastModified)
+    resp, err = http.DefaultClient.Do(req)
+    if err != nil {
+        drive_fail("TEST7: Conditional request failed", t)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusNotModified {
+        drive_fail("TEST8: Conditional request was not answered with 304", t)
+    }
+
+    resp, err = http.Get(server.URL + "/missing")
+    if err != nil {
+        drive_fail("TEST9: GET failed", t)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusNotFound {
+        drive_fail("TEST10: Missing file was not answered with 404", t)
+    }
+
+    debugOut("[+] http.FileSystem Test PASS")
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Stream ingestion. CreateFrom() creates a file and appends the contents of an io.Reader
+ *  to it in INGEST_CHUNK_SIZE chunks, each an IRP_WRITE of its own, so the source never
+ *  has to be read into memory as a whole before a Write().
+ */
+
+import (
+    "io"
+    "context"
+)
+
+const INGEST_CHUNK_SIZE       int       = 256 * 1024
+
+/*
+ * Creates the file `name` with the contents of `r`, and returns the number of bytes
+ *  read from it. On an error the file keeps the data written until then
+ */
+func (f *FSHeader) CreateFrom(name string, r io.Reader) (int64, error) {
+    return f.CreateFromCtx(context.Background(), name, r)
+}
+
+/*
+ * CreateFrom() which gives up once ctx is done, between two chunks
+ */
+func (f *FSHeader) CreateFromCtx(ctx context.Context, name string, r io.Reader) (n int64, err error) {
+    if err := f.CreateCtx(ctx, name); err != nil {
+        return 0, err
+    }
+
+    return f.appendFrom(ctx, name, r)
+}
+
+/*
+ * Appends the contents of `r` to the file `name` in INGEST_CHUNK_SIZE chunks
+ */
+func (f *FSHeader) appendFrom(ctx context.Context, name string, r io.Reader) (n int64, err error) {
+    chunk := make([]byte, INGEST_CHUNK_SIZE)
+    for {
+        read, rerr := io.ReadFull(r, chunk)
+        if read > 0 {
+            if err := f.AppendCtx(ctx, name, chunk[:read]); err != nil {
+                return n, err
+            }
+            n += int64(read)
+        }
+
+        if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+            return n, nil
+        }
+        if rerr != nil {
+            return n, rerr
+        }
+    }
+}
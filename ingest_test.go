@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "io"
+    "os"
+    "bytes"
+    "errors"
+    "context"
+    "testing"
+)
+
+/*
+ * Fails after `limit` bytes
+ */
+type failingReader struct {
+    data        []byte
+    limit       int
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+    if r.limit == 0 {
+        return 0, io.ErrClosedPipe
+    }
+    if len(p) > r.limit {
+        p = p[:r.limit]
+    }
+    n := copy(p, r.data)
+    r.data, r.limit = r.data[n:], r.limit - n
+    return n, nil
+}
+
+func TestCreateFrom(t *testing.T) {
+    debugOut("[+] Running CreateFrom Test...")
+
+    var filename = gen_raw_filename("test_create_from")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    data := make([]byte, INGEST_CHUNK_SIZE * 2 + 123)
+    for i := range data {
+        data[i] = byte(i % 251)
+    }
+    n, err := header.CreateFrom("/ingested", bytes.NewReader(data))
+    if err != nil || n != int64(len(data)) {
+        drive_fail("TEST2: Failed to ingest the reader", t)
+    }
+    if output, _ := header.Read("/ingested"); !bytes.Equal(output, data) {
+        drive_fail("TEST3: Data mismatch after CreateFrom", t)
+    }
+
+    /* An empty reader creates an empty file */
+    if n, err := header.CreateFrom("/empty", bytes.NewReader(nil)); err != nil || n != 0 || header.Check("/empty") == false {
+        drive_fail("TEST4: Failed to ingest an empty reader", t)
+    }
+    if _, err := header.CreateFrom("/empty", bytes.NewReader(data)); errors.Is(err, ErrExist) == false {
+        drive_fail("TEST5: Ingested into an existing file", t)
+    }
+
+    /* A reader error is returned, with the data ingested until then */
+    n, err = header.CreateFrom("/partial", &failingReader{ data: data, limit: INGEST_CHUNK_SIZE })
+    if errors.Is(err, io.ErrClosedPipe) == false || n != int64(INGEST_CHUNK_SIZE) {
+        drive_fail("TEST6: Reader error was not returned", t)
+    }
+    if output, _ := header.Read("/partial"); !bytes.Equal(output, data[:INGEST_CHUNK_SIZE]) {
+        drive_fail("TEST7: Partial data mismatch", t)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if _, err := header.CreateFromCtx(ctx, "/cancelled", bytes.NewReader(data)); errors.Is(err, context.Canceled) == false {
+        drive_fail("TEST8: Cancelled CreateFrom succeeded", t)
+    }
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Inspection of a database without loading it. The raw fs stream is read, decrypted and
+ *  decompressed as a whole, as it must be, but only the stream header and the RawFile
+ *  of every file are decoded; the data of the files is skipped. Of a RecordStorage only
+ *  the catalog is read.
+ */
+
+import (
+    "sort"
+    "bytes"
+    "encoding/gob"
+)
+
+/*
+ * Versions of the layout of a database, see ImageInfo
+ */
+const (
+    FORMAT_LEGACY             int       = 1 + iota /* A raw fs stream without an envelope */
+    FORMAT_ENVELOPE           /* A raw fs stream which describes its encoding, see STREAM_ENVELOPE_MAGIC */
+    FORMAT_SCOPED             /* A raw fs stream with a separate catalog, see scope.go */
+    FORMAT_RECORDS            /* A RecordStorage */
+)
+
+type ImageInfo struct {
+    Name        string
+    Version     int /* FORMAT_LEGACY, FORMAT_ENVELOPE, FORMAT_SCOPED or FORMAT_RECORDS */
+    Flags       FlagVal /* FLAG_ENCRYPT and FLAG_COMPRESS, if they apply to the stream. Not recorded by a RecordStorage */
+    Files       int /* Not counting directories */
+    Directories int /* Not counting "/" */
+    TotalSize   int64 /* Sum of the sizes of the files */
+    StoredSize  int64 /* Size of the raw fs stream, or the sum of the stored records */
+    Codec       string /* Of FLAG_COMPRESS_FILES, see DBConfig.Codec */
+    Signature   string /* See DBConfig.Signature */
+    Labels      map[string]string /* See SetLabel() */
+    Volumes     []string /* See OpenVolume() */
+}
+
+/*
+ * Returns the ImageInfo of the raw fs stream `name`, which may be encrypted with the
+ *  default key. See InspectConfig()
+ */
+func Inspect(name string) (ImageInfo, error) {
+    info, err := InspectConfig(name, 0, nil)
+    if err != nil {
+        if encrypted, err := InspectConfig(name, FLAG_ENCRYPT, nil); err == nil {
+            return encrypted, nil
+        }
+    }
+    return info, err
+}
+
+/*
+ * Returns the ImageInfo of the database `name` without loading it. `flags` and `config`
+ *  are those it would be loaded with
+ */
+func InspectConfig(name string, flags FlagVal, config *DBConfig) (ImageInfo, error) {
+    info := ImageInfo{ Name: name, Labels: make(map[string]string) }
+
+    cfg, release, err := probeConfig(config, true)
+    if err != nil {
+        return info, err
+    }
+    defer release()
+
+    if cfg.Records != nil {
+        err := info.inspectRecords(&cfg)
+        return info, err
+    }
+
+    table, layout, err := readStreamLayout(name, flags, &cfg)
+    if err != nil {
+        return info, err
+    }
+    if err := info.inspectTable(table, layout, &cfg); err != nil {
+        return info, err
+    }
+
+    storage, stored_name := cfg.storage(name)
+    if size, err := storage.Open(stored_name); err == nil {
+        info.StoredSize = size
+    }
+    return info, nil
+}
+
+func (i *ImageInfo) inspectTable(table []byte, layout streamLayout, config *DBConfig) error {
+    i.Version = FORMAT_LEGACY
+    if layout.envelope == true {
+        i.Version = FORMAT_ENVELOPE
+    }
+    if layout.encrypted == true {
+        i.Flags |= FLAG_ENCRYPT
+    }
+    if layout.compressed == true {
+        i.Flags |= FLAG_COMPRESS
+    }
+
+    ptr := bytes.NewBuffer(table)
+    if layout.scoped == true {
+        var err error
+        if ptr, _, _, err = decodeScoped(table, config); err != nil {
+            return err
+        }
+
+        i.Version = FORMAT_SCOPED
+        if (table[0] & (SCOPED_DATA_ENCRYPTED | SCOPED_CATALOG_ENCRYPTED)) > 0 {
+            i.Flags |= FLAG_ENCRYPT
+        }
+        if (table[0] & SCOPED_CATALOG_COMPRESSED) > 0 {
+            i.Flags |= FLAG_COMPRESS
+        }
+    }
+
+    header, err := decodeStreamHeader(ptr, config)
+    if err != nil {
+        return err
+    }
+    i.Codec, i.Signature = header.Codec, header.Signature
+    if i.Codec == "" {
+        i.Codec = CodecGzip.Name()
+    }
+    for key, value := range header.Labels {
+        i.Labels[key] = value
+    }
+    for name := range header.Volumes {
+        i.Volumes = append(i.Volumes, name)
+    }
+    sort.Strings(i.Volumes)
+
+    for {
+        if err := skipRecordPad(ptr); err != nil {
+            return err
+        }
+        if ptr.Len() == 0 {
+            break
+        }
+
+        var raw RawFile
+        if err := gob.NewDecoder(ptr).Decode(&raw); err != nil {
+            return err
+        }
+        i.add(&raw)
+        if layout.scoped == true && (raw.Flags & FLAG_COMPRESS) > 0 {
+            i.Flags |= FLAG_COMPRESS
+        }
+
+        /* The data of a scoped stream follows the catalog */
+        if layout.scoped == false && raw.UnzippedLen > 0 {
+            stored := raw.StoredLen
+            if stored == 0 {
+                stored = raw.UnzippedLen
+            }
+            if stored > ptr.Len() {
+                return retErrStr("Stream is truncated")
+            }
+            ptr.Next(stored)
+        }
+    }
+
+    return nil
+}
+
+func (i *ImageInfo) inspectRecords(config *DBConfig) error {
+    i.Version = FORMAT_RECORDS
+
+    catalog, err := config.Records.Catalog()
+    if err != nil {
+        return err
+    }
+    for n := range catalog {
+        raw := &catalog[n]
+        switch raw.Name {
+        case AUDIT_RECORD_NAME:
+            continue
+        case LABELS_RECORD_NAME:
+            for key, value := range raw.Xattrs {
+                i.Labels[key] = value
+            }
+            continue
+        }
+
+        i.add(raw)
+        if raw.StoredLen > 0 {
+            i.StoredSize += int64(raw.StoredLen)
+        } else {
+            i.StoredSize += int64(raw.UnzippedLen)
+        }
+    }
+
+    return nil
+}
+
+func (i *ImageInfo) add(raw *RawFile) {
+    if raw.Name == "/" {
+        return
+    }
+    if (raw.Flags & FLAG_DIRECTORY) > 0 {
+        i.Directories += 1
+        return
+    }
+    i.Files += 1
+    i.TotalSize += int64(raw.UnzippedLen)
+}
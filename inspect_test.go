@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "testing"
+)
+
+func TestInspect(t *testing.T) {
+    debugOut("[+] Running Inspect Test...")
+
+    var filename = gen_raw_filename("test_inspect")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    for _, scope := range []Scope{ SCOPE_ALL, SCOPE_DATA } {
+        config := &DBConfig{ EncryptScope: scope, RecordPad: 8 }
+        header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | FLAG_ENCRYPT | FLAG_COMPRESS, config)
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to create database", t)
+        }
+        header.StartIOController()
+        header.Create("/dir/")
+        header.Create("/dir/a")
+        header.Write("/dir/a", []byte("0123456789"))
+        header.Create("/b")
+        header.Write("/b", []byte("abcde"))
+        header.SetLabel(LABEL_VOLUME, "inspected")
+        if err := header.UnmountDB(0); err != nil {
+            drive_fail("TEST2: Failed to commit database", t)
+        }
+        stat, _ := os.Stat(filename)
+
+        /* Encrypted with the default key */
+        info, err := Inspect(filename)
+        if err != nil {
+            drive_fail("TEST3: Failed to inspect database: " + err.Error(), t)
+        }
+        if info.Files != 2 || info.Directories < 1 || info.TotalSize != 15 || info.StoredSize != stat.Size() {
+            drive_fail("TEST4: Unexpected file counts or sizes", t)
+        }
+        if info.Flags != FLAG_ENCRYPT | FLAG_COMPRESS || info.Labels[LABEL_VOLUME] != "inspected" ||
+            info.Signature != FS_SIGNATURE {
+            drive_fail("TEST5: Unexpected flags or labels", t)
+        }
+        if (scope == SCOPE_ALL && info.Version != FORMAT_ENVELOPE) || (scope == SCOPE_DATA && info.Version != FORMAT_SCOPED) {
+            drive_fail("TEST6: Unexpected format version", t)
+        }
+    }
+
+    if _, err := Inspect(gen_raw_filename("test_inspect_missing")); err == nil {
+        drive_fail("TEST7: Inspected a missing database", t)
+    }
+
+    /* A RecordStorage */
+    records := newMemRecords()
+    header, _ := CreateDatabaseConfig("records", FLAG_DB_CREATE, &DBConfig{ Records: records })
+    header.StartIOController()
+    header.Create("/file")
+    header.Write("/file", []byte("data"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST8: Failed to commit database", t)
+    }
+    info, err := InspectConfig("records", 0, &DBConfig{ Records: records })
+    if err != nil || info.Version != FORMAT_RECORDS || info.Files != 1 || info.TotalSize != 4 {
+        drive_fail("TEST9: Unexpected inspection of a RecordStorage", t)
+    }
+}
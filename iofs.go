@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "errors"
+    "context"
+    "io"
+    "io/fs"
+    "path"
+    "sort"
+    "strings"
+    "time"
+)
+
+/*
+ * Read-only io/fs view of the database, rooted at `root` (always with a trailing "/").
+ *  Implements fs.FS, fs.ReadDirFS, fs.StatFS, fs.ReadFileFS, fs.GlobFS and fs.SubFS.
+ */
+type ioFS struct {
+    hdr         *FSHeader
+    root        string
+    ctx         context.Context /* Passed to AccessCtx(), e.g. with a principal */
+}
+
+/*
+ * Returns an fs.FS view of the database, which may be passed to any standard library
+ *  API which accepts one (template.ParseFS, http.FS, fs.WalkDir, ...). The view is
+ *  live: it reflects later writes.
+ */
+func (f *FSHeader) FS() fs.FS {
+    return f.FSCtx(context.Background())
+}
+
+/*
+ * FS() whose reads are checked for the principal of ctx, see session.go
+ */
+func (f *FSHeader) FSCtx(ctx context.Context) fs.FS {
+    return &ioFS{ hdr: f, root: "/", ctx: ctx }
+}
+
+/*
+ * Converts an fs.FS name into a database path, without a trailing "/"
+ */
+func (v *ioFS) path(name string) string {
+    if name == "." {
+        return strings.TrimSuffix(v.root, "/")
+    }
+
+    return v.root + name
+}
+
+/*
+ * Runs Access() on a name, reporting a denial against the fs.FS name
+ */
+func (v *ioFS) access(op string, name string, mode AccessMode) error {
+    err := v.hdr.AccessCtx(v.ctx, v.path(name), mode)
+    if err == nil {
+        return nil
+    }
+
+    var perr *fs.PathError
+    if errors.As(err, &perr) {
+        err = perr.Err
+    }
+    return &fs.PathError{ Op: op, Path: name, Err: err }
+}
+
+func (v *ioFS) stat(op string, name string) (*govfsFile, *fileInfo, error) {
+    if !fs.ValidPath(name) {
+        return nil, nil, &fs.PathError{ Op: op, Path: name, Err: fs.ErrInvalid }
+    }
+    if v.hdr.isClosed() {
+        return nil, nil, &fs.PathError{ Op: op, Path: name, Err: fs.ErrClosed }
+    }
+
+    file, dir := v.hdr.resolve(v.path(name))
+    if file == nil {
+        return nil, nil, &fs.PathError{ Op: op, Path: name, Err: fs.ErrNotExist }
+    }
+
+    return file, newFileInfo(path.Base(name), file, dir), nil
+}
+
+func (v *ioFS) Open(name string) (fs.File, error) {
+    file, info, err := v.stat("open", name)
+    if err != nil {
+        return nil, err
+    }
+
+    if info.IsDir() {
+        if err := v.access("open", name, ACCESS_LIST); err != nil {
+            return nil, err
+        }
+        entries, err := v.readDir(name)
+        if err != nil {
+            return nil, err
+        }
+        return &ioDir{ info: info, entries: entries }, nil
+    }
+
+    if err := v.access("open", name, ACCESS_READ); err != nil {
+        return nil, err
+    }
+    data, err := v.readFile("open", name, file)
+    if err != nil {
+        return nil, err
+    }
+
+    return &ioFile{ info: info, Reader: bytes.NewReader(data) }, nil
+}
+
+func (v *ioFS) Stat(name string) (fs.FileInfo, error) {
+    _, info, err := v.stat("stat", name)
+    if err != nil {
+        return nil, err
+    }
+
+    return info, nil
+}
+
+func (v *ioFS) ReadFile(name string) ([]byte, error) {
+    file, info, err := v.stat("read", name)
+    if err != nil {
+        return nil, err
+    }
+    if info.IsDir() {
+        return nil, &fs.PathError{ Op: "read", Path: name, Err: ErrIsDirectory }
+    }
+    if err := v.access("read", name, ACCESS_READ); err != nil {
+        return nil, err
+    }
+
+    return v.readFile("read", name, file)
+}
+
+func (v *ioFS) readFile(op string, name string, file *govfsFile) ([]byte, error) {
+    if err := v.hdr.syncPath(file.filename); err != nil {
+        return nil, &fs.PathError{ Op: op, Path: name, Err: err }
+    }
+
+    data, err := v.hdr.openData(file)
+    if err != nil {
+        return nil, &fs.PathError{ Op: op, Path: name, Err: err }
+    }
+
+    return data, nil
+}
+
+func (v *ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+    _, info, err := v.stat("readdir", name)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        return nil, &fs.PathError{ Op: "readdir", Path: name, Err: ErrNotDirectory }
+    }
+    if err := v.access("readdir", name, ACCESS_LIST); err != nil {
+        return nil, err
+    }
+
+    return v.readDir(name)
+}
+
+/*
+ * Returns the children of a directory, sorted by name
+ */
+func (v *ioFS) readDir(name string) ([]fs.DirEntry, error) {
+    var dir = v.path(name) + "/"
+
+    children := make(map[string]*fileInfo)
+    for _, file := range v.hdr.children(dir) {
+        isDir := (file.flags & FLAG_DIRECTORY) > 0
+        base := path.Base(strings.TrimSuffix(file.filename, "/"))
+        if existing := children[base]; existing != nil && existing.IsDir() {
+            continue /* A directory and a file may share a name, the directory wins */
+        }
+        children[base] = newFileInfo(base, file, isDir)
+    }
+
+    output := make([]fs.DirEntry, 0, len(children))
+    for _, info := range children {
+        output = append(output, info)
+    }
+    sort.Slice(output, func (i, j int) bool {
+        return output[i].Name() < output[j].Name()
+    })
+
+    return output, nil
+}
+
+func (v *ioFS) Glob(pattern string) ([]string, error) {
+    if _, err := path.Match(pattern, ""); err != nil {
+        return nil, err
+    }
+
+    /* path.Match never matches "/" with a wildcard, so matching full names is equivalent to fs.Glob */
+    seen := make(map[string]bool)
+    var output []string
+    for _, file := range v.hdr.files() {
+        if !strings.HasPrefix(file.filename, v.root) {
+            continue
+        }
+
+        name := strings.TrimSuffix(strings.TrimPrefix(file.filename, v.root), "/")
+        if name == "" || seen[name] {
+            continue
+        }
+        if ok, _ := path.Match(pattern, name); ok {
+            seen[name] = true
+            output = append(output, name)
+        }
+    }
+    sort.Strings(output)
+
+    return output, nil
+}
+
+func (v *ioFS) Sub(dir string) (fs.FS, error) {
+    _, info, err := v.stat("sub", dir)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        return nil, &fs.PathError{ Op: "sub", Path: dir, Err: ErrNotDirectory }
+    }
+    if dir == "." {
+        return v, nil
+    }
+
+    return &ioFS{ hdr: v.hdr, root: v.path(dir) + "/", ctx: v.ctx }, nil
+}
+
+/*
+ * fs.FileInfo and fs.DirEntry
+ */
+type fileInfo struct {
+    name        string
+    size        int64
+    mode        fs.FileMode
+    modtime     time.Time
+}
+
+func newFileInfo(name string, file *govfsFile, dir bool) *fileInfo {
+    file.lock.Lock()
+    defer file.lock.Unlock()
+
+    info := &fileInfo{
+        name: name,
+        size: int64(file.size),
+        mode: 0444,
+        modtime: file.modTime(),
+    }
+    if dir == true {
+        info.size = 0
+        info.mode = fs.ModeDir | 0555
+    }
+
+    return info
+}
+
+func (i *fileInfo) Name() string               { return i.name }
+func (i *fileInfo) Size() int64                { return i.size }
+func (i *fileInfo) Mode() fs.FileMode          { return i.mode }
+func (i *fileInfo) ModTime() time.Time         { return i.modtime }
+func (i *fileInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}           { return nil }
+func (i *fileInfo) Type() fs.FileMode          { return i.mode.Type() }
+func (i *fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+/*
+ * An open file holds a snapshot of its contents, and also implements io.Seeker and io.ReaderAt
+ */
+type ioFile struct {
+    *bytes.Reader
+    info        *fileInfo
+}
+
+func (f *ioFile) Stat() (fs.FileInfo, error) {
+    return f.info, nil
+}
+
+func (f *ioFile) Close() error {
+    return nil
+}
+
+type ioDir struct {
+    info        *fileInfo
+    entries     []fs.DirEntry
+    offset      int
+}
+
+func (d *ioDir) Stat() (fs.FileInfo, error) {
+    return d.info, nil
+}
+
+func (d *ioDir) Read([]byte) (int, error) {
+    return 0, &fs.PathError{ Op: "read", Path: d.info.name, Err: ErrIsDirectory }
+}
+
+func (d *ioDir) Close() error {
+    return nil
+}
+
+func (d *ioDir) ReadDir(n int) ([]fs.DirEntry, error) {
+    remaining := d.entries[d.offset:]
+    if n <= 0 {
+        d.offset = len(d.entries)
+        return remaining, nil
+    }
+    if len(remaining) == 0 {
+        return nil, io.EOF
+    }
+    if n > len(remaining) {
+        n = len(remaining)
+    }
+    d.offset += n
+
+    return remaining[:n], nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "io/fs"
+    "time"
+    "strings"
+    "text/template"
+)
+
+func TestIOFS(t *testing.T) {
+    debugOut("[+] Running io/fs Adapter Test...")
+
+    var filename = gen_raw_filename("test_iofs")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    start := time.Now()
+    files := map[string]string{
+        "/templates/index.tmpl": "Hello {{.}}",
+        "/templates/partials/footer.tmpl": "footer",
+        "/static/app.js": "app",
+        "/README": "readme",
+    }
+    for name, data := range files {
+        header.Create(name)
+        header.Write(name, []byte(data))
+    }
+
+    fsys := header.FS()
+    if data, err := fs.ReadFile(fsys, "templates/index.tmpl"); err != nil || string(data) != files["/templates/index.tmpl"] {
+        drive_fail("TEST2: ReadFile failed", t)
+    }
+
+    info, err := fs.Stat(fsys, "static/app.js")
+    if err != nil || info.Size() != 3 || info.IsDir() || info.ModTime().Before(start.Add(-time.Second)) {
+        drive_fail("TEST3: Unexpected Stat() result for a file", t)
+    }
+    if info, err := fs.Stat(fsys, "templates/partials"); err != nil || !info.IsDir() {
+        drive_fail("TEST3.1: Unexpected Stat() result for a directory", t)
+    }
+    if _, err := fs.Stat(fsys, "missing"); !os.IsNotExist(err) {
+        drive_fail("TEST3.2: Stat() of a missing file did not return fs.ErrNotExist", t)
+    }
+    if _, err := fsys.Open("/README"); err == nil {
+        drive_fail("TEST3.3: Opened an invalid path", t)
+    }
+
+    entries, err := fs.ReadDir(fsys, ".")
+    var names []string
+    for _, e := range entries {
+        names = append(names, e.Name())
+    }
+    if err != nil || strings.Join(names, ",") != "README,static,templates" {
+        drive_fail("TEST4: Unexpected root listing: " + strings.Join(names, ","), t)
+    }
+
+    var walked []string
+    fs.WalkDir(fsys, ".", func (path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if !d.IsDir() {
+            walked = append(walked, path)
+        }
+        return nil
+    })
+    if len(walked) != len(files) {
+        drive_fail("TEST5: WalkDir did not visit all files", t)
+    }
+
+    if matches, err := fs.Glob(fsys, "templates/*.tmpl"); err != nil || len(matches) != 1 || matches[0] != "templates/index.tmpl" {
+        drive_fail("TEST6: Unexpected Glob() result", t)
+    }
+
+    sub, err := fs.Sub(fsys, "templates")
+    if err != nil {
+        drive_fail("TEST7: Sub() failed", t)
+    }
+    if data, err := fs.ReadFile(sub, "partials/footer.tmpl"); err != nil || string(data) != "footer" {
+        drive_fail("TEST8: ReadFile failed in a Sub() view", t)
+    }
+
+    /* Any API which accepts an fs.FS */
+    tmpl, err := template.ParseFS(sub, "*.tmpl")
+    if err != nil {
+        drive_fail("TEST9: template.ParseFS failed", t)
+    }
+    var output strings.Builder
+    if tmpl.Execute(&output, "govfs"); output.String() != "Hello govfs" {
+        drive_fail("TEST10: Unexpected template output", t)
+    }
+
+    /* Modification times survive a commit */
+    modtime := info.ModTime()
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST11: Failed to commit database", t)
+    }
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST12: Failed to load database", t)
+    }
+    if info, err := fs.Stat(loaded.FS(), "static/app.js"); err != nil || !info.ModTime().Equal(modtime) {
+        drive_fail("TEST13: Modification time was not preserved", t)
+    }
+
+    debugOut("[+] io/fs Adapter Test PASS")
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "os"
+    "io"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/hmac"
+
+    "golang.org/x/crypto/argon2"
+)
+
+/*
+ * Keyfile parameters. The keyfile contents are treated as opaque key material and are
+ *  never parsed, so no branch depends on the key bytes.
+ */
+const MIN_KEYFILE_LENGTH      int       = 16
+const MAX_KEYFILE_LENGTH      int       = 1 << 20
+const KEYFILE_GEN_LENGTH      int       = 64                /* Size of a keyfile created by GenerateKeyfile() */
+const KEYFILE_DERIVED_LENGTH  int       = 32
+
+/* argon2id cost parameters used when a passphrase is combined with the keyfile */
+const (
+    KEYFILE_ARGON_TIME        uint32    = 1
+    KEYFILE_ARGON_MEMORY      uint32    = 64 * 1024
+    KEYFILE_ARGON_THREADS     uint8     = 4
+)
+
+/*
+ * Reads the keyfile at `path` and derives a database key from it, optionally combined
+ *  with a passphrase. The returned key may be passed in DBConfig.Key, after which the
+ *  caller should ZeroKey() it.
+ */
+func KeyFromFile(path string, passphrase []byte) ([]byte, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    return KeyFromReader(file, passphrase)
+}
+
+/*
+ * Same as KeyFromFile(), but reads the key material from any io.Reader. Every intermediate
+ *  buffer holding key material is zeroed before returning.
+ */
+func KeyFromReader(r io.Reader, passphrase []byte) ([]byte, error) {
+    material := make([]byte, MAX_KEYFILE_LENGTH + 1)
+    defer ZeroKey(material)
+
+    length, err := io.ReadFull(r, material)
+    if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+        return nil, err
+    }
+
+    if length > MAX_KEYFILE_LENGTH {
+        return nil, retErrStr("keyfile: Key material is too long")
+    }
+    if length < MIN_KEYFILE_LENGTH {
+        return nil, retErrStr("keyfile: Key material is too short")
+    }
+
+    return deriveKeyfileKey(material[:length], passphrase), nil
+}
+
+/*
+ * Writes a new keyfile composed of KEYFILE_GEN_LENGTH random bytes. The file is only
+ *  readable by the owner, and an existing file is never overwritten.
+ */
+func GenerateKeyfile(path string) error {
+    material := make([]byte, KEYFILE_GEN_LENGTH)
+    defer ZeroKey(material)
+
+    if _, err := io.ReadFull(rand.Reader, material); err != nil {
+        return err
+    }
+
+    file, err := os.OpenFile(path, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0600)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    if _, err := file.Write(material); err != nil {
+        return err
+    }
+
+    return file.Sync()
+}
+
+/*
+ * Overwrites key material in place. Safe to call on a nil slice
+ */
+func ZeroKey(key []byte) {
+    for i := range key {
+        key[i] = 0
+    }
+}
+
+/*
+ * Without a passphrase the key is the SHA-256 of the keyfile. With a passphrase, the
+ *  passphrase is stretched with argon2id and salted with an HMAC of the keyfile, so
+ *  both factors are required to open the database.
+ */
+func deriveKeyfileKey(material []byte, passphrase []byte) []byte {
+    if len(passphrase) == 0 {
+        sum := sha256.Sum256(material)
+        output := make([]byte, len(sum))
+        copy(output, sum[:])
+        ZeroKey(sum[:])
+        return output
+    }
+
+    mac := hmac.New(sha256.New, material)
+    mac.Write([]byte(FS_SIGNATURE))
+    salt := mac.Sum(nil)
+    defer ZeroKey(salt)
+
+    return argon2.IDKey(passphrase, salt, KEYFILE_ARGON_TIME, KEYFILE_ARGON_MEMORY,
+        KEYFILE_ARGON_THREADS, uint32(KEYFILE_DERIVED_LENGTH))
+}
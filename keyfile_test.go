@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+)
+
+func TestKeyfile(t *testing.T) {
+    debugOut("[+] Running Keyfile Test...")
+
+    var keyfile = gen_raw_filename("test_keyfile")
+    var filename = gen_raw_filename("test_keyfile_db")
+    os.Remove(keyfile)
+    os.Remove(filename)
+    defer os.Remove(keyfile)
+    defer os.Remove(filename)
+
+    if err := GenerateKeyfile(keyfile); err != nil {
+        drive_fail("TEST1: Failed to generate keyfile", t)
+    }
+    if err := GenerateKeyfile(keyfile); err == nil {
+        drive_fail("TEST1.1: GenerateKeyfile overwrote an existing keyfile", t)
+    }
+
+    key, err := KeyFromFile(keyfile, []byte("passphrase"))
+    if err != nil || len(key) != KEYFILE_DERIVED_LENGTH {
+        drive_fail("TEST2: Failed to derive key from keyfile", t)
+    }
+    plain, _ := KeyFromFile(keyfile, nil)
+    if bytes.Equal(key, plain) {
+        drive_fail("TEST2.1: Passphrase is not part of the derived key", t)
+    }
+    if _, err := KeyFromReader(bytes.NewReader([]byte("short")), nil); err == nil {
+        drive_fail("TEST2.2: Short key material was accepted", t)
+    }
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | FLAG_ENCRYPT,
+        &DBConfig{ Cipher: CipherAESGCM, Key: key })
+    if header == nil || err != nil {
+        drive_fail("TEST3: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/file0")
+    header.Write("/file0", []byte("keyfile data"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST4: Failed to commit database", t)
+    }
+
+    /* The config holds its own copy, so the caller may wipe theirs */
+    ZeroKey(key)
+    if !bytes.Equal(key, make([]byte, len(key))) {
+        drive_fail("TEST5: ZeroKey failed", t)
+    }
+
+    key, _ = KeyFromFile(keyfile, []byte("passphrase"))
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD | FLAG_ENCRYPT,
+        &DBConfig{ Cipher: CipherAESGCM, Key: key })
+    if loaded == nil || err != nil {
+        drive_fail("TEST6: Failed to load database with keyfile", t)
+    }
+    if data, _ := loaded.Read("/file0"); string(data) != "keyfile data" {
+        drive_fail("TEST6.1: Data mismatch", t)
+    }
+
+    wrong, _ := KeyFromFile(keyfile, []byte("wrong"))
+    if _, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD | FLAG_ENCRYPT,
+        &DBConfig{ Cipher: CipherAESGCM, Key: wrong }); err == nil {
+        drive_fail("TEST7: Database opened with the wrong passphrase", t)
+    }
+
+    debugOut("[+] Keyfile Test PASS")
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package govfs
+
+import (
+    "io"
+    "crypto/rand"
+)
+
+/*
+ * A KeyProvider supplies the database key when it is not passed in DBConfig.Key.
+ *  The returned slice is owned by the caller, which zeroes it after use.
+ */
+type KeyProvider interface {
+    Key() ([]byte, error)
+}
+
+const KEYRING_KEY_LENGTH      int       = 32
+const KEYRING_DEFAULT_SERVICE string    = "govfs"
+
+/*
+ * Key provider backed by the operating system's credential store:
+ *  Linux   -- the kernel user keyring (keyctl). Note that the user keyring does not
+ *             survive a reboot, the key must be re-provisioned by the session.
+ *  macOS   -- the login Keychain, as a generic password
+ *  Windows -- DPAPI, the key is protected with the user's credentials and the
+ *             protected blob is stored in %APPDATA%\govfs
+ */
+type KeyringProvider struct {
+    Service     string /* Defaults to KEYRING_DEFAULT_SERVICE */
+    Account     string /* Identifies the database key, e.g. the database filename */
+}
+
+func (p *KeyringProvider) Key() ([]byte, error) {
+    if p.Account == "" {
+        return nil, retErrStr("keyring: No account specified")
+    }
+
+    return keyringLoad(p.service(), p.Account)
+}
+
+/*
+ * Stores `key` in the credential store, replacing any existing key for the account
+ */
+func (p *KeyringProvider) Store(key []byte) error {
+    if p.Account == "" {
+        return retErrStr("keyring: No account specified")
+    }
+    if len(key) == 0 {
+        return retErrStr("keyring: Empty key")
+    }
+
+    return keyringStore(p.service(), p.Account, key)
+}
+
+/*
+ * Generates a new random key, stores it in the credential store and returns it
+ */
+func (p *KeyringProvider) Generate() ([]byte, error) {
+    key := make([]byte, KEYRING_KEY_LENGTH)
+    if _, err := io.ReadFull(rand.Reader, key); err != nil {
+        return nil, err
+    }
+
+    if err := p.Store(key); err != nil {
+        ZeroKey(key)
+        return nil, err
+    }
+
+    return key, nil
+}
+
+func (p *KeyringProvider) service() string {
+    if p.Service == "" {
+        return KEYRING_DEFAULT_SERVICE
+    }
+
+    return p.Service
+}
+
+/*
+ * Key provider wrapping KeyFromFile()
+ */
+type KeyfileProvider struct {
+    Path        string
+    Passphrase  []byte
+}
+
+func (p *KeyfileProvider) Key() ([]byte, error) {
+    return KeyFromFile(p.Path, p.Passphrase)
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+    "strconv"
+)
+
+func TestKeyProvider(t *testing.T) {
+    debugOut("[+] Running Key Provider Test...")
+
+    var keyfile = gen_raw_filename("test_provider_keyfile")
+    var filename = gen_raw_filename("test_provider_db")
+    os.Remove(keyfile)
+    defer os.Remove(keyfile)
+    defer os.Remove(filename)
+
+    if err := GenerateKeyfile(keyfile); err != nil {
+        drive_fail("TEST1: Failed to generate keyfile", t)
+    }
+
+    provider := &KeyfileProvider{ Path: keyfile, Passphrase: []byte("passphrase") }
+    config := &DBConfig{ Cipher: CipherAESGCM, KeyProvider: provider }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        drive_fail("TEST2: Failed to create database with key provider", t)
+    }
+    header.StartIOController()
+    header.Create("/file0")
+    header.Write("/file0", []byte("provider"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST3: Failed to commit database", t)
+    }
+
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD | FLAG_ENCRYPT, config)
+    if loaded == nil || err != nil {
+        drive_fail("TEST4: Failed to load database with key provider", t)
+    }
+
+    provider.Path = keyfile + ".missing"
+    if _, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD | FLAG_ENCRYPT, config); err == nil {
+        drive_fail("TEST5: Failed key provider did not fail the load", t)
+    }
+    debugOut("[+] Keyfile Provider PASS")
+
+    /* The credential store may be unavailable in sandboxes and CI */
+    keyring := &KeyringProvider{ Account: "govfs_test_" + strconv.Itoa(os.Getpid()) }
+    key, err := keyring.Generate()
+    if err != nil {
+        t.Skip("credential store unavailable: " + err.Error())
+    }
+
+    stored, err := keyring.Key()
+    if err != nil || !bytes.Equal(stored, key) {
+        drive_fail("TEST6: Keyring returned a different key", t)
+    }
+    debugOut("[+] Keyring Provider PASS")
+}
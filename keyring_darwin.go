@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package govfs
+
+import (
+    "os/exec"
+    "bytes"
+    "strings"
+    "encoding/hex"
+)
+
+/*
+ * The Keychain is driven through security(1). The key is stored hex encoded, since
+ *  generic passwords are returned as text by `find-generic-password -w`. It is never
+ *  passed on the command line, where ps(1) shows it to every local user
+ */
+func keyringLoad(service string, account string) ([]byte, error) {
+    output, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+    defer ZeroKey(output)
+    if err != nil {
+        return nil, err
+    }
+
+    encoded := bytes.TrimSpace(output)
+    key := make([]byte, hex.DecodedLen(len(encoded)))
+    if _, err := hex.Decode(key, encoded); err != nil {
+        ZeroKey(key)
+        return nil, err
+    }
+
+    return key, nil
+}
+
+func keyringStore(service string, account string, key []byte) error {
+    if strings.ContainsAny(service + account, "\"\\\n") {
+        return retErrStr("keyring: Invalid service or account name")
+    }
+
+    /* `security -i` reads the command from stdin. -U updates an existing item */
+    command := []byte("add-generic-password -U -s \"" + service + "\" -a \"" + account + "\" -w ")
+    encoded := make([]byte, hex.EncodedLen(len(key)))
+    hex.Encode(encoded, key)
+    command = append(append(command, encoded...), '\n')
+    ZeroKey(encoded)
+    defer ZeroKey(command)
+
+    cmd := exec.Command("security", "-i")
+    cmd.Stdin = bytes.NewReader(command)
+    return cmd.Run()
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package govfs
+
+import (
+    "golang.org/x/sys/unix"
+)
+
+func keyringDescription(service string, account string) string {
+    return service + ":" + account
+}
+
+func keyringLoad(service string, account string) ([]byte, error) {
+    id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", keyringDescription(service, account), 0)
+    if err != nil {
+        return nil, err
+    }
+
+    /* Query the payload length first */
+    length, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+    if err != nil {
+        return nil, err
+    }
+
+    key := make([]byte, length)
+    if _, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, key, 0); err != nil {
+        ZeroKey(key)
+        return nil, err
+    }
+
+    return key, nil
+}
+
+func keyringStore(service string, account string, key []byte) error {
+    _, err := unix.AddKey("user", keyringDescription(service, account), key, unix.KEY_SPEC_USER_KEYRING)
+    return err
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package govfs
+
+import (
+    "os"
+    "unsafe"
+    "path/filepath"
+
+    "golang.org/x/sys/windows"
+)
+
+func keyringPath(service string, account string) (string, error) {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        return "", err
+    }
+
+    return filepath.Join(dir, "govfs", service + "-" + s(account) + ".key"), nil
+}
+
+func keyringLoad(service string, account string) ([]byte, error) {
+    path, err := keyringPath(service, account)
+    if err != nil {
+        return nil, err
+    }
+
+    protected, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    if len(protected) == 0 {
+        return nil, retErrStr("keyring: " + path + " is empty")
+    }
+
+    var in, out windows.DataBlob
+    in.Size = uint32(len(protected))
+    in.Data = &protected[0]
+
+    if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+        return nil, err
+    }
+    defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+    blob := unsafe.Slice(out.Data, out.Size)
+    key := make([]byte, len(blob))
+    copy(key, blob)
+    ZeroKey(blob)
+
+    return key, nil
+}
+
+func keyringStore(service string, account string, key []byte) error {
+    path, err := keyringPath(service, account)
+    if err != nil {
+        return err
+    }
+
+    if len(key) == 0 {
+        return retErrStr("keyring: Empty key")
+    }
+
+    var in, out windows.DataBlob
+    in.Size = uint32(len(key))
+    in.Data = &key[0]
+
+    if err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+        return err
+    }
+    defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+    protected := make([]byte, out.Size)
+    copy(protected, unsafe.Slice(out.Data, out.Size))
+
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return err
+    }
+
+    return os.WriteFile(path, protected, 0600)
+}
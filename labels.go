@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Database labels. A small key/value section kept in the rawStreamHeader, or as the
+ *  LABELS_RECORD_NAME record of a RecordStorage, for e.g. a volume label, the version of
+ *  the application which wrote the database, or arbitrary tags. LABEL_CREATED is set
+ *  when a raw fs stream is created; a RecordStorage only holds the record once a label
+ *  is set. ReadLabels() returns the labels without loading any file: the stream is
+ *  decrypted and decompressed, but only its header is decoded, and of a RecordStorage
+ *  only the catalog is read.
+ */
+
+import (
+    "sync"
+    "time"
+)
+
+const (
+    LABEL_VOLUME              string    = "volume"
+    LABEL_APP_VERSION         string    = "app_version"
+    LABEL_CREATED             string    = "created" /* RFC 3339, set by CreateDatabase() of a raw fs stream */
+)
+
+const LABELS_RECORD_NAME      string    = "govfs:labels" /* The labels are the Xattrs of its RawFile */
+
+type labelTable struct {
+    lock        sync.Mutex
+    labels      map[string]string
+    version     int /* Incremented by every change */
+    committed   int /* The version of the last commit or load */
+}
+
+/*
+ * Sets the label `key`, or removes it if `value` is empty. Labels are persisted by the
+ *  next commit
+ */
+func (f *FSHeader) SetLabel(key string, value string) error {
+    if f.config.ReadOnly == true {
+        return ErrReadOnly
+    }
+    if key == "" {
+        return retErrStr("SetLabel: A label requires a key")
+    }
+
+    f.labels.lock.Lock()
+    defer f.labels.lock.Unlock()
+
+    if value == "" {
+        delete(f.labels.labels, key)
+    } else {
+        if f.labels.labels == nil {
+            f.labels.labels = make(map[string]string)
+        }
+        f.labels.labels[key] = value
+    }
+    f.labels.version += 1
+    return nil
+}
+
+/*
+ * Returns the label `key`, and whether it is set
+ */
+func (f *FSHeader) Label(key string) (string, bool) {
+    f.labels.lock.Lock()
+    defer f.labels.lock.Unlock()
+
+    value, ok := f.labels.labels[key]
+    return value, ok
+}
+
+/*
+ * Returns a copy of every label
+ */
+func (f *FSHeader) Labels() map[string]string {
+    labels, _ := f.labels.snapshot()
+    if labels == nil {
+        labels = make(map[string]string)
+    }
+    return labels
+}
+
+/*
+ * Returns the labels of the database `name` without loading it. `flags` and `config`
+ *  are those it would be loaded with
+ */
+func ReadLabels(name string, flags FlagVal, config *DBConfig) (map[string]string, error) {
+    cfg, release, err := probeConfig(config, true)
+    if err != nil {
+        return nil, err
+    }
+    defer release()
+
+    var labels = make(map[string]string)
+    if cfg.Records != nil {
+        catalog, err := cfg.Records.Catalog()
+        if err != nil {
+            return nil, err
+        }
+        for _, raw := range catalog {
+            if raw.Name != LABELS_RECORD_NAME {
+                continue
+            }
+            for key, value := range raw.Xattrs {
+                labels[key] = value
+            }
+        }
+        return labels, nil
+    }
+
+    header, err := readStreamHeader(name, flags, &cfg)
+    if err != nil {
+        return nil, err
+    }
+    for key, value := range header.Labels {
+        labels[key] = value
+    }
+    return labels, nil
+}
+
+/*
+ * Sets LABEL_CREATED on a new raw fs stream
+ */
+func (f *FSHeader) initLabels() {
+    f.labels.lock.Lock()
+    defer f.labels.lock.Unlock()
+
+    f.labels.labels = map[string]string{ LABEL_CREATED: time.Now().UTC().Format(time.RFC3339) }
+    f.labels.version += 1
+}
+
+/*
+ * Returns a copy of the labels and their version, for a commit
+ */
+func (l *labelTable) snapshot() (map[string]string, int) {
+    l.lock.Lock()
+    defer l.lock.Unlock()
+
+    if len(l.labels) == 0 {
+        return nil, l.version
+    }
+    return copyXattrs(l.labels), l.version
+}
+
+/*
+ * Sets the labels of a load, which need not be committed again
+ */
+func (l *labelTable) set(labels map[string]string) {
+    l.lock.Lock()
+    defer l.lock.Unlock()
+
+    l.labels = labels
+    l.committed = l.version
+}
+
+func (l *labelTable) setCommitted(version int) {
+    l.lock.Lock()
+    defer l.lock.Unlock()
+
+    if version > l.committed {
+        l.committed = version
+    }
+}
+
+/*
+ * The LABELS_RECORD_NAME record for commitRecords(), nil if the labels did not change
+ *  since the last commit
+ */
+func (f *FSHeader) labelsRecord() (*Record, int) {
+    labels, version := f.labels.snapshot()
+
+    f.labels.lock.Lock()
+    committed := f.labels.committed
+    f.labels.lock.Unlock()
+    if version == committed {
+        return nil, version
+    }
+
+    return &Record{ Header: RawFile{ Name: LABELS_RECORD_NAME, Xattrs: labels } }, version
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "time"
+    "testing"
+)
+
+func TestLabels(t *testing.T) {
+    debugOut("[+] Running Database Label Test...")
+
+    var filename = gen_raw_filename("test_labels")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ EncryptScope: SCOPE_DATA }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | FLAG_ENCRYPT | FLAG_COMPRESS, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    created, ok := header.Label(LABEL_CREATED)
+    if _, err := time.Parse(time.RFC3339, created); ok == false || err != nil {
+        drive_fail("TEST2: Creation time was not set", t)
+    }
+    if header.SetLabel("", "x") == nil {
+        drive_fail("TEST3: Accepted an empty key", t)
+    }
+    header.SetLabel(LABEL_VOLUME, "assets")
+    header.SetLabel(LABEL_APP_VERSION, "1.2.3")
+    header.SetLabel("tag", "removed")
+    header.SetLabel("tag", "")
+    header.StartIOController()
+    header.Create("/file")
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST4: Failed to commit database", t)
+    }
+
+    /* Read without loading */
+    labels, err := ReadLabels(filename, FLAG_ENCRYPT | FLAG_COMPRESS, nil)
+    if err != nil || len(labels) != 3 || labels[LABEL_VOLUME] != "assets" || labels[LABEL_APP_VERSION] != "1.2.3" ||
+        labels[LABEL_CREATED] != created {
+        drive_fail("TEST5: Unexpected labels", t)
+    }
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD | FLAG_ENCRYPT | FLAG_COMPRESS)
+    if loaded == nil || err != nil || len(loaded.Labels()) != 3 {
+        drive_fail("TEST6: Labels were not loaded", t)
+    }
+    if _, ok := loaded.Label("tag"); ok == true {
+        drive_fail("TEST7: Removed label was persisted", t)
+    }
+
+    /* A RecordStorage keeps them in a record */
+    records := newMemRecords()
+    rheader, err := CreateDatabaseConfig("records", FLAG_DB_CREATE, &DBConfig{ Records: records })
+    if rheader == nil || err != nil {
+        drive_fail("TEST8: Failed to create database", t)
+    }
+    rheader.StartIOController()
+    rheader.Create("/file")
+    rheader.SetLabel(LABEL_VOLUME, "records")
+    if err := rheader.UnmountDB(0); err != nil {
+        drive_fail("TEST9: Failed to commit database", t)
+    }
+    labels, err = ReadLabels("records", 0, &DBConfig{ Records: records })
+    if err != nil || len(labels) != 1 || labels[LABEL_VOLUME] != "records" {
+        drive_fail("TEST10: Unexpected labels of a RecordStorage", t)
+    }
+    rloaded, err := CreateDatabaseConfig("records", FLAG_DB_LOAD, &DBConfig{ Records: records })
+    if rloaded == nil || err != nil || rloaded.Check("/file") == false {
+        drive_fail("TEST11: Failed to load database", t)
+    }
+    if volume, _ := rloaded.Label(LABEL_VOLUME); volume != "records" {
+        drive_fail("TEST12: Labels were not loaded from the RecordStorage", t)
+    }
+}
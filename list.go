@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Structured listings, for callers which would otherwise parse the "(DIR)  /x" strings
+ *  of GetFileList(). Filters are applied before sorting and paging, so that a page of a
+ *  huge directory does not cost the caller the whole listing.
+ */
+
+import (
+    "path"
+    "sort"
+    "time"
+    "strings"
+)
+
+type ListSort int
+
+const (
+    SORT_NAME                 ListSort = iota
+    SORT_SIZE
+    SORT_MODTIME
+)
+
+type ListType int
+
+const (
+    LIST_ALL                  ListType = iota
+    LIST_FILES
+    LIST_DIRS
+)
+
+type EntryInfo struct {
+    Name        string /* Directories with a trailing "/" */
+    Dir         bool
+    Size        int /* Of the plaintext data, 0 for directories */
+    Checksum    string /* See DBConfig.Checksum, "" for directories and empty files */
+    Algorithm   string /* Name of the algorithm of Checksum */
+    ModTime     time.Time /* Zero if loaded from a stream written before modification times were recorded */
+    Generation  uint64 /* Bumped by every write, see generation.go */
+}
+
+type ListOptions struct {
+    Dir         string /* Only the subtree beneath this directory, "" for the whole database */
+    Shallow     bool /* Only the entries directly beneath Dir, or the root */
+    Prefix      string /* Only entries whose base name starts with it */
+    Type        ListType
+    MinSize     int
+    MaxSize     int /* 0 is unlimited */
+    ModifiedSince time.Time /* Only entries modified at or after it, unless zero */
+    Sort        ListSort /* Ties are sorted by name */
+    Reverse     bool
+    After       *EntryInfo /* Continue after this entry, the last of the previous page. Unlike Offset,
+                              pages neither repeat nor skip entries while files are created and deleted */
+    Offset      int /* Entries to skip, after sorting */
+    Limit       int /* Maximum number of entries, 0 is unlimited */
+}
+
+/*
+ * Returns the files and directories of the database, except the root
+ */
+func (f *FSHeader) List(opts ListOptions) ([]EntryInfo, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+
+    var dir = "/"
+    if opts.Dir != "" {
+        dir = dirKey(opts.Dir)
+        if f.checkDir(dir) == false {
+            return nil, pathError("list", opts.Dir, ErrNotExist)
+        }
+    }
+
+    var files []*govfsFile
+    switch {
+    case opts.Shallow == true:
+        files = f.children(dir)
+    case dir == "/":
+        files = f.files()
+    default:
+        f.walk(dir, func (file *govfsFile) {
+            files = append(files, file)
+        })
+    }
+
+    less := entryLess(opts.Sort, opts.Reverse)
+    seen := make(map[string]bool)
+    var output []EntryInfo
+    for _, file := range files {
+        if file.filename == "/" || seen[file.filename] == true {
+            continue /* A directory may be keyed twice, see dispatch() */
+        }
+        seen[file.filename] = true
+
+        e := entryInfo(file)
+        if opts.match(&e) == false || (opts.After != nil && less(opts.After, &e) == false) {
+            continue
+        }
+        output = append(output, e)
+    }
+
+    sort.Slice(output, func (i, j int) bool {
+        return less(&output[i], &output[j])
+    })
+
+    if opts.Offset >= len(output) {
+        return []EntryInfo{}, nil
+    }
+    if opts.Offset > 0 {
+        output = output[opts.Offset:]
+    }
+    if opts.Limit > 0 && len(output) > opts.Limit {
+        output = output[:opts.Limit]
+    }
+
+    return output, nil
+}
+
+/*
+ * Returns the entry of one file or directory
+ */
+func (f *FSHeader) Stat(name string) (EntryInfo, error) {
+    if f.isClosed() {
+        return EntryInfo{}, ErrClosed
+    }
+    if err := f.syncPath(name); err != nil {
+        return EntryInfo{}, err
+    }
+
+    file := f.check(name)
+    if file == nil {
+        return EntryInfo{}, pathError("stat", name, ErrNotExist)
+    }
+
+    return entryInfo(file), nil
+}
+
+func entryInfo(file *govfsFile) EntryInfo {
+    file.lock.Lock()
+    defer file.lock.Unlock()
+
+    e := EntryInfo{ Name: file.filename, Dir: (file.flags & FLAG_DIRECTORY) > 0, ModTime: file.modTime() }
+    if e.Dir == false && file.size > 0 {
+        e.Size, e.Checksum, e.Algorithm = file.size, file.dataSum(), checksumName(file.sumAlgorithm())
+    }
+    e.Generation = file.generation()
+
+    return e
+}
+
+func (opts *ListOptions) match(e *EntryInfo) bool {
+    switch {
+    case opts.Type == LIST_FILES && e.Dir == true, opts.Type == LIST_DIRS && e.Dir == false:
+        return false
+    case e.Size < opts.MinSize, opts.MaxSize > 0 && e.Size > opts.MaxSize:
+        return false
+    case opts.ModifiedSince.IsZero() == false && e.ModTime.Before(opts.ModifiedSince):
+        return false
+    }
+
+    return strings.HasPrefix(path.Base(strings.TrimSuffix(e.Name, "/")), opts.Prefix)
+}
+
+/*
+ * The order of the entries, the names break ties so that it is total
+ */
+func entryLess(by ListSort, reverse bool) func (a, b *EntryInfo) bool {
+    less := func (a, b *EntryInfo) bool {
+        switch by {
+        case SORT_SIZE:
+            if a.Size != b.Size {
+                return a.Size < b.Size
+            }
+        case SORT_MODTIME:
+            if a.ModTime.Equal(b.ModTime) == false {
+                return a.ModTime.Before(b.ModTime)
+            }
+        }
+        return a.Name < b.Name
+    }
+
+    if reverse == true {
+        return func (a, b *EntryInfo) bool {
+            return less(b, a)
+        }
+    }
+    return less
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+func listNames(entries []EntryInfo) string {
+    var names []string
+    for _, e := range entries {
+        names = append(names, e.Name)
+    }
+    return strings.Join(names, " ")
+}
+
+func TestList(t *testing.T) {
+    debugOut("[+] Running Structured Listing Test...")
+
+    header, err := CreateDatabase("structured_list", FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/docs/b.txt")
+    header.Write("/docs/b.txt", []byte("bb"))
+    header.Create("/docs/a.txt")
+    header.Write("/docs/a.txt", []byte("aaaa"))
+    header.Create("/c.txt")
+    header.Write("/c.txt", []byte("c"))
+    header.Create("/empty/")
+    header.check("/c.txt").modtime = time.Now().Add(time.Hour).UnixNano()
+
+    entries, err := header.List(ListOptions{})
+    if err != nil || listNames(entries) != "/c.txt /docs/ /docs/a.txt /docs/b.txt /empty/" {
+        drive_fail("TEST2: Invalid listing: " + listNames(entries), t)
+    }
+    a := entries[2]
+    if a.Dir == true || a.Size != 4 || a.Checksum != checksumOf(ChecksumSHA256, []byte("aaaa")) ||
+        a.Algorithm != "sha256" || a.ModTime.IsZero() {
+        drive_fail("TEST3: Invalid entry of a file", t)
+    }
+    if entries[1].Dir == false || entries[1].Size != 0 || entries[1].Checksum != "" {
+        drive_fail("TEST4: Invalid entry of a directory", t)
+    }
+
+    entries, _ = header.List(ListOptions{ Sort: SORT_SIZE, Reverse: true })
+    if listNames(entries) != "/docs/a.txt /docs/b.txt /c.txt /empty/ /docs/" {
+        drive_fail("TEST5: Invalid listing by size: " + listNames(entries), t)
+    }
+    entries, _ = header.List(ListOptions{ Sort: SORT_MODTIME, Offset: 4 })
+    if listNames(entries) != "/c.txt" {
+        drive_fail("TEST6: Invalid listing by modification time: " + listNames(entries), t)
+    }
+
+    entries, _ = header.List(ListOptions{ Dir: "/docs", Offset: 1, Limit: 1 })
+    if listNames(entries) != "/docs/b.txt" {
+        drive_fail("TEST7: Invalid page of a directory: " + listNames(entries), t)
+    }
+    if entries, err := header.List(ListOptions{ Offset: 10 }); err != nil || len(entries) != 0 {
+        drive_fail("TEST8: Invalid listing past the end", t)
+    }
+    if _, err := header.List(ListOptions{ Dir: "/c.txt" }); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST9: Listed a directory which does not exist", t)
+    }
+
+    debugOut("[+] Structured Listing Test PASS")
+}
+
+func TestListFilters(t *testing.T) {
+    debugOut("[+] Running Listing Filter Test...")
+
+    header, err := CreateDatabase("list_filters", FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    for i, name := range []string{ "/big/img1.png", "/big/img2.png", "/big/notes.txt", "/big/sub/img3.png" } {
+        header.Create(name)
+        header.Write(name, make([]byte, (i + 1) * 10))
+    }
+    since := time.Now()
+    header.check("/big/img1.png").modtime = since.Add(-time.Hour).UnixNano()
+
+    entries, _ := header.List(ListOptions{ Dir: "/big/", Shallow: true })
+    if listNames(entries) != "/big/img1.png /big/img2.png /big/notes.txt /big/sub/" {
+        drive_fail("TEST2: Invalid shallow listing: " + listNames(entries), t)
+    }
+    entries, _ = header.List(ListOptions{ Dir: "/big/", Prefix: "img", Type: LIST_FILES })
+    if listNames(entries) != "/big/img1.png /big/img2.png /big/sub/img3.png" {
+        drive_fail("TEST3: Invalid listing by prefix: " + listNames(entries), t)
+    }
+    entries, _ = header.List(ListOptions{ Type: LIST_DIRS })
+    if listNames(entries) != "/big/ /big/sub/" {
+        drive_fail("TEST4: Invalid listing of directories: " + listNames(entries), t)
+    }
+    entries, _ = header.List(ListOptions{ MinSize: 20, MaxSize: 30 })
+    if listNames(entries) != "/big/img2.png /big/notes.txt" {
+        drive_fail("TEST5: Invalid listing by size: " + listNames(entries), t)
+    }
+    entries, _ = header.List(ListOptions{ Type: LIST_FILES, ModifiedSince: since.Add(-time.Minute) })
+    if listNames(entries) != "/big/img2.png /big/notes.txt /big/sub/img3.png" {
+        drive_fail("TEST6: Invalid listing by modification time: " + listNames(entries), t)
+    }
+
+    /* Pages continue after the last entry, even when an earlier one was deleted meanwhile */
+    opts := ListOptions{ Type: LIST_FILES, Sort: SORT_SIZE, Reverse: true, Limit: 2 }
+    page, _ := header.List(opts)
+    if listNames(page) != "/big/sub/img3.png /big/notes.txt" {
+        drive_fail("TEST7: Invalid first page: " + listNames(page), t)
+    }
+    header.Delete("/big/sub/img3.png")
+    opts.After = &page[len(page) - 1]
+    page, _ = header.List(opts)
+    if listNames(page) != "/big/img2.png /big/img1.png" {
+        drive_fail("TEST8: Invalid second page: " + listNames(page), t)
+    }
+
+    debugOut("[+] Listing Filter Test PASS")
+}
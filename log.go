@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "time"
+)
+
+/*
+ * Structured events for DBConfig.Logger. Every IRP processed by the IO controller is
+ *  logged, as are loads and commits of the database and other storage operations.
+ */
+type LogEvent struct {
+    Op          string /* One of the LOG_* constants */
+    Path        string /* The file, or the database name for LOG_LOAD/LOG_COMMIT */
+    Size        int /* Bytes written, loaded or committed */
+    Duration    time.Duration
+    Err         error
+}
+
+type Logger interface {
+    Log(event LogEvent)
+}
+
+const (
+    LOG_CREATE                string    = "create"
+    LOG_READ                  string    = "read" /* Only counted by Stats(), reads are not logged */
+    LOG_WRITE                 string    = "write"
+    LOG_APPEND                string    = "append"
+    LOG_DELETE                string    = "delete"
+    LOG_SHRED                 string    = "shred"
+    LOG_PURGE                 string    = "purge"
+    LOG_XATTR                 string    = "xattr" /* An extended attribute was set or removed */
+    LOG_LOAD                  string    = "load" /* The database */
+    LOG_LOAD_RECORD           string    = "load_record" /* The data of one file from DBConfig.Records */
+    LOG_COMMIT                string    = "commit"
+    LOG_REPLICATE             string    = "replicate" /* A replication session ended, Path is the follower */
+    LOG_SCRUB                 string    = "scrub" /* The scrubber verified a file, Err is ErrChecksum if it was corrupt */
+)
+
+func (c *DBConfig) logEvent(op string, path string, size int, start time.Time, err error) {
+    if c.Logger == nil {
+        return
+    }
+
+    c.Logger.Log(LogEvent{
+        Op: op,
+        Path: path,
+        Size: size,
+        Duration: time.Since(start),
+        Err: err,
+    })
+}
+
+/*
+ * Counts an operation in Stats() and logs it
+ */
+func (f *FSHeader) observe(op string, path string, size int, start time.Time, err error) {
+    f.op_stats.add(op, size, time.Since(start), err)
+    if op != LOG_READ {
+        f.config.logEvent(op, path, size, start, err)
+    }
+}
+
+/*
+ * Observes an IRP once dispatch() processed it
+ */
+func (f *FSHeader) observeIRP(ioh *govfsIoBlock, start time.Time) {
+    if op := irpOp(ioh); op != "" {
+        f.observe(op, ioh.name, len(ioh.data), start, ioh.status)
+    }
+}
+
+/*
+ * The LOG_* operation of an IRP, "" if it is not logged
+ */
+func irpOp(ioh *govfsIoBlock) string {
+    switch ioh.operation {
+    case IRP_CREATE:
+        return LOG_CREATE
+    case IRP_WRITE:
+        if (ioh.flags & FLAG_APPEND) > 0 {
+            return LOG_APPEND
+        }
+        return LOG_WRITE
+    case IRP_DELETE:
+        if (ioh.flags & FLAG_SHRED) > 0 {
+            return LOG_SHRED
+        }
+        return LOG_DELETE
+    case IRP_PURGE:
+        return LOG_PURGE
+    case IRP_XATTR:
+        return LOG_XATTR
+    }
+
+    return ""
+}
@@ -0,0 +1,60 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+    "log/slog"
+)
+
+/*
+ * Returns a Logger which writes events to `logger`, failed operations at LevelError
+ *  and the others at LevelDebug
+ */
+func SlogLogger(logger *slog.Logger) Logger {
+    return slogLogger{ logger: logger }
+}
+
+type slogLogger struct {
+    logger      *slog.Logger
+}
+
+func (l slogLogger) Log(event LogEvent) {
+    var level = slog.LevelDebug
+    attrs := []slog.Attr{
+        slog.String("op", event.Op),
+        slog.String("path", event.Path),
+        slog.Int("size", event.Size),
+        slog.Duration("duration", event.Duration),
+    }
+    if event.Err != nil {
+        level = slog.LevelError
+        attrs = append(attrs, slog.String("error", event.Err.Error()))
+    }
+
+    l.logger.LogAttrs(context.Background(), level, "govfs " + event.Op, attrs...)
+}
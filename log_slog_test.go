@@ -0,0 +1,51 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "log/slog"
+)
+
+func TestSlogLogger(t *testing.T) {
+    var output bytes.Buffer
+    logger := SlogLogger(slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{ Level: slog.LevelDebug })))
+
+    logger.Log(LogEvent{ Op: LOG_WRITE, Path: "/file", Size: 5 })
+    logger.Log(LogEvent{ Op: LOG_DELETE, Path: "/file", Err: ErrTimeout })
+
+    lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+    if len(lines) != 2 || !strings.Contains(lines[0], "level=DEBUG") || !strings.Contains(lines[0], "path=/file") ||
+        !strings.Contains(lines[0], "size=5") {
+        t.Fatal("TEST1: Invalid slog output: ", output.String())
+    }
+    if !strings.Contains(lines[1], "level=ERROR") || !strings.Contains(lines[1], "timed out") {
+        t.Fatal("TEST2: Error was not logged: ", lines[1])
+    }
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "sync"
+    "testing"
+)
+
+type recordingLogger struct {
+    lock        sync.Mutex
+    events      []LogEvent
+}
+
+func (l *recordingLogger) Log(event LogEvent) {
+    l.lock.Lock()
+    l.events = append(l.events, event)
+    l.lock.Unlock()
+}
+
+func TestLogger(t *testing.T) {
+    debugOut("[+] Running Logger Test...")
+
+    logger := &recordingLogger{}
+    raw := gen_raw_filename("logger")
+    header, err := CreateDatabaseConfig(raw, FLAG_DB_CREATE, &DBConfig{ Logger: logger })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    header.Create("/file")
+    header.Write("/file", []byte("hello"))
+    header.Append("/file", []byte("!"))
+    header.Write("/missing", []byte("x")) /* Fails before reaching the IO controller */
+    header.Shred("/file")
+    header.Purge()
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit", t)
+    }
+    header.Close()
+
+    loaded, err := CreateDatabaseConfig(raw, FLAG_DB_LOAD, &DBConfig{ Logger: logger })
+    if loaded == nil || err != nil {
+        drive_fail("TEST3: Failed to load database", t)
+    }
+    loaded.Close()
+
+    expected := []struct{ op string; path string; size int }{
+        { LOG_CREATE, "/file", 0 },
+        { LOG_WRITE, "/file", 5 },
+        { LOG_APPEND, "/file", 1 },
+        { LOG_SHRED, "/file", 0 },
+        { LOG_PURGE, "/", 0 },
+        { LOG_COMMIT, raw, 0 },
+        { LOG_LOAD, raw, 0 },
+    }
+    if len(logger.events) != len(expected) {
+        drive_fail("TEST4: Unexpected number of events", t)
+    }
+    for i, event := range logger.events {
+        if event.Op != expected[i].op || event.Path != expected[i].path || event.Size != expected[i].size || event.Err != nil {
+            drive_fail("TEST5: Unexpected event " + event.Op, t)
+        }
+    }
+
+    /* Failed IRPs carry the error */
+    header, _ = CreateDatabaseConfig(raw, FLAG_DB_CREATE, &DBConfig{ Logger: logger, Direct: true })
+    header.StartIOController()
+    header.Create("/file")
+    irp := header.generateIRP("/file", nil, IRP_DELETE)
+    header.Delete("/file")
+    header.submit(irp)
+    if last := logger.events[len(logger.events) - 1]; last.Op != LOG_DELETE || last.Err == nil {
+        drive_fail("TEST6: Failed operation was not logged with its error", t)
+    }
+    header.Close()
+
+    debugOut("[+] Logger Test PASS")
+}
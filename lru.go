@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Memory budget for RecordStorage databases. When DBConfig.MemoryBudget is set, the
+ *  data of the least recently used files is dropped from memory once more than that
+ *  many bytes are resident, and read back from DBConfig.Records on the next access.
+ *
+ * Only clean files are evicted, i.e. files whose data matches their record as of the
+ *  last commit or load. Files written since are evicted after the next UnmountDB(), so
+ *  the resident size may exceed the budget until then.
+ */
+
+import (
+    "sync"
+    "container/list"
+)
+
+type lruCache struct {
+    lock        sync.Mutex
+    budget      int
+    order       *list.List /* *govfsFile, the front is the most recently used */
+    entries     map[*govfsFile]*lruEntry
+    resident    int /* Bytes of govfsFile.data of the files in order */
+    hits        uint64
+    misses      uint64
+    evictions   uint64
+}
+
+type lruEntry struct {
+    element     *list.Element
+    size        int
+}
+
+/*
+ * Cache statistics since the database was created or loaded
+ */
+type CacheStats struct {
+    Budget      int /* DBConfig.MemoryBudget */
+    Resident    int /* Bytes of file data in memory */
+    Files       int /* Number of files whose data is in memory */
+    Hits        uint64 /* Reads of files whose data was in memory */
+    Misses      uint64 /* Reads which had to load the data from DBConfig.Records */
+    Evictions   uint64
+    HitRate     float64 /* Hits / (Hits + Misses), 0 before the first read */
+}
+
+func newLRUCache(budget int) *lruCache {
+    return &lruCache{
+        budget: budget,
+        order: list.New(),
+        entries: make(map[*govfsFile]*lruEntry),
+    }
+}
+
+/*
+ * Returns the cache statistics, or zero statistics if DBConfig.MemoryBudget is not set
+ */
+func (f *FSHeader) CacheStats() CacheStats {
+    if f.lru == nil {
+        return CacheStats{}
+    }
+
+    f.lru.lock.Lock()
+    defer f.lru.lock.Unlock()
+
+    output := CacheStats{
+        Budget: f.lru.budget,
+        Resident: f.lru.resident,
+        Files: len(f.lru.entries),
+        Hits: f.lru.hits,
+        Misses: f.lru.misses,
+        Evictions: f.lru.evictions,
+    }
+    if total := output.Hits + output.Misses; total > 0 {
+        output.HitRate = float64(output.Hits) / float64(total)
+    }
+
+    return output
+}
+
+/*
+ * Called by Read() for every read of a file's data, `hit` is false if the data had to
+ *  be loaded. The caller holds file.lock.
+ */
+func (f *FSHeader) cacheRead(file *govfsFile, hit bool) {
+    if f.lru == nil || file.size == 0 || file.spill != nil {
+        return
+    }
+
+    f.lru.lock.Lock()
+    if hit == true {
+        f.lru.hits++
+    } else {
+        f.lru.misses++
+    }
+    f.lru.lock.Unlock()
+
+    f.cacheUpdate(file)
+}
+
+/*
+ * Marks a file as the most recently used and accounts for the size of its data, then
+ *  evicts down to the budget. The caller holds file.lock.
+ */
+func (f *FSHeader) cacheUpdate(file *govfsFile) {
+    if f.lru == nil {
+        return
+    }
+
+    f.lru.lock.Lock()
+    defer f.lru.lock.Unlock()
+
+    f.lru.set(file, len(file.data))
+    f.lru.evict(f, f.lru.overBudget)
+}
+
+/*
+ * Called once a file is deleted. The caller holds file.lock.
+ */
+func (f *FSHeader) cacheRemove(file *govfsFile) {
+    if f.lru == nil {
+        return
+    }
+
+    f.lru.lock.Lock()
+    f.lru.set(file, 0)
+    f.lru.lock.Unlock()
+}
+
+/*
+ * Evicts down to the budget, called after a commit made files clean
+ */
+func (f *FSHeader) cacheTrim() {
+    if f.lru == nil {
+        return
+    }
+
+    f.lru.lock.Lock()
+    defer f.lru.lock.Unlock()
+
+    f.lru.evict(f, f.lru.overBudget)
+}
+
+/*
+ * Evicts until `fits` returns true, see checkMemory()
+ */
+func (f *FSHeader) cacheEvict(fits func () bool) {
+    if f.lru == nil {
+        return
+    }
+
+    f.lru.lock.Lock()
+    defer f.lru.lock.Unlock()
+
+    f.lru.evict(f, func () bool { return fits() == false })
+}
+
+func (c *lruCache) overBudget() bool {
+    return c.resident > c.budget
+}
+
+func (c *lruCache) set(file *govfsFile, size int) {
+    entry, ok := c.entries[file]
+    if size == 0 {
+        if ok {
+            c.resident -= entry.size
+            c.order.Remove(entry.element)
+            delete(c.entries, file)
+        }
+        return
+    }
+
+    if ok {
+        c.resident += size - entry.size
+        entry.size = size
+        c.order.MoveToFront(entry.element)
+    } else {
+        c.entries[file] = &lruEntry{ element: c.order.PushFront(file), size: size }
+        c.resident += size
+    }
+}
+
+/*
+ * Drops the data of the least recently used clean files while `over` returns true. Files which are locked by someone else are skipped rather than
+ *  waited for, the caller may hold the lock of another file.
+ */
+func (c *lruCache) evict(f *FSHeader, over func () bool) {
+    for e := c.order.Back(); e != nil && over() == true; {
+        file := e.Value.(*govfsFile)
+        e = e.Prev()
+
+        if file.lock.TryLock() == false {
+            continue
+        }
+        if f.evictable(file) == true {
+            f.adjustMemory(-residentSize(file))
+            wipeBuffer(file.data, false)
+            file.data = nil
+            file.unload()
+            c.set(file, 0)
+            c.evictions++
+        }
+        file.lock.Unlock()
+    }
+}
+
+/*
+ * A file can be evicted if its data can be read back from DBConfig.Records. The caller
+ *  holds file.lock.
+ */
+func (f *FSHeader) evictable(file *govfsFile) bool {
+    return file.stored() != nil && file.record() == nil && file.spill == nil &&
+        len(file.data) > 0 && file.stored().RawSum == file.dataSum()
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestMemoryBudget(t *testing.T) {
+    debugOut("[+] Running Memory Budget Test...")
+
+    if _, err := CreateDatabaseConfig("budget", FLAG_DB_CREATE, &DBConfig{ MemoryBudget: 1 }); err == nil {
+        drive_fail("TEST1: MemoryBudget without a RecordStorage was accepted", t)
+    }
+
+    records := newMemRecords()
+    config := &DBConfig{ Records: records, MemoryBudget: 2500 }
+    header, err := CreateDatabaseConfig("budget", FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST2: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    names := []string{ "/a", "/b", "/c", "/d" }
+    for i, name := range names {
+        header.Create(name)
+        header.Write(name, bytes.Repeat([]byte{ byte('a' + i) }, 1000))
+    }
+
+    /* Nothing is committed yet, so nothing can be evicted */
+    if stats := header.CacheStats(); stats.Resident != 4000 || stats.Evictions != 0 {
+        drive_fail("TEST3: Dirty files were evicted", t)
+    }
+
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST4: Failed to commit", t)
+    }
+    stats := header.CacheStats()
+    if stats.Resident > 2500 || stats.Evictions != 2 || stats.Files != 2 {
+        drive_fail("TEST5: Commit did not evict down to the budget", t)
+    }
+    if header.check("/a").data != nil || header.check("/d").data == nil {
+        drive_fail("TEST6: Evicted files are not the least recently used", t)
+    }
+
+    /* Reading an evicted file loads it and evicts the next least recently used one */
+    reads := records.reads
+    if data, err := header.Read("/a"); err != nil || !bytes.Equal(data, bytes.Repeat([]byte{ 'a' }, 1000)) {
+        drive_fail("TEST7: Failed to read an evicted file", t)
+    }
+    if records.reads != reads + 1 || header.check("/c").data != nil {
+        drive_fail("TEST8: Evicted file was not reloaded", t)
+    }
+    header.Read("/a")
+
+    stats = header.CacheStats()
+    if stats.Hits != 1 || stats.Misses != 1 || stats.HitRate != 0.5 || stats.Evictions != 3 {
+        drive_fail("TEST9: Invalid cache statistics", t)
+    }
+
+    /* A write makes the file dirty, it stays resident */
+    header.Write("/b", []byte("changed"))
+    header.Read("/c")
+    header.Read("/d")
+    if data, _ := header.Read("/b"); string(data) != "changed" {
+        drive_fail("TEST10: Dirty file was evicted", t)
+    }
+
+    header.Delete("/a")
+    if stats := header.CacheStats(); stats.Resident > 2500 + len("changed") {
+        drive_fail("TEST11: Deleted file is still accounted for", t)
+    }
+    header.Close()
+
+    debugOut("[+] Memory Budget Test PASS")
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Manifests list every path of the database with its size, digest and flags, so that
+ *  external systems can audit the contents of a database without loading its data.
+ *  The digests are the checksums kept with each file, see DBConfig.Checksum, so
+ *  exporting reads no data, and neither does verifying unless a file was summed with
+ *  another algorithm than the manifest records.
+ *
+ * JSON manifests are an array of ManifestEntry. CSV manifests have a header row and the
+ *  columns path, size, algorithm, digest and flags, the flags separated by spaces.
+ */
+
+import (
+    "io"
+    "bufio"
+    "strconv"
+    "strings"
+    "encoding/csv"
+    "encoding/json"
+)
+
+type ManifestFormat int
+
+const (
+    MANIFEST_JSON             ManifestFormat = iota
+    MANIFEST_CSV
+)
+
+const (
+    MANIFEST_APPEND_ONLY      string    = "append-only" /* See CreateAppendOnly() */
+    MANIFEST_HASH_CHAIN       string    = "hash-chain"
+)
+
+type ManifestEntry struct {
+    Path        string      `json:"path"` /* Directories with a trailing "/" */
+    Size        int         `json:"size"`
+    Algorithm   string      `json:"algorithm,omitempty"` /* "" for directories and empty files */
+    Digest      string      `json:"digest,omitempty"`
+    Flags       []string    `json:"flags,omitempty"` /* MANIFEST_* */
+}
+
+/*
+ * The differences found by VerifyAgainstManifest(), by path
+ */
+type ManifestReport struct {
+    Missing     []string /* In the manifest, but not in the database */
+    Extra       []string /* In the database, but not in the manifest */
+    Changed     []string /* In both, with another size, digest or flags */
+}
+
+func (r *ManifestReport) OK() bool {
+    return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Changed) == 0
+}
+
+var manifest_columns = []string{ "path", "size", "algorithm", "digest", "flags" }
+
+/*
+ * Writes a JSON manifest of every file and directory, sorted by path
+ */
+func (f *FSHeader) ExportManifest(w io.Writer) error {
+    return f.ExportManifestFormat(w, MANIFEST_JSON)
+}
+
+func (f *FSHeader) ExportManifestFormat(w io.Writer, format ManifestFormat) error {
+    entries, err := f.manifest()
+    if err != nil {
+        return err
+    }
+
+    if format == MANIFEST_JSON {
+        e := json.NewEncoder(w)
+        e.SetIndent("", "  ")
+        return e.Encode(entries)
+    }
+
+    c := csv.NewWriter(w)
+    c.Write(manifest_columns)
+    for _, e := range entries {
+        c.Write([]string{ e.Path, strconv.Itoa(e.Size), e.Algorithm, e.Digest, strings.Join(e.Flags, " ") })
+    }
+    c.Flush()
+
+    return c.Error()
+}
+
+/*
+ * Compares the database to a manifest of either format. The error is only set if the
+ *  manifest cannot be read, differences are returned in the report
+ */
+func (f *FSHeader) VerifyAgainstManifest(r io.Reader) (*ManifestReport, error) {
+    expected, err := readManifest(r)
+    if err != nil {
+        return nil, err
+    }
+    entries, err := f.manifest()
+    if err != nil {
+        return nil, err
+    }
+
+    report := &ManifestReport{}
+    actual := make(map[string]ManifestEntry)
+    for _, e := range entries {
+        actual[e.Path] = e
+    }
+
+    for _, m := range expected {
+        e, ok := actual[m.Path]
+        if ok == false {
+            report.Missing = append(report.Missing, m.Path)
+            continue
+        }
+        delete(actual, m.Path)
+
+        if e.Size != m.Size || strings.Join(e.Flags, " ") != strings.Join(m.Flags, " ") ||
+            f.digestMatches(e, m) == false {
+            report.Changed = append(report.Changed, m.Path)
+        }
+    }
+    for _, e := range entries {
+        if _, ok := actual[e.Path]; ok == true {
+            report.Extra = append(report.Extra, e.Path)
+        }
+    }
+
+    return report, nil
+}
+
+/*
+ * Only reads the data of a file which was summed with another algorithm than `m`
+ */
+func (f *FSHeader) digestMatches(e ManifestEntry, m ManifestEntry) bool {
+    if e.Algorithm == m.Algorithm {
+        return e.Digest == m.Digest
+    }
+
+    c := checksumByName(m.Algorithm)
+    if c == nil {
+        return false
+    }
+    data, err := f.Read(e.Path)
+    if err != nil {
+        return false
+    }
+    defer wipeBuffer(data, false)
+
+    return checksumOf(c, data) == m.Digest
+}
+
+func (f *FSHeader) manifest() ([]ManifestEntry, error) {
+    /* Buffered writes would not be in the digests */
+    if err := f.Sync(); err != nil {
+        return nil, err
+    }
+    list, err := f.List(ListOptions{})
+    if err != nil {
+        return nil, err
+    }
+
+    entries := make([]ManifestEntry, 0, len(list))
+    for _, e := range list {
+        m := ManifestEntry{ Path: e.Name, Size: e.Size, Algorithm: e.Algorithm, Digest: e.Checksum }
+        if file := f.check(e.Name); file != nil {
+            if (file.flags & FLAG_APPEND_ONLY) > 0 {
+                m.Flags = append(m.Flags, MANIFEST_APPEND_ONLY)
+            }
+            if (file.flags & FLAG_HASH_CHAIN) > 0 {
+                m.Flags = append(m.Flags, MANIFEST_HASH_CHAIN)
+            }
+        }
+        entries = append(entries, m)
+    }
+
+    return entries, nil
+}
+
+/*
+ * Reads a manifest of either format, JSON manifests start with "["
+ */
+func readManifest(r io.Reader) ([]ManifestEntry, error) {
+    b := bufio.NewReader(r)
+    for {
+        c, err := b.ReadByte()
+        if err != nil {
+            return nil, err
+        }
+        if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+            continue
+        }
+        b.UnreadByte()
+
+        if c == '[' {
+            var entries []ManifestEntry
+            if err := json.NewDecoder(b).Decode(&entries); err != nil {
+                return nil, err
+            }
+            return entries, nil
+        }
+        break
+    }
+
+    rows, err := csv.NewReader(b).ReadAll()
+    if err != nil {
+        return nil, err
+    }
+    if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(manifest_columns, ",") {
+        return nil, retErrStr("manifest: Unknown format")
+    }
+
+    var entries []ManifestEntry
+    for _, row := range rows[1:] {
+        size, err := strconv.Atoi(row[1])
+        if err != nil {
+            return nil, retErrStr("manifest: Invalid size of " + row[0])
+        }
+        e := ManifestEntry{ Path: row[0], Size: size, Algorithm: row[2], Digest: row[3] }
+        if row[4] != "" {
+            e.Flags = strings.Split(row[4], " ")
+        }
+        entries = append(entries, e)
+    }
+
+    return entries, nil
+}
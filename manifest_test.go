@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestManifest(t *testing.T) {
+    debugOut("[+] Running Manifest Test...")
+
+    header, err := CreateDatabaseConfig("manifest", FLAG_DB_CREATE, &DBConfig{ Checksum: ChecksumBLAKE3 })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/docs/")
+    header.Create("/docs/a")
+    header.Create("/docs/b")
+    header.CreateAppendOnly("/log", true)
+    header.Write("/docs/a", []byte("alpha"))
+    header.Write("/docs/b", []byte("beta"))
+    header.Append("/log", []byte("entry"))
+
+    for _, format := range []ManifestFormat{ MANIFEST_JSON, MANIFEST_CSV } {
+        var manifest bytes.Buffer
+        if err := header.ExportManifestFormat(&manifest, format); err != nil {
+            drive_fail("TEST2: ExportManifest() failed", t)
+        }
+        if report, err := header.VerifyAgainstManifest(bytes.NewReader(manifest.Bytes())); err != nil || report.OK() == false {
+            drive_fail("TEST3: Database does not match its own manifest", t)
+        }
+    }
+
+    var manifest bytes.Buffer
+    header.ExportManifest(&manifest)
+    if strings.Contains(manifest.String(), "\"append-only\"") == false {
+        drive_fail("TEST4: Manifest does not record the flags", t)
+    }
+
+    header.Write("/docs/a", []byte("changed"))
+    header.Delete("/docs/b")
+    header.Create("/new")
+    report, err := header.VerifyAgainstManifest(&manifest)
+    if err != nil || len(report.Changed) != 1 || report.Changed[0] != "/docs/a" || len(report.Missing) != 1 ||
+        report.Missing[0] != "/docs/b" || len(report.Extra) != 1 || report.Extra[0] != "/new" {
+        drive_fail("TEST5: Unexpected manifest report", t)
+    }
+
+    /* A digest of another algorithm is computed from the data */
+    csv := "path,size,algorithm,digest,flags\n/docs/a,7,sha256," + checksumOf(ChecksumSHA256, []byte("changed")) + ",\n"
+    report, err = header.VerifyAgainstManifest(strings.NewReader(csv))
+    if err != nil || len(report.Changed) != 0 || len(report.Missing) != 0 {
+        drive_fail("TEST6: Digest of another algorithm did not match", t)
+    }
+
+    if _, err := header.VerifyAgainstManifest(strings.NewReader("name,size\n")); err == nil {
+        drive_fail("TEST7: Manifest of an unknown format was accepted", t)
+    }
+}
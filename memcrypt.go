@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+/*
+ * In-memory encryption of file data. When DBConfig.EncryptMemory is set, every
+ *  govfsFile.data buffer is sealed with an ephemeral key which is generated when the
+ *  database is created/loaded and never leaves the process. Plaintext only exists in
+ *  the transient buffers returned by openData(), i.e. during Read and UnmountDB.
+ */
+
+import (
+    "io"
+    "time"
+    "crypto/rand"
+
+    "golang.org/x/crypto/chacha20poly1305"
+)
+
+func (f *FSHeader) initMemoryCipher() error {
+    key := make([]byte, chacha20poly1305.KeySize)
+    defer ZeroKey(key)
+
+    if _, err := io.ReadFull(rand.Reader, key); err != nil {
+        return err
+    }
+
+    aead, err := chacha20poly1305.NewX(key)
+    if err != nil {
+        return err
+    }
+    f.mem_cipher = aead
+
+    /* Seal anything that was loaded from the raw fs stream */
+    for _, v := range f.files() {
+        if len(v.data) == 0 {
+            continue
+        }
+
+        sealed, err := f.sealData(v.data)
+        if err != nil {
+            return err
+        }
+        wipeBuffer(v.data, false)
+        v.data = sealed
+    }
+
+    return nil
+}
+
+/*
+ * Returns the buffer to be stored in govfsFile.data for the plaintext `data`. The
+ *  returned buffer never aliases `data`.
+ */
+func (f *FSHeader) sealData(data []byte) ([]byte, error) {
+    if f.mem_cipher == nil {
+        output := make([]byte, len(data))
+        copy(output, data)
+        return output, nil
+    }
+
+    nonce := make([]byte, f.mem_cipher.NonceSize(), f.mem_cipher.NonceSize() + len(data) + f.mem_cipher.Overhead())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return nil, err
+    }
+
+    return f.mem_cipher.Seal(nonce, nonce, data, nil), nil
+}
+
+/*
+ * Returns a copy of the plaintext contents of a file, which the caller owns
+ */
+func (f *FSHeader) openData(file *govfsFile) ([]byte, error) {
+    file.lock.Lock()
+    defer file.lock.Unlock()
+
+    return f.unsealData(file)
+}
+
+/*
+ * Reads the data of a file which is still in DBConfig.Records. The caller holds file.lock
+ */
+func (f *FSHeader) loadUnloaded(file *govfsFile) error {
+    if file.record() == nil {
+        return nil
+    }
+
+    start := time.Now()
+    err := f.loadRecord(file)
+    f.observe(LOG_LOAD_RECORD, file.filename, file.size, start, err)
+    if err != nil {
+        return err
+    }
+    f.adjustMemory(residentSize(file))
+    f.cacheUpdate(file)
+
+    return nil
+}
+
+/*
+ * openData() for callers which already hold file.lock
+ */
+func (f *FSHeader) unsealData(file *govfsFile) ([]byte, error) {
+    return f.unsealDataInto(file, nil)
+}
+
+/*
+ * unsealData() which reuses the capacity of `buf` if it is large enough
+ */
+func (f *FSHeader) unsealDataInto(file *govfsFile, buf []byte) ([]byte, error) {
+    if err := f.loadUnloaded(file); err != nil {
+        return nil, err
+    }
+    if file.spill != nil {
+        return f.spillRead(file, buf)
+    }
+    data := file.data
+
+    if f.mem_cipher == nil || len(data) == 0 {
+        output := growBuffer(buf, len(data))
+        copy(output, data)
+        return output, nil
+    }
+
+    if len(data) < f.mem_cipher.NonceSize() + f.mem_cipher.Overhead() {
+        return nil, retErrStr("openData: Sealed data is too short")
+    }
+
+    nonce := data[:f.mem_cipher.NonceSize()]
+    output, err := f.mem_cipher.Open(buf[:0], nonce, data[f.mem_cipher.NonceSize():], nil)
+    if err != nil {
+        return nil, retErrStr("openData: In-memory data failed authentication")
+    }
+
+    return output, nil
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+)
+
+func TestMemoryEncryption(t *testing.T) {
+    debugOut("[+] Running In-Memory Encryption Test...")
+
+    var filename = gen_raw_filename("test_memcrypt")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ EncryptMemory: true }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    data := []byte("plaintext that must not be resident")
+    header.Create("/file0")
+    if err := header.Write("/file0", data); err != nil {
+        drive_fail("TEST2: Failed to write file0", t)
+    }
+
+    if bytes.Contains(header.check("/file0").data, data) {
+        drive_fail("TEST3: Plaintext is stored in memory", t)
+    }
+    if size, _ := header.GetFileSize("/file0"); size != uint(len(data)) {
+        drive_fail("TEST4: Invalid plaintext size", t)
+    }
+    if output, err := header.Read("/file0"); err != nil || !bytes.Equal(output, data) {
+        drive_fail("TEST5: Failed to read sealed data", t)
+    }
+
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST6: Failed to commit database", t)
+    }
+
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, config)
+    if loaded == nil || err != nil {
+        drive_fail("TEST7: Failed to load database", t)
+    }
+    if bytes.Contains(loaded.check("/file0").data, data) {
+        drive_fail("TEST8: Loaded plaintext is stored in memory", t)
+    }
+    if output, _ := loaded.Read("/file0"); !bytes.Equal(output, data) {
+        drive_fail("TEST9: Data mismatch after load", t)
+    }
+
+    debugOut("[+] In-Memory Encryption Test PASS")
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Global memory limit. DBConfig.MaxMemory bounds the plaintext size of the file data
+ *  held in memory, i.e. excluding spilled files and records which were not read yet.
+ *  A write which would exceed it is handled according to DBConfig.MemoryPolicy.
+ */
+
+type MemoryPolicy int
+
+const (
+    MEMORY_FAIL               MemoryPolicy = iota /* Fail the write with ErrNoSpace */
+    MEMORY_EVICT              /* Evict clean files as with DBConfig.MemoryBudget, requires DBConfig.Records */
+    MEMORY_SPILL              /* Keep the written file on the disk, see spill.go */
+)
+
+/*
+ * Returns the plaintext size of the file data held in memory
+ */
+func (f *FSHeader) MemoryUsage() int {
+    f.size_lock.Lock()
+    defer f.size_lock.Unlock()
+
+    return f.mem_size
+}
+
+/*
+ * The number of bytes a file accounts for in MemoryUsage(). The caller holds file.lock.
+ */
+func residentSize(file *govfsFile) int {
+    if file.record() != nil || file.spill != nil {
+        return 0
+    }
+
+    return file.size
+}
+
+func (f *FSHeader) adjustMemory(delta int) {
+    if delta == 0 {
+        return
+    }
+
+    f.size_lock.Lock()
+    f.mem_size += delta
+    f.size_lock.Unlock()
+}
+
+func (f *FSHeader) initMemoryUsage() {
+    for _, v := range f.files() {
+        f.mem_size += residentSize(v)
+    }
+}
+
+/*
+ * Called by dispatch() before `data` replaces the contents of a file. Returns true if
+ *  the data is to be spilled to the disk, or ErrNoSpace if it does not fit. The caller
+ *  holds file.lock.
+ */
+func (f *FSHeader) checkMemory(file *govfsFile, data []byte) (bool, error) {
+    if f.spills(len(data)) {
+        return true, nil
+    }
+    if f.config.MaxMemory <= 0 {
+        return false, nil
+    }
+
+    growth := len(data) - residentSize(file)
+    fits := func () bool {
+        return growth <= 0 || f.MemoryUsage() + growth <= f.config.MaxMemory
+    }
+    if fits() == true {
+        return false, nil
+    }
+
+    switch f.config.MemoryPolicy {
+    case MEMORY_EVICT:
+        f.cacheEvict(fits)
+        if fits() == true {
+            return false, nil
+        }
+    case MEMORY_SPILL:
+        return true, nil
+    }
+
+    return false, ErrNoSpace
+}
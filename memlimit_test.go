@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "errors"
+    "testing"
+)
+
+func TestMemoryLimit(t *testing.T) {
+    debugOut("[+] Running Memory Limit Test...")
+
+    block := bytes.Repeat([]byte("m"), 600)
+
+    /* MEMORY_FAIL */
+    header, err := CreateDatabaseConfig("memlimit", FLAG_DB_CREATE, &DBConfig{ MaxMemory: 1000 })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/a")
+    header.Create("/b")
+    if err := header.Write("/a", block); err != nil || header.MemoryUsage() != 600 {
+        drive_fail("TEST2: Write within the limit failed", t)
+    }
+    if err := header.Write("/b", block); !errors.Is(err, ErrNoSpace) {
+        drive_fail("TEST3: Write exceeding the limit did not fail with ErrNoSpace", t)
+    }
+    if err := header.Write("/a", bytes.Repeat([]byte("m"), 1000)); err != nil {
+        drive_fail("TEST4: Growing a file within the limit failed", t)
+    }
+    header.Delete("/a")
+    if err := header.Write("/b", block); err != nil || header.MemoryUsage() != 600 {
+        drive_fail("TEST5: Delete did not release memory", t)
+    }
+    header.Close()
+
+    /* MEMORY_SPILL */
+    header, err = CreateDatabaseConfig("memlimit", FLAG_DB_CREATE,
+        &DBConfig{ MaxMemory: 1000, MemoryPolicy: MEMORY_SPILL, SpillDir: t.TempDir() })
+    if header == nil || err != nil {
+        drive_fail("TEST6: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/a")
+    header.Create("/b")
+    header.Write("/a", block)
+    if err := header.Write("/b", block); err != nil || header.check("/b").spill == nil || header.MemoryUsage() != 600 {
+        drive_fail("TEST7: Write exceeding the limit was not spilled", t)
+    }
+    if data, err := header.Read("/b"); err != nil || !bytes.Equal(data, block) {
+        drive_fail("TEST8: Failed to read a spilled file", t)
+    }
+    header.Close()
+
+    /* MEMORY_EVICT */
+    if _, err := CreateDatabaseConfig("memlimit", FLAG_DB_CREATE, &DBConfig{ MaxMemory: 1000, MemoryPolicy: MEMORY_EVICT }); err == nil {
+        drive_fail("TEST9: MEMORY_EVICT without a RecordStorage was accepted", t)
+    }
+    header, err = CreateDatabaseConfig("memlimit", FLAG_DB_CREATE,
+        &DBConfig{ MaxMemory: 1000, MemoryPolicy: MEMORY_EVICT, Records: newMemRecords() })
+    if header == nil || err != nil {
+        drive_fail("TEST10: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/a")
+    header.Create("/b")
+    header.Create("/c")
+    header.Write("/a", block)
+    header.UnmountDB(0)
+    if err := header.Write("/b", block); err != nil || header.check("/a").data != nil || header.MemoryUsage() != 600 {
+        drive_fail("TEST11: Clean file was not evicted", t)
+    }
+    if err := header.Write("/c", block); !errors.Is(err, ErrNoSpace) {
+        drive_fail("TEST12: Dirty file was evicted", t)
+    }
+    if data, err := header.Read("/a"); err != nil || !bytes.Equal(data, block) {
+        drive_fail("TEST13: Failed to read an evicted file", t)
+    }
+    header.Close()
+
+    debugOut("[+] Memory Limit Test PASS")
+}
@@ -0,0 +1,304 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "sync"
+    "sync/atomic"
+)
+
+/*
+ * Number of independently locked partitions of the metadata table. Must be a power
+ *  of two, see shard()
+ */
+const META_SHARD_COUNT        int       = 64
+
+/*
+ * A shard's map is rebuilt once this many keys were removed from it and they outnumber
+ *  the remaining ones, as Go maps never release the buckets of deleted keys
+ */
+const META_COMPACT_THRESHOLD  int       = 1024
+
+/*
+ * The file metadata table, keyed by the name itself, so that two names can never share
+ *  an entry. Lookups from many goroutines only contend on the shard which holds the
+ *  key, rather than on a single lock. The number of keys and the keys in each directory
+ *  are maintained with every set() and remove(), so counting and listing a directory
+ *  never walk the whole table.
+ */
+type metaTable struct {
+    shards      [META_SHARD_COUNT]metaShard
+    total       int64 /* Keys in all shards, atomic */
+    tree_lock   sync.RWMutex /* Guards children */
+    children    map[string]map[*govfsFile]struct{} /* Files beneath each directory, by its name with a trailing "/" */
+}
+
+type metaShard struct {
+    lock        sync.RWMutex
+    files       map[string]*govfsFile
+    removed     int /* Keys removed since the map was last built, see compact() */
+}
+
+func newMetaTable() *metaTable {
+    m := new(metaTable)
+    for i := range m.shards {
+        m.shards[i].files = make(map[string]*govfsFile)
+    }
+    m.children = make(map[string]map[*govfsFile]struct{})
+
+    return m
+}
+
+func (m *metaTable) shard(key string) *metaShard {
+    return &m.shards[keyHash(key) & uint32(META_SHARD_COUNT - 1)]
+}
+
+/*
+ * FNV-1a of a name, which spreads names sharing a long prefix over the shards
+ */
+func keyHash(key string) uint32 {
+    var h uint32 = 2166136261
+    for i := 0; i < len(key); i += 1 {
+        h ^= uint32(key[i])
+        h *= 16777619
+    }
+
+    return h
+}
+
+func (m *metaTable) get(key string) *govfsFile {
+    sh := m.shard(key)
+    sh.lock.RLock()
+    defer sh.lock.RUnlock()
+
+    return sh.files[key]
+}
+
+func (m *metaTable) set(key string, file *govfsFile) {
+    sh := m.shard(key)
+    sh.lock.Lock()
+    defer sh.lock.Unlock()
+
+    old, ok := sh.files[key]
+    if ok == false {
+        atomic.AddInt64(&m.total, 1)
+    } else if old != file {
+        m.unlink(key, old)
+    }
+    if old != file {
+        m.link(key, file)
+    }
+    sh.files[key] = file
+}
+
+/*
+ * Removes the key, so that it is gone from every count and listing, and a file created
+ *  under the same name later is a new one. Returns false if there was no such key
+ */
+func (m *metaTable) remove(key string) bool {
+    sh := m.shard(key)
+    sh.lock.Lock()
+    defer sh.lock.Unlock()
+
+    old, ok := sh.files[key]
+    if ok == false {
+        return false
+    }
+    delete(sh.files, key)
+    atomic.AddInt64(&m.total, -1)
+    m.unlink(key, old)
+
+    sh.removed += 1
+    if sh.removed >= META_COMPACT_THRESHOLD && sh.removed > len(sh.files) {
+        sh.compact()
+    }
+
+    return true
+}
+
+/*
+ * Rebuilds the shard's map at the size of the remaining keys, freeing the memory of
+ *  the removed ones. The lock must be held
+ */
+func (sh *metaShard) compact() {
+    files := make(map[string]*govfsFile, len(sh.files))
+    for k, v := range sh.files {
+        files[k] = v
+    }
+    sh.files, sh.removed = files, 0
+}
+
+/*
+ * Compacts every shard from which any key was removed, see metaShard.compact()
+ */
+func (m *metaTable) gc() {
+    for i := range m.shards {
+        m.shards[i].lock.Lock()
+        if m.shards[i].removed > 0 {
+            m.shards[i].compact()
+        }
+        m.shards[i].lock.Unlock()
+    }
+}
+
+/*
+ * Adds the file of a key to the children of its directory. The shard lock of the key is
+ *  held. The children are kept by pointer rather than by key, which halves the size of
+ *  their entries; every key has its own file, see the implicit directories of IRP_CREATE
+ */
+func (m *metaTable) link(key string, file *govfsFile) {
+    parent := parentDir(key)
+    if parent == "" {
+        return /* The root */
+    }
+
+    m.tree_lock.Lock()
+    defer m.tree_lock.Unlock()
+
+    files := m.children[parent]
+    if files == nil {
+        files = make(map[*govfsFile]struct{})
+        m.children[parent] = files
+    }
+    files[file] = struct{}{}
+}
+
+func (m *metaTable) unlink(key string, file *govfsFile) {
+    parent := parentDir(key)
+
+    m.tree_lock.Lock()
+    defer m.tree_lock.Unlock()
+
+    if files := m.children[parent]; files != nil {
+        delete(files, file)
+        if len(files) == 0 {
+            delete(m.children, parent)
+        }
+    }
+}
+
+/*
+ * Returns the files and directories directly beneath `dir`, which has a trailing "/".
+ *  Takes time in the number of children only
+ */
+func (m *metaTable) list(dir string) []*govfsFile {
+    m.tree_lock.RLock()
+    defer m.tree_lock.RUnlock()
+
+    output := make([]*govfsFile, 0, len(m.children[dir]))
+    for file := range m.children[dir] {
+        output = append(output, file)
+    }
+
+    return output
+}
+
+/*
+ * Empties the table, and returns the files which it held
+ */
+func (m *metaTable) reset() []*govfsFile {
+    var output []*govfsFile
+    for i := range m.shards {
+        m.shards[i].lock.Lock()
+        for _, v := range m.shards[i].files {
+            output = append(output, v)
+        }
+        atomic.AddInt64(&m.total, -int64(len(m.shards[i].files)))
+        m.shards[i].files, m.shards[i].removed = make(map[string]*govfsFile), 0
+        m.shards[i].lock.Unlock()
+    }
+
+    m.tree_lock.Lock()
+    m.children = make(map[string]map[*govfsFile]struct{})
+    m.tree_lock.Unlock()
+
+    return output
+}
+
+/*
+ * Total number of files and directories, including the root
+ */
+func (m *metaTable) count() uint {
+    return uint(atomic.LoadInt64(&m.total))
+}
+
+/*
+ * Returns all files and directories. Shards are locked one at a time, so the
+ *  snapshot is not atomic with respect to concurrent creates or deletes.
+ */
+func (m *metaTable) snapshot() []*govfsFile {
+    var output []*govfsFile
+    for i := range m.shards {
+        m.shards[i].lock.RLock()
+        for _, v := range m.shards[i].files {
+            output = append(output, v)
+        }
+        m.shards[i].lock.RUnlock()
+    }
+
+    return output
+}
+
+/*
+ * Returns the keys of all files and directories. Implicitly created directories are
+ *  keyed without their trailing "/"
+ */
+func (m *metaTable) names() []string {
+    var output []string
+    for i := range m.shards {
+        m.shards[i].lock.RLock()
+        for k := range m.shards[i].files {
+            output = append(output, k)
+        }
+        m.shards[i].lock.RUnlock()
+    }
+
+    return output
+}
+
+/*
+ * The salted md5 of a name, by which the metadata table used to be keyed. Tools which
+ *  recorded those sums can map them back with ResolveSum()
+ */
+func PathSum(name string) string {
+    return s(name)
+}
+
+/*
+ * Returns the name of the file or directory whose PathSum() is `sum`. Hashes every
+ *  name, so it is meant for tooling rather than lookups
+ */
+func (f *FSHeader) ResolveSum(sum string) (string, bool) {
+    if f.isClosed() {
+        return "", false
+    }
+
+    for _, name := range f.meta.names() {
+        if s(name) == sum {
+            return name, true
+        }
+    }
+
+    return "", false
+}
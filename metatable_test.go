@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "sort"
+    "sync"
+    "strings"
+    "strconv"
+    "unsafe"
+)
+
+func TestMetaTable(t *testing.T) {
+    debugOut("[+] Running Sharded Metadata Test...")
+
+    m := newMetaTable()
+    used := make(map[*metaShard]bool)
+    for i := 0; i < 1024; i += 1 {
+        key := "/file" + strconv.Itoa(i)
+        m.set(key, &govfsFile{ filename: key })
+        used[m.shard(key)] = true
+    }
+    if len(used) != META_SHARD_COUNT {
+        drive_fail("TEST1: Keys are not spread across all shards", t)
+    }
+    if m.count() != 1024 || len(m.snapshot()) != 1024 {
+        drive_fail("TEST2: Unexpected file count", t)
+    }
+
+    /* Removed keys are gone from the count and the snapshot */
+    if m.remove("/file0") == false || m.remove("/file0") == true || m.get("/file0") != nil ||
+        m.count() != 1023 || len(m.snapshot()) != 1023 {
+        drive_fail("TEST3: Unexpected state after delete", t)
+    }
+    m.set("/file0", &govfsFile{ filename: "/file0" })
+
+    var wg sync.WaitGroup
+    for g := 0; g < 8; g += 1 {
+        wg.Add(1)
+        go func (g int) {
+            defer wg.Done()
+            for i := 0; i < 256; i += 1 {
+                key := "/g" + strconv.Itoa(g) + "/" + strconv.Itoa(i)
+                m.set(key, &govfsFile{ filename: key })
+                if m.get(key) == nil {
+                    t.Error("TEST4: Lost a concurrent insert")
+                    return
+                }
+            }
+        }(g)
+    }
+    wg.Wait()
+    if m.count() != 1024 + 8 * 256 {
+        drive_fail("TEST5: Unexpected file count after concurrent inserts", t)
+    }
+
+    debugOut("[+] Sharded Metadata Test PASS")
+}
+
+func TestDeleteRecreate(t *testing.T) {
+    debugOut("[+] Running Delete/Recreate Test...")
+
+    var filename = gen_raw_filename("delete_recreate")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    header.Create("/keep.txt")
+    header.Write("/keep.txt", []byte("keep"))
+    base := header.GetFileCount()
+
+    /* Enough cycles on one name to trigger the compaction of its shard */
+    for i := 0; i < META_COMPACT_THRESHOLD * 2; i += 1 {
+        if err := header.Create("/cycle/file"); err != nil {
+            drive_fail("TEST2: Failed to recreate a deleted file", t)
+        }
+        if size, _ := header.GetFileSize("/cycle/file"); size != 0 {
+            drive_fail("TEST3: Recreated file has the contents of the deleted one", t)
+        }
+        header.Write("/cycle/file", []byte("cycle " + strconv.Itoa(i)))
+        if err := header.Delete("/cycle/file"); err != nil {
+            drive_fail("TEST4: Failed to delete a file", t)
+        }
+    }
+    header.Delete("/cycle")
+    if header.GetFileCount() != base || header.Check("/cycle/file") == true ||
+        header.GetTotalFilesizes() != len("keep") {
+        drive_fail("TEST5: Deleted files are still accounted for", t)
+    }
+    if sh := header.meta.shard("/cycle/file"); sh.removed >= META_COMPACT_THRESHOLD {
+        drive_fail("TEST6: Shard was not compacted", t)
+    }
+
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST7: Failed to commit database", t)
+    }
+    for i := range header.meta.shards {
+        if header.meta.shards[i].removed != 0 {
+            drive_fail("TEST8: Commit did not compact the metadata table", t)
+        }
+    }
+    header.Close()
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST9: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+    if loaded.GetFileCount() != base || loaded.Check("/cycle/file") == true {
+        drive_fail("TEST10: Deleted file was committed", t)
+    }
+
+    debugOut("[+] Delete/Recreate Test PASS")
+}
+
+func TestDirectoryIndex(t *testing.T) {
+    debugOut("[+] Running Directory Index Test...")
+
+    header, err := CreateDatabase("directory_index", FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    for _, name := range []string{ "/docs/a.txt", "/docs/old/b.txt", "/docs/old/", "/x/docs/c.txt", "/d.txt" } {
+        header.Create(name)
+    }
+    if header.GetFileCount() != uint(len(header.files())) {
+        drive_fail("TEST2: File count differs from the metadata table", t)
+    }
+
+    list, err := header.GetFileListDirectory("/docs/")
+    sort.Strings(list)
+    if err != nil || strings.Join(list, " ") != "/docs/ /docs/a.txt /docs/old/ /docs/old/b.txt" {
+        drive_fail("TEST3: Invalid listing of a directory: " + strings.Join(list, " "), t)
+    }
+    if list, _ := header.GetFileListDirectory("/missing/"); list != nil {
+        drive_fail("TEST4: Listed a missing directory", t)
+    }
+
+    header.Delete("/docs/old/b.txt")
+    if list, _ := header.GetFileListDirectory("/docs/old/"); len(list) != 1 || list[0] != "/docs/old/" {
+        drive_fail("TEST5: Listing contains a deleted file", t)
+    }
+    if header.GetFileCount() != uint(len(header.files())) {
+        drive_fail("TEST6: File count differs from the metadata table after delete", t)
+    }
+
+    header.Purge()
+    if header.GetFileCount() != 1 || len(header.meta.list("/")) != 0 {
+        drive_fail("TEST7: Directory index was not emptied by a purge", t)
+    }
+
+    debugOut("[+] Directory Index Test PASS")
+}
+
+func TestFileOverhead(t *testing.T) {
+    /* Empty files carry no fileContents, see govfsFile */
+    if size := unsafe.Sizeof(govfsFile{}); size > 96 {
+        drive_fail("TEST1: govfsFile grew to " + strconv.Itoa(int(size)) + " bytes", t)
+    }
+
+    m := newMetaTable()
+    a, b := &govfsFile{ filename: "/dir/" }, &govfsFile{ filename: "/dir/" }
+    m.set("/dir/", a)
+    m.set("/dir", b)
+    if len(m.list("/")) != 2 {
+        drive_fail("TEST2: Both keys of a directory must be listed", t)
+    }
+    c := &govfsFile{ filename: "/dir/" }
+    m.set("/dir", c)
+    if files := m.list("/"); len(files) != 2 || (files[0] != b && files[1] != b) == false {
+        drive_fail("TEST3: Replaced file is still listed", t)
+    }
+    m.remove("/dir/")
+    m.remove("/dir")
+    if len(m.list("/")) != 0 || m.count() != 0 {
+        drive_fail("TEST4: Removed files are still listed", t)
+    }
+}
+
+func TestResolveSum(t *testing.T) {
+    debugOut("[+] Running Path Sum Test...")
+
+    header, err := CreateDatabase("resolve_sum", FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/docs/a.txt")
+    header.Create("/docs/a.txt/")
+    if header.Check("/docs/a.txt") == false || header.Check("/docs/a.txt/") == false {
+        drive_fail("TEST2: A file and a directory of the same name do not coexist", t)
+    }
+
+    if name, ok := header.ResolveSum(PathSum("/docs/a.txt")); ok == false || name != "/docs/a.txt" {
+        drive_fail("TEST3: Failed to resolve the sum of a file", t)
+    }
+    if name, ok := header.ResolveSum(PathSum("/docs")); ok == false || name != "/docs" {
+        drive_fail("TEST4: Failed to resolve the sum of an implicit directory", t)
+    }
+    if _, ok := header.ResolveSum(PathSum("/missing")); ok == true {
+        drive_fail("TEST5: Resolved the sum of a missing file", t)
+    }
+
+    debugOut("[+] Path Sum Test PASS")
+}
+
+func BenchmarkCheckParallel(b *testing.B) {
+    var filename = gen_raw_filename("bench_check")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        b.Fatal("Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    var names []string
+    for i := 0; i < 1024; i += 1 {
+        names = append(names, "/bench/file" + strconv.Itoa(i))
+        header.Create(names[i])
+    }
+
+    b.ResetTimer()
+    b.RunParallel(func (pb *testing.PB) {
+        var i int = 0
+        for pb.Next() {
+            header.Check(names[i % len(names)])
+            i += 1
+        }
+    })
+}
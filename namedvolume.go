@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Named volumes. A database may hold several independent trees besides its own, e.g.
+ *  code, assets and user data, in the same raw fs stream. Each volume is a database of
+ *  its own, opened with OpenVolume() and its own flags and DBConfig, so it may be
+ *  encrypted with another key or compressed differently. Its raw fs stream is kept in
+ *  the rawStreamHeader of the database which holds it: committing a volume replaces
+ *  its stream in memory, and the next commit of the database persists it.
+ *
+ * These are not the hidden volumes of DBConfig.VolumeSize, see hidden.go.
+ */
+
+import (
+    "sort"
+    "sync"
+    "sync/atomic"
+)
+
+/*
+ * The raw fs streams of the named volumes of a database
+ */
+type volumeTable struct {
+    lock        sync.Mutex
+    streams     map[string][]byte
+}
+
+/*
+ * Opens or creates the named volume `name` of the database, as CreateDatabaseConfig()
+ *  would with `flags` and `config`. The volume must be committed with UnmountDB() before
+ *  the database, and is stored in it, so config may not set Storage, Records, VolumeSize
+ *  or Locking
+ */
+func (f *FSHeader) OpenVolume(name string, flags FlagVal, config *DBConfig) (*FSHeader, error) {
+    if name == "" {
+        return nil, retErrStr("OpenVolume: A volume requires a name")
+    }
+    if f.config.Records != nil {
+        return nil, retErrStr("OpenVolume: Volumes require a raw fs stream")
+    }
+
+    var cfg DBConfig
+    if config != nil {
+        cfg = *config
+    }
+    if cfg.Storage != nil || cfg.Records != nil || cfg.VolumeSize > 0 || cfg.Locking == true {
+        return nil, retErrStr("OpenVolume: A volume cannot set Storage, Records, VolumeSize or Locking")
+    }
+    cfg.Storage = &volumeStorage{ parent: f }
+
+    return openDatabase(name, flags, &cfg, nil)
+}
+
+/*
+ * Returns the names of the volumes of the database, in order
+ */
+func (f *FSHeader) Volumes() []string {
+    f.volumes.lock.Lock()
+    defer f.volumes.lock.Unlock()
+
+    output := make([]string, 0, len(f.volumes.streams))
+    for name := range f.volumes.streams {
+        output = append(output, name)
+    }
+    sort.Strings(output)
+    return output
+}
+
+/*
+ * Destroys the named volume `name`. Handles of it returned by OpenVolume() must no
+ *  longer be committed
+ */
+func (f *FSHeader) DeleteVolume(name string) error {
+    if f.config.ReadOnly == true {
+        return ErrReadOnly
+    }
+
+    f.volumes.lock.Lock()
+    defer f.volumes.lock.Unlock()
+
+    stream, ok := f.volumes.streams[name]
+    if ok == false {
+        return pathError("delete", name, ErrNotExist)
+    }
+    wipeBuffer(stream, false)
+    delete(f.volumes.streams, name)
+
+    /* The previous raw fs file still holds the volume */
+    atomic.StoreInt32(&f.wipe_stale, 1)
+    return nil
+}
+
+/*
+ * Returns a copy of the streams, for the rawStreamHeader of a commit. The streams are
+ *  copied as well, since DeleteVolume() wipes them
+ */
+func (v *volumeTable) snapshot() map[string][]byte {
+    v.lock.Lock()
+    defer v.lock.Unlock()
+
+    if len(v.streams) == 0 {
+        return nil
+    }
+    output := make(map[string][]byte, len(v.streams))
+    for name, stream := range v.streams {
+        output[name] = append([]byte(nil), stream...)
+    }
+    return output
+}
+
+func (v *volumeTable) set(streams map[string][]byte) {
+    v.lock.Lock()
+    defer v.lock.Unlock()
+
+    v.streams = streams
+}
+
+/*
+ * The StorageBackend of a named volume, which keeps its raw fs stream in the volumeTable
+ *  of the database holding it
+ */
+type volumeStorage struct {
+    parent      *FSHeader
+}
+
+func (s *volumeStorage) Open(name string) (int64, error) {
+    v := &s.parent.volumes
+    v.lock.Lock()
+    defer v.lock.Unlock()
+
+    stream, ok := v.streams[name]
+    if ok == false {
+        return 0, ErrNotExist
+    }
+    return int64(len(stream)), nil
+}
+
+func (s *volumeStorage) Read(name string) ([]byte, error) {
+    v := &s.parent.volumes
+    v.lock.Lock()
+    defer v.lock.Unlock()
+
+    stream, ok := v.streams[name]
+    if ok == false {
+        return nil, ErrNotExist
+    }
+    return append([]byte(nil), stream...), nil
+}
+
+func (s *volumeStorage) Write(name string, data []byte) error {
+    if s.parent.config.ReadOnly == true {
+        return ErrReadOnly
+    }
+
+    v := &s.parent.volumes
+    v.lock.Lock()
+    defer v.lock.Unlock()
+
+    if v.streams == nil {
+        v.streams = make(map[string][]byte)
+    }
+    v.streams[name] = append([]byte(nil), data...)
+    return nil
+}
+
+func (s *volumeStorage) Delete(name string) error {
+    v := &s.parent.volumes
+    v.lock.Lock()
+    defer v.lock.Unlock()
+
+    if stream, ok := v.streams[name]; ok == true {
+        wipeBuffer(stream, false)
+        delete(v.streams, name)
+        atomic.StoreInt32(&s.parent.wipe_stale, 1)
+    }
+    return nil
+}
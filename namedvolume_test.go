@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "bytes"
+    "errors"
+    "testing"
+)
+
+func TestNamedVolumes(t *testing.T) {
+    debugOut("[+] Running Named Volume Test...")
+
+    var filename = gen_raw_filename("test_named_volumes")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    key := bytes.Repeat([]byte{ 7 }, 32)
+    userConfig := &DBConfig{ Key: key, Cipher: CipherAESGCM }
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/root_file")
+    header.Write("/root_file", []byte("root"))
+
+    code, err := header.OpenVolume("code", FLAG_DB_CREATE, nil)
+    if code == nil || err != nil {
+        drive_fail("TEST2: Failed to create volume", t)
+    }
+    user, err := header.OpenVolume("user", FLAG_DB_CREATE | FLAG_ENCRYPT, userConfig)
+    if user == nil || err != nil {
+        drive_fail("TEST3: Failed to create volume", t)
+    }
+    code.StartIOController()
+    user.StartIOController()
+    code.Create("/main.go")
+    code.Write("/main.go", []byte("package main"))
+    user.Create("/settings")
+    user.Write("/settings", []byte("user_secret_setting"))
+    if code.UnmountDB(0) != nil || user.UnmountDB(0) != nil || header.UnmountDB(0) != nil {
+        drive_fail("TEST4: Failed to commit", t)
+    }
+
+    /* The encrypted volume is not readable in the raw fs file */
+    raw, _ := os.ReadFile(filename)
+    if bytes.Contains(raw, []byte("user_secret_setting")) || bytes.Contains(raw, []byte("package main")) == false {
+        drive_fail("TEST5: Volume is not stored with its own flags", t)
+    }
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST6: Failed to load database", t)
+    }
+    if volumes := loaded.Volumes(); len(volumes) != 2 || volumes[0] != "code" || volumes[1] != "user" {
+        drive_fail("TEST7: Volumes were not persisted", t)
+    }
+    if loaded.Check("/main.go") == true || loaded.Check("/root_file") == false {
+        drive_fail("TEST8: Volume is not independent of the database", t)
+    }
+
+    if _, err := loaded.OpenVolume("user", FLAG_DB_LOAD | FLAG_ENCRYPT,
+        &DBConfig{ Key: bytes.Repeat([]byte{ 8 }, 32), Cipher: CipherAESGCM }); err == nil {
+        drive_fail("TEST9: Opened volume with the wrong key", t)
+    }
+    user, err = loaded.OpenVolume("user", FLAG_DB_LOAD | FLAG_ENCRYPT, userConfig)
+    if user == nil || err != nil {
+        drive_fail("TEST10: Failed to open volume", t)
+    }
+    if output, _ := user.Read("/settings"); !bytes.Equal(output, []byte("user_secret_setting")) {
+        drive_fail("TEST11: Volume data mismatch", t)
+    }
+
+    if _, err := loaded.OpenVolume("code", FLAG_DB_LOAD, &DBConfig{ Records: nil, Locking: true }); err == nil {
+        drive_fail("TEST12: Volume accepted Locking", t)
+    }
+
+    /* Deleting a volume */
+    if err := loaded.DeleteVolume("code"); err != nil {
+        drive_fail("TEST13: Failed to delete volume", t)
+    }
+    if err := loaded.DeleteVolume("code"); errors.Is(err, ErrNotExist) == false {
+        drive_fail("TEST14: Deleted a missing volume", t)
+    }
+    loaded.StartIOController()
+    if err := loaded.UnmountDB(0); err != nil {
+        drive_fail("TEST15: Failed to commit", t)
+    }
+    loaded, _ = CreateDatabase(filename, FLAG_DB_LOAD)
+    if volumes := loaded.Volumes(); len(volumes) != 1 || volumes[0] != "user" {
+        drive_fail("TEST16: Volume was not deleted", t)
+    }
+}
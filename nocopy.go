@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Variants of Write() and Read() for large files which avoid the copies the plain ones
+ *  make. Write() copies the data since the caller may reuse its slice, and the file
+ *  keeps that copy; WriteOwned() lets the file keep the caller's slice itself. Read()
+ *  returns a new slice; ReadInto() fills one the caller reuses, e.g. from a sync.Pool
+ */
+
+import (
+    "context"
+)
+
+/*
+ * Write() which hands `d` over to the database instead of copying it. The caller must
+ *  not use `d` afterwards: the file keeps it as its contents (unless they are sealed
+ *  with DBConfig.EncryptMemory or spilled), and wipes it once they are overwritten
+ */
+func (f *FSHeader) WriteOwned(name string, d []byte) error {
+    return f.WriteOwnedCtx(context.Background(), name, d)
+}
+
+func (f *FSHeader) WriteOwnedCtx(ctx context.Context, name string, d []byte) error {
+    return f.writeCtx(ctx, name, d, true)
+}
+
+/*
+ * Read() into the capacity of `buf` if it is large enough, otherwise into a new slice.
+ *  Returns the contents, which alias `buf` in the first case
+ */
+func (f *FSHeader) ReadInto(name string, buf []byte) ([]byte, error) {
+    return f.readCtx(context.Background(), name, buf)
+}
+
+/*
+ * Returns `n` bytes of the capacity of buf, or a new slice if it is too small
+ */
+func growBuffer(buf []byte, n int) []byte {
+    if cap(buf) >= n {
+        return buf[:n]
+    }
+
+    return make([]byte, n)
+}
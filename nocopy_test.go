@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestNoCopy(t *testing.T) {
+    debugOut("[+] Running No-Copy I/O Test...")
+
+    header, err := CreateDatabase("nocopy", FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/copied")
+    header.Create("/owned")
+
+    /* Write() keeps a copy, the caller may reuse its slice */
+    data := []byte("copied contents")
+    header.Write("/copied", data)
+    data[0] = 'X'
+    if output, err := header.Read("/copied"); err != nil || string(output) != "copied contents" {
+        drive_fail("TEST2: Write() did not copy the data", t)
+    }
+
+    owned := []byte("owned contents")
+    if err := header.WriteOwned("/owned", owned); err != nil {
+        drive_fail("TEST3: WriteOwned() failed", t)
+    }
+    if &header.check("/owned").data[0] != &owned[0] {
+        drive_fail("TEST4: WriteOwned() copied the data", t)
+    }
+    if output, err := header.Read("/owned"); err != nil || string(output) != "owned contents" {
+        drive_fail("TEST5: Invalid contents of the owned file", t)
+    }
+
+    buf := make([]byte, 0, 64)
+    output, err := header.ReadInto("/owned", buf)
+    if err != nil || string(output) != "owned contents" || &output[0] != &buf[:1][0] {
+        drive_fail("TEST6: ReadInto() did not reuse the buffer", t)
+    }
+    output, err = header.ReadInto("/copied", make([]byte, 4))
+    if err != nil || !bytes.Equal(output, []byte("copied contents")) {
+        drive_fail("TEST7: ReadInto() of a smaller buffer failed", t)
+    }
+
+    debugOut("[+] No-Copy I/O Test PASS")
+}
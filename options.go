@@ -0,0 +1,261 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Functional options of New() and Open(). Unlike the FlagVal of CreateDatabase(), which
+ *  mixes the intent to load or create with how the database is kept, the intent is the
+ *  constructor and contradicting options fail
+ */
+
+import (
+    "io/fs"
+    "os"
+    "sync"
+)
+
+type Option func(o *openOptions)
+
+type openOptions struct {
+    config      *DBConfig /* WithConfig(), the other options take precedence */
+    encrypt     bool
+    key         []byte
+    cipher      Cipher
+    compress    bool
+    codec       Codec
+    checksum    Checksum
+    readOnly    bool
+    inMemory    bool
+}
+
+/*
+ * FLAG_ENCRYPT with `key`, or the hostname key if it is nil. See KeyFromFile()
+ */
+func WithEncryption(key []byte) Option {
+    return func (o *openOptions) {
+        o.encrypt, o.key = true, key
+    }
+}
+
+/*
+ * The cipher of WithEncryption(), defaults to CipherRC4
+ */
+func WithCipher(c Cipher) Option {
+    return func (o *openOptions) {
+        o.cipher = c
+    }
+}
+
+/*
+ * FLAG_COMPRESS with `codec`, or CodecGzip if it is nil
+ */
+func WithCompression(codec Codec) Option {
+    return func (o *openOptions) {
+        o.compress, o.codec = true, codec
+    }
+}
+
+/*
+ * The algorithm of the checksums of files written from now on, defaults to ChecksumSHA256
+ */
+func WithChecksum(c Checksum) Option {
+    return func (o *openOptions) {
+        o.checksum = c
+    }
+}
+
+/*
+ * Every change, and committing, fails with ErrReadOnly. Only valid for Open()
+ */
+func ReadOnly() Option {
+    return func (o *openOptions) {
+        o.readOnly = true
+    }
+}
+
+/*
+ * Commits are kept in memory instead of the storage selected by the name, so nothing
+ *  is written to the disk and the database is lost with the header. Only valid for New()
+ */
+func InMemory() Option {
+    return func (o *openOptions) {
+        o.inMemory = true
+    }
+}
+
+/*
+ * The parameters which have no option of their own
+ */
+func WithConfig(config *DBConfig) Option {
+    return func (o *openOptions) {
+        o.config = config
+    }
+}
+
+/*
+ * Creates an empty database, which replaces `name` once committed
+ */
+func New(name string, opts ...Option) (*FSHeader, error) {
+    o, err := applyOptions(opts)
+    if err != nil {
+        return nil, err
+    }
+    if o.readOnly == true {
+        return nil, retErrStr("New: A new database cannot be read-only")
+    }
+
+    flags, config, err := o.build()
+    if err != nil {
+        return nil, err
+    }
+
+    return CreateDatabaseConfig(name, FLAG_DB_CREATE | flags, config)
+}
+
+/*
+ * Loads an existing database, failing with an error matching fs.ErrNotExist if there
+ *  is none
+ */
+func Open(name string, opts ...Option) (*FSHeader, error) {
+    o, err := applyOptions(opts)
+    if err != nil {
+        return nil, err
+    }
+    if o.inMemory == true {
+        return nil, retErrStr("Open: An in-memory database cannot be loaded")
+    }
+
+    flags, config, err := o.build()
+    if err != nil {
+        return nil, err
+    }
+    if config.Records == nil {
+        storage, stored_name := config.storage(name)
+        if _, err := storage.Open(stored_name); os.IsNotExist(err) {
+            return nil, &fs.PathError{ Op: "open", Path: name, Err: fs.ErrNotExist }
+        }
+    }
+
+    return CreateDatabaseConfig(name, FLAG_DB_LOAD | flags, config)
+}
+
+func applyOptions(opts []Option) (*openOptions, error) {
+    o := &openOptions{}
+    for _, opt := range opts {
+        if opt == nil {
+            return nil, retErrStr("Invalid nil Option")
+        }
+        opt(o)
+    }
+
+    return o, nil
+}
+
+func (o *openOptions) build() (FlagVal, *DBConfig, error) {
+    var config DBConfig
+    if o.config != nil {
+        config = *o.config
+    }
+
+    var flags FlagVal = 0
+    if o.encrypt == true {
+        flags |= FLAG_ENCRYPT
+        if o.key != nil {
+            config.Key = o.key
+        }
+    }
+    if o.cipher != nil {
+        if o.encrypt == false {
+            return 0, nil, retErrStr("WithCipher requires WithEncryption")
+        }
+        config.Cipher = o.cipher
+    }
+    if o.compress == true {
+        flags |= FLAG_COMPRESS
+        if o.codec != nil {
+            config.Codec = o.codec
+        }
+    }
+    if o.checksum != nil {
+        config.Checksum = o.checksum
+    }
+    config.ReadOnly = config.ReadOnly || o.readOnly
+
+    if o.inMemory == true {
+        if config.Records != nil || config.Storage != nil {
+            return 0, nil, retErrStr("InMemory conflicts with DBConfig.Storage and DBConfig.Records")
+        }
+        config.Storage = &memoryStorage{ blobs: make(map[string][]byte) }
+        config.Locking = false
+    }
+
+    return flags, &config, nil
+}
+
+/*
+ * Keeps the raw fs streams of InMemory() databases
+ */
+type memoryStorage struct {
+    lock        sync.Mutex
+    blobs       map[string][]byte
+}
+
+func (m *memoryStorage) Open(name string) (int64, error) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    blob, ok := m.blobs[name]
+    if ok == false {
+        return 0, fs.ErrNotExist
+    }
+    return int64(len(blob)), nil
+}
+
+func (m *memoryStorage) Read(name string) ([]byte, error) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    blob, ok := m.blobs[name]
+    if ok == false {
+        return nil, fs.ErrNotExist
+    }
+    return append([]byte(nil), blob...), nil
+}
+
+func (m *memoryStorage) Write(name string, data []byte) error {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    m.blobs[name] = append([]byte(nil), data...)
+    return nil
+}
+
+func (m *memoryStorage) Delete(name string) error {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    wipeBuffer(m.blobs[name], false)
+    delete(m.blobs, name)
+    return nil
+}
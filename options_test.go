@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "io/fs"
+    "os"
+    "testing"
+)
+
+func TestOptions(t *testing.T) {
+    debugOut("[+] Running Functional Options Test...")
+
+    var filename = gen_raw_filename("options")
+    os.Remove(filename)
+    defer os.Remove(filename)
+    key := make([]byte, 32)
+
+    if _, err := Open(filename); !errors.Is(err, fs.ErrNotExist) {
+        drive_fail("TEST1: Open of a missing database did not fail with fs.ErrNotExist", t)
+    }
+
+    header, err := New(filename, WithEncryption(key), WithCipher(CipherAESGCM), WithCompression(CodecZstd))
+    if header == nil || err != nil {
+        drive_fail("TEST2: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/a.txt")
+    header.Write("/a.txt", []byte("options"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST3: Failed to commit database", t)
+    }
+    header.Close()
+
+    if _, err := Open(filename, WithEncryption(make([]byte, 32)), WithCompression(CodecGzip)); err == nil {
+        drive_fail("TEST4: Loaded database with the wrong codec", t)
+    }
+
+    loaded, err := Open(filename, ReadOnly(), WithEncryption(key), WithCipher(CipherAESGCM),
+        WithCompression(CodecZstd), WithConfig(&DBConfig{ Codec: CodecGzip }))
+    if loaded == nil || err != nil {
+        drive_fail("TEST5: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+    if data, err := loaded.Read("/a.txt"); err != nil || string(data) != "options" {
+        drive_fail("TEST6: Invalid file contents", t)
+    }
+    if err := loaded.Write("/a.txt", []byte("changed")); !errors.Is(err, ErrReadOnly) {
+        drive_fail("TEST7: Write to a read-only database did not fail with ErrReadOnly", t)
+    }
+    if err := loaded.Create("/b.txt"); !errors.Is(err, ErrReadOnly) || loaded.Check("/b.txt") == true {
+        drive_fail("TEST8: Create in a read-only database did not fail", t)
+    }
+    if err := loaded.UnmountDB(0); !errors.Is(err, ErrReadOnly) {
+        drive_fail("TEST9: Commit of a read-only database did not fail", t)
+    }
+
+    if _, err := New(filename, ReadOnly()); err == nil {
+        drive_fail("TEST10: Created a read-only database", t)
+    }
+    if _, err := Open(filename, InMemory()); err == nil {
+        drive_fail("TEST11: Loaded an in-memory database", t)
+    }
+    if _, err := New(filename, WithCipher(CipherAESGCM)); err == nil {
+        drive_fail("TEST12: WithCipher without WithEncryption succeeded", t)
+    }
+
+    debugOut("[+] Functional Options Test PASS")
+}
+
+func TestInMemory(t *testing.T) {
+    debugOut("[+] Running In-Memory Database Test...")
+
+    var filename = gen_raw_filename("in_memory")
+    os.Remove(filename)
+
+    header, err := New(filename, InMemory(), WithCompression(nil))
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/a.txt")
+    header.Write("/a.txt", []byte("memory"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+    if _, err := os.Stat(filename); err == nil {
+        os.Remove(filename)
+        drive_fail("TEST3: In-memory database was written to the disk", t)
+    }
+
+    debugOut("[+] In-Memory Database Test PASS")
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+/*
+ * Package otel creates OpenTelemetry spans for govfs operations, see govfs.Tracer
+ */
+package otel
+
+import (
+    "context"
+
+    "go.opentelemetry.io/otel/trace"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/attribute"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+const TRACER_NAME             string    = "github.com/AlexRuzin/govfs"
+
+/*
+ * Span attributes
+ */
+const (
+    ATTR_PATH                 attribute.Key = "govfs.path"
+    ATTR_SIZE                 attribute.Key = "govfs.size"
+)
+
+type Tracer struct {
+    tracer      trace.Tracer
+}
+
+/*
+ * Returns a govfs.Tracer which creates spans with `provider`, e.g.
+ *  otel.GetTracerProvider()
+ */
+func NewTracer(provider trace.TracerProvider) *Tracer {
+    return &Tracer{ tracer: provider.Tracer(TRACER_NAME) }
+}
+
+func (t *Tracer) Start(ctx context.Context, op string, name string) (context.Context, govfs.TraceSpan) {
+    var options = []trace.SpanStartOption{ trace.WithSpanKind(trace.SpanKindInternal) }
+    if name != "" {
+        options = append(options, trace.WithAttributes(ATTR_PATH.String(name)))
+    }
+
+    ctx, span := t.tracer.Start(ctx, op, options...)
+    return ctx, &otelSpan{ span: span }
+}
+
+type otelSpan struct {
+    span        trace.Span
+}
+
+func (s *otelSpan) End(size int, err error) {
+    s.span.SetAttributes(ATTR_SIZE.Int(size))
+    if err != nil {
+        s.span.RecordError(err)
+        s.span.SetStatus(codes.Error, err.Error())
+    }
+    s.span.End()
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package otel
+
+import (
+    "context"
+    "testing"
+    "path/filepath"
+
+    "go.opentelemetry.io/otel/codes"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+func TestTracer(t *testing.T) {
+    recorder := tracetest.NewSpanRecorder()
+    provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+    path := filepath.Join(t.TempDir(), "traced")
+    header, err := govfs.CreateDatabaseConfig(path, govfs.FLAG_DB_CREATE, &govfs.DBConfig{ Tracer: NewTracer(provider) })
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    /* Spans are children of the caller's span */
+    ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+    header.CreateCtx(ctx, "/file")
+    header.WriteCtx(ctx, "/file", []byte("hello"))
+    header.ReadCtx(ctx, "/file")
+    header.ReadCtx(ctx, "/missing")
+    header.DeleteCtx(ctx, "/file")
+    header.UnmountDBCtx(ctx, 0)
+    parent.End()
+
+    spans := recorder.Ended()
+    expected := []string{ govfs.TRACE_CREATE, govfs.TRACE_WRITE, govfs.TRACE_READ, govfs.TRACE_READ,
+        govfs.TRACE_DELETE, govfs.TRACE_COMMIT, "request" }
+    if len(spans) != len(expected) {
+        t.Fatal("TEST2: Unexpected number of spans: ", len(spans))
+    }
+    for i, span := range spans {
+        if span.Name() != expected[i] {
+            t.Fatal("TEST3: Unexpected span ", span.Name())
+        }
+        if span.Name() != "request" && span.Parent().SpanID() != parent.SpanContext().SpanID() {
+            t.Fatal("TEST4: Span is not a child of the caller's span")
+        }
+    }
+
+    attributes := map[string]string{}
+    for _, kv := range spans[1].Attributes() {
+        attributes[string(kv.Key)] = kv.Value.Emit()
+    }
+    if attributes[string(ATTR_PATH)] != "/file" || attributes[string(ATTR_SIZE)] != "5" {
+        t.Fatal("TEST5: Missing span attributes")
+    }
+    if spans[2].Status().Code == codes.Error || spans[3].Status().Code != codes.Error {
+        t.Fatal("TEST6: Failed operation is not marked as an error")
+    }
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Size obfuscation. With DBConfig.PadSize, random bytes are appended to the serialized
+ *  fs table, inside of the envelope and so inside of the encryption, until the envelope
+ *  is a multiple of PadSize. The raw fs stream then only reveals the size of the
+ *  contents to within PadSize, plus the constant overhead of the cipher and the mask.
+ *  The last PAD_TRAILER_LENGTH bytes of the padding record its length.
+ *
+ * With DBConfig.ShuffleRecords the files are also written in a random order, instead
+ *  of one that follows the layout of the metadata table.
+ *
+ * Records, i.e. the RawFile header and the data of a file, may also be separated by
+ *  padding: DBConfig.RecordPad random bytes at least, and enough to begin every record
+ *  at a multiple of DBConfig.RecordAlign. Each pad is a block of
+ *
+ *  RECORD_PAD_MAGIC | uint32 filler length | filler
+ *
+ *  which the loader skips. A gob message never has a length of zero, so the magic is
+ *  not mistaken for a record. Offsets are counted from the start of the envelope, which
+ *  is the start of the raw fs file unless it is compressed, encrypted or masked as a
+ *  whole. In a scoped stream, see scope.go, only the records of the catalog are padded.
+ */
+
+import (
+    "io"
+    "bytes"
+    "math/rand"
+    "encoding/binary"
+    crand "crypto/rand"
+)
+
+const PAD_TRAILER_LENGTH      int       = 8
+const RECORD_PAD_MAGIC        byte      = 0
+const RECORD_PAD_HEADER       int       = 5 /* RECORD_PAD_MAGIC and the uint32 filler length */
+
+/*
+ * Pads the envelope in `stream` to a multiple of `size` bytes
+ */
+func padStream(stream *bytes.Buffer, size int) error {
+    pad := size - (stream.Len() + PAD_TRAILER_LENGTH) % size
+    if pad == size {
+        pad = 0
+    }
+    pad += PAD_TRAILER_LENGTH
+
+    stream.Bytes()[1] |= STREAM_ENVELOPE_PADDED
+
+    padding := make([]byte, pad)
+    if _, err := io.ReadFull(crand.Reader, padding[:pad - PAD_TRAILER_LENGTH]); err != nil {
+        return err
+    }
+    binary.BigEndian.PutUint64(padding[pad - PAD_TRAILER_LENGTH:], uint64(pad))
+    stream.Write(padding)
+
+    return nil
+}
+
+/*
+ * Returns the serialized fs table of an envelope without its padding
+ */
+func unpadStream(table []byte) ([]byte, error) {
+    if len(table) < PAD_TRAILER_LENGTH {
+        return nil, retErrStr("readFsStream: Padding is truncated")
+    }
+
+    pad := binary.BigEndian.Uint64(table[len(table) - PAD_TRAILER_LENGTH:])
+    if pad < uint64(PAD_TRAILER_LENGTH) || pad > uint64(len(table)) {
+        return nil, retErrStr("readFsStream: Padding is corrupt")
+    }
+
+    return table[:len(table) - int(pad)], nil
+}
+
+/*
+ * Returns the length of the pad block which precedes a record at `offset`, 0 if none
+ */
+func (c *DBConfig) recordPadding(offset int) int {
+    var minimum = c.RecordPad
+    if minimum == 0 {
+        minimum = STREAM_PAD_LEN
+    }
+    if minimum <= 0 && (c.RecordAlign <= 1 || offset % c.RecordAlign == 0) {
+        return 0
+    }
+    if minimum < 0 {
+        minimum = 0
+    }
+
+    length := RECORD_PAD_HEADER + minimum
+    if c.RecordAlign > 1 {
+        if rem := (offset + length) % c.RecordAlign; rem != 0 {
+            length += c.RecordAlign - rem
+        }
+    }
+    return length
+}
+
+/*
+ * Appends a pad block of `length` bytes, filled with random bytes, to `stream`
+ */
+func writeRecordPad(stream *bytes.Buffer, length int) error {
+    block := make([]byte, length)
+    block[0] = RECORD_PAD_MAGIC
+    binary.BigEndian.PutUint32(block[1:RECORD_PAD_HEADER], uint32(length - RECORD_PAD_HEADER))
+    if _, err := io.ReadFull(crand.Reader, block[RECORD_PAD_HEADER:]); err != nil {
+        return err
+    }
+
+    stream.Write(block)
+    return nil
+}
+
+/*
+ * Skips the pad blocks at the beginning of `p`
+ */
+func skipRecordPad(p *bytes.Buffer) error {
+    for p.Len() > 0 && p.Bytes()[0] == RECORD_PAD_MAGIC {
+        if p.Len() < RECORD_PAD_HEADER {
+            return retErrStr("Record padding is truncated")
+        }
+        filler := binary.BigEndian.Uint32(p.Bytes()[1:RECORD_PAD_HEADER])
+        if uint64(filler) > uint64(p.Len() - RECORD_PAD_HEADER) {
+            return retErrStr("Record padding is truncated")
+        }
+        p.Next(RECORD_PAD_HEADER + int(filler))
+    }
+
+    return nil
+}
+
+/*
+ * Puts `files` into a random order
+ */
+func shuffleFiles(files []*govfsFile) {
+    rand.Shuffle(len(files), func (i, j int) {
+        files[i], files[j] = files[j], files[i]
+    })
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "sort"
+    "bytes"
+    "strconv"
+    "strings"
+    "testing"
+    "encoding/gob"
+)
+
+func TestPadding(t *testing.T) {
+    debugOut("[+] Running Stream Padding Test...")
+
+    const pad = 4096
+    var sizes []int
+    for i, length := range []int{ 10, 3000 } {
+        for _, flags := range []FlagVal{ 0, FLAG_ENCRYPT, FLAG_COMPRESS } {
+            var filename = gen_raw_filename("test_padding_" + strconv.Itoa(i) + "_" + strconv.Itoa(int(flags)))
+            os.Remove(filename)
+            defer os.Remove(filename)
+
+            config := &DBConfig{ PadSize: pad }
+            header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | flags, config)
+            if header == nil || err != nil {
+                drive_fail("TEST1: Failed to create database", t)
+            }
+            header.StartIOController()
+            data := bytes.Repeat([]byte("p"), length)
+            header.Create("/file")
+            header.Write("/file", data)
+            if err := header.UnmountDB(0); err != nil {
+                drive_fail("TEST2: Failed to commit database", t)
+            }
+
+            raw, _ := os.ReadFile(filename)
+            if len(raw) % pad != 0 {
+                drive_fail("TEST3: Stream is not padded to a multiple of PadSize", t)
+            }
+            sizes = append(sizes, len(raw))
+
+            /* Loading does not require PadSize */
+            loaded, err := CreateDatabase(filename, FLAG_DB_LOAD | flags)
+            if loaded == nil || err != nil {
+                drive_fail("TEST4: Failed to load padded database", t)
+            }
+            if output, _ := loaded.Read("/file"); !bytes.Equal(output, data) {
+                drive_fail("TEST5: Data mismatch after load", t)
+            }
+        }
+    }
+
+    for _, size := range sizes {
+        if size != sizes[0] {
+            drive_fail("TEST6: Stream size depends on the contents", t)
+        }
+    }
+
+    /* The trailer is checked */
+    table := make([]byte, 16)
+    table[15] = 17
+    if _, err := unpadStream(table); err == nil {
+        drive_fail("TEST7: Accepted corrupt padding", t)
+    }
+    table[15] = 12
+    if output, err := unpadStream(table); err != nil || len(output) != 4 {
+        drive_fail("TEST8: Padding was not removed", t)
+    }
+}
+
+func TestShuffleRecords(t *testing.T) {
+    debugOut("[+] Running Record Shuffle Test...")
+
+    var filename = gen_raw_filename("test_shuffle")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ ShuffleRecords: true })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    var names []string
+    for i := 0; i < 64; i++ {
+        name := "/file" + strconv.Itoa(1000 + i)
+        header.Create(name)
+        header.Write(name, []byte(name))
+        names = append(names, name)
+    }
+
+    order := func () string {
+        if err := header.UnmountDB(0); err != nil {
+            drive_fail("TEST2: Failed to commit database", t)
+        }
+        raw, _ := os.ReadFile(filename)
+        sorted := append([]string(nil), names...)
+        sort.Slice(sorted, func (i, j int) bool {
+            return bytes.Index(raw, []byte(sorted[i])) < bytes.Index(raw, []byte(sorted[j]))
+        })
+        return strings.Join(sorted, ",")
+    }
+    if order() == order() {
+        drive_fail("TEST3: Records were written in the same order twice", t)
+    }
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil || loaded.GetFileCount() != header.GetFileCount() {
+        drive_fail("TEST4: Failed to load shuffled database", t)
+    }
+}
+
+func TestRecordPadding(t *testing.T) {
+    debugOut("[+] Running Record Padding Test...")
+
+    const align = 512
+    for _, flags := range []FlagVal{ 0, FLAG_ENCRYPT | FLAG_COMPRESS } {
+        var filename = gen_raw_filename("test_record_pad_" + strconv.Itoa(int(flags)))
+        os.Remove(filename)
+        defer os.Remove(filename)
+
+        config := &DBConfig{ RecordPad: 16, RecordAlign: align }
+        header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | flags, config)
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to create database", t)
+        }
+        header.StartIOController()
+        header.Create("/dir/")
+        header.Create("/empty")
+        for i := 0; i < 8; i++ {
+            name := "/file" + strconv.Itoa(i)
+            header.Create(name)
+            header.Write(name, bytes.Repeat([]byte(name), i * 100))
+        }
+        if err := header.UnmountDB(0); err != nil {
+            drive_fail("TEST2: Failed to commit database", t)
+        }
+
+        if flags == 0 {
+            /* Every record of the plain stream begins at a multiple of RecordAlign */
+            raw, _ := os.ReadFile(filename)
+            ptr := bytes.NewBuffer(raw[2:])
+            hdr, err := decodeStreamHeader(ptr, config)
+            if err != nil {
+                drive_fail("TEST3: Failed to decode the stream header", t)
+            }
+            var records uint = 0
+            for {
+                if err := skipRecordPad(ptr); err != nil {
+                    drive_fail("TEST4: Failed to skip record padding", t)
+                }
+                if ptr.Len() == 0 {
+                    break
+                }
+                if (len(raw) - ptr.Len()) % align != 0 {
+                    drive_fail("TEST5: Record is not aligned", t)
+                }
+                raw_file := RawFile{}
+                if err := gob.NewDecoder(ptr).Decode(&raw_file); err != nil {
+                    drive_fail("TEST6: Failed to decode a record", t)
+                }
+                stored := raw_file.StoredLen
+                if stored == 0 {
+                    stored = raw_file.UnzippedLen
+                }
+                ptr.Next(stored)
+                records += 1
+            }
+            if records != hdr.FileCount {
+                drive_fail("TEST7: Record count mismatch", t)
+            }
+        }
+
+        /* Loading does not require either option */
+        loaded, err := CreateDatabase(filename, FLAG_DB_LOAD | flags)
+        if loaded == nil || err != nil || loaded.Check("/dir/") == false || loaded.Check("/empty") == false {
+            drive_fail("TEST8: Failed to load padded database", t)
+        }
+        for i := 0; i < 8; i++ {
+            name := "/file" + strconv.Itoa(i)
+            if output, _ := loaded.Read(name); !bytes.Equal(output, bytes.Repeat([]byte(name), i * 100)) {
+                drive_fail("TEST9: Data mismatch after load", t)
+            }
+        }
+    }
+
+    /* A truncated pad block is rejected */
+    if err := skipRecordPad(bytes.NewBuffer([]byte{ RECORD_PAD_MAGIC, 0, 0, 0, 9, 1 })); err == nil {
+        drive_fail("TEST10: Accepted truncated record padding", t)
+    }
+}
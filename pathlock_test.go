@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "sync"
+    "errors"
+)
+
+func TestConcurrentCreate(t *testing.T) {
+    debugOut("[+] Running Concurrent Create Test...")
+
+    var filename = gen_raw_filename("test_pathlock")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+    defer header.Close()
+
+    const racers = 16
+    for _, async := range []bool{ false, true } {
+        name := "/race/sync"
+        if async {
+            name = "/race/async"
+        }
+
+        var wg sync.WaitGroup
+        results := make(chan error, racers)
+        for i := 0; i < racers; i += 1 {
+            wg.Add(1)
+            go func () {
+                defer wg.Done()
+                if async {
+                    results <- <- header.CreateAsync(name)
+                } else {
+                    results <- header.Create(name)
+                }
+            }()
+        }
+        wg.Wait()
+        close(results)
+
+        var created = 0
+        for err := range results {
+            switch {
+            case err == nil:
+                created += 1
+            case !errors.Is(err, ErrExist) || !os.IsExist(err):
+                drive_fail("TEST2: Losing Create() did not return ErrExist", t)
+            }
+        }
+        if created != 1 {
+            drive_fail("TEST3: Expected exactly one Create() to succeed", t)
+        }
+    }
+
+    debugOut("[+] Concurrent Create Test PASS")
+}
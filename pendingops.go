@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "sort"
+    "sync"
+    "time"
+)
+
+/*
+ * A queued or in-flight IO controller operation, as returned by PendingOps()
+ */
+type PendingOp struct {
+    Op          string /* "create", "write", "append", "delete", "shred" or "purge" */
+    Path        string
+    Priority    Priority
+    Size        int /* Length of the data, for writes */
+    Age         time.Duration /* Time since the operation was queued */
+    InFlight    bool /* The IO controller is executing it */
+}
+
+type pendingOps struct {
+    lock        sync.Mutex
+    irps        map[*govfsIoBlock]time.Time /* IRP -> time the controller started it, or zero if queued */
+}
+
+/*
+ * Returns the operations which are queued for, or being executed by, the IO controller,
+ *  oldest first. Intended for debugging stuck applications and for progress reporting.
+ */
+func (f *FSHeader) PendingOps() []PendingOp {
+    f.ops.lock.Lock()
+    var output = make([]PendingOp, 0, len(f.ops.irps))
+    for irp, started := range f.ops.irps {
+        output = append(output, PendingOp{
+            Op: irpOpName(irp),
+            Path: irp.name,
+            Priority: irp.priority,
+            Size: len(irp.data),
+            Age: time.Since(irp.queued),
+            InFlight: !started.IsZero(),
+        })
+    }
+    f.ops.lock.Unlock()
+
+    sort.SliceStable(output, func (i, j int) bool {
+        return output[i].Age > output[j].Age
+    })
+
+    return output
+}
+
+func (f *FSHeader) trackIRP(irp *govfsIoBlock) {
+    f.ops.lock.Lock()
+    defer f.ops.lock.Unlock()
+
+    if f.ops.irps == nil {
+        f.ops.irps = make(map[*govfsIoBlock]time.Time)
+    }
+    f.ops.irps[irp] = time.Time{}
+}
+
+func (f *FSHeader) startIRP(irp *govfsIoBlock) {
+    f.ops.lock.Lock()
+    defer f.ops.lock.Unlock()
+
+    if _, ok := f.ops.irps[irp]; ok == true {
+        f.ops.irps[irp] = time.Now()
+    }
+}
+
+func (f *FSHeader) untrackIRP(irp *govfsIoBlock) {
+    f.ops.lock.Lock()
+    defer f.ops.lock.Unlock()
+
+    delete(f.ops.irps, irp)
+}
+
+func irpOpName(irp *govfsIoBlock) string {
+    switch irp.operation {
+    case IRP_CREATE:
+        return "create"
+    case IRP_WRITE:
+        if (irp.flags & FLAG_APPEND) > 0 {
+            return "append"
+        }
+        return "write"
+    case IRP_DELETE:
+        if (irp.flags & FLAG_SHRED) > 0 {
+            return "shred"
+        }
+        return "delete"
+    case IRP_PURGE:
+        return "purge"
+    case IRP_XATTR:
+        return "xattr"
+    }
+
+    return "unknown"
+}
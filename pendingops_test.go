@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "time"
+)
+
+func TestPendingOps(t *testing.T) {
+    debugOut("[+] Running Pending Operations Test...")
+
+    var filename = gen_raw_filename("test_pendingops")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+    defer header.Close()
+
+    header.Create("/wedged")
+    header.Create("/queued")
+    if len(header.PendingOps()) != 0 {
+        drive_fail("TEST2: Completed operations are still pending", t)
+    }
+
+    /* Wedge the IO controller on the first write */
+    wedged := header.check("/wedged")
+    wedged.lock.Lock()
+    first := header.WriteAsync("/wedged", []byte("wedged"))
+    second := header.DeleteAsync("/queued")
+
+    var ops []PendingOp
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        ops = header.PendingOps()
+        if len(ops) == 2 && ops[0].InFlight {
+            break
+        }
+        if time.Now().After(deadline) {
+            drive_fail("TEST3: Expected one in-flight and one queued operation", t)
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    if ops[0].Op != "write" || ops[0].Path != "/wedged" || ops[0].Size != 6 || ops[0].Priority != PRIORITY_NORMAL {
+        drive_fail("TEST4: Unexpected in-flight operation", t)
+    }
+    if ops[1].Op != "delete" || ops[1].Path != "/queued" || ops[1].InFlight || ops[0].Age < ops[1].Age {
+        drive_fail("TEST5: Unexpected queued operation", t)
+    }
+
+    wedged.lock.Unlock()
+    if err := WaitAll(first, second); err != nil {
+        drive_fail("TEST6: Queued operations failed", t)
+    }
+    if len(header.PendingOps()) != 0 {
+        drive_fail("TEST7: Completed operations are still pending", t)
+    }
+
+    debugOut("[+] Pending Operations Test PASS")
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "strings"
+)
+
+/*
+ * An EncryptionPolicy marks a directory as "encrypted at rest". The data of every file
+ *  beneath the directory is encrypted with the policy's cipher and key on commit, in
+ *  addition to any FLAG_ENCRYPT on the whole fs stream. The nearest marked ancestor
+ *  of a file wins.
+ *
+ * Keys are never written to the stream, so the same policies must be passed in
+ *  DBConfig.Policies when the database is loaded again.
+ */
+type EncryptionPolicy struct {
+    Cipher      Cipher /* Defaults to CipherAESGCM */
+    Key         []byte
+    KeyProvider KeyProvider /* Used if Key is nil */
+}
+
+/*
+ * Marks `dir` as encrypted at rest with `policy`. The directory must exist. A nil
+ *  policy removes the marking.
+ */
+func (f *FSHeader) SetEncryptionPolicy(dir string, policy *EncryptionPolicy) error {
+    dir = policyDir(dir)
+
+    file := f.checkDirectory(dir)
+    if file == nil {
+        return pathError("SetEncryptionPolicy", dir, ErrNotExist)
+    }
+
+    if policy != nil && policy.Key == nil && policy.KeyProvider == nil {
+        return retErrStr("SetEncryptionPolicy: Policy has no key")
+    }
+
+    f.policy_lock.Lock()
+    defer f.policy_lock.Unlock()
+
+    file.lock.Lock()
+    if policy == nil {
+        delete(f.config.Policies, dir)
+        file.flags &^= FLAG_ENCRYPT
+    } else {
+        f.config.Policies[dir] = copyPolicy(policy)
+        file.flags |= FLAG_ENCRYPT
+    }
+    file.lock.Unlock()
+
+    return nil
+}
+
+/*
+ * Returns the directory and policy which apply to the file `name`, if any
+ */
+func (f *FSHeader) findPolicy(name string) (string, *EncryptionPolicy) {
+    f.policy_lock.RLock()
+    defer f.policy_lock.RUnlock()
+
+    if len(f.config.Policies) == 0 {
+        return "", nil
+    }
+
+    for dir := parentDir(name); dir != ""; dir = parentDir(dir) {
+        if policy := f.config.Policies[dir]; policy != nil {
+            return dir, policy
+        }
+    }
+
+    return "", nil
+}
+
+/*
+ * Implicitly created subdirectories are keyed without the trailing "/", explicitly
+ *  created ones with it
+ */
+func (f *FSHeader) checkDirectory(dir string) *govfsFile {
+    for _, name := range []string{ dir, strings.TrimSuffix(dir, "/") } {
+        if file := f.check(name); file != nil && (file.flags & FLAG_DIRECTORY) > 0 {
+            return file
+        }
+    }
+
+    if dir == "/" {
+        return f.check("/")
+    }
+
+    return nil
+}
+
+func (p *EncryptionPolicy) cipher() Cipher {
+    if p.Cipher == nil {
+        return CipherAESGCM
+    }
+
+    return p.Cipher
+}
+
+func (p *EncryptionPolicy) key() ([]byte, error) {
+    if p.Key == nil {
+        return p.KeyProvider.Key()
+    }
+
+    output := make([]byte, len(p.Key))
+    copy(output, p.Key)
+    return output, nil
+}
+
+func (p *EncryptionPolicy) encrypt(data []byte) ([]byte, error) {
+    key, err := p.key()
+    if err != nil {
+        return nil, err
+    }
+    defer ZeroKey(key)
+
+    return p.cipher().Encrypt(data, key)
+}
+
+func (p *EncryptionPolicy) decrypt(data []byte) ([]byte, error) {
+    key, err := p.key()
+    if err != nil {
+        return nil, err
+    }
+    defer ZeroKey(key)
+
+    return p.cipher().Decrypt(data, key)
+}
+
+func copyPolicy(policy *EncryptionPolicy) *EncryptionPolicy {
+    output := *policy
+    if policy.Key != nil {
+        output.Key = append([]byte(nil), policy.Key...)
+    }
+
+    return &output
+}
+
+func copyPolicies(policies map[string]*EncryptionPolicy) map[string]*EncryptionPolicy {
+    output := make(map[string]*EncryptionPolicy)
+    for dir, policy := range policies {
+        if policy != nil {
+            output[policyDir(dir)] = copyPolicy(policy)
+        }
+    }
+
+    return output
+}
+
+/* Policies are keyed by the directory name with a trailing "/" */
+func policyDir(dir string) string {
+    if !strings.HasSuffix(dir, "/") {
+        return dir + "/"
+    }
+
+    return dir
+}
+
+/*
+ * Returns the parent directory of `name` with a trailing "/", or "" for the root
+ */
+func parentDir(name string) string {
+    name = strings.TrimSuffix(name, "/")
+    if name == "" {
+        return ""
+    }
+
+    return name[:strings.LastIndex(name, "/") + 1]
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+)
+
+func TestEncryptionPolicy(t *testing.T) {
+    debugOut("[+] Running Subtree Encryption Policy Test...")
+
+    var filename = gen_raw_filename("test_policy")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    secret := []byte("subtree secret contents")
+    public := []byte("public contents")
+    header.Create("/private/keys/")
+    if err := header.SetEncryptionPolicy("/private", &EncryptionPolicy{ Key: []byte("subtree key") }); err != nil {
+        drive_fail("TEST2: Failed to set encryption policy", t)
+    }
+    if err := header.SetEncryptionPolicy("/missing", &EncryptionPolicy{ Key: []byte("k") }); err == nil {
+        drive_fail("TEST2.1: Policy set on a nonexistent directory", t)
+    }
+
+    header.Create("/private/keys/file0")
+    header.Write("/private/keys/file0", secret)
+    header.Create("/public/file1")
+    header.Write("/public/file1", public)
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST3: Failed to commit database", t)
+    }
+
+    raw, _ := os.ReadFile(filename)
+    if bytes.Contains(raw, secret) {
+        drive_fail("TEST4: Subtree data was not encrypted at rest", t)
+    }
+    if !bytes.Contains(raw, public) {
+        drive_fail("TEST4.1: Data outside the subtree was encrypted", t)
+    }
+
+    if _, err := CreateDatabase(filename, FLAG_DB_LOAD); err == nil {
+        drive_fail("TEST5: Database loaded without the subtree policy", t)
+    }
+
+    config := &DBConfig{ Policies: map[string]*EncryptionPolicy{ "/private": { Key: []byte("subtree key") } } }
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, config)
+    if loaded == nil || err != nil {
+        drive_fail("TEST6: Failed to load database with the subtree policy", t)
+    }
+    if data, _ := loaded.Read("/private/keys/file0"); !bytes.Equal(data, secret) {
+        drive_fail("TEST7: Subtree data mismatch after load", t)
+    }
+    if data, _ := loaded.Read("/public/file1"); !bytes.Equal(data, public) {
+        drive_fail("TEST7.1: Data mismatch after load", t)
+    }
+
+    debugOut("[+] Subtree Encryption Policy Test PASS")
+}
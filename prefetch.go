@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Readahead. Prefetch() loads the data of files which are only in DBConfig.Records
+ *  (not yet loaded, or evicted by DBConfig.MemoryBudget) and reads spilled files into
+ *  the page cache, in the background, so that a later read does not wait on the
+ *  backend. A Reader which is read sequentially does the same for the next
+ *  PREFETCH_WINDOW bytes of its file.
+ *
+ * Prefetching is a hint: errors are left for the demand read to report.
+ */
+
+import (
+    "io"
+    "sync/atomic"
+)
+
+const (
+    PREFETCH_WORKERS          int       = 4 /* Files fetched concurrently by one Prefetch() */
+    PREFETCH_WINDOW           int       = 256 * 1024 /* Bytes read ahead of a sequential Reader */
+    PREFETCH_SEQUENTIAL       int       = 2 /* Consecutive sequential reads before reading ahead */
+)
+
+/*
+ * Fetches the data of the named files, and of every file beneath the named
+ *  directories, ahead of demand. Returns without waiting for it
+ */
+func (f *FSHeader) Prefetch(paths ...string) error {
+    if f.isClosed() {
+        return ErrClosed
+    }
+
+    var files []*govfsFile
+    for _, name := range paths {
+        file := f.check(name)
+        if file == nil {
+            continue
+        }
+        if (file.flags & FLAG_DIRECTORY) == 0 && file.filename != "/" {
+            files = append(files, file)
+            continue
+        }
+
+        f.walk(dirKey(name), func (child *govfsFile) {
+            if (child.flags & FLAG_DIRECTORY) == 0 {
+                files = append(files, child)
+            }
+        })
+    }
+    if len(files) == 0 {
+        return nil
+    }
+
+    workers := PREFETCH_WORKERS
+    if workers > len(files) {
+        workers = len(files)
+    }
+
+    var next int64 = -1
+    for i := 0; i < workers; i++ {
+        started := f.startPrefetch(func () {
+            for {
+                i := atomic.AddInt64(&next, 1)
+                if i >= int64(len(files)) || f.isClosed() {
+                    return
+                }
+                f.prefetchFile(files[i], 0, -1)
+            }
+        })
+        if started == false {
+            return ErrClosed
+        }
+    }
+
+    return nil
+}
+
+/*
+ * Runs `fn` on a goroutine which Shutdown() waits for. Returns false if the header
+ *  is closed
+ */
+func (f *FSHeader) startPrefetch(fn func ()) bool {
+    f.ctl_lock.Lock()
+    defer f.ctl_lock.Unlock()
+
+    if f.closed == true {
+        return false
+    }
+
+    f.prefetches.Add(1)
+    go func () {
+        defer f.prefetches.Done()
+        fn()
+    }()
+
+    return true
+}
+
+/*
+ * Loads the record of a file, or reads `n` bytes of its spill file from `off` into the
+ *  page cache, all of it if `n` is negative
+ */
+func (f *FSHeader) prefetchFile(file *govfsFile, off int64, n int) {
+    file.lock.Lock()
+    f.loadUnloaded(file)
+    var sf *spillFile = file.spill
+    var size = int64(file.size)
+    file.lock.Unlock()
+
+    if sf == nil {
+        return
+    }
+    if n < 0 || off + int64(n) > size {
+        n = int(size - off)
+    }
+
+    /* The ciphertext is discarded, the spill file may be replaced meanwhile */
+    buf := make([]byte, 64 * 1024)
+    for n > 0 {
+        chunk := buf
+        if len(chunk) > n {
+            chunk = chunk[:n]
+        }
+        read, err := sf.file.ReadAt(chunk, off)
+        if err != nil && err != io.EOF || read == 0 {
+            return
+        }
+        off += int64(read)
+        n -= read
+    }
+}
+
+/*
+ * Called by Reader.Read() before reading at r.Offset. Once the file is read sequentially,
+ *  starts fetching the window beyond what was already fetched
+ */
+func (r *Reader) readAhead() {
+    if r.Offset == r.next {
+        r.sequential++
+    } else {
+        r.sequential = 0
+        r.ahead = 0
+    }
+    if r.sequential < PREFETCH_SEQUENTIAL {
+        return
+    }
+
+    /* Refilled once less than half of the window is left ahead of the reader */
+    if r.ahead - r.Offset >= PREFETCH_WINDOW / 2 {
+        return
+    }
+    start := r.ahead
+    if start < r.Offset {
+        start = r.Offset
+    }
+    end := r.Offset + PREFETCH_WINDOW
+    r.ahead = end
+
+    file := r.File
+    r.Hdr.startPrefetch(func () {
+        r.Hdr.prefetchFile(file, int64(start), end - start)
+    })
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "io"
+    "bytes"
+    "testing"
+)
+
+func TestPrefetch(t *testing.T) {
+    debugOut("[+] Running Prefetch Test...")
+
+    records := newMemRecords()
+    config := &DBConfig{ Records: records }
+    header, err := CreateDatabaseConfig("prefetch", FLAG_DB_LOAD | FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    names := []string{ "/docs/a", "/docs/sub/b", "/other" }
+    for _, name := range names {
+        header.Create(name)
+        header.Write(name, []byte("contents of " + name))
+    }
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit records", t)
+    }
+
+    header, err = CreateDatabaseConfig("prefetch", FLAG_DB_LOAD, config)
+    if header == nil || err != nil {
+        drive_fail("TEST3: Failed to load records", t)
+    }
+    header.StartIOController()
+
+    /* A directory prefetches its subtree, missing names are ignored */
+    if err := header.Prefetch("/docs/", "/missing"); err != nil {
+        drive_fail("TEST4: Prefetch failed", t)
+    }
+    header.prefetches.Wait()
+    for _, name := range names {
+        if loaded := header.check(name).record() == nil; loaded != (name != "/other") {
+            drive_fail("TEST5: Unexpected prefetch state of " + name, t)
+        }
+    }
+
+    /* Prefetched data is not read again */
+    reads := records.reads
+    if data, _ := header.Read("/docs/sub/b"); string(data) != "contents of /docs/sub/b" || records.reads != reads {
+        drive_fail("TEST6: Prefetched file was read again", t)
+    }
+
+    header.Close()
+    if err := header.Prefetch("/other"); err != ErrClosed {
+        drive_fail("TEST7: Prefetch after Close() did not fail", t)
+    }
+}
+
+func TestReadAhead(t *testing.T) {
+    debugOut("[+] Running Sequential Read-Ahead Test...")
+
+    header, err := CreateDatabaseConfig("readahead", FLAG_DB_CREATE, &DBConfig{ SpillSize: 1, SpillDir: t.TempDir() })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    data := bytes.Repeat([]byte("0123456789abcdef"), PREFETCH_WINDOW / 4)
+    header.Create("/large")
+    header.Write("/large", data)
+
+    reader, err := header.NewReader("/large")
+    if err != nil {
+        drive_fail("TEST2: Failed to create reader", t)
+    }
+
+    var output []byte
+    chunk := make([]byte, 4096)
+    for {
+        n, err := reader.Read(chunk)
+        output = append(output, chunk[:n]...)
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            drive_fail("TEST3: Read failed", t)
+        }
+        if len(output) > len(data) {
+            drive_fail("TEST3.1: Read past the end", t)
+        }
+    }
+    if !bytes.Equal(output, data) {
+        drive_fail("TEST4: Data mismatch", t)
+    }
+    if reader.ahead < len(data) {
+        drive_fail("TEST5: Sequential reads did not read ahead", t)
+    }
+
+    /* A seek restarts the detection */
+    reader.Offset = 0
+    reader.Read(chunk)
+    if reader.sequential != 0 || reader.ahead != 0 {
+        drive_fail("TEST6: Read-ahead continued after a seek", t)
+    }
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+)
+
+/*
+ * IRP priorities. The IO controller always services a higher priority queue first,
+ *  so a bulk import submitted with PRIORITY_BACKGROUND does not delay interactive
+ *  operations. Operations without a priority use PRIORITY_NORMAL.
+ */
+type Priority int
+
+const (
+    PRIORITY_BACKGROUND       Priority = iota
+    PRIORITY_NORMAL
+    PRIORITY_HIGH
+
+    IRP_PRIORITY_COUNT        int = iota
+)
+
+type priorityKey struct{}
+
+/*
+ * Returns a context which submits the operations of the *Ctx() methods with priority `p`
+ */
+func WithPriority(ctx context.Context, p Priority) context.Context {
+    return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityFromContext(ctx context.Context) Priority {
+    if p, ok := ctx.Value(priorityKey{}).(Priority); ok == true {
+        return p
+    }
+
+    return PRIORITY_NORMAL
+}
+
+/*
+ * Must be called with ctl_lock held
+ */
+func (f *FSHeader) queue(p Priority) chan *govfsIoBlock {
+    switch p {
+    case PRIORITY_HIGH:
+        return f.io_high
+    case PRIORITY_BACKGROUND:
+        return f.io_bg
+    }
+
+    return f.io_in
+}
+
+/*
+ * Returns the next IRP from the highest priority queue which has one, blocking until
+ *  any queue does. Closed queues are set to nil. Returns nil once all are closed and empty.
+ */
+func nextIRP(queues *[IRP_PRIORITY_COUNT]chan *govfsIoBlock) *govfsIoBlock {
+    for {
+        for p := IRP_PRIORITY_COUNT - 1; p >= 0; p -= 1 {
+            if queues[p] == nil {
+                continue
+            }
+
+            select {
+            case ioh, ok := <- queues[p]:
+                if ok == false {
+                    queues[p] = nil
+                    continue
+                }
+                return ioh
+            default:
+            }
+        }
+
+        if queues[PRIORITY_HIGH] == nil && queues[PRIORITY_NORMAL] == nil && queues[PRIORITY_BACKGROUND] == nil {
+            return nil
+        }
+
+        /* Nothing is queued, wait on all queues. A nil queue is never selected */
+        var ioh *govfsIoBlock
+        var ok bool
+        var p Priority
+        select {
+        case ioh, ok = <- queues[PRIORITY_HIGH]:
+            p = PRIORITY_HIGH
+        case ioh, ok = <- queues[PRIORITY_NORMAL]:
+            p = PRIORITY_NORMAL
+        case ioh, ok = <- queues[PRIORITY_BACKGROUND]:
+            p = PRIORITY_BACKGROUND
+        }
+
+        if ok == false {
+            queues[p] = nil
+            continue
+        }
+
+        return ioh
+    }
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "context"
+)
+
+func TestPriority(t *testing.T) {
+    debugOut("[+] Running IRP Priority Test...")
+
+    var queues [IRP_PRIORITY_COUNT]chan *govfsIoBlock
+    for p := range queues {
+        queues[p] = make(chan *govfsIoBlock, 4)
+    }
+    for i := 0; i < 2; i += 1 {
+        queues[PRIORITY_BACKGROUND] <- &govfsIoBlock{ name: "background" }
+        queues[PRIORITY_NORMAL] <- &govfsIoBlock{ name: "normal" }
+        queues[PRIORITY_HIGH] <- &govfsIoBlock{ name: "high" }
+    }
+
+    expected := []string{ "high", "high", "normal", "normal", "background", "background" }
+    for i := range expected {
+        if ioh := nextIRP(&queues); ioh == nil || ioh.name != expected[i] {
+            drive_fail("TEST1: IRPs were not serviced in priority order", t)
+        }
+    }
+
+    for p := range queues {
+        close(queues[p])
+    }
+    if nextIRP(&queues) != nil {
+        drive_fail("TEST2: nextIRP returned an IRP from closed queues", t)
+    }
+
+    var filename = gen_raw_filename("test_priority")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST3: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST3.1: Failed to start IOController", t)
+    }
+    defer header.Close()
+
+    background := WithPriority(context.Background(), PRIORITY_BACKGROUND)
+    interactive := WithPriority(context.Background(), PRIORITY_HIGH)
+    if err := header.CreateCtx(background, "/import/file0"); err != nil {
+        drive_fail("TEST4: Failed to create file with background priority", t)
+    }
+    if err := header.WriteCtx(interactive, "/import/file0", []byte("priority")); err != nil {
+        drive_fail("TEST5: Failed to write file with high priority", t)
+    }
+    if output, _ := header.Read("/import/file0"); string(output) != "priority" {
+        drive_fail("TEST6: Data mismatch", t)
+    }
+
+    debugOut("[+] IRP Priority Test PASS")
+}
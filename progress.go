@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Progress of long operations, for frontends showing the commit or load of a large
+ *  database. DBConfig.Progress is called as files are encoded by UnmountDB(), and as
+ *  they are decoded by a load of a raw fs stream, at most every PROGRESS_INTERVAL and
+ *  once more when the operation completes. A load from DBConfig.Records only reads
+ *  the catalog, the data is read on demand, so it reports no progress.
+ */
+
+import (
+    "sync"
+    "time"
+)
+
+const PROGRESS_INTERVAL       time.Duration = 100 * time.Millisecond
+
+type Progress struct {
+    Op          string /* LOG_COMMIT or LOG_LOAD */
+    Path        string /* The database name */
+    Files       int /* Files done */
+    TotalFiles  int
+    Bytes       int64 /* Bytes of file data done */
+    TotalBytes  int64 /* 0 if not known, for a commit to DBConfig.Records */
+    Elapsed     time.Duration
+    Done        bool /* The final report, the operation completed */
+}
+
+type ProgressFunc func (p Progress)
+
+/*
+ * The estimated time left, from the rate of the bytes done so far, or of the files if
+ *  TotalBytes is not known. Zero until any are done
+ */
+func (p Progress) ETA() time.Duration {
+    done, total := p.Bytes, p.TotalBytes
+    if total <= 0 {
+        done, total = int64(p.Files), int64(p.TotalFiles)
+    }
+    if done <= 0 || done >= total {
+        return 0
+    }
+
+    return time.Duration(float64(p.Elapsed) * float64(total - done) / float64(done))
+}
+
+/*
+ * Returns a ProgressFunc which sends to `ch`, for frontends which would rather receive.
+ *  Reports are dropped while `ch` is full, except the final one
+ */
+func ProgressChannel(ch chan<- Progress) ProgressFunc {
+    return func (p Progress) {
+        if p.Done == true {
+            ch <- p
+            return
+        }
+
+        select {
+        case ch <- p:
+        default:
+        }
+    }
+}
+
+type progressTracker struct {
+    lock        sync.Mutex
+    fn          ProgressFunc
+    p           Progress
+    start       time.Time
+    last        time.Time
+}
+
+/*
+ * Returns nil if `fn` is, all methods of a nil tracker do nothing
+ */
+func newProgress(fn ProgressFunc, op string, path string, files int, bytes int64) *progressTracker {
+    if fn == nil {
+        return nil
+    }
+
+    now := time.Now()
+    return &progressTracker{
+        fn: fn,
+        p: Progress{ Op: op, Path: path, TotalFiles: files, TotalBytes: bytes },
+        start: now,
+        last: now,
+    }
+}
+
+/*
+ * Safe for concurrent use, the callback is not called concurrently
+ */
+func (t *progressTracker) add(files int, bytes int64) {
+    if t == nil {
+        return
+    }
+
+    t.lock.Lock()
+    defer t.lock.Unlock()
+
+    t.p.Files += files
+    t.p.Bytes += bytes
+    if now := time.Now(); now.Sub(t.last) >= PROGRESS_INTERVAL {
+        t.last = now
+        t.p.Elapsed = now.Sub(t.start)
+        t.fn(t.p)
+    }
+}
+
+func (t *progressTracker) done() {
+    if t == nil {
+        return
+    }
+
+    t.lock.Lock()
+    defer t.lock.Unlock()
+
+    t.p.Elapsed = time.Since(t.start)
+    t.p.Done = true
+    t.fn(t.p)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestProgress(t *testing.T) {
+    debugOut("[+] Running Progress Test...")
+
+    var filename = gen_raw_filename("test_progress")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    var lock sync.Mutex
+    var reports []Progress
+    config := &DBConfig{ Progress: func (p Progress) {
+        lock.Lock()
+        reports = append(reports, p)
+        lock.Unlock()
+    }}
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/dir/")
+    for _, name := range []string{ "/dir/a", "/dir/b", "/empty" } {
+        header.Create(name)
+    }
+    header.Write("/dir/a", make([]byte, 1000))
+    header.Write("/dir/b", make([]byte, 24))
+
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+    last := reports[len(reports) - 1]
+    if last.Op != LOG_COMMIT || last.Done == false || last.Files == 0 || last.Files != last.TotalFiles ||
+        last.Bytes != 1024 || last.TotalBytes != 1024 {
+        drive_fail("TEST3: Unexpected final commit report", t)
+    }
+    header.Close()
+
+    ch := make(chan Progress, 1)
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, &DBConfig{ Progress: ProgressChannel(ch) })
+    if loaded == nil || err != nil {
+        drive_fail("TEST4: Failed to load database", t)
+    }
+    defer loaded.Close()
+
+    /* The final report is not dropped, even though the channel may be full */
+    for p := range ch {
+        if p.Done == false {
+            continue
+        }
+        if p.Op != LOG_LOAD || p.Files != last.Files || p.TotalFiles != last.Files || p.Bytes != 1024 || p.TotalBytes != 1024 {
+            drive_fail("TEST5: Unexpected final load report", t)
+        }
+        break
+    }
+}
+
+func TestProgressETA(t *testing.T) {
+    debugOut("[+] Running Progress ETA Test...")
+
+    p := Progress{ Bytes: 25, TotalBytes: 100, Elapsed: time.Second }
+    if p.ETA() != 3 * time.Second {
+        drive_fail("TEST1: Unexpected ETA", t)
+    }
+
+    /* Falls back to the files if the bytes are not known */
+    p = Progress{ Files: 1, TotalFiles: 2, Elapsed: time.Second }
+    if p.ETA() != time.Second {
+        drive_fail("TEST2: Unexpected ETA without TotalBytes", t)
+    }
+    if (Progress{ TotalBytes: 100 }).ETA() != 0 {
+        drive_fail("TEST3: ETA before any progress is not 0", t)
+    }
+}
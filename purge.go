@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+)
+
+/*
+ * Removes every file and directory except the root. The file contents are zeroed in
+ *  memory, the total size is reset, buffered writes are dropped, and the next commit
+ *  overwrites the previous raw fs file. The IO controller keeps running; use Close()
+ *  to stop it.
+ */
+func (f *FSHeader) Purge() error {
+    return f.PurgeCtx(context.Background())
+}
+
+/*
+ * Purge() for the principal of ctx, which fails with ErrPermission if the ACL of any
+ *  file denies it ACCESS_DELETE, see acl.go
+ */
+func (f *FSHeader) PurgeCtx(ctx context.Context) error {
+    if f.isClosed() {
+        return ErrClosed
+    }
+
+    irp := &govfsIoBlock{
+        name: "/",
+        principal: principalFromContext(ctx),
+        operation: IRP_PURGE,
+        io_out: make(chan *govfsIoBlock, 1),
+    }
+
+    /* Before buffered writes are dropped. The IO controller checks again */
+    if err := f.authorizeIRP(irp); err != nil {
+        return err
+    }
+
+    if f.wb != nil {
+        f.wb.flush_lock.Lock()
+        defer f.wb.flush_lock.Unlock()
+
+        f.wb.lock.Lock()
+        f.wb.pending = make(map[string]*pendingWrite)
+        f.wb.lock.Unlock()
+    }
+
+    output_irp, err := f.submitCtx(ctx, irp)
+    if err != nil {
+        return err
+    }
+
+    return output_irp.status
+}
+
+/*
+ * Equivalent to Purge()
+ */
+func (f *FSHeader) RemoveAllFiles() error {
+    return f.Purge()
+}
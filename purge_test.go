@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+)
+
+func TestPurge(t *testing.T) {
+    debugOut("[+] Running Purge Test...")
+
+    var filename = gen_raw_filename("test_purge")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+    defer header.Close()
+
+    secret := []byte("purged contents")
+    header.Create("/folder0/file0")
+    header.Write("/folder0/file0", secret)
+    header.Create("/file1")
+    header.Write("/file1", secret)
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+    buffer := header.check("/file1").data
+
+    if err := header.Purge(); err != nil {
+        drive_fail("TEST3: Failed to purge database", t)
+    }
+    if header.Check("/folder0/file0") || header.Check("/folder0") || header.Check("/file1") {
+        drive_fail("TEST4: Files still exist after purge", t)
+    }
+    if !header.Check("/") || header.GetFileCount() != 1 || header.GetTotalFilesizes() != 0 {
+        drive_fail("TEST5: Unexpected state after purge", t)
+    }
+    if !bytes.Equal(buffer, make([]byte, len(secret))) {
+        drive_fail("TEST6: Data buffer was not zeroed", t)
+    }
+
+    /* The controller is still usable */
+    if !header.ControllerRunning() {
+        drive_fail("TEST7: Purge stopped the IO controller", t)
+    }
+    if err := header.Create("/file2"); err != nil {
+        drive_fail("TEST8: Failed to create file after purge", t)
+    }
+    header.Write("/file2", []byte("after"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST9: Failed to commit database", t)
+    }
+
+    raw, _ := os.ReadFile(filename)
+    if bytes.Contains(raw, secret) {
+        drive_fail("TEST10: Purged data is still present in the raw fs file", t)
+    }
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST11: Failed to load database", t)
+    }
+    if loaded.Check("/file1") || !loaded.Check("/file2") {
+        drive_fail("TEST12: Unexpected files after load", t)
+    }
+
+    debugOut("[+] Purge Test PASS")
+}
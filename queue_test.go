@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "time"
+    "errors"
+    "context"
+)
+
+func TestQueueDepth(t *testing.T) {
+    debugOut("[+] Running IRP Queue Test...")
+
+    var filename = gen_raw_filename("test_queue")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    for _, c := range []struct{ depth, expected int }{ { 0, IRP_QUEUE_DEPTH }, { -1, 0 }, { 2, 2 } } {
+        header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ QueueDepth: c.depth })
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to create database", t)
+        }
+        if err := header.StartIOController(); err != nil {
+            drive_fail("TEST1.1: Failed to start IOController", t)
+        }
+        if length, depth := header.QueueLength(); length != 0 || depth != c.expected {
+            drive_fail("TEST2: Unexpected queue depth", t)
+        }
+        header.Close()
+    }
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ QueueDepth: 2, FailWhenQueueFull: true })
+    if header == nil || err != nil {
+        drive_fail("TEST3: Failed to create database", t)
+    }
+    if err := header.Create("/file0"); err == nil {
+        drive_fail("TEST3.1: Create succeeded without an IO controller", t)
+    }
+
+    /* A queue which is never serviced fills up after two IRPs */
+    header.ctl_lock.Lock()
+    header.io_in = make(chan *govfsIoBlock, 2)
+    header.ctl_lock.Unlock()
+    header.meta.set("/file0", &govfsFile{ filename: "/file0", flags: FLAG_FILE })
+
+    for i := 0; i < 2; i += 1 {
+        ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+        if err := header.WriteCtx(ctx, "/file0", []byte("queued")); !errors.Is(err, context.DeadlineExceeded) {
+            drive_fail("TEST4: Queued write was not accepted", t)
+        }
+        cancel()
+    }
+    if length, _ := header.QueueLength(); length != 2 {
+        drive_fail("TEST5: Unexpected queue length", t)
+    }
+    if err := header.Write("/file0", []byte("full")); !errors.Is(err, ErrQueueFull) {
+        drive_fail("TEST6: Write to a full queue did not return ErrQueueFull", t)
+    }
+
+    debugOut("[+] IRP Queue Test PASS")
+}
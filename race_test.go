@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "sync"
+    "strconv"
+)
+
+/*
+ * Readers run concurrently with the IO controller. Run with `go test -race`
+ */
+func TestConcurrentReaders(t *testing.T) {
+    debugOut("[+] Running Concurrent Reader Test...")
+
+    var filename = gen_raw_filename("test_race")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+    defer header.Close()
+
+    const writers = 8
+    const files = 32
+    var wg sync.WaitGroup
+    for w := 0; w < writers; w += 1 {
+        wg.Add(1)
+        go func (w int) {
+            defer wg.Done()
+            for i := 0; i < files; i += 1 {
+                name := "/dir" + strconv.Itoa(w) + "/file" + strconv.Itoa(i)
+                if err := header.Create(name); err != nil {
+                    t.Error("TEST2: Failed to create " + name)
+                    return
+                }
+                if err := header.Write(name, []byte(name)); err != nil {
+                    t.Error("TEST3: Failed to write " + name)
+                    return
+                }
+                if i % 4 == 0 {
+                    if err := header.Delete(name); err != nil {
+                        t.Error("TEST4: Failed to delete " + name)
+                        return
+                    }
+                }
+            }
+        }(w)
+    }
+
+    stop := make(chan struct{})
+    var readers sync.WaitGroup
+    for r := 0; r < 4; r += 1 {
+        readers.Add(1)
+        go func (r int) {
+            defer readers.Done()
+            for {
+                select {
+                case <- stop:
+                    return
+                default:
+                }
+
+                name := "/dir" + strconv.Itoa(r) + "/file1"
+                if header.Check(name) {
+                    header.Read(name)
+                    header.GetFileSize(name)
+                }
+                header.GetFileList()
+                header.GetFileListDirectory("/dir" + strconv.Itoa(r) + "/")
+                header.GetFileCount()
+                header.GetTotalFilesizes()
+            }
+        }(r)
+    }
+
+    /* Commit while the writers are running */
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST5: Failed to commit database during writes", t)
+    }
+
+    wg.Wait()
+    close(stop)
+    readers.Wait()
+
+    for w := 0; w < writers; w += 1 {
+        for i := 0; i < files; i += 1 {
+            name := "/dir" + strconv.Itoa(w) + "/file" + strconv.Itoa(i)
+            if header.Check(name) != (i % 4 != 0) {
+                drive_fail("TEST6: Unexpected state for " + name, t)
+            }
+        }
+    }
+
+    debugOut("[+] Concurrent Reader Test PASS")
+}
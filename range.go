@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Partial reads, e.g. the first bytes of a file for content type sniffing, without
+ *  copying the rest of it. Spilled files are read from the disk at the offset; only data
+ *  sealed with DBConfig.EncryptMemory, or verified with DBConfig.VerifyReads, is read whole,
+ *  and wiped afterwards
+ */
+
+import (
+    "io"
+    "time"
+)
+
+/*
+ * Returns at most `n` bytes of a file from offset `off`, fewer at the end of the file and
+ *  none past it
+ */
+func (f *FSHeader) ReadRange(name string, off int, n int) (data []byte, err error) {
+    start := time.Now()
+    defer func () { f.observe(LOG_READ, name, len(data), start, err) }()
+
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+    if off < 0 || n < 0 {
+        return nil, pathError("read", name, retErrStr("Invalid range"))
+    }
+    if err := f.syncPath(name); err != nil {
+        return nil, err
+    }
+
+    file := f.check(name)
+    if file == nil {
+        return nil, pathError("read", name, ErrNotExist)
+    }
+
+    file.lock.Lock()
+    defer file.lock.Unlock()
+
+    if (file.flags & FLAG_DIRECTORY) > 0 {
+        return nil, pathError("read", name, ErrIsDirectory)
+    }
+
+    hit := file.record() == nil
+    if err := f.loadUnloaded(file); err != nil {
+        return nil, err
+    }
+    f.cacheRead(file, hit)
+
+    if off >= file.size {
+        return []byte{}, nil
+    }
+    if n > file.size - off {
+        n = file.size - off
+    }
+    output := make([]byte, n)
+
+    switch {
+    case f.config.VerifyReads == true:
+        /* The checksum covers all of the contents */
+        plaintext, err := f.unsealData(file)
+        if err != nil {
+            return nil, err
+        }
+        if err := f.verifyData(file, plaintext); err != nil {
+            wipeBuffer(plaintext, false)
+            return nil, pathError("read", name, err)
+        }
+        copy(output, plaintext[off:])
+        wipeBuffer(plaintext, false)
+    case file.spill != nil:
+        if _, err := f.spillReadAt(file, output, int64(off)); err != nil && err != io.EOF {
+            return nil, err
+        }
+    case f.mem_cipher != nil:
+        plaintext, err := f.unsealData(file)
+        if err != nil {
+            return nil, err
+        }
+        copy(output, plaintext[off:])
+        wipeBuffer(plaintext, false)
+    default:
+        copy(output, file.data[off:])
+    }
+
+    return output, nil
+}
+
+/*
+ * Returns the first `n` bytes of a file, or all of it if it is shorter
+ */
+func (f *FSHeader) Head(name string, n int) ([]byte, error) {
+    return f.ReadRange(name, 0, n)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "errors"
+    "strconv"
+    "testing"
+)
+
+func TestReadRange(t *testing.T) {
+    debugOut("[+] Running Range Read Test...")
+
+    data := []byte("0123456789abcdef")
+    configs := []*DBConfig{
+        nil,
+        &DBConfig{ EncryptMemory: true },
+        &DBConfig{ SpillSize: 1, SpillDir: t.TempDir() },
+    }
+
+    for i, config := range configs {
+        header, err := CreateDatabaseConfig("range", FLAG_DB_CREATE, config)
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to create database", t)
+        }
+        header.StartIOController()
+
+        header.Create("/file")
+        if err := header.Write("/file", data); err != nil {
+            drive_fail("TEST2: Failed to write file", t)
+        }
+        header.Create("/dir/")
+
+        if output, err := header.Head("/file", 4); err != nil || !bytes.Equal(output, data[:4]) {
+            drive_fail("TEST3: Invalid head of file in configuration " + strconv.Itoa(i), t)
+        }
+        if output, err := header.ReadRange("/file", 10, 3); err != nil || !bytes.Equal(output, data[10:13]) {
+            drive_fail("TEST4: Invalid range of file", t)
+        }
+        if output, err := header.ReadRange("/file", 12, 100); err != nil || !bytes.Equal(output, data[12:]) {
+            drive_fail("TEST5: Range past the end was not truncated", t)
+        }
+        if output, err := header.ReadRange("/file", 100, 4); err != nil || len(output) != 0 {
+            drive_fail("TEST6: Range beyond the file is not empty", t)
+        }
+        if output, err := header.Head("/file", 1 << 20); err != nil || !bytes.Equal(output, data) {
+            drive_fail("TEST7: Head larger than the file did not return it whole", t)
+        }
+
+        if _, err := header.ReadRange("/file", -1, 4); err == nil {
+            drive_fail("TEST8: Negative offset was accepted", t)
+        }
+        if _, err := header.Head("/missing", 4); !errors.Is(err, ErrNotExist) {
+            drive_fail("TEST9: Missing file did not return ErrNotExist", t)
+        }
+        if _, err := header.Head("/dir/", 4); err == nil {
+            drive_fail("TEST10: Directory was read", t)
+        }
+        header.Close()
+    }
+
+    debugOut("[+] Range Read Test PASS")
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Throughput limits. DBConfig.RateLimit caps the bytes per second of all writes, and
+ *  DBConfig.SessionRateLimit those of each principal (see WithPrincipal()), so that a
+ *  bulk import cannot saturate memory bandwidth. An IRP over the limit waits before it
+ *  is queued, not in the IO controller, so it only holds up its own submitter, and the
+ *  wait is cut short by its context. Reads are never throttled, nor are operations
+ *  submitted with PRIORITY_HIGH, which is how a foreground writer bypasses the limit.
+ *
+ * Each limit is a token bucket holding up to one second of throughput. A write larger
+ *  than the bucket is let through once the bucket is refilled, and borrows from the next.
+ */
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+type rateLimiter struct {
+    rate        float64 /* Bytes per second, also the capacity */
+    tokens      float64
+    last        time.Time
+}
+
+type throttle struct {
+    lock        sync.Mutex
+    database    *rateLimiter /* nil if DBConfig.RateLimit is not set */
+    session     int /* DBConfig.SessionRateLimit */
+    sessions    map[string]*rateLimiter
+}
+
+func newRateLimiter(rate int, now time.Time) *rateLimiter {
+    return &rateLimiter{ rate: float64(rate), tokens: float64(rate), last: now }
+}
+
+func (l *rateLimiter) refill(now time.Time) {
+    l.tokens += now.Sub(l.last).Seconds() * l.rate
+    if l.tokens > l.rate {
+        l.tokens = l.rate
+    }
+    l.last = now
+}
+
+/*
+ * Takes `n` bytes from the bucket, and returns how long the caller must wait for them
+ */
+func (l *rateLimiter) reserve(n int, now time.Time) time.Duration {
+    l.refill(now)
+    l.tokens -= float64(n)
+    if l.tokens >= 0 {
+        return 0
+    }
+
+    return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func newThrottle(config *DBConfig) *throttle {
+    if config.RateLimit <= 0 && config.SessionRateLimit <= 0 {
+        return nil
+    }
+
+    t := &throttle{ session: config.SessionRateLimit, sessions: make(map[string]*rateLimiter) }
+    if config.RateLimit > 0 {
+        t.database = newRateLimiter(config.RateLimit, time.Now())
+    }
+
+    return t
+}
+
+/*
+ * Must be called with t.lock held. Operations without a principal are one session
+ */
+func (t *throttle) limiters(principal string, now time.Time) []*rateLimiter {
+    var limiters []*rateLimiter
+    if t.database != nil {
+        limiters = append(limiters, t.database)
+    }
+    if t.session <= 0 {
+        return limiters
+    }
+
+    l := t.sessions[principal]
+    if l == nil {
+        /* Sessions whose bucket is full again are no different from new ones */
+        for k, v := range t.sessions {
+            if v.refill(now); v.tokens >= v.rate {
+                delete(t.sessions, k)
+            }
+        }
+        l = newRateLimiter(t.session, now)
+        t.sessions[principal] = l
+    }
+
+    return append(limiters, l)
+}
+
+/*
+ * Waits until the data of `irp` is within the limits, or ctx is done. The bytes of an
+ *  IRP given up on are returned to the buckets.
+ */
+func (f *FSHeader) throttleIRP(ctx context.Context, irp *govfsIoBlock) error {
+    t := f.throttle
+    if t == nil || len(irp.data) == 0 || priorityFromContext(ctx) == PRIORITY_HIGH {
+        return nil
+    }
+
+    n := len(irp.data)
+    now := time.Now()
+    var wait time.Duration
+
+    t.lock.Lock()
+    limiters := t.limiters(principalFromContext(ctx), now)
+    for _, l := range limiters {
+        if d := l.reserve(n, now); d > wait {
+            wait = d
+        }
+    }
+    t.lock.Unlock()
+
+    if wait == 0 {
+        return nil
+    }
+
+    timer := time.NewTimer(wait)
+    defer timer.Stop()
+
+    select {
+    case <- timer.C:
+        return nil
+    case <- ctx.Done():
+        t.lock.Lock()
+        for _, l := range limiters {
+            l.tokens += float64(n)
+        }
+        t.lock.Unlock()
+        return ctx.Err()
+    }
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestRateLimit(t *testing.T) {
+    debugOut("[+] Running Rate Limit Test...")
+
+    const RATE = 1024 * 1024
+    header, err := CreateDatabaseConfig("rate_limit", FLAG_DB_CREATE, &DBConfig{ RateLimit: RATE })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+    header.Create("/file")
+
+    /* The first second of throughput is not delayed */
+    start := time.Now()
+    if err := header.Write("/file", make([]byte, RATE)); err != nil || time.Since(start) > 400 * time.Millisecond {
+        drive_fail("TEST2: Write within the limit was delayed", t)
+    }
+
+    start = time.Now()
+    if err := header.Write("/file", make([]byte, RATE / 2)); err != nil || time.Since(start) < 400 * time.Millisecond {
+        drive_fail("TEST3: Write over the limit was not delayed", t)
+    }
+
+    /* Foreground writes bypass the limit */
+    header.Write("/file", make([]byte, RATE))
+    start = time.Now()
+    high := WithPriority(context.Background(), PRIORITY_HIGH)
+    if err := header.WriteCtx(high, "/file", make([]byte, RATE / 4)); err != nil || time.Since(start) > 400 * time.Millisecond {
+        drive_fail("TEST4: PRIORITY_HIGH write was delayed", t)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+    defer cancel()
+    if err := header.WriteCtx(ctx, "/file", make([]byte, RATE)); !errors.Is(err, context.DeadlineExceeded) {
+        drive_fail("TEST5: Throttled write did not give up with its context", t)
+    }
+}
+
+func TestSessionRateLimit(t *testing.T) {
+    debugOut("[+] Running Session Rate Limit Test...")
+
+    const RATE = 1024 * 1024
+    header, err := CreateDatabaseConfig("session_rate_limit", FLAG_DB_CREATE, &DBConfig{ SessionRateLimit: RATE })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+    header.Create("/file")
+
+    alice := WithPrincipal(context.Background(), "alice")
+    bob := WithPrincipal(context.Background(), "bob")
+    header.WriteCtx(alice, "/file", make([]byte, RATE))
+
+    /* Another session has its own budget */
+    start := time.Now()
+    if err := header.WriteCtx(bob, "/file", make([]byte, RATE / 4)); err != nil || time.Since(start) > 400 * time.Millisecond {
+        drive_fail("TEST2: Write of another session was delayed", t)
+    }
+
+    start = time.Now()
+    if err := header.WriteCtx(alice, "/file", make([]byte, RATE / 2)); err != nil || time.Since(start) < 400 * time.Millisecond {
+        drive_fail("TEST3: Write over the session limit was not delayed", t)
+    }
+}
@@ -0,0 +1,349 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Record storage. Instead of one monolithic raw fs stream, a RecordStorage keeps each
+ *  file as its own record, so that UnmountDB() only writes the files which changed
+ *  since the last commit or load, and loading only reads the catalog; the data of a
+ *  file is read when it is first accessed.
+ *
+ * The records hold the same RawFile headers and stored data as the stream, i.e. file
+ *  data is compressed by FLAG_COMPRESS_FILES and encrypted by EncryptionPolicy. With
+ *  FLAG_ENCRYPT the data of every file is also encrypted with DBConfig.Cipher and the
+ *  database key. Names, sizes and modification times are not encrypted.
+ */
+
+import (
+    "sync"
+    "bytes"
+    "context"
+)
+
+/*
+ * A file as it is stored. Data is empty for directories and empty files
+ */
+type Record struct {
+    Header      RawFile
+    Data        []byte
+}
+
+type RecordStorage interface {
+    Catalog() ([]RawFile, error) /* The headers of every record */
+    ReadData(name string) ([]byte, error) /* The data of one record, by RawFile.Name. Called concurrently, e.g. by Prefetch() */
+    Commit(put []Record, remove []string) error /* Must be applied atomically */
+}
+
+/*
+ * Files which changed since the last commit or load, keyed by govfsFile.filename. A
+ *  nil file was deleted
+ */
+type dirtySet struct {
+    lock        sync.Mutex
+    files       map[string]*govfsFile
+    all         bool /* Purged, every record is rewritten and stale ones removed */
+}
+
+/*
+ * Called by dispatch() for every file it creates, writes or deletes
+ */
+func (f *FSHeader) markDirty(name string, file *govfsFile) {
+    if f.config.Records == nil || name == "/" {
+        return
+    }
+
+    f.dirty.lock.Lock()
+    defer f.dirty.lock.Unlock()
+
+    if f.dirty.files == nil {
+        f.dirty.files = make(map[string]*govfsFile)
+    }
+    f.dirty.files[name] = file
+}
+
+func (f *FSHeader) markPurged() {
+    if f.config.Records == nil {
+        return
+    }
+
+    f.dirty.lock.Lock()
+    defer f.dirty.lock.Unlock()
+
+    f.dirty.files = nil
+    f.dirty.all = true
+}
+
+/*
+ * UnmountDB() for a RecordStorage database
+ */
+func (f *FSHeader) commitRecords(ctx context.Context, flags FlagVal) error {
+    f.dirty.lock.Lock()
+    dirty, all := f.dirty.files, f.dirty.all
+    f.dirty.files, f.dirty.all = nil, false
+    f.dirty.lock.Unlock()
+
+    var put []Record
+    var remove []string
+    var audited int
+    var labelVersion int
+    var progress *progressTracker
+    err := func () error {
+        if all == true {
+            dirty = make(map[string]*govfsFile)
+            for _, file := range f.files() {
+                if file.filename != "/" {
+                    dirty[file.filename] = file
+                }
+            }
+
+            catalog, err := f.config.Records.Catalog()
+            if err != nil {
+                return err
+            }
+            for _, raw := range catalog {
+                if _, ok := dirty[raw.Name]; !ok && raw.Name != AUDIT_RECORD_NAME && raw.Name != LABELS_RECORD_NAME {
+                    remove = append(remove, raw.Name)
+                }
+            }
+        }
+
+        /* The sizes of the records are not known before encoding them */
+        progress = newProgress(f.config.Progress, LOG_COMMIT, f.filename, len(dirty), 0)
+        for name, file := range dirty {
+            if file == nil {
+                remove = append(remove, name)
+                progress.add(1, 0)
+                continue
+            }
+
+            if err := ctx.Err(); err != nil {
+                return err
+            }
+            record, err := f.encodeRecord(file, flags)
+            if err != nil {
+                return err
+            }
+            put = append(put, record)
+            progress.add(1, int64(record.Header.UnzippedLen))
+        }
+
+        record, count, err := f.auditRecord()
+        if err != nil {
+            return err
+        }
+        if record != nil {
+            put = append(put, *record)
+        }
+        audited = count
+
+        if record, version := f.labelsRecord(); record != nil {
+            put = append(put, *record)
+            labelVersion = version
+        }
+
+        return f.config.Records.Commit(put, remove)
+    }()
+
+    if err == nil {
+        f.auditCommitted(audited)
+        f.labels.setCommitted(labelVersion)
+        f.setStored(put, dirty)
+        f.cacheTrim()
+        progress.done()
+    } else {
+        /* Retry on the next commit, later changes take precedence */
+        f.dirty.lock.Lock()
+        f.dirty.all = f.dirty.all || all
+        for name, file := range dirty {
+            if _, ok := f.dirty.files[name]; !ok {
+                if f.dirty.files == nil {
+                    f.dirty.files = make(map[string]*govfsFile)
+                }
+                f.dirty.files[name] = file
+            }
+        }
+        f.dirty.lock.Unlock()
+    }
+
+    return err
+}
+
+/*
+ * Remembers the committed records of files which did not change while committing
+ */
+func (f *FSHeader) setStored(put []Record, dirty map[string]*govfsFile) {
+    for i := range put {
+        raw := put[i].Header
+        file := dirty[raw.Name]
+        if file == nil || raw.UnzippedLen == 0 {
+            continue
+        }
+
+        file.lock.Lock()
+        if file.dataSum() == raw.RawSum {
+            file.setStored(&raw)
+        }
+        file.lock.Unlock()
+    }
+}
+
+func (f *FSHeader) encodeRecord(file *govfsFile, flags FlagVal) (Record, error) {
+    var stored bytes.Buffer
+    raw, err := f.encodeFile(file, flags, f.config.Codec, &stored)
+    data := stored.Bytes()
+    if err != nil {
+        return Record{}, err
+    }
+    if (raw.Flags & FLAG_COMPRESS) > 0 {
+        raw.Codec = f.config.Codec.Name()
+    }
+
+    if (f.flags & FLAG_ENCRYPT) > 0 && len(data) > 0 {
+        key := f.config.fsKey()
+        data, err = f.config.Cipher.Encrypt(data, key)
+        ZeroKey(key)
+        if err != nil {
+            return Record{}, err
+        }
+    }
+
+    return Record{ Header: raw, Data: data }, nil
+}
+
+/*
+ * Builds a header from the catalog of a RecordStorage. Returns nil if it is empty
+ */
+func loadRecords(name string, flags FlagVal, config *DBConfig) (*FSHeader, error) {
+    catalog, err := config.Records.Catalog()
+    if err != nil || len(catalog) == 0 {
+        return nil, err
+    }
+
+    output := &FSHeader{
+        filename: name,
+        meta:     newMetaTable(),
+        flags:    flags,
+    }
+    output.meta.set("/", &govfsFile{ filename: "/" })
+    output.comp_stats = newCompressionStats(config.Codec.Name())
+
+    for i := range catalog {
+        raw := &catalog[i]
+        if raw.Name == AUDIT_RECORD_NAME {
+            if err := output.loadAuditRecord(config); err != nil {
+                return nil, err
+            }
+            continue
+        }
+        if raw.Name == LABELS_RECORD_NAME {
+            output.labels.set(copyXattrs(raw.Xattrs))
+            continue
+        }
+        output.comp_stats.add(raw, raw.Codec)
+
+        /* FLAG_COMPRESS/FLAG_ENCRYPT on a file describe the stored data only */
+        var fileFlags = raw.Flags
+        if (fileFlags & FLAG_FILE) > 0 {
+            fileFlags &^= FLAG_COMPRESS | FLAG_ENCRYPT
+        }
+
+        file := &govfsFile{
+            filename: raw.Name,
+            flags: fileFlags,
+            modtime: unixNano(raw.ModTime),
+            xattrs: raw.Xattrs,
+        }
+        if raw.UnzippedLen > 0 {
+            file.setSum(raw.RawSum, checksumByName(raw.Checksum))
+            file.setGeneration(raw.Generation)
+            file.size = raw.UnzippedLen
+            file.setStored(raw)
+            file.unload()
+        }
+        output.meta.set(raw.Name, file)
+    }
+    output.setCompressionStats(output.comp_stats)
+    output.usage.rebuild(output.files())
+
+    return output, nil
+}
+
+/*
+ * Reads the data of a file which is still in the RecordStorage. Called by unsealData()
+ *  with file.lock held
+ */
+func (f *FSHeader) loadRecord(file *govfsFile) error {
+    raw := file.record()
+
+    stored, err := f.config.Records.ReadData(raw.Name)
+    if err != nil {
+        return err
+    }
+
+    if (f.flags & FLAG_ENCRYPT) > 0 {
+        key := f.config.fsKey()
+        stored, err = f.config.Cipher.Decrypt(stored, key)
+        ZeroKey(key)
+        if err != nil {
+            return err
+        }
+    }
+
+    codec := codecByName(raw.Codec)
+    if codec == nil {
+        return retErrStr("Unknown compression codec " + raw.Codec)
+    }
+
+    f.policy_lock.RLock()
+    data, err := decodeFile(raw, stored, codec, f.config.Policies)
+    f.policy_lock.RUnlock()
+    if err != nil {
+        return err
+    }
+
+    if f.spills(len(data)) {
+        err = f.spillWrite(file, data)
+        if f.mem_cipher != nil {
+            wipeBuffer(data, false)
+        }
+        if err != nil {
+            return err
+        }
+        file.setLoaded()
+        return nil
+    }
+
+    sealed, err := f.sealData(data)
+    if f.mem_cipher != nil {
+        wipeBuffer(data, false)
+    }
+    if err != nil {
+        return err
+    }
+
+    file.data = sealed
+    file.setLoaded()
+
+    return nil
+}
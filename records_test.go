@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "sync"
+    "bytes"
+    "testing"
+)
+
+/*
+ * In-memory RecordStorage which counts what each commit writes
+ */
+type memRecords struct {
+    headers     map[string]RawFile
+    data        map[string][]byte
+    puts        int
+    removes     int
+    reads       int
+    reads_lock  sync.Mutex
+}
+
+func newMemRecords() *memRecords {
+    return &memRecords{ headers: make(map[string]RawFile), data: make(map[string][]byte) }
+}
+
+func (m *memRecords) Catalog() ([]RawFile, error) {
+    var output []RawFile
+    for _, raw := range m.headers {
+        output = append(output, raw)
+    }
+    return output, nil
+}
+
+func (m *memRecords) ReadData(name string) ([]byte, error) {
+    m.reads_lock.Lock()
+    m.reads++
+    m.reads_lock.Unlock()
+    return append([]byte(nil), m.data[name]...), nil
+}
+
+func (m *memRecords) Commit(put []Record, remove []string) error {
+    for _, record := range put {
+        m.headers[record.Header.Name] = record.Header
+        m.data[record.Header.Name] = append([]byte(nil), record.Data...)
+    }
+    for _, name := range remove {
+        delete(m.headers, name)
+        delete(m.data, name)
+    }
+    m.puts, m.removes = len(put), len(remove)
+    return nil
+}
+
+func TestRecordStorage(t *testing.T) {
+    debugOut("[+] Running Record Storage Test...")
+
+    records := newMemRecords()
+    config := &DBConfig{ Records: records, Codec: CodecZstd }
+    header, err := CreateDatabaseConfig("records", FLAG_DB_LOAD | FLAG_DB_CREATE | FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    text := bytes.Repeat([]byte("compressible "), 200)
+    header.Create("/docs/a.txt")
+    header.Write("/docs/a.txt", text)
+    header.Create("/docs/b.txt")
+    header.Write("/docs/b.txt", []byte("b"))
+    header.Create("/empty")
+    if err := header.UnmountDB(FLAG_COMPRESS_FILES); err != nil {
+        drive_fail("TEST2: Failed to commit records", t)
+    }
+    if records.puts != 4 || len(records.headers) != 4 { /* /docs/, a.txt, b.txt, /empty */
+        drive_fail("TEST3: Unexpected initial commit", t)
+    }
+    if bytes.Contains(records.data["/docs/a.txt"], []byte("compressible")) {
+        drive_fail("TEST4: Record data is not encrypted", t)
+    }
+
+    /* Only changes are written */
+    header.Write("/docs/b.txt", []byte("changed"))
+    header.Delete("/empty")
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST5: Failed to commit records", t)
+    }
+    if records.puts != 1 || records.removes != 1 || len(records.headers) != 3 {
+        drive_fail("TEST6: Commit was not incremental", t)
+    }
+    if err := header.UnmountDB(0); err != nil || records.puts != 0 || records.removes != 0 {
+        drive_fail("TEST7: Commit without changes wrote records", t)
+    }
+    header.Close()
+
+    /* Loading only reads the catalog */
+    header, err = CreateDatabaseConfig("records", FLAG_DB_LOAD | FLAG_ENCRYPT, config)
+    if header == nil || err != nil {
+        drive_fail("TEST8: Failed to load records", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+    if records.reads != 0 || header.GetFileCount() != 4 || header.GetTotalFilesizes() != len(text) + len("changed") {
+        drive_fail("TEST9: Unexpected state after load", t)
+    }
+    if size, _ := header.GetFileSize("/docs/a.txt"); int(size) != len(text) || records.reads != 0 {
+        drive_fail("TEST10: File size required reading the data", t)
+    }
+
+    if data, err := header.Read("/docs/a.txt"); err != nil || !bytes.Equal(data, text) {
+        drive_fail("TEST11: Loaded file has unexpected contents", t)
+    }
+    if data, err := header.Read("/docs/b.txt"); err != nil || string(data) != "changed" {
+        drive_fail("TEST12: Loaded file has unexpected contents", t)
+    }
+    header.Read("/docs/a.txt")
+    if records.reads != 2 {
+        drive_fail("TEST13: Data was read more than once", t)
+    }
+
+    /* Purge removes every record */
+    header.Purge()
+    header.Create("/new")
+    if err := header.UnmountDB(0); err != nil || len(records.headers) != 1 {
+        drive_fail("TEST14: Purge did not remove the records", t)
+    }
+}
@@ -0,0 +1,599 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Streaming replication. Replicate() ships every mutation the IO controller applies
+ *  (create, write, append, delete, purge) over TCP, or TLS if a *tls.Config is given,
+ *  to a follower database which serves Follow(). The follower applies them through
+ *  its own IO controller and is a warm standby copy of the leader.
+ *
+ * Mutations are numbered. On every (re)connect the follower sends the number of the
+ *  last mutation it applied, and the leader resends what it missed from a bounded
+ *  backlog, or a full snapshot if the backlog no longer covers it or the follower
+ *  was replicating another leader.
+ *
+ * The backlog holds file data in plaintext, also with DBConfig.EncryptMemory.
+ */
+
+import (
+    "io"
+    "net"
+    "sort"
+    "sync"
+    "time"
+    "bufio"
+    "errors"
+    "crypto/tls"
+    "crypto/rand"
+    "encoding/gob"
+    "encoding/hex"
+)
+
+const REPL_BACKLOG_SIZE       int           = 16 * 1024 * 1024 /* Bytes of write data kept for followers which reconnect */
+const REPL_RETRY_DELAY        time.Duration = 500 * time.Millisecond /* Doubles after every failed connect */
+const REPL_RETRY_MAX          time.Duration = 30 * time.Second
+const REPL_TIMEOUT            time.Duration = 30 * time.Second /* Per message */
+
+type replOp int
+
+const (
+    REPL_CREATE               replOp = iota
+    REPL_WRITE
+    REPL_APPEND
+    REPL_DELETE
+    REPL_SHRED
+    REPL_PURGE
+    REPL_XATTR                /* Sets the attribute Attr to Data */
+    REPL_REMOVEXATTR
+    REPL_SNAPSHOT             /* Begins a full resync, the follower is inconsistent until REPL_SYNCED */
+    REPL_SYNCED               /* Ends a full resync at Seq */
+)
+
+/*
+ * Sent by the follower on every connect
+ */
+type replHello struct {
+    Epoch       string /* Of the leader the follower replicates, "" if none */
+    Seq         uint64 /* Last mutation applied */
+}
+
+type replMessage struct {
+    Epoch       string /* Only set by REPL_SYNCED */
+    Seq         uint64
+    Op          replOp
+    Name        string
+    Data        []byte
+    Attr        string /* Only set by REPL_XATTR and REPL_REMOVEXATTR */
+    Owner       string /* Only set by REPL_CREATE of a principal, see OWNER_XATTR */
+}
+
+/*
+ * The mutations applied by dispatch(), guarded by lock. dispatch() holds apply shared
+ *  while applying and recording a mutation, so that a snapshot is consistent with seq.
+ *  A snapshot therefore waits for IRPs which are still executing, also ones abandoned
+ *  by DBConfig.OperationTimeout.
+ */
+type replLog struct {
+    apply       sync.RWMutex
+    lock        sync.Mutex
+    epoch       string /* Random, so a follower never mistakes another leader's seq */
+    seq         uint64
+    backlog     []*replMessage
+    size        int /* Bytes of data in backlog */
+    notify      chan struct{} /* Closed and replaced on every mutation */
+    leaders     map[*Replicator]struct{}
+    follow_lock sync.Mutex /* Held by follow(), guards followed */
+    followed    replHello /* Of the leader this database follows, see Follow() */
+}
+
+/*
+ * Replication status of a Replicator
+ */
+type ReplicationStatus struct {
+    Connected   bool
+    Seq         uint64 /* Last mutation sent */
+    Snapshots   uint64 /* Number of full resyncs */
+    Err         error /* Of the last connection attempt or connection */
+}
+
+/*
+ * Ships the mutations of a leader to one follower, see Replicate()
+ */
+type Replicator struct {
+    hdr         *FSHeader
+    addr        string
+    tls_config  *tls.Config
+    stop        chan struct{}
+    done        chan struct{}
+    lock        sync.Mutex
+    conn        net.Conn
+    status      ReplicationStatus
+}
+
+/*
+ * Starts shipping mutations to the follower at `addr`, connecting over TLS if
+ *  `config` is not nil. Reconnects until Close() is called.
+ */
+func (f *FSHeader) Replicate(addr string, config *tls.Config) (*Replicator, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+
+    r := &Replicator{
+        hdr: f,
+        addr: addr,
+        tls_config: config,
+        stop: make(chan struct{}),
+        done: make(chan struct{}),
+    }
+
+    f.repl.lock.Lock()
+    f.repl.init()
+    f.repl.leaders[r] = struct{}{}
+    f.repl.lock.Unlock()
+
+    go r.run()
+
+    return r, nil
+}
+
+/*
+ * Stops replicating. If connected, the mutations recorded so far are sent first.
+ */
+func (r *Replicator) Close() error {
+    r.hdr.repl.lock.Lock()
+    if _, ok := r.hdr.repl.leaders[r]; !ok {
+        r.hdr.repl.lock.Unlock()
+        return ErrClosed
+    }
+    delete(r.hdr.repl.leaders, r)
+    if len(r.hdr.repl.leaders) == 0 {
+        r.hdr.repl.backlog, r.hdr.repl.size = nil, 0
+    }
+    r.hdr.repl.lock.Unlock()
+
+    close(r.stop)
+    <- r.done
+
+    return nil
+}
+
+func (r *Replicator) Status() ReplicationStatus {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    return r.status
+}
+
+/*
+ * Closes every Replicator, called once the header is closed
+ */
+func (f *FSHeader) stopReplication() {
+    f.repl.lock.Lock()
+    var leaders []*Replicator
+    for r := range f.repl.leaders {
+        leaders = append(leaders, r)
+    }
+    f.repl.lock.Unlock()
+
+    for _, r := range leaders {
+        r.Close()
+    }
+}
+
+func (l *replLog) init() {
+    if l.epoch != "" {
+        return
+    }
+
+    var epoch [16]byte
+    io.ReadFull(rand.Reader, epoch[:])
+    l.epoch = hex.EncodeToString(epoch[:])
+    l.notify = make(chan struct{})
+    l.leaders = make(map[*Replicator]struct{})
+}
+
+/*
+ * Called by dispatch() once the IRP is processed
+ */
+func (l *replLog) record(ioh *govfsIoBlock) {
+    if ioh.status != nil {
+        return
+    }
+
+    l.lock.Lock()
+    defer l.lock.Unlock()
+    if l.epoch == "" {
+        return
+    }
+
+    msg := &replMessage{ Name: ioh.name }
+    switch ioh.operation {
+    case IRP_CREATE:
+        msg.Op, msg.Owner = REPL_CREATE, ioh.principal
+    case IRP_WRITE:
+        /* The file keeps ioh.data, and wipes it once it is overwritten */
+        msg.Op, msg.Data = REPL_WRITE, append([]byte(nil), ioh.data...)
+        if (ioh.flags & FLAG_APPEND) > 0 {
+            msg.Op = REPL_APPEND
+        }
+    case IRP_DELETE:
+        msg.Op = REPL_DELETE
+        if (ioh.flags & FLAG_SHRED) > 0 {
+            msg.Op = REPL_SHRED
+        }
+    case IRP_PURGE:
+        msg.Op = REPL_PURGE
+    case IRP_XATTR:
+        msg.Op, msg.Attr, msg.Data = REPL_XATTR, ioh.attr, ioh.data
+        if (ioh.flags & FLAG_REMOVE_XATTR) > 0 {
+            msg.Op, msg.Data = REPL_REMOVEXATTR, nil
+        }
+    default:
+        return
+    }
+
+    l.seq++
+    msg.Seq = l.seq
+    if len(l.leaders) > 0 {
+        l.backlog = append(l.backlog, msg)
+        l.size += len(msg.Data)
+
+        /* A follower which falls further behind gets a snapshot */
+        var trim = 0
+        for l.size > REPL_BACKLOG_SIZE && trim < len(l.backlog) - 1 {
+            l.size -= len(l.backlog[trim].Data)
+            trim++
+        }
+        if trim > 0 {
+            l.backlog = append([]*replMessage(nil), l.backlog[trim:]...)
+        }
+    }
+
+    close(l.notify)
+    l.notify = make(chan struct{})
+}
+
+/*
+ * Returns the mutations after `seq`, or false if the backlog does not cover them.
+ *  Also returns the channel which is closed on the next mutation.
+ */
+func (l *replLog) since(seq uint64) ([]*replMessage, bool, chan struct{}) {
+    l.lock.Lock()
+    defer l.lock.Unlock()
+
+    if seq == l.seq {
+        return nil, true, l.notify
+    }
+    if seq > l.seq || len(l.backlog) == 0 || l.backlog[0].Seq > seq + 1 {
+        return nil, false, l.notify
+    }
+
+    start := sort.Search(len(l.backlog), func (i int) bool { return l.backlog[i].Seq > seq })
+    return append([]*replMessage(nil), l.backlog[start:]...), true, l.notify
+}
+
+/*
+ * Returns every file as REPL_CREATE/REPL_WRITE/REPL_XATTR messages, consistent as of the
+ *  returned mutation number
+ */
+func (f *FSHeader) replSnapshot() ([]*replMessage, uint64, error) {
+    f.repl.apply.Lock()
+    defer f.repl.apply.Unlock()
+
+    files := f.files()
+    sort.Slice(files, func (i, j int) bool { return files[i].filename < files[j].filename })
+
+    var output, xattrs []*replMessage
+    for _, file := range files {
+        if file.filename == "/" {
+            continue
+        }
+
+        /* After all creates, implicit directories only exist once their files do */
+        file.lock.Lock()
+        for _, attr := range xattrNames(file.xattrs) {
+            xattrs = append(xattrs, &replMessage{ Op: REPL_XATTR, Name: file.filename, Attr: attr,
+                Data: []byte(file.xattrs[attr]) })
+        }
+        file.lock.Unlock()
+
+        if (file.flags & FLAG_DIRECTORY) > 0 {
+            /* Implicit directories are created along with their files */
+            if f.check(file.filename) == file {
+                output = append(output, &replMessage{ Op: REPL_CREATE, Name: file.filename })
+            }
+            continue
+        }
+
+        data, err := f.openData(file)
+        if err != nil {
+            return nil, 0, err
+        }
+        output = append(output, &replMessage{ Op: REPL_CREATE, Name: file.filename })
+        if len(data) > 0 {
+            output = append(output, &replMessage{ Op: REPL_WRITE, Name: file.filename, Data: data })
+        }
+    }
+
+    output = append(output, xattrs...)
+
+    f.repl.lock.Lock()
+    defer f.repl.lock.Unlock()
+
+    return output, f.repl.seq, nil
+}
+
+func (r *Replicator) setStatus(update func (s *ReplicationStatus)) {
+    r.lock.Lock()
+    update(&r.status)
+    r.lock.Unlock()
+}
+
+func (r *Replicator) run() {
+    defer close(r.done)
+
+    var delay = REPL_RETRY_DELAY
+    for {
+        start := time.Now()
+        err := r.session()
+        r.hdr.observe(LOG_REPLICATE, r.addr, 0, start, err)
+        r.setStatus(func (s *ReplicationStatus) {
+            s.Connected = false
+            s.Err = err
+        })
+        if err == nil {
+            return /* Closed */
+        }
+
+        select {
+        case <- r.stop:
+            return
+        case <- time.After(delay):
+        }
+        if delay *= 2; delay > REPL_RETRY_MAX {
+            delay = REPL_RETRY_MAX
+        }
+    }
+}
+
+func (r *Replicator) dial() (net.Conn, error) {
+    dialer := &net.Dialer{ Timeout: REPL_TIMEOUT }
+    if r.tls_config != nil {
+        return tls.DialWithDialer(dialer, "tcp", r.addr, r.tls_config)
+    }
+
+    return dialer.Dial("tcp", r.addr)
+}
+
+/*
+ * One connection to the follower. Returns nil once the Replicator is closed
+ */
+func (r *Replicator) session() error {
+    conn, err := r.dial()
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    var hello replHello
+    conn.SetReadDeadline(time.Now().Add(REPL_TIMEOUT))
+    if err := gob.NewDecoder(conn).Decode(&hello); err != nil {
+        return err
+    }
+
+    /* The follower sends nothing else, a read returns once it disconnects */
+    gone := make(chan struct{})
+    conn.SetReadDeadline(time.Time{})
+    go func () {
+        io.Copy(io.Discard, conn)
+        close(gone)
+    }()
+
+    writer := bufio.NewWriter(conn)
+    enc := gob.NewEncoder(writer)
+    send := func (messages []*replMessage) error {
+        for _, msg := range messages {
+            conn.SetWriteDeadline(time.Now().Add(REPL_TIMEOUT))
+            if err := enc.Encode(msg); err != nil {
+                return err
+            }
+        }
+        conn.SetWriteDeadline(time.Now().Add(REPL_TIMEOUT))
+        return writer.Flush()
+    }
+
+    var seq = hello.Seq
+    if hello.Epoch != r.hdr.repl.epoch {
+        seq = ^uint64(0) /* Forces a snapshot */
+    }
+    r.setStatus(func (s *ReplicationStatus) {
+        s.Connected = true
+        s.Err = nil
+    })
+
+    for {
+        messages, ok, notify := r.hdr.repl.since(seq)
+        if ok == false {
+            snapshot, snapshot_seq, err := r.hdr.replSnapshot()
+            if err != nil {
+                return err
+            }
+
+            messages = append([]*replMessage{ { Op: REPL_SNAPSHOT } }, snapshot...)
+            messages = append(messages, &replMessage{ Op: REPL_SYNCED, Epoch: r.hdr.repl.epoch, Seq: snapshot_seq })
+            r.setStatus(func (s *ReplicationStatus) { s.Snapshots++ })
+        }
+
+        if err := send(messages); err != nil {
+            return err
+        }
+        if len(messages) > 0 {
+            seq = messages[len(messages) - 1].Seq
+            r.setStatus(func (s *ReplicationStatus) { s.Seq = seq })
+            continue
+        }
+
+        select {
+        case <- notify:
+        case <- gone:
+            return retErrStr("replicate: Follower disconnected")
+        case <- r.stop:
+            /* Ship what was recorded before Close() */
+            messages, ok, _ := r.hdr.repl.since(seq)
+            if ok == true && len(messages) > 0 {
+                if err := send(messages); err != nil {
+                    return err
+                }
+                seq = messages[len(messages) - 1].Seq
+                r.setStatus(func (s *ReplicationStatus) { s.Seq = seq })
+            }
+            return nil
+        }
+    }
+}
+
+/*
+ * Applies the mutations of a leader which replicates to this database, accepting
+ *  connections on `listener` until it is closed. Wrap the listener with tls.NewListener()
+ *  for TLS. Only one leader is served at a time, a new connection replaces the current
+ *  one, e.g. when the leader reconnects before the old connection timed out.
+ */
+func (f *FSHeader) Follow(listener net.Listener) error {
+    var (
+        lock        sync.Mutex /* Guards current */
+        current     net.Conn
+        sessions    sync.WaitGroup
+    )
+
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            lock.Lock()
+            if current != nil {
+                current.Close()
+            }
+            lock.Unlock()
+            sessions.Wait()
+
+            if errors.Is(err, net.ErrClosed) {
+                return nil
+            }
+            return err
+        }
+
+        lock.Lock()
+        if current != nil {
+            current.Close()
+        }
+        current = conn
+        lock.Unlock()
+
+        sessions.Add(1)
+        go func () {
+            defer sessions.Done()
+            defer conn.Close()
+
+            f.follow(conn)
+        }()
+    }
+}
+
+func (f *FSHeader) follow(conn net.Conn) error {
+    f.repl.follow_lock.Lock()
+    defer f.repl.follow_lock.Unlock()
+
+    state := &f.repl.followed
+    if err := gob.NewEncoder(conn).Encode(state); err != nil {
+        return err
+    }
+
+    dec := gob.NewDecoder(bufio.NewReader(conn))
+    for {
+        var msg replMessage
+        if err := dec.Decode(&msg); err != nil {
+            return err
+        }
+
+        switch msg.Op {
+        case REPL_SNAPSHOT:
+            *state = replHello{}
+            if err := f.Purge(); err != nil {
+                return err
+            }
+            continue
+        case REPL_SYNCED:
+            *state = replHello{ Epoch: msg.Epoch, Seq: msg.Seq }
+            continue
+        }
+
+        if err := f.applyReplicated(&msg); err != nil {
+            /* Diverged from the leader, resync on the next connect */
+            *state = replHello{}
+            return err
+        }
+        if state.Epoch != "" && msg.Seq != 0 {
+            state.Seq = msg.Seq
+        }
+    }
+}
+
+func (f *FSHeader) applyReplicated(msg *replMessage) error {
+    var err error
+    switch msg.Op {
+    case REPL_CREATE:
+        if err = f.Create(msg.Name); errors.Is(err, ErrExist) {
+            err = nil
+        }
+        if err == nil && msg.Owner != "" && msg.Name != "/" {
+            err = f.SetXattr(msg.Name, OWNER_XATTR, msg.Owner)
+        }
+    case REPL_WRITE:
+        err = f.Write(msg.Name, msg.Data)
+    case REPL_APPEND:
+        err = f.Append(msg.Name, msg.Data)
+    case REPL_DELETE, REPL_SHRED:
+        if f.Check(msg.Name) == false {
+            return nil
+        }
+        if msg.Op == REPL_SHRED {
+            err = f.Shred(msg.Name)
+        } else {
+            err = f.Delete(msg.Name)
+        }
+    case REPL_PURGE:
+        err = f.Purge()
+    case REPL_XATTR:
+        err = f.SetXattr(msg.Name, msg.Attr, string(msg.Data))
+    case REPL_REMOVEXATTR:
+        if err = f.RemoveXattr(msg.Name, msg.Attr); errors.Is(err, ErrNoAttribute) {
+            err = nil
+        }
+    default:
+        err = retErrStr("follow: Invalid replication message")
+    }
+
+    return err
+}
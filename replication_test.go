@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "net"
+    "time"
+    "testing"
+)
+
+func waitFor(cond func () bool) bool {
+    for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+        if cond() == true {
+            return true
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    return false
+}
+
+func followerHas(follower *FSHeader, name string, data string) func () bool {
+    return func () bool {
+        output, err := follower.Read(name)
+        return err == nil && string(output) == data
+    }
+}
+
+func TestReplication(t *testing.T) {
+    debugOut("[+] Running Replication Test...")
+
+    follower, _ := CreateDatabaseConfig("follower", FLAG_DB_CREATE, nil)
+    follower.StartIOController()
+    defer follower.Close()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Skip("Cannot listen: ", err)
+    }
+    addr := listener.Addr().String()
+    followed := make(chan error, 1)
+    go func () { followed <- follower.Follow(listener) }()
+
+    /* Existing files reach the follower with a snapshot */
+    leader, _ := CreateDatabaseConfig("leader", FLAG_DB_CREATE, nil)
+    leader.StartIOController()
+    defer leader.Close()
+    leader.Create("/pre/a")
+    leader.Write("/pre/a", []byte("before"))
+    leader.AddTags("/pre/a", "snapshot")
+    leader.Create("/dir/")
+
+    replicator, err := leader.Replicate(addr, nil)
+    if err != nil {
+        drive_fail("TEST1: Failed to start replication", t)
+    }
+    if waitFor(followerHas(follower, "/pre/a", "before")) == false || follower.Check("/dir/") == false ||
+        waitFor(func () bool { tags, _ := follower.Tags("/pre/a"); return len(tags) == 1 }) == false {
+        drive_fail("TEST2: Snapshot was not replicated", t)
+    }
+
+    /* Mutations are streamed */
+    leader.Create("/b")
+    leader.Write("/b", []byte("hello"))
+    leader.Append("/b", []byte(" world"))
+    leader.SetXattr("/b", "author", "alex")
+    leader.Create("/c")
+    leader.Delete("/c")
+    if waitFor(followerHas(follower, "/b", "hello world")) == false ||
+        waitFor(func () bool { value, _ := follower.GetXattr("/b", "author"); return value == "alex" }) == false {
+        drive_fail("TEST3: Mutations were not replicated", t)
+    }
+    if waitFor(func () bool { return follower.Check("/c") == false }) == false {
+        drive_fail("TEST4: Delete was not replicated", t)
+    }
+    if status := replicator.Status(); status.Connected == false || status.Snapshots != 1 {
+        drive_fail("TEST5: Invalid replication status", t)
+    }
+
+    /* Mutations made while disconnected are resent from the backlog */
+    listener.Close()
+    if err := <- followed; err != nil {
+        drive_fail("TEST6: Follow failed", t)
+    }
+    waitFor(func () bool { return replicator.Status().Connected == false })
+    leader.Append("/b", []byte("!"))
+    leader.Create("/d")
+
+    if listener, err = net.Listen("tcp", addr); err != nil {
+        t.Skip("Cannot listen again: ", err)
+    }
+    defer listener.Close()
+    go follower.Follow(listener)
+
+    if waitFor(followerHas(follower, "/b", "hello world!")) == false || follower.Check("/d") == false {
+        drive_fail("TEST7: Missed mutations were not resent", t)
+    }
+    if status := replicator.Status(); status.Snapshots != 1 {
+        drive_fail("TEST8: Reconnect resent a snapshot instead of the backlog", t)
+    }
+
+    /* A Purge() on the leader leaves only the root */
+    leader.Purge()
+    if waitFor(func () bool { return follower.GetFileCount() == 1 }) == false {
+        drive_fail("TEST9: Purge was not replicated", t)
+    }
+
+    if err := replicator.Close(); err != nil || replicator.Close() != ErrClosed {
+        drive_fail("TEST10: Failed to close the replicator", t)
+    }
+
+    debugOut("[+] Replication Test PASS")
+}
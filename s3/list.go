@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+
+package s3
+
+import (
+    "sort"
+    "strings"
+    "strconv"
+    "net/http"
+    "io/fs"
+    "encoding/xml"
+    "encoding/base64"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+type listEntry struct {
+    Key             string      `xml:"Key"`
+    LastModified    string      `xml:"LastModified"`
+    ETag            string      `xml:"ETag"`
+    Size            int64       `xml:"Size"`
+    StorageClass    string      `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+    Prefix          string      `xml:"Prefix"`
+}
+
+/*
+ * ListObjects (V1) and ListObjectsV2 result. Fields which only apply to one
+ *  version are omitted when empty
+ */
+type listResult struct {
+    XMLName                 xml.Name        `xml:"ListBucketResult"`
+    Namespace               string          `xml:"xmlns,attr"`
+    Name                    string          `xml:"Name"`
+    Prefix                  string          `xml:"Prefix"`
+    Marker                  *string         `xml:"Marker,omitempty"`
+    NextMarker              string          `xml:"NextMarker,omitempty"`
+    ContinuationToken       string          `xml:"ContinuationToken,omitempty"`
+    NextContinuationToken   string          `xml:"NextContinuationToken,omitempty"`
+    StartAfter              string          `xml:"StartAfter,omitempty"`
+    KeyCount                *int            `xml:"KeyCount,omitempty"`
+    MaxKeys                 int             `xml:"MaxKeys"`
+    Delimiter               string          `xml:"Delimiter,omitempty"`
+    IsTruncated             bool            `xml:"IsTruncated"`
+    Contents                []listEntry     `xml:"Contents"`
+    CommonPrefixes          []commonPrefix  `xml:"CommonPrefixes"`
+}
+
+func sortedKeys(m map[string]*govfs.FSHeader) []string {
+    output := make([]string, 0, len(m))
+    for k := range m {
+        output = append(output, k)
+    }
+    sort.Strings(output)
+
+    return output
+}
+
+/*
+ * Returns every object key in key order. Files are keyed by their path, and empty
+ *  directories by their path with a trailing "/"
+ */
+func objectKeys(hdr *govfs.FSHeader) ([]string, error) {
+    var output []string
+    err := fs.WalkDir(hdr.FS(), ".", func (name string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if name == "." {
+            return nil
+        }
+
+        if d.IsDir() {
+            if entries, _ := fs.ReadDir(hdr.FS(), name); len(entries) == 0 {
+                output = append(output, name + "/")
+            }
+            return nil
+        }
+        output = append(output, name)
+
+        return nil
+    })
+    sort.Strings(output) /* "a.txt" sorts before "a/b", unlike a directory walk */
+
+    return output, err
+}
+
+func (h *Handler) listObjects(w http.ResponseWriter, r *http.Request, bucket string, hdr *govfs.FSHeader) error {
+    query := r.URL.Query()
+    result := listResult{
+        Namespace: S3_NAMESPACE,
+        Name: bucket,
+        Prefix: query.Get("prefix"),
+        Delimiter: query.Get("delimiter"),
+        MaxKeys: S3_DEFAULT_MAX_KEYS,
+    }
+    if max := query.Get("max-keys"); max != "" {
+        n, err := strconv.Atoi(max)
+        if err != nil || n < 0 {
+            return newError(http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+        }
+        if n < S3_DEFAULT_MAX_KEYS {
+            result.MaxKeys = n
+        }
+    }
+
+    /* Entries up to and including marker have been returned */
+    var marker string
+    v2 := query.Get("list-type") == "2"
+    if v2 == true {
+        result.StartAfter = query.Get("start-after")
+        result.ContinuationToken = query.Get("continuation-token")
+        marker = result.StartAfter
+        if result.ContinuationToken != "" {
+            decoded, err := base64.StdEncoding.DecodeString(result.ContinuationToken)
+            if err != nil {
+                return newError(http.StatusBadRequest, "InvalidArgument", "Invalid continuation-token")
+            }
+            marker = string(decoded)
+        }
+    } else {
+        marker = query.Get("marker")
+        result.Marker = &marker
+    }
+
+    keys, err := objectKeys(hdr)
+    if err != nil {
+        return err
+    }
+
+    var last string
+    count := 0
+    for _, key := range keys {
+        if !strings.HasPrefix(key, result.Prefix) || key <= marker {
+            continue
+        }
+
+        var prefix string
+        if result.Delimiter != "" {
+            if i := strings.Index(key[len(result.Prefix):], result.Delimiter); i >= 0 {
+                prefix = key[:len(result.Prefix) + i + len(result.Delimiter)]
+            }
+        }
+        if prefix != "" && (prefix == last || prefix <= marker) {
+            continue /* Already returned */
+        }
+
+        if count == result.MaxKeys {
+            result.IsTruncated = true
+            break
+        }
+        count++
+
+        if prefix != "" {
+            result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{ Prefix: prefix })
+            last = prefix
+            continue
+        }
+
+        data, modtime, err := readObject(hdr, key)
+        if err != nil {
+            continue /* Deleted during the listing */
+        }
+        result.Contents = append(result.Contents, listEntry{
+            Key: key,
+            LastModified: modtime.UTC().Format(S3_TIME_FORMAT),
+            ETag: etag(data),
+            Size: int64(len(data)),
+            StorageClass: "STANDARD",
+        })
+        last = key
+    }
+
+    if result.IsTruncated == true {
+        if v2 == true {
+            result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+        } else {
+            result.NextMarker = last
+        }
+    }
+    if v2 == true {
+        result.KeyCount = &count
+    }
+    writeXML(w, http.StatusOK, &result)
+
+    return nil
+}
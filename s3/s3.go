@@ -0,0 +1,504 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+
+/*
+ * Package s3 serves govfs databases through a minimal S3-compatible endpoint, so
+ *  that S3 SDKs and tools such as rclone can read and write them. Each bucket is a
+ *  database and each object key is a path within it, i.e. "dir/file" is "/dir/file".
+ *
+ * Only path-style requests are supported (http://host/bucket/key). Request
+ *  signatures are not checked, so the endpoint should only be reachable by trusted
+ *  clients. Multipart uploads, versioning and object metadata are not supported
+ */
+package s3
+
+import (
+    "io"
+    "fmt"
+    "bytes"
+    "bufio"
+    "errors"
+    "strings"
+    "strconv"
+    "net/url"
+    "net/http"
+    "io/fs"
+    "time"
+    "crypto/md5"
+    "encoding/hex"
+    "encoding/xml"
+    "encoding/base64"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+const S3_NAMESPACE string = "http://s3.amazonaws.com/doc/2006-03-01/"
+const S3_TIME_FORMAT string = "2006-01-02T15:04:05.000Z"
+const S3_DEFAULT_MAX_KEYS int = 1000
+const S3_MAX_OBJECT_SIZE int64 = 5 << 30 /* S3's limit for a single PUT, the default of Handler.MaxObjectSize */
+const S3_MAX_CHUNK_SIZE int64 = 16 << 20 /* Largest aws-chunked chunk accepted */
+
+/*
+ * Serves each database under its bucket name. The IO controllers must be running
+ */
+type Handler struct {
+    buckets     map[string]*govfs.FSHeader
+    created     time.Time
+    MaxObjectSize int64 /* Largest object accepted by a PUT, defaults to S3_MAX_OBJECT_SIZE */
+}
+
+func NewHandler(buckets map[string]*govfs.FSHeader) *Handler {
+    h := &Handler{
+        buckets: make(map[string]*govfs.FSHeader, len(buckets)),
+        created: time.Now(),
+    }
+    for name, hdr := range buckets {
+        h.buckets[name] = hdr
+    }
+
+    return h
+}
+
+/*
+ * S3 error response
+ */
+type s3Error struct {
+    XMLName     xml.Name    `xml:"Error"`
+    Code        string      `xml:"Code"`
+    Message     string      `xml:"Message"`
+    Resource    string      `xml:"Resource"`
+    status      int
+}
+
+func (e *s3Error) Error() string {
+    return e.Code + ": " + e.Message
+}
+
+func newError(status int, code string, message string) *s3Error {
+    return &s3Error{ Code: code, Message: message, status: status }
+}
+
+var (
+    errNoSuchBucket     = newError(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+    errNoSuchKey        = newError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+    errInvalidKey       = newError(http.StatusBadRequest, "InvalidArgument", "The specified key is not a valid path")
+    errBadDigest        = newError(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received")
+    errNotImplemented   = newError(http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented")
+    errMethod           = newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+    errTooLarge         = newError(http.StatusBadRequest, "EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size")
+    errIncompleteBody   = newError(http.StatusBadRequest, "IncompleteBody", "Truncated aws-chunked body")
+)
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+    var s3err *s3Error
+    if !errors.As(err, &s3err) {
+        s3err = newError(http.StatusInternalServerError, "InternalError", err.Error())
+    }
+
+    output := *s3err
+    output.Resource = r.URL.Path
+    if r.Method == http.MethodHead {
+        w.WriteHeader(output.status)
+        return
+    }
+    writeXML(w, output.status, &output)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/xml")
+    w.WriteHeader(status)
+    io.WriteString(w, xml.Header)
+    xml.NewEncoder(w).Encode(v)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+    if bucket == "" {
+        if r.Method != http.MethodGet {
+            writeError(w, r, errMethod)
+            return
+        }
+        h.listBuckets(w, r)
+        return
+    }
+
+    hdr := h.buckets[bucket]
+    if hdr == nil {
+        writeError(w, r, errNoSuchBucket)
+        return
+    }
+
+    var err error
+    if key == "" {
+        switch r.Method {
+        case http.MethodGet:
+            err = h.listObjects(w, r, bucket, hdr)
+        case http.MethodHead, http.MethodPut: /* PUT is CreateBucket, which already exists */
+            w.WriteHeader(http.StatusOK)
+        case http.MethodPost:
+            if _, ok := r.URL.Query()["delete"]; !ok {
+                err = errNotImplemented
+                break
+            }
+            err = h.deleteObjects(w, r, hdr)
+        default:
+            err = errNotImplemented
+        }
+    } else {
+        if _, ok := r.URL.Query()["uploads"]; ok {
+            writeError(w, r, errNotImplemented)
+            return
+        }
+
+        switch r.Method {
+        case http.MethodGet, http.MethodHead:
+            err = h.getObject(w, r, hdr, key)
+        case http.MethodPut:
+            if r.Header.Get("x-amz-copy-source") != "" {
+                err = h.copyObject(w, r, hdr, key)
+                break
+            }
+            err = h.putObject(w, r, hdr, key)
+        case http.MethodDelete:
+            err = deleteObject(hdr, key)
+            if err == nil {
+                w.WriteHeader(http.StatusNoContent)
+            }
+        default:
+            err = errMethod
+        }
+    }
+
+    if err != nil {
+        writeError(w, r, err)
+    }
+}
+
+/*
+ * Returns the fs.FS name of an object key. Keys ending in "/" are directories
+ */
+func fsName(key string) (string, error) {
+    name := strings.TrimSuffix(key, "/")
+    if name == "" || !fs.ValidPath(name) {
+        return "", errInvalidKey
+    }
+
+    return name, nil
+}
+
+func etag(data []byte) string {
+    sum := md5.Sum(data)
+    return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+/*
+ * Returns the contents and modification time of an object, or errNoSuchKey
+ */
+func readObject(hdr *govfs.FSHeader, key string) ([]byte, time.Time, error) {
+    name, err := fsName(key)
+    if err != nil {
+        return nil, time.Time{}, err
+    }
+
+    info, err := fs.Stat(hdr.FS(), name)
+    if err != nil || info.IsDir() != strings.HasSuffix(key, "/") {
+        return nil, time.Time{}, errNoSuchKey
+    }
+    if info.IsDir() {
+        return nil, info.ModTime(), nil
+    }
+
+    data, err := fs.ReadFile(hdr.FS(), name)
+    if err != nil {
+        return nil, time.Time{}, err
+    }
+
+    return data, info.ModTime(), nil
+}
+
+/*
+ * Stores data under key, replacing any previous contents. A key ending in "/"
+ *  creates a directory
+ */
+func writeObject(r *http.Request, hdr *govfs.FSHeader, key string, data []byte) error {
+    name, err := fsName(key)
+    if err != nil {
+        return err
+    }
+    info, statErr := fs.Stat(hdr.FS(), name)
+
+    if strings.HasSuffix(key, "/") {
+        if len(data) > 0 {
+            return newError(http.StatusBadRequest, "InvalidArgument", "A directory object must be empty")
+        }
+        if statErr == nil && info.IsDir() {
+            return nil
+        }
+        return hdr.CreateCtx(r.Context(), "/" + name + "/")
+    }
+
+    path := "/" + name
+    switch {
+    case statErr == nil && info.IsDir():
+        return newError(http.StatusConflict, "InvalidArgument", "The key is a directory")
+    case statErr != nil:
+        if err := hdr.CreateCtx(r.Context(), path); err != nil {
+            return err
+        }
+    }
+
+    return hdr.WriteCtx(r.Context(), path, data)
+}
+
+func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, hdr *govfs.FSHeader, key string) error {
+    data, modtime, err := readObject(hdr, key)
+    if err != nil {
+        return err
+    }
+
+    w.Header().Set("ETag", etag(data))
+    w.Header().Set("Content-Type", "application/octet-stream")
+    http.ServeContent(w, r, "", modtime, bytes.NewReader(data))
+
+    return nil
+}
+
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, hdr *govfs.FSHeader, key string) error {
+    data, err := readBody(w, r, h.maxObjectSize())
+    if err != nil {
+        return err
+    }
+
+    if digest := r.Header.Get("Content-MD5"); digest != "" {
+        sum := md5.Sum(data)
+        if digest != base64.StdEncoding.EncodeToString(sum[:]) {
+            return errBadDigest
+        }
+    }
+
+    if err := writeObject(r, hdr, key, data); err != nil {
+        return err
+    }
+
+    w.Header().Set("ETag", etag(data))
+    w.WriteHeader(http.StatusOK)
+
+    return nil
+}
+
+func (h *Handler) copyObject(w http.ResponseWriter, r *http.Request, hdr *govfs.FSHeader, key string) error {
+    source, err := url.PathUnescape(r.Header.Get("x-amz-copy-source"))
+    if err != nil {
+        return newError(http.StatusBadRequest, "InvalidArgument", "Invalid x-amz-copy-source")
+    }
+    source, _, _ = strings.Cut(source, "?") /* versionId */
+
+    bucket, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+    sourceHdr := h.buckets[bucket]
+    if sourceHdr == nil {
+        return errNoSuchBucket
+    }
+
+    data, _, err := readObject(sourceHdr, sourceKey)
+    if err != nil {
+        return err
+    }
+    if err := writeObject(r, hdr, key, data); err != nil {
+        return err
+    }
+
+    writeXML(w, http.StatusOK, &struct {
+        XMLName         xml.Name    `xml:"CopyObjectResult"`
+        LastModified    string      `xml:"LastModified"`
+        ETag            string      `xml:"ETag"`
+    }{ LastModified: time.Now().UTC().Format(S3_TIME_FORMAT), ETag: etag(data) })
+
+    return nil
+}
+
+/*
+ * Deleting a missing key succeeds, as in S3. A directory is only removed when it
+ *  is empty, so that deleting a "dir/" marker does not orphan its children
+ */
+func deleteObject(hdr *govfs.FSHeader, key string) error {
+    name, err := fsName(key)
+    if err != nil {
+        return err
+    }
+
+    info, err := fs.Stat(hdr.FS(), name)
+    if err != nil || info.IsDir() != strings.HasSuffix(key, "/") {
+        return nil
+    }
+
+    path := "/" + name
+    if info.IsDir() {
+        if entries, _ := fs.ReadDir(hdr.FS(), name); len(entries) > 0 {
+            return nil
+        }
+        if hdr.Check(path + "/") == true {
+            path += "/" /* Explicitly created, implicit directories are keyed without the "/" */
+        }
+    }
+
+    return hdr.Delete(path)
+}
+
+func (h *Handler) deleteObjects(w http.ResponseWriter, r *http.Request, hdr *govfs.FSHeader) error {
+    var request struct {
+        Quiet       bool        `xml:"Quiet"`
+        Objects     []struct {
+            Key         string      `xml:"Key"`
+        }                       `xml:"Object"`
+    }
+    if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+        return newError(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed")
+    }
+
+    type deleted struct {
+        Key         string      `xml:"Key"`
+    }
+    type deleteError struct {
+        Key         string      `xml:"Key"`
+        Code        string      `xml:"Code"`
+        Message     string      `xml:"Message"`
+    }
+    result := struct {
+        XMLName     xml.Name        `xml:"DeleteResult"`
+        Namespace   string          `xml:"xmlns,attr"`
+        Deleted     []deleted       `xml:"Deleted"`
+        Errors      []deleteError   `xml:"Error"`
+    }{ Namespace: S3_NAMESPACE }
+
+    for _, object := range request.Objects {
+        if err := deleteObject(hdr, object.Key); err != nil {
+            result.Errors = append(result.Errors, deleteError{ Key: object.Key, Code: "InternalError", Message: err.Error() })
+            continue
+        }
+        if request.Quiet == false {
+            result.Deleted = append(result.Deleted, deleted{ Key: object.Key })
+        }
+    }
+    writeXML(w, http.StatusOK, &result)
+
+    return nil
+}
+
+func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+    type bucket struct {
+        Name            string      `xml:"Name"`
+        CreationDate    string      `xml:"CreationDate"`
+    }
+    result := struct {
+        XMLName     xml.Name    `xml:"ListAllMyBucketsResult"`
+        Namespace   string      `xml:"xmlns,attr"`
+        Owner       struct {
+            ID          string      `xml:"ID"`
+            DisplayName string      `xml:"DisplayName"`
+        }                       `xml:"Owner"`
+        Buckets     []bucket    `xml:"Buckets>Bucket"`
+    }{ Namespace: S3_NAMESPACE }
+    result.Owner.ID = "govfs"
+    result.Owner.DisplayName = "govfs"
+
+    for _, name := range sortedKeys(h.buckets) {
+        result.Buckets = append(result.Buckets, bucket{ Name: name, CreationDate: h.created.UTC().Format(S3_TIME_FORMAT) })
+    }
+    writeXML(w, http.StatusOK, &result)
+}
+
+func (h *Handler) maxObjectSize() int64 {
+    if h.MaxObjectSize > 0 {
+        return h.MaxObjectSize
+    }
+
+    return S3_MAX_OBJECT_SIZE
+}
+
+/*
+ * Reads the request body of at most `max` bytes, decoding the aws-chunked encoding
+ *  used by SigV4 streaming uploads. The sizes are sent by the client, so the buffer
+ *  only grows as data arrives
+ */
+func readBody(w http.ResponseWriter, r *http.Request, max int64) ([]byte, error) {
+    if !strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") &&
+        !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+        if r.ContentLength > max {
+            return nil, errTooLarge
+        }
+
+        data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, max))
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            return nil, errTooLarge
+        }
+        return data, err
+    }
+
+    var limit = max
+    if decoded := r.Header.Get("x-amz-decoded-content-length"); decoded != "" {
+        length, err := strconv.ParseInt(decoded, 10, 64)
+        if err != nil || length < 0 {
+            return nil, newError(http.StatusBadRequest, "InvalidArgument", "Invalid x-amz-decoded-content-length")
+        }
+        if length > max {
+            return nil, errTooLarge
+        }
+        limit = length
+    }
+
+    var output bytes.Buffer
+    reader := bufio.NewReader(r.Body)
+    for {
+        /* ReadSlice() fails on lines longer than the buffer, rather than growing it */
+        line, err := reader.ReadSlice('\n')
+        if err != nil {
+            return nil, errIncompleteBody
+        }
+
+        size, _, _ := strings.Cut(strings.TrimSpace(string(line)), ";")
+        length, err := strconv.ParseInt(size, 16, 64)
+        if err != nil || length < 0 || length > S3_MAX_CHUNK_SIZE {
+            return nil, newError(http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("Invalid chunk size %q", size))
+        }
+        if length == 0 {
+            /* Trailers, if any, are ignored */
+            if r.Header.Get("x-amz-decoded-content-length") != "" && int64(output.Len()) != limit {
+                return nil, errIncompleteBody
+            }
+            return output.Bytes(), nil
+        }
+        if int64(output.Len()) + length > limit {
+            return nil, errTooLarge
+        }
+
+        if _, err := io.CopyN(&output, reader, length); err != nil {
+            return nil, errIncompleteBody
+        }
+        var crlf [2]byte /* Each chunk is followed by "\r\n" */
+        if _, err := io.ReadFull(reader, crlf[:]); err != nil {
+            return nil, errIncompleteBody
+        }
+    }
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+
+package s3
+
+import (
+    "io"
+    "strings"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "encoding/xml"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+func do(t *testing.T, method string, url string, body string, headers ...string) (int, http.Header, string) {
+    req, err := http.NewRequest(method, url, strings.NewReader(body))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i + 1 < len(headers); i += 2 {
+        req.Header.Set(headers[i], headers[i + 1])
+    }
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    data, _ := io.ReadAll(resp.Body)
+
+    return resp.StatusCode, resp.Header, string(data)
+}
+
+func newServer(t *testing.T) (*govfs.FSHeader, *httptest.Server) {
+    header, err := govfs.CreateDatabase(filepath.Join(t.TempDir(), "test_s3"), govfs.FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        t.Fatal("Failed to create database")
+    }
+    header.StartIOController()
+    t.Cleanup(func () { header.Close() })
+
+    server := httptest.NewServer(NewHandler(map[string]*govfs.FSHeader{ "media": header }))
+    t.Cleanup(server.Close)
+
+    return header, server
+}
+
+func TestS3Objects(t *testing.T) {
+    header, server := newServer(t)
+
+    code, resp, _ := do(t, "PUT", server.URL + "/media/photos/cat.jpg", "meow", "Content-MD5", "SkvkDJasYxTpHZPzgEOmNA==")
+    if code != http.StatusOK || resp.Get("ETag") != "\"4a4be40c96ac6314e91d93f38043a634\"" {
+        t.Fatalf("TEST1: PUT returned %d, ETag %s", code, resp.Get("ETag"))
+    }
+    if data, err := header.Read("/photos/cat.jpg"); err != nil || string(data) != "meow" {
+        t.Fatal("TEST2: PUT did not write the file")
+    }
+    if code, _, _ := do(t, "PUT", server.URL + "/media/bad", "meow", "Content-MD5", "AAAAAAAAAAAAAAAAAAAAAA=="); code != http.StatusBadRequest {
+        t.Fatalf("TEST3: PUT with a bad Content-MD5 returned %d", code)
+    }
+
+    if code, _, body := do(t, "GET", server.URL + "/media/photos/cat.jpg", "", "Range", "bytes=1-2"); code != http.StatusPartialContent || body != "eo" {
+        t.Fatalf("TEST4: Range GET returned %d: %s", code, body)
+    }
+    if code, resp, _ := do(t, "HEAD", server.URL + "/media/photos/cat.jpg", ""); code != http.StatusOK || resp.Get("Content-Length") != "4" {
+        t.Fatalf("TEST5: HEAD returned %d", code)
+    }
+    if code, _, body := do(t, "GET", server.URL + "/media/photos/dog.jpg", ""); code != http.StatusNotFound || !strings.Contains(body, "NoSuchKey") {
+        t.Fatalf("TEST6: GET of a missing key returned %d: %s", code, body)
+    }
+    if code, _, _ := do(t, "GET", server.URL + "/nobucket/key", ""); code != http.StatusNotFound {
+        t.Fatalf("TEST7: GET of a missing bucket returned %d", code)
+    }
+
+    /* SigV4 streaming upload */
+    chunked := "5;chunk-signature=00\r\nhello\r\n6;chunk-signature=00\r\n world\r\n0;chunk-signature=00\r\n\r\n"
+    if code, _, _ := do(t, "PUT", server.URL + "/media/hello.txt", chunked, "x-amz-content-sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"); code != http.StatusOK {
+        t.Fatalf("TEST8: Chunked PUT returned %d", code)
+    }
+    if data, _ := header.Read("/hello.txt"); string(data) != "hello world" {
+        t.Fatalf("TEST9: Chunked PUT wrote %q", data)
+    }
+
+    if code, _, body := do(t, "PUT", server.URL + "/media/backup/cat.jpg", "", "x-amz-copy-source", "/media/photos/cat.jpg"); code != http.StatusOK ||
+        !strings.Contains(body, "CopyObjectResult") {
+        t.Fatalf("TEST10: Copy returned %d: %s", code, body)
+    }
+    if data, _ := header.Read("/backup/cat.jpg"); string(data) != "meow" {
+        t.Fatal("TEST11: Copy did not copy the contents")
+    }
+
+    /* An empty body truncates */
+    do(t, "PUT", server.URL + "/media/backup/cat.jpg", "")
+    if size, _ := header.GetFileSize("/backup/cat.jpg"); size != 0 {
+        t.Fatal("TEST12: PUT of an empty body did not truncate")
+    }
+
+    if code, _, _ := do(t, "DELETE", server.URL + "/media/photos/cat.jpg", ""); code != http.StatusNoContent || header.Check("/photos/cat.jpg") {
+        t.Fatalf("TEST13: DELETE returned %d", code)
+    }
+    if code, _, _ := do(t, "DELETE", server.URL + "/media/photos/cat.jpg", ""); code != http.StatusNoContent {
+        t.Fatalf("TEST14: DELETE of a missing key returned %d", code)
+    }
+
+    request := "<Delete><Object><Key>hello.txt</Key></Object><Object><Key>backup/cat.jpg</Key></Object></Delete>"
+    if code, _, body := do(t, "POST", server.URL + "/media?delete", request); code != http.StatusOK || strings.Count(body, "<Deleted>") != 2 {
+        t.Fatalf("TEST15: DeleteObjects returned %d: %s", code, body)
+    }
+    if header.Check("/hello.txt") || header.Check("/backup/cat.jpg") {
+        t.Fatal("TEST16: DeleteObjects did not delete the files")
+    }
+}
+
+func TestS3List(t *testing.T) {
+    header, server := newServer(t)
+
+    for _, name := range []string{ "/a.txt", "/a/1", "/a/2", "/b/c/3", "/z" } {
+        header.Create(name)
+        header.Write(name, []byte(name))
+    }
+    header.Create("/empty/")
+
+    list := func (query string) listResult {
+        code, _, body := do(t, "GET", server.URL + "/media?" + query, "")
+        if code != http.StatusOK {
+            t.Fatalf("List %s returned %d: %s", query, code, body)
+        }
+        var result listResult
+        if err := xml.Unmarshal([]byte(body), &result); err != nil {
+            t.Fatal(err)
+        }
+        return result
+    }
+    keys := func (result listResult) string {
+        var output []string
+        for _, e := range result.Contents {
+            output = append(output, e.Key)
+        }
+        for _, p := range result.CommonPrefixes {
+            output = append(output, p.Prefix)
+        }
+        return strings.Join(output, ",")
+    }
+
+    if got := keys(list("")); got != "a.txt,a/1,a/2,b/c/3,empty/,z" {
+        t.Fatalf("TEST1: Unexpected listing %s", got)
+    }
+    if got := keys(list("delimiter=/")); got != "a.txt,z,a/,b/,empty/" {
+        t.Fatalf("TEST2: Unexpected delimited listing %s", got)
+    }
+    if got := keys(list("prefix=a/&delimiter=/")); got != "a/1,a/2" {
+        t.Fatalf("TEST3: Unexpected prefixed listing %s", got)
+    }
+
+    /* Page through with both list versions */
+    var pages []string
+    result := list("list-type=2&max-keys=2&delimiter=/")
+    for {
+        pages = append(pages, keys(result))
+        if result.IsTruncated == false {
+            break
+        }
+        result = list("list-type=2&max-keys=2&delimiter=/&continuation-token=" + result.NextContinuationToken)
+    }
+    if got := strings.Join(pages, "|"); got != "a.txt,a/|b/,empty/|z" {
+        t.Fatalf("TEST4: Unexpected V2 pages %s", got)
+    }
+
+    pages = nil
+    result = list("max-keys=4")
+    for {
+        pages = append(pages, keys(result))
+        if result.IsTruncated == false {
+            break
+        }
+        result = list("max-keys=4&marker=" + result.NextMarker)
+    }
+    if got := strings.Join(pages, "|"); got != "a.txt,a/1,a/2,b/c/3|empty/,z" {
+        t.Fatalf("TEST5: Unexpected V1 pages %s", got)
+    }
+
+    if code, _, body := do(t, "GET", server.URL + "/", ""); code != http.StatusOK || !strings.Contains(body, "<Name>media</Name>") {
+        t.Fatalf("TEST6: ListBuckets returned %d: %s", code, body)
+    }
+}
+
+func TestS3Limits(t *testing.T) {
+    header, err := govfs.CreateDatabase(filepath.Join(t.TempDir(), "test_s3_limits"), govfs.FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    handler := NewHandler(map[string]*govfs.FSHeader{ "media": header })
+    handler.MaxObjectSize = 8
+    server := httptest.NewServer(handler)
+    defer server.Close()
+
+    const streaming = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+    if code, _, body := do(t, "PUT", server.URL + "/media/big", "0123456789"); code != http.StatusBadRequest || !strings.Contains(body, "EntityTooLarge") {
+        t.Fatalf("TEST2: PUT over MaxObjectSize returned %d: %s", code, body)
+    }
+
+    /* Chunk sizes are sent by the client, and must not be allocated up front */
+    huge := "7fffffffffffffff;chunk-signature=00\r\nhello\r\n0;chunk-signature=00\r\n\r\n"
+    if code, _, _ := do(t, "PUT", server.URL + "/media/huge", huge, "x-amz-content-sha256", streaming); code != http.StatusBadRequest {
+        t.Fatalf("TEST3: PUT with a huge chunk size returned %d", code)
+    }
+    chunks := "5;chunk-signature=00\r\nhello\r\n5;chunk-signature=00\r\nworld\r\n0;chunk-signature=00\r\n\r\n"
+    if code, _, body := do(t, "PUT", server.URL + "/media/chunks", chunks, "x-amz-content-sha256", streaming); code != http.StatusBadRequest || !strings.Contains(body, "EntityTooLarge") {
+        t.Fatalf("TEST4: Chunked PUT over MaxObjectSize returned %d: %s", code, body)
+    }
+    if code, _, _ := do(t, "PUT", server.URL + "/media/decoded", "5;chunk-signature=00\r\nhello\r\n0;chunk-signature=00\r\n\r\n",
+        "x-amz-content-sha256", streaming, "x-amz-decoded-content-length", "100"); code != http.StatusBadRequest {
+        t.Fatalf("TEST5: Chunked PUT with x-amz-decoded-content-length over MaxObjectSize returned %d", code)
+    }
+    if code, _, _ := do(t, "PUT", server.URL + "/media/short", "5;chunk-signature=00\r\nhello\r\n0;chunk-signature=00\r\n\r\n",
+        "x-amz-content-sha256", streaming, "x-amz-decoded-content-length", "6"); code != http.StatusBadRequest {
+        t.Fatalf("TEST6: Chunked PUT shorter than x-amz-decoded-content-length returned %d", code)
+    }
+    if code, _, _ := do(t, "PUT", server.URL + "/media/ok", "5;chunk-signature=00\r\nhello\r\n0;chunk-signature=00\r\n\r\n",
+        "x-amz-content-sha256", streaming, "x-amz-decoded-content-length", "5"); code != http.StatusOK {
+        t.Fatalf("TEST7: Chunked PUT within MaxObjectSize returned %d", code)
+    }
+    if header.Check("/big") || header.Check("/huge") || header.Check("/chunks") {
+        t.Fatal("TEST8: A rejected PUT created a file")
+    }
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Encryption and compression scopes. By default FLAG_ENCRYPT and FLAG_COMPRESS apply
+ *  to the whole raw fs stream. DBConfig.EncryptScope and DBConfig.CompressScope narrow
+ *  either to the catalog, i.e. the stream header and the RawFile of every file, or to the
+ *  data of the files. A scoped stream keeps the two apart:
+ *
+ *  SCOPED_STREAM_MAGIC | envelope | scope | uvarint catalog length | catalog | data
+ *
+ *  The magic, the envelope and the scope byte are never encrypted, so the stream records
+ *  its own layout and loading does not require either option. The catalog is compressed
+ *  and then encrypted as a whole, the data of every file on its own, in the order of the
+ *  catalog. With SCOPE_DATA encryption the names and attributes stay readable, e.g. to
+ *  scan the catalog, while the contents are encrypted.
+ */
+
+import (
+    "bytes"
+    "encoding/binary"
+)
+
+type Scope int
+const (
+    SCOPE_ALL                 Scope = iota /* The whole raw fs stream, the default */
+    SCOPE_DATA                /* The data of each file */
+    SCOPE_METADATA            /* The catalog of names, attributes and the stream header */
+)
+
+const SCOPED_STREAM_MAGIC     string    = "govfs\x00sc" /* Precedes the envelope of a scoped stream, outside of any encryption */
+
+/*
+ * Bits of the scope byte, which describe how the parts of a scoped stream are stored
+ */
+const (
+    SCOPED_DATA_ENCRYPTED     byte      = 1 << iota
+    SCOPED_CATALOG_ENCRYPTED
+    SCOPED_CATALOG_COMPRESSED
+)
+
+/*
+ * Returns whether commits write a scoped stream
+ */
+func (c *DBConfig) scoped() bool {
+    return c.EncryptScope != SCOPE_ALL || c.CompressScope != SCOPE_ALL
+}
+
+/*
+ * Returns the scope byte of the next commit. The data of each file is compressed by
+ *  the UnmountDB() flags, see scopedFlags()
+ */
+func (f *FSHeader) scopeBits() byte {
+    var bits byte = 0
+    if (f.flags & FLAG_ENCRYPT) > 0 {
+        if f.config.EncryptScope != SCOPE_METADATA {
+            bits |= SCOPED_DATA_ENCRYPTED
+        }
+        if f.config.EncryptScope != SCOPE_DATA {
+            bits |= SCOPED_CATALOG_ENCRYPTED
+        }
+    }
+    if (f.flags & FLAG_COMPRESS) > 0 && f.config.CompressScope != SCOPE_DATA {
+        bits |= SCOPED_CATALOG_COMPRESSED
+    }
+    return bits
+}
+
+/*
+ * Returns the UnmountDB() flags of a scoped commit, which compress the data of each
+ *  file if FLAG_COMPRESS covers it
+ */
+func (f *FSHeader) scopedFlags(flags FlagVal) FlagVal {
+    if (f.flags & FLAG_COMPRESS) > 0 && f.config.CompressScope != SCOPE_METADATA {
+        flags |= FLAG_COMPRESS_FILES
+    }
+    return flags
+}
+
+/*
+ * Encrypts the stored data of a file of a scoped commit
+ */
+func (f *FSHeader) sealScoped(data *bytes.Buffer) error {
+    key := f.config.fsKey()
+    sealed, err := f.config.Cipher.Encrypt(data.Bytes(), key)
+    ZeroKey(key)
+    if err != nil {
+        return err
+    }
+
+    data.Reset()
+    data.Write(sealed)
+    return nil
+}
+
+/*
+ * Assembles the serialized fs table of a scoped stream from its catalog and data
+ */
+func (f *FSHeader) encodeScoped(catalog *bytes.Buffer, data *bytes.Buffer) (*bytes.Buffer, error) {
+    bits := f.scopeBits()
+
+    var blob = catalog.Bytes()
+    if (bits & SCOPED_CATALOG_COMPRESSED) > 0 {
+        out, err := f.config.Codec.Compress(blob)
+        if err != nil {
+            return nil, err
+        }
+        blob = out
+    }
+    if (bits & SCOPED_CATALOG_ENCRYPTED) > 0 {
+        key := f.config.fsKey()
+        out, err := f.config.Cipher.Encrypt(blob, key)
+        ZeroKey(key)
+        if err != nil {
+            return nil, err
+        }
+        blob = out
+    }
+
+    var length [binary.MaxVarintLen64]byte
+    n := binary.PutUvarint(length[:], uint64(len(blob)))
+
+    output := new(bytes.Buffer)
+    output.Grow(1 + n + len(blob) + data.Len())
+    output.WriteByte(bits)
+    output.Write(length[:n])
+    output.Write(blob)
+    output.Write(data.Bytes())
+    return output, nil
+}
+
+/*
+ * Splits the serialized fs table of a scoped stream into its decrypted and decompressed
+ *  catalog and its data. `unseal` decrypts the stored data of a file, and is nil unless
+ *  it is encrypted
+ */
+func decodeScoped(table []byte, config *DBConfig) (catalog *bytes.Buffer, data *bytes.Buffer,
+    unseal func ([]byte) ([]byte, error), err error) {
+    if len(table) == 0 {
+        return nil, nil, nil, retErrStr("Scoped stream is truncated")
+    }
+    bits := table[0]
+
+    length, n := binary.Uvarint(table[1:])
+    if n <= 0 || length > uint64(len(table) - 1 - n) {
+        return nil, nil, nil, retErrStr("Scoped stream is truncated")
+    }
+    blob := table[1 + n:1 + n + int(length)]
+
+    if (bits & SCOPED_CATALOG_ENCRYPTED) > 0 {
+        key := config.fsKey()
+        blob, err = config.Cipher.Decrypt(blob, key)
+        ZeroKey(key)
+        if err != nil {
+            return nil, nil, nil, err
+        }
+    }
+    if (bits & SCOPED_CATALOG_COMPRESSED) > 0 {
+        /* The codec is identified by its magic, fall back to the configured one */
+        codec := detectCodec(blob)
+        if codec == nil {
+            codec = config.Codec
+        }
+        if blob, err = codec.Decompress(blob); err != nil {
+            return nil, nil, nil, retErrStr("Failed to decompress the catalog (" + codec.Name() + "): " +
+                err.Error())
+        }
+    }
+
+    if (bits & SCOPED_DATA_ENCRYPTED) > 0 {
+        unseal = func (stored []byte) ([]byte, error) {
+            key := config.fsKey()
+            defer ZeroKey(key)
+            return config.Cipher.Decrypt(stored, key)
+        }
+    }
+
+    return bytes.NewBuffer(blob), bytes.NewBuffer(table[1 + n + int(length):]), unseal, nil
+}
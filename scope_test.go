@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "bytes"
+    "strconv"
+    "testing"
+)
+
+func TestScopes(t *testing.T) {
+    debugOut("[+] Running Encryption/Compression Scope Test...")
+
+    var name = "/catalog_visible_name"
+    var data = bytes.Repeat([]byte("contents_stay_hidden "), 64)
+
+    for i, scope := range []struct {
+        encrypt     Scope
+        compress    Scope
+        pad         int
+    } {
+        { SCOPE_DATA, SCOPE_DATA, 0 },
+        { SCOPE_METADATA, SCOPE_METADATA, 0 },
+        { SCOPE_DATA, SCOPE_ALL, 4096 },
+        { SCOPE_ALL, SCOPE_METADATA, 0 },
+    } {
+        var filename = gen_raw_filename("test_scope_" + strconv.Itoa(i))
+        os.Remove(filename)
+        defer os.Remove(filename)
+
+        config := &DBConfig{ EncryptScope: scope.encrypt, CompressScope: scope.compress, PadSize: scope.pad }
+        header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | FLAG_ENCRYPT | FLAG_COMPRESS, config)
+        if header == nil || err != nil {
+            drive_fail("TEST1: Failed to create database", t)
+        }
+        header.StartIOController()
+        header.Create("/dir/")
+        header.Create(name)
+        header.Write(name, data)
+        header.Create("/empty")
+        if err := header.UnmountDB(0); err != nil {
+            drive_fail("TEST2: Failed to commit database", t)
+        }
+
+        raw, _ := os.ReadFile(filename)
+        if bytes.HasPrefix(raw, []byte(SCOPED_STREAM_MAGIC)) == false {
+            drive_fail("TEST3: Stream is not scoped", t)
+        }
+        if visible := bytes.Contains(raw, []byte(name)); visible != (i == 0) {
+            drive_fail("TEST4: Catalog visibility does not match the scope", t)
+        }
+        if visible := bytes.Contains(raw, data[:32]); visible != (i == 1) {
+            drive_fail("TEST5: Data visibility does not match the scope", t)
+        }
+        if scope.pad > 0 && (len(raw) - len(SCOPED_STREAM_MAGIC)) % scope.pad != 0 {
+            drive_fail("TEST6: Scoped stream is not padded", t)
+        }
+
+        /* The stream describes itself */
+        if ok, err := IsDatabase(filename, 0, nil); ok == false || err != nil {
+            drive_fail("TEST7: Scoped stream is not recognized", t)
+        }
+        loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+        if loaded == nil || err != nil {
+            drive_fail("TEST8: Failed to load scoped database", t)
+        }
+        if output, _ := loaded.Read(name); !bytes.Equal(output, data) {
+            drive_fail("TEST9: Data mismatch after load", t)
+        }
+        if loaded.Check("/dir/") == false || loaded.Check("/empty") == false {
+            drive_fail("TEST10: Files missing after load", t)
+        }
+    }
+
+    /* A truncated catalog is rejected */
+    if _, _, _, err := decodeScoped([]byte{ 0, 100, 1, 2 }, &DBConfig{}); err == nil {
+        drive_fail("TEST11: Accepted a truncated catalog", t)
+    }
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Background scrubber, enabled by setting DBConfig.ScrubInterval. Verifies the checksum
+ *  of one file per interval, cycling through all of them, so that silent corruption in
+ *  memory or in a spill file is found before it is read or committed. A corrupt file
+ *  whose contents were unchanged since the last commit is repaired from
+ *  DBConfig.Records; the raw fs stream cannot be read back one file at a time. Both
+ *  are delivered to Watch() as EVENT_CORRUPT and EVENT_REPAIRED.
+ *
+ * Files which are not resident, i.e. still (or again) only in DBConfig.Records, are
+ *  skipped: their contents are verified when they are loaded.
+ */
+
+import (
+    "context"
+    "sort"
+    "time"
+)
+
+const (
+    EVENT_CORRUPT             string    = "corrupt" /* The contents of Path do not match their checksum */
+    EVENT_REPAIRED            string    = "repaired" /* The contents of Path were read back from DBConfig.Records */
+)
+
+type ScrubReport struct {
+    Files       int /* Number of files verified */
+    Corrupt     []string /* Including the repaired ones */
+    Repaired    []string
+}
+
+type scrubber struct {
+    stop        chan struct{}
+    done        chan struct{}
+}
+
+/*
+ * Verifies every file once, as the scrubber does but without waiting between them
+ */
+func (f *FSHeader) Scrub(ctx context.Context) (ScrubReport, error) {
+    var report ScrubReport
+
+    for _, name := range f.scrubNames() {
+        if f.isClosed() {
+            return report, ErrClosed
+        }
+        if err := ctx.Err(); err != nil {
+            return report, err
+        }
+
+        verified, repaired, err := f.scrubFile(name)
+        if verified == true {
+            report.Files++
+        }
+        if err != nil {
+            report.Corrupt = append(report.Corrupt, name)
+        }
+        if repaired == true {
+            report.Repaired = append(report.Repaired, name)
+        }
+    }
+
+    return report, nil
+}
+
+func (f *FSHeader) startScrubber() {
+    f.scrub = &scrubber{
+        stop: make(chan struct{}),
+        done: make(chan struct{}),
+    }
+
+    go f.runScrubber(f.scrub)
+}
+
+/*
+ * Called by Shutdown()
+ */
+func (f *FSHeader) stopScrubber() {
+    if f.scrub == nil {
+        return
+    }
+
+    close(f.scrub.stop)
+    <- f.scrub.done
+}
+
+func (f *FSHeader) runScrubber(s *scrubber) {
+    defer close(s.done)
+
+    ticker := time.NewTicker(f.config.ScrubInterval)
+    defer ticker.Stop()
+
+    var names []string
+    for {
+        select {
+        case <- s.stop:
+            return
+        case <- ticker.C:
+        }
+
+        /* Files created during a pass are verified by the next one */
+        if len(names) == 0 {
+            names = f.scrubNames()
+            if len(names) == 0 {
+                continue
+            }
+        }
+        f.scrubFile(names[0])
+        names = names[1:]
+    }
+}
+
+/*
+ * The files to verify, in order
+ */
+func (f *FSHeader) scrubNames() []string {
+    var names []string
+    for _, file := range f.files() {
+        if (file.flags & FLAG_DIRECTORY) == 0 {
+            names = append(names, file.filename)
+        }
+    }
+    sort.Strings(names)
+
+    return names
+}
+
+/*
+ * Verifies one file, and repairs it if it is corrupt. Returns ErrChecksum if it was
+ *  corrupt, even if it was repaired
+ */
+func (f *FSHeader) scrubFile(name string) (verified bool, repaired bool, err error) {
+    file := f.check(name)
+    if file == nil {
+        return false, false, nil
+    }
+
+    start := time.Now()
+    file.lock.Lock()
+    if (file.flags & FLAG_DIRECTORY) > 0 || file.record() != nil || file.sumAlgorithm() == nil ||
+        file.dataSum() == "" {
+        file.lock.Unlock()
+        return false, false, nil
+    }
+
+    data, err := f.unsealData(file)
+    if err == nil {
+        if checksumOf(file.sumAlgorithm(), data) != file.dataSum() {
+            err = ErrChecksum
+        }
+        wipeBuffer(data, false)
+    } else {
+        /* Sealed contents fail to open if they were modified */
+        err = ErrChecksum
+    }
+    if err != nil {
+        repaired = f.repairFile(file)
+    }
+    size := file.size
+    file.lock.Unlock()
+
+    f.observe(LOG_SCRUB, name, size, start, err)
+    if err != nil {
+        f.notifyEvent(Event{ Op: EVENT_CORRUPT, Path: name, Size: size, Time: time.Now() })
+    }
+    if repaired == true {
+        f.notifyEvent(Event{ Op: EVENT_REPAIRED, Path: name, Size: size, Time: time.Now() })
+    }
+
+    return true, repaired, err
+}
+
+/*
+ * Replaces corrupt contents with the committed ones, if they are the same contents. The
+ *  caller holds file.lock
+ */
+func (f *FSHeader) repairFile(file *govfsFile) bool {
+    if f.config.Records == nil || file.stored() == nil || file.stored().RawSum != file.dataSum() {
+        return false
+    }
+
+    f.adjustMemory(-residentSize(file))
+    wipeBuffer(file.data, false)
+    file.data = nil
+    f.removeSpill(file, false)
+    file.unload()
+
+    /* Otherwise the next read tries again */
+    return f.loadUnloaded(file) == nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestScrub(t *testing.T) {
+    debugOut("[+] Running Scrubber Test...")
+
+    header, err := CreateDatabaseConfig("scrub", FLAG_DB_CREATE, &DBConfig{ Records: newMemRecords() })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/a")
+    header.Write("/a", []byte("committed contents"))
+    header.Create("/b")
+    header.Write("/b", []byte("contents"))
+    header.Create("/dir/")
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+    header.Write("/b", []byte("uncommitted contents"))
+
+    report, err := header.Scrub(context.Background())
+    if err != nil || report.Files != 2 || len(report.Corrupt) != 0 {
+        drive_fail("TEST3: Intact files were reported corrupt", t)
+    }
+
+    events, cancel := header.Watch("/")
+    defer cancel()
+    header.check("/a").data[0] ^= 1
+    header.check("/b").data[0] ^= 1
+
+    /* Only /a is unchanged since the commit */
+    report, err = header.Scrub(context.Background())
+    if err != nil || strings.Join(report.Corrupt, " ") != "/a /b" || strings.Join(report.Repaired, " ") != "/a" {
+        drive_fail("TEST4: Invalid scrub report", t)
+    }
+    if data, err := header.Read("/a"); err != nil || string(data) != "committed contents" {
+        drive_fail("TEST5: Corrupt file was not repaired", t)
+    }
+
+    var ops []string
+    for i := 0; i < 3; i++ {
+        e := <- events
+        ops = append(ops, e.Op + " " + e.Path)
+    }
+    if strings.Join(ops, ", ") != "corrupt /a, repaired /a, corrupt /b" {
+        drive_fail("TEST6: Invalid events: " + strings.Join(ops, ", "), t)
+    }
+
+    debugOut("[+] Scrubber Test PASS")
+}
+
+func TestScrubInterval(t *testing.T) {
+    header, err := CreateDatabaseConfig("scrub_interval", FLAG_DB_CREATE,
+        &DBConfig{ ScrubInterval: time.Millisecond, EncryptMemory: true })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    events, cancel := header.Watch("/")
+    defer cancel()
+    header.Create("/file")
+    header.Write("/file", []byte("contents"))
+    file := header.check("/file")
+    file.lock.Lock()
+    file.data[0] ^= 1
+    file.lock.Unlock()
+
+    timeout := time.After(10 * time.Second)
+    for {
+        select {
+        case e := <- events:
+            if e.Op == EVENT_CORRUPT && e.Path == "/file" {
+                return
+            }
+        case <- timeout:
+            drive_fail("TEST2: Scrubber did not report the corrupt file", t)
+        }
+    }
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Sessions. A session is the principal attached to a context by WithPrincipal(), and
+ *  every *Ctx() operation made with that context is made as it: audit entries and hooks
+ *  record it, DBConfig.SessionRateLimit throttles it, ACLs are enforced for it (see
+ *  acl.go), and files and directories it creates are owned by it. DBConfig.SessionQuota
+ *  bounds the bytes of the files each principal owns. FSCtx(), FileServer() with
+ *  SessionHandler(), and the WebDAV and SFTP servers carry the session of a request
+ *  through, so that one database can serve several users
+ */
+
+import (
+    "context"
+)
+
+const OWNER_XATTR             string    = "govfs.owner" /* The principal which created the file */
+
+/*
+ * Returns the principal which owns a file or directory, "" if it was not created by
+ *  one. Only operations without a principal may change OWNER_XATTR
+ */
+func (f *FSHeader) Owner(name string) (string, error) {
+    attrs, err := f.Xattrs(name)
+    if err != nil {
+        return "", err
+    }
+
+    return attrs[OWNER_XATTR], nil
+}
+
+/*
+ * Returns the bytes of the files owned by `principal`, as counted against
+ *  DBConfig.SessionQuota
+ */
+func (f *FSHeader) SessionUsage(principal string) int {
+    return f.usage.owned(principal)
+}
+
+/*
+ * Buffered writes reach the IO controller without their principal, so those of a
+ *  principal are not buffered. The audit log, hooks, ACLs, quota and rate limit all
+ *  see the caller
+ */
+func (f *FSHeader) buffersSession(ctx context.Context) bool {
+    return principalFromContext(ctx) == ""
+}
+
+/*
+ * The caller holds file.lock
+ */
+func fileOwner(file *govfsFile) string {
+    return file.xattrs[OWNER_XATTR]
+}
+
+/*
+ * Fails with ErrSessionQuota if a write of a principal growing `file` by `growth` bytes
+ *  would take the owner of the file over DBConfig.SessionQuota. Files without an owner
+ *  are not counted. The caller holds file.lock
+ */
+func (f *FSHeader) checkSessionQuota(file *govfsFile, principal string, growth int) error {
+    if f.config.SessionQuota <= 0 || principal == "" || growth <= 0 {
+        return nil
+    }
+
+    owner := fileOwner(file)
+    if owner == "" {
+        return nil
+    }
+    if f.usage.owned(owner) + growth > f.config.SessionQuota {
+        return pathError("write", file.filename, ErrSessionQuota)
+    }
+
+    return nil
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "io"
+    "errors"
+    "context"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+)
+
+func TestSession(t *testing.T) {
+    debugOut("[+] Running Session Test...")
+
+    var filename = gen_raw_filename("test_session")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ SessionQuota: 100, Audit: true }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    alice := WithPrincipal(context.Background(), "alice")
+    bob := WithPrincipal(context.Background(), "bob")
+
+    /* Files are owned by the principal which created them */
+    header.CreateCtx(alice, "/alice/a.txt")
+    header.Create("/shared.txt")
+    if owner, err := header.Owner("/alice/a.txt"); err != nil || owner != "alice" {
+        drive_fail("TEST2: Owner() of a file created by a principal failed", t)
+    }
+    if owner, err := header.Owner("/shared.txt"); err != nil || owner != "" {
+        drive_fail("TEST3: Owner() of a file created without a principal failed", t)
+    }
+
+    /* The bytes of the files of each owner are counted against the quota */
+    if err := header.WriteCtx(alice, "/alice/a.txt", make([]byte, 60)); err != nil {
+        drive_fail("TEST4: WriteCtx() within the quota failed", t)
+    }
+    if err := header.AppendCtx(alice, "/alice/a.txt", make([]byte, 30)); err != nil {
+        drive_fail("TEST5: AppendCtx() within the quota failed", t)
+    }
+    if usage := header.SessionUsage("alice"); usage != 90 {
+        drive_fail("TEST6: SessionUsage() did not count the writes", t)
+    }
+    if err := header.AppendCtx(alice, "/alice/a.txt", make([]byte, 20)); !errors.Is(err, ErrSessionQuota) || !errors.Is(err, ErrQuota) {
+        drive_fail("TEST7: AppendCtx() over the quota did not fail with ErrSessionQuota", t)
+    }
+    if err := header.WriteCtx(bob, "/alice/a.txt", make([]byte, 120)); !errors.Is(err, ErrSessionQuota) {
+        drive_fail("TEST8: WriteCtx() of another principal over the quota of the owner did not fail", t)
+    }
+    if err := header.WriteCtx(alice, "/alice/a.txt", make([]byte, 40)); err != nil || header.SessionUsage("alice") != 40 {
+        drive_fail("TEST9: WriteCtx() shrinking a file was not counted", t)
+    }
+
+    /* Operations without a principal, and files without an owner, are not limited */
+    if err := header.Write("/alice/a.txt", make([]byte, 150)); err != nil || header.SessionUsage("alice") != 150 {
+        drive_fail("TEST10: Write() without a principal failed", t)
+    }
+    if err := header.WriteCtx(bob, "/shared.txt", make([]byte, 500)); err != nil || header.SessionUsage("bob") != 0 {
+        drive_fail("TEST11: WriteCtx() of a file without an owner failed", t)
+    }
+
+    /* Changing the owner moves the bytes of the file */
+    if err := header.SetXattr("/alice/a.txt", OWNER_XATTR, "bob"); err != nil {
+        drive_fail("TEST12: SetXattr() of OWNER_XATTR failed", t)
+    }
+    if header.SessionUsage("alice") != 0 || header.SessionUsage("bob") != 150 {
+        drive_fail("TEST13: The bytes of the file did not move to its new owner", t)
+    }
+    header.CreateCtx(bob, "/bob.txt")
+    header.WriteCtx(bob, "/bob.txt", make([]byte, 10))
+    if err := header.DeleteCtx(bob, "/bob.txt"); err != nil || header.SessionUsage("bob") != 150 {
+        drive_fail("TEST14: DeleteCtx() was not counted", t)
+    }
+
+    /* Audit entries are attributed to the session */
+    if entries := header.Audit(AuditQuery{ Principal: "alice" }); len(entries) == 0 {
+        drive_fail("TEST15: Operations of the session were not audited", t)
+    }
+
+    /* Owners are committed, and the usage rebuilt on load */
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST16: Failed to commit database", t)
+    }
+    header.Close()
+
+    loaded, err := Open(filename, WithConfig(config))
+    if loaded == nil || err != nil {
+        drive_fail("TEST17: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+    if owner, _ := loaded.Owner("/alice/a.txt"); owner != "bob" || loaded.SessionUsage("bob") != 150 {
+        drive_fail("TEST18: Owners were not committed", t)
+    }
+    if err := loaded.AppendCtx(bob, "/alice/a.txt", []byte("x")); !errors.Is(err, ErrSessionQuota) {
+        drive_fail("TEST19: The quota was not enforced after loading", t)
+    }
+}
+
+func TestSessionWriteBack(t *testing.T) {
+    debugOut("[+] Running Session Write-Back Test...")
+
+    header, err := CreateDatabaseConfig("session_wb", FLAG_DB_CREATE, &DBConfig{ WriteBackSize: 1024, Audit: true })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    alice := WithPrincipal(context.Background(), "alice")
+    header.Create("/a")
+    header.Write("/a", []byte("buffered"))
+    if err := header.WriteCtx(alice, "/a", []byte("small")); err != nil {
+        drive_fail("TEST2: Write of a principal failed", t)
+    }
+    if err := header.AppendCtx(alice, "/a", []byte("!")); err != nil {
+        drive_fail("TEST3: Append of a principal failed", t)
+    }
+    header.Sync()
+
+    /* Small writes of a principal bypass the cache, and are audited as it */
+    if entries := header.Audit(AuditQuery{ Prefix: "/a", Principal: "alice" }); len(entries) != 2 ||
+        entries[0].Op != LOG_WRITE || entries[1].Op != LOG_APPEND {
+        drive_fail("TEST4: Writes of a principal were not audited as it", t)
+    }
+    if data, _ := header.Read("/a"); string(data) != "small!" {
+        drive_fail("TEST5: Unexpected contents", t)
+    }
+}
+
+func TestSessionHTTP(t *testing.T) {
+    debugOut("[+] Running Session HTTP Test...")
+
+    var filename = gen_raw_filename("test_session_http")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+    header.Create("/site/page.html")
+    header.Write("/site/page.html", []byte("<html>page</html>"))
+    header.SetACL("/site/page.html", []ACLEntry{ { Principal: "alice", Allow: ACCESS_READ } })
+
+    /* FSCtx() checks reads for the principal */
+    if _, err := header.FSCtx(WithPrincipal(context.Background(), "bob")).Open("site/page.html"); !errors.Is(err, ErrPermission) {
+        drive_fail("TEST2: FSCtx().Open() denied by the ACL did not fail with ErrPermission", t)
+    }
+    if _, err := header.FSCtx(WithPrincipal(context.Background(), "alice")).Open("site/page.html"); err != nil {
+        drive_fail("TEST3: FSCtx().Open() allowed by the ACL failed", t)
+    }
+
+    handler := SessionHandler(header.FileServer(), func (r *http.Request) string {
+        return r.Header.Get("X-User")
+    })
+    server := httptest.NewServer(handler)
+    defer server.Close()
+
+    get := func (user string) (int, string) {
+        req, _ := http.NewRequest("GET", server.URL + "/site/page.html", nil)
+        req.Header.Set("X-User", user)
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            drive_fail("TEST4: GET failed", t)
+        }
+        defer resp.Body.Close()
+        body, _ := io.ReadAll(resp.Body)
+        return resp.StatusCode, string(body)
+    }
+
+    if code, body := get("alice"); code != http.StatusOK || body != "<html>page</html>" {
+        drive_fail("TEST5: GET of a session allowed by the ACL failed", t)
+    }
+    if code, _ := get("bob"); code != http.StatusForbidden {
+        drive_fail("TEST6: GET of a session denied by the ACL was not forbidden", t)
+    }
+    if code, _ := get(""); code != http.StatusOK {
+        drive_fail("TEST7: GET without a session failed", t)
+    }
+}
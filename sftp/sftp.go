@@ -0,0 +1,289 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+/*
+ * Package sftp serves a govfs database over SFTP, with the semantics of the WebDAV
+ *  server: writes are buffered per open file and stored when the file is closed, and
+ *  renames copy. Symbolic links and attribute changes are not supported
+ */
+package sftp
+
+import (
+    "io"
+    "os"
+    "net"
+    "path"
+    "sync"
+    "bytes"
+    "context"
+    "io/fs"
+
+    "github.com/AlexRuzin/govfs"
+    "github.com/AlexRuzin/govfs/webdav"
+    xsftp "github.com/pkg/sftp"
+    "golang.org/x/crypto/ssh"
+    xwebdav "golang.org/x/net/webdav"
+)
+
+/*
+ * Returns the handlers of an sftp.RequestServer serving hdr. If readOnly is set, every
+ *  request that would modify the database fails with permission denied. The IO
+ *  controller must be running
+ */
+func NewHandlers(hdr *govfs.FSHeader, readOnly bool) xsftp.Handlers {
+    return NewSessionHandlers(hdr, readOnly, "")
+}
+
+/*
+ * NewHandlers() whose requests are made as `principal`, see govfs.WithPrincipal()
+ */
+func NewSessionHandlers(hdr *govfs.FSHeader, readOnly bool, principal string) xsftp.Handlers {
+    h := &handlers{ hdr: hdr, fs: webdav.NewFileSystem(hdr), readOnly: readOnly, principal: principal }
+    return xsftp.Handlers{ FileGet: h, FilePut: h, FileCmd: h, FileList: h }
+}
+
+/*
+ * Accepts SSH connections on listener until it is closed, serving hdr to every
+ *  "sftp" subsystem request. config authenticates the clients, and the requests of
+ *  each connection are made as its SSH user
+ */
+func Serve(listener net.Listener, config *ssh.ServerConfig, hdr *govfs.FSHeader, readOnly bool) error {
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            return err
+        }
+
+        go serveConn(conn, config, hdr, readOnly)
+    }
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig, hdr *govfs.FSHeader, readOnly bool) {
+    defer conn.Close()
+
+    sconn, channels, requests, err := ssh.NewServerConn(conn, config)
+    if err != nil {
+        return
+    }
+    go ssh.DiscardRequests(requests)
+    h := NewSessionHandlers(hdr, readOnly, sconn.User())
+
+    for newChannel := range channels {
+        if newChannel.ChannelType() != "session" {
+            newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+            continue
+        }
+
+        channel, requests, err := newChannel.Accept()
+        if err != nil {
+            return
+        }
+        go serveSession(channel, requests, h)
+    }
+}
+
+/*
+ * Only the "sftp" subsystem is served, there is no shell
+ */
+func serveSession(channel ssh.Channel, requests <-chan *ssh.Request, h xsftp.Handlers) {
+    defer channel.Close()
+
+    for req := range requests {
+        ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+        req.Reply(ok, nil)
+        if ok == false {
+            continue
+        }
+
+        go ssh.DiscardRequests(requests)
+        server := xsftp.NewRequestServer(channel, h)
+        server.Serve()
+        server.Close()
+        return
+    }
+}
+
+type handlers struct {
+    hdr         *govfs.FSHeader
+    fs          xwebdav.FileSystem
+    readOnly    bool
+    principal   string
+}
+
+/*
+ * Context of a request, with the principal of the handlers
+ */
+func (h *handlers) context(ctx context.Context) context.Context {
+    if h.principal == "" {
+        return ctx
+    }
+
+    return govfs.WithPrincipal(ctx, h.principal)
+}
+
+/*
+ * Reads a snapshot of the file
+ */
+func (h *handlers) Fileread(r *xsftp.Request) (io.ReaderAt, error) {
+    data, err := fs.ReadFile(h.hdr.FSCtx(h.context(r.Context())), fsName(r.Filepath))
+    if err != nil {
+        return nil, err
+    }
+
+    return bytes.NewReader(data), nil
+}
+
+func (h *handlers) Filewrite(r *xsftp.Request) (io.WriterAt, error) {
+    if h.readOnly == true {
+        return nil, os.ErrPermission
+    }
+
+    pflags := r.Pflags()
+    flag := os.O_RDWR
+    if pflags.Creat == true {
+        flag |= os.O_CREATE
+    }
+    if pflags.Trunc == true {
+        flag |= os.O_TRUNC
+    }
+    if pflags.Excl == true {
+        flag |= os.O_EXCL
+    }
+
+    /* The file outlives the request, so it is not bound to its context */
+    file, err := h.fs.OpenFile(h.context(context.Background()), r.Filepath, flag, 0644)
+    if err != nil {
+        return nil, err
+    }
+
+    return &writerAt{ file: file, append: pflags.Append }, nil
+}
+
+func (h *handlers) Filecmd(r *xsftp.Request) error {
+    if h.readOnly == true {
+        return os.ErrPermission
+    }
+
+    ctx := h.context(r.Context())
+    switch r.Method {
+    case "Setstat":
+        return nil
+    case "Rename":
+        return h.fs.Rename(ctx, r.Filepath, r.Target)
+    case "Mkdir":
+        return h.fs.Mkdir(ctx, r.Filepath, 0755)
+    case "Remove", "Rmdir":
+        info, err := h.fs.Stat(ctx, r.Filepath)
+        if err != nil {
+            return err
+        }
+        if info.IsDir() != (r.Method == "Rmdir") {
+            return xsftp.ErrSSHFxFailure
+        }
+        return h.fs.RemoveAll(ctx, r.Filepath)
+    }
+
+    return xsftp.ErrSSHFxOpUnsupported
+}
+
+func (h *handlers) Filelist(r *xsftp.Request) (xsftp.ListerAt, error) {
+    switch r.Method {
+    case "List":
+        dir, err := h.fs.OpenFile(h.context(r.Context()), r.Filepath, os.O_RDONLY, 0)
+        if err != nil {
+            return nil, err
+        }
+        defer dir.Close()
+
+        infos, err := dir.Readdir(-1)
+        if err != nil {
+            return nil, err
+        }
+        return listerAt(infos), nil
+    case "Stat":
+        info, err := h.fs.Stat(h.context(r.Context()), r.Filepath)
+        if err != nil {
+            return nil, err
+        }
+        return listerAt{ info }, nil
+    }
+
+    return nil, xsftp.ErrSSHFxOpUnsupported
+}
+
+/*
+ * fs.FS name of an SFTP path, e.g. "dir/file". The root is "."
+ */
+func fsName(name string) string {
+    if name = path.Clean("/" + name); name == "/" {
+        return "."
+    }
+
+    return name[1:]
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(output []os.FileInfo, offset int64) (int, error) {
+    if offset >= int64(len(l)) {
+        return 0, io.EOF
+    }
+
+    n := copy(output, l[offset:])
+    if n < len(output) {
+        return n, io.EOF
+    }
+    return n, nil
+}
+
+/*
+ * Requests of a handle may be processed concurrently, so the seek and the write are
+ *  made under a lock
+ */
+type writerAt struct {
+    lock        sync.Mutex
+    file        xwebdav.File
+    append      bool
+}
+
+func (w *writerAt) WriteAt(p []byte, offset int64) (int, error) {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    whence := io.SeekStart
+    if w.append == true {
+        offset, whence = 0, io.SeekEnd
+    }
+    if _, err := w.file.Seek(offset, whence); err != nil {
+        return 0, err
+    }
+
+    return w.file.Write(p)
+}
+
+func (w *writerAt) Close() error {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    return w.file.Close()
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package sftp
+
+import (
+    "io"
+    "os"
+    "strings"
+    "testing"
+    "path/filepath"
+
+    "github.com/AlexRuzin/govfs"
+    xsftp "github.com/pkg/sftp"
+)
+
+/*
+ * Both ends of an in-memory SFTP session
+ */
+type pipe struct {
+    io.Reader
+    io.WriteCloser
+}
+
+func newClient(t *testing.T, readOnly bool) (*govfs.FSHeader, *xsftp.Client) {
+    return newSessionClient(t, readOnly, "")
+}
+
+func newSessionClient(t *testing.T, readOnly bool, principal string) (*govfs.FSHeader, *xsftp.Client) {
+    header, err := govfs.CreateDatabase(filepath.Join(t.TempDir(), "test_sftp"), govfs.FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        t.Fatal("Failed to create database")
+    }
+    header.StartIOController()
+    t.Cleanup(func () { header.Close() })
+
+    serverRead, clientWrite := io.Pipe()
+    clientRead, serverWrite := io.Pipe()
+    server := xsftp.NewRequestServer(pipe{ serverRead, serverWrite }, NewSessionHandlers(header, readOnly, principal))
+    go func () {
+        server.Serve()
+        server.Close()
+    }()
+
+    client, err := xsftp.NewClientPipe(clientRead, clientWrite)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func () { client.Close() })
+
+    return header, client
+}
+
+func put(client *xsftp.Client, name string, data string) error {
+    file, err := client.Create(name)
+    if err != nil {
+        return err
+    }
+    if _, err := file.Write([]byte(data)); err != nil {
+        return err
+    }
+
+    return file.Close()
+}
+
+func get(client *xsftp.Client, name string) (string, error) {
+    file, err := client.Open(name)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+    data, err := io.ReadAll(file)
+
+    return string(data), err
+}
+
+func TestSFTP(t *testing.T) {
+    header, client := newClient(t, false)
+
+    if err := client.Mkdir("/docs"); err != nil {
+        t.Fatal("TEST1: Mkdir failed: " + err.Error())
+    }
+    if err := put(client, "/docs/a.txt", "hello"); err != nil {
+        t.Fatal("TEST2: Upload failed: " + err.Error())
+    }
+    if data, err := header.Read("/docs/a.txt"); err != nil || string(data) != "hello" {
+        t.Fatal("TEST3: Upload was not stored")
+    }
+    if data, err := get(client, "/docs/a.txt"); err != nil || data != "hello" {
+        t.Fatal("TEST4: Download failed")
+    }
+
+    infos, err := client.ReadDir("/docs")
+    if err != nil || len(infos) != 1 || infos[0].Name() != "a.txt" || infos[0].Size() != 5 {
+        t.Fatal("TEST5: Unexpected directory listing")
+    }
+    if info, err := client.Stat("/docs"); err != nil || !info.IsDir() {
+        t.Fatal("TEST6: Stat of a directory failed")
+    }
+
+    if err := client.Rename("/docs/a.txt", "/docs/b.txt"); err != nil {
+        t.Fatal("TEST7: Rename failed: " + err.Error())
+    }
+    if header.Check("/docs/a.txt") == true || header.Check("/docs/b.txt") == false {
+        t.Fatal("TEST8: Rename was not applied")
+    }
+    if _, err := get(client, "/missing"); !os.IsNotExist(err) {
+        t.Fatal("TEST9: Download of a missing file did not fail with ErrNotExist")
+    }
+    if err := client.Remove("/docs/b.txt"); err != nil || header.Check("/docs/b.txt") == true {
+        t.Fatal("TEST10: Remove failed")
+    }
+    if err := client.RemoveDirectory("/docs"); err != nil {
+        t.Fatal("TEST11: Rmdir failed")
+    }
+    if err := client.Symlink("/a", "/b"); err == nil {
+        t.Fatal("TEST12: Symlink succeeded")
+    }
+}
+
+func TestSFTPReadOnly(t *testing.T) {
+    header, client := newClient(t, true)
+    header.Create("/a.txt")
+    header.Write("/a.txt", []byte("read only"))
+
+    if data, err := get(client, "/a.txt"); err != nil || data != "read only" {
+        t.Fatal("TEST1: Download failed")
+    }
+    if err := put(client, "/b.txt", "data"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+        t.Fatal("TEST2: Upload to a read-only server succeeded")
+    }
+    if err := client.Remove("/a.txt"); err == nil || header.Check("/a.txt") == false {
+        t.Fatal("TEST3: Remove from a read-only server succeeded")
+    }
+}
+
+func TestSFTPSession(t *testing.T) {
+    header, client := newSessionClient(t, false, "alice")
+    header.Create("/private.txt")
+    header.Write("/private.txt", []byte("private"))
+    header.SetACL("/private.txt", []govfs.ACLEntry{ { Principal: "bob", Allow: govfs.ACCESS_READ } })
+
+    /* Requests are made as the principal of the handlers */
+    if err := put(client, "/a.txt", "hello"); err != nil {
+        t.Fatal("TEST1: Upload failed: " + err.Error())
+    }
+    if owner, _ := header.Owner("/a.txt"); owner != "alice" {
+        t.Fatal("TEST2: Upload was not owned by the principal")
+    }
+    if _, err := get(client, "/private.txt"); err == nil {
+        t.Fatal("TEST3: Download denied by the ACL succeeded")
+    }
+    if err := client.Remove("/private.txt"); err == nil || header.Check("/private.txt") == false {
+        t.Fatal("TEST4: Remove denied by the ACL succeeded")
+    }
+}
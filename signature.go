@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Stream signature. The header of every raw fs stream records DBConfig.Signature,
+ *  FS_SIGNATURE by default, and a load fails with ErrSignature unless it matches.
+ *
+ * The signature alone does not hide what the stream is: the gob encoding of an
+ *  unencrypted stream names its types and fields. With DBConfig.SignatureKey the whole
+ *  stream is masked with a key stream derived from it, after FLAG_COMPRESS and
+ *  FLAG_ENCRYPT, and prefixed with a random nonce and a keyed tag of the nonce and the
+ *  signature. Without the key, the stream is indistinguishable from random data; with
+ *  it, IsDatabase() recognizes it from the tag alone. RecordStorage is not masked.
+ */
+
+import (
+    "io"
+    "bytes"
+    "crypto/aes"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/cipher"
+    "crypto/sha256"
+)
+
+const (
+    SIGNATURE_MAX_LENGTH      int       = 64
+    SIGNATURE_NONCE_LENGTH    int       = 16
+    SIGNATURE_TAG_LENGTH      int       = 16
+)
+
+/*
+ * Returns the signature configured in `c`, or FS_SIGNATURE
+ */
+func (c *DBConfig) signature() string {
+    if c.Signature == "" {
+        return FS_SIGNATURE
+    }
+
+    return c.Signature
+}
+
+/*
+ * Returns the tag of a masked stream with `nonce`
+ */
+func (c *DBConfig) signatureTag(nonce []byte) []byte {
+    mac := hmac.New(sha256.New, c.SignatureKey)
+    mac.Write(nonce)
+    mac.Write([]byte(c.signature()))
+
+    return mac.Sum(nil)[:SIGNATURE_TAG_LENGTH]
+}
+
+/*
+ * Returns the key stream which masks the stream after `nonce`
+ */
+func (c *DBConfig) signatureStream(nonce []byte) (cipher.Stream, error) {
+    mac := hmac.New(sha256.New, c.SignatureKey)
+    mac.Write([]byte("govfs stream mask"))
+    key := mac.Sum(nil)
+    defer ZeroKey(key)
+
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+
+    return cipher.NewCTR(block, nonce), nil
+}
+
+/*
+ * Masks a raw fs stream if DBConfig.SignatureKey is set
+ */
+func (c *DBConfig) maskStream(stream []byte) ([]byte, error) {
+    if c.SignatureKey == nil {
+        return stream, nil
+    }
+
+    output := make([]byte, SIGNATURE_NONCE_LENGTH + SIGNATURE_TAG_LENGTH + len(stream))
+    nonce := output[:SIGNATURE_NONCE_LENGTH]
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return nil, err
+    }
+    copy(output[SIGNATURE_NONCE_LENGTH:], c.signatureTag(nonce))
+
+    mask, err := c.signatureStream(nonce)
+    if err != nil {
+        return nil, err
+    }
+    mask.XORKeyStream(output[SIGNATURE_NONCE_LENGTH + SIGNATURE_TAG_LENGTH:], stream)
+
+    return output, nil
+}
+
+/*
+ * Reverses maskStream(), in place. Fails with ErrSignature if neither the tag nor a
+ *  volume matches
+ */
+func (c *DBConfig) unmaskStream(raw []byte) ([]byte, error) {
+    if c.SignatureKey == nil {
+        return raw, nil
+    }
+    if c.checkSignatureTag(raw) == false {
+        /* Either volume of a DBConfig.VolumeSize file, see hidden.go */
+        return c.openVolume(raw)
+    }
+
+    nonce := raw[:SIGNATURE_NONCE_LENGTH]
+    stream := raw[SIGNATURE_NONCE_LENGTH + SIGNATURE_TAG_LENGTH:]
+    mask, err := c.signatureStream(nonce)
+    if err != nil {
+        return nil, err
+    }
+    mask.XORKeyStream(stream, stream)
+
+    return stream, nil
+}
+
+func (c *DBConfig) checkSignatureTag(raw []byte) bool {
+    if len(raw) < SIGNATURE_NONCE_LENGTH + SIGNATURE_TAG_LENGTH {
+        return false
+    }
+
+    nonce := raw[:SIGNATURE_NONCE_LENGTH]
+    tag := raw[SIGNATURE_NONCE_LENGTH:SIGNATURE_NONCE_LENGTH + SIGNATURE_TAG_LENGTH]
+
+    return hmac.Equal(tag, c.signatureTag(nonce))
+}
+
+/*
+ * Reports whether `name` holds a database with the signature of `config`. A stream
+ *  masked with DBConfig.SignatureKey is recognized by its tag, without decrypting it;
+ *  otherwise the header is read, which requires the key if `flags` has FLAG_ENCRYPT
+ */
+func IsDatabase(name string, flags FlagVal, config *DBConfig) (bool, error) {
+    cfg, release, err := probeConfig(config, config == nil || config.SignatureKey == nil)
+    if err != nil {
+        return false, err
+    }
+    defer release()
+
+    if cfg.SignatureKey != nil {
+        storage, stored_name := cfg.storage(name)
+        raw, err := storage.Read(stored_name)
+        if err != nil {
+            return false, err
+        }
+        _, _, _, _, volume := cfg.findVolume(raw)
+        return cfg.checkSignatureTag(raw) || volume, nil
+    }
+
+    stream, scoped, err := readFsStream(name, flags, &cfg)
+    if err != nil {
+        return false, err
+    }
+    if _, err := tableHeader(stream, scoped, &cfg); err != nil {
+        return false, nil /* Not a gob stream, or another signature */
+    }
+
+    return true, nil
+}
+
+/*
+ * Returns a copy of `config` for reading a stream without loading it, and a function
+ *  which zeroes the key if it was supplied by the KeyProvider. The KeyProvider is only
+ *  asked if `needKey`
+ */
+func probeConfig(config *DBConfig, needKey bool) (DBConfig, func (), error) {
+    var cfg DBConfig
+    if config != nil {
+        cfg = *config
+    }
+    if cfg.Cipher == nil {
+        cfg.Cipher = CipherRC4
+    }
+    if cfg.Codec == nil {
+        cfg.Codec = CodecGzip
+    }
+    if cfg.Key == nil && cfg.KeyProvider != nil && needKey == true {
+        key, err := cfg.KeyProvider.Key()
+        if err != nil {
+            return cfg, nil, err
+        }
+        cfg.Key = key
+        return cfg, func () { ZeroKey(key) }, nil
+    }
+
+    return cfg, func () {}, nil
+}
+
+/*
+ * Reads, decrypts and decompresses the raw fs stream `name`, and decodes only its header
+ */
+func readStreamHeader(name string, flags FlagVal, config *DBConfig) (*rawStreamHeader, error) {
+    stream, scoped, err := readFsStream(name, flags, config)
+    if err != nil {
+        return nil, err
+    }
+    return tableHeader(stream, scoped, config)
+}
+
+/*
+ * Decodes the header of the serialized fs table returned by readFsStream()
+ */
+func tableHeader(stream []byte, scoped bool, config *DBConfig) (*rawStreamHeader, error) {
+    catalog := bytes.NewBuffer(stream)
+    if scoped == true {
+        var err error
+        if catalog, _, _, err = decodeScoped(stream, config); err != nil {
+            return nil, err
+        }
+    }
+
+    return decodeStreamHeader(catalog, config)
+}
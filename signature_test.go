@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+)
+
+func TestSignature(t *testing.T) {
+    debugOut("[+] Running Stream Signature Test...")
+
+    var filename = gen_raw_filename("test_signature")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ Signature: "custom_signature" }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/file")
+    header.Write("/file", []byte("signed contents"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+
+    raw, _ := os.ReadFile(filename)
+    if !bytes.Contains(raw, []byte("custom_signature")) || bytes.Contains(raw, []byte(FS_SIGNATURE)) {
+        drive_fail("TEST3: Configured signature was not recorded", t)
+    }
+    if _, err := CreateDatabase(filename, FLAG_DB_LOAD); !errors.Is(err, ErrSignature) {
+        drive_fail("TEST4: Database loaded with the default signature", t)
+    }
+    if ok, err := IsDatabase(filename, 0, nil); ok != false || err != nil {
+        drive_fail("TEST5: Detected with the default signature", t)
+    }
+    if ok, err := IsDatabase(filename, 0, config); ok != true || err != nil {
+        drive_fail("TEST6: Not detected with the configured signature", t)
+    }
+
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, config)
+    if loaded == nil || err != nil {
+        drive_fail("TEST7: Failed to load with the configured signature", t)
+    }
+    if data, _ := loaded.Read("/file"); string(data) != "signed contents" {
+        drive_fail("TEST8: Data mismatch after load", t)
+    }
+
+    long := &DBConfig{ Signature: strings.Repeat("x", SIGNATURE_MAX_LENGTH + 1) }
+    if _, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, long); err == nil {
+        drive_fail("TEST9: Accepted a signature that is too long", t)
+    }
+}
+
+func TestSignatureKey(t *testing.T) {
+    debugOut("[+] Running Masked Stream Test...")
+
+    var filename = gen_raw_filename("test_signature_key")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ SignatureKey: []byte("signature key") }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/folder/file")
+    header.Write("/folder/file", []byte("masked contents"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+
+    /* Neither the signature, the gob types nor the contents are visible */
+    raw, _ := os.ReadFile(filename)
+    for _, s := range []string{ FS_SIGNATURE, "RawFile", "Signature", "masked contents", "/folder/file" } {
+        if bytes.Contains(raw, []byte(s)) {
+            drive_fail("TEST3: Masked stream contains " + s, t)
+        }
+    }
+
+    wrong := &DBConfig{ SignatureKey: []byte("wrong key") }
+    if _, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, wrong); !errors.Is(err, ErrSignature) {
+        drive_fail("TEST4: Database loaded with the wrong signature key", t)
+    }
+    if _, err := CreateDatabase(filename, FLAG_DB_LOAD); err == nil {
+        drive_fail("TEST5: Database loaded without the signature key", t)
+    }
+
+    if ok, err := IsDatabase(filename, 0, config); ok != true || err != nil {
+        drive_fail("TEST6: Not detected with the signature key", t)
+    }
+    if ok, _ := IsDatabase(filename, 0, wrong); ok != false {
+        drive_fail("TEST7: Detected with the wrong signature key", t)
+    }
+    if ok, _ := IsDatabase(filename, 0, nil); ok != false {
+        drive_fail("TEST8: Detected without the signature key", t)
+    }
+
+    /* Each commit uses a new nonce */
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, config)
+    if loaded == nil || err != nil {
+        drive_fail("TEST9: Failed to load with the signature key", t)
+    }
+    if data, _ := loaded.Read("/folder/file"); string(data) != "masked contents" {
+        drive_fail("TEST10: Data mismatch after load", t)
+    }
+    loaded.StartIOController()
+    if err := loaded.UnmountDB(0); err != nil {
+        drive_fail("TEST11: Failed to commit database", t)
+    }
+    if again, _ := os.ReadFile(filename); bytes.Equal(again[:SIGNATURE_NONCE_LENGTH], raw[:SIGNATURE_NONCE_LENGTH]) {
+        drive_fail("TEST12: Nonce was reused", t)
+    }
+}
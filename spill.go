@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Disk spill for large files. When DBConfig.SpillSize is set, the data of every file
+ *  of at least that many bytes is kept in a temporary file under DBConfig.SpillDir
+ *  instead of on the heap. Spill files are encrypted with AES-CTR under an ephemeral
+ *  key which never leaves the process, so a spill file left behind by a crash cannot
+ *  be read. CTR mode is seekable, so appends and Reader reads only touch the bytes
+ *  they need.
+ */
+
+import (
+    "os"
+    "io"
+    "hash"
+    "time"
+    "crypto/aes"
+    "crypto/rand"
+    "crypto/cipher"
+    "encoding/hex"
+)
+
+const SPILL_BLOCK_SIZE        int       = 64 * 1024
+const SPILL_FILE_PATTERN      string    = "govfs-spill-*"
+
+type spillFile struct {
+    file        *os.File
+    iv          []byte
+    sum         hash.Hash /* Checksum of the plaintext written so far, see spillSum() */
+}
+
+func (f *FSHeader) initSpill() error {
+    key := make([]byte, 32)
+    defer ZeroKey(key)
+
+    if _, err := io.ReadFull(rand.Reader, key); err != nil {
+        return err
+    }
+
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return err
+    }
+    f.spill_block = block
+
+    /* Move anything large that was loaded from the raw fs stream to the disk */
+    for _, v := range f.files() {
+        if f.spills(len(v.data)) == false {
+            continue
+        }
+
+        if err := f.spillWrite(v, v.data); err != nil {
+            return err
+        }
+        wipeBuffer(v.data, false)
+        v.data = nil
+    }
+
+    return nil
+}
+
+/*
+ * Returns true if a file of `size` bytes is to be kept on the disk
+ */
+func (f *FSHeader) spills(size int) bool {
+    return f.spill_block != nil && f.config.SpillSize > 0 && size >= f.config.SpillSize
+}
+
+/*
+ * Replaces the contents of a file with `data`, which is written to its spill file. The
+ *  caller holds file.lock.
+ */
+func (f *FSHeader) spillWrite(file *govfsFile, data []byte) error {
+    if file.spill == nil {
+        tmp, err := os.CreateTemp(f.config.SpillDir, SPILL_FILE_PATTERN)
+        if err != nil {
+            return err
+        }
+        file.spill = &spillFile{ file: tmp }
+    } else if err := file.spill.file.Truncate(0); err != nil {
+        return err
+    }
+
+    /* A fresh IV for every rewrite, the key stream must never be reused for other data */
+    sf := file.spill
+    sf.iv = make([]byte, aes.BlockSize)
+    if _, err := io.ReadFull(rand.Reader, sf.iv); err != nil {
+        return err
+    }
+    sf.sum = f.config.Checksum.New()
+
+    if err := f.spillWriteAt(sf, data, 0); err != nil {
+        return err
+    }
+    file.setSum(spillSum(sf), f.config.Checksum)
+
+    return nil
+}
+
+/*
+ * Appends `data` to a spilled file without reading it back. The caller holds file.lock.
+ */
+func (f *FSHeader) spillAppend(file *govfsFile, data []byte) error {
+    if err := f.spillWriteAt(file.spill, data, int64(file.size)); err != nil {
+        return err
+    }
+
+    f.usage.resize(file.filename, len(data))
+    f.usage.own(fileOwner(file), len(data))
+
+    file.size += len(data)
+    file.setSum(spillSum(file.spill), file.sumAlgorithm())
+    file.modtime = time.Now().UnixNano()
+    file.contents.generation++
+    file.setLoaded()
+
+    return nil
+}
+
+func (f *FSHeader) spillWriteAt(sf *spillFile, data []byte, offset int64) error {
+    stream := f.spillStream(sf, offset)
+    block := make([]byte, SPILL_BLOCK_SIZE)
+    defer wipeBuffer(block, false)
+
+    for len(data) > 0 {
+        n := copy(block, data)
+        sf.sum.Write(data[:n])
+        stream.XORKeyStream(block[:n], block[:n])
+        if _, err := sf.file.WriteAt(block[:n], offset); err != nil {
+            return err
+        }
+
+        data = data[n:]
+        offset += int64(n)
+    }
+
+    return nil
+}
+
+/*
+ * Reads the plaintext of a spilled file at `offset` into `p`. Returns io.EOF once the
+ *  end of the file is reached. The caller holds file.lock.
+ */
+func (f *FSHeader) spillReadAt(file *govfsFile, p []byte, offset int64) (int, error) {
+    if offset >= int64(file.size) {
+        return 0, io.EOF
+    }
+    if remaining := int64(file.size) - offset; int64(len(p)) > remaining {
+        p = p[:remaining]
+    }
+
+    n, err := file.spill.file.ReadAt(p, offset)
+    f.spillStream(file.spill, offset).XORKeyStream(p[:n], p[:n])
+    if err != nil && err != io.EOF {
+        return n, err
+    }
+    if n < len(p) {
+        return n, retErrStr("spill: Spill file is truncated")
+    }
+
+    if offset + int64(n) >= int64(file.size) {
+        return n, io.EOF
+    }
+
+    return n, nil
+}
+
+/*
+ * Returns a copy of the plaintext of a spilled file, in `buf` if it is large enough.
+ *  The caller holds file.lock.
+ */
+func (f *FSHeader) spillRead(file *govfsFile, buf []byte) ([]byte, error) {
+    output := growBuffer(buf, file.size)
+    if _, err := f.spillReadAt(file, output, 0); err != nil && err != io.EOF {
+        return nil, err
+    }
+
+    return output, nil
+}
+
+/*
+ * Returns the CTR key stream of a spill file positioned at `offset`
+ */
+func (f *FSHeader) spillStream(sf *spillFile, offset int64) cipher.Stream {
+    iv := make([]byte, aes.BlockSize)
+    copy(iv, sf.iv)
+
+    /* Advance the big endian counter by the number of whole blocks */
+    carry := uint64(offset / int64(aes.BlockSize))
+    for i := len(iv) - 1; i >= 0 && carry > 0; i-- {
+        carry += uint64(iv[i])
+        iv[i] = byte(carry)
+        carry >>= 8
+    }
+
+    stream := cipher.NewCTR(f.spill_block, iv)
+    if skip := offset % int64(aes.BlockSize); skip > 0 {
+        discard := make([]byte, skip)
+        stream.XORKeyStream(discard, discard)
+    }
+
+    return stream
+}
+
+/*
+ * Equivalent to checksumOf() the plaintext, without holding all of it in memory
+ */
+func spillSum(sf *spillFile) string {
+    return hex.EncodeToString(sf.sum.Sum(nil))
+}
+
+/*
+ * Closes and removes the spill file of a file, if any. If `shred` is set, its contents
+ *  are overwritten first. The caller holds file.lock.
+ */
+func (f *FSHeader) removeSpill(file *govfsFile, shred bool) {
+    if file.spill == nil {
+        return
+    }
+
+    name := file.spill.file.Name()
+    file.spill.file.Close()
+    if shred == true {
+        overwriteFile(name)
+    }
+    os.Remove(name)
+    file.spill = nil
+}
+
+/*
+ * Removes every spill file, called once the header is closed
+ */
+func (f *FSHeader) removeSpills() {
+    if f.spill_block == nil {
+        return
+    }
+
+    for _, v := range f.files() {
+        v.lock.Lock()
+        f.removeSpill(v, false)
+        v.lock.Unlock()
+    }
+}
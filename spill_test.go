@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "io"
+    "bytes"
+    "testing"
+    "strconv"
+    "strings"
+    "crypto/aes"
+    "crypto/rand"
+    "path/filepath"
+)
+
+func spillFiles(t *testing.T, dir string) []string {
+    names, err := filepath.Glob(filepath.Join(dir, SPILL_FILE_PATTERN))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return names
+}
+
+func TestSpill(t *testing.T) {
+    debugOut("[+] Running Disk Spill Test...")
+
+    dir := t.TempDir()
+    raw := gen_raw_filename("spill")
+    defer os.Remove(raw)
+
+    config := &DBConfig{ SpillSize: 4096, SpillDir: dir }
+    header, err := CreateDatabaseConfig(raw, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    large := make([]byte, 100000)
+    io.ReadFull(rand.Reader, large)
+    header.Create("/large")
+    header.Write("/large", large)
+    header.Create("/small")
+    header.Write("/small", []byte("small"))
+
+    names := spillFiles(t, dir)
+    if len(names) != 1 || header.check("/large").data != nil {
+        drive_fail("TEST2: Large file was not spilled", t)
+    }
+    if contents, _ := os.ReadFile(names[0]); len(contents) != len(large) || bytes.Contains(contents, large[:64]) {
+        drive_fail("TEST3: Spill file is not encrypted", t)
+    }
+    if data, err := header.Read("/large"); err != nil || !bytes.Equal(data, large) {
+        drive_fail("TEST4: Failed to read a spilled file", t)
+    }
+
+    /* Appends go to the disk, the checksum must match a rewrite of the same data */
+    tail := []byte("appended on the disk")
+    if err := header.Append("/large", tail); err != nil {
+        drive_fail("TEST5: Failed to append to a spilled file", t)
+    }
+    large = append(large, tail...)
+    if header.check("/large").dataSum() != checksumOf(ChecksumSHA256, large) {
+        drive_fail("TEST6: Invalid checksum after appending", t)
+    }
+
+    /* The Reader streams at odd offsets and block sizes */
+    reader, err := header.NewReader("/large")
+    if err != nil {
+        drive_fail("TEST7: Failed to create Reader", t)
+    }
+    var output []byte
+    block := make([]byte, 4099)
+    for {
+        n, err := reader.Read(block)
+        output = append(output, block[:n]...)
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            drive_fail("TEST8: Reader failed", t)
+        }
+    }
+    if !bytes.Equal(output, large) {
+        drive_fail("TEST9: Reader returned invalid data", t)
+    }
+
+    /* Shrinking the file moves it back to the heap */
+    header.Write("/large", []byte("now small"))
+    if len(spillFiles(t, dir)) != 0 || header.check("/large").spill != nil {
+        drive_fail("TEST10: Spill file was not removed", t)
+    }
+
+    /* Spilled files survive a commit and are spilled again on load */
+    header.Write("/large", large)
+    header.Close()
+    if len(spillFiles(t, dir)) != 0 {
+        drive_fail("TEST11: Close did not remove the spill files", t)
+    }
+
+    header, _ = CreateDatabaseConfig(raw, FLAG_DB_CREATE, config)
+    header.StartIOController()
+    header.Create("/large")
+    header.Write("/large", large)
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST12: Failed to commit", t)
+    }
+    header.Close()
+
+    loaded, err := CreateDatabaseConfig(raw, FLAG_DB_LOAD, config)
+    if loaded == nil || err != nil {
+        drive_fail("TEST13: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    if len(spillFiles(t, dir)) != 1 {
+        drive_fail("TEST14: Loaded file was not spilled", t)
+    }
+    if data, err := loaded.Read("/large"); err != nil || !bytes.Equal(data, large) {
+        drive_fail("TEST15: Loaded spilled file is invalid", t)
+    }
+
+    if err := loaded.Shred("/large"); err != nil || len(spillFiles(t, dir)) != 0 {
+        drive_fail("TEST16: Shred did not remove the spill file", t)
+    }
+    loaded.Close()
+
+    debugOut("[+] Disk Spill Test PASS")
+}
+
+func TestSpillStream(t *testing.T) {
+    header, err := CreateDatabaseConfig("spillstream", FLAG_DB_CREATE, &DBConfig{ SpillSize: 1, SpillDir: t.TempDir() })
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    defer header.Close()
+
+    /* Every offset must decrypt the same key stream as a read from the start */
+    plain := make([]byte, 1000)
+    io.ReadFull(rand.Reader, plain)
+    file := &govfsFile{ filename: "/x" }
+    if err := header.spillWrite(file, plain); err != nil {
+        t.Fatal("TEST2: ", err)
+    }
+    file.size = len(plain)
+
+    /* Force the counter to carry across bytes */
+    copy(file.spill.iv[aes.BlockSize - 2:], []byte{ 0xff, 0xfe })
+    if err := header.spillWriteAt(file.spill, plain, 0); err != nil {
+        t.Fatal("TEST2: ", err)
+    }
+    defer header.removeSpill(file, false)
+
+    for _, offset := range []int{ 0, 1, 15, 16, 17, 255, 256, 999 } {
+        p := make([]byte, 40)
+        n, err := header.spillReadAt(file, p, int64(offset))
+        if err != nil && err != io.EOF {
+            t.Fatal("TEST3: ", err)
+        }
+        if !bytes.Equal(p[:n], plain[offset:offset + n]) {
+            t.Fatal("TEST4: Invalid data at offset ", offset)
+        }
+    }
+}
+
+func TestCommitSpillError(t *testing.T) {
+    var filename = gen_raw_filename("spill_commit")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ SpillSize: 1, SpillDir: t.TempDir() })
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    for i := 0; i < 64; i++ {
+        name := "/file" + strconv.Itoa(i)
+        header.Create(name)
+        header.Write(name, []byte(name))
+    }
+
+    /* A file which cannot be read fails the commit instead of hanging it */
+    header.check("/file7").spill.file.Close()
+    if err := header.UnmountDB(0); err == nil || strings.Contains(err.Error(), "/file7") == false {
+        t.Fatal("TEST2: Commit of an unreadable file did not fail: ", err)
+    }
+    if _, err := os.Stat(filename); os.IsNotExist(err) == false {
+        t.Fatal("TEST3: Failed commit wrote the raw fs stream")
+    }
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+/*
+ * Package sqlite keeps a govfs database in SQLite, one row per file, see
+ *  govfs.RecordStorage. Commits are transactions, so a crash never leaves a partial
+ *  commit behind, and only the files which changed are written. The catalog may be
+ *  queried with SQL for reporting, e.g.
+ *
+ *      SELECT name, size, stored_size, modified FROM files WHERE directory = 0 ORDER BY size DESC
+ *
+ * Schema:
+ *
+ *  files   name TEXT PRIMARY KEY, directory INTEGER, size INTEGER, stored_size INTEGER,
+ *          modified TEXT (RFC 3339, UTC), checksum TEXT, flags INTEGER, policy TEXT,
+ *          compression TEXT, codec TEXT, algorithm TEXT (the checksum's, '' for legacy md5),
+ *          xattrs TEXT (JSON object of the extended attributes, '' if none)
+ *  data    name TEXT PRIMARY KEY REFERENCES files, data BLOB
+ */
+package sqlite
+
+import (
+    "time"
+    "strings"
+    "io/fs"
+    "database/sql"
+    "encoding/json"
+
+    _ "github.com/mattn/go-sqlite3"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+const SQLITE_SCHEMA string = `
+CREATE TABLE IF NOT EXISTS files (
+    name        TEXT PRIMARY KEY,
+    directory   INTEGER NOT NULL,
+    size        INTEGER NOT NULL,
+    stored_size INTEGER NOT NULL,
+    modified    TEXT,
+    checksum    TEXT NOT NULL,
+    flags       INTEGER NOT NULL,
+    policy      TEXT NOT NULL,
+    compression TEXT NOT NULL,
+    codec       TEXT NOT NULL,
+    algorithm   TEXT NOT NULL DEFAULT '',
+    xattrs      TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS data (
+    name        TEXT PRIMARY KEY REFERENCES files (name) ON DELETE CASCADE,
+    data        BLOB NOT NULL
+);`
+
+type Storage struct {
+    db          *sql.DB
+}
+
+/*
+ * Opens or creates an SQLite database file, in WAL mode
+ */
+func Open(path string) (*Storage, error) {
+    var separator = "?"
+    if strings.Contains(path, "?") {
+        separator = "&"
+    }
+
+    db, err := sql.Open("sqlite3", path + separator + "_journal_mode=WAL&_foreign_keys=on&_busy_timeout=5000")
+    if err != nil {
+        return nil, err
+    }
+
+    storage, err := New(db)
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    return storage, nil
+}
+
+/*
+ * Uses an open database, e.g. one shared with the application, and creates the tables
+ *  if they do not exist
+ */
+func New(db *sql.DB) (*Storage, error) {
+    if _, err := db.Exec(SQLITE_SCHEMA); err != nil {
+        return nil, err
+    }
+
+    /* Databases created by earlier versions lack the columns added since */
+    for _, column := range []string{ "algorithm", "xattrs" } {
+        var columns int
+        err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('files') WHERE name = ?`, column).Scan(&columns)
+        if err != nil {
+            return nil, err
+        }
+        if columns == 0 {
+            if _, err := db.Exec(`ALTER TABLE files ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    return &Storage{ db: db }, nil
+}
+
+func (s *Storage) Close() error {
+    return s.db.Close()
+}
+
+/*
+ * The underlying database, for reporting queries
+ */
+func (s *Storage) DB() *sql.DB {
+    return s.db
+}
+
+func (s *Storage) Catalog() ([]govfs.RawFile, error) {
+    rows, err := s.db.Query(`SELECT name, size, stored_size, modified, checksum, flags, policy, compression, codec,
+        algorithm, xattrs FROM files`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var output []govfs.RawFile
+    for rows.Next() {
+        var raw govfs.RawFile
+        var modified sql.NullString
+        var xattrs string
+        err := rows.Scan(&raw.Name, &raw.UnzippedLen, &raw.StoredLen, &modified, &raw.RawSum, &raw.Flags,
+            &raw.Policy, &raw.Compression, &raw.Codec, &raw.Checksum, &xattrs)
+        if err != nil {
+            return nil, err
+        }
+        if xattrs != "" {
+            if err := json.Unmarshal([]byte(xattrs), &raw.Xattrs); err != nil {
+                return nil, err
+            }
+        }
+
+        if modified.Valid {
+            if raw.ModTime, err = time.Parse(time.RFC3339Nano, modified.String); err != nil {
+                return nil, err
+            }
+        }
+        output = append(output, raw)
+    }
+
+    return output, rows.Err()
+}
+
+func (s *Storage) ReadData(name string) ([]byte, error) {
+    var output []byte
+    err := s.db.QueryRow(`SELECT data FROM data WHERE name = ?`, name).Scan(&output)
+    if err == sql.ErrNoRows {
+        return nil, fs.ErrNotExist
+    }
+
+    return output, err
+}
+
+func (s *Storage) Commit(put []govfs.Record, remove []string) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback() /* No-op once committed */
+
+    for _, name := range remove {
+        if _, err := tx.Exec(`DELETE FROM files WHERE name = ?`, name); err != nil {
+            return err
+        }
+    }
+
+    for _, record := range put {
+        raw := record.Header
+
+        var modified sql.NullString
+        if !raw.ModTime.IsZero() {
+            modified = sql.NullString{ String: raw.ModTime.UTC().Format(time.RFC3339Nano), Valid: true }
+        }
+        directory := (raw.Flags & govfs.FLAG_DIRECTORY) > 0
+
+        var xattrs string
+        if len(raw.Xattrs) > 0 {
+            encoded, err := json.Marshal(raw.Xattrs)
+            if err != nil {
+                return err
+            }
+            xattrs = string(encoded)
+        }
+
+        _, err := tx.Exec(`INSERT INTO files (name, directory, size, stored_size, modified, checksum, flags, policy, compression, codec,
+                algorithm, xattrs)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT (name) DO UPDATE SET directory = excluded.directory, size = excluded.size,
+                stored_size = excluded.stored_size, modified = excluded.modified, checksum = excluded.checksum,
+                flags = excluded.flags, policy = excluded.policy, compression = excluded.compression, codec = excluded.codec,
+                algorithm = excluded.algorithm, xattrs = excluded.xattrs`,
+            raw.Name, directory, raw.UnzippedLen, raw.StoredLen, modified, raw.RawSum, raw.Flags, raw.Policy,
+            raw.Compression, raw.Codec, raw.Checksum, xattrs)
+        if err != nil {
+            return err
+        }
+
+        if len(record.Data) == 0 {
+            _, err = tx.Exec(`DELETE FROM data WHERE name = ?`, raw.Name)
+        } else {
+            _, err = tx.Exec(`INSERT INTO data (name, data) VALUES (?, ?)
+                ON CONFLICT (name) DO UPDATE SET data = excluded.data`, raw.Name, record.Data)
+        }
+        if err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit()
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Operation statistics. Every event which is passed to DBConfig.Logger, and every
+ *  Read(), is also counted per operation. Latency percentiles are computed over the
+ *  last STATS_SAMPLES operations of each kind.
+ */
+
+import (
+    "sort"
+    "sync"
+    "time"
+)
+
+const STATS_SAMPLES           int       = 1024
+
+/*
+ * Statistics of one kind of operation, e.g. LOG_WRITE
+ */
+type OpStats struct {
+    Count       uint64
+    Errors      uint64
+    Bytes       uint64 /* LogEvent.Size of every operation, successful or not */
+    P50         time.Duration
+    P90         time.Duration
+    P99         time.Duration
+    Max         time.Duration /* Of all operations */
+}
+
+type FSStats struct {
+    Since       time.Time /* When the database was created or loaded, or ResetStats() */
+    Ops         map[string]OpStats /* Keyed by LogEvent.Op */
+}
+
+type statsTable struct {
+    lock        sync.Mutex
+    since       time.Time
+    ops         map[string]*opCounter
+}
+
+type opCounter struct {
+    count       uint64
+    errors      uint64
+    bytes       uint64
+    max         time.Duration
+    samples     []time.Duration /* Ring of the last STATS_SAMPLES latencies */
+    next        int
+}
+
+func (f *FSHeader) Stats() FSStats {
+    f.op_stats.lock.Lock()
+    defer f.op_stats.lock.Unlock()
+
+    output := FSStats{
+        Since: f.op_stats.since,
+        Ops: make(map[string]OpStats, len(f.op_stats.ops)),
+    }
+    for op, c := range f.op_stats.ops {
+        latencies := append([]time.Duration(nil), c.samples...)
+        sort.Slice(latencies, func (i, j int) bool { return latencies[i] < latencies[j] })
+
+        output.Ops[op] = OpStats{
+            Count: c.count,
+            Errors: c.errors,
+            Bytes: c.bytes,
+            P50: percentile(latencies, 50),
+            P90: percentile(latencies, 90),
+            P99: percentile(latencies, 99),
+            Max: c.max,
+        }
+    }
+
+    return output
+}
+
+/*
+ * Clears all statistics
+ */
+func (f *FSHeader) ResetStats() {
+    f.op_stats.lock.Lock()
+    defer f.op_stats.lock.Unlock()
+
+    f.op_stats.since = time.Now()
+    f.op_stats.ops = nil
+}
+
+func (t *statsTable) add(op string, size int, latency time.Duration, err error) {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+
+    if t.ops == nil {
+        t.ops = make(map[string]*opCounter)
+    }
+    c := t.ops[op]
+    if c == nil {
+        c = &opCounter{}
+        t.ops[op] = c
+    }
+
+    c.count++
+    c.bytes += uint64(size)
+    if err != nil {
+        c.errors++
+    }
+    if latency > c.max {
+        c.max = latency
+    }
+
+    if len(c.samples) < STATS_SAMPLES {
+        c.samples = append(c.samples, latency)
+    } else {
+        c.samples[c.next] = latency
+        c.next = (c.next + 1) % STATS_SAMPLES
+    }
+}
+
+/*
+ * Returns the p-th percentile of sorted latencies, by the nearest rank
+ */
+func percentile(latencies []time.Duration, p int) time.Duration {
+    if len(latencies) == 0 {
+        return 0
+    }
+
+    rank := (p * len(latencies) + 99) / 100
+    if rank < 1 {
+        rank = 1
+    }
+
+    return latencies[rank - 1]
+}
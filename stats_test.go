@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "time"
+    "testing"
+)
+
+func TestStats(t *testing.T) {
+    debugOut("[+] Running Statistics Test...")
+
+    header, err := CreateDatabaseConfig("stats", FLAG_DB_CREATE, nil)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/file")
+    for i := 0; i < 10; i++ {
+        header.Write("/file", []byte("0123456789"))
+    }
+    header.Read("/file")
+    header.Read("/missing")
+
+    stats := header.Stats()
+    if stats.Since.IsZero() || len(stats.Ops) != 3 {
+        drive_fail("TEST2: Unexpected operations", t)
+    }
+    if write := stats.Ops[LOG_WRITE]; write.Count != 10 || write.Bytes != 100 || write.Errors != 0 ||
+        write.P50 <= 0 || write.P50 > write.P99 || write.P99 > write.Max {
+        drive_fail("TEST3: Invalid write statistics", t)
+    }
+    if read := stats.Ops[LOG_READ]; read.Count != 2 || read.Errors != 1 || read.Bytes != 10 {
+        drive_fail("TEST4: Invalid read statistics", t)
+    }
+
+    header.ResetStats()
+    if stats := header.Stats(); len(stats.Ops) != 0 || !stats.Since.After(time.Time{}) {
+        drive_fail("TEST5: Statistics were not reset", t)
+    }
+
+    debugOut("[+] Statistics Test PASS")
+}
+
+func TestPercentile(t *testing.T) {
+    var latencies []time.Duration
+    for i := 1; i <= 100; i++ {
+        latencies = append(latencies, time.Duration(i))
+    }
+
+    if percentile(latencies, 50) != 50 || percentile(latencies, 99) != 99 || percentile(latencies[:1], 90) != 1 ||
+        percentile(nil, 50) != 0 {
+        t.Fatal("TEST1: Invalid percentiles")
+    }
+
+    /* The sample ring keeps the latest latencies */
+    var table statsTable
+    for i := 0; i < STATS_SAMPLES + 10; i++ {
+        table.add(LOG_WRITE, 1, time.Duration(i), nil)
+    }
+    if c := table.ops[LOG_WRITE]; len(c.samples) != STATS_SAMPLES || c.samples[9] != time.Duration(STATS_SAMPLES + 9) ||
+        c.count != uint64(STATS_SAMPLES + 10) {
+        t.Fatal("TEST2: Invalid sample ring")
+    }
+}
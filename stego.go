@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "io"
+    "io/fs"
+    "bytes"
+    "image"
+    "image/png"
+    "image/color"
+    "crypto/rand"
+    "encoding/binary"
+)
+
+const STEGO_PREFIX            string    = "stego:"
+const STEGO_MAGIC             string    = "gvfs"
+const STEGO_HEADER_SIZE       int       = 8 /* STEGO_MAGIC, then the big endian stream length */
+const STEGO_JPEG_MARKER       byte      = 0xef /* APP15 */
+const STEGO_JPEG_SEGMENT      int       = 65533 - len(STEGO_MAGIC) /* Maximum segment length, less the length field and the identifier */
+
+var png_signature  = []byte("\x89PNG\r\n\x1a\n")
+var jpeg_signature = []byte{ 0xff, 0xd8 }
+
+/*
+ * Returns a database name which keeps the raw fs stream inside the picture at `image`,
+ *  which must already exist. Every commit rewrites the picture with the new stream
+ *  embedded, see EmbedStream()
+ */
+func StegoName(image string) string {
+    return STEGO_PREFIX + image
+}
+
+/*
+ * Embeds a stream in a PNG or JPEG carrier, and returns the new picture, which looks
+ *  the same as the carrier. Any stream embedded previously is replaced. Use an
+ *  encrypted stream (FLAG_ENCRYPT), the embedding itself does not hide the contents
+ *  from someone who knows where to look.
+ *
+ * PNG:  The stream is stored in the least significant bit of each red, green and blue
+ *       value, so the carrier must have at least (8 + len(stream)) * 8 / 3 pixels. The
+ *       remaining bits are randomised. The output is always an 8-bit RGBA PNG
+ * JPEG: Lossy encoding would destroy the pixel bits, so the stream is stored in APP15
+ *       segments after the carrier's own APPn segments instead. There is no size
+ *       limit, but the file grows by the size of the stream
+ */
+func EmbedStream(carrier []byte, stream []byte) ([]byte, error) {
+    return embedPayload(carrier, stegoPayload(stream))
+}
+
+/*
+ * Embeds a header and stream built by stegoPayload(). A nil payload removes any
+ *  embedded stream
+ */
+func embedPayload(carrier []byte, payload []byte) ([]byte, error) {
+    switch {
+    case bytes.HasPrefix(carrier, png_signature):
+        return embedPNG(carrier, payload)
+    case bytes.HasPrefix(carrier, jpeg_signature):
+        return embedJPEG(carrier, payload)
+    }
+
+    return nil, retErrStr("stego: The carrier is not a PNG or JPEG image")
+}
+
+/*
+ * Returns the stream embedded by EmbedStream(), or fs.ErrNotExist if there is none
+ */
+func ExtractStream(picture []byte) ([]byte, error) {
+    var payload []byte
+    switch {
+    case bytes.HasPrefix(picture, png_signature):
+        img, err := png.Decode(bytes.NewReader(picture))
+        if err != nil {
+            return nil, err
+        }
+        payload = readLSB(toNRGBA(img).Pix)
+    case bytes.HasPrefix(picture, jpeg_signature):
+        segments, _, err := jpegSegments(picture)
+        if err != nil {
+            return nil, err
+        }
+        payload = segments
+    default:
+        return nil, retErrStr("stego: The picture is not a PNG or JPEG image")
+    }
+
+    if len(payload) < STEGO_HEADER_SIZE || string(payload[:len(STEGO_MAGIC)]) != STEGO_MAGIC {
+        return nil, fs.ErrNotExist
+    }
+    length := binary.BigEndian.Uint32(payload[len(STEGO_MAGIC):STEGO_HEADER_SIZE])
+    if uint64(length) > uint64(len(payload) - STEGO_HEADER_SIZE) {
+        return nil, retErrStr("stego: The embedded stream is truncated")
+    }
+
+    return payload[STEGO_HEADER_SIZE:STEGO_HEADER_SIZE + int(length)], nil
+}
+
+func stegoPayload(stream []byte) []byte {
+    payload := make([]byte, STEGO_HEADER_SIZE + len(stream))
+    copy(payload, STEGO_MAGIC)
+    binary.BigEndian.PutUint32(payload[len(STEGO_MAGIC):], uint32(len(stream)))
+    copy(payload[STEGO_HEADER_SIZE:], stream)
+
+    return payload
+}
+
+/*
+ * Converts without premultiplying, which would lose the low bits of translucent pixels
+ */
+func toNRGBA(img image.Image) *image.NRGBA {
+    if nrgba, ok := img.(*image.NRGBA); ok {
+        return nrgba
+    }
+
+    bounds := img.Bounds()
+    output := image.NewNRGBA(bounds)
+    for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+        for x := bounds.Min.X; x < bounds.Max.X; x++ {
+            output.Set(x, y, color.NRGBAModel.Convert(img.At(x, y)))
+        }
+    }
+
+    return output
+}
+
+func embedPNG(carrier []byte, payload []byte) ([]byte, error) {
+    img, err := png.Decode(bytes.NewReader(carrier))
+    if err != nil {
+        return nil, err
+    }
+    nrgba := toNRGBA(img)
+
+    capacity := len(nrgba.Pix) / 4 * 3 / 8
+    if len(payload) > capacity {
+        return nil, retErrStr("stego: The carrier image is too small for the stream")
+    }
+
+    /* Pad with random bits, so that the used and unused parts of the image look alike */
+    padded := make([]byte, capacity)
+    copy(padded, payload)
+    if _, err := io.ReadFull(rand.Reader, padded[len(payload):]); err != nil {
+        return nil, err
+    }
+    writeLSB(nrgba.Pix, padded)
+
+    var output bytes.Buffer
+    if err := png.Encode(&output, nrgba); err != nil {
+        return nil, err
+    }
+
+    return output.Bytes(), nil
+}
+
+/*
+ * Stores `data` in the least significant bits of the RGB values of NRGBA pixels
+ */
+func writeLSB(pix []byte, data []byte) {
+    var bit = 0
+    for i := range pix {
+        if i % 4 == 3 {
+            continue /* Alpha */
+        }
+        if bit == len(data) * 8 {
+            return
+        }
+
+        pix[i] = (pix[i] &^ 1) | ((data[bit / 8] >> (7 - uint(bit % 8))) & 1)
+        bit++
+    }
+}
+
+func readLSB(pix []byte) []byte {
+    output := make([]byte, len(pix) / 4 * 3 / 8)
+
+    var bit = 0
+    for i := range pix {
+        if i % 4 == 3 {
+            continue
+        }
+        if bit == len(output) * 8 {
+            break
+        }
+
+        output[bit / 8] |= (pix[i] & 1) << (7 - uint(bit % 8))
+        bit++
+    }
+
+    return output
+}
+
+/*
+ * Walks the JPEG segments up to the start of scan. Returns the concatenated contents of
+ *  the govfs APP15 segments, and the picture without them
+ */
+func jpegSegments(picture []byte) ([]byte, []byte, error) {
+    var payload []byte
+    stripped := append([]byte(nil), jpeg_signature...)
+
+    offset := len(jpeg_signature)
+    for {
+        if offset + 4 > len(picture) || picture[offset] != 0xff {
+            return nil, nil, retErrStr("stego: Malformed JPEG segment")
+        }
+
+        marker := picture[offset + 1]
+        if marker == 0xda { /* Start of scan, the entropy coded data follows */
+            stripped = append(stripped, picture[offset:]...)
+            return payload, stripped, nil
+        }
+
+        length := int(binary.BigEndian.Uint16(picture[offset + 2:]))
+        end := offset + 2 + length
+        if length < 2 || end > len(picture) {
+            return nil, nil, retErrStr("stego: Malformed JPEG segment")
+        }
+
+        body := picture[offset + 4:end]
+        if marker == STEGO_JPEG_MARKER && bytes.HasPrefix(body, []byte(STEGO_MAGIC)) {
+            payload = append(payload, body[len(STEGO_MAGIC):]...)
+        } else {
+            stripped = append(stripped, picture[offset:end]...)
+        }
+        offset = end
+    }
+}
+
+func embedJPEG(carrier []byte, payload []byte) ([]byte, error) {
+    _, stripped, err := jpegSegments(carrier)
+    if err != nil {
+        return nil, err
+    }
+
+    /* Insert after the APP0-APP14 segments (JFIF, Exif, ...), as an editor would */
+    offset := len(jpeg_signature)
+    for offset + 4 <= len(stripped) && stripped[offset + 1] >= 0xe0 && stripped[offset + 1] < STEGO_JPEG_MARKER {
+        offset += 2 + int(binary.BigEndian.Uint16(stripped[offset + 2:]))
+    }
+
+    var output bytes.Buffer
+    output.Write(stripped[:offset])
+    for len(payload) > 0 {
+        chunk := payload
+        if len(chunk) > STEGO_JPEG_SEGMENT {
+            chunk = chunk[:STEGO_JPEG_SEGMENT]
+        }
+        payload = payload[len(chunk):]
+
+        var length [2]byte
+        binary.BigEndian.PutUint16(length[:], uint16(2 + len(STEGO_MAGIC) + len(chunk)))
+        output.Write([]byte{ 0xff, STEGO_JPEG_MARKER })
+        output.Write(length[:])
+        output.WriteString(STEGO_MAGIC)
+        output.Write(chunk)
+    }
+    output.Write(stripped[offset:])
+
+    return output.Bytes(), nil
+}
+
+func init() {
+    RegisterStorage(STEGO_PREFIX, stegoStorage{})
+}
+
+/*
+ * Keeps the raw fs stream inside a picture on the host, see StegoName()
+ */
+type stegoStorage struct{}
+
+func (stegoStorage) Read(name string) ([]byte, error) {
+    picture, err := os.ReadFile(name)
+    if err != nil {
+        return nil, err
+    }
+
+    return ExtractStream(picture)
+}
+
+/*
+ * A carrier without an embedded stream does not hold a database yet
+ */
+func (s stegoStorage) Open(name string) (int64, error) {
+    stream, err := s.Read(name)
+    if err != nil {
+        return 0, err
+    }
+
+    return int64(len(stream)), nil
+}
+
+func (stegoStorage) Write(name string, data []byte) error {
+    return rewriteCarrier(name, stegoPayload(data))
+}
+
+/*
+ * Removes the stream, the PNG bits are all randomised. The carrier itself must survive,
+ *  so the file is not overwritten as StorageFile does
+ */
+func (s stegoStorage) Delete(name string) error {
+    if _, err := s.Open(name); err != nil {
+        return err
+    }
+
+    return rewriteCarrier(name, nil)
+}
+
+func rewriteCarrier(name string, payload []byte) error {
+    carrier, err := os.ReadFile(name)
+    if err != nil {
+        return err /* The carrier is never created */
+    }
+
+    picture, err := embedPayload(carrier, payload)
+    if err != nil {
+        return err
+    }
+
+    return StorageFile.Write(name, picture)
+}
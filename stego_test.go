@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "io/fs"
+    "bytes"
+    "image"
+    "image/png"
+    "image/jpeg"
+    "image/color"
+    "testing"
+    "path/filepath"
+)
+
+func genCarrier(format string, size int, t *testing.T) []byte {
+    img := image.NewNRGBA(image.Rect(0, 0, size, size))
+    for y := 0; y < size; y++ {
+        for x := 0; x < size; x++ {
+            img.Set(x, y, color.NRGBA{ uint8(x * 4), uint8(y * 4), uint8(x + y), uint8(255 - x % 2 * 100) })
+        }
+    }
+
+    var output bytes.Buffer
+    var err error
+    if format == "png" {
+        err = png.Encode(&output, img)
+    } else {
+        err = jpeg.Encode(&output, img, nil)
+    }
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return output.Bytes()
+}
+
+func TestStegoPNG(t *testing.T) {
+    debugOut("[+] Running PNG Steganography Test...")
+
+    carrier := genCarrier("png", 64, t)
+    stream := bytes.Repeat([]byte("encrypted stream "), 50)
+
+    picture, err := EmbedStream(carrier, stream)
+    if err != nil {
+        drive_fail("TEST1: Failed to embed stream: " + err.Error(), t)
+    }
+    if extracted, err := ExtractStream(picture); err != nil || !bytes.Equal(extracted, stream) {
+        drive_fail("TEST2: Extracted stream does not match", t)
+    }
+
+    /* Every value is within one of the carrier's */
+    before, _ := png.Decode(bytes.NewReader(carrier))
+    after, err := png.Decode(bytes.NewReader(picture))
+    if err != nil {
+        drive_fail("TEST3: Output is not a valid PNG", t)
+    }
+    a, b := toNRGBA(before).Pix, toNRGBA(after).Pix
+    for i := range a {
+        if d := int(a[i]) - int(b[i]); d > 1 || d < -1 || (i % 4 == 3 && d != 0) {
+            drive_fail("TEST4: The picture changed visibly", t)
+        }
+    }
+
+    /* Re-embedding replaces the previous stream */
+    picture, _ = EmbedStream(picture, []byte("short"))
+    if extracted, _ := ExtractStream(picture); string(extracted) != "short" {
+        drive_fail("TEST5: The stream was not replaced", t)
+    }
+
+    if _, err := EmbedStream(genCarrier("png", 8, t), stream); err == nil {
+        drive_fail("TEST6: Embedded a stream larger than the carrier", t)
+    }
+    if _, err := ExtractStream(carrier); err != fs.ErrNotExist {
+        drive_fail("TEST7: Found a stream in a plain carrier", t)
+    }
+}
+
+func TestStegoJPEG(t *testing.T) {
+    debugOut("[+] Running JPEG Steganography Test...")
+
+    carrier := genCarrier("jpeg", 64, t)
+    stream := bytes.Repeat([]byte{ 0xff, 0xd9, 0x00, 0x42 }, 40000) /* Spans several segments */
+
+    picture, err := EmbedStream(carrier, stream)
+    if err != nil {
+        drive_fail("TEST1: Failed to embed stream: " + err.Error(), t)
+    }
+    if extracted, err := ExtractStream(picture); err != nil || !bytes.Equal(extracted, stream) {
+        drive_fail("TEST2: Extracted stream does not match", t)
+    }
+    if _, err := jpeg.Decode(bytes.NewReader(picture)); err != nil {
+        drive_fail("TEST3: Output is not a valid JPEG", t)
+    }
+
+    picture, _ = EmbedStream(picture, []byte("short"))
+    if extracted, _ := ExtractStream(picture); string(extracted) != "short" {
+        drive_fail("TEST4: The stream was not replaced", t)
+    }
+    if len(picture) != len(carrier) + 4 + len(STEGO_MAGIC) + STEGO_HEADER_SIZE + len("short") {
+        drive_fail("TEST5: Previous segments were not removed", t)
+    }
+}
+
+func TestStegoStore(t *testing.T) {
+    debugOut("[+] Running Steganography Store Test...")
+
+    carrier := filepath.Join(t.TempDir(), "holiday.png")
+    os.WriteFile(carrier, genCarrier("png", 128, t), 0600)
+
+    header, err := CreateDatabase(StegoName(carrier), FLAG_DB_LOAD | FLAG_DB_CREATE | FLAG_ENCRYPT | FLAG_COMPRESS)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database in a fresh carrier", t)
+    }
+    header.StartIOController()
+    header.Create("/notes.txt")
+    header.Write("/notes.txt", []byte("hidden in plain sight"))
+    header.Create("/old.txt")
+    header.Write("/old.txt", []byte("deleted"))
+    header.UnmountDB(0)
+    header.Delete("/old.txt")
+
+    header, err = header.Commit()
+    if header == nil || err != nil {
+        drive_fail("TEST2: Failed to commit and reload database", t)
+    }
+    defer header.Close()
+
+    if data, err := header.Read("/notes.txt"); err != nil || string(data) != "hidden in plain sight" {
+        drive_fail("TEST3: Reloaded file has unexpected contents", t)
+    }
+    if header.Check("/old.txt") == true {
+        drive_fail("TEST4: Deleted file was reloaded", t)
+    }
+
+    picture, _ := os.ReadFile(carrier)
+    if _, err := png.Decode(bytes.NewReader(picture)); err != nil {
+        drive_fail("TEST5: The carrier is no longer a valid PNG", t)
+    }
+
+    if _, err := CreateDatabase(StegoName(filepath.Join(t.TempDir(), "missing.png")), FLAG_DB_LOAD); err == nil {
+        drive_fail("TEST6: Loaded a database from a missing carrier", t)
+    }
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "sync"
+    "context"
+    "strings"
+    "path/filepath"
+)
+
+/*
+ * A StorageBackend keeps the raw fs stream, a single blob, for readFsStream and
+ *  writeFsStream. Set DBConfig.Storage to use one for a database, or register it
+ *  for a name prefix with RegisterStorage(). Otherwise the database name selects a
+ *  built-in backend:
+ *
+ *  "ads:"          NTFS alternate data streams, see ADSName()
+ *  "stego:"        Pictures, see StegoName()
+ *  "indexeddb:"    IndexedDB (js/wasm), see storage_js.go
+ *  "localstorage:" localStorage (js/wasm)
+ *  Other names     Files on the host, StorageFile
+ */
+type StorageBackend interface {
+    Open(name string) (int64, error) /* Returns the size of the blob, fs.ErrNotExist if there is none */
+    Read(name string) ([]byte, error)
+    Write(name string, data []byte) error /* Replaces the blob */
+    Delete(name string) error /* Destroys the blob so that it cannot be recovered, before a commit replaces it */
+}
+
+/*
+ * Optionally implemented by a StorageBackend whose writes can be given up on. A write
+ *  abandoned because ctx is done must leave the previous blob in place, see UnmountDBCtx()
+ */
+type ContextStorage interface {
+    WriteCtx(ctx context.Context, name string, data []byte) error
+}
+
+/*
+ * Implemented by StorageFile, which destroys the previous blob only once the new one is
+ *  written and about to replace it. Other backends have the previous blob deleted before
+ *  the write, see writeFsStream()
+ */
+type wipingStorage interface {
+    writeWipe(ctx context.Context, name string, data []byte) error
+}
+
+const STORAGE_WRITE_CHUNK     int       = 1024 * 1024 /* ctx is checked between chunks, see WriteCtx() */
+
+var StorageFile StorageBackend = fileStorage{}
+
+var (
+    storage_lock        sync.RWMutex
+    storage_prefixes    = map[string]StorageBackend{}
+)
+
+/*
+ * Selects `backend` for database names beginning with `prefix`. The backend is passed
+ *  the name without the prefix. A nil backend removes the prefix
+ */
+func RegisterStorage(prefix string, backend StorageBackend) {
+    storage_lock.Lock()
+    defer storage_lock.Unlock()
+
+    if backend == nil {
+        delete(storage_prefixes, prefix)
+        return
+    }
+    storage_prefixes[prefix] = backend
+}
+
+/*
+ * Returns the backend for a database name, and the name within that backend
+ */
+func (c *DBConfig) storage(name string) (StorageBackend, string) {
+    if c.Storage != nil {
+        return c.Storage, name
+    }
+
+    storage_lock.RLock()
+    defer storage_lock.RUnlock()
+
+    /* The longest prefix wins */
+    var backend StorageBackend = StorageFile
+    var match string
+    for prefix, b := range storage_prefixes {
+        if strings.HasPrefix(name, prefix) && len(prefix) > len(match) {
+            backend, match = b, prefix
+        }
+    }
+
+    return backend, strings.TrimPrefix(name, match)
+}
+
+/*
+ * Stores the raw fs stream in a file on the host
+ */
+type fileStorage struct{}
+
+func (fileStorage) Open(name string) (int64, error) {
+    info, err := os.Stat(name)
+    if err != nil {
+        return 0, err
+    }
+
+    return info.Size(), nil
+}
+
+func (fileStorage) Read(name string) ([]byte, error) {
+    return os.ReadFile(name)
+}
+
+func (s fileStorage) Write(name string, data []byte) error {
+    return s.WriteCtx(context.Background(), name, data)
+}
+
+/*
+ * Writes a temporary file next to `name` and renames it over `name` once complete, so
+ *  that a write which fails or is given up on leaves the previous file in place
+ */
+func (s fileStorage) WriteCtx(ctx context.Context, name string, data []byte) error {
+    return s.write(ctx, name, data, false)
+}
+
+/*
+ * WriteCtx() which overwrites the previous file in place between writing the temporary
+ *  file and renaming it. The rename is made even if the overwrite fails, whose error is
+ *  returned after it
+ */
+func (s fileStorage) writeWipe(ctx context.Context, name string, data []byte) error {
+    return s.write(ctx, name, data, true)
+}
+
+func (fileStorage) write(ctx context.Context, name string, data []byte, wipe bool) (err error) {
+    var mode os.FileMode = 0644
+    if info, err := os.Stat(name); err == nil {
+        mode = info.Mode().Perm()
+    }
+
+    file, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name) + ".*.tmp")
+    if err != nil {
+        return err
+    }
+    defer func () {
+        if err != nil {
+            file.Close()
+            os.Remove(file.Name())
+        }
+    }()
+
+    for off := 0; off < len(data); off += STORAGE_WRITE_CHUNK {
+        if err = ctx.Err(); err != nil {
+            return err
+        }
+
+        end := off + STORAGE_WRITE_CHUNK
+        if end > len(data) {
+            end = len(data)
+        }
+        if _, err = file.Write(data[off:end]); err != nil {
+            return err
+        }
+    }
+
+    file.Chmod(mode) /* Best effort, e.g. js/wasm does not support it */
+    if err = file.Close(); err != nil {
+        return err
+    }
+
+    var wipeErr error
+    if wipe == true {
+        if wipeErr = overwriteFile(name); os.IsNotExist(wipeErr) {
+            wipeErr = nil
+        }
+    }
+    if err = os.Rename(file.Name(), name); err != nil {
+        return err
+    }
+
+    return wipeErr
+}
+
+func (fileStorage) Delete(name string) error {
+    if err := overwriteFile(name); err != nil {
+        return err
+    }
+
+    return os.Remove(name)
+}
@@ -0,0 +1,260 @@
+//go:build js && wasm
+// +build js,wasm
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "io/fs"
+    "syscall/js"
+    "encoding/base64"
+)
+
+/*
+ * Browser stores for the raw fs stream, selected by the database name:
+ *
+ *  "indexeddb:<name>"      A record in the "streams" object store of the "govfs"
+ *                          IndexedDB database
+ *  "localstorage:<name>"   The "govfs:<name>" localStorage item, base64 encoded. Limited
+ *                          to a few MB by most browsers
+ *
+ * IndexedDB is asynchronous, so UnmountDB(), Commit() and CreateDatabase() block the
+ *  calling goroutine until the browser completes the request. They must not be called
+ *  from a js.FuncOf callback, which blocks the event loop; start a goroutine instead
+ */
+const IDB_DATABASE            string    = "govfs"
+const IDB_OBJECT_STORE        string    = "streams"
+const LOCAL_STORAGE_PREFIX    string    = "govfs:"
+
+func init() {
+    RegisterStorage("indexeddb:", idbStorage{})
+    RegisterStorage("localstorage:", localStorage{})
+}
+
+/*
+ * JavaScript exceptions surface as js.Error panics
+ */
+func catchJS(err *error) {
+    if r := recover(); r != nil {
+        if e, ok := r.(js.Error); ok {
+            *err = retErrStr("js: " + e.Error())
+            return
+        }
+        panic(r)
+    }
+}
+
+func bytesToJS(data []byte) js.Value {
+    array := js.Global().Get("Uint8Array").New(len(data))
+    js.CopyBytesToJS(array, data)
+    return array
+}
+
+type localStorage struct{}
+
+func (localStorage) storage() (js.Value, error) {
+    storage := js.Global().Get("localStorage")
+    if storage.IsUndefined() || storage.IsNull() {
+        return js.Value{}, retErrStr("localstorage: localStorage is not available")
+    }
+
+    return storage, nil
+}
+
+func (s localStorage) get(name string) (data []byte, err error) {
+    defer catchJS(&err)
+
+    storage, err := s.storage()
+    if err != nil {
+        return nil, err
+    }
+
+    item := storage.Call("getItem", LOCAL_STORAGE_PREFIX + name)
+    if item.IsNull() || item.IsUndefined() {
+        return nil, fs.ErrNotExist
+    }
+
+    return base64.StdEncoding.DecodeString(item.String())
+}
+
+func (s localStorage) Open(name string) (int64, error) {
+    data, err := s.get(name)
+    return int64(len(data)), err
+}
+
+func (s localStorage) Read(name string) ([]byte, error) {
+    return s.get(name)
+}
+
+func (s localStorage) Write(name string, data []byte) (err error) {
+    defer catchJS(&err) /* QuotaExceededError */
+
+    storage, err := s.storage()
+    if err != nil {
+        return err
+    }
+    storage.Call("setItem", LOCAL_STORAGE_PREFIX + name, base64.StdEncoding.EncodeToString(data))
+
+    return nil
+}
+
+/*
+ * Strings are immutable, the item is replaced with zeroes before it is removed in
+ *  the hope that the browser reuses its storage
+ */
+func (s localStorage) Delete(name string) (err error) {
+    size, err := s.Open(name)
+    if err != nil {
+        return err
+    }
+    if err := s.Write(name, make([]byte, size)); err != nil {
+        return err
+    }
+    defer catchJS(&err)
+
+    storage, err := s.storage()
+    if err != nil {
+        return err
+    }
+    storage.Call("removeItem", LOCAL_STORAGE_PREFIX + name)
+
+    return nil
+}
+
+type idbStorage struct{}
+
+/*
+ * Blocks until `target` fires `event`, or its error event
+ */
+func idbWait(target js.Value, event string) error {
+    done := make(chan error, 1)
+    success := js.FuncOf(func (this js.Value, args []js.Value) interface{} {
+        done <- nil
+        return nil
+    })
+    failure := js.FuncOf(func (this js.Value, args []js.Value) interface{} {
+        done <- retErrStr("indexeddb: " + target.Get("error").Call("toString").String())
+        return nil
+    })
+    defer success.Release()
+    defer failure.Release()
+
+    target.Set("on" + event, success)
+    target.Set("onerror", failure)
+
+    return <-done
+}
+
+func (idbStorage) connect() (db js.Value, err error) {
+    defer catchJS(&err)
+
+    factory := js.Global().Get("indexedDB")
+    if factory.IsUndefined() || factory.IsNull() {
+        return js.Value{}, retErrStr("indexeddb: IndexedDB is not available")
+    }
+
+    request := factory.Call("open", IDB_DATABASE, 1)
+    upgrade := js.FuncOf(func (this js.Value, args []js.Value) interface{} {
+        request.Get("result").Call("createObjectStore", IDB_OBJECT_STORE)
+        return nil
+    })
+    defer upgrade.Release()
+    request.Set("onupgradeneeded", upgrade)
+
+    if err := idbWait(request, "success"); err != nil {
+        return js.Value{}, err
+    }
+
+    return request.Get("result"), nil
+}
+
+func (s idbStorage) get(name string) (data []byte, err error) {
+    db, err := s.connect()
+    if err != nil {
+        return nil, err
+    }
+    defer db.Call("close")
+    defer catchJS(&err)
+
+    request := db.Call("transaction", IDB_OBJECT_STORE, "readonly").Call("objectStore", IDB_OBJECT_STORE).Call("get", name)
+    if err := idbWait(request, "success"); err != nil {
+        return nil, err
+    }
+
+    result := request.Get("result")
+    if result.IsUndefined() || result.IsNull() {
+        return nil, fs.ErrNotExist
+    }
+    data = make([]byte, result.Get("length").Int())
+    js.CopyBytesToGo(data, result)
+
+    return data, nil
+}
+
+func (s idbStorage) Open(name string) (int64, error) {
+    data, err := s.get(name)
+    return int64(len(data)), err
+}
+
+func (s idbStorage) Read(name string) ([]byte, error) {
+    return s.get(name)
+}
+
+func (s idbStorage) Write(name string, data []byte) (err error) {
+    db, err := s.connect()
+    if err != nil {
+        return err
+    }
+    defer db.Call("close")
+    defer catchJS(&err)
+
+    /* Durable once the transaction completes, not when the put() request succeeds */
+    transaction := db.Call("transaction", IDB_OBJECT_STORE, "readwrite")
+    transaction.Call("objectStore", IDB_OBJECT_STORE).Call("put", bytesToJS(data), name)
+
+    return idbWait(transaction, "complete")
+}
+
+func (s idbStorage) Delete(name string) (err error) {
+    size, err := s.Open(name)
+    if err != nil {
+        return err
+    }
+    if err := s.Write(name, make([]byte, size)); err != nil {
+        return err
+    }
+
+    db, err := s.connect()
+    if err != nil {
+        return err
+    }
+    defer db.Call("close")
+    defer catchJS(&err)
+
+    transaction := db.Call("transaction", IDB_OBJECT_STORE, "readwrite")
+    transaction.Call("objectStore", IDB_OBJECT_STORE).Call("delete", name)
+
+    return idbWait(transaction, "complete")
+}
@@ -0,0 +1,112 @@
+//go:build js && wasm
+// +build js,wasm
+
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "bytes"
+    "testing"
+    "syscall/js"
+)
+
+/*
+ * Node.js has no localStorage, so a minimal one is installed for the test
+ */
+func fakeLocalStorage() (map[string]string, func ()) {
+    items := make(map[string]string)
+    getItem := js.FuncOf(func (this js.Value, args []js.Value) interface{} {
+        if v, ok := items[args[0].String()]; ok {
+            return v
+        }
+        return nil
+    })
+    setItem := js.FuncOf(func (this js.Value, args []js.Value) interface{} {
+        items[args[0].String()] = args[1].String()
+        return nil
+    })
+    removeItem := js.FuncOf(func (this js.Value, args []js.Value) interface{} {
+        delete(items, args[0].String())
+        return nil
+    })
+
+    previous := js.Global().Get("localStorage")
+    storage := js.Global().Get("Object").New()
+    storage.Set("getItem", getItem)
+    storage.Set("setItem", setItem)
+    storage.Set("removeItem", removeItem)
+    js.Global().Set("localStorage", storage)
+
+    return items, func () {
+        js.Global().Set("localStorage", previous)
+        getItem.Release()
+        setItem.Release()
+        removeItem.Release()
+    }
+}
+
+func testBrowserStore(name string, t *testing.T) {
+    header, err := CreateDatabase(name, FLAG_DB_CREATE | FLAG_ENCRYPT | FLAG_COMPRESS)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/dir/file")
+    header.Write("/dir/file", []byte("stored in the browser"))
+    header.Create("/deleted")
+    header.UnmountDB(0)
+    header.Delete("/deleted") /* The next commit deletes the previous stream */
+
+    header, err = header.Commit()
+    if header == nil || err != nil {
+        drive_fail("TEST2: Failed to commit and reload database: " + err.Error(), t)
+    }
+    defer header.Close()
+
+    if data, err := header.Read("/dir/file"); err != nil || !bytes.Equal(data, []byte("stored in the browser")) {
+        drive_fail("TEST3: Reloaded file has unexpected contents", t)
+    }
+}
+
+func TestLocalStorage(t *testing.T) {
+    debugOut("[+] Running localStorage Store Test...")
+
+    items, restore := fakeLocalStorage()
+    defer restore()
+
+    testBrowserStore("localstorage:test", t)
+    if len(items[LOCAL_STORAGE_PREFIX + "test"]) == 0 {
+        drive_fail("TEST4: The stream was not stored in localStorage", t)
+    }
+}
+
+func TestIndexedDB(t *testing.T) {
+    if js.Global().Get("indexedDB").IsUndefined() {
+        t.Skip("IndexedDB is not available")
+    }
+    debugOut("[+] Running IndexedDB Store Test...")
+
+    testBrowserStore("indexeddb:test", t)
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "io/fs"
+    "bytes"
+    "errors"
+    "context"
+    "testing"
+    "path/filepath"
+)
+
+/*
+ * In-memory StorageBackend
+ */
+type memStorage struct {
+    blobs       map[string][]byte
+    deleted     int
+}
+
+func (m *memStorage) Open(name string) (int64, error) {
+    data, ok := m.blobs[name]
+    if !ok {
+        return 0, fs.ErrNotExist
+    }
+    return int64(len(data)), nil
+}
+
+func (m *memStorage) Read(name string) ([]byte, error) {
+    data, ok := m.blobs[name]
+    if !ok {
+        return nil, fs.ErrNotExist
+    }
+    return append([]byte(nil), data...), nil
+}
+
+func (m *memStorage) Write(name string, data []byte) error {
+    m.blobs[name] = append([]byte(nil), data...)
+    return nil
+}
+
+func (m *memStorage) Delete(name string) error {
+    if _, ok := m.blobs[name]; !ok {
+        return fs.ErrNotExist
+    }
+    wipeBuffer(m.blobs[name], false)
+    delete(m.blobs, name)
+    m.deleted++
+    return nil
+}
+
+func testStorageBackend(name string, config *DBConfig, storage *memStorage, t *testing.T) {
+    header, err := CreateDatabaseConfig(name, FLAG_DB_CREATE | FLAG_ENCRYPT | FLAG_COMPRESS, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    header.Create("/keep")
+    header.Write("/keep", []byte("kept"))
+    header.Create("/drop")
+    header.Write("/drop", []byte("dropped"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+    if len(storage.blobs["db"]) == 0 {
+        drive_fail("TEST3: The stream was not written to the backend", t)
+    }
+
+    header.Shred("/drop")
+    header, err = header.Commit()
+    if header == nil || err != nil {
+        drive_fail("TEST4: Failed to commit and reload database", t)
+    }
+    defer header.Close()
+    if storage.deleted != 1 {
+        drive_fail("TEST5: The stale stream was not deleted", t)
+    }
+
+    if data, err := header.Read("/keep"); err != nil || !bytes.Equal(data, []byte("kept")) {
+        drive_fail("TEST6: Reloaded file has unexpected contents", t)
+    }
+    if header.Check("/drop") == true {
+        drive_fail("TEST7: Deleted file was reloaded", t)
+    }
+    if header.CompressionStats().StreamSize != int64(len(storage.blobs["db"])) {
+        drive_fail("TEST8: Unexpected stream size", t)
+    }
+}
+
+func TestStorageBackend(t *testing.T) {
+    debugOut("[+] Running Storage Backend Test...")
+
+    storage := &memStorage{ blobs: make(map[string][]byte) }
+    testStorageBackend("db", &DBConfig{ Storage: storage }, storage, t)
+
+    if _, err := CreateDatabaseConfig("missing", FLAG_DB_LOAD, &DBConfig{ Storage: storage }); err == nil {
+        drive_fail("TEST9: Loaded a database which does not exist", t)
+    }
+}
+
+func TestRegisterStorage(t *testing.T) {
+    debugOut("[+] Running Storage Prefix Test...")
+
+    storage := &memStorage{ blobs: make(map[string][]byte) }
+    RegisterStorage("mem:", storage)
+    defer RegisterStorage("mem:", nil)
+
+    config := &DBConfig{}
+    if backend, name := config.storage("/tmp/mem:db"); name != "/tmp/mem:db" || backend != StorageFile {
+        drive_fail("TEST1: A path was not mapped to StorageFile", t)
+    }
+    if backend, name := config.storage("mem:db"); name != "db" || backend != storage {
+        drive_fail("TEST2: The prefix was not mapped to its backend", t)
+    }
+
+    testStorageBackend("mem:db", nil, storage, t)
+}
+
+/*
+ * Runs `cancel` as soon as a file is compressed, i.e. while the commit encodes files
+ */
+type cancelCodec struct {
+    Codec
+    cancel      func ()
+}
+
+func (c *cancelCodec) Compress(data []byte) ([]byte, error) {
+    if c.cancel != nil {
+        c.cancel()
+    }
+    return c.Codec.Compress(data)
+}
+
+/*
+ * Runs `cancel` before writing the raw fs file
+ */
+type cancelStorage struct {
+    StorageBackend
+    cancel      func ()
+}
+
+func (s *cancelStorage) WriteCtx(ctx context.Context, name string, data []byte) error {
+    if s.cancel != nil {
+        s.cancel()
+    }
+    return StorageFile.(ContextStorage).WriteCtx(ctx, name, data)
+}
+
+func TestCancelCommit(t *testing.T) {
+    debugOut("[+] Running Cancelled Commit Test...")
+
+    var filename = gen_raw_filename("test_cancel_commit")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    codec := &cancelCodec{ Codec: CodecGzip }
+    storage := &cancelStorage{ StorageBackend: StorageFile }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ Codec: codec, Storage: storage })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/file")
+    header.Write("/file", []byte("committed"))
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+    committed, _ := os.ReadFile(filename)
+
+    unchanged := func (test string) {
+        if data, _ := os.ReadFile(filename); bytes.Equal(data, committed) == false {
+            drive_fail(test + ": Cancelled commit changed the raw fs file", t)
+        }
+        if tmp, _ := filepath.Glob(filename + ".*.tmp"); len(tmp) != 0 {
+            drive_fail(test + ": Cancelled commit left a temporary file", t)
+        }
+    }
+
+    header.Write("/file", make([]byte, 64 * 1024))
+
+    /* Cancelled while encoding the files */
+    ctx, cancel := context.WithCancel(context.Background())
+    codec.cancel = cancel
+    if err := header.UnmountDBCtx(ctx, FLAG_COMPRESS_FILES); !errors.Is(err, context.Canceled) {
+        drive_fail("TEST3: Commit was not cancelled while encoding", t)
+    }
+    codec.cancel = nil
+    unchanged("TEST4")
+
+    /* Cancelled while writing the raw fs file */
+    ctx, cancel = context.WithCancel(context.Background())
+    storage.cancel = cancel
+    if err := header.UnmountDBCtx(ctx, 0); !errors.Is(err, context.Canceled) {
+        drive_fail("TEST5: Commit was not cancelled while writing", t)
+    }
+    storage.cancel = nil
+    unchanged("TEST6")
+
+    /* The header is unchanged, a later commit writes the same contents */
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST7: Failed to commit after a cancelled commit", t)
+    }
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST8: Failed to load database", t)
+    }
+    if data, _ := loaded.Read("/file"); len(data) != 64 * 1024 {
+        drive_fail("TEST9: Unexpected contents after a cancelled commit", t)
+    }
+}
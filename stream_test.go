@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "bytes"
+    "strconv"
+)
+
+/*
+ * Round-trips a database through every combination of stream flags, per-file
+ *  compression and codec. The loader is not told whether the stream is compressed.
+ */
+func TestStreamFlagMatrix(t *testing.T) {
+    debugOut("[+] Running Stream Flag Matrix Test...")
+
+    var filename = gen_raw_filename("test_stream_matrix")
+    defer os.Remove(filename)
+
+    files := map[string][]byte{
+        "/empty":               {},
+        "/small":               []byte("x"),
+        "/folder0/text":        bytes.Repeat([]byte("compressible stream data "), 256),
+        "/folder0/folder1/bin": []byte{ 0, 1, 2, 3, 255, 254, 253 },
+    }
+
+    for _, streamFlags := range []FlagVal{ 0, FLAG_COMPRESS, FLAG_ENCRYPT, FLAG_COMPRESS | FLAG_ENCRYPT } {
+        for _, unmountFlags := range []FlagVal{ 0, FLAG_COMPRESS_FILES } {
+            for _, codec := range []Codec{ CodecGzip, CodecZstd, CodecSnappy } {
+                var desc = "stream=" + strconv.Itoa(int(streamFlags)) + " files=" +
+                    strconv.Itoa(int(unmountFlags)) + " codec=" + codec.Name()
+                os.Remove(filename)
+
+                config := &DBConfig{ Codec: codec, Cipher: CipherAESGCM, CompressMinSize: -1 }
+                header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE | streamFlags, config)
+                if header == nil || err != nil {
+                    drive_fail("TEST1: Failed to create database " + desc, t)
+                }
+                header.StartIOController()
+                for name, data := range files {
+                    header.Create(name)
+                    header.Write(name, data)
+                }
+
+                if err := header.UnmountDB(unmountFlags); err != nil {
+                    drive_fail("TEST2: Failed to commit database " + desc, t)
+                }
+
+                loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD | (streamFlags & FLAG_ENCRYPT),
+                    &DBConfig{ Cipher: CipherAESGCM })
+                if loaded == nil || err != nil {
+                    drive_fail("TEST3: Failed to load database " + desc, t)
+                }
+                for name, data := range files {
+                    if output, err := loaded.Read(name); err != nil || !bytes.Equal(output, data) {
+                        drive_fail("TEST4: Data mismatch for " + name + " " + desc, t)
+                    }
+                }
+
+                /* Commit() reloads the database with the original flags */
+                loaded.flags |= streamFlags
+                loaded.StartIOController()
+                if _, err := loaded.Commit(); err != nil {
+                    drive_fail("TEST5: Failed to re-commit database " + desc, t)
+                }
+            }
+        }
+    }
+
+    /* Empty or truncated streams must fail cleanly */
+    os.WriteFile(filename, []byte{}, 0644)
+    if _, err := CreateDatabase(filename, FLAG_DB_LOAD | FLAG_COMPRESS); err == nil {
+        drive_fail("TEST6: Empty stream was accepted", t)
+    }
+    os.WriteFile(filename, []byte{ STREAM_ENVELOPE_MAGIC, STREAM_ENVELOPE_COMPRESSED, 0x1f, 0x8b }, 0644)
+    if _, err := CreateDatabase(filename, FLAG_DB_LOAD); err == nil {
+        drive_fail("TEST7: Truncated compressed stream was accepted", t)
+    }
+
+    /* FLAG_DB_LOAD | FLAG_DB_CREATE loads an existing database rather than replacing it */
+    header, _ := CreateDatabase(filename, FLAG_DB_CREATE)
+    header.StartIOController()
+    header.Create("/kept")
+    header.UnmountDB(0)
+    if loaded, err := CreateDatabase(filename, FLAG_DB_LOAD | FLAG_DB_CREATE); err != nil || !loaded.Check("/kept") {
+        drive_fail("TEST8: FLAG_DB_CREATE replaced an existing database", t)
+    }
+
+    debugOut("[+] Stream Flag Matrix Test PASS")
+}
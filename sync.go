@@ -0,0 +1,410 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * rsync-style synchronization, for keeping edge copies of a master database up to
+ *  date. The master serves ServeSync() over TCP, or TLS, and a copy pulls from it with
+ *  SyncFrom(), or from another header in the same process with SyncFromHeader().
+ *
+ * The copy compares the listing of the master to its own by checksum, so unchanged
+ *  files cost nothing but their entry. For each changed file it sends the digests of
+ *  its fixed SYNC_BLOCK_SIZE blocks, and the master replies with only the blocks which
+ *  differ, which the copy patches into its data and verifies against the digest of the
+ *  whole file. Names missing from the master are deleted from the copy.
+ *
+ * Unlike Replicate(), a sync is a one-off pass which neither needs the copy to have
+ *  followed the master from the start nor keeps a backlog on the master.
+ */
+
+import (
+    "net"
+    "sort"
+    "sync"
+    "time"
+    "bytes"
+    "bufio"
+    "errors"
+    "strings"
+    "crypto/tls"
+    "crypto/sha256"
+    "encoding/gob"
+)
+
+const SYNC_BLOCK_SIZE         int           = 64 * 1024
+const SYNC_TIMEOUT            time.Duration = 30 * time.Second /* Per message */
+
+/*
+ * What SyncFrom() did
+ */
+type SyncStats struct {
+    Files       int /* Files created or updated */
+    Deleted     int
+    Unchanged   int
+    Bytes       int64 /* File data received */
+}
+
+type syncRequest struct {
+    Name        string /* "" requests the listing */
+    Blocks      [][]byte /* SHA-256 of each SYNC_BLOCK_SIZE block of the copy's data */
+}
+
+type syncRange struct {
+    Offset      int
+    Data        []byte
+}
+
+type syncReply struct {
+    Listing     []EntryInfo
+    Size        int
+    Sum         []byte /* SHA-256 of the whole data */
+    Ranges      []syncRange /* The blocks which differ, and anything past the copy's data */
+    Err         string
+}
+
+/*
+ * The master's side, over a connection or in process
+ */
+type syncSource interface {
+    request(req *syncRequest) (*syncReply, error)
+}
+
+type localSource struct {
+    hdr         *FSHeader
+}
+
+func (s localSource) request(req *syncRequest) (*syncReply, error) {
+    return s.hdr.syncReply(req), nil
+}
+
+type remoteSource struct {
+    conn        net.Conn
+    writer      *bufio.Writer
+    enc         *gob.Encoder
+    dec         *gob.Decoder
+}
+
+func (s *remoteSource) request(req *syncRequest) (*syncReply, error) {
+    s.conn.SetDeadline(time.Now().Add(SYNC_TIMEOUT))
+    if err := s.enc.Encode(req); err != nil {
+        return nil, err
+    }
+    if err := s.writer.Flush(); err != nil {
+        return nil, err
+    }
+
+    var reply syncReply
+    if err := s.dec.Decode(&reply); err != nil {
+        return nil, err
+    }
+
+    return &reply, nil
+}
+
+/*
+ * Serves the contents of this database to SyncFrom() of other databases, accepting
+ *  connections on `listener` until it is closed. Wrap the listener with tls.NewListener()
+ *  for TLS.
+ */
+func (f *FSHeader) ServeSync(listener net.Listener) error {
+    var sessions sync.WaitGroup
+    defer sessions.Wait()
+
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            if errors.Is(err, net.ErrClosed) {
+                return nil
+            }
+            return err
+        }
+
+        sessions.Add(1)
+        go func () {
+            defer sessions.Done()
+            defer conn.Close()
+
+            writer := bufio.NewWriter(conn)
+            enc := gob.NewEncoder(writer)
+            dec := gob.NewDecoder(bufio.NewReader(conn))
+            for {
+                var req syncRequest
+                conn.SetDeadline(time.Now().Add(SYNC_TIMEOUT))
+                if err := dec.Decode(&req); err != nil {
+                    return
+                }
+                if enc.Encode(f.syncReply(&req)) != nil || writer.Flush() != nil {
+                    return
+                }
+            }
+        }()
+    }
+}
+
+/*
+ * Updates this database to the contents of the one served by ServeSync() at `addr`,
+ *  connecting over TLS if `config` is not nil
+ */
+func (f *FSHeader) SyncFrom(addr string, config *tls.Config) (SyncStats, error) {
+    dialer := &net.Dialer{ Timeout: SYNC_TIMEOUT }
+    var conn net.Conn
+    var err error
+    if config != nil {
+        conn, err = tls.DialWithDialer(dialer, "tcp", addr, config)
+    } else {
+        conn, err = dialer.Dial("tcp", addr)
+    }
+    if err != nil {
+        return SyncStats{}, err
+    }
+    defer conn.Close()
+
+    writer := bufio.NewWriter(conn)
+    return f.syncFrom(&remoteSource{
+        conn: conn,
+        writer: writer,
+        enc: gob.NewEncoder(writer),
+        dec: gob.NewDecoder(bufio.NewReader(conn)),
+    })
+}
+
+/*
+ * SyncFrom() of a database in the same process
+ */
+func (f *FSHeader) SyncFromHeader(src *FSHeader) (SyncStats, error) {
+    if src.isClosed() {
+        return SyncStats{}, ErrClosed
+    }
+
+    return f.syncFrom(localSource{ hdr: src })
+}
+
+func (f *FSHeader) syncFrom(src syncSource) (SyncStats, error) {
+    var stats SyncStats
+    if f.isClosed() {
+        return stats, ErrClosed
+    }
+
+    reply, err := src.request(&syncRequest{})
+    if err != nil {
+        return stats, err
+    }
+    if reply.Err != "" {
+        return stats, retErrStr("sync: " + reply.Err)
+    }
+    local, err := f.List(ListOptions{})
+    if err != nil {
+        return stats, err
+    }
+
+    existing := make(map[string]EntryInfo)
+    for _, e := range local {
+        existing[e.Name] = e
+    }
+    remote := make(map[string]bool)
+
+    /* Sorted by name, so directories are created before their contents */
+    for _, e := range reply.Listing {
+        remote[e.Name] = true
+        l, ok := existing[e.Name]
+        if ok == true && l.Dir == e.Dir && l.Size == e.Size && l.Algorithm == e.Algorithm && l.Checksum == e.Checksum {
+            stats.Unchanged += 1
+            continue
+        }
+        if ok == true && l.Dir != e.Dir {
+            if err := f.syncDelete(l.Name); err != nil {
+                return stats, err
+            }
+            stats.Deleted += 1
+        }
+        if err := f.Create(e.Name); err != nil && errors.Is(err, ErrExist) == false {
+            return stats, err
+        }
+        if e.Dir == true {
+            continue
+        }
+
+        n, changed, err := f.syncFile(src, e.Name)
+        if err != nil {
+            return stats, err
+        }
+        if changed == true || ok == false {
+            stats.Files += 1
+        } else {
+            stats.Unchanged += 1
+        }
+        stats.Bytes += int64(n)
+    }
+
+    /* Contents before their directories */
+    sort.Slice(local, func (i, j int) bool {
+        return local[i].Name > local[j].Name
+    })
+    for _, e := range local {
+        if remote[e.Name] == true || f.Check(e.Name) == false {
+            continue
+        }
+        if err := f.syncDelete(e.Name); err != nil {
+            return stats, err
+        }
+        stats.Deleted += 1
+    }
+
+    return stats, nil
+}
+
+/*
+ * Deletes a name, and everything beneath it if it is a directory
+ */
+func (f *FSHeader) syncDelete(name string) error {
+    if strings.HasSuffix(name, "/") {
+        var contents []string
+        f.walk(name, func (file *govfsFile) {
+            if file.filename != name {
+                contents = append(contents, file.filename)
+            }
+        })
+        sort.Sort(sort.Reverse(sort.StringSlice(contents)))
+        for _, c := range contents {
+            if err := f.Delete(c); err != nil && errors.Is(err, ErrNotExist) == false {
+                return err
+            }
+        }
+    }
+
+    if err := f.Delete(name); err != nil && errors.Is(err, ErrNotExist) == false {
+        return err
+    }
+
+    return nil
+}
+
+/*
+ * Brings one file up to date, returns the bytes of data received. The contents are
+ *  unchanged if only the checksums differ, e.g. by their algorithm
+ */
+func (f *FSHeader) syncFile(src syncSource, name string) (int, bool, error) {
+    data, err := f.Read(name)
+    if err != nil {
+        return 0, false, err
+    }
+    if f.mem_cipher != nil {
+        defer wipeBuffer(data, false)
+    }
+
+    reply, err := src.request(&syncRequest{ Name: name, Blocks: blockSums(data) })
+    if err != nil {
+        return 0, false, err
+    }
+    if reply.Err != "" {
+        return 0, false, pathError("sync", name, retErrStr(reply.Err))
+    }
+    if len(reply.Ranges) == 0 && reply.Size == len(data) {
+        return 0, false, nil
+    }
+
+    /* Anything past the copy's data is sent, which bounds the size before it is allocated */
+    var sent int
+    for _, r := range reply.Ranges {
+        sent += len(r.Data)
+    }
+    if reply.Size < 0 || reply.Size > len(data) + sent {
+        return 0, false, pathError("sync", name, retErrStr("Invalid size"))
+    }
+
+    /* An empty output truncates the file */
+    output := make([]byte, reply.Size)
+    copy(output, data)
+    var received int
+    for _, r := range reply.Ranges {
+        if r.Offset < 0 || r.Offset + len(r.Data) > len(output) {
+            return 0, false, pathError("sync", name, retErrStr("Invalid range"))
+        }
+        copy(output[r.Offset:], r.Data)
+        received += len(r.Data)
+    }
+
+    sum := sha256.Sum256(output)
+    if bytes.Equal(sum[:], reply.Sum) == false {
+        return 0, false, pathError("sync", name, ErrChecksum)
+    }
+
+    return received, true, f.WriteOwned(name, output)
+}
+
+func blockSums(data []byte) [][]byte {
+    var sums [][]byte
+    for off := 0; off < len(data); off += SYNC_BLOCK_SIZE {
+        end := off + SYNC_BLOCK_SIZE
+        if end > len(data) {
+            end = len(data)
+        }
+        sum := sha256.Sum256(data[off:end])
+        sums = append(sums, sum[:])
+    }
+
+    return sums
+}
+
+/*
+ * The master's answer to one request of the copy
+ */
+func (f *FSHeader) syncReply(req *syncRequest) *syncReply {
+    reply := &syncReply{}
+    if req.Name == "" {
+        listing, err := f.List(ListOptions{})
+        if err != nil {
+            reply.Err = err.Error()
+        }
+        reply.Listing = listing
+        return reply
+    }
+
+    data, err := f.Read(req.Name)
+    if err != nil {
+        reply.Err = err.Error()
+        return reply
+    }
+    if f.mem_cipher != nil {
+        defer wipeBuffer(data, false)
+    }
+
+    sum := sha256.Sum256(data)
+    reply.Size, reply.Sum = len(data), sum[:]
+    for i, block := range blockSums(data) {
+        off := i * SYNC_BLOCK_SIZE
+        end := off + SYNC_BLOCK_SIZE
+        if end > len(data) {
+            end = len(data)
+        }
+
+        /* The copy keeps its block at the same offset if it has the same digest */
+        if i < len(req.Blocks) && bytes.Equal(block, req.Blocks[i]) == true {
+            continue
+        }
+        reply.Ranges = append(reply.Ranges, syncRange{ Offset: off, Data: append([]byte(nil), data[off:end]...) })
+    }
+
+    return reply
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "net"
+    "bytes"
+    "testing"
+)
+
+func syncPopulate(h *FSHeader) {
+    h.Create("/docs/")
+    h.Create("/docs/big")
+    h.Create("/docs/small")
+    h.Create("/stale/")
+    h.Create("/stale/file")
+    h.Write("/docs/big", bytes.Repeat([]byte("0123456789abcdef"), SYNC_BLOCK_SIZE / 4))
+    h.Write("/docs/small", []byte("small"))
+}
+
+func TestSync(t *testing.T) {
+    debugOut("[+] Running Sync Test...")
+
+    master, err := CreateDatabaseConfig("sync_master", FLAG_DB_CREATE, &DBConfig{})
+    if master == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    master.StartIOController()
+    defer master.Close()
+    edge, _ := CreateDatabaseConfig("sync_edge", FLAG_DB_CREATE, &DBConfig{ Checksum: ChecksumBLAKE3 })
+    edge.StartIOController()
+    defer edge.Close()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        drive_fail("TEST2: Failed to listen", t)
+    }
+    done := make(chan error)
+    go func () { done <- master.ServeSync(listener) }()
+    defer func () {
+        listener.Close()
+        <- done
+    }()
+
+    syncPopulate(master)
+    stats, err := edge.SyncFrom(listener.Addr().String(), nil)
+    if err != nil || stats.Files != 3 || stats.Bytes != int64(4 * SYNC_BLOCK_SIZE + 5) {
+        drive_fail("TEST3: Initial sync failed", t)
+    }
+    if changes, _ := master.Diff(edge); len(changes) != 0 {
+        drive_fail("TEST4: Databases differ after sync", t)
+    }
+
+    /* Only the changed block is transferred, and removed names are deleted */
+    big, _ := master.Read("/docs/big")
+    big[SYNC_BLOCK_SIZE + 1] = 'X'
+    master.Write("/docs/big", big)
+    master.Delete("/stale/file")
+    master.Create("/new")
+
+    stats, err = edge.SyncFrom(listener.Addr().String(), nil)
+    if err != nil || stats.Files != 2 || stats.Bytes != int64(SYNC_BLOCK_SIZE) || stats.Deleted != 1 {
+        drive_fail("TEST5: Incremental sync failed", t)
+    }
+    if changes, _ := master.Diff(edge); len(changes) != 0 {
+        drive_fail("TEST6: Databases differ after incremental sync", t)
+    }
+
+    /* Summed with other algorithms, but the contents are the same */
+    if stats, err := edge.SyncFrom(listener.Addr().String(), nil); err != nil || stats.Files != 0 || stats.Bytes != 0 {
+        drive_fail("TEST7: Sync of identical databases transferred data", t)
+    }
+}
+
+func TestSyncFromHeader(t *testing.T) {
+    debugOut("[+] Running Local Sync Test...")
+
+    master, _ := CreateDatabaseConfig("sync_local_master", FLAG_DB_CREATE, &DBConfig{})
+    master.StartIOController()
+    defer master.Close()
+    edge, _ := CreateDatabaseConfig("sync_local_edge", FLAG_DB_CREATE, &DBConfig{})
+    edge.StartIOController()
+    defer edge.Close()
+
+    syncPopulate(master)
+    edge.Create("/docs/")
+    edge.Create("/docs/big")
+    edge.Write("/docs/big", []byte("outdated"))
+
+    if _, err := edge.SyncFromHeader(master); err != nil {
+        drive_fail("TEST1: SyncFromHeader() failed", t)
+    }
+    if changes, _ := master.Diff(edge); len(changes) != 0 {
+        drive_fail("TEST2: Databases differ after sync", t)
+    }
+    if stats, _ := edge.SyncFromHeader(master); stats.Files != 0 || stats.Unchanged == 0 {
+        drive_fail("TEST3: Second sync was not a no-op", t)
+    }
+
+    /* A file emptied on the master is truncated */
+    master.Write("/docs/big", nil)
+    if stats, err := edge.SyncFromHeader(master); err != nil || stats.Files != 1 {
+        drive_fail("TEST4: Sync of an emptied file failed", t)
+    }
+    if size, _ := edge.GetFileSize("/docs/big"); size != 0 {
+        drive_fail("TEST5: Emptied file was not truncated", t)
+    }
+
+    /* A size which the reply does not cover is rejected before it is allocated */
+    edge.Write("/docs/big", []byte("data"))
+    for _, size := range []int{ -1, 1 << 40 } {
+        reply := &syncReply{ Size: size, Ranges: []syncRange{ { Offset: 0, Data: []byte("x") } } }
+        if _, _, err := edge.syncFile(stubSource{ reply }, "/docs/big"); err == nil {
+            drive_fail("TEST6: Accepted an invalid size", t)
+        }
+    }
+}
+
+type stubSource struct {
+    reply       *syncReply
+}
+
+func (s stubSource) request(req *syncRequest) (*syncReply, error) {
+    return s.reply, nil
+}
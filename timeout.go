@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "time"
+)
+
+/*
+ * Dispatches an IRP, but gives up on it once it has been queued for longer than
+ *  `timeout` so that a wedged operation cannot block its caller. An IRP which expired
+ *  while queued is not executed at all. One which expires while executing fails with
+ *  ErrTimeout, but the operation itself cannot be interrupted: it keeps running in
+ *  the background, and may still take effect. dispatch() relies on being the only
+ *  operation running, so no other IRP is dispatched until the abandoned one finishes;
+ *  those which expire waiting for it fail with ErrTimeout.
+ */
+func (f *FSHeader) dispatchTimeout(ioh *govfsIoBlock, timeout time.Duration) {
+    remaining := timeout - time.Since(ioh.queued)
+    if remaining <= 0 {
+        ioh.status = ErrTimeout
+        return
+    }
+
+    if f.abandoned != nil {
+        timer := time.NewTimer(remaining)
+        select {
+        case <- f.abandoned:
+            f.abandoned = nil
+            timer.Stop()
+        case <- timer.C:
+            ioh.status = ErrTimeout
+            return
+        }
+
+        if remaining = timeout - time.Since(ioh.queued); remaining <= 0 {
+            ioh.status = ErrTimeout
+            return
+        }
+    }
+
+    /* The operation works on a copy, so that an abandoned one does not race with the reply */
+    work := *ioh
+    done := make(chan struct{})
+    go func () {
+        f.dispatch(&work)
+        close(done)
+    }()
+
+    timer := time.NewTimer(remaining)
+    defer timer.Stop()
+
+    select {
+    case <- done:
+        /* Only the results, the submitter is reading io_out */
+        ioh.status = work.status
+        ioh.file = work.file
+        ioh.generation = work.generation
+    case <- timer.C:
+        ioh.status = ErrTimeout
+        f.abandoned = done
+    }
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "time"
+    "errors"
+)
+
+func TestOperationTimeout(t *testing.T) {
+    debugOut("[+] Running Operation Timeout Test...")
+
+    var filename = gen_raw_filename("test_timeout")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ OperationTimeout: 50 * time.Millisecond }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+    defer header.Close()
+
+    if err := header.Create("/wedged"); err != nil {
+        drive_fail("TEST2: Failed to create file", t)
+    }
+    if err := header.Create("/healthy"); err != nil {
+        drive_fail("TEST2.1: Failed to create file", t)
+    }
+
+    /* Wedge writes to one file by holding its lock */
+    wedged := header.check("/wedged")
+    wedged.lock.Lock()
+
+    start := time.Now()
+    if err := header.Write("/wedged", []byte("wedged")); !errors.Is(err, ErrTimeout) {
+        drive_fail("TEST3: Wedged write did not return ErrTimeout", t)
+    }
+    if time.Since(start) > 5 * time.Second {
+        drive_fail("TEST3.1: Timeout was not enforced", t)
+    }
+
+    /* No other operation runs alongside the abandoned one, but its caller is not blocked */
+    start = time.Now()
+    if err := header.Write("/healthy", []byte("blocked")); !errors.Is(err, ErrTimeout) {
+        drive_fail("TEST4: Write behind an abandoned operation did not return ErrTimeout", t)
+    }
+    if time.Since(start) > 5 * time.Second {
+        drive_fail("TEST4.1: Timeout was not enforced behind an abandoned operation", t)
+    }
+
+    /* Once it finishes, operations are dispatched again */
+    wedged.lock.Unlock()
+    if err := header.Write("/healthy", []byte("healthy")); err != nil {
+        drive_fail("TEST5: IO controller did not resume after the abandoned operation", t)
+    }
+    if output, _ := header.Read("/healthy"); string(output) != "healthy" {
+        drive_fail("TEST6: Data mismatch", t)
+    }
+    if output, _ := header.Read("/wedged"); string(output) != "wedged" {
+        drive_fail("TEST7: The abandoned operation did not take effect", t)
+    }
+
+    debugOut("[+] Operation Timeout Test PASS")
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+)
+
+/*
+ * A Tracer wraps operations in spans, e.g. the otel subpackage for OpenTelemetry. Set
+ *  DBConfig.Tracer to trace Create, Read, Write, Append, Delete and UnmountDB. The span
+ *  is a child of whatever span the caller's context carries, use the *Ctx() variants
+ *  to pass it in.
+ */
+type Tracer interface {
+    Start(ctx context.Context, op string, name string) (context.Context, TraceSpan)
+}
+
+type TraceSpan interface {
+    End(size int, err error) /* `size` is the number of bytes read, written or committed */
+}
+
+/*
+ * Span names, as passed to Tracer.Start()
+ */
+const (
+    TRACE_CREATE              string    = "govfs.Create"
+    TRACE_READ                string    = "govfs.Read"
+    TRACE_WRITE               string    = "govfs.Write"
+    TRACE_APPEND              string    = "govfs.Append"
+    TRACE_DELETE              string    = "govfs.Delete"
+    TRACE_COMMIT              string    = "govfs.Commit"
+)
+
+type noSpan struct{}
+
+func (noSpan) End(size int, err error) {}
+
+func (f *FSHeader) trace(ctx context.Context, op string, name string) (context.Context, TraceSpan) {
+    if f.config.Tracer == nil {
+        return ctx, noSpan{}
+    }
+
+    return f.config.Tracer.Start(ctx, op, name)
+}
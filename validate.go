@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Content validation. Validators see the complete contents a file would have after
+ *  each write or append, before it is applied, and reject it by returning an error.
+ *  The caller receives a *ValidationError naming the file, which wraps the validator's
+ *  error and is also ErrRejected.
+ *
+ * Like hooks, validators run on the IO controller and must not call back into the
+ *  database. A slow validator, e.g. a malware scanner, holds up every other operation.
+ */
+
+import (
+    "bytes"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+/*
+ * `name` is the file being written, `data` its contents after the write and must not be
+ *  modified or retained
+ */
+type Validator func(name string, data []byte) error
+
+type ValidationError struct {
+    Path        string
+    Err         error
+}
+
+func (e *ValidationError) Error() string {
+    return ErrRejected.Error() + ": " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+    return e.Err
+}
+
+func (e *ValidationError) Is(target error) bool {
+    return target == ErrRejected
+}
+
+type validatorList struct {
+    lock        sync.RWMutex
+    validators  []*dirValidator
+}
+
+type dirValidator struct {
+    dir         string
+    validate    Validator
+}
+
+/*
+ * Validates the writes to every file whose name begins with `dir`, "/" for all of
+ *  them, in addition to DBConfig.Validators. The returned function removes it again
+ */
+func (f *FSHeader) AddValidator(dir string, v Validator) CancelFunc {
+    entry := &dirValidator{ dir: dir, validate: v }
+
+    f.validators.lock.Lock()
+    f.validators.validators = append(f.validators.validators, entry)
+    f.validators.lock.Unlock()
+
+    return func () {
+        f.validators.lock.Lock()
+        defer f.validators.lock.Unlock()
+
+        for i, v := range f.validators.validators {
+            if v == entry {
+                f.validators.validators = append(f.validators.validators[:i:i], f.validators.validators[i + 1:]...)
+                return
+            }
+        }
+    }
+}
+
+/*
+ * Rejects files larger than `max` bytes
+ */
+func MaxSizeValidator(max int) Validator {
+    return func(name string, data []byte) error {
+        if len(data) > max {
+            return retErrStr("file is larger than " + strconv.Itoa(max) + " bytes")
+        }
+        return nil
+    }
+}
+
+/*
+ * Rejects non-empty files which do not begin with one of `magic`, e.g. "\x89PNG"
+ */
+func MagicValidator(magic ...[]byte) Validator {
+    return func(name string, data []byte) error {
+        if len(data) == 0 {
+            return nil
+        }
+        for _, m := range magic {
+            if bytes.HasPrefix(data, m) {
+                return nil
+            }
+        }
+        return retErrStr("file content has an unexpected type")
+    }
+}
+
+func (f *FSHeader) initValidators() {
+    for _, v := range f.config.Validators {
+        f.validators.validators = append(f.validators.validators, &dirValidator{ dir: "/", validate: v })
+    }
+}
+
+/*
+ * Called by dispatch() for IRP_WRITE with file.lock held
+ */
+func (f *FSHeader) validateIRP(file *govfsFile, ioh *govfsIoBlock) error {
+    f.validators.lock.RLock()
+    validators := f.validators.validators
+    f.validators.lock.RUnlock()
+
+    var matched []Validator
+    for _, v := range validators {
+        if strings.HasPrefix(ioh.name, v.dir) {
+            matched = append(matched, v.validate)
+        }
+    }
+    if len(matched) == 0 {
+        return nil
+    }
+
+    var data = ioh.data
+    if (ioh.flags & FLAG_APPEND) > 0 {
+        existing, err := f.unsealData(file)
+        if err != nil {
+            return err
+        }
+        data = append(existing, ioh.data...)
+        if f.mem_cipher != nil || file.spill != nil {
+            defer wipeBuffer(data, false)
+        }
+    }
+
+    for _, v := range matched {
+        if err := v(ioh.name, data); err != nil {
+            return &ValidationError{ Path: ioh.name, Err: err }
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestValidators(t *testing.T) {
+    debugOut("[+] Running Content Validation Test...")
+
+    header, err := CreateDatabaseConfig("validate", FLAG_DB_CREATE,
+        &DBConfig{ Validators: []Validator{ MaxSizeValidator(8) } })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/a")
+    if err := header.Write("/a", []byte("12345")); err != nil {
+        drive_fail("TEST2: Valid write was rejected", t)
+    }
+
+    /* Appends are validated with the resulting contents */
+    err = header.Append("/a", []byte("6789"))
+    var rejected *ValidationError
+    if !errors.Is(err, ErrRejected) || !errors.As(err, &rejected) || rejected.Path != "/a" {
+        drive_fail("TEST3: Oversized append was not rejected", t)
+    }
+    if data, _ := header.Read("/a"); string(data) != "12345" {
+        drive_fail("TEST4: Rejected append was applied", t)
+    }
+
+    /* Validators for a subtree */
+    errInfected := errors.New("infected")
+    remove := header.AddValidator("/images/", MagicValidator([]byte("\x89PNG"), []byte("\xff\xd8\xff")))
+    header.AddValidator("/", func (name string, data []byte) error {
+        if string(data) == "EICAR" {
+            return errInfected
+        }
+        return nil
+    })
+    header.Create("/images/a.png")
+    if err := header.Write("/images/a.png", []byte("text")); !errors.Is(err, ErrRejected) {
+        drive_fail("TEST5: Magic bytes were not checked", t)
+    }
+    if err := header.Write("/images/a.png", []byte("\x89PNG..")); err != nil {
+        drive_fail("TEST6: Valid image was rejected", t)
+    }
+    if err := header.Write("/a", []byte("EICAR")); !errors.Is(err, errInfected) {
+        drive_fail("TEST7: Scanner error was not returned", t)
+    }
+
+    remove()
+    if err := header.Write("/images/a.png", []byte("text")); err != nil {
+        drive_fail("TEST8: Removed validator still ran", t)
+    }
+
+    debugOut("[+] Content Validation Test PASS")
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Change notification. Watch() delivers an Event for every successful create, write,
+ *  append, delete, shred and purge processed by the IO controller (or inline in
+ *  DBConfig.Direct mode), in the order they were applied.
+ *
+ * dispatch() never waits for a watcher: events are queued per watcher and delivered
+ *  by its own goroutine. If a watcher falls WATCH_QUEUE_SIZE events behind, the queued
+ *  events are dropped and replaced by one EVENT_OVERFLOW, after which the caller should
+ *  rescan whatever it caches.
+ */
+
+import (
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    WATCH_QUEUE_SIZE          int       = 4096
+    EVENT_OVERFLOW            string    = "overflow" /* Events were dropped, see above */
+)
+
+type Event struct {
+    Op          string /* LOG_CREATE, LOG_WRITE, LOG_APPEND, LOG_DELETE, LOG_SHRED, LOG_PURGE, LOG_XATTR, EVENT_OVERFLOW, or EVENT_CORRUPT and EVENT_REPAIRED from the scrubber */
+    Path        string /* "/" for LOG_PURGE and EVENT_OVERFLOW */
+    Size        int /* Bytes written */
+    Time        time.Time
+}
+
+/*
+ * Stops a Watch(), its channel is closed once the goroutine delivering it returns
+ */
+type CancelFunc func()
+
+type watchList struct {
+    lock        sync.Mutex
+    watchers    map[*watcher]struct{}
+    closed      bool /* Set by stopWatches() */
+}
+
+type watcher struct {
+    prefix      string
+    out         chan Event
+    lock        sync.Mutex
+    queue       []Event
+    wake        chan struct{}
+    done        chan struct{}
+    once        sync.Once
+}
+
+/*
+ * Delivers the events of every file whose name begins with `pathPrefix`, "" or "/" for
+ *  all of them. LOG_PURGE is delivered to every watcher. The channel is closed by the
+ *  CancelFunc, or when the database is closed.
+ */
+func (f *FSHeader) Watch(pathPrefix string) (<-chan Event, CancelFunc) {
+    w := &watcher{
+        prefix: pathPrefix,
+        out: make(chan Event),
+        wake: make(chan struct{}, 1),
+        done: make(chan struct{}),
+    }
+
+    f.watch.lock.Lock()
+    if f.watch.closed == true {
+        f.watch.lock.Unlock()
+        close(w.out)
+        return w.out, func () {}
+    }
+    if f.watch.watchers == nil {
+        f.watch.watchers = make(map[*watcher]struct{})
+    }
+    f.watch.watchers[w] = struct{}{}
+    f.watch.lock.Unlock()
+
+    go w.deliver()
+
+    return w.out, func () {
+        f.watch.lock.Lock()
+        delete(f.watch.watchers, w)
+        f.watch.lock.Unlock()
+        w.stop()
+    }
+}
+
+/*
+ * Called by dispatch() for every IRP it processed
+ */
+func (f *FSHeader) notifyIRP(ioh *govfsIoBlock) {
+    if ioh.status != nil {
+        return
+    }
+
+    op := irpOp(ioh)
+    if op == "" {
+        return
+    }
+
+    e := Event{ Op: op, Path: ioh.name, Size: len(ioh.data), Time: time.Now() }
+    if ioh.operation == IRP_PURGE {
+        e.Path = "/"
+    }
+    f.notifyEvent(e)
+}
+
+func (f *FSHeader) notifyEvent(e Event) {
+    f.watch.lock.Lock()
+    defer f.watch.lock.Unlock()
+
+    for w := range f.watch.watchers {
+        if e.Op == LOG_PURGE || strings.HasPrefix(e.Path, w.prefix) {
+            w.push(e)
+        }
+    }
+}
+
+/*
+ * Closes every watcher, called by Shutdown()
+ */
+func (f *FSHeader) stopWatches() {
+    f.watch.lock.Lock()
+    watchers := f.watch.watchers
+    f.watch.watchers = nil
+    f.watch.closed = true
+    f.watch.lock.Unlock()
+
+    for w := range watchers {
+        w.stop()
+    }
+}
+
+func (w *watcher) push(e Event) {
+    w.lock.Lock()
+    if len(w.queue) >= WATCH_QUEUE_SIZE {
+        w.queue = append(w.queue[:0], Event{ Op: EVENT_OVERFLOW, Path: "/", Time: e.Time })
+    }
+    w.queue = append(w.queue, e)
+    w.lock.Unlock()
+
+    select {
+    case w.wake <- struct{}{}:
+    default:
+    }
+}
+
+func (w *watcher) stop() {
+    w.once.Do(func () { close(w.done) })
+}
+
+func (w *watcher) deliver() {
+    defer close(w.out)
+
+    for {
+        w.lock.Lock()
+        if len(w.queue) == 0 {
+            w.lock.Unlock()
+            select {
+            case <-w.wake:
+                continue
+            case <-w.done:
+                return
+            }
+        }
+        e := w.queue[0]
+        w.queue[0] = Event{}
+        w.queue = w.queue[1:]
+        w.lock.Unlock()
+
+        select {
+        case w.out <- e:
+        case <-w.done:
+            return
+        }
+    }
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "strconv"
+    "testing"
+    "time"
+)
+
+func nextEvent(events <-chan Event, t *testing.T) Event {
+    select {
+    case e, ok := <-events:
+        if ok == false {
+            drive_fail("Watch channel was closed", t)
+        }
+        return e
+    case <-time.After(5 * time.Second):
+        drive_fail("Timed out waiting for an event", t)
+    }
+
+    return Event{}
+}
+
+func TestWatch(t *testing.T) {
+    debugOut("[+] Running Watch Test...")
+
+    header, err := CreateDatabaseConfig("watch", FLAG_DB_CREATE, nil)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    events, cancel := header.Watch("/docs/")
+    all, _ := header.Watch("")
+
+    header.Create("/other")
+    header.Create("/docs/a.txt")
+    header.Write("/docs/a.txt", []byte("hello"))
+    header.Append("/docs/a.txt", []byte("!"))
+    header.Write("/docs/missing", []byte("x")) /* Failures are not delivered */
+    header.Delete("/docs/a.txt")
+    header.Purge()
+
+    for i, want := range []Event{
+        { Op: LOG_CREATE, Path: "/docs/a.txt" },
+        { Op: LOG_WRITE, Path: "/docs/a.txt", Size: 5 },
+        { Op: LOG_APPEND, Path: "/docs/a.txt", Size: 1 },
+        { Op: LOG_DELETE, Path: "/docs/a.txt" },
+        { Op: LOG_PURGE, Path: "/" },
+    } {
+        e := nextEvent(events, t)
+        if e.Op != want.Op || e.Path != want.Path || e.Size != want.Size || e.Time.IsZero() {
+            drive_fail("TEST2: Unexpected event " + strconv.Itoa(i), t)
+        }
+    }
+    if e := nextEvent(all, t); e.Op != LOG_CREATE || e.Path != "/other" {
+        drive_fail("TEST3: Unfiltered watcher missed an event", t)
+    }
+
+    cancel()
+    cancel()
+    for range events {
+    }
+
+    /* A watcher which does not read is not waited for */
+    slow, _ := header.Watch("/")
+    header.Create("/flood")
+    for i := 0; i < WATCH_QUEUE_SIZE + 100; i++ {
+        header.Write("/flood", []byte("x"))
+    }
+    var overflow = false
+    for i := 0; i < 3; i++ {
+        if nextEvent(slow, t).Op == EVENT_OVERFLOW {
+            overflow = true
+        }
+    }
+    if overflow == false {
+        drive_fail("TEST4: Overflow was not reported", t)
+    }
+
+    /* Closing the database closes every watcher */
+    header.Close()
+    for range all {
+    }
+    for range slow {
+    }
+    closed, _ := header.Watch("")
+    if _, ok := <-closed; ok == true {
+        drive_fail("TEST5: Watch on a closed database delivered an event", t)
+    }
+
+    debugOut("[+] Watch Test PASS")
+}
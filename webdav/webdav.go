@@ -0,0 +1,430 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+
+/*
+ * Package webdav serves a govfs database over WebDAV, so that the Windows and macOS
+ *  clients can map it as a network drive without FUSE
+ */
+package webdav
+
+import (
+    "os"
+    "io"
+    "io/fs"
+    "path"
+    "time"
+    "errors"
+    "context"
+    "strings"
+
+    "github.com/AlexRuzin/govfs"
+    xwebdav "golang.org/x/net/webdav"
+)
+
+/*
+ * Furthest a write may start past the end of a file opened for writing. The gap is
+ *  allocated and zero filled, so a client must not be able to pick it freely
+ */
+const MAX_WRITE_GAP int64 = 16 << 20
+
+/*
+ * Returns a webdav.Handler serving hdr, with an in-memory lock system. Set Prefix on
+ *  the returned handler when it is not mounted at "/". Wrap it with
+ *  govfs.SessionHandler() to make the requests of each user as its principal
+ */
+func NewHandler(hdr *govfs.FSHeader) *xwebdav.Handler {
+    return &xwebdav.Handler{
+        FileSystem: NewFileSystem(hdr),
+        LockSystem: xwebdav.NewMemLS(),
+    }
+}
+
+/*
+ * Returns a webdav.FileSystem backed by hdr. Writes are buffered per open file and
+ *  stored when the file is closed. Every method is made as the principal of its
+ *  context, see govfs.WithPrincipal(). The IO controller must be running
+ */
+func NewFileSystem(hdr *govfs.FSHeader) xwebdav.FileSystem {
+    return &fileSystem{ hdr: hdr }
+}
+
+type fileSystem struct {
+    hdr         *govfs.FSHeader
+}
+
+/*
+ * Database path of a WebDAV name, e.g. "/dir/file". The root is "/"
+ */
+func clean(name string) string {
+    return path.Clean("/" + name)
+}
+
+/*
+ * fs.FS name of a database path, e.g. "dir/file". The root is "."
+ */
+func fsName(name string) string {
+    if name == "/" {
+        return "."
+    }
+
+    return name[1:]
+}
+
+func (v *fileSystem) stat(name string) (fs.FileInfo, error) {
+    return fs.Stat(v.hdr.FS(), fsName(name))
+}
+
+/*
+ * Fails with os.ErrNotExist unless the parent of name is a directory, or with the
+ *  error from Access() if names may not be created in it
+ */
+func (v *fileSystem) checkParent(ctx context.Context, op string, name string) error {
+    info, err := v.stat(path.Dir(name))
+    if err != nil || !info.IsDir() {
+        return &fs.PathError{ Op: op, Path: name, Err: fs.ErrNotExist }
+    }
+
+    return v.hdr.AccessCtx(ctx, path.Dir(name), govfs.ACCESS_WRITE)
+}
+
+func (v *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+    name = clean(name)
+    if _, err := v.stat(name); err == nil {
+        return &fs.PathError{ Op: "mkdir", Path: name, Err: fs.ErrExist }
+    }
+    if err := v.checkParent(ctx, "mkdir", name); err != nil {
+        return err
+    }
+
+    return v.hdr.CreateCtx(ctx, name + "/")
+}
+
+func (v *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (xwebdav.File, error) {
+    name = clean(name)
+    if flag & (os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_TRUNC | os.O_APPEND) == 0 {
+        file, err := v.hdr.FSCtx(ctx).Open(fsName(name))
+        if err != nil {
+            return nil, err
+        }
+
+        return &readFile{ File: file, name: name }, nil
+    }
+
+    info, err := v.stat(name)
+    exists := err == nil
+    switch {
+    case exists && info.IsDir():
+        return nil, &fs.PathError{ Op: "open", Path: name, Err: errors.New("is a directory") }
+    case exists && (flag & os.O_CREATE) > 0 && (flag & os.O_EXCL) > 0:
+        return nil, &fs.PathError{ Op: "open", Path: name, Err: fs.ErrExist }
+    case !exists && (flag & os.O_CREATE) == 0:
+        return nil, err
+    case exists:
+        if err := v.hdr.AccessCtx(ctx, name, writeMode(flag)); err != nil {
+            return nil, err
+        }
+    case !exists:
+        if err := v.checkParent(ctx, "open", name); err != nil {
+            return nil, err
+        }
+        if err := v.hdr.CreateCtx(ctx, name); err != nil {
+            return nil, err
+        }
+    }
+
+    file := &writeFile{ ctx: ctx, hdr: v.hdr, name: name, modtime: time.Now() }
+    if exists && (flag & os.O_TRUNC) == 0 {
+        if file.data, err = v.hdr.ReadCtx(ctx, name); err != nil {
+            return nil, err
+        }
+    }
+    file.truncated = exists && (flag & os.O_TRUNC) > 0 && info.Size() > 0
+    if (flag & os.O_APPEND) > 0 {
+        file.offset = int64(len(file.data))
+    }
+
+    return file, nil
+}
+
+/*
+ * Removes name and everything beneath it. Removing "/" purges the database. A file
+ *  and a directory of the same name are both removed
+ */
+func (v *fileSystem) RemoveAll(ctx context.Context, name string) error {
+    name = clean(name)
+    if name == "/" {
+        return v.hdr.PurgeCtx(ctx)
+    }
+    targets, err := v.removeTargets(ctx, name)
+    if err != nil {
+        return err
+    }
+
+    for _, target := range targets {
+        if err := v.hdr.DeleteCtx(ctx, target); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+/*
+ * Returns the names RemoveAll(name) deletes, failing before anything is deleted if
+ *  Access() denies any of them
+ */
+func (v *fileSystem) removeTargets(ctx context.Context, name string) ([]string, error) {
+    if _, err := v.stat(name); err != nil {
+        return nil, err
+    }
+
+    /* Implicitly created directories are keyed without the trailing "/", explicit ones with it */
+    var candidates = []string{ name, name + "/" }
+    list, _ := v.hdr.GetFileListDirectory(name + "/")
+    for _, child := range list {
+        if strings.HasPrefix(child, name + "/") && child != name + "/" {
+            candidates = append(candidates, child, strings.TrimSuffix(child, "/"))
+        }
+    }
+
+    var targets []string
+    var seen = make(map[string]bool)
+    for _, target := range candidates {
+        if seen[target] == true || v.hdr.Check(target) == false {
+            continue
+        }
+        seen[target] = true
+        if err := v.hdr.AccessCtx(ctx, target, govfs.ACCESS_DELETE); err != nil {
+            return nil, err
+        }
+        targets = append(targets, target)
+    }
+
+    return targets, nil
+}
+
+/*
+ * Access() mode needed to open an existing file with flag. Close() replaces the whole
+ *  file, even with os.O_APPEND, and unless truncated the current contents are read first
+ */
+func writeMode(flag int) govfs.AccessMode {
+    var mode = govfs.ACCESS_WRITE
+    if (flag & os.O_TRUNC) == 0 {
+        mode |= govfs.ACCESS_READ
+    }
+
+    return mode
+}
+
+/*
+ * Renames by copying oldName to newName and removing oldName, so a failure part of
+ *  the way through may leave both. newName must not exist
+ */
+func (v *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+    oldName, newName = clean(oldName), clean(newName)
+    if oldName == "/" || newName == "/" || strings.HasPrefix(newName, oldName + "/") {
+        return &os.LinkError{ Op: "rename", Old: oldName, New: newName, Err: fs.ErrInvalid }
+    }
+    if _, err := v.stat(oldName); err != nil {
+        return err
+    }
+    if _, err := v.stat(newName); err == nil {
+        return &os.LinkError{ Op: "rename", Old: oldName, New: newName, Err: fs.ErrExist }
+    }
+    if err := v.checkParent(ctx, "rename", newName); err != nil {
+        return err
+    }
+    if _, err := v.removeTargets(ctx, oldName); err != nil {
+        return err
+    }
+
+    err := fs.WalkDir(v.hdr.FSCtx(ctx), fsName(oldName), func (p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+
+        target := newName + strings.TrimPrefix("/" + p, oldName)
+        if d.IsDir() {
+            return v.hdr.CreateCtx(ctx, target + "/")
+        }
+
+        data, err := v.hdr.ReadCtx(ctx, "/" + p)
+        if err != nil {
+            return err
+        }
+        if err := v.hdr.CreateCtx(ctx, target); err != nil {
+            return err
+        }
+
+        return v.hdr.WriteCtx(ctx, target, data)
+    })
+    if err != nil {
+        return err
+    }
+
+    return v.RemoveAll(ctx, oldName)
+}
+
+func (v *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+    return v.stat(clean(name))
+}
+
+/*
+ * A file or directory opened read-only, a snapshot taken by the fs.FS adapter
+ */
+type readFile struct {
+    fs.File
+    name        string
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+    if seeker, ok := f.File.(io.Seeker); ok {
+        return seeker.Seek(offset, whence)
+    }
+
+    return 0, &fs.PathError{ Op: "seek", Path: f.name, Err: errors.New("is a directory") }
+}
+
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+    dir, ok := f.File.(fs.ReadDirFile)
+    if !ok {
+        return nil, &fs.PathError{ Op: "readdir", Path: f.name, Err: errors.New("not a directory") }
+    }
+
+    entries, err := dir.ReadDir(count)
+    output := make([]os.FileInfo, 0, len(entries))
+    for _, entry := range entries {
+        info, err := entry.Info()
+        if err != nil {
+            return output, err
+        }
+        output = append(output, info)
+    }
+
+    return output, err
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+    return 0, &fs.PathError{ Op: "write", Path: f.name, Err: fs.ErrPermission }
+}
+
+/*
+ * A file opened for writing. The contents are held in memory and written to the
+ *  database by Close()
+ */
+type writeFile struct {
+    ctx         context.Context
+    hdr         *govfs.FSHeader
+    name        string
+    data        []byte
+    offset      int64
+    modtime     time.Time
+    dirty       bool
+    truncated   bool /* O_TRUNC of a non-empty file */
+    closed      bool
+}
+
+func (f *writeFile) Read(p []byte) (int, error) {
+    if f.offset >= int64(len(f.data)) {
+        return 0, io.EOF
+    }
+
+    n := copy(p, f.data[f.offset:])
+    f.offset += int64(n)
+
+    return n, nil
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+    if f.closed == true {
+        return 0, fs.ErrClosed
+    }
+    if f.offset - int64(len(f.data)) > MAX_WRITE_GAP {
+        return 0, &fs.PathError{ Op: "write", Path: f.name, Err: errors.New("offset too far past the end of the file") }
+    }
+
+    end := f.offset + int64(len(p))
+    if end > int64(len(f.data)) {
+        grown := make([]byte, end)
+        copy(grown, f.data)
+        f.data = grown
+    }
+    copy(f.data[f.offset:], p)
+    f.offset = end
+    f.dirty = true
+
+    return len(p), nil
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+    switch whence {
+    case io.SeekStart:
+    case io.SeekCurrent:
+        offset += f.offset
+    case io.SeekEnd:
+        offset += int64(len(f.data))
+    default:
+        return 0, &fs.PathError{ Op: "seek", Path: f.name, Err: fs.ErrInvalid }
+    }
+    if offset < 0 {
+        return 0, &fs.PathError{ Op: "seek", Path: f.name, Err: fs.ErrInvalid }
+    }
+    f.offset = offset
+
+    return offset, nil
+}
+
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+    return nil, &fs.PathError{ Op: "readdir", Path: f.name, Err: errors.New("not a directory") }
+}
+
+func (f *writeFile) Stat() (os.FileInfo, error) {
+    return &fileInfo{ name: path.Base(f.name), size: int64(len(f.data)), modtime: f.modtime }, nil
+}
+
+func (f *writeFile) Close() error {
+    if f.closed == true {
+        return fs.ErrClosed
+    }
+    f.closed = true
+
+    if f.dirty == false && f.truncated == false {
+        return nil
+    }
+
+    return f.hdr.WriteCtx(f.ctx, f.name, f.data)
+}
+
+type fileInfo struct {
+    name        string
+    size        int64
+    modtime     time.Time
+}
+
+func (i *fileInfo) Name() string               { return i.name }
+func (i *fileInfo) Size() int64                { return i.size }
+func (i *fileInfo) Mode() fs.FileMode          { return 0644 }
+func (i *fileInfo) ModTime() time.Time         { return i.modtime }
+func (i *fileInfo) IsDir() bool                { return false }
+func (i *fileInfo) Sys() interface{}           { return nil }
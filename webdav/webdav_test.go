@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+
+package webdav
+
+import (
+    "io"
+    "os"
+    "context"
+    "bytes"
+    "strings"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+
+    "github.com/AlexRuzin/govfs"
+)
+
+func do(t *testing.T, method string, url string, body string, headers ...string) (int, string) {
+    req, err := http.NewRequest(method, url, strings.NewReader(body))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i + 1 < len(headers); i += 2 {
+        req.Header.Set(headers[i], headers[i + 1])
+    }
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    data, _ := io.ReadAll(resp.Body)
+
+    return resp.StatusCode, string(data)
+}
+
+func TestWebDAV(t *testing.T) {
+    header, err := govfs.CreateDatabase(filepath.Join(t.TempDir(), "test_webdav"), govfs.FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/docs/readme.txt")
+    header.Write("/docs/readme.txt", []byte("existing file"))
+
+    server := httptest.NewServer(NewHandler(header))
+    defer server.Close()
+
+    if code, body := do(t, "PROPFIND", server.URL + "/docs/", "", "Depth", "1"); code != http.StatusMultiStatus ||
+        !strings.Contains(body, "/docs/readme.txt") {
+        t.Fatalf("TEST2: PROPFIND returned %d: %s", code, body)
+    }
+
+    if code, _ := do(t, "MKCOL", server.URL + "/music/", ""); code != http.StatusCreated {
+        t.Fatalf("TEST3: MKCOL returned %d", code)
+    }
+    if code, _ := do(t, "MKCOL", server.URL + "/missing/child/", ""); code != http.StatusConflict {
+        t.Fatalf("TEST4: MKCOL without a parent returned %d", code)
+    }
+
+    if code, _ := do(t, "PUT", server.URL + "/music/song.mp3", "la la la"); code != http.StatusCreated {
+        t.Fatalf("TEST5: PUT returned %d", code)
+    }
+    if data, err := header.Read("/music/song.mp3"); err != nil || !bytes.Equal(data, []byte("la la la")) {
+        t.Fatal("TEST6: PUT did not write the file")
+    }
+    if code, body := do(t, "GET", server.URL + "/music/song.mp3", ""); code != http.StatusOK || body != "la la la" {
+        t.Fatalf("TEST7: GET returned %d: %s", code, body)
+    }
+
+    /* Overwriting with an empty body truncates, keeping the attributes */
+    header.SetXattr("/docs/readme.txt", "user.tag", "blue")
+    if code, _ := do(t, "PUT", server.URL + "/docs/readme.txt", ""); code != http.StatusCreated {
+        t.Fatalf("TEST8: PUT returned %d", code)
+    }
+    if size, _ := header.GetFileSize("/docs/readme.txt"); size != 0 || header.Check("/docs/readme.txt") == false {
+        t.Fatal("TEST9: PUT of an empty body did not truncate")
+    }
+    if tag, _ := header.GetXattr("/docs/readme.txt", "user.tag"); tag != "blue" {
+        t.Fatal("TEST9: PUT of an empty body lost the attributes")
+    }
+
+    if code, _ := do(t, "MOVE", server.URL + "/music/", "", "Destination", server.URL + "/archive/"); code != http.StatusCreated {
+        t.Fatalf("TEST10: MOVE returned %d", code)
+    }
+    if header.Check("/music/song.mp3") || !header.Check("/archive/song.mp3") {
+        t.Fatal("TEST11: MOVE did not move the directory")
+    }
+    if data, _ := header.Read("/archive/song.mp3"); !bytes.Equal(data, []byte("la la la")) {
+        t.Fatal("TEST12: MOVE lost the file contents")
+    }
+
+    if code, _ := do(t, "DELETE", server.URL + "/archive/", ""); code != http.StatusNoContent {
+        t.Fatalf("TEST13: DELETE returned %d", code)
+    }
+    if header.Check("/archive/song.mp3") || header.Check("/archive/") {
+        t.Fatal("TEST14: DELETE left files behind")
+    }
+    if code, _ := do(t, "GET", server.URL + "/archive/song.mp3", ""); code != http.StatusNotFound {
+        t.Fatalf("TEST15: GET of a deleted file returned %d", code)
+    }
+}
+
+func TestWebDAVAccess(t *testing.T) {
+    header, err := govfs.CreateDatabase(filepath.Join(t.TempDir(), "test_webdav_access"), govfs.FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+    header.Create("/logs/")
+    header.Create("/logs/today.txt")
+    header.Write("/logs/today.txt", []byte("today"))
+    header.CreateAppendOnly("/logs/audit.log", false)
+    header.Append("/logs/audit.log", []byte("entry"))
+
+    server := httptest.NewServer(NewHandler(header))
+    defer server.Close()
+
+    /* Access() denies replacing or removing an append-only file */
+    if code, _ := do(t, "PUT", server.URL + "/logs/audit.log", "forged"); code < 400 {
+        t.Fatalf("TEST2: PUT of an append-only file returned %d", code)
+    }
+    if code, _ := do(t, "DELETE", server.URL + "/logs/", ""); code < 400 {
+        t.Fatalf("TEST3: DELETE of a directory holding an append-only file returned %d", code)
+    }
+    if !header.Check("/logs/today.txt") {
+        t.Fatal("TEST4: A denied DELETE removed files")
+    }
+    if code, _ := do(t, "MOVE", server.URL + "/logs/", "", "Destination", server.URL + "/old/"); code < 400 {
+        t.Fatalf("TEST5: MOVE of a directory holding an append-only file returned %d", code)
+    }
+    if header.Check("/old/today.txt") {
+        t.Fatal("TEST6: A denied MOVE copied files")
+    }
+    if data, _ := header.Read("/logs/audit.log"); !bytes.Equal(data, []byte("entry")) {
+        t.Fatal("TEST7: The append-only file was modified")
+    }
+    if code, body := do(t, "GET", server.URL + "/logs/audit.log", ""); code != http.StatusOK || body != "entry" {
+        t.Fatalf("TEST8: GET returned %d: %s", code, body)
+    }
+}
+
+func TestWebDAVSession(t *testing.T) {
+    header, err := govfs.CreateDatabase(filepath.Join(t.TempDir(), "test_webdav_session"), govfs.FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+    header.Create("/home/")
+
+    handler := govfs.SessionHandler(NewHandler(header), func (r *http.Request) string {
+        return r.Header.Get("X-User")
+    })
+    server := httptest.NewServer(handler)
+    defer server.Close()
+
+    /* Files are created as, and owned by, the principal of the request */
+    if code, _ := do(t, "PUT", server.URL + "/home/alice.txt", "private", "X-User", "alice"); code != http.StatusCreated {
+        t.Fatalf("TEST2: PUT returned %d", code)
+    }
+    if owner, _ := header.Owner("/home/alice.txt"); owner != "alice" {
+        t.Fatalf("TEST3: PUT created a file owned by %q", owner)
+    }
+    header.SetACL("/home/alice.txt", []govfs.ACLEntry{ { Principal: "alice", Allow: govfs.ACCESS_READ | govfs.ACCESS_WRITE } })
+
+    if code, body := do(t, "GET", server.URL + "/home/alice.txt", "", "X-User", "alice"); code != http.StatusOK || body != "private" {
+        t.Fatalf("TEST4: GET of the owner returned %d: %s", code, body)
+    }
+    if code, _ := do(t, "GET", server.URL + "/home/alice.txt", "", "X-User", "bob"); code < 400 {
+        t.Fatalf("TEST5: GET denied by the ACL returned %d", code)
+    }
+    if code, _ := do(t, "PUT", server.URL + "/home/alice.txt", "forged", "X-User", "bob"); code < 400 {
+        t.Fatalf("TEST6: PUT denied by the ACL returned %d", code)
+    }
+    if code, _ := do(t, "DELETE", server.URL + "/home/alice.txt", "", "X-User", "alice"); code < 400 {
+        t.Fatalf("TEST7: DELETE denied by the ACL returned %d", code)
+    }
+    if data, _ := header.Read("/home/alice.txt"); !bytes.Equal(data, []byte("private")) {
+        t.Fatal("TEST8: A denied request changed the file")
+    }
+}
+
+func TestWebDAVWriteGap(t *testing.T) {
+    header, err := govfs.CreateDatabase(filepath.Join(t.TempDir(), "test_webdav_gap"), govfs.FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        t.Fatal("TEST1: Failed to create database")
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    file, err := NewFileSystem(header).OpenFile(context.Background(), "/sparse.bin", os.O_RDWR | os.O_CREATE, 0644)
+    if err != nil {
+        t.Fatal("TEST2: OpenFile failed")
+    }
+    file.Seek(MAX_WRITE_GAP, io.SeekStart)
+    if _, err := file.Write([]byte("x")); err != nil {
+        t.Fatal("TEST3: Write within MAX_WRITE_GAP failed")
+    }
+    file.Seek(1 << 40, io.SeekStart)
+    if _, err := file.Write([]byte("x")); err == nil {
+        t.Fatal("TEST4: Write far past the end of the file succeeded")
+    }
+    if err := file.Close(); err != nil {
+        t.Fatal("TEST5: Close failed")
+    }
+    if size, _ := header.GetFileSize("/sparse.bin"); size != uint(MAX_WRITE_GAP + 1) {
+        t.Fatal("TEST6: The rejected write changed the file")
+    }
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "os"
+    "io"
+    "context"
+    "crypto/rand"
+)
+
+const WIPE_BLOCK_SIZE         int       = 64 * 1024
+
+/*
+ * Deletes a file and destroys its contents. The in-memory data is overwritten with random
+ *  bytes and then zeroed, and the next commit overwrites the previous raw fs file in
+ *  place once the new one is written, so the file cannot be recovered from either the
+ *  heap or the disk.
+ */
+func (f *FSHeader) Shred(name string) error {
+    return f.ShredCtx(context.Background(), name)
+}
+
+/*
+ * Shred() which is made as DeleteCtx(): buffered writes of the file are discarded, and
+ *  it is traced as a delete
+ */
+func (f *FSHeader) ShredCtx(ctx context.Context, name string) error {
+    return f.deleteCtx(ctx, name, FLAG_SHRED)
+}
+
+/*
+ * Zeroes a data buffer in place. If `random` is set, the buffer is first overwritten
+ *  with random data
+ */
+func wipeBuffer(data []byte, random bool) {
+    if len(data) == 0 {
+        return
+    }
+
+    if random == true {
+        io.ReadFull(rand.Reader, data)
+    }
+
+    for i := range data {
+        data[i] = 0
+    }
+}
+
+/*
+ * Overwrites the entire contents of an existing file with zeroes and flushes it to the disk
+ */
+func overwriteFile(name string) error {
+    file, err := os.OpenFile(name, os.O_WRONLY, 0)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    info, err := file.Stat()
+    if err != nil {
+        return err
+    }
+
+    zero := make([]byte, WIPE_BLOCK_SIZE)
+    for remaining := info.Size(); remaining > 0; {
+        block := int64(len(zero))
+        if remaining < block {
+            block = remaining
+        }
+
+        if _, err := file.Write(zero[:block]); err != nil {
+            return err
+        }
+        remaining -= block
+    }
+
+    return file.Sync()
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package govfs
+
+import (
+    "io"
+    "testing"
+    "os"
+    "bytes"
+    "sync/atomic"
+)
+
+func TestShred(t *testing.T) {
+    debugOut("[+] Running Secure Wipe Test...")
+
+    var filename = gen_raw_filename("test_shred")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    secret := []byte("top secret contents")
+    header.Create("/secret")
+    header.Write("/secret", secret)
+    header.Create("/deleted")
+    header.Write("/deleted", secret)
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST2: Failed to commit database", t)
+    }
+
+    /* Keep a reference to the underlying buffers to verify that they are wiped */
+    shredded := header.check("/secret").data
+    deleted := header.check("/deleted").data
+
+    if err := header.Shred("/secret"); err != nil {
+        drive_fail("TEST3: Failed to shred file", t)
+    }
+    if err := header.Delete("/deleted"); err != nil {
+        drive_fail("TEST3.1: Failed to delete file", t)
+    }
+    if header.Check("/secret") || header.Check("/deleted") {
+        drive_fail("TEST4: Shredded file still exists", t)
+    }
+    if !bytes.Equal(shredded, make([]byte, len(secret))) || !bytes.Equal(deleted, make([]byte, len(secret))) {
+        drive_fail("TEST5: Data buffer was not zeroed", t)
+    }
+    if err := header.Shred("/secret"); err == nil {
+        drive_fail("TEST5.1: Shredded a nonexistent file", t)
+    }
+
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST6: Failed to commit database", t)
+    }
+    raw, _ := os.ReadFile(filename)
+    if bytes.Contains(raw, secret) {
+        drive_fail("TEST7: Shredded data is still present in the raw fs file", t)
+    }
+
+    /* A plain delete leaves the previous raw fs file to be replaced by the rename */
+    header.Create("/plain")
+    header.Delete("/plain")
+    if atomic.LoadInt32(&header.wipe_stale) != 0 {
+        drive_fail("TEST8: Delete() marked the raw fs file to be wiped", t)
+    }
+
+    /* The previous raw fs file is zeroed in place, once the new one is written */
+    header.Create("/secret")
+    header.Write("/secret", secret)
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST9: Failed to commit database", t)
+    }
+    previous, err := os.Open(filename)
+    if err != nil {
+        drive_fail("TEST9.1: Failed to open the raw fs file", t)
+    }
+    defer previous.Close()
+    header.Shred("/secret")
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST10: Failed to commit database", t)
+    }
+    old, _ := io.ReadAll(previous)
+    if len(old) == 0 || bytes.Equal(old, make([]byte, len(old))) == false {
+        drive_fail("TEST11: The previous raw fs file was not zeroed", t)
+    }
+    if loaded, err := CreateDatabase(filename, FLAG_DB_LOAD); err != nil || loaded.Check("/secret") == true {
+        drive_fail("TEST12: Failed to load the database after the wipe", t)
+    }
+
+    debugOut("[+] Secure Wipe Test PASS")
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+const WRITEBACK_DEFAULT_DELAY time.Duration = 100 * time.Millisecond
+
+/*
+ * Optional write-back cache in front of the IO controller, enabled by setting
+ *  DBConfig.WriteBackSize. Writes and appends smaller than WriteBackSize are buffered
+ *  per file, and sent as a single IRP once WriteBackSize bytes are pending for the
+ *  file, after WriteBackDelay, or on Sync(). Reads of a file flush it first.
+ */
+type writeBack struct {
+    lock        sync.Mutex /* Guards pending, timer and err */
+    flush_lock  sync.Mutex /* Keeps flushed IRPs in submission order */
+    pending     map[string]*pendingWrite
+    timer       *time.Timer
+    err         error /* First error from a background flush, returned by Sync() */
+}
+
+type pendingWrite struct {
+    data        []byte
+    replace     bool /* data replaces the file contents, rather than being appended */
+}
+
+func newWriteBack() *writeBack {
+    return &writeBack{
+        pending: make(map[string]*pendingWrite),
+    }
+}
+
+/*
+ * Appends `d` to the contents of a file
+ */
+func (f *FSHeader) Append(name string, d []byte) error {
+    return f.AppendCtx(context.Background(), name, d)
+}
+
+func (f *FSHeader) AppendCtx(ctx context.Context, name string, d []byte) (err error) {
+    ctx, span := f.trace(ctx, TRACE_APPEND, name)
+    defer func () { span.End(len(d), err) }()
+
+    if f.wb != nil {
+        /* Each record of a chain is framed against the one before it, so is not buffered */
+        if len(d) < f.config.WriteBackSize && f.isChained(name) == false && f.buffersSession(ctx) == true {
+            return f.bufferWrite(name, d, false)
+        }
+
+        /* The buffered data must be written first */
+        f.wb.flush_lock.Lock()
+        defer f.wb.flush_lock.Unlock()
+        if err := f.flushPathLocked(name); err != nil {
+            return err
+        }
+    }
+
+    irp, err := f.writeIRP(name, d, false)
+    if err != nil {
+        return err
+    }
+    irp.flags |= FLAG_APPEND
+
+    output_irp, err := f.submitCtx(ctx, irp)
+    if err != nil {
+        return err
+    }
+
+    return output_irp.status
+}
+
+/*
+ * Sends all buffered writes to the IO controller and waits for them to complete
+ */
+func (f *FSHeader) Sync() error {
+    if f.wb == nil {
+        return nil
+    }
+
+    f.wb.flush_lock.Lock()
+    defer f.wb.flush_lock.Unlock()
+
+    f.wb.lock.Lock()
+    pending := f.wb.pending
+    f.wb.pending = make(map[string]*pendingWrite)
+    if f.wb.timer != nil {
+        f.wb.timer.Stop()
+        f.wb.timer = nil
+    }
+    status := f.wb.err
+    f.wb.err = nil
+    f.wb.lock.Unlock()
+
+    for name, p := range pending {
+        if err := f.flushWrite(name, p); err != nil && status == nil {
+            status = err
+        }
+    }
+
+    return status
+}
+
+func (f *FSHeader) bufferWrite(name string, d []byte, replace bool) error {
+    if f.isClosed() {
+        return ErrClosed
+    }
+    if f.check(name) == nil {
+        return pathError("write", name, ErrNotExist)
+    }
+
+    f.wb.lock.Lock()
+    p := f.wb.pending[name]
+    if p == nil || replace == true {
+        p = &pendingWrite{ replace: replace }
+        f.wb.pending[name] = p
+    }
+    p.data = append(p.data, d...)
+    full := len(p.data) >= f.config.WriteBackSize
+    if full == false && f.wb.timer == nil {
+        delay := f.config.WriteBackDelay
+        if delay <= 0 {
+            delay = WRITEBACK_DEFAULT_DELAY
+        }
+        f.wb.timer = time.AfterFunc(delay, f.backgroundSync)
+    }
+    f.wb.lock.Unlock()
+
+    if full == true {
+        return f.syncPath(name)
+    }
+
+    return nil
+}
+
+func (f *FSHeader) backgroundSync() {
+    f.wb.lock.Lock()
+    f.wb.timer = nil
+    f.wb.lock.Unlock()
+
+    if err := f.Sync(); err != nil {
+        f.wb.lock.Lock()
+        if f.wb.err == nil {
+            f.wb.err = err
+        }
+        f.wb.lock.Unlock()
+    }
+}
+
+/*
+ * Flushes the buffered writes of a single file
+ */
+func (f *FSHeader) syncPath(name string) error {
+    if f.wb == nil {
+        return nil
+    }
+
+    f.wb.flush_lock.Lock()
+    defer f.wb.flush_lock.Unlock()
+
+    return f.flushPathLocked(name)
+}
+
+/*
+ * syncPath() for callers which already hold flush_lock
+ */
+func (f *FSHeader) flushPathLocked(name string) error {
+    f.wb.lock.Lock()
+    p := f.wb.pending[name]
+    delete(f.wb.pending, name)
+    f.wb.lock.Unlock()
+
+    if p == nil {
+        return nil
+    }
+
+    return f.flushWrite(name, p)
+}
+
+/*
+ * Drops the buffered writes of a file which is being deleted or replaced. Must be
+ *  called with flush_lock held, so that an in-progress flush cannot land afterwards
+ */
+func (f *FSHeader) discardPath(name string) {
+    if f.wb == nil || f.isAppendOnly(name) == true {
+        /* The IO controller rejects the delete or replace of an append-only file */
+        return
+    }
+
+    f.wb.lock.Lock()
+    delete(f.wb.pending, name)
+    f.wb.lock.Unlock()
+}
+
+func (f *FSHeader) flushWrite(name string, p *pendingWrite) error {
+    irp, err := f.writeIRP(name, p.data, true)
+    if err != nil {
+        return err
+    }
+    if p.replace == false {
+        irp.flags |= FLAG_APPEND
+    }
+
+    output_irp, err := f.submit(irp)
+    if err != nil {
+        return err
+    }
+
+    return output_irp.status
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "testing"
+    "os"
+    "time"
+    "bytes"
+    "strconv"
+)
+
+func TestAppend(t *testing.T) {
+    debugOut("[+] Running Append Test...")
+
+    var filename = gen_raw_filename("test_append")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/log")
+    header.Write("/log", []byte("line0\n"))
+    if err := header.Append("/log", []byte("line1\n")); err != nil {
+        drive_fail("TEST2: Failed to append to file", t)
+    }
+    if output, _ := header.Read("/log"); string(output) != "line0\nline1\n" {
+        drive_fail("TEST3: Data mismatch after append", t)
+    }
+    if err := header.Append("/missing", []byte("line")); err == nil {
+        drive_fail("TEST4: Appended to a nonexistent file", t)
+    }
+
+    debugOut("[+] Append Test PASS")
+}
+
+func TestWriteBack(t *testing.T) {
+    debugOut("[+] Running Write-Back Cache Test...")
+
+    var filename = gen_raw_filename("test_writeback")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ WriteBackSize: 1024, WriteBackDelay: time.Hour }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    if err := header.StartIOController(); err != nil {
+        drive_fail("TEST1.1: Failed to start IOController", t)
+    }
+
+    header.Create("/log")
+    var expected bytes.Buffer
+    for i := 0; i < 10; i += 1 {
+        line := []byte("line" + strconv.Itoa(i) + "\n")
+        expected.Write(line)
+        if err := header.Append("/log", line); err != nil {
+            drive_fail("TEST2: Failed to append to file", t)
+        }
+    }
+
+    /* Nothing has been sent to the IO controller yet */
+    if header.check("/log").size != 0 {
+        drive_fail("TEST3: Small appends were not buffered", t)
+    }
+    if err := header.Sync(); err != nil {
+        drive_fail("TEST4: Sync() failed", t)
+    }
+    if header.check("/log").size != expected.Len() {
+        drive_fail("TEST5: Sync() did not flush buffered appends", t)
+    }
+
+    /* Reads see buffered writes, and a write replaces buffered appends */
+    header.Append("/log", []byte("dropped"))
+    header.Write("/log", []byte("replaced "))
+    header.Append("/log", []byte("appended"))
+    if output, _ := header.Read("/log"); string(output) != "replaced appended" {
+        drive_fail("TEST6: Data mismatch after buffered write", t)
+    }
+
+    /* Reaching WriteBackSize flushes the file */
+    header.Write("/log", nil)
+    chunk := bytes.Repeat([]byte("x"), 600)
+    header.Append("/log", chunk)
+    header.Append("/log", chunk)
+    if header.check("/log").size < 2 * len(chunk) {
+        drive_fail("TEST7: Buffered appends were not flushed at WriteBackSize", t)
+    }
+
+    /* Deleting a file drops its buffered writes */
+    header.Create("/deleted")
+    header.Write("/deleted", []byte("deleted"))
+    if err := header.Delete("/deleted"); err != nil {
+        drive_fail("TEST8: Failed to delete file", t)
+    }
+    if err := header.Sync(); err != nil {
+        drive_fail("TEST8.1: Sync() failed after delete", t)
+    }
+
+    /* As does shredding it */
+    header.Create("/shredded")
+    header.Write("/shredded", []byte("shredded"))
+    if err := header.Shred("/shredded"); err != nil {
+        drive_fail("TEST8.2: Failed to shred file", t)
+    }
+    if err := header.Sync(); err != nil || header.Check("/shredded") == true {
+        drive_fail("TEST8.3: Buffered write of a shredded file was flushed", t)
+    }
+
+    header.Create("/pending")
+    header.Write("/pending", []byte("pending"))
+    if err := header.Shutdown(true, 0); err != nil {
+        drive_fail("TEST9: Failed to shut down database", t)
+    }
+
+    loaded, err := CreateDatabase(filename, FLAG_DB_LOAD)
+    if loaded == nil || err != nil {
+        drive_fail("TEST10: Failed to load database", t)
+    }
+    if output, _ := loaded.Read("/pending"); string(output) != "pending" {
+        drive_fail("TEST11: Buffered write was lost on Shutdown()", t)
+    }
+
+    debugOut("[+] Write-Back Cache Test PASS")
+}
+
+func TestWriteBackDelay(t *testing.T) {
+    debugOut("[+] Running Write-Back Delay Test...")
+
+    var filename = gen_raw_filename("test_writeback_delay")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    config := &DBConfig{ WriteBackSize: 1024, WriteBackDelay: 10 * time.Millisecond }
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, config)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    header.Create("/log")
+    header.Append("/log", []byte("line"))
+
+    file := header.check("/log")
+    flushed := func () bool {
+        file.lock.Lock()
+        defer file.lock.Unlock()
+        return file.size > 0
+    }
+
+    deadline := time.Now().Add(5 * time.Second)
+    for !flushed() {
+        if time.Now().After(deadline) {
+            drive_fail("TEST2: Buffered append was not flushed after WriteBackDelay", t)
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+
+    debugOut("[+] Write-Back Delay Test PASS")
+}
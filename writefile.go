@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Create and write with a policy for an existing or missing target. Create() fails if
+ *  the file exists and Write() if it does not; WriteFile() and CreateFile() take per-call
+ *  options instead, so that e.g. "create or replace" is a single call rather than a
+ *  Create() whose ErrExist is ignored. The check and the create are serialized with
+ *  Create() of the same name, see lockPath().
+ */
+
+import (
+    "errors"
+    "context"
+    "strconv"
+)
+
+/*
+ * What WriteFile() and CreateFile() do if the file exists
+ */
+type ExistPolicy int
+const (
+    EXIST_FAIL                ExistPolicy = iota /* Fail with ErrExist */
+    EXIST_OVERWRITE           /* Replace the contents */
+    EXIST_VERSION             /* Keep the contents as a version, see VersionName(), then replace them */
+)
+
+/*
+ * What WriteFile() and CreateFile() do if the file is missing
+ */
+type MissingPolicy int
+const (
+    MISSING_CREATE            MissingPolicy = iota /* Create the file */
+    MISSING_FAIL              /* Fail with ErrNotExist */
+)
+
+type WriteOption func (o *writeOptions)
+
+type writeOptions struct {
+    exist       ExistPolicy
+    missing     MissingPolicy
+}
+
+func OnExist(policy ExistPolicy) WriteOption {
+    return func (o *writeOptions) {
+        o.exist = policy
+    }
+}
+
+func OnMissing(policy MissingPolicy) WriteOption {
+    return func (o *writeOptions) {
+        o.missing = policy
+    }
+}
+
+/*
+ * Returns the name of the version `n` of a file kept by EXIST_VERSION, e.g. "/a.txt.~1~"
+ */
+func VersionName(name string, n int) string {
+    return name + ".~" + strconv.Itoa(n) + "~"
+}
+
+/*
+ * Sets the contents of the file `name` to `d`. By default the file is created if it is
+ *  missing and its contents are replaced if it exists, see OnExist() and OnMissing()
+ */
+func (f *FSHeader) WriteFile(name string, d []byte, opts ...WriteOption) error {
+    return f.WriteFileCtx(context.Background(), name, d, opts...)
+}
+
+func (f *FSHeader) WriteFileCtx(ctx context.Context, name string, d []byte, opts ...WriteOption) error {
+    o := writeOptions{ exist: EXIST_OVERWRITE, missing: MISSING_CREATE }
+    for _, opt := range opts {
+        opt(&o)
+    }
+
+    return f.writeFile(ctx, name, d, &o)
+}
+
+/*
+ * Creates the empty file or directory `name`. By default it fails with ErrExist as
+ *  Create() does, see OnExist(); EXIST_OVERWRITE and EXIST_VERSION empty an existing file
+ */
+func (f *FSHeader) CreateFile(name string, opts ...WriteOption) error {
+    o := writeOptions{ exist: EXIST_FAIL, missing: MISSING_CREATE }
+    for _, opt := range opts {
+        opt(&o)
+    }
+
+    return f.writeFile(context.Background(), name, nil, &o)
+}
+
+func (f *FSHeader) writeFile(ctx context.Context, name string, d []byte, o *writeOptions) error {
+    if f.isClosed() {
+        return ErrClosed
+    }
+    if err := f.syncPath(name); err != nil {
+        return err
+    }
+
+    unlock := f.lockPath(name)
+    defer unlock()
+
+    file := f.check(name)
+    if file == nil {
+        if o.missing == MISSING_FAIL {
+            return pathError("write", name, ErrNotExist)
+        }
+        if err := f.createLocked(ctx, name); err != nil {
+            return err
+        }
+        if len(d) == 0 {
+            return nil
+        }
+        return f.WriteCtx(ctx, name, d)
+    }
+
+    switch o.exist {
+    case EXIST_FAIL:
+        return pathError("create", name, ErrExist)
+    case EXIST_VERSION:
+        if (file.flags & FLAG_DIRECTORY) > 0 {
+            return pathError("write", name, ErrIsDirectory)
+        }
+        if f.isAppendOnly(name) == true {
+            return pathError("write", name, ErrAppendOnly)
+        }
+        if err := f.keepVersion(ctx, name); err != nil {
+            return err
+        }
+    }
+
+    if len(d) == 0 && (file.flags & FLAG_DIRECTORY) > 0 {
+        return nil /* CreateFile() of an existing directory */
+    }
+    return f.WriteCtx(ctx, name, d)
+}
+
+/*
+ * Copies the contents of `name` to the lowest VersionName() which does not exist. The
+ *  version is not path locked, as its lock may be that of `name`
+ */
+func (f *FSHeader) keepVersion(ctx context.Context, name string) error {
+    data, err := f.ReadCtx(ctx, name)
+    if err != nil {
+        return err
+    }
+
+    for n := 1; ; n++ {
+        version := VersionName(name, n)
+        if f.check(version) != nil {
+            continue
+        }
+
+        err := f.createLocked(ctx, version)
+        if errors.Is(err, ErrExist) == true {
+            continue
+        }
+        if err != nil {
+            return err
+        }
+        if len(data) == 0 {
+            return nil
+        }
+        return f.WriteCtx(ctx, version, data)
+    }
+}
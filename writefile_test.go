@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "os"
+    "context"
+    "bytes"
+    "errors"
+    "testing"
+)
+
+func TestWriteFile(t *testing.T) {
+    debugOut("[+] Running WriteFile Policy Test...")
+
+    var filename = gen_raw_filename("test_write_file")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    /* Create or replace by default */
+    if err := header.WriteFile("/a", []byte("first")); err != nil {
+        drive_fail("TEST2: Failed to create a missing file", t)
+    }
+    if err := header.WriteFile("/a", []byte("second")); err != nil {
+        drive_fail("TEST3: Failed to overwrite a file", t)
+    }
+    if output, _ := header.Read("/a"); !bytes.Equal(output, []byte("second")) {
+        drive_fail("TEST4: Data mismatch after overwrite", t)
+    }
+
+    if err := header.WriteFile("/a", []byte("x"), OnExist(EXIST_FAIL)); errors.Is(err, ErrExist) == false {
+        drive_fail("TEST5: EXIST_FAIL overwrote a file", t)
+    }
+    if err := header.WriteFile("/b", []byte("x"), OnMissing(MISSING_FAIL)); errors.Is(err, ErrNotExist) == false ||
+        header.Check("/b") == true {
+        drive_fail("TEST6: MISSING_FAIL created a file", t)
+    }
+
+    /* Versions */
+    if err := header.WriteFile("/a", []byte("third"), OnExist(EXIST_VERSION)); err != nil {
+        drive_fail("TEST7: Failed to version a file", t)
+    }
+    if err := header.WriteFile("/a", []byte("fourth"), OnExist(EXIST_VERSION)); err != nil {
+        drive_fail("TEST8: Failed to version a file", t)
+    }
+    first, _ := header.Read(VersionName("/a", 1))
+    second, _ := header.Read(VersionName("/a", 2))
+    current, _ := header.Read("/a")
+    if string(first) != "second" || string(second) != "third" || string(current) != "fourth" {
+        drive_fail("TEST9: Versions mismatch", t)
+    }
+
+    /* CreateFile */
+    if err := header.CreateFile("/a"); errors.Is(err, ErrExist) == false {
+        drive_fail("TEST10: CreateFile of an existing file succeeded", t)
+    }
+    if err := header.CreateFile("/c"); err != nil || header.Check("/c") == false {
+        drive_fail("TEST11: CreateFile failed", t)
+    }
+    if err := header.CreateFile("/a", OnExist(EXIST_OVERWRITE)); err != nil {
+        drive_fail("TEST12: CreateFile failed to empty a file", t)
+    }
+    if output, _ := header.Read("/a"); len(output) != 0 {
+        drive_fail("TEST13: CreateFile did not empty the file", t)
+    }
+
+    /* Directories */
+    header.Create("/dir/")
+    if err := header.WriteFile("/dir/", []byte("x"), OnExist(EXIST_VERSION)); errors.Is(err, ErrIsDirectory) == false {
+        drive_fail("TEST14: Versioned a directory", t)
+    }
+}
+
+func TestTruncate(t *testing.T) {
+    debugOut("[+] Running Truncate Test...")
+
+    var filename = gen_raw_filename("test_truncate")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabase(filename, FLAG_DB_CREATE)
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+    defer header.Close()
+
+    ctx := WithPrincipal(context.Background(), "alice")
+    if err := header.CreateCtx(ctx, "/a"); err != nil {
+        drive_fail("TEST2: Failed to create a file", t)
+    }
+    header.WriteCtx(ctx, "/a", []byte("contents"))
+    header.SetXattr("/a", "user.tag", "blue")
+    header.SetACL("/a", []ACLEntry{ { Principal: "alice", Allow: ACCESS_READ | ACCESS_WRITE } })
+
+    /* An empty write truncates the file in place */
+    if err := header.WriteCtx(ctx, "/a", nil); err != nil {
+        drive_fail("TEST3: Failed to truncate a file", t)
+    }
+    if output, err := header.Read("/a"); err != nil || len(output) != 0 || header.GetTotalFilesizes() != 0 {
+        drive_fail("TEST4: Write of nothing did not truncate the file", t)
+    }
+    tag, _ := header.GetXattr("/a", "user.tag")
+    owner, _ := header.Owner("/a")
+    acl, _ := header.ACL("/a")
+    if tag != "blue" || owner != "alice" || len(acl) != 1 {
+        drive_fail("TEST5: Truncate lost the attributes of the file", t)
+    }
+
+    /* Even of an empty file, an empty write is a write */
+    before, _ := header.Stat("/a")
+    if gen, err := header.WriteGeneration("/a", nil); err != nil || gen != before.Generation + 1 {
+        drive_fail("TEST5.1: Empty write did not advance the generation", t)
+    }
+
+    /* As do WriteFile() and CreateFile() */
+    header.Write("/a", []byte("again"))
+    if err := header.CreateFile("/a", OnExist(EXIST_OVERWRITE)); err != nil {
+        drive_fail("TEST6: CreateFile failed to empty a file", t)
+    }
+    if size, _ := header.GetFileSize("/a"); size != 0 {
+        drive_fail("TEST7: CreateFile did not empty the file", t)
+    }
+    if tag, _ := header.GetXattr("/a", "user.tag"); tag != "blue" {
+        drive_fail("TEST8: CreateFile lost the attributes of the file", t)
+    }
+}
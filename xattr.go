@@ -0,0 +1,467 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+/*
+ * Extended attributes and tags. Attributes are name/value strings kept with every file
+ *  and directory, committed with its header, and changed through the IO controller like
+ *  any other mutation, so that they are audited, hooked, watched and replicated. Tags are
+ *  the attribute TAGS_XATTR, a sorted list which Find() queries
+ */
+
+import (
+    "sort"
+    "strings"
+    "unicode"
+)
+
+const (
+    XATTR_MAX_NAME            int       = 255
+    XATTR_MAX_VALUE           int       = 64 * 1024
+    TAGS_XATTR                string    = "govfs.tags" /* Tags of the file, separated by TAG_SEPARATOR */
+    TAG_SEPARATOR             string    = ","
+)
+
+/*
+ * Sets the attribute `attr` of a file or directory to `value`
+ */
+func (f *FSHeader) SetXattr(name string, attr string, value string) error {
+    if len(attr) == 0 || len(attr) > XATTR_MAX_NAME {
+        return pathError("setxattr", name, retErrStr("Invalid attribute name"))
+    }
+    if len(value) > XATTR_MAX_VALUE {
+        return pathError("setxattr", name, retErrStr("Attribute value is too long"))
+    }
+    if attr == ACL_XATTR {
+        if _, err := parseACL(value); err != nil {
+            return pathError("setxattr", name, err)
+        }
+    }
+
+    return f.submitXattr(name, attr, []byte(value), 0)
+}
+
+/*
+ * Removes the attribute `attr`, ErrNoAttribute if it is not set
+ */
+func (f *FSHeader) RemoveXattr(name string, attr string) error {
+    return f.submitXattr(name, attr, nil, FLAG_REMOVE_XATTR)
+}
+
+func (f *FSHeader) submitXattr(name string, attr string, value []byte, flags FlagVal) error {
+    if f.isClosed() {
+        return ErrClosed
+    }
+
+    file := f.check(name)
+    if file == nil && f.hasHooks() == false {
+        return pathError("setxattr", name, ErrNotExist) /* A hook may rewrite the name, see resolveIRP() */
+    }
+
+    irp := &govfsIoBlock{
+        file: file,
+        name: name,
+        attr: attr,
+        data: value,
+        flags: flags,
+        io_out: make(chan *govfsIoBlock, 1),
+        operation: IRP_XATTR,
+    }
+
+    output_irp, err := f.submit(irp)
+    if err != nil {
+        return err
+    }
+
+    return output_irp.status
+}
+
+/*
+ * Applies IRP_XATTR, called by dispatch()
+ */
+func (f *FSHeader) setXattr(ioh *govfsIoBlock) error {
+    i := f.check(ioh.name)
+    if i == nil {
+        return pathError("setxattr", ioh.name, ErrNotExist)
+    }
+    if i.filename == "/" {
+        return retErrStr("IRP_XATTR: The root has no attributes")
+    }
+
+    if (ioh.flags & FLAG_REMOVE_XATTR) > 0 {
+        i.lock.Lock()
+        _, ok := i.xattrs[ioh.attr]
+        i.lock.Unlock()
+        if ok == false {
+            return pathError("removexattr", ioh.name, ErrNoAttribute)
+        }
+    }
+
+    /* An explicitly created directory is also keyed without its "/", see dispatch() */
+    targets := []*govfsFile{ i }
+    if (i.flags & FLAG_DIRECTORY) > 0 {
+        for _, key := range []string{ i.filename, strings.TrimSuffix(i.filename, "/") } {
+            if other := f.check(key); other != nil && other != i && other.filename == i.filename {
+                targets = append(targets, other)
+            }
+        }
+    }
+
+    for _, file := range targets {
+        file.lock.Lock()
+        owner, size := fileOwner(file), file.size
+        if (ioh.flags & FLAG_REMOVE_XATTR) > 0 {
+            delete(file.xattrs, ioh.attr)
+        } else {
+            if file.xattrs == nil {
+                file.xattrs = make(map[string]string)
+            }
+            file.xattrs[ioh.attr] = string(ioh.data)
+        }
+        if ioh.attr == OWNER_XATTR && file == i && (file.flags & FLAG_DIRECTORY) == 0 {
+            /* The bytes of the file move to its new owner */
+            f.usage.own(owner, -size)
+            f.usage.own(fileOwner(file), size)
+        }
+        file.lock.Unlock()
+    }
+    f.markDirty(i.filename, i)
+
+    return nil
+}
+
+/*
+ * Returns the value of the attribute `attr`, ErrNoAttribute if it is not set
+ */
+func (f *FSHeader) GetXattr(name string, attr string) (string, error) {
+    attrs, err := f.Xattrs(name)
+    if err != nil {
+        return "", err
+    }
+
+    value, ok := attrs[attr]
+    if ok == false {
+        return "", pathError("getxattr", name, ErrNoAttribute)
+    }
+
+    return value, nil
+}
+
+/*
+ * Returns a copy of all attributes of a file or directory
+ */
+func (f *FSHeader) Xattrs(name string) (map[string]string, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+
+    file := f.check(name)
+    if file == nil {
+        return nil, pathError("getxattr", name, ErrNotExist)
+    }
+
+    file.lock.Lock()
+    defer file.lock.Unlock()
+
+    output := copyXattrs(file.xattrs)
+    if output == nil {
+        output = make(map[string]string)
+    }
+
+    return output, nil
+}
+
+/*
+ * Adds tags to a file or directory. Tags may not be empty, nor contain white space,
+ *  TAG_SEPARATOR, "=" or parentheses, see Find()
+ */
+func (f *FSHeader) AddTags(name string, tags ...string) error {
+    return f.updateTags(name, func (set map[string]bool) error {
+        for _, tag := range tags {
+            if validTag(tag) == false {
+                return pathError("tag", name, retErrStr("Invalid tag " + tag))
+            }
+            set[tag] = true
+        }
+        return nil
+    })
+}
+
+func (f *FSHeader) RemoveTags(name string, tags ...string) error {
+    return f.updateTags(name, func (set map[string]bool) error {
+        for _, tag := range tags {
+            delete(set, tag)
+        }
+        return nil
+    })
+}
+
+/*
+ * Returns the tags of a file or directory, sorted
+ */
+func (f *FSHeader) Tags(name string) ([]string, error) {
+    attrs, err := f.Xattrs(name)
+    if err != nil {
+        return nil, err
+    }
+
+    return splitTags(attrs[TAGS_XATTR]), nil
+}
+
+/*
+ * Read-modify-write of TAGS_XATTR, under the path lock so that concurrent updates of the
+ *  tags of one file are not lost
+ */
+func (f *FSHeader) updateTags(name string, update func (set map[string]bool) error) error {
+    unlock := f.lockPath(name)
+    defer unlock()
+
+    tags, err := f.Tags(name)
+    if err != nil {
+        return err
+    }
+
+    set := make(map[string]bool)
+    for _, tag := range tags {
+        set[tag] = true
+    }
+    if err := update(set); err != nil {
+        return err
+    }
+
+    if len(set) == 0 {
+        if len(tags) == 0 {
+            return nil
+        }
+        return f.RemoveXattr(name, TAGS_XATTR)
+    }
+
+    tags = tags[:0]
+    for tag := range set {
+        tags = append(tags, tag)
+    }
+    sort.Strings(tags)
+
+    return f.SetXattr(name, TAGS_XATTR, strings.Join(tags, TAG_SEPARATOR))
+}
+
+/*
+ * Returns the names of the files and directories tagged with `tag`, sorted
+ */
+func (f *FSHeader) FindByTag(tag string) ([]string, error) {
+    if validTag(tag) == false {
+        return nil, retErrStr("FindByTag: Invalid tag " + tag)
+    }
+
+    return f.Find(tag)
+}
+
+/*
+ * Returns the names of the files and directories which match `query`, sorted. A query
+ *  is made of terms, which are either a tag or attr=value, combined with AND and OR and
+ *  grouped with parentheses. AND binds tighter than OR, e.g.
+ *
+ *      (invoice OR receipt) AND year=2017
+ */
+func (f *FSHeader) Find(query string) ([]string, error) {
+    if f.isClosed() {
+        return nil, ErrClosed
+    }
+
+    expr, err := parseQuery(query)
+    if err != nil {
+        return nil, err
+    }
+
+    seen := make(map[string]bool)
+    var output []string
+    for _, file := range f.files() {
+        file.lock.Lock()
+        match := len(file.xattrs) > 0 && expr.match(file.xattrs, splitTags(file.xattrs[TAGS_XATTR]))
+        file.lock.Unlock()
+
+        if match == true && seen[file.filename] == false {
+            seen[file.filename] = true
+            output = append(output, file.filename)
+        }
+    }
+    sort.Strings(output)
+
+    return output, nil
+}
+
+func copyXattrs(attrs map[string]string) map[string]string {
+    if len(attrs) == 0 {
+        return nil
+    }
+
+    output := make(map[string]string, len(attrs))
+    for k, v := range attrs {
+        output[k] = v
+    }
+
+    return output
+}
+
+func xattrNames(attrs map[string]string) []string {
+    var output []string
+    for k := range attrs {
+        output = append(output, k)
+    }
+    sort.Strings(output)
+
+    return output
+}
+
+func splitTags(value string) []string {
+    if value == "" {
+        return []string{}
+    }
+    return strings.Split(value, TAG_SEPARATOR)
+}
+
+func validTag(tag string) bool {
+    if tag == "" || tag == "AND" || tag == "OR" {
+        return false
+    }
+
+    return strings.IndexFunc(tag, func (r rune) bool {
+        return unicode.IsSpace(r) || strings.ContainsRune(TAG_SEPARATOR + "=()", r)
+    }) < 0
+}
+
+/*
+ * A parsed Find() query
+ */
+type queryExpr struct {
+    op          string /* "AND", "OR", or "" for a term */
+    left, right *queryExpr
+    attr        string /* attr=value terms */
+    value       string /* The tag, or the value of attr */
+}
+
+func (e *queryExpr) match(attrs map[string]string, tags []string) bool {
+    switch e.op {
+    case "AND":
+        return e.left.match(attrs, tags) && e.right.match(attrs, tags)
+    case "OR":
+        return e.left.match(attrs, tags) || e.right.match(attrs, tags)
+    }
+
+    if e.attr != "" {
+        value, ok := attrs[e.attr]
+        return ok == true && value == e.value
+    }
+    for _, tag := range tags {
+        if tag == e.value {
+            return true
+        }
+    }
+
+    return false
+}
+
+type queryParser struct {
+    tokens      []string
+    pos         int
+}
+
+func parseQuery(query string) (*queryExpr, error) {
+    query = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(query)
+    p := &queryParser{ tokens: strings.Fields(query) }
+    if len(p.tokens) == 0 {
+        return nil, retErrStr("Find: Empty query")
+    }
+
+    expr, err := p.or()
+    if err != nil {
+        return nil, err
+    }
+    if p.pos < len(p.tokens) {
+        return nil, retErrStr("Find: Unexpected " + p.tokens[p.pos])
+    }
+
+    return expr, nil
+}
+
+func (p *queryParser) next() string {
+    if p.pos >= len(p.tokens) {
+        return ""
+    }
+    return p.tokens[p.pos]
+}
+
+func (p *queryParser) or() (*queryExpr, error) {
+    left, err := p.and()
+    for err == nil && p.next() == "OR" {
+        p.pos += 1
+        var right *queryExpr
+        if right, err = p.and(); err == nil {
+            left = &queryExpr{ op: "OR", left: left, right: right }
+        }
+    }
+
+    return left, err
+}
+
+func (p *queryParser) and() (*queryExpr, error) {
+    left, err := p.term()
+    for err == nil && p.next() == "AND" {
+        p.pos += 1
+        var right *queryExpr
+        if right, err = p.term(); err == nil {
+            left = &queryExpr{ op: "AND", left: left, right: right }
+        }
+    }
+
+    return left, err
+}
+
+func (p *queryParser) term() (*queryExpr, error) {
+    token := p.next()
+    p.pos += 1
+
+    switch {
+    case token == "(":
+        expr, err := p.or()
+        if err != nil {
+            return nil, err
+        }
+        if p.next() != ")" {
+            return nil, retErrStr("Find: Missing )")
+        }
+        p.pos += 1
+        return expr, nil
+    case token == "", token == ")", token == "AND", token == "OR":
+        return nil, retErrStr("Find: Expected a tag or attr=value instead of \"" + token + "\"")
+    case strings.Contains(token, "="):
+        attr, value, _ := strings.Cut(token, "=")
+        if attr == "" {
+            return nil, retErrStr("Find: Invalid term " + token)
+        }
+        return &queryExpr{ attr: attr, value: value }, nil
+    }
+
+    return &queryExpr{ value: token }, nil
+}
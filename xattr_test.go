@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017 AlexRuzin (stan.ruzin@gmail.com)
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+
+package govfs
+
+import (
+    "errors"
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestXattr(t *testing.T) {
+    debugOut("[+] Running Extended Attribute Test...")
+
+    var filename = gen_raw_filename("xattr")
+    os.Remove(filename)
+    defer os.Remove(filename)
+
+    header, err := CreateDatabaseConfig(filename, FLAG_DB_CREATE, &DBConfig{ Audit: true })
+    if header == nil || err != nil {
+        drive_fail("TEST1: Failed to create database", t)
+    }
+    header.StartIOController()
+
+    header.Create("/docs/a.txt")
+    header.Write("/docs/a.txt", []byte("a"))
+    if err := header.SetXattr("/docs/a.txt", "author", "alex"); err != nil {
+        drive_fail("TEST2: Failed to set an attribute", t)
+    }
+    if value, err := header.GetXattr("/docs/a.txt", "author"); err != nil || value != "alex" {
+        drive_fail("TEST3: Invalid attribute value", t)
+    }
+    if _, err := header.GetXattr("/docs/a.txt", "missing"); !errors.Is(err, ErrNoAttribute) {
+        drive_fail("TEST4: Missing attribute did not fail with ErrNoAttribute", t)
+    }
+    if err := header.SetXattr("/missing", "author", "alex"); !errors.Is(err, ErrNotExist) {
+        drive_fail("TEST5: Attribute of a missing file did not fail with ErrNotExist", t)
+    }
+    if err := header.RemoveXattr("/docs/a.txt", "missing"); !errors.Is(err, ErrNoAttribute) {
+        drive_fail("TEST6: Removal of a missing attribute did not fail with ErrNoAttribute", t)
+    }
+    if entries := header.Audit(AuditQuery{}); entries[len(entries) - 1].Op != LOG_XATTR {
+        drive_fail("TEST7: Attribute change was not audited", t)
+    }
+
+    header.AddTags("/docs/a.txt", "invoice", "2017")
+    header.AddTags("/docs/a.txt", "paid")
+    header.RemoveTags("/docs/a.txt", "2017")
+    if tags, _ := header.Tags("/docs/a.txt"); strings.Join(tags, " ") != "invoice paid" {
+        drive_fail("TEST8: Invalid tags", t)
+    }
+    if err := header.AddTags("/docs/a.txt", "two words"); err == nil {
+        drive_fail("TEST9: Added an invalid tag", t)
+    }
+
+    header.Create("/docs/b.txt")
+    header.AddTags("/docs/b.txt", "receipt")
+    header.SetXattr("/docs/b.txt", "author", "alex")
+    header.Create("/photos/")
+    header.AddTags("/photos/", "invoice")
+
+    if err := header.UnmountDB(0); err != nil {
+        drive_fail("TEST10: Failed to commit database", t)
+    }
+    header.Close()
+
+    loaded, err := CreateDatabaseConfig(filename, FLAG_DB_LOAD, &DBConfig{ Audit: true })
+    if loaded == nil || err != nil {
+        drive_fail("TEST11: Failed to load database", t)
+    }
+    loaded.StartIOController()
+    defer loaded.Close()
+
+    if value, _ := loaded.GetXattr("/docs/a.txt", "author"); value != "alex" {
+        drive_fail("TEST12: Attribute was not committed", t)
+    }
+    if names, err := loaded.FindByTag("invoice"); err != nil || strings.Join(names, " ") != "/docs/a.txt /photos/" {
+        drive_fail("TEST13: Invalid files by tag: " + strings.Join(names, " "), t)
+    }
+
+    queries := map[string]string{
+        "invoice AND paid": "/docs/a.txt",
+        "(invoice OR receipt) AND author=alex": "/docs/a.txt /docs/b.txt",
+        "receipt OR invoice AND paid": "/docs/a.txt /docs/b.txt",
+        "author=nobody": "",
+    }
+    for query, expected := range queries {
+        if names, err := loaded.Find(query); err != nil || strings.Join(names, " ") != expected {
+            drive_fail("TEST14: Invalid result of " + query + ": " + strings.Join(names, " "), t)
+        }
+    }
+    for _, query := range []string{ "", "invoice AND", "(invoice", "OR paid", "=x" } {
+        if _, err := loaded.Find(query); err == nil {
+            drive_fail("TEST15: Invalid query " + query + " was accepted", t)
+        }
+    }
+
+    debugOut("[+] Extended Attribute Test PASS")
+}